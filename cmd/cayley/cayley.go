@@ -49,6 +49,7 @@ import (
 	_ "github.com/cayleygraph/cayley/writer"
 
 	// Load supported query languages
+	_ "github.com/cayleygraph/cayley/query/bgp"
 	_ "github.com/cayleygraph/cayley/query/gizmo"
 	_ "github.com/cayleygraph/cayley/query/graphql"
 	_ "github.com/cayleygraph/cayley/query/mql"
@@ -79,6 +80,7 @@ var (
 			graph.IgnoreDuplicates = viper.GetBool("load.ignore_duplicates")
 			graph.IgnoreMissing = viper.GetBool("load.ignore_missing")
 			quad.DefaultBatch = viper.GetInt("load.batch")
+			quad.SkolemBase = viper.GetString("load.skolem_base")
 			return nil
 		},
 	}
@@ -120,11 +122,15 @@ func init() {
 		command.NewLoadDatabaseCmd(),
 		command.NewDumpDatabaseCmd(),
 		command.NewUpgradeCmd(),
+		command.NewCompactCmd(),
+		command.NewVerifyCmd(),
 		command.NewReplCmd(),
 		command.NewQueryCmd(),
 		command.NewHttpCmd(),
 		command.NewConvertCmd(),
 		command.NewDedupCommand(),
+		command.NewDiffCmd(),
+		command.NewBenchmarkCmd(),
 	)
 	rootCmd.PersistentFlags().StringP("config", "c", "", "path to an explicit configuration file")
 
@@ -136,6 +142,7 @@ func init() {
 	rootCmd.PersistentFlags().Bool("dup", true, "don't stop loading on duplicated on add")
 	rootCmd.PersistentFlags().Bool("missing", false, "don't stop loading on missing key on delete")
 	rootCmd.PersistentFlags().Int("batch", quad.DefaultBatch, "size of quads batch to load at once")
+	rootCmd.PersistentFlags().String("skolem_base", quad.SkolemBase, "authority IRI for skolemized blank nodes (ex: http://example.com)")
 
 	rootCmd.PersistentFlags().String("memprofile", "", "path to output memory profile")
 	rootCmd.PersistentFlags().String("cpuprofile", "", "path to output cpu profile")
@@ -147,6 +154,7 @@ func init() {
 	viper.BindPFlag("load.ignore_duplicates", rootCmd.PersistentFlags().Lookup("dup"))
 	viper.BindPFlag("load.ignore_missing", rootCmd.PersistentFlags().Lookup("missing"))
 	viper.BindPFlag(command.KeyLoadBatch, rootCmd.PersistentFlags().Lookup("batch"))
+	viper.BindPFlag("load.skolem_base", rootCmd.PersistentFlags().Lookup("skolem_base"))
 
 	// make both store.path and store.address work
 	viper.RegisterAlias(command.KeyPath, command.KeyAddress)
@@ -0,0 +1,362 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	workloadLoad  = "load"
+	workloadQuery = "query"
+	workloadMixed = "mixed"
+)
+
+func NewBenchmarkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "benchmark",
+		Aliases: []string{"bench"},
+		Short:   "Run a synthetic workload against the database and report its performance.",
+		Long: `Run a synthetic workload against the database and report its performance.
+
+The "load" workload generates a random graph and writes it to the database.
+The "query" workload runs a suite of queries against a graph generated earlier
+with the same --nodes and --predicates values. The "mixed" workload does both.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			p := mustSetupProfile(cmd)
+			defer mustFinishProfile(p)
+
+			workload, _ := cmd.Flags().GetString("workload")
+			switch workload {
+			case workloadLoad, workloadQuery, workloadMixed:
+			default:
+				return fmt.Errorf("unknown workload: %q", workload)
+			}
+			var g benchGraph
+			g.Nodes, _ = cmd.Flags().GetInt("nodes")
+			g.Quads, _ = cmd.Flags().GetInt("quads")
+			g.Predicates, _ = cmd.Flags().GetInt("predicates")
+			g.Skew, _ = cmd.Flags().GetFloat64("skew")
+			g.Seed, _ = cmd.Flags().GetInt64("seed")
+			if err := g.validate(); err != nil {
+				return err
+			}
+			runs, _ := cmd.Flags().GetInt("runs")
+			if runs <= 0 {
+				return errors.New("number of runs must be positive")
+			}
+
+			h, err := openForQueries(cmd)
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+
+			ctx, cancel := getContext()
+			defer cancel()
+
+			rep := benchReport{
+				Backend:  viper.GetString(KeyBackend),
+				Workload: workload,
+				Graph:    g,
+			}
+			if workload != workloadQuery {
+				clog.Infof("loading %d quads...", g.Quads)
+				res, err := g.load(ctx, h.QuadWriter, viper.GetInt(KeyLoadBatch))
+				if err != nil {
+					return err
+				}
+				rep.Load = res
+			}
+			if workload != workloadLoad {
+				for i, q := range benchQueries {
+					clog.Infof("running %q query...", q.Name)
+					// same inputs for all backends, but different for each query
+					in := g.newInput(g.Seed + int64(i) + 1)
+					res, err := runBenchQuery(ctx, h.QuadStore, q, in, runs)
+					if err != nil {
+						return err
+					}
+					rep.Queries = append(rep.Queries, res)
+				}
+			}
+			if js, _ := cmd.Flags().GetBool("json"); js {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(rep)
+			}
+			return rep.print(os.Stdout)
+		},
+	}
+	cmd.Flags().Bool("init", false, "initialize the database before using it")
+	registerLoadFlags(cmd)
+	cmd.Flags().String("workload", workloadMixed, `workload to run: "load", "query" or "mixed"`)
+	cmd.Flags().Int("nodes", 10000, "number of nodes in the generated graph")
+	cmd.Flags().Int("quads", 50000, "number of quads in the generated graph")
+	cmd.Flags().Int("predicates", 10, "number of distinct predicates in the generated graph")
+	cmd.Flags().Float64("skew", 1.5, "skew of predicates and objects (Zipf exponent, greater than 1); 0 for uniform distribution")
+	cmd.Flags().Int64("seed", 1, "seed for the random generator")
+	cmd.Flags().Int("runs", 100, "number of times to run each query")
+	cmd.Flags().Bool("json", false, "print the report as JSON")
+	return cmd
+}
+
+// benchGraph describes a synthetic graph used by the benchmark.
+type benchGraph struct {
+	Nodes      int     `json:"nodes"`
+	Quads      int     `json:"quads"`
+	Predicates int     `json:"predicates"`
+	Skew       float64 `json:"skew"`
+	Seed       int64   `json:"seed"`
+}
+
+func (g benchGraph) validate() error {
+	if g.Nodes < 2 || g.Predicates < 1 || g.Quads < 1 {
+		return errors.New("graph must have at least 2 nodes, 1 predicate and 1 quad")
+	}
+	if g.Skew != 0 && g.Skew <= 1 {
+		return errors.New("skew must be greater than 1, or 0 for uniform distribution")
+	}
+	return nil
+}
+
+func benchNode(i int) quad.IRI { return quad.IRI("n" + strconv.Itoa(i)) }
+func benchPred(i int) quad.IRI { return quad.IRI("p" + strconv.Itoa(i)) }
+
+// sampler returns a function that picks values in [0, n) according to the skew of the graph.
+func (g benchGraph) sampler(r *rand.Rand, n int) func() int {
+	if g.Skew == 0 || n < 2 {
+		return func() int { return r.Intn(n) }
+	}
+	z := rand.NewZipf(r, g.Skew, 1, uint64(n-1))
+	return func() int { return int(z.Uint64()) }
+}
+
+// benchInput picks random nodes and predicates for queries.
+type benchInput struct {
+	nodes func() int
+	preds func() int
+	objs  func() int
+}
+
+func (g benchGraph) newInput(seed int64) *benchInput {
+	r := rand.New(rand.NewSource(seed))
+	return &benchInput{
+		nodes: func() int { return r.Intn(g.Nodes) },
+		preds: g.sampler(r, g.Predicates),
+		objs:  g.sampler(r, g.Nodes),
+	}
+}
+
+// Node returns a node picked uniformly.
+func (in *benchInput) Node() quad.IRI { return benchNode(in.nodes()) }
+
+// Pred returns a predicate, with popular predicates picked more often.
+func (in *benchInput) Pred() quad.IRI { return benchPred(in.preds()) }
+
+// Object returns a node, with popular objects picked more often.
+func (in *benchInput) Object() quad.IRI { return benchNode(in.objs()) }
+
+// load generates the graph and writes it in batches.
+func (g benchGraph) load(ctx context.Context, qw graph.QuadWriter, batch int) (*benchResult, error) {
+	if batch <= 0 {
+		batch = quad.DefaultBatch
+	}
+	in := g.newInput(g.Seed)
+	seen := make(map[quad.Quad]struct{}, g.Quads)
+	buf := make([]quad.Quad, 0, batch)
+	var lat []time.Duration
+	m := startMeasure()
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		start := time.Now()
+		if err := qw.AddQuadSet(buf); err != nil {
+			return err
+		}
+		lat = append(lat, time.Since(start))
+		buf = buf[:0]
+		return nil
+	}
+	// random quads may repeat; give up on dense graphs instead of looping forever
+	for tries := 0; len(seen) < g.Quads && tries < 10*g.Quads; tries++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		q := quad.Quad{Subject: in.Node(), Predicate: in.Pred(), Object: in.Object()}
+		if _, ok := seen[q]; ok {
+			continue
+		}
+		seen[q] = struct{}{}
+		buf = append(buf, q)
+		if len(buf) >= batch {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(seen) < g.Quads {
+		clog.Warningf("generated only %d unique quads out of %d", len(seen), g.Quads)
+	}
+	res := m.result("load", lat, int64(len(seen)))
+	res.Results = int64(len(seen))
+	return res, nil
+}
+
+// benchQuery is a query that is run by the benchmark with random inputs.
+type benchQuery struct {
+	Name  string
+	Build func(qs graph.QuadStore, in *benchInput) *path.Path
+}
+
+var benchQueries = []benchQuery{
+	{Name: "point", Build: func(qs graph.QuadStore, in *benchInput) *path.Path {
+		return path.StartPath(qs, in.Node()).Out(in.Pred())
+	}},
+	{Name: "two-hop", Build: func(qs graph.QuadStore, in *benchInput) *path.Path {
+		return path.StartPath(qs, in.Node()).Out(in.Pred()).Out(in.Pred())
+	}},
+	{Name: "co-star", Build: func(qs graph.QuadStore, in *benchInput) *path.Path {
+		// nodes that share objects with both start nodes
+		p := in.Pred()
+		return path.StartPath(qs, in.Node()).Out(p).In(p).
+			And(path.StartPath(qs, in.Node()).Out(p).In(p))
+	}},
+	{Name: "has", Build: func(qs graph.QuadStore, in *benchInput) *path.Path {
+		return path.StartPath(qs).Has(in.Pred(), in.Object())
+	}},
+	{Name: "count", Build: func(qs graph.QuadStore, in *benchInput) *path.Path {
+		p := in.Pred()
+		return path.StartPath(qs, in.Object()).In(p).Out(p).Count()
+	}},
+}
+
+// runBenchQuery executes the query a given number of times and iterates all results.
+func runBenchQuery(ctx context.Context, qs graph.QuadStore, q benchQuery, in *benchInput, runs int) (*benchResult, error) {
+	lat := make([]time.Duration, 0, runs)
+	var n int64
+	m := startMeasure()
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		it := q.Build(qs, in).BuildIterator()
+		err := graph.Iterate(ctx, it).Each(func(graph.Value) {
+			n++
+		})
+		it.Close()
+		if err != nil {
+			return nil, fmt.Errorf("query %q failed: %v", q.Name, err)
+		}
+		lat = append(lat, time.Since(start))
+	}
+	res := m.result(q.Name, lat, int64(runs))
+	res.Results = n
+	return res, nil
+}
+
+// measure tracks time and memory allocations of a benchmark step.
+type measure struct {
+	start time.Time
+	mem   runtime.MemStats
+}
+
+func startMeasure() *measure {
+	m := &measure{start: time.Now()}
+	runtime.ReadMemStats(&m.mem)
+	return m
+}
+
+// result computes throughput and latency percentiles. Ops is a number of operations
+// performed, i.e. queries or quads written.
+func (m *measure) result(name string, lat []time.Duration, ops int64) *benchResult {
+	total := time.Since(m.start)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	res := &benchResult{Name: name, Ops: ops, Total: total}
+	if total > 0 {
+		res.OpsPerSec = float64(ops) / total.Seconds()
+	}
+	if ops > 0 {
+		res.AllocsPerOp = (mem.Mallocs - m.mem.Mallocs) / uint64(ops)
+		res.BytesPerOp = (mem.TotalAlloc - m.mem.TotalAlloc) / uint64(ops)
+	}
+	if len(lat) == 0 {
+		return res
+	}
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	var sum time.Duration
+	for _, d := range lat {
+		sum += d
+	}
+	pct := func(p float64) time.Duration {
+		return lat[int(p*float64(len(lat)-1)+0.5)]
+	}
+	res.Mean = sum / time.Duration(len(lat))
+	res.P50, res.P90, res.P99 = pct(0.5), pct(0.9), pct(0.99)
+	res.Max = lat[len(lat)-1]
+	return res
+}
+
+// benchResult is a summary of a single benchmark step. Latencies are measured per
+// query, or per batch for the load step. Durations are encoded in nanoseconds.
+type benchResult struct {
+	Name        string        `json:"name"`
+	Ops         int64         `json:"ops"`
+	Results     int64         `json:"results"`
+	Total       time.Duration `json:"total"`
+	OpsPerSec   float64       `json:"ops_per_sec"`
+	Mean        time.Duration `json:"mean"`
+	P50         time.Duration `json:"p50"`
+	P90         time.Duration `json:"p90"`
+	P99         time.Duration `json:"p99"`
+	Max         time.Duration `json:"max"`
+	AllocsPerOp uint64        `json:"allocs_per_op"`
+	BytesPerOp  uint64        `json:"bytes_per_op"`
+}
+
+type benchReport struct {
+	Backend  string         `json:"backend"`
+	Workload string         `json:"workload"`
+	Graph    benchGraph     `json:"graph"`
+	Load     *benchResult   `json:"load,omitempty"`
+	Queries  []*benchResult `json:"queries,omitempty"`
+}
+
+// print writes the report as a table.
+func (r benchReport) print(w io.Writer) error {
+	fmt.Fprintf(w, "backend: %s, workload: %s, graph: %d nodes, %d quads, %d predicates, skew %v\n\n",
+		r.Backend, r.Workload, r.Graph.Nodes, r.Graph.Quads, r.Graph.Predicates, r.Graph.Skew)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "step\tops\tops/s\tmean\tp50\tp90\tp99\tmax\tallocs/op\tB/op\tresults\t")
+	rows := r.Queries
+	if r.Load != nil {
+		rows = append([]*benchResult{r.Load}, rows...)
+	}
+	for _, s := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%v\t%v\t%v\t%v\t%v\t%d\t%d\t%d\t\n",
+			s.Name, s.Ops, s.OpsPerSec, s.Mean, s.P50, s.P90, s.P99, s.Max,
+			s.AllocsPerOp, s.BytesPerOp, s.Results)
+	}
+	return tw.Flush()
+}
@@ -70,6 +70,12 @@ func (r *multiReader) Close() error {
 	return nil
 }
 
+// scopedReader is a quad reader that renames blank nodes, closing the original reader.
+type scopedReader struct {
+	quad.Reader
+	io.Closer
+}
+
 func NewConvertCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "convert",
@@ -92,6 +98,15 @@ func NewConvertCmd() *cobra.Command {
 				return errors.New("both input and output files must be specified")
 			}
 			loadf, _ := cmd.Flags().GetString(flagLoadFormat)
+			bnodes, _ := cmd.Flags().GetString(flagBNodes)
+			mode, err := quad.BNodeModeByName(bnodes)
+			if err != nil {
+				return err
+			}
+			v, err := validationFlags(cmd)
+			if err != nil {
+				return err
+			}
 			var multi multiReader
 			for _, path := range files {
 				path := path
@@ -101,11 +116,23 @@ func NewConvertCmd() *cobra.Command {
 					} else {
 						fmt.Printf("reading %q\n", path)
 					}
-					return internal.QuadReaderFor(path, loadf)
+					qr, err := internal.QuadReaderFor(path, loadf)
+					if err != nil {
+						return nil, err
+					}
+					// blank nodes are scoped to each file
+					return scopedReader{Reader: quad.ScopeBNodes(qr, mode), Closer: qr}, nil
 				}))
 			}
+			var qr quad.Reader = quad.ValidateQuads(&multi, v)
+			if unskolem, _ := cmd.Flags().GetBool(flagUnskolemize); unskolem {
+				qr = quad.Unskolemize(qr)
+			}
+			if drop, _ := cmd.Flags().GetBool(flagDropLabels); drop {
+				qr = quad.DropLabels(qr)
+			}
 			// TODO: print additional stats
-			return writerQuadsTo(dump, dumpf, &multi)
+			return writerQuadsTo(dump, dumpf, qr)
 		},
 	}
 	registerLoadFlags(cmd)
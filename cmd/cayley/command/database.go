@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -15,8 +16,10 @@ import (
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/kv"
 	"github.com/cayleygraph/cayley/internal"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/csv"
 )
 
 const (
@@ -34,6 +37,21 @@ const (
 	flagLoadFormat = "load_format"
 	flagDump       = "dump"
 	flagDumpFormat = "dump_format"
+
+	flagMapping         = "mapping"
+	flagContinueOnError = "continue_on_error"
+	flagBNodes          = "bnodes"
+	flagValidate        = "validate"
+	flagNFC             = "nfc"
+	flagUnskolemize     = "unskolemize"
+	flagDropLabels      = "drop_labels"
+	flagCanonical       = "canonical"
+	flagInitIfMissing   = "init_if_missing"
+	flagCheckpoint      = "checkpoint"
+	flagResume          = "resume"
+
+	flagHandle          = "handle"
+	flagReadOnlyHandles = "read_only_handles"
 )
 
 var ErrNotPersistent = errors.New("database type is not persistent")
@@ -49,6 +67,48 @@ func registerLoadFlags(cmd *cobra.Command) {
 	}
 	sort.Strings(names)
 	cmd.Flags().String(flagLoadFormat, "", `quad file format to use for loading instead of auto-detection ("`+strings.Join(names, `", "`)+`")`)
+	cmd.Flags().String(flagBNodes, quad.BNodeScope.String(), `blank nodes handling: "scope" renames them to be unique for each load, "skolem" replaces them with unique IRIs, "preserve" keeps labels as-is`)
+	cmd.Flags().String(flagValidate, quad.ValidateLenient.String(), `quad validation: "lenient" normalizes quads before checking them, "strict" rejects quads that are not in a canonical form, "none" disables checks`)
+	cmd.Flags().Bool(flagNFC, false, "normalize literals to Unicode NFC (rejected in strict mode, if not normalized)")
+}
+
+// validationFlags returns quad validation rules requested by the flags.
+func validationFlags(cmd *cobra.Command) (quad.Validation, error) {
+	name, _ := cmd.Flags().GetString(flagValidate)
+	mode, err := quad.ValidationModeByName(name)
+	if err != nil {
+		return quad.Validation{}, err
+	}
+	nfc, _ := cmd.Flags().GetBool(flagNFC)
+	return quad.Validation{Mode: mode, CanonicalOptions: quad.CanonicalOptions{NFC: nfc}}, nil
+}
+
+// loadQuads loads a quad file, handling blank nodes, validation and checkpoints according to the flags.
+// Loaded quads are attributed to the file in the change history.
+func loadQuads(cmd *cobra.Command, h *graph.Handle, path, typ string) error {
+	name, _ := cmd.Flags().GetString(flagBNodes)
+	mode, err := quad.BNodeModeByName(name)
+	if err != nil {
+		return err
+	}
+	v, err := validationFlags(cmd)
+	if err != nil {
+		return err
+	}
+	every, _ := cmd.Flags().GetInt(flagCheckpoint)
+	resume, _ := cmd.Flags().GetBool(flagResume)
+	actor := path
+	if path == "-" {
+		actor = "stdin"
+	}
+	qw := graph.WriterWithActor(h.QuadWriter, actor)
+	if every <= 0 && !resume {
+		return internal.DecompressAndLoad(qw, quad.DefaultBatch, path, typ, mode, v)
+	}
+	hz, _ := h.QuadStore.(graph.Horizoner)
+	return internal.LoadWithCheckpoints(qw, quad.DefaultBatch, path, typ, mode, v, internal.CheckpointOptions{
+		Every: every, Resume: resume, Horizon: hz,
+	})
 }
 
 func registerDumpFlags(cmd *cobra.Command) {
@@ -61,6 +121,11 @@ func registerDumpFlags(cmd *cobra.Command) {
 	}
 	sort.Strings(names)
 	cmd.Flags().String(flagDumpFormat, "", `quad file format to use instead of auto-detection ("`+strings.Join(names, `", "`)+`")`)
+	cmd.Flags().Bool(flagUnskolemize, false, "convert IRIs generated for blank nodes (see --bnodes) back to blank nodes")
+	cmd.Flags().Bool(flagDropLabels, false, `remove labels of quads; required to write labeled quads in formats without labels ("ntriples")`)
+	cmd.Flags().Bool(flagCanonical, false, "write distinct quads sorted by subject, predicate, object and label, and renumber blank nodes in this order")
+	cmd.Flags().Int(flagSortChunk, internal.DefaultSortChunk, "number of quads to sort in memory before spilling them to disk (see --canonical)")
+	cmd.Flags().String(flagSortDir, "", "directory for temporary sort files (see --canonical)")
 }
 
 func NewInitDatabaseCmd() *cobra.Command {
@@ -113,13 +178,17 @@ func NewLoadDatabaseCmd() *cobra.Command {
 
 			// TODO: check read-only flag in config before that?
 			typ, _ := cmd.Flags().GetString(flagLoadFormat)
-			if err = internal.Load(h.QuadWriter, quad.DefaultBatch, load, typ); err != nil {
+			if mpath, _ := cmd.Flags().GetString(flagMapping); mpath != "" || typ == "csv" || typ == "tsv" {
+				err = loadTable(cmd, h.QuadWriter, load, typ, mpath)
+			} else {
+				err = loadQuads(cmd, h, load, typ)
+			}
+			if err != nil {
 				return err
 			}
 
 			if dump, _ := cmd.Flags().GetString(flagDump); dump != "" {
-				typ, _ := cmd.Flags().GetString(flagDumpFormat)
-				if err = dumpDatabase(h, dump, typ); err != nil {
+				if err = dumpDatabase(h, dump, dumpOptionsFromFlags(cmd)); err != nil {
 					return err
 				}
 			}
@@ -127,11 +196,41 @@ func NewLoadDatabaseCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().Bool("init", false, "initialize the database before using it")
+	cmd.Flags().String(flagMapping, "", `JSON file with a column mapping for loading CSV and TSV tables ("csv" or "tsv" load format)`)
+	cmd.Flags().Bool(flagContinueOnError, false, "skip table rows that cannot be converted instead of failing the load")
+	cmd.Flags().Int(flagCheckpoint, 0, "save a progress of the load every N batches to a checkpoint file next to the quad file")
+	cmd.Flags().Bool(flagResume, false, "resume an interrupted load from its checkpoint file (see --checkpoint)")
 	registerLoadFlags(cmd)
 	registerDumpFlags(cmd)
 	return cmd
 }
 
+func loadTable(cmd *cobra.Command, qw graph.QuadWriter, path, typ, mpath string) error {
+	if mpath == "" {
+		return errors.New("column mapping must be specified for loading tables")
+	}
+	f, err := os.Open(mpath)
+	if err != nil {
+		return err
+	}
+	m, err := csv.ReadMapping(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read mapping: %v", err)
+	}
+	var onErr func(err *csv.RowError)
+	if skip, _ := cmd.Flags().GetBool(flagContinueOnError); skip {
+		onErr = func(err *csv.RowError) {
+			clog.Warningf("skipping row: %v", err)
+		}
+	}
+	v, err := validationFlags(cmd)
+	if err != nil {
+		return err
+	}
+	return internal.LoadTable(qw, quad.DefaultBatch, path, typ, *m, onErr, v)
+}
+
 func NewDumpDatabaseCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "dump",
@@ -151,8 +250,7 @@ func NewDumpDatabaseCmd() *cobra.Command {
 			}
 			defer h.Close()
 
-			typ, _ := cmd.Flags().GetString(flagDumpFormat)
-			return dumpDatabase(h, dump, typ)
+			return dumpDatabase(h, dump, dumpOptionsFromFlags(cmd))
 		},
 	}
 	registerDumpFlags(cmd)
@@ -178,6 +276,90 @@ func NewUpgradeCmd() *cobra.Command {
 	return cmd
 }
 
+// compactor is implemented by quad stores that support soft deletes (see "tombstones" option of KV backends).
+type compactor interface {
+	Horizon() graph.PrimaryKey
+	Compact(ctx context.Context, horizon int64) error
+}
+
+func NewCompactCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Purge deleted quads from the database.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			name := viper.GetString(KeyBackend)
+			if graph.IsRegistered(name) && !graph.IsPersistent(name) {
+				return ErrNotPersistent
+			}
+			keep, err := cmd.Flags().GetInt64("keep")
+			if err != nil {
+				return err
+			}
+			h, err := openDatabase()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+
+			qs, ok := h.QuadStore.(compactor)
+			if !ok {
+				return fmt.Errorf("compaction is not supported by %q backend", name)
+			}
+			horizon := qs.Horizon().Int() - keep
+			clog.Infof("purging quads deleted at or before horizon %d...", horizon)
+			return qs.Compact(context.Background(), horizon)
+		},
+	}
+	cmd.Flags().Int64("keep", 0, "number of the latest horizon values to retain deleted quads for")
+	return cmd
+}
+
+// hashVerifier is implemented by quad stores that key nodes by hashes of their values (see KV backends).
+type hashVerifier interface {
+	VerifyHashes(ctx context.Context, fn func(c kv.HashCollision) error) error
+}
+
+func NewVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Scan the database for nodes with colliding hashes.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			h, err := openDatabase()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+
+			qs, ok := h.QuadStore.(hashVerifier)
+			if !ok {
+				return fmt.Errorf("verification is not supported by %q backend", viper.GetString(KeyBackend))
+			}
+			var chained, lost int
+			err = qs.VerifyHashes(context.Background(), func(c kv.HashCollision) error {
+				if c.Chained {
+					chained++
+					fmt.Printf("chained: %v (node %d, hash %x)\n", c.Value, c.ID, c.Key)
+				} else {
+					lost++
+					fmt.Printf("unreachable: %v (node %d, hash %x)\n", c.Value, c.ID, c.Key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("chained collisions: %d, unreachable nodes: %d\n", chained, lost)
+			if lost != 0 {
+				return fmt.Errorf("found %d nodes that cannot be found by their values", lost)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
 func printBackendInfo() {
 	name := viper.GetString(KeyBackend)
 	path := viper.GetString(KeyAddress)
@@ -209,6 +391,25 @@ func openDatabase() (*graph.Handle, error) {
 	return &graph.Handle{QuadStore: qs, QuadWriter: qw}, nil
 }
 
+// openError adds a hint on how to fix an error returned when opening the database.
+func openError(err error) error {
+	name := viper.GetString(KeyBackend)
+	path := viper.GetString(KeyAddress)
+	switch e := err.(type) {
+	case *graph.ErrWrongBackend:
+		if e.Found != "" {
+			return fmt.Errorf("%v; use --db=%s to open it", err, e.Found)
+		}
+		return fmt.Errorf("%v; %q does not contain a %s database, check --db and --dbpath flags", err, path, name)
+	case *graph.ErrIncompatibleVersion:
+		return fmt.Errorf("%v; run 'cayley upgrade' to convert the database", err)
+	}
+	if err == graph.ErrNotInitialized {
+		return fmt.Errorf("%v; run 'cayley init' or use --%s flag to create a database at %q", err, flagInitIfMissing, path)
+	}
+	return err
+}
+
 func openForQueries(cmd *cobra.Command) (*graph.Handle, error) {
 	if init, err := cmd.Flags().GetBool("init"); err != nil {
 		return nil, err
@@ -226,10 +427,18 @@ func openForQueries(cmd *cobra.Command) (*graph.Handle, error) {
 		viper.Set(KeyAddress, "")
 		h, err = openDatabase()
 	}
+	if err == graph.ErrNotInitialized {
+		if missing, _ := cmd.Flags().GetBool(flagInitIfMissing); missing {
+			clog.Infof("database is not initialized, creating a new one")
+			if err = initDatabase(); err == nil {
+				h, err = openDatabase()
+			}
+		}
+	}
 	if err == graph.ErrQuadStoreNotPersistent {
 		return nil, fmt.Errorf("%v; did you mean -i flag?", err)
 	} else if err != nil {
-		return nil, err
+		return nil, openError(err)
 	}
 
 	if load2, _ := cmd.Flags().GetString(flagLoad); load2 != "" {
@@ -243,7 +452,7 @@ func openForQueries(cmd *cobra.Command) (*graph.Handle, error) {
 		typ, _ := cmd.Flags().GetString(flagLoadFormat)
 		// TODO: check read-only flag in config before that?
 		start := time.Now()
-		if err = internal.Load(h.QuadWriter, quad.DefaultBatch, load, typ); err != nil {
+		if err = loadQuads(cmd, h, load, typ); err != nil {
 			h.Close()
 			return nil, err
 		}
@@ -252,6 +461,83 @@ func openForQueries(cmd *cobra.Command) (*graph.Handle, error) {
 	return h, nil
 }
 
+func registerHandleFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray(flagHandle, nil, `additional named database in the "name=backend:path" form (can be repeated)`)
+	cmd.Flags().StringSlice(flagReadOnlyHandles, nil, "names of additional databases that cannot be written to (see --handle)")
+}
+
+// openHandles opens additional named databases requested by the flags.
+// Databases of non-persistent backends are created empty and the path is loaded into them.
+func openHandles(cmd *cobra.Command) ([]graph.NamedHandle, error) {
+	specs, _ := cmd.Flags().GetStringArray(flagHandle)
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	ro, _ := cmd.Flags().GetStringSlice(flagReadOnlyHandles)
+	readOnly := make(map[string]bool, len(ro))
+	for _, name := range ro {
+		readOnly[name] = true
+	}
+	opts := graph.Options(viper.GetStringMap(KeyOptions))
+	var handles []graph.NamedHandle
+	for _, spec := range specs {
+		h, err := openHandle(cmd, spec, opts)
+		if err != nil {
+			closeHandles(handles)
+			return nil, err
+		}
+		h.ReadOnly = readOnly[h.Name]
+		delete(readOnly, h.Name)
+		handles = append(handles, h)
+	}
+	for name := range readOnly {
+		closeHandles(handles)
+		return nil, fmt.Errorf("read-only handle %q is not defined", name)
+	}
+	return handles, nil
+}
+
+// openHandle opens a database described as "name=backend:path".
+func openHandle(cmd *cobra.Command, spec string, opts graph.Options) (graph.NamedHandle, error) {
+	i := strings.IndexByte(spec, '=')
+	if i <= 0 {
+		return graph.NamedHandle{}, fmt.Errorf("invalid handle %q; expected name=backend:path", spec)
+	}
+	name, backend := spec[:i], spec[i+1:]
+	var path string
+	if j := strings.IndexByte(backend, ':'); j >= 0 {
+		backend, path = backend[:j], backend[j+1:]
+	}
+	var load string
+	qs, err := graph.NewQuadStore(backend, path, opts)
+	if err == graph.ErrQuadStoreNotPersistent {
+		load = path
+		qs, err = graph.NewQuadStore(backend, "", opts)
+	}
+	if err != nil {
+		return graph.NamedHandle{}, fmt.Errorf("cannot open handle %q: %v", name, err)
+	}
+	qw, err := graph.NewQuadWriter("single", qs, opts)
+	if err != nil {
+		qs.Close()
+		return graph.NamedHandle{}, err
+	}
+	h := &graph.Handle{QuadStore: qs, QuadWriter: qw}
+	if load != "" {
+		if err = loadQuads(cmd, h, load, ""); err != nil {
+			h.Close()
+			return graph.NamedHandle{}, fmt.Errorf("cannot load handle %q: %v", name, err)
+		}
+	}
+	return graph.NamedHandle{Name: name, Handle: h}, nil
+}
+
+func closeHandles(handles []graph.NamedHandle) {
+	for _, h := range handles {
+		h.Handle.Close()
+	}
+}
+
 type profileData struct {
 	cpuProfile *os.File
 	memPath    string
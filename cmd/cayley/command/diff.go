@@ -0,0 +1,218 @@
+package command
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	flagSource     = "source"
+	flagTarget     = "target"
+	flagSourceDB   = "source_db"
+	flagTargetDB   = "target_db"
+	flagOutput     = "output"
+	flagSkipBNodes = "skip_bnodes"
+	flagSortChunk  = "sort_chunk"
+	flagSortDir    = "sort_dir"
+)
+
+func NewDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare quads of two databases or quad files.",
+		Long: `Compare quads of two databases or quad files.
+
+Source and target can be either a quad file (detected by the extension) or a path
+to a database. Blank nodes are compared by their labels.
+
+By default, the command prints quads that are only in the source (prefixed with "-")
+and only in the target (prefixed with "+"). With --output=nquads, it writes them to
+<dump>.remove.nq and <dump>.add.nq files instead; applying those files to the source
+with /api/v1/delete and /api/v1/write results in the target graph.
+
+The command exits with status 1 if any differences were found.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			source, _ := cmd.Flags().GetString(flagSource)
+			target, _ := cmd.Flags().GetString(flagTarget)
+			if source == "" && target == "" && len(args) == 2 {
+				source, target = args[0], args[1]
+			}
+			if source == "" || target == "" {
+				return errors.New("both source and target must be specified")
+			}
+			output, _ := cmd.Flags().GetString(flagOutput)
+			dump, _ := cmd.Flags().GetString(flagDump)
+			switch output {
+			case "text":
+			case "nquads":
+				if dump == "" || dump == "-" {
+					return errors.New("output file prefix must be specified for nquads output")
+				}
+			default:
+				return fmt.Errorf("unsupported output format: %q", output)
+			}
+			st, err := diffGraphs(cmd, source, target, output, dump)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("source: %d quads, target: %d quads\n", st.Source, st.Target)
+			fmt.Printf("only in source: %d, only in target: %d\n", st.OnlySource, st.OnlyTarget)
+			if st.Changed() {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String(flagSource, "", "source database path or quad file")
+	cmd.Flags().String(flagTarget, "", "target database path or quad file")
+	cmd.Flags().String(flagSourceDB, "", "database backend to use for the source (defaults to --db)")
+	cmd.Flags().String(flagTargetDB, "", "database backend to use for the target (defaults to --db)")
+	cmd.Flags().String(flagOutput, "text", `output format: "text" prints differences, "nquads" writes them as add and remove sets`)
+	cmd.Flags().StringP(flagDump, "o", "diff", `prefix of files to write the add and remove sets to (".gz" supported)`)
+	cmd.Flags().Bool(flagSkipBNodes, false, "ignore all quads that contain blank nodes")
+	cmd.Flags().Int(flagSortChunk, internal.DefaultSortChunk, "number of quads to sort in memory before spilling them to disk")
+	cmd.Flags().String(flagSortDir, "", "directory for temporary sort files")
+	return cmd
+}
+
+func diffGraphs(cmd *cobra.Command, source, target, output, dump string) (internal.DiffStats, error) {
+	src, err := sortDiffSide(cmd, source, flagSourceDB)
+	if err != nil {
+		return internal.DiffStats{}, err
+	}
+	defer src.Close()
+	dst, err := sortDiffSide(cmd, target, flagTargetDB)
+	if err != nil {
+		return internal.DiffStats{}, err
+	}
+	defer dst.Close()
+
+	if output == "text" {
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		return internal.DiffQuads(src, dst, func(l string) error {
+			_, err := fmt.Fprintln(w, "-", l)
+			return err
+		}, func(l string) error {
+			_, err := fmt.Fprintln(w, "+", l)
+			return err
+		})
+	}
+	gz := strings.HasSuffix(dump, ".gz")
+	prefix := strings.TrimSuffix(dump, ".gz")
+	remove, err := newLineWriter(prefix+".remove.nq", gz)
+	if err != nil {
+		return internal.DiffStats{}, err
+	}
+	defer remove.Close()
+	add, err := newLineWriter(prefix+".add.nq", gz)
+	if err != nil {
+		return internal.DiffStats{}, err
+	}
+	defer add.Close()
+	st, err := internal.DiffQuads(src, dst, remove.WriteLine, add.WriteLine)
+	if err != nil {
+		return st, err
+	}
+	if err = remove.Close(); err != nil {
+		return st, err
+	}
+	return st, add.Close()
+}
+
+// sortDiffSide reads all quads from a quad file or a database and sorts them.
+func sortDiffSide(cmd *cobra.Command, path, dbFlag string) (*internal.SortedQuads, error) {
+	var qr quad.ReadCloser
+	if internal.IsQuadFile(path) {
+		clog.Infof("reading quad file %q", path)
+		r, err := internal.QuadReaderFor(path, "")
+		if err != nil {
+			return nil, err
+		}
+		qr = r
+	} else {
+		name, _ := cmd.Flags().GetString(dbFlag)
+		if name == "" {
+			name = viper.GetString(KeyBackend)
+		}
+		clog.Infof("reading database %q (%s)", path, name)
+		opts := graph.Options(viper.GetStringMap(KeyOptions))
+		qs, err := graph.NewQuadStore(name, path, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer qs.Close()
+		qr = graph.NewQuadStoreReader(qs)
+	}
+	defer qr.Close()
+
+	var r quad.Reader = qr
+	if skip, _ := cmd.Flags().GetBool(flagSkipBNodes); skip {
+		r = internal.SkipBNodes(r)
+	}
+	chunk, _ := cmd.Flags().GetInt(flagSortChunk)
+	dir, _ := cmd.Flags().GetString(flagSortDir)
+	return internal.SortQuads(r, chunk, dir)
+}
+
+// lineWriter writes N-Quads lines to a file, optionally compressing it.
+type lineWriter struct {
+	f  *os.File
+	gz *gzip.Writer
+	w  *bufio.Writer
+}
+
+func newLineWriter(path string, gz bool) (*lineWriter, error) {
+	if gz {
+		path += ".gz"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create file %q: %v", path, err)
+	}
+	fmt.Printf("writing quads to file %q\n", path)
+	lw := &lineWriter{f: f}
+	var w io.Writer = f
+	if gz {
+		lw.gz = gzip.NewWriter(f)
+		w = lw.gz
+	}
+	lw.w = bufio.NewWriter(w)
+	return lw, nil
+}
+
+func (w *lineWriter) WriteLine(l string) error {
+	w.w.WriteString(l)
+	return w.w.WriteByte('\n')
+}
+
+// Close flushes and closes the file. It's safe to call it multiple times.
+func (w *lineWriter) Close() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.w.Flush()
+	if w.gz != nil {
+		if err2 := w.gz.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err2 := w.f.Close(); err == nil {
+		err = err2
+	}
+	w.f = nil
+	return err
+}
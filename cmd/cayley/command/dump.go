@@ -8,9 +8,13 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/spf13/cobra"
+
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
 )
 
 func writerQuadsTo(path string, typ string, qr quad.Reader) error {
@@ -55,7 +59,9 @@ func writerQuadsTo(path string, typ string, qr quad.Reader) error {
 	defer qw.Close()
 
 	n, err := quad.Copy(qw, qr)
-	if err != nil {
+	if err == nquads.ErrLabeledQuad {
+		return fmt.Errorf("%v; use --%s to write them as triples", err, flagDropLabels)
+	} else if err != nil {
 		return err
 	} else if err = qw.Close(); err != nil {
 		return err
@@ -66,9 +72,46 @@ func writerQuadsTo(path string, typ string, qr quad.Reader) error {
 	return nil
 }
 
-func dumpDatabase(h *graph.Handle, path string, typ string) error {
+// dumpOptions controls how dumpDatabase writes quads.
+type dumpOptions struct {
+	Format      string // format name; detected by the file extension if empty
+	Unskolemize bool   // convert generated IRIs back to blank nodes
+	DropLabels  bool   // remove labels of quads
+	Canonical   bool   // write quads in canonical order
+	SortChunk   int    // number of quads to sort in memory for canonical order
+	SortDir     string // directory for temporary sort files
+}
+
+func dumpOptionsFromFlags(cmd *cobra.Command) dumpOptions {
+	var opts dumpOptions
+	opts.Format, _ = cmd.Flags().GetString(flagDumpFormat)
+	opts.Unskolemize, _ = cmd.Flags().GetBool(flagUnskolemize)
+	opts.DropLabels, _ = cmd.Flags().GetBool(flagDropLabels)
+	opts.Canonical, _ = cmd.Flags().GetBool(flagCanonical)
+	opts.SortChunk, _ = cmd.Flags().GetInt(flagSortChunk)
+	opts.SortDir, _ = cmd.Flags().GetString(flagSortDir)
+	return opts
+}
+
+func dumpDatabase(h *graph.Handle, path string, opts dumpOptions) error {
 	//TODO: add possible support for exporting specific queries only
 	qr := graph.NewQuadStoreReader(h.QuadStore)
 	defer qr.Close()
-	return writerQuadsTo(path, typ, qr)
+	var r quad.Reader = qr
+	if opts.Unskolemize {
+		r = quad.Unskolemize(r)
+	}
+	if opts.DropLabels {
+		r = quad.DropLabels(r)
+	}
+	if opts.Canonical {
+		clog.Infof("sorting quads")
+		cr, err := internal.Canonicalize(r, opts.SortChunk, opts.SortDir)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+		r = cr
+	}
+	return writerQuadsTo(path, opts.Format, r)
 }
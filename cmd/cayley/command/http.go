@@ -9,7 +9,9 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
 	chttp "github.com/cayleygraph/cayley/internal/http"
+	cayleyhttp "github.com/cayleygraph/cayley/server/http"
 )
 
 func NewHttpCmd() *cobra.Command {
@@ -27,9 +29,36 @@ func NewHttpCmd() *cobra.Command {
 			}
 			defer h.Close()
 
+			handles, err := openHandles(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeHandles(handles)
+
+			valid, err := validationFlags(cmd)
+			if err != nil {
+				return err
+			}
+			stall, _ := cmd.Flags().GetDuration("stall_timeout")
+			qmem, _ := cmd.Flags().GetInt64("query_memory")
+			exportLimit, _ := cmd.Flags().GetInt("export_limit")
+			proxies, _ := cmd.Flags().GetStringSlice("trusted_proxy")
+			trusted, err := cayleyhttp.ParseTrustedProxies(proxies)
+			if err != nil {
+				return err
+			}
+			if mem, _ := cmd.Flags().GetInt64("memory"); mem > 0 {
+				graph.GlobalBudget.SetLimit(mem)
+			}
 			err = chttp.SetupRoutes(h, &chttp.Config{
-				Timeout:  viper.GetDuration(keyQueryTimeout),
-				ReadOnly: viper.GetBool(KeyReadOnly),
+				Timeout:        viper.GetDuration(keyQueryTimeout),
+				ReadOnly:       viper.GetBool(KeyReadOnly),
+				Validation:     valid,
+				StallTimeout:   stall,
+				QueryMemory:    qmem,
+				ExportLimit:    exportLimit,
+				TrustedProxies: trusted,
+				Handles:        handles,
 			})
 			if err != nil {
 				return err
@@ -45,9 +74,16 @@ func NewHttpCmd() *cobra.Command {
 	}
 	cmd.Flags().String("host", "127.0.0.1:64210", "host:port to listen on")
 	cmd.Flags().Bool("init", false, "initialize the database before using it")
+	cmd.Flags().Bool(flagInitIfMissing, false, "initialize the database if there is none at the path")
 	cmd.Flags().DurationP("timeout", "t", 30*time.Second, "elapsed time until an individual query times out")
+	cmd.Flags().Duration("stall_timeout", chttp.DefaultStallTimeout, "time after which a streamed query is cancelled if the client does not read results")
+	cmd.Flags().Int("export_limit", chttp.DefaultExportLimit, "maximal number of quads written by a single export request")
+	cmd.Flags().StringSlice("trusted_proxy", nil, "address or network of a reverse proxy that authenticates clients; only such proxies can set the actor recorded with changes")
+	cmd.Flags().Int64("query_memory", 0, "approximate memory in bytes that a single query can use for buffered results (0 = no limit)")
+	cmd.Flags().Int64("memory", 0, "approximate memory in bytes that all running queries can use for buffered results (0 = no limit)")
 	cmd.Flags().StringVar(&chttp.AssetsPath, "assets", "", "explicit path to the HTTP assets")
 	registerLoadFlags(cmd)
+	registerHandleFlags(cmd)
 	viper.BindPFlag(keyQueryTimeout, cmd.Flags().Lookup("timeout"))
 	return cmd
 }
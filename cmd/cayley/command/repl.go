@@ -42,6 +42,7 @@ func getContext() (context.Context, func()) {
 func registerQueryFlags(cmd *cobra.Command) {
 	langs := query.Languages()
 	cmd.Flags().Bool("init", false, "initialize the database before using it")
+	cmd.Flags().Bool(flagInitIfMissing, false, "initialize the database if there is none at the path")
 	cmd.Flags().String("lang", "gizmo", `query language to use ("`+strings.Join(langs, `", "`)+`")`)
 	cmd.Flags().DurationP("timeout", "t", 30*time.Second, "elapsed time until an individual query times out")
 	viper.BindPFlag(keyQueryTimeout, cmd.Flags().Lookup("timeout"))
@@ -63,15 +64,22 @@ func NewReplCmd() *cobra.Command {
 			}
 			defer h.Close()
 
+			handles, err := openHandles(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeHandles(handles)
+
 			ctx, cancel := getContext()
 			defer cancel()
 
 			timeout := viper.GetDuration("timeout")
 			lang, _ := cmd.Flags().GetString("lang")
-			return repl.Repl(ctx, h, lang, timeout)
+			return repl.Repl(ctx, h, lang, timeout, handles...)
 		},
 	}
 	registerQueryFlags(cmd)
+	registerHandleFlags(cmd)
 	return cmd
 }
 
@@ -70,7 +70,7 @@ func main() {
 	store, err := cayley.NewGraph("bolt", tmpdir, nil)
 	checkErr(err)
 	defer store.Close()
-	qw := graph.NewWriter(store)
+	qw := graph.NewWriter(store, nil)
 
 	// Save an object
 	bob := Person{
@@ -104,7 +104,7 @@ func main() {
 		{Lat: 12.3, Lng: 34.5},
 		{Lat: 39.7, Lng: 8.41},
 	}
-	qw = graph.NewWriter(store)
+	qw = graph.NewWriter(store, nil)
 	for _, c := range coords {
 		id, err = sch.WriteAsQuads(qw, c)
 		checkErr(err)
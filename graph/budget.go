@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// AvgValueSize is an approximate memory size of a single value stored in memory
+// by a query. It is used to estimate memory used by buffered results.
+const AvgValueSize = 64
+
+// RowSize returns an approximate memory size of a single result with n tagged values.
+func RowSize(n int) int64 {
+	return int64(n+1) * AvgValueSize
+}
+
+// ErrBudgetExceeded is returned when a query buffers more results than its memory
+// budget allows.
+type ErrBudgetExceeded struct {
+	Limit  int64 // limit of the budget in bytes
+	Global bool  // process-wide budget was exceeded, see GlobalBudget
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	if e.Global {
+		return fmt.Sprintf("query: memory limit of all queries exceeded (%d bytes)", e.Limit)
+	}
+	return fmt.Sprintf("query: memory limit exceeded (%d bytes)", e.Limit)
+}
+
+// Budget accounts approximate memory used by results buffered by queries
+// (ex: by Sort iterator or results collected by a query session).
+// Budgets may be nested: memory reserved in a budget is also reserved in its parent.
+//
+// A nil budget is valid and has no limit. Budget is safe for concurrent use.
+type Budget struct {
+	parent *Budget
+	limit  int64
+
+	mu     sync.Mutex
+	used   int64
+	closed bool
+}
+
+// GlobalBudget is a process-wide budget shared by all queries that use budgets
+// created with it as a parent. It has no limit by default.
+var GlobalBudget = NewBudget(0, nil)
+
+// NewBudget creates a new budget with a given limit in bytes. Zero limit means that
+// only the limit of the parent is checked.
+func NewBudget(limit int64, parent *Budget) *Budget {
+	return &Budget{parent: parent, limit: limit}
+}
+
+// SetLimit changes the limit of the budget. Memory that is already reserved is not affected.
+func (b *Budget) SetLimit(limit int64) {
+	atomic.StoreInt64(&b.limit, limit)
+}
+
+// Limit returns the limit of the budget, or zero if it has no limit.
+func (b *Budget) Limit() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.limit)
+}
+
+// Used returns the amount of memory currently reserved in the budget.
+func (b *Budget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Reserve accounts n bytes in the budget and all its parents. It returns ErrBudgetExceeded
+// if any of the limits is exceeded; in this case nothing is reserved.
+//
+// Nothing is reserved after the budget is closed.
+func (b *Budget) Reserve(n int64) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	if limit := b.Limit(); limit > 0 && b.used+n > limit {
+		return &ErrBudgetExceeded{Limit: limit, Global: b == GlobalBudget}
+	}
+	// parents are locked while the child is locked, never the other way around
+	if err := b.parent.Reserve(n); err != nil {
+		return err
+	}
+	b.used += n
+	return nil
+}
+
+// Release returns n bytes previously reserved with Reserve to the budget and its parents.
+//
+// Release is a no-op after the budget is closed, since Close has already returned all
+// the reserved memory to parents.
+func (b *Budget) Release(n int64) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.used -= n
+	b.parent.Release(n)
+}
+
+// Close releases all the memory reserved in the budget. It should be called when a
+// query is done, to return the memory to parent budgets.
+//
+// Iterators of the query may still be running and releasing memory after Close;
+// such calls are ignored.
+func (b *Budget) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.parent.Release(b.used)
+	b.used = 0
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a context that carries a memory budget for a query.
+// Iterators and query sessions that buffer results will reserve memory in it.
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// BudgetFromContext returns a memory budget associated with the context, or nil.
+func BudgetFromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
@@ -0,0 +1,59 @@
+package graph
+
+import "testing"
+
+func TestBudget(t *testing.T) {
+	global := GlobalBudget
+	defer func() { GlobalBudget = global }()
+	GlobalBudget = NewBudget(100, nil)
+
+	q1 := NewBudget(60, GlobalBudget)
+	q2 := NewBudget(60, GlobalBudget)
+	if err := q1.Reserve(50); err != nil {
+		t.Fatal(err)
+	}
+	if err, ok := q1.Reserve(20).(*ErrBudgetExceeded); !ok || err.Limit != 60 || err.Global {
+		t.Fatalf("expected query limit to be exceeded, got: %v", err)
+	}
+	if err := q2.Reserve(40); err != nil {
+		t.Fatal(err)
+	}
+	if err, ok := q2.Reserve(20).(*ErrBudgetExceeded); !ok || err.Limit != 100 || !err.Global {
+		t.Fatalf("expected global limit to be exceeded, got: %v", err)
+	}
+	if q2.Used() != 40 || GlobalBudget.Used() != 90 {
+		t.Fatalf("failed reservations were not rolled back: %d, %d", q2.Used(), GlobalBudget.Used())
+	}
+	q1.Close()
+	if err := q2.Reserve(20); err != nil {
+		t.Fatal(err)
+	}
+	q2.Release(10)
+	if q2.Used() != 50 || GlobalBudget.Used() != 50 {
+		t.Fatalf("unexpected usage: %d, %d", q2.Used(), GlobalBudget.Used())
+	}
+	q2.Close()
+	if n := GlobalBudget.Used(); n != 0 {
+		t.Fatalf("memory was not released: %d", n)
+	}
+
+	// iterators may still run after the query handler has closed the budget
+	q3 := NewBudget(60, GlobalBudget)
+	if err := q3.Reserve(30); err != nil {
+		t.Fatal(err)
+	}
+	q3.Close()
+	q3.Release(30)
+	if err := q3.Reserve(30); err != nil {
+		t.Fatal(err)
+	}
+	q3.Release(30)
+	if q3.Used() != 0 || GlobalBudget.Used() != 0 {
+		t.Fatalf("closed budget changed usage: %d, %d", q3.Used(), GlobalBudget.Used())
+	}
+
+	var b *Budget
+	if err := b.Reserve(1 << 40); err != nil {
+		t.Fatal("nil budget should have no limit")
+	}
+}
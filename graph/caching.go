@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"sync/atomic"
+
+	"github.com/cayleygraph/cayley/internal/lru"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// DefaultCacheSize is the default number of entries in each cache of CachingQuadStore.
+const DefaultCacheSize = 1 << 14
+
+var _ QuadStore = (*CachingQuadStore)(nil)
+
+// CacheStats contains the number of lookups served by a cache and the number of
+// lookups passed to the underlying quad store.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// CachingStats contains stats for each cache of CachingQuadStore.
+type CachingStats struct {
+	Names  CacheStats // NameOf lookups
+	Values CacheStats // ValueOf lookups
+	Quads  CacheStats // Quad lookups
+}
+
+type cacheCounter struct {
+	hits, misses int64 // accessed atomically
+}
+
+func (c *cacheCounter) hit()  { atomic.AddInt64(&c.hits, 1) }
+func (c *cacheCounter) miss() { atomic.AddInt64(&c.misses, 1) }
+
+func (c *cacheCounter) stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+	}
+}
+
+// CachingQuadStore is a QuadStore decorator that keeps results of NameOf, ValueOf
+// and Quad lookups in bounded LRU caches. Iterators built against it resolve values
+// through the caches transparently.
+//
+// Caches are cleared on each ApplyDeltas call made through the decorator. Writes
+// made directly to the underlying quad store are not observed, and may leave stale
+// entries in the caches.
+//
+// All methods are safe for concurrent use, if the underlying quad store is.
+type CachingQuadStore struct {
+	QuadStore
+
+	names  *lru.Cache // Value key -> quad.Value
+	values *lru.Cache // quad.Value string -> Value
+	quads  *lru.Cache // Value key -> quad.Quad
+
+	nameStats, valueStats, quadStats cacheCounter
+}
+
+// NewCachingQuadStore wraps the quad store with caches that keep at most size entries each.
+// If size is zero or negative, DefaultCacheSize is used.
+func NewCachingQuadStore(qs QuadStore, size int) *CachingQuadStore {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &CachingQuadStore{
+		QuadStore: qs,
+		names:     lru.New(size),
+		values:    lru.New(size),
+		quads:     lru.New(size),
+	}
+}
+
+// CacheStats returns the number of cache hits and misses since the quad store was created.
+func (qs *CachingQuadStore) CacheStats() CachingStats {
+	return CachingStats{
+		Names:  qs.nameStats.stats(),
+		Values: qs.valueStats.stats(),
+		Quads:  qs.quadStats.stats(),
+	}
+}
+
+// Purge removes all entries from the caches.
+func (qs *CachingQuadStore) Purge() {
+	qs.names.Purge()
+	qs.values.Purge()
+	qs.quads.Purge()
+}
+
+func (qs *CachingQuadStore) ApplyDeltas(in []Delta, opts IgnoreOpts) error {
+	// deleted values must not be resolved from the cache
+	defer qs.Purge()
+	return qs.QuadStore.ApplyDeltas(in, opts)
+}
+
+func (qs *CachingQuadStore) NameOf(v Value) quad.Value {
+	if v == nil {
+		return nil
+	}
+	k := v.Key()
+	if x, ok := qs.names.Get(k); ok {
+		qs.nameStats.hit()
+		return x.(quad.Value)
+	}
+	qs.nameStats.miss()
+	name := qs.QuadStore.NameOf(v)
+	if name != nil {
+		qs.names.Put(k, name)
+	}
+	return name
+}
+
+func (qs *CachingQuadStore) ValueOf(name quad.Value) Value {
+	if name == nil {
+		return nil
+	}
+	k := quad.StringOf(name)
+	if x, ok := qs.values.Get(k); ok {
+		qs.valueStats.hit()
+		return x.(Value)
+	}
+	qs.valueStats.miss()
+	v := qs.QuadStore.ValueOf(name)
+	if v != nil {
+		qs.values.Put(k, v)
+	}
+	return v
+}
+
+func (qs *CachingQuadStore) Quad(v Value) quad.Quad {
+	if v == nil {
+		return quad.Quad{}
+	}
+	k := v.Key()
+	if x, ok := qs.quads.Get(k); ok {
+		qs.quadStats.hit()
+		return x.(quad.Quad)
+	}
+	qs.quadStats.miss()
+	q := qs.QuadStore.Quad(v)
+	if q.IsValid() {
+		qs.quads.Put(k, q)
+	}
+	return q
+}
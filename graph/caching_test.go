@@ -0,0 +1,54 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// countingStore resolves string values and counts calls to NameOf.
+type countingStore struct {
+	QuadStore
+	names int
+}
+
+func (qs *countingStore) NameOf(v Value) quad.Value {
+	qs.names++
+	return quad.String(v.(PreFetchedValue).NameOf().(quad.String) + "!")
+}
+
+func (qs *countingStore) ApplyDeltas(in []Delta, opts IgnoreOpts) error { return nil }
+
+func TestCachingQuadStoreNameOf(t *testing.T) {
+	base := &countingStore{}
+	qs := NewCachingQuadStore(base, 2)
+	a, b, c := PreFetched(quad.String("a")), PreFetched(quad.String("b")), PreFetched(quad.String("c"))
+
+	for i := 0; i < 3; i++ {
+		if name := qs.NameOf(a); name != quad.String("a!") {
+			t.Fatalf("unexpected name: %v", name)
+		}
+	}
+	if base.names != 1 {
+		t.Errorf("expected repeated NameOf to hit the cache, got %d lookups", base.names)
+	}
+	if st := qs.CacheStats().Names; st != (CacheStats{Hits: 2, Misses: 1}) {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	// a is evicted as the least recently used value
+	qs.NameOf(b)
+	qs.NameOf(c)
+	qs.NameOf(a)
+	if base.names != 4 {
+		t.Errorf("expected evicted value to be resolved again, got %d lookups", base.names)
+	}
+
+	if err := qs.ApplyDeltas(nil, IgnoreOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	qs.NameOf(a)
+	if base.names != 5 {
+		t.Errorf("expected cache to be cleared after a write, got %d lookups", base.names)
+	}
+}
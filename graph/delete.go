@@ -0,0 +1,124 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// ErrDeleteAll is returned by DeleteMatching if the pattern matches all quads, and
+// the deletion of everything was not forced explicitly.
+var ErrDeleteAll = errors.New("delete: pattern matches all quads")
+
+// DeleteOptions controls the removal of quads by DeleteMatching.
+type DeleteOptions struct {
+	// BatchSize is the number of quads removed in a single transaction.
+	// Zero value means quad.DefaultBatch.
+	BatchSize int
+	// Force allows a pattern without any values, which removes all quads.
+	Force bool
+	// Progress is called after each batch with the total number of removed quads.
+	Progress func(removed int)
+}
+
+// DeleteMatching removes all quads that match the pattern. Directions of the pattern that
+// are set to nil match any value. It returns the number of removed quads.
+//
+// Quads are removed in batches, each batch is a separate transaction. If the removal
+// fails, all previous batches stay removed, thus calling it again with the same pattern
+// continues the removal.
+func DeleteMatching(ctx context.Context, h *Handle, pattern quad.Quad, opts DeleteOptions) (int, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = quad.DefaultBatch
+	}
+	// use the index for the most selective value, and check other directions manually
+	var (
+		dir   quad.Direction
+		val   Value
+		size  int64
+		check []quad.Direction
+	)
+	for _, d := range quad.Directions {
+		v := pattern.Get(d)
+		if v == nil {
+			continue
+		}
+		gv := h.QuadStore.ValueOf(v)
+		if gv == nil {
+			// value is not in the store, thus no quads match
+			return 0, nil
+		}
+		it := h.QuadStore.QuadIterator(d, gv)
+		sz, _ := it.Size()
+		it.Close()
+		if val == nil || sz < size {
+			if val != nil {
+				check = append(check, dir)
+			}
+			dir, val, size = d, gv, sz
+		} else {
+			check = append(check, d)
+		}
+	}
+	if val == nil && !opts.Force {
+		return 0, ErrDeleteAll
+	}
+	matches := func(q quad.Quad) bool {
+		for _, d := range check {
+			if q.Get(d) != pattern.Get(d) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var (
+		total int
+		prev  map[quad.Quad]struct{} // quads removed by the previous batch
+	)
+	for {
+		// iterator is opened again for each batch, since removed quads
+		// may invalidate its position on some backends
+		var it Iterator
+		if val == nil {
+			it = h.QuadStore.QuadsAllIterator()
+		} else {
+			it = h.QuadStore.QuadIterator(dir, val)
+		}
+		tx := NewTransactionN(opts.BatchSize)
+		batch := make(map[quad.Quad]struct{}, opts.BatchSize)
+		for len(tx.Deltas) < opts.BatchSize && it.Next(ctx) {
+			q := h.QuadStore.Quad(it.Result())
+			if !matches(q) {
+				continue
+			}
+			if _, ok := prev[q]; ok {
+				it.Close()
+				return total, fmt.Errorf("delete: quad was not removed: %v", q)
+			}
+			tx.RemoveQuad(q)
+			batch[q] = struct{}{}
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return total, err
+		}
+		if len(tx.Deltas) == 0 {
+			return total, nil
+		}
+		if err = h.QuadWriter.ApplyTransaction(tx); err != nil {
+			return total, err
+		}
+		total += len(tx.Deltas)
+		if opts.Progress != nil {
+			opts.Progress(total)
+		}
+		prev = batch
+		if err = ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+// Describer is an optional interface for iterators that can describe their parameters.
+//
+// Iterators that are specific to a backend, or hold a state that cannot be serialized,
+// should describe their logical definition in terms of generic iterators instead
+// (ex: an index scan can be described as a LinksTo of a Fixed node).
+type Describer interface {
+	// Describe returns parameters of the iterator. UID, name and tags are
+	// filled by DescribeIterator. If Type is not set, the type of iterator is used.
+	// If Iterators is nil, subiterators are described automatically.
+	Describe() Description
+}
+
+// IteratorBuilder creates an iterator from its description.
+// Subiterators are already built and passed in the same order as in the description.
+type IteratorBuilder func(qs QuadStore, d Description, sub []Iterator) (Iterator, error)
+
+var (
+	buildersMu sync.RWMutex
+	builders   = make(map[Type]IteratorBuilder)
+)
+
+// RegisterIteratorBuilder registers a function that rebuilds iterators of a given type.
+// See BuildFromDescription.
+func RegisterIteratorBuilder(t Type, fnc IteratorBuilder) {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	if _, ok := builders[t]; ok {
+		panic(fmt.Sprintf("iterator builder for %q is already registered", t))
+	}
+	builders[t] = fnc
+}
+
+// DescribeIteratorFor is the same as DescribeIterator, but also converts all
+// values of the description to strings using a given quad store. The result can
+// be serialized and rebuilt with BuildFromDescription.
+func DescribeIteratorFor(qs QuadStore, it Iterator) Description {
+	d := DescribeIterator(it)
+	resolveRefs(qs, &d)
+	return d
+}
+
+func resolveRefs(qs QuadStore, d *Description) {
+	for _, v := range d.Refs {
+		d.Values = append(d.Values, EncodeValue(qs.NameOf(v)))
+	}
+	d.Refs = nil
+	if len(d.FixedRefs) != 0 {
+		d.FixedTags = make(map[string]string, len(d.FixedRefs))
+		for k, v := range d.FixedRefs {
+			d.FixedTags[k] = EncodeValue(qs.NameOf(v))
+		}
+	}
+	d.FixedRefs = nil
+	for i := range d.Iterators {
+		resolveRefs(qs, &d.Iterators[i])
+	}
+	if d.Morphism != nil {
+		resolveRefs(qs, d.Morphism)
+	}
+}
+
+// BuildFromDescription rebuilds an iterator tree from its description on a given
+// quad store. Values of the description are resolved with ValueOf, thus the tree
+// can be described on one quad store and rebuilt on another one with the same data.
+//
+// Description should be created by DescribeIteratorFor. Only iterator types with
+// a registered builder can be rebuilt. See RegisterIteratorBuilder.
+//
+// Descriptions that are deeper than MaxDepth are rejected with ErrTooDeep.
+func BuildFromDescription(qs QuadStore, d Description) (Iterator, error) {
+	return buildFromDescription(qs, d, 1)
+}
+
+func buildFromDescription(qs QuadStore, d Description, depth int) (Iterator, error) {
+	if MaxDepth > 0 && depth > MaxDepth {
+		return nil, &ErrTooDeep{Max: MaxDepth}
+	}
+	buildersMu.RLock()
+	fnc := builders[d.Type]
+	buildersMu.RUnlock()
+	if fnc == nil {
+		return nil, &ErrUnknownIterator{Type: d.Type}
+	}
+	var sub []Iterator
+	closeAll := func() {
+		for _, it := range sub {
+			it.Close()
+		}
+	}
+	for _, sd := range d.Iterators {
+		it, err := buildFromDescription(qs, sd, depth+1)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sub = append(sub, it)
+	}
+	it, err := fnc(qs, d, sub)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	tg := it.Tagger()
+	for _, tag := range d.Tags {
+		if !hasTag(tg, tag) {
+			tg.Add(tag)
+		}
+	}
+	for tag, s := range d.FixedTags {
+		v, err := DecodeValue(s)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		tg.AddFixed(tag, qs.ValueOf(v))
+	}
+	return it, nil
+}
+
+// ErrUnknownIterator is returned when an iterator cannot be built from its description,
+// because there is no builder registered for its type.
+type ErrUnknownIterator struct {
+	Type Type
+}
+
+func (e *ErrUnknownIterator) Error() string {
+	if e.Type == "" {
+		return "graph: iterator type is not set"
+	}
+	return fmt.Sprintf("graph: cannot build iterator of type %q", string(e.Type))
+}
+
+// MarshalPlan encodes an iterator tree as JSON. Values are converted to strings
+// using a given quad store. The plan can be rebuilt with UnmarshalPlan.
+func MarshalPlan(qs QuadStore, it Iterator) ([]byte, error) {
+	return json.Marshal(DescribeIteratorFor(qs, it))
+}
+
+// UnmarshalPlan rebuilds an iterator tree encoded by MarshalPlan on a given quad store.
+// See BuildFromDescription for details.
+func UnmarshalPlan(data []byte, qs QuadStore) (Iterator, error) {
+	var d Description
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("graph: cannot decode plan: %v", err)
+	}
+	return BuildFromDescription(qs, d)
+}
+
+// hasTag checks if a tagger already has a given tag. Some iterators share the
+// tagger with their subiterator, thus tags may already be set.
+func hasTag(tg *Tagger, tag string) bool {
+	for _, t := range tg.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeValue encodes a value in N-Quads notation for use in Description.
+func EncodeValue(v quad.Value) string {
+	return quad.StringOf(v)
+}
+
+// DecodeValue decodes a value encoded with EncodeValue. Typed strings are converted
+// to native values if possible.
+func DecodeValue(s string) (quad.Value, error) {
+	if s == "" {
+		return nil, nil
+	}
+	q, err := nquads.Parse("<s> <p> " + s + " .")
+	if err != nil {
+		return nil, fmt.Errorf("graph: cannot decode value %q: %v", s, err)
+	}
+	if ts, ok := q.Object.(quad.TypedString); ok {
+		return ts.ParseValue()
+	}
+	return q.Object, nil
+}
+
+// DecodeValues decodes Values of the description and resolves them with ValueOf.
+// Values that are not present in the quad store are returned as nil.
+func (d Description) DecodeValues(qs QuadStore) ([]Value, error) {
+	out := make([]Value, 0, len(d.Values))
+	for _, s := range d.Values {
+		v, err := DecodeValue(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, qs.ValueOf(v))
+	}
+	return out, nil
+}
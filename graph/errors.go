@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrReadOnly is returned when trying to modify a database, or a view of it, that is read-only.
+	ErrReadOnly = errors.New("database is read-only")
+
+	// ErrCancelled is returned when an operation was stopped before completion, because
+	// it was cancelled by the client. It belongs to the same class as context.Canceled,
+	// while context.DeadlineExceeded is reported as a timeout (see ErrorCode).
+	ErrCancelled = errors.New("operation cancelled")
+)
+
+// QueryError is returned when a query cannot be parsed or compiled. Position of the error
+// in the query text is set, if it's known.
+type QueryError struct {
+	Language string // name of the query language
+	Line     int    // line of the error, starting from 1; zero if unknown
+	Column   int    // column of the error, starting from 1; zero if unknown
+	Err      error
+}
+
+// Error returns the message of the underlying error, prefixed with the position and
+// the name of the language. The name is not repeated, if the message already starts with it.
+func (e *QueryError) Error() string {
+	msg := e.Err.Error()
+	if e.Line > 0 {
+		msg = fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, msg)
+	}
+	if e.Language == "" || strings.HasPrefix(msg, e.Language+":") {
+		return msg
+	}
+	return e.Language + ": " + msg
+}
+
+// Cause returns the underlying error.
+func (e *QueryError) Cause() error {
+	return e.Err
+}
+
+// NewQueryError creates a QueryError for a byte offset in the query text.
+// Negative offset means that the position is not known.
+func NewQueryError(lang, qu string, offset int, err error) *QueryError {
+	qe := &QueryError{Language: lang, Err: err}
+	if offset < 0 {
+		return qe
+	}
+	if offset > len(qu) {
+		offset = len(qu)
+	}
+	qe.Line = strings.Count(qu[:offset], "\n") + 1
+	qe.Column = offset - strings.LastIndex(qu[:offset], "\n")
+	return qe
+}
+
+// IsQueryError returns whether an error is caused by an invalid query.
+func IsQueryError(err error) bool {
+	return ErrorCode(err) == CodeQuery
+}
+
+// Stable codes of error classes, returned by ErrorCode.
+const (
+	CodeQuadExists     = "quad_exists"
+	CodeQuadNotExist   = "quad_not_exist"
+	CodeNodeNotExist   = "node_not_exist"
+	CodeInvalidAction  = "invalid_action"
+	CodeNotInitialized = "not_initialized"
+	CodeDatabaseExists = "database_exists"
+	CodeReadOnly       = "read_only"
+	CodeCancelled      = "cancelled"
+	CodeTimeout        = "timeout"
+	CodeBudgetExceeded = "budget_exceeded"
+	CodeQuery          = "query_error"
+
+	CodeWrongBackend        = "wrong_backend"
+	CodeIncompatibleVersion = "incompatible_version"
+)
+
+// causer is implemented by errors that wrap another error.
+type causer interface {
+	Cause() error
+}
+
+// ErrorCode returns a stable machine-readable code of the class of the error, for example
+// CodeQuadExists for ErrQuadExists, or an empty string if the class is not known.
+//
+// Errors that wrap another error with a Cause method (ex: DeltaError) are classified
+// by their cause.
+func ErrorCode(err error) string {
+	for err != nil {
+		switch e := err.(type) {
+		case *QueryError:
+			return CodeQuery
+		case *ErrBudgetExceeded:
+			return CodeBudgetExceeded
+		case *ErrWrongBackend:
+			return CodeWrongBackend
+		case *ErrIncompatibleVersion:
+			return CodeIncompatibleVersion
+		case *DeltaError:
+			err = e.Err
+			continue
+		}
+		switch err {
+		case ErrQuadExists:
+			return CodeQuadExists
+		case ErrQuadNotExist:
+			return CodeQuadNotExist
+		case ErrNodeNotExists:
+			return CodeNodeNotExist
+		case ErrInvalidAction:
+			return CodeInvalidAction
+		case ErrNotInitialized:
+			return CodeNotInitialized
+		case ErrDatabaseExists:
+			return CodeDatabaseExists
+		case ErrReadOnly:
+			return CodeReadOnly
+		case ErrCancelled, context.Canceled:
+			return CodeCancelled
+		case context.DeadlineExceeded:
+			return CodeTimeout
+		}
+		c, ok := err.(causer)
+		if !ok {
+			return ""
+		}
+		err = c.Cause()
+	}
+	return ""
+}
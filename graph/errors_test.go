@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+type wrappedError struct {
+	err error
+}
+
+func (e *wrappedError) Error() string { return "wrapped: " + e.err.Error() }
+func (e *wrappedError) Cause() error  { return e.err }
+
+func TestErrorCode(t *testing.T) {
+	q := quad.MakeIRI("a", "b", "c", "")
+	for _, c := range []struct {
+		err  error
+		code string
+	}{
+		{ErrQuadExists, CodeQuadExists},
+		{&DeltaError{Delta: Delta{Quad: q, Action: Add}, Err: ErrQuadExists}, CodeQuadExists},
+		{&DeltaError{Delta: Delta{Quad: q, Action: Delete}, Err: ErrQuadNotExist}, CodeQuadNotExist},
+		{ErrNodeNotExists, CodeNodeNotExist},
+		{ErrInvalidAction, CodeInvalidAction},
+		{ErrNotInitialized, CodeNotInitialized},
+		{ErrDatabaseExists, CodeDatabaseExists},
+		{ErrReadOnly, CodeReadOnly},
+		{ErrCancelled, CodeCancelled},
+		{context.Canceled, CodeCancelled},
+		{context.DeadlineExceeded, CodeTimeout},
+		{&ErrWrongBackend{Found: "bolt", Expected: "leveldb"}, CodeWrongBackend},
+		{&ErrIncompatibleVersion{Found: 3, Expected: 2}, CodeIncompatibleVersion},
+		{&ErrBudgetExceeded{Limit: 10}, CodeBudgetExceeded},
+		{&QueryError{Language: "mql", Err: errors.New("bad")}, CodeQuery},
+		{&wrappedError{&DeltaError{Err: ErrQuadExists}}, CodeQuadExists},
+		{&wrappedError{errors.New("unknown")}, ""},
+		{errors.New("unknown"), ""},
+		{nil, ""},
+	} {
+		if code := ErrorCode(c.err); code != c.code {
+			t.Errorf("unexpected code for %v: %q vs %q", c.err, code, c.code)
+		}
+	}
+	if !IsQueryError(&wrappedError{&QueryError{Err: errors.New("bad")}}) {
+		t.Error("expected a query error")
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	const qu = "first\nsecond line\nthird"
+	for _, c := range []struct {
+		offset       int
+		line, column int
+		msg          string
+	}{
+		{offset: 0, line: 1, column: 1, msg: "lang: line 1, column 1: bad"},
+		{offset: 8, line: 2, column: 3, msg: "lang: line 2, column 3: bad"},
+		{offset: 100, line: 3, column: 6, msg: "lang: line 3, column 6: bad"},
+		{offset: -1, msg: "lang: bad"},
+	} {
+		err := NewQueryError("lang", qu, c.offset, errors.New("bad"))
+		if err.Line != c.line || err.Column != c.column {
+			t.Errorf("unexpected position for offset %d: %d:%d", c.offset, err.Line, err.Column)
+		}
+		if err.Error() != c.msg {
+			t.Errorf("unexpected message: %q", err.Error())
+		}
+	}
+	// the language is not repeated in the message
+	err := &QueryError{Language: "lang", Err: errors.New("lang: bad")}
+	if err.Error() != "lang: bad" {
+		t.Errorf("unexpected message: %q", err.Error())
+	}
+}
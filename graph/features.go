@@ -0,0 +1,55 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Features describes optional capabilities of a quad store in its current configuration.
+//
+// A feature must only be reported if it's actually available. Query planners and API
+// handlers use features to decide which code path to take, and the conformance tests
+// in graphtest verify that reported features behave as described.
+type Features struct {
+	// Ordered is set if QuadsAllIterator and NodesAllIterator return results in
+	// ascending order and implement Seekable.
+	Ordered bool `json:"ordered"`
+	// Seek is set if iterators returned by QuadIterator implement Seekable.
+	Seek bool `json:"seek"`
+	// BulkLookup is set if the quad store can resolve multiple values at once (see BatchQuadStore).
+	BulkLookup bool `json:"bulk_lookup"`
+	// LabelIndex is set if quads can be found by label without scanning all quads.
+	LabelIndex bool `json:"label_index"`
+	// DeltaLog is set if the quad store keeps a history of changes (see DeltaLog).
+	DeltaLog bool `json:"delta_log"`
+	// Snapshots is set if the quad store can provide consistent read-only views (see Snapshotter).
+	Snapshots bool `json:"snapshots"`
+}
+
+// FeatureReporter is an optional interface for quad stores that report their capabilities.
+type FeatureReporter interface {
+	// Features returns capabilities of the quad store in its current configuration.
+	Features() Features
+}
+
+// FeaturesOf returns capabilities of a quad store.
+//
+// If the quad store doesn't implement FeatureReporter, a conservative set of features is
+// returned: only the ones that cannot fail at runtime are derived from implemented interfaces.
+func FeaturesOf(qs QuadStore) Features {
+	qs = Unwrap(qs)
+	if r, ok := qs.(FeatureReporter); ok {
+		return r.Features()
+	}
+	_, bulk := qs.(BatchQuadStore)
+	return Features{BulkLookup: bulk}
+}
@@ -0,0 +1,202 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphmock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+)
+
+var _ graph.Iterator = &Iterator{}
+
+// IteratorType is the type of Iterator mocks.
+const IteratorType = graph.Type("mock")
+
+// IteratorCalls holds the number of calls to each method of the Iterator mock.
+type IteratorCalls struct {
+	Next     int
+	NextPath int
+	Contains int
+	Reset    int
+	Close    int
+	Size     int
+	Stats    int
+	Optimize int
+}
+
+// IteratorOption configures the Iterator mock.
+type IteratorOption func(it *Iterator)
+
+// WithStats sets the stats that will be returned by the Iterator mock.
+// Size returned by the iterator will be changed accordingly.
+func WithStats(st graph.IteratorStats) IteratorOption {
+	return func(it *Iterator) {
+		it.stats = &st
+	}
+}
+
+// WithErr sets an error that will be returned by the Iterator mock after all
+// its values were returned by Next, or after a failed Contains call.
+func WithErr(err error) IteratorOption {
+	return func(it *Iterator) {
+		it.failWith = err
+	}
+}
+
+// Iterator is a mock iterator that returns a fixed set of values and records calls
+// to its methods. It is intended to test interactions of composite iterators
+// with their sub-iterators.
+type Iterator struct {
+	uid    uint64
+	tags   graph.Tagger
+	values []graph.Value
+	opts   []IteratorOption
+	index  int
+	result graph.Value
+	err    error
+
+	stats    *graph.IteratorStats
+	failWith error
+
+	// Calls holds the number of calls to each method of the iterator.
+	// Clones of the iterator share counters with it, since composite iterators
+	// usually clone their sub-iterators during optimization.
+	Calls *IteratorCalls
+}
+
+// NewIterator creates a new Iterator mock with given values and options.
+func NewIterator(vals []graph.Value, opts ...IteratorOption) *Iterator {
+	it := &Iterator{
+		uid:    iterator.NextUID(),
+		values: vals,
+		opts:   opts,
+		Calls:  &IteratorCalls{},
+	}
+	for _, opt := range opts {
+		opt(it)
+	}
+	return it
+}
+
+func (it *Iterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *Iterator) Reset() {
+	it.Calls.Reset++
+	it.index = 0
+	it.result = nil
+	it.err = nil
+}
+
+func (it *Iterator) Close() error {
+	it.Calls.Close++
+	return nil
+}
+
+func (it *Iterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Iterator) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *Iterator) Clone() graph.Iterator {
+	out := NewIterator(it.values, it.opts...)
+	out.Calls = it.Calls
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Iterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.Calls.Next++
+	if it.index >= len(it.values) {
+		it.result = nil
+		it.err = it.failWith
+		return graph.NextLogOut(it, false)
+	}
+	it.result = it.values[it.index]
+	it.index++
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Iterator) NextPath(ctx context.Context) bool {
+	it.Calls.NextPath++
+	return false
+}
+
+func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	it.Calls.Contains++
+	vk := graph.ToKey(v)
+	for _, x := range it.values {
+		if graph.ToKey(x) == vk {
+			it.result = x
+			return graph.ContainsLogOut(it, v, true)
+		}
+	}
+	it.err = it.failWith
+	return graph.ContainsLogOut(it, v, false)
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *Iterator) Type() graph.Type { return IteratorType }
+
+func (it *Iterator) String() string {
+	return fmt.Sprintf("Mock(%v)", it.values)
+}
+
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	it.Calls.Optimize++
+	return it, false
+}
+
+func (it *Iterator) Size() (int64, bool) {
+	it.Calls.Size++
+	if it.stats != nil {
+		return it.stats.Size, it.stats.ExactSize
+	}
+	return int64(len(it.values)), true
+}
+
+func (it *Iterator) Stats() graph.IteratorStats {
+	it.Calls.Stats++
+	if it.stats != nil {
+		return *it.stats
+	}
+	s := int64(len(it.values))
+	return graph.IteratorStats{
+		ContainsCost: s,
+		NextCost:     s,
+		Size:         s,
+		ExactSize:    true,
+	}
+}
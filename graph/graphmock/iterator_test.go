@@ -0,0 +1,54 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphmock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	"github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func TestIterator(t *testing.T) {
+	ctx := context.TODO()
+	wantErr := errors.New("unique")
+	it := graphmock.NewIterator([]graph.Value{iterator.Int64Node(1), iterator.Int64Node(2)}, graphmock.WithErr(wantErr))
+
+	var got []graph.Value
+	for it.Next(ctx) {
+		if it.Err() != nil {
+			t.Errorf("unexpected error before the end of iteration: %v", it.Err())
+		}
+		got = append(got, it.Result())
+	}
+	if len(got) != 2 || it.Calls.Next != 3 {
+		t.Errorf("unexpected results: %v (%d calls)", got, it.Calls.Next)
+	}
+	if it.Err() != wantErr {
+		t.Errorf("unexpected error: %v", it.Err())
+	}
+	it.Reset()
+	if it.Err() != nil || it.Calls.Reset != 1 {
+		t.Errorf("iterator was not reset")
+	}
+	c := it.Clone().(*graphmock.Iterator)
+	c.Next(ctx)
+	if it.Calls.Next != 4 {
+		t.Errorf("clone should share counters: %+v", *it.Calls)
+	}
+}
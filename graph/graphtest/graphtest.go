@@ -2,6 +2,7 @@ package graphtest
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"sort"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/graph/path/pathtest"
 	"github.com/cayleygraph/cayley/graph/shape"
 	"github.com/cayleygraph/cayley/quad"
@@ -56,6 +58,9 @@ var graphTests = []struct {
 	{"compare typed values", TestCompareTypedValues},
 	{"schema", TestSchema},
 	{"delete reinserted", TestDeleteReinserted},
+	{"delete matching", TestDeleteMatching},
+	{"prepared", TestPrepared},
+	{"features", TestFeatures},
 }
 
 func TestAll(t *testing.T, gen testutil.DatabaseFunc, conf *Config) {
@@ -85,6 +90,64 @@ func BenchmarkAll(t *testing.B, gen testutil.DatabaseFunc, conf *Config) {
 	t.Run("integration", func(t *testing.B) {
 		BenchmarkIntegration(t, gen, conf.AlwaysRunIntegration)
 	})
+	t.Run("skewed intersection", func(t *testing.B) {
+		BenchmarkSkewedIntersection(t, gen)
+	})
+}
+
+// BenchmarkSkewedIntersection intersects a large posting list with a small one: quads with
+// a common predicate and quads with a rare object. The And iterator that scans the large
+// list is compared with the intersection by seeking, if quad iterators of the store are sorted.
+func BenchmarkSkewedIntersection(b *testing.B, gen testutil.DatabaseFunc) {
+	const (
+		total = 20000
+		rare  = 20
+	)
+	ctx := context.TODO()
+	qs, opts, closer := gen(b)
+	defer closer()
+
+	quads := make([]quad.Quad, 0, total)
+	for i := 0; i < total; i++ {
+		o := "common"
+		if i%(total/rare) == 0 {
+			o = "rare"
+		}
+		quads = append(quads, quad.MakeIRI(fmt.Sprintf("n%d", i), "type", o, ""))
+	}
+	testutil.MakeWriter(b, qs, opts, quads...)
+
+	pred, obj := qs.ValueOf(quad.IRI("type")), qs.ValueOf(quad.IRI("rare"))
+	run := func(b *testing.B, intersect func(large, small graph.Iterator) graph.Iterator) {
+		for i := 0; i < b.N; i++ {
+			it := intersect(qs.QuadIterator(quad.Predicate, pred), qs.QuadIterator(quad.Object, obj))
+			n := 0
+			for it.Next(ctx) {
+				n++
+			}
+			require.NoError(b, it.Err())
+			it.Close()
+			require.Equal(b, rare, n)
+		}
+	}
+	b.Run("and", func(b *testing.B) {
+		run(b, func(large, small graph.Iterator) graph.Iterator {
+			// the first iterator is scanned and the second is checked with Contains
+			return iterator.NewAnd(qs, large, small)
+		})
+	})
+	b.Run("seek", func(b *testing.B) {
+		large, ok1 := qs.QuadIterator(quad.Predicate, pred).(graph.Seekable)
+		small, ok2 := qs.QuadIterator(quad.Object, obj).(graph.Seekable)
+		if !ok1 || !ok2 || large.SortOrder() == "" || large.SortOrder() != small.SortOrder() {
+			b.Skip("quad iterators are not sorted")
+		}
+		large.Close()
+		small.Close()
+		run(b, func(large, small graph.Iterator) graph.Iterator {
+			return iterator.NewZigZag(large.(graph.Seekable), small.(graph.Seekable))
+		})
+	})
 }
 
 // This is a simple test graph.
@@ -374,7 +437,7 @@ func Test1K(t *testing.T, gen testutil.DatabaseFunc, c *Config) {
 	w, err := writer.NewSingle(qs, graph.IgnoreOpts{})
 	require.NoError(t, err)
 
-	qw := graph.NewWriter(w)
+	qw := graph.NewWriter(w, nil)
 	exp := make([]quad.Quad, 0, n)
 	for i := 0; i < n; i++ {
 		q := quad.Make(i, i, i, nil)
@@ -1080,7 +1143,7 @@ func TestSchema(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
 
 	sch := schema.NewConfig()
 
-	qw := graph.NewWriter(w)
+	qw := graph.NewWriter(w, nil)
 	id, err := sch.WriteAsQuads(qw, p)
 	require.NoError(t, err)
 	err = qw.Close()
@@ -1113,3 +1176,188 @@ func TestDeleteReinserted(t testing.TB, gen testutil.DatabaseFunc, _ *Config) {
 	}
 
 }
+
+func TestPrepared(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
+	ctx := context.TODO()
+	qs, opts, closer := gen(t)
+	defer closer()
+
+	quads := MakeQuadSet()
+	testutil.MakeWriter(t, qs, opts, quads...)
+	follows := quads[0].Predicate
+
+	pr := path.StartPath(qs, shape.Param("who")).Out(follows).Prepare()
+	defer pr.Close()
+	// C follows two nodes, E follows one and G follows none
+	for _, who := range []quad.Value{quads[1].Subject, quads[7].Subject, quads[5].Object} {
+		var exp []quad.Value
+		for _, q := range quads {
+			if q.Subject == who && q.Predicate == follows {
+				exp = append(exp, q.Object)
+			}
+		}
+		ic, err := pr.Iterate(ctx, map[string]quad.Value{"who": who})
+		require.NoError(t, err)
+		got, err := ic.Paths(false).AllValues(qs)
+		require.NoError(t, err)
+		sort.Sort(quad.ByValueString(exp))
+		sort.Sort(quad.ByValueString(got))
+		require.Equal(t, exp, got, "unexpected results for %v", who)
+	}
+}
+
+func TestDeleteMatching(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
+	ctx := context.TODO()
+	qs, opts, closer := gen(t)
+	defer closer()
+
+	w := testutil.MakeWriter(t, qs, opts, MakeQuadSet()...)
+	h := &graph.Handle{QuadStore: qs, QuadWriter: w}
+	follows := MakeQuadSet()[0].Predicate
+
+	var progress []int
+	n, err := graph.DeleteMatching(ctx, h, quad.Quad{Predicate: follows}, graph.DeleteOptions{
+		BatchSize: 3,
+		Progress:  func(n int) { progress = append(progress, n) },
+	})
+	require.NoError(t, err)
+	require.Equal(t, 8, n)
+	require.Equal(t, []int{3, 6, 8}, progress)
+
+	var exp []quad.Quad
+	for _, q := range MakeQuadSet() {
+		if q.Predicate != follows {
+			exp = append(exp, q)
+		}
+	}
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), exp, true)
+
+	// sizes and nodes must be the same as for a store with the remaining quads only
+	qs2, opts2, closer2 := gen(t)
+	defer closer2()
+	testutil.MakeWriter(t, qs2, opts2, exp...)
+	if !conf.SkipSizeCheckAfterDelete {
+		require.Equal(t, qs2.Size(), qs.Size(), "Unexpected quadstore size")
+	}
+	ExpectIteratedValues(t, qs, qs.NodesAllIterator(), IteratedValues(t, qs2, qs2.NodesAllIterator()), true)
+
+	// all values must match
+	n, err = graph.DeleteMatching(ctx, h, quad.Quad{Subject: exp[0].Subject, Predicate: exp[0].Predicate}, graph.DeleteOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), exp[1:], true)
+
+	n, err = graph.DeleteMatching(ctx, h, quad.Quad{Subject: quad.String("missing")}, graph.DeleteOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	// deleting everything must be forced
+	_, err = graph.DeleteMatching(ctx, h, quad.Quad{}, graph.DeleteOptions{})
+	require.Equal(t, graph.ErrDeleteAll, err)
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), exp[1:], true)
+
+	n, err = graph.DeleteMatching(ctx, h, quad.Quad{}, graph.DeleteOptions{Force: true})
+	require.NoError(t, err)
+	require.Equal(t, len(exp)-1, n)
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), nil, true)
+}
+
+// TestFeatures checks that all features reported by the quad store actually behave as described.
+func TestFeatures(t testing.TB, gen testutil.DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	qs, opts, closer := gen(t)
+	defer closer()
+
+	w := testutil.MakeWriter(t, qs, opts, MakeQuadSet()...)
+	f := graph.FeaturesOf(qs)
+
+	if f.Ordered {
+		expectSeekOrder(t, qs.QuadsAllIterator)
+		expectSeekOrder(t, qs.NodesAllIterator)
+	}
+	if f.Seek {
+		d := qs.ValueOf(quad.String("D"))
+		expectSeekOrder(t, func() graph.Iterator {
+			return qs.QuadIterator(quad.Subject, d)
+		})
+	}
+	if f.BulkLookup {
+		_, ok := graph.Unwrap(qs).(graph.BatchQuadStore)
+		require.True(t, ok, "bulk lookups are reported, but not implemented")
+		names := []quad.Value{quad.String("A"), quad.String("B")}
+		refs, err := graph.RefsOf(ctx, qs, names)
+		require.NoError(t, err)
+		got, err := graph.ValuesOf(ctx, qs, refs)
+		require.NoError(t, err)
+		require.Equal(t, names, got)
+	}
+	if f.LabelIndex {
+		it := qs.QuadIterator(quad.Label, qs.ValueOf(quad.String("status_graph")))
+		sz, exact := it.Size()
+		it.Close()
+		require.True(t, exact, "label index must report an exact size")
+		require.Equal(t, int64(3), sz, "label lookup is not served by an index")
+	}
+	if f.DeltaLog {
+		q := MakeQuadSet()[0]
+		require.NoError(t, w.RemoveQuad(q))
+		hist, err := graph.QuadHistory(ctx, qs, q)
+		require.NoError(t, err)
+		require.Len(t, hist, 2)
+		require.Equal(t, graph.Add, hist[0].Action)
+		require.Equal(t, graph.Delete, hist[1].Action)
+	}
+	if f.Snapshots {
+		s, ok := graph.Unwrap(qs).(graph.Snapshotter)
+		require.True(t, ok, "snapshots are reported, but not implemented")
+		snap, err := s.Snapshot()
+		require.NoError(t, err)
+		defer snap.Close()
+		before := IteratedQuads(t, snap, snap.QuadsAllIterator())
+
+		require.NoError(t, w.AddQuad(quad.Make("E", "follows", "A", nil)))
+		ExpectIteratedQuads(t, snap, snap.QuadsAllIterator(), before, false)
+	}
+}
+
+// expectSeekOrder checks that an iterator is seekable and returns results in ascending order:
+// seeking to the key of each result must return it, followed by all the results after it.
+func expectSeekOrder(t testing.TB, newIt func() graph.Iterator) {
+	ctx := context.TODO()
+	it := newIt()
+	sk, ok := it.(graph.Seekable)
+	require.True(t, ok, "iterator is not seekable: %T", it)
+	require.NotEmpty(t, sk.SortOrder(), "iterator is not sorted: %v", it)
+	var (
+		keys []interface{}
+		ids  []uint64
+	)
+	for sk.Next(ctx) {
+		keys = append(keys, graph.ToKey(sk.Result()))
+		if n := len(ids); n != 0 {
+			require.True(t, ids[n-1] <= sk.SortKey(), "sort keys are not ascending")
+		}
+		ids = append(ids, sk.SortKey())
+	}
+	require.NoError(t, sk.Err())
+	sk.Close()
+	require.NotEmpty(t, keys)
+
+	for i, k := range ids {
+		it := newIt().(graph.Seekable)
+		got, ok := iterator.SeekKey(ctx, it, k)
+		require.True(t, ok, "cannot seek to result %d", i)
+		rest := []interface{}{graph.ToKey(got)}
+		for it.Next(ctx) {
+			rest = append(rest, graph.ToKey(it.Result()))
+		}
+		require.NoError(t, it.Err())
+		it.Close()
+		// results with the same key are considered equal
+		j := i
+		for j > 0 && ids[j-1] == k {
+			j--
+		}
+		require.Equal(t, keys[j:], rest, "results are not sorted")
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
 	"github.com/cayleygraph/cayley/internal"
+	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/query"
 	"github.com/cayleygraph/cayley/query/gizmo"
 	_ "github.com/cayleygraph/cayley/writer"
@@ -476,7 +477,7 @@ func prepare(t testing.TB, gen testutil.DatabaseFunc) (*graph.Handle, func()) {
 		start := time.Now()
 		var err error
 		for _, p := range []string{"./", "../"} {
-			err = internal.Load(h.QuadWriter, 0, filepath.Join(p, "../../data/30kmoviedata.nq.gz"), format)
+			err = internal.DecompressAndLoad(h.QuadWriter, 0, filepath.Join(p, "../../data/30kmoviedata.nq.gz"), format, quad.BNodePreserve, quad.Validation{})
 			if err == nil || !os.IsNotExist(err) {
 				break
 			}
@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/cayleygraph/cayley/clog"
+)
+
+// CommitHook observes deltas applied to a quad store. It receives deltas as they were
+// passed to ApplyDeltas and the horizon of the quad store after the commit. If ignore
+// options were set, deltas may include quads that were already present or missing.
+//
+// Hooks are used to maintain derived data, such as indexes and statistics.
+type CommitHook func(deltas []Delta, horizon PrimaryKey) error
+
+type commitHook struct {
+	fn       CommitHook
+	critical bool
+}
+
+var commitHooks struct {
+	sync.RWMutex
+	last  int
+	hooks map[int]commitHook
+	order []int // ids of hooks in the registration order
+	errs  int64 // accessed atomically
+}
+
+// AddCommitHook registers a hook that is called after each successful write to quad
+// stores that support hooks (currently memstore and KV backends). The returned
+// function removes the hook.
+//
+// Guarantees:
+//
+//   - Hooks are called in the registration order, after all critical hooks.
+//   - Hooks are called synchronously while the quad store holds its write lock, thus
+//     commits to the same quad store are observed in the order of their horizons.
+//     Hooks must not write to the same quad store.
+//   - An error of the hook is logged and counted (see CommitHookErrors), but the write
+//     is not rolled back and other hooks are still called.
+//   - Hooks are called at most once per commit. If the process crashes after the commit,
+//     the hook is not called for it. Hooks that maintain persistent data should store the
+//     horizon of the last delta they observed and catch up from the quad store on restart,
+//     which gives at-least-once delivery.
+func AddCommitHook(fn CommitHook) (remove func()) {
+	return addCommitHook(commitHook{fn: fn})
+}
+
+// AddCriticalCommitHook registers a hook that must succeed for the write to be committed.
+// Critical hooks are called in the registration order, inside the write transaction, just
+// before it's committed. If a critical hook fails, following hooks are not called, the
+// transaction is rolled back and the error is returned by ApplyDeltas.
+//
+// The horizon passed to critical hooks is the one the quad store will have if the commit
+// succeeds. The commit itself may still fail after hooks were called.
+func AddCriticalCommitHook(fn CommitHook) (remove func()) {
+	return addCommitHook(commitHook{fn: fn, critical: true})
+}
+
+func addCommitHook(h commitHook) func() {
+	if h.fn == nil {
+		panic("commit hook must not be nil")
+	}
+	commitHooks.Lock()
+	defer commitHooks.Unlock()
+	if commitHooks.hooks == nil {
+		commitHooks.hooks = make(map[int]commitHook)
+	}
+	commitHooks.last++
+	id := commitHooks.last
+	commitHooks.hooks[id] = h
+	commitHooks.order = append(commitHooks.order, id)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			commitHooks.Lock()
+			defer commitHooks.Unlock()
+			delete(commitHooks.hooks, id)
+			for i, v := range commitHooks.order {
+				if v == id {
+					commitHooks.order = append(commitHooks.order[:i:i], commitHooks.order[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// listCommitHooks returns registered hooks of a given kind in the registration order.
+func listCommitHooks(critical bool) []CommitHook {
+	commitHooks.RLock()
+	defer commitHooks.RUnlock()
+	var out []CommitHook
+	for _, id := range commitHooks.order {
+		if h := commitHooks.hooks[id]; h.critical == critical {
+			out = append(out, h.fn)
+		}
+	}
+	return out
+}
+
+// HasCommitHooks reports if any commit hooks are registered. Quad stores may use it
+// to avoid calculating the horizon for hooks.
+func HasCommitHooks() bool {
+	commitHooks.RLock()
+	defer commitHooks.RUnlock()
+	return len(commitHooks.order) != 0
+}
+
+// CommitHookErrors returns the number of errors returned by non-critical commit hooks.
+func CommitHookErrors() int64 {
+	return atomic.LoadInt64(&commitHooks.errs)
+}
+
+// BeforeCommit calls critical commit hooks. Quad stores must call it inside the write
+// transaction, before committing it, and must abort the transaction if it fails.
+func BeforeCommit(deltas []Delta, horizon PrimaryKey) error {
+	for _, fn := range listCommitHooks(true) {
+		if err := fn(deltas, horizon); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterCommit calls non-critical commit hooks. Quad stores must call it after a
+// successful commit, while still holding the write lock.
+func AfterCommit(deltas []Delta, horizon PrimaryKey) {
+	for _, fn := range listCommitHooks(false) {
+		if err := fn(deltas, horizon); err != nil {
+			atomic.AddInt64(&commitHooks.errs, 1)
+			clog.Errorf("commit hook failed at horizon %v: %v", horizon, err)
+		}
+	}
+}
+
+// WriteStats is a number of quads written to all quad stores that support commit hooks.
+type WriteStats struct {
+	Commits int64 // number of successful ApplyDeltas calls
+	Added   int64 // number of added quads
+	Deleted int64 // number of deleted quads
+}
+
+var writeStats WriteStats // accessed atomically
+
+func init() {
+	AddCommitHook(countWrites)
+}
+
+// countWrites is a commit hook that maintains WriteStats.
+func countWrites(deltas []Delta, _ PrimaryKey) error {
+	var add, del int64
+	for _, d := range deltas {
+		switch d.Action {
+		case Add:
+			add++
+		case Delete:
+			del++
+		}
+	}
+	atomic.AddInt64(&writeStats.Commits, 1)
+	atomic.AddInt64(&writeStats.Added, add)
+	atomic.AddInt64(&writeStats.Deleted, del)
+	return nil
+}
+
+// GetWriteStats returns the number of writes since the process has started.
+// Deltas ignored because of IgnoreOpts are counted as well.
+func GetWriteStats() WriteStats {
+	return WriteStats{
+		Commits: atomic.LoadInt64(&writeStats.Commits),
+		Added:   atomic.LoadInt64(&writeStats.Added),
+		Deleted: atomic.LoadInt64(&writeStats.Deleted),
+	}
+}
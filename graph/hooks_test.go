@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestCommitHooks(t *testing.T) {
+	var calls []string
+	hook := func(name string, err error) CommitHook {
+		return func(_ []Delta, _ PrimaryKey) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	errHook := errors.New("hook failed")
+	rm1 := AddCommitHook(hook("a", errHook))
+	defer rm1()
+	rm2 := AddCriticalCommitHook(hook("critical", nil))
+	defer rm2()
+	rm3 := AddCommitHook(hook("b", nil))
+
+	deltas := []Delta{
+		{Quad: quad.MakeIRI("a", "b", "c", ""), Action: Add},
+		{Quad: quad.MakeIRI("a", "b", "d", ""), Action: Add},
+		{Quad: quad.MakeIRI("a", "b", "e", ""), Action: Delete},
+	}
+	stats := GetWriteStats()
+	nerr := CommitHookErrors()
+	if err := BeforeCommit(deltas, NewSequentialKey(1)); err != nil {
+		t.Fatal(err)
+	}
+	AfterCommit(deltas, NewSequentialKey(1))
+	if exp := []string{"critical", "a", "b"}; !reflect.DeepEqual(calls, exp) {
+		t.Errorf("unexpected order of hooks: %v vs %v", calls, exp)
+	}
+	if n := CommitHookErrors(); n != nerr+1 {
+		t.Errorf("expected hook error to be counted, got: %d", n-nerr)
+	}
+	exp := WriteStats{Commits: stats.Commits + 1, Added: stats.Added + 2, Deleted: stats.Deleted + 1}
+	if st := GetWriteStats(); st != exp {
+		t.Errorf("unexpected write stats: %+v vs %+v", st, exp)
+	}
+
+	calls = nil
+	rm3()
+	rm3()
+	AfterCommit(deltas, NewSequentialKey(2))
+	if exp := []string{"a"}; !reflect.DeepEqual(calls, exp) {
+		t.Errorf("unexpected hooks after removal: %v vs %v", calls, exp)
+	}
+
+	calls = nil
+	rm := AddCriticalCommitHook(hook("fail", errHook))
+	defer rm()
+	rm4 := AddCriticalCommitHook(hook("skipped", nil))
+	defer rm4()
+	if err := BeforeCommit(deltas, NewSequentialKey(3)); err != errHook {
+		t.Errorf("expected critical hook to fail, got: %v", err)
+	}
+	if exp := []string{"critical", "fail"}; !reflect.DeepEqual(calls, exp) {
+		t.Errorf("unexpected critical hooks: %v vs %v", calls, exp)
+	}
+}
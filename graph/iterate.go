@@ -19,7 +19,11 @@ type IterateChain struct {
 	optimize bool
 
 	limit int
-	n     int
+	n     int   // results and paths returned
+	nres  int64 // results returned by Next, without paths
+
+	truncated bool
+	io        IOStats
 }
 
 // Iterate is a set of helpers for iteration. Context may be used to cancel execution.
@@ -42,9 +46,18 @@ func (c *IterateChain) next() bool {
 		return false
 	default:
 	}
-	ok := (c.limit < 0 || c.n < c.limit) && c.it.Next(c.ctx)
+	if c.limit >= 0 && c.n >= c.limit {
+		// check if the limit has dropped any results; it's not necessary if the size
+		// is known to be exhausted
+		if size, exact := c.it.Size(); !exact || size > c.nres {
+			c.truncated = c.truncated || c.it.Next(c.ctx)
+		}
+		return false
+	}
+	ok := c.it.Next(c.ctx)
 	if ok {
 		c.n++
+		c.nres++
 	}
 	return ok
 }
@@ -54,13 +67,27 @@ func (c *IterateChain) nextPath() bool {
 		return false
 	default:
 	}
-	ok := c.paths && (c.limit < 0 || c.n < c.limit) && c.it.NextPath(c.ctx)
+	if !c.paths {
+		return false
+	} else if c.limit >= 0 && c.n >= c.limit {
+		// the next path belongs to the last result, so checking it is cheap
+		c.truncated = c.truncated || c.it.NextPath(c.ctx)
+		return false
+	}
+	ok := c.it.NextPath(c.ctx)
 	if ok {
 		c.n++
 	}
 	return ok
 }
-func (c *IterateChain) start() {
+
+// start prepares the iterator for execution. If the iterator tree is too deep to be
+// processed, the iterator is closed and an error is returned.
+func (c *IterateChain) start() error {
+	if err := CheckDepth(c.it); err != nil {
+		c.it.Close()
+		return err
+	}
 	if c.optimize {
 		c.it, _ = c.it.Optimize()
 		if c.qs != nil {
@@ -68,19 +95,25 @@ func (c *IterateChain) start() {
 		}
 	}
 	if !clog.V(2) {
-		return
+		return nil
 	}
 	if b, err := json.MarshalIndent(DescribeIterator(c.it), "", "  "); err != nil {
 		clog.Infof("failed to format description: %v", err)
 	} else {
 		clog.Infof("%s", b)
 	}
+	return nil
 }
 func (c *IterateChain) end() {
+	if c.ctx.Err() != nil || IsTruncated(c.it) {
+		c.truncated = true
+	}
 	c.it.Close()
+	c.io = TotalIOStats(c.it)
 	if !clog.V(2) {
 		return
 	}
+	clog.Infof("backend reads: %d, cache hits: %d, bytes: %d", c.io.Reads, c.io.CacheHits, c.io.Bytes)
 	if b, err := json.MarshalIndent(DumpStats(c.it), "", "  "); err != nil {
 		clog.Infof("failed to format stats: %v", err)
 	} else {
@@ -88,7 +121,40 @@ func (c *IterateChain) end() {
 	}
 }
 
-// Limit limits a total number of results returned.
+// Explain optimizes the iterator the same way as other methods of the chain, but
+// instead of running it, returns a description of the iterator tree with estimated
+// costs. See ExplainIterator.
+//
+// If the tree is too deep to be processed, only the root iterator is described, and its
+// name is set to the error.
+func (c *IterateChain) Explain() Description {
+	if err := c.start(); err != nil {
+		return Description{UID: c.it.UID(), Type: c.it.Type(), Name: err.Error()}
+	}
+	d := ExplainIterator(c.it)
+	c.io = TotalIOStats(c.it)
+	c.it.Close()
+	return d
+}
+
+// Truncated reports if the last execution has stopped early and some results were dropped,
+// either because of the limit set on the chain, a truncating iterator (see Truncater),
+// or because the context was canceled.
+//
+// When the limit is reached, a single result is requested from the iterator to check
+// if it had more results, unless the iterator reports an exact size that was already returned.
+func (c *IterateChain) Truncated() bool {
+	return c.truncated
+}
+
+// IOStats returns reads performed on the backend by the last execution. See TotalIOStats.
+// After Explain, it returns reads made while estimating the costs.
+func (c *IterateChain) IOStats() IOStats {
+	return c.io
+}
+
+// Limit limits a total number of results returned, including sub-paths.
+// The iterator is closed as soon as the limit is reached and checked for more results.
 func (c *IterateChain) Limit(n int) *IterateChain {
 	c.limit = n
 	return c
@@ -107,6 +173,13 @@ func (c *IterateChain) On(qs QuadStore) *IterateChain {
 	return c
 }
 
+// Budget sets a memory budget shared by all iterators of the tree that buffer results
+// (see WithBudget). Budget is released when the iteration ends.
+func (c *IterateChain) Budget(b *Budget) *IterateChain {
+	c.ctx = WithBudget(c.ctx, b)
+	return c
+}
+
 // UnOptimized disables iterator optimization.
 func (c *IterateChain) UnOptimized() *IterateChain {
 	c.optimize = false
@@ -115,7 +188,9 @@ func (c *IterateChain) UnOptimized() *IterateChain {
 
 // Each will run a provided callback for each result of the iterator.
 func (c *IterateChain) Each(fnc func(Value)) error {
-	c.start()
+	if err := c.start(); err != nil {
+		return err
+	}
 	defer c.end()
 	done := c.ctx.Done()
 
@@ -140,7 +215,9 @@ func (c *IterateChain) Each(fnc func(Value)) error {
 
 // All will return all results of an iterator.
 func (c *IterateChain) Count() (int64, error) {
-	c.start()
+	if err := c.start(); err != nil {
+		return 0, err
+	}
 	defer c.end()
 	if err := c.it.Err(); err != nil {
 		return 0, err
@@ -172,7 +249,9 @@ iteration:
 
 // All will return all results of an iterator.
 func (c *IterateChain) All() ([]Value, error) {
-	c.start()
+	if err := c.start(); err != nil {
+		return nil, err
+	}
 	defer c.end()
 	done := c.ctx.Done()
 	var out []Value
@@ -198,7 +277,9 @@ iteration:
 
 // First will return a first result of an iterator. It returns nil if iterator is empty.
 func (c *IterateChain) First() (Value, error) {
-	c.start()
+	if err := c.start(); err != nil {
+		return nil, err
+	}
 	defer c.end()
 	if !c.next() {
 		return nil, c.it.Err()
@@ -210,7 +291,9 @@ func (c *IterateChain) First() (Value, error) {
 //
 // Channel will NOT be closed when function returns.
 func (c *IterateChain) Send(out chan<- Value) error {
-	c.start()
+	if err := c.start(); err != nil {
+		return err
+	}
 	defer c.end()
 	done := c.ctx.Done()
 	for c.next() {
@@ -232,7 +315,9 @@ func (c *IterateChain) Send(out chan<- Value) error {
 
 // TagEach will run a provided tag map callback for each result of the iterator.
 func (c *IterateChain) TagEach(fnc func(map[string]Value)) error {
-	c.start()
+	if err := c.start(); err != nil {
+		return err
+	}
 	defer c.end()
 	done := c.ctx.Done()
 
@@ -337,7 +422,9 @@ func (c *IterateChain) SendValues(qs QuadStore, out chan<- quad.Value) error {
 	if c.qs == nil {
 		return errNoQuadStore
 	}
-	c.start()
+	if err := c.start(); err != nil {
+		return err
+	}
 	defer c.end()
 	done := c.ctx.Done()
 	send := func(v Value) error {
@@ -18,6 +18,8 @@ package graph
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/cayleygraph/cayley/clog"
@@ -167,26 +169,145 @@ type Iterator interface {
 	SubIterators() []Iterator
 
 	// Close the iterator and do internal cleanup.
+	//
+	// Closing the root iterator closes the whole tree: each iterator must close all
+	// its sub-iterators and release any backend resources (cursors, transactions)
+	// it has opened. Close must be idempotent: resources are released only once, and
+	// calling it again has no effect. The iterator may acquire resources again if
+	// it's used after Close, thus it should be closed again after that.
 	Close() error
 
 	// UID returns the unique identifier of the iterator.
 	UID() uint64
 }
 
+// Truncater is an optional interface for iterators that may stop the iteration
+// before all results of their subiterators were returned (ex: Limit or Timeout).
+type Truncater interface {
+	// Truncated reports if the iterator has stopped early and some results were dropped.
+	Truncated() bool
+}
+
+// LimitHinter is an optional interface for iterators that can stop scanning early, if
+// only a few results will be requested (ex: a backend scan under Limit).
+type LimitHinter interface {
+	// SetLimitHint informs the iterator that at most n results will be requested with Next.
+	// It is only a hint: the iterator must still return all results, if requested.
+	SetLimitHint(n int64)
+}
+
+// IsTruncated checks if the iterator or any of its subiterators has dropped some results.
+// Iterators that do not implement Truncater are considered complete.
+func IsTruncated(it Iterator) bool {
+	if t, ok := it.(Truncater); ok && t.Truncated() {
+		return true
+	}
+	for _, sub := range it.SubIterators() {
+		if IsTruncated(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Seekable is an optional interface for iterators that return results in ascending
+// order of integer keys and can skip forward to a given key without reading the
+// results before it (ex: index scans of ordered backends).
+//
+// The order is defined by the backend, see SortOrder of the backend iterators.
+// Iterators with the same sort order can be intersected by seeking (see iterator.ZigZag)
+// and merged without comparing values (see iterator.MergeSorted). Results with the
+// same key in the same order are considered equal.
+type Seekable interface {
+	Iterator
+	// SortOrder returns a name of the key space in which results are sorted,
+	// or an empty string if results are not sorted. Other methods of the
+	// interface must not be called if the sort order is empty.
+	SortOrder() string
+	// SortKey returns a key of the current result.
+	SortKey() uint64
+	// NextGE advances the iterator to the next result with a key greater than or
+	// equal to k. It must only be called before the first result, or when the key
+	// of the current result is less than k.
+	NextGE(ctx context.Context, k uint64) bool
+}
+
+// IOStats counts reads performed by an iterator on the backend.
+type IOStats struct {
+	Reads     int64 // number of keys read from the backend
+	CacheHits int64 // number of reads served from a cache
+	Bytes     int64 // number of bytes read from the backend
+}
+
+// Add adds reads from another stats to this one.
+func (s *IOStats) Add(o IOStats) {
+	s.Reads += o.Reads
+	s.CacheHits += o.CacheHits
+	s.Bytes += o.Bytes
+}
+
+// IOStater is an optional interface for iterators that read data from the backend
+// (ex: index scans of KV or SQL backends).
+type IOStater interface {
+	// IOStats returns reads performed by the iterator itself, excluding its subiterators.
+	// Reads of the iterators that are created internally (and are not returned by
+	// SubIterators) are included.
+	IOStats() IOStats
+}
+
+// TotalIOStats returns the sum of reads performed by the iterator and all its subiterators.
+// Iterators that do not implement IOStater are considered to perform no reads.
+func TotalIOStats(it Iterator) IOStats {
+	var st IOStats
+	if s, ok := it.(IOStater); ok {
+		st = s.IOStats()
+	}
+	for _, sub := range it.SubIterators() {
+		st.Add(TotalIOStats(sub))
+	}
+	return st
+}
+
 // DescribeIterator returns a description of the iterator tree.
+//
+// Values in the description are not resolved, use DescribeIteratorFor to get
+// a description that can be serialized and rebuilt with BuildFromDescription.
 func DescribeIterator(it Iterator) Description {
-	sz, exact := it.Size()
-	d := Description{
-		UID:  it.UID(),
-		Name: it.String(),
-		Type: it.Type(),
-		Tags: it.Tagger().Tags(),
-		Size: sz, Exact: exact,
+	return describeIterator(it, false)
+}
+
+// ExplainIterator is the same as DescribeIterator, but also includes estimated
+// costs and sizes of each iterator in the tree. Iterators are never advanced.
+func ExplainIterator(it Iterator) Description {
+	return describeIterator(it, true)
+}
+
+func describeIterator(it Iterator, stats bool) Description {
+	var d Description
+	if di, ok := it.(Describer); ok {
+		d = di.Describe()
+	}
+	d.UID = it.UID()
+	d.Name = it.String()
+	if d.Type == "" {
+		d.Type = it.Type()
+	}
+	d.Tags = it.Tagger().Tags()
+	if fixed := it.Tagger().Fixed(); len(fixed) != 0 {
+		d.FixedRefs = fixed
+	}
+	if stats {
+		st := it.Stats()
+		d.Stats = &st
+		d.Size, d.Exact = st.Size, st.ExactSize
+	}
+	if d.Iterators != nil {
+		return d
 	}
 	if sub := it.SubIterators(); len(sub) != 0 {
 		d.Iterators = make([]Description, 0, len(sub))
 		for _, sit := range sub {
-			d.Iterators = append(d.Iterators, DescribeIterator(sit))
+			d.Iterators = append(d.Iterators, describeIterator(sit, stats))
 		}
 	}
 	return d
@@ -197,9 +318,28 @@ type Description struct {
 	Name      string        `json:",omitempty"`
 	Type      Type          `json:",omitempty"`
 	Tags      []string      `json:",omitempty"`
-	Size      int64         `json:",omitempty"`
-	Exact     bool          `json:",omitempty"`
 	Iterators []Description `json:",omitempty"`
+
+	// Size, Exact and Stats are estimated costs of the iterator. Only set by ExplainIterator.
+	Size  int64          `json:",omitempty"`
+	Exact bool           `json:",omitempty"`
+	Stats *IteratorStats `json:",omitempty"`
+
+	// Fields below describe parameters of the iterator. See BuildFromDescription.
+
+	FixedTags map[string]string `json:",omitempty"` // values of fixed tags in N-Quads notation
+	Direction quad.Direction    `json:",omitempty"`
+	Values    []string          `json:",omitempty"` // values in N-Quads notation
+	Params    Options           `json:",omitempty"` // parameters specific to the iterator type
+
+	// Morphism describes an iterator tree that is built from each input of iterators
+	// like Recursive. The input is described as an iterator of MorphismInput type.
+	Morphism *Description `json:",omitempty"`
+
+	// Refs and FixedRefs are quad store values that are not yet converted to
+	// Values and FixedTags. See DescribeIteratorFor.
+	Refs      []Value          `json:"-"`
+	FixedRefs map[string]Value `json:"-"`
 }
 
 // ApplyMorphism is a curried function that can generates a new iterator based on some prior iterator.
@@ -232,20 +372,127 @@ func Height(it Iterator, until Type) int {
 	return maxDepth + 1
 }
 
+// MaxDepth is the maximal depth of iterator trees that can be built from descriptions
+// or executed with Iterate. Most methods of iterators process the tree recursively, and
+// the limit protects them from crafted queries that would overflow the stack.
+// Zero or negative value disables the check.
+var MaxDepth = 1000
+
+// ErrTooDeep is returned for iterator trees that are deeper than MaxDepth.
+type ErrTooDeep struct {
+	Max int
+}
+
+func (e *ErrTooDeep) Error() string {
+	return fmt.Sprintf("iterator tree is deeper than %d levels", e.Max)
+}
+
+// CheckDepth returns ErrTooDeep if the iterator tree is deeper than MaxDepth.
+// Unlike Height, it stops descending once the limit is reached.
+func CheckDepth(it Iterator) error {
+	if MaxDepth <= 0 || depthWithin(it, MaxDepth) {
+		return nil
+	}
+	return &ErrTooDeep{Max: MaxDepth}
+}
+
+// depthWithin reports if the height of the tree is at most n.
+func depthWithin(it Iterator, n int) bool {
+	if n <= 0 {
+		return false
+	}
+	for _, sub := range it.SubIterators() {
+		if !depthWithin(sub, n-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrTagCollision is returned when the same tag is declared by different parts
+// of an iterator tree. Such tags would silently overwrite each other in TagResults.
+type ErrTagCollision struct {
+	Tags []string
+}
+
+func (e *ErrTagCollision) Error() string {
+	return "tags declared more than once: " + strings.Join(e.Tags, ", ")
+}
+
+// CheckTags walks the iterator tree and returns ErrTagCollision if any tag is
+// declared by more than one iterator. Tags declared in different branches of an
+// Or are not considered a collision, since only one branch contributes to a result.
+//
+// The check is strict: it also reports the same tag bound independently by branches
+// of an intersection. Query builders should check tags declared by a single path
+// instead, see path.Path.CheckTags.
+func CheckTags(it Iterator) error {
+	var dup []string
+	for tag, n := range countTags(it, nil) {
+		if n > 1 {
+			dup = append(dup, tag)
+		}
+	}
+	if len(dup) == 0 {
+		return nil
+	}
+	sort.Strings(dup)
+	return &ErrTagCollision{Tags: dup}
+}
+
+// countTags returns the number of times each tag will be written by TagResults
+// of the iterator tree. Wrapper iterators may share a Tagger with their parent;
+// such tags are only counted once.
+func countTags(it Iterator, parent *Tagger) map[string]int {
+	out := make(map[string]int)
+	if tg := it.Tagger(); tg != parent {
+		for _, tag := range tg.Tags() {
+			out[tag] = 1
+		}
+		for tag := range tg.Fixed() {
+			out[tag] = 1
+		}
+	}
+	subs := it.SubIterators()
+	if it.Type() == Or {
+		branches := make(map[string]int)
+		for _, sub := range subs {
+			for tag, n := range countTags(sub, it.Tagger()) {
+				if n > branches[tag] {
+					branches[tag] = n
+				}
+			}
+		}
+		for tag, n := range branches {
+			out[tag] += n
+		}
+		return out
+	}
+	for _, sub := range subs {
+		for tag, n := range countTags(sub, it.Tagger()) {
+			out[tag] += n
+		}
+	}
+	return out
+}
+
 // FixedIterator wraps iterators that are modifiable by addition of fixed value sets.
 type FixedIterator interface {
 	Iterator
 	Add(Value)
 }
 
+// IteratorStats describes estimated costs and the size of an iterator, as well as
+// the number of calls made to it. Costs are relative to a single in-memory lookup;
+// see iterator.MaxCost for the cost model.
 type IteratorStats struct {
-	ContainsCost int64
-	NextCost     int64
-	Size         int64
-	ExactSize    bool
-	Next         int64
-	Contains     int64
-	ContainsNext int64
+	ContainsCost int64 // estimated cost of a single Contains call
+	NextCost     int64 // estimated cost of a single Next call
+	Size         int64 // estimated number of results
+	ExactSize    bool  // Size is exact
+	Next         int64 // number of Next calls made so far
+	Contains     int64 // number of Contains calls made so far
+	ContainsNext int64 // number of internal Next calls made by Contains
 }
 
 // Type enumerates the set of Iterator types.
@@ -253,25 +500,53 @@ type Type string
 
 // These are the iterator types, defined as constants
 const (
-	Invalid     = Type("")
-	All         = Type("all")
-	And         = Type("and")
-	Or          = Type("or")
-	HasA        = Type("hasa")
-	LinksTo     = Type("linksto")
-	Comparison  = Type("comparison")
-	Null        = Type("null")
-	Err         = Type("error")
-	Fixed       = Type("fixed")
-	Not         = Type("not")
-	Optional    = Type("optional")
-	Materialize = Type("materialize")
-	Unique      = Type("unique")
-	Limit       = Type("limit")
-	Skip        = Type("skip")
-	Regex       = Type("regexp")
-	Count       = Type("count")
-	Recursive   = Type("recursive")
+	Invalid              = Type("")
+	All                  = Type("all")
+	And                  = Type("and")
+	Or                   = Type("or")
+	HasA                 = Type("hasa")
+	LinksTo              = Type("linksto")
+	Comparison           = Type("comparison")
+	Null                 = Type("null")
+	Err                  = Type("error")
+	Fixed                = Type("fixed")
+	Not                  = Type("not")
+	Optional             = Type("optional")
+	Materialize          = Type("materialize")
+	Unique               = Type("unique")
+	Limit                = Type("limit")
+	Skip                 = Type("skip")
+	Regex                = Type("regexp")
+	Count                = Type("count")
+	DistinctCount        = Type("distinct_count")
+	Recursive            = Type("recursive")
+	RateLimit            = Type("ratelimit")
+	Validate             = Type("validate")
+	Sort                 = Type("sort")
+	ZigZag               = Type("zigzag")
+	AndBitmap            = Type("and_bitmap")
+	CIDRMatch            = Type("cidr")
+	Timeout              = Type("timeout")
+	CardinalityViolation = Type("cardinality_violation")
+	Sync                 = Type("sync")
+	Nearest              = Type("nearest")
+	Page                 = Type("page")
+	SlidingCount         = Type("sliding_count")
+	MergeSorted          = Type("merge_sorted")
+	RequireTags          = Type("require_tags")
+	Lazy                 = Type("lazy")
+	Prefix               = Type("prefix")
+	Sample               = Type("sample")
+	Predicates           = Type("predicates")
+	Follow               = Type("follow")
+	LimitPerNode         = Type("limit_per_node")
+	CycleDetect          = Type("cycle_detect")
+	Enumerate            = Type("enumerate")
+	DegreeSample         = Type("degree_sample")
+	DistinctPairs        = Type("distinct_pairs")
+	Edge                 = Type("edge")
+	Shared               = Type("shared")
+	MorphismInput        = Type("morphism_input")
 )
 
 // String returns a string representation of the Type.
@@ -286,6 +561,7 @@ type StatsContainer struct {
 	UID  uint64
 	Type Type
 	IteratorStats
+	IO     *IOStats `json:",omitempty"`
 	SubIts []StatsContainer
 }
 
@@ -294,6 +570,10 @@ func DumpStats(it Iterator) StatsContainer {
 	out.IteratorStats = it.Stats()
 	out.Type = it.Type()
 	out.UID = it.UID()
+	if s, ok := it.(IOStater); ok {
+		st := s.IOStats()
+		out.IO = &st
+	}
 	for _, sub := range it.SubIterators() {
 		out.SubIts = append(out.SubIts, DumpStats(sub))
 	}
@@ -17,12 +17,71 @@ package iterator
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/cayleygraph/cayley/graph"
 )
 
 var _ graph.Iterator = &And{}
 
+// TagPolicy defines how the And iterator combines tags when more than one of
+// its subiterators sets the same tag to different values.
+type TagPolicy int
+
+const (
+	// TagKeepLast keeps the value set by the last subiterator. This is the default.
+	TagKeepLast = TagPolicy(iota)
+	// TagKeepFirst keeps the value set by the first subiterator.
+	TagKeepFirst
+	// TagErrorOnConflict fails the iteration with ErrTagConflict on the first result
+	// with conflicting tags. The result itself is not returned.
+	TagErrorOnConflict
+	// TagCollectAll sets the tag to TagValues containing all distinct values.
+	TagCollectAll
+)
+
+func (p TagPolicy) String() string {
+	switch p {
+	case TagKeepLast:
+		return "keep_last"
+	case TagKeepFirst:
+		return "keep_first"
+	case TagErrorOnConflict:
+		return "error"
+	case TagCollectAll:
+		return "collect"
+	}
+	return fmt.Sprintf("TagPolicy(%d)", int(p))
+}
+
+// TagValues is a set of values of a single tag, returned by And with TagCollectAll policy.
+type TagValues []graph.Value
+
+// tagValuesKey is a key of TagValues: a list of keys of all values, in order.
+type tagValuesKey struct {
+	key  interface{}
+	next interface{}
+}
+
+func (v TagValues) Key() interface{} {
+	var k interface{}
+	for i := len(v) - 1; i >= 0; i-- {
+		k = tagValuesKey{key: graph.ToKey(v[i]), next: k}
+	}
+	return k
+}
+
+// ErrTagConflict is returned by And with TagErrorOnConflict policy when subiterators
+// set the same tag to different values.
+type ErrTagConflict struct {
+	Tag    string
+	Values []graph.Value
+}
+
+func (e *ErrTagConflict) Error() string {
+	return fmt.Sprintf("conflicting values for tag %q: %v", e.Tag, e.Values)
+}
+
 // The And iterator. Consists of a number of subiterators, the primary of which will
 // be Next()ed if next is called.
 type And struct {
@@ -36,6 +95,7 @@ type And struct {
 	runstats          graph.IteratorStats
 	err               error
 	qs                graph.QuadStore
+	tagPolicy         TagPolicy
 }
 
 // NewAnd creates an And iterator. `qs` is only required when needing a handle
@@ -59,6 +119,7 @@ func (it *And) UID() uint64 {
 // Reset all internal iterators
 func (it *And) Reset() {
 	it.result = nil
+	it.err = nil
 	it.primaryIt.Reset()
 	for _, sub := range it.internalIterators {
 		sub.Reset()
@@ -70,28 +131,105 @@ func (it *And) Tagger() *graph.Tagger {
 	return &it.tags
 }
 
+// SetTagPolicy sets the way tags are combined when subiterators disagree on their values.
+func (it *And) SetTagPolicy(p TagPolicy) {
+	it.tagPolicy = p
+}
+
+// TagPolicy returns the current policy for conflicting tags.
+func (it *And) TagPolicy() TagPolicy {
+	return it.tagPolicy
+}
+
 // An extended TagResults, as it needs to add it's own results and
 // recurse down it's subiterators.
 func (it *And) TagResults(dst map[string]graph.Value) {
-	it.tags.TagResult(dst, it.Result())
+	if it.tagPolicy == TagKeepLast {
+		it.tags.TagResult(dst, it.Result())
 
-	if it.primaryIt != nil {
-		it.primaryIt.TagResults(dst)
+		if it.primaryIt != nil {
+			it.primaryIt.TagResults(dst)
+		}
+		for _, sub := range it.internalIterators {
+			sub.TagResults(dst)
+		}
+		return
 	}
-	for _, sub := range it.internalIterators {
-		sub.TagResults(dst)
+	// conflicts were already reported by Next and Contains
+	out := make(map[string]graph.Value)
+	it.collectTags(out)
+	for tag, v := range out {
+		dst[tag] = v
+	}
+}
+
+// collectTags collects tags from each source separately to detect conflicts.
+// It returns the first conflict, if the policy does not resolve it.
+func (it *And) collectTags(out map[string]graph.Value) error {
+	var err error
+	it.tags.TagResult(out, it.Result())
+	for _, sub := range it.SubIterators() {
+		m := make(map[string]graph.Value)
+		sub.TagResults(m)
+		for tag, v := range m {
+			if e := it.mergeTag(out, tag, v); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// checkTags fails the iteration if subiterators set conflicting tags for the current
+// result and the policy requires an error. It returns false in this case.
+func (it *And) checkTags() bool {
+	if it.tagPolicy != TagErrorOnConflict {
+		return true
+	}
+	return !it.setErr(it.collectTags(make(map[string]graph.Value)))
+}
+
+// mergeTag adds a tag value to dst according to the tag policy. It returns an error
+// for conflicting values with TagErrorOnConflict policy; the first value is kept.
+func (it *And) mergeTag(dst map[string]graph.Value, tag string, v graph.Value) error {
+	prev, ok := dst[tag]
+	if !ok {
+		dst[tag] = v
+		return nil
+	}
+	if vals, ok := prev.(TagValues); ok {
+		for _, x := range vals {
+			if graph.ToKey(x) == graph.ToKey(v) {
+				return nil
+			}
+		}
+		dst[tag] = append(vals, v)
+		return nil
+	} else if graph.ToKey(prev) == graph.ToKey(v) {
+		return nil
+	}
+	switch it.tagPolicy {
+	case TagKeepFirst:
+	case TagErrorOnConflict:
+		return &ErrTagConflict{Tag: tag, Values: []graph.Value{prev, v}}
+	case TagCollectAll:
+		dst[tag] = TagValues{prev, v}
+	default:
+		dst[tag] = v
 	}
+	return nil
 }
 
 func (it *And) Clone() graph.Iterator {
 	and := NewAnd(it.qs)
 	and.AddSubIterator(it.primaryIt.Clone())
 	and.tags.CopyFrom(it)
+	and.tagPolicy = it.tagPolicy
 	for _, sub := range it.internalIterators {
 		and.AddSubIterator(sub.Clone())
 	}
 	if it.checkList != nil {
-		and.optimizeContains()
+		and.optimizeContains(nil)
 	}
 	return and
 }
@@ -133,17 +271,36 @@ func (it *And) AddSubIterator(sub graph.Iterator) {
 func (it *And) Next(ctx context.Context) bool {
 	graph.NextLogIn(it)
 	it.runstats.Next += 1
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	}
 	for it.primaryIt.Next(ctx) {
 		curr := it.primaryIt.Result()
 		if it.subItsContain(ctx, curr, nil) {
 			it.result = curr
-			return graph.NextLogOut(it, true)
+			return graph.NextLogOut(it, it.checkTags())
+		} else if it.err != nil {
+			return graph.NextLogOut(it, false)
 		}
 	}
-	it.err = it.primaryIt.Err()
+	it.setErr(it.primaryIt.Err())
 	return graph.NextLogOut(it, false)
 }
 
+// setErr records the first error of subiterators. All subiterators are closed right away
+// to release their resources, instead of waiting for an explicit Close.
+// It returns false if there is no error.
+func (it *And) setErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if it.err == nil {
+		it.err = err
+		it.Close()
+	}
+	return true
+}
+
 func (it *And) Err() error {
 	if err := it.err; err != nil {
 		return err
@@ -169,9 +326,15 @@ func (it *And) subItsContain(ctx context.Context, val graph.Value, lastResult gr
 	for i, sub := range it.internalIterators {
 		subIsGood = sub.Contains(ctx, val)
 		if !subIsGood {
+			if it.setErr(sub.Err()) {
+				return false
+			}
 			if lastResult != nil {
 				for j := 0; j < i; j++ {
-					it.internalIterators[j].Contains(ctx, lastResult)
+					prev := it.internalIterators[j]
+					if !prev.Contains(ctx, lastResult) && it.setErr(prev.Err()) {
+						return false
+					}
 				}
 			}
 			break
@@ -185,8 +348,7 @@ func (it *And) checkContainsList(ctx context.Context, val graph.Value, lastResul
 	for i, c := range it.checkList {
 		ok = c.Contains(ctx, val)
 		if !ok {
-			it.err = c.Err()
-			if it.err != nil {
+			if it.setErr(c.Err()) {
 				return false
 			}
 
@@ -201,8 +363,7 @@ func (it *And) checkContainsList(ctx context.Context, val graph.Value, lastResul
 					// which will be 'true'
 					it.checkList[j].Contains(ctx, lastResult)
 
-					it.err = it.checkList[j].Err()
-					if it.err != nil {
+					if it.setErr(it.checkList[j].Err()) {
 						return false
 					}
 				}
@@ -212,6 +373,7 @@ func (it *And) checkContainsList(ctx context.Context, val graph.Value, lastResul
 	}
 	if ok {
 		it.result = val
+		ok = it.checkTags()
 	}
 	return graph.ContainsLogOut(it, val, ok)
 }
@@ -220,6 +382,9 @@ func (it *And) checkContainsList(ctx context.Context, val graph.Value, lastResul
 func (it *And) Contains(ctx context.Context, val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
 	it.runstats.Contains += 1
+	if it.err != nil {
+		return graph.ContainsLogOut(it, val, false)
+	}
 	lastResult := it.result
 	if it.checkList != nil {
 		return it.checkContainsList(ctx, val, lastResult)
@@ -229,10 +394,14 @@ func (it *And) Contains(ctx context.Context, val graph.Value) bool {
 		othersGood := it.subItsContain(ctx, val, lastResult)
 		if othersGood {
 			it.result = val
-			return graph.ContainsLogOut(it, val, true)
+			return graph.ContainsLogOut(it, val, it.checkTags())
 		}
+	} else {
+		it.setErr(it.primaryIt.Err())
 	}
-	if lastResult != nil {
+	if it.err != nil {
+		return graph.ContainsLogOut(it, val, false)
+	} else if lastResult != nil {
 		it.primaryIt.Contains(ctx, lastResult)
 	}
 	return graph.ContainsLogOut(it, val, false)
@@ -242,42 +411,71 @@ func (it *And) Contains(ctx context.Context, val graph.Value) bool {
 // with an intersection, we know that the largest we can be is the size of the
 // smallest iterator. This is the heuristic we shall follow. Better heuristics
 // welcome.
+//
+// Optional iterators never restrict the results, thus their sizes are ignored.
+// Lazy iterators are asked last, and are not built if the And is known to be empty.
 func (it *And) Size() (int64, bool) {
-	val, b := it.primaryIt.Size()
-	for _, sub := range it.internalIterators {
+	val, b := int64(-1), false
+	for _, sub := range lazyLast(it.SubIterators()) {
+		if !restricts(sub) {
+			continue
+		}
 		newval, newb := sub.Size()
+		if newb && newval == 0 {
+			// intersection with an empty set is empty, no need to ask other iterators
+			return 0, true
+		}
+		if val < 0 {
+			val, b = newval, newb
+			continue
+		}
 		if val > newval {
 			val = newval
 		}
 		b = newb && b
 	}
+	if val < 0 {
+		return it.primaryIt.Size()
+	}
 	return val, b
 }
 
 // An And has no NextPath of its own -- that is, there are no other values
 // which satisfy our previous result that are not the result itself. Our
 // subiterators might, however, so just pass the call recursively.
+//
+// Paths are enumerated like an odometer: subiterators are advanced first, and once
+// one of them moves to the next path, all the previous ones are rewound to their
+// first path. The primary iterator is advanced only when all subiterators are
+// exhausted. This way, every combination of subiterator paths is returned exactly once.
 func (it *And) NextPath(ctx context.Context) bool {
-	if it.primaryIt.NextPath(ctx) {
-		return true
-	}
-	it.err = it.primaryIt.Err()
-	if it.err != nil {
-		return false
-	}
-	for _, sub := range it.internalIterators {
+	for i, sub := range it.internalIterators {
 		if sub.NextPath(ctx) {
-			return true
+			return it.rewindPaths(ctx, it.internalIterators[:i]) && it.checkTags()
 		}
-
-		it.err = sub.Err()
-		if it.err != nil {
+		if it.setErr(sub.Err()) {
 			return false
 		}
 	}
+	if it.primaryIt.NextPath(ctx) {
+		return it.rewindPaths(ctx, it.internalIterators) && it.checkTags()
+	}
+	it.setErr(it.primaryIt.Err())
 	return false
 }
 
+// rewindPaths moves subiterators back to the first path of the current result
+// by checking the (already verified) result again.
+func (it *And) rewindPaths(ctx context.Context, subs []graph.Iterator) bool {
+	for _, sub := range subs {
+		if !sub.Contains(ctx, it.result) {
+			it.setErr(sub.Err())
+			return false
+		}
+	}
+	return true
+}
+
 // Perform and-specific cleanup, of which there currently is none.
 func (it *And) cleanUp() {}
 
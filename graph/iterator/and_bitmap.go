@@ -0,0 +1,313 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// Bitmap is a set of integer ids stored as a dense bit set. It is efficient for
+// intersecting large sets of ids from a dense id space (see Bitmapper).
+type Bitmap struct {
+	words []uint64
+}
+
+// Add adds an id to the set.
+func (b *Bitmap) Add(id uint64) {
+	i := int(id / 64)
+	if i >= len(b.words) {
+		words := make([]uint64, i+1, 2*(i+1))
+		copy(words, b.words)
+		b.words = words
+	}
+	b.words[i] |= 1 << (id % 64)
+}
+
+// Contains checks if the id is in the set.
+func (b *Bitmap) Contains(id uint64) bool {
+	i := int(id / 64)
+	return i < len(b.words) && b.words[i]&(1<<(id%64)) != 0
+}
+
+// Len returns the number of ids in the set.
+func (b *Bitmap) Len() int {
+	n := 0
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// And removes all ids that are not in the other set.
+func (b *Bitmap) And(o *Bitmap) {
+	if len(o.words) < len(b.words) {
+		b.words = b.words[:len(o.words)]
+	}
+	for i := range b.words {
+		b.words[i] &= o.words[i]
+	}
+}
+
+// Next returns the smallest id in the set that is greater than or equal to id.
+func (b *Bitmap) Next(id uint64) (uint64, bool) {
+	i := int(id / 64)
+	if i >= len(b.words) {
+		return 0, false
+	}
+	// skip the bits of the first word that are less than id
+	if w := b.words[i] >> (id % 64); w != 0 {
+		return id + uint64(bits.TrailingZeros64(w)), true
+	}
+	for i++; i < len(b.words); i++ {
+		if w := b.words[i]; w != 0 {
+			return uint64(i)*64 + uint64(bits.TrailingZeros64(w)), true
+		}
+	}
+	return 0, false
+}
+
+// Bitmapper is an optional interface for sorted backend iterators which keys are
+// dense integer ids of results, and that can collect ids of all their results into
+// a bitmap without iterating them one by one. Only iterators with the same sort
+// order can be intersected by AndBitmap.
+//
+// Bitmapper iterators must not have sub-iterators, so the only tags they set
+// are tags of their own results.
+type Bitmapper interface {
+	graph.Seekable
+	// AddIDs adds ids of all results to the bitmap.
+	AddIDs(ctx context.Context, b *Bitmap) error
+	// ValueOfID returns the result with a given id.
+	ValueOfID(id uint64) graph.Value
+}
+
+// canBitmap checks if all iterators implement Bitmapper.
+func canBitmap(its []graph.Iterator) bool {
+	for _, sub := range its {
+		if _, ok := sub.(Bitmapper); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	// bitmapMinSize is the minimal size of sub-iterators for which AndBitmap is used.
+	// Smaller sets are intersected faster without allocating bitmaps.
+	bitmapMinSize = 256
+	// bitmapMaxSkew is the maximal ratio of sizes of the largest and the smallest
+	// sub-iterators for which AndBitmap is used. Otherwise, it's cheaper to check
+	// results of the smallest one against the others.
+	bitmapMaxSkew = 8
+)
+
+// useBitmaps checks if iterators can be intersected by AndBitmap, and if it's
+// likely to be faster than other methods.
+func useBitmaps(its []graph.Iterator, cache statsCache) bool {
+	if len(its) < 2 || !canBitmap(its) || sortOrderOf(its) == "" {
+		return false
+	}
+	var min, max int64 = -1, 0
+	for _, sub := range its {
+		n := cache.stats(sub).Size
+		if min < 0 || n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return min >= bitmapMinSize && max <= min*bitmapMaxSkew
+}
+
+var _ graph.Iterator = &AndBitmap{}
+
+// AndBitmap is an intersection of iterators that share a dense id space.
+//
+// On the first call to Next, it collects ids of all results of each sub-iterator
+// into a bitmap, intersects the bitmaps and then iterates the remaining ids.
+// It is much faster than And when sub-iterators are large and have similar sizes.
+type AndBitmap struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIts []Bitmapper
+	ids    *Bitmap
+	next   uint64
+	result graph.Value
+	err    error
+}
+
+// NewAndBitmap creates an intersection of iterators. All iterators must have
+// the same sort order.
+func NewAndBitmap(its ...Bitmapper) *AndBitmap {
+	return &AndBitmap{
+		uid:    NextUID(),
+		subIts: its,
+	}
+}
+
+func (it *AndBitmap) UID() uint64 {
+	return it.uid
+}
+
+func (it *AndBitmap) Reset() {
+	it.next = 0
+	it.result = nil
+}
+
+func (it *AndBitmap) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *AndBitmap) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.result)
+	for _, sub := range it.subIts {
+		sub.Tagger().TagResult(dst, it.result)
+	}
+}
+
+func (it *AndBitmap) Clone() graph.Iterator {
+	its := make([]Bitmapper, 0, len(it.subIts))
+	for _, sub := range it.subIts {
+		its = append(its, sub.Clone().(Bitmapper))
+	}
+	out := NewAndBitmap(its...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *AndBitmap) SubIterators() []graph.Iterator {
+	out := make([]graph.Iterator, 0, len(it.subIts))
+	for _, sub := range it.subIts {
+		out = append(out, sub)
+	}
+	return out
+}
+
+// run collects and intersects ids of all sub-iterators.
+func (it *AndBitmap) run(ctx context.Context) bool {
+	it.ids = &Bitmap{}
+	for i, sub := range it.subIts {
+		b := it.ids
+		if i != 0 {
+			b = &Bitmap{}
+		}
+		if err := sub.AddIDs(ctx, b); err != nil {
+			it.err = err
+			return false
+		}
+		if i != 0 {
+			it.ids.And(b)
+		}
+		if len(it.ids.words) == 0 {
+			break
+		}
+	}
+	return true
+}
+
+func (it *AndBitmap) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.result = nil
+	if it.err != nil || len(it.subIts) == 0 {
+		return graph.NextLogOut(it, false)
+	}
+	if it.ids == nil && !it.run(ctx) {
+		return graph.NextLogOut(it, false)
+	}
+	id, ok := it.ids.Next(it.next)
+	if !ok {
+		return graph.NextLogOut(it, false)
+	}
+	it.next = id + 1
+	it.result = it.subIts[0].ValueOfID(id)
+	return graph.NextLogOut(it, true)
+}
+
+func (it *AndBitmap) NextPath(ctx context.Context) bool {
+	return false
+}
+
+// Contains checks the value against all sub-iterators.
+func (it *AndBitmap) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	for _, sub := range it.subIts {
+		if !sub.Contains(ctx, val) {
+			it.err = sub.Err()
+			return graph.ContainsLogOut(it, val, false)
+		}
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *AndBitmap) Err() error {
+	return it.err
+}
+
+func (it *AndBitmap) Result() graph.Value {
+	return it.result
+}
+
+func (it *AndBitmap) Close() error {
+	it.ids = nil
+	var err error
+	for _, sub := range it.subIts {
+		if err2 := sub.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (it *AndBitmap) Type() graph.Type { return graph.AndBitmap }
+
+func (it *AndBitmap) String() string {
+	return fmt.Sprintf("AndBitmap(%d)", len(it.subIts))
+}
+
+func (it *AndBitmap) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+// Size is the size of the intersection, if it was already computed, or the size
+// of the smallest sub-iterator.
+func (it *AndBitmap) Size() (int64, bool) {
+	if it.ids != nil {
+		return int64(it.ids.Len()), true
+	}
+	if len(it.subIts) == 0 {
+		return 0, true
+	}
+	var size int64 = -1
+	for _, sub := range it.subIts {
+		n, exact := sub.Size()
+		if exact && n == 0 {
+			return 0, true
+		}
+		if size < 0 || n < size {
+			size = n
+		}
+	}
+	return size, len(it.subIts) == 1
+}
+
+// Stats accounts for collecting ids of all sub-iterators before the first result
+// can be returned. Setting a bit is assumed to be as cheap as a Next.
+func (it *AndBitmap) Stats() graph.IteratorStats {
+	var st graph.IteratorStats
+	var total int64
+	for _, sub := range it.subIts {
+		s := sub.Stats()
+		total += s.Size
+		st.ContainsCost += s.ContainsCost
+	}
+	st.Size, st.ExactSize = it.Size()
+	st.NextCost = 1
+	if it.ids == nil && st.Size > 0 {
+		st.NextCost += total / st.Size
+	}
+	return st
+}
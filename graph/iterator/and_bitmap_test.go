@@ -0,0 +1,144 @@
+package iterator_test
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+// A testing iterator that returns sorted values and can collect them into a bitmap.
+type bitmapIterator struct {
+	*sortedIterator
+}
+
+func newBitmapIterator(vals ...int64) bitmapIterator {
+	return bitmapIterator{newSortedIterator(vals...)}
+}
+
+func (it bitmapIterator) Clone() graph.Iterator {
+	return bitmapIterator{it.sortedIterator.Clone().(*sortedIterator)}
+}
+
+func (it bitmapIterator) Contains(ctx context.Context, v graph.Value) bool {
+	x := int64(v.(Int64Node))
+	i := sort.Search(len(it.vals), func(i int) bool { return it.vals[i] >= x })
+	if i < len(it.vals) && it.vals[i] == x {
+		it.i = i
+		return true
+	}
+	return false
+}
+
+func (it bitmapIterator) AddIDs(ctx context.Context, b *Bitmap) error {
+	for _, v := range it.vals {
+		b.Add(uint64(v))
+	}
+	return nil
+}
+
+func (it bitmapIterator) ValueOfID(id uint64) graph.Value { return Int64Node(id) }
+
+func TestBitmap(t *testing.T) {
+	var a, b Bitmap
+	for _, v := range []uint64{1, 5, 63, 64, 200, 1000} {
+		a.Add(v)
+	}
+	for _, v := range []uint64{5, 64, 65, 1000, 5000} {
+		b.Add(v)
+	}
+	if a.Len() != 6 || !a.Contains(63) || a.Contains(62) || a.Contains(5000) {
+		t.Fatalf("unexpected bitmap: %d", a.Len())
+	}
+	a.And(&b)
+	var got []uint64
+	for id, ok := a.Next(0); ok; id, ok = a.Next(id + 1) {
+		got = append(got, id)
+	}
+	if exp := []uint64{5, 64, 1000}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected intersection: %v vs %v", got, exp)
+	}
+	if id, ok := a.Next(65); !ok || id != 1000 {
+		t.Errorf("unexpected next id: %v", id)
+	}
+}
+
+// denseLists returns n lists of ids from [0, max) that contain each id with probability p.
+func denseLists(rnd *rand.Rand, n int, max int64, p float64) [][]int64 {
+	out := make([][]int64, n)
+	for i := range out {
+		for v := int64(0); v < max; v++ {
+			if rnd.Float64() < p {
+				out[i] = append(out[i], v)
+			}
+		}
+	}
+	return out
+}
+
+func TestAndBitmap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		lists := denseLists(rnd, 3, 2000, 0.5)
+		var naive, subs []graph.Iterator
+		for _, l := range lists {
+			naive = append(naive, graphmock.NewIterator(toValues(l)))
+			subs = append(subs, newBitmapIterator(l...))
+		}
+		expect := collectInt64(t, NewAnd(nil, naive...))
+
+		and := NewAnd(nil, subs...)
+		and.Tagger().Add("id")
+		it, _ := and.Optimize()
+		if it.Type() != graph.AndBitmap {
+			t.Fatalf("expected dense iterators to be intersected by bitmaps, got %v", it)
+		}
+		if got := collectInt64(t, it); !reflect.DeepEqual(got, expect) {
+			t.Fatalf("unexpected results: %v vs %v", got, expect)
+		}
+		if n, exact := it.Size(); !exact || n != int64(len(expect)) {
+			t.Errorf("unexpected size: %d (%v)", n, exact)
+		}
+		it.Reset()
+		if !it.Next(context.TODO()) {
+			t.Fatal("expected a result after reset")
+		}
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		if tags["id"] != Int64Node(expect[0]) {
+			t.Errorf("unexpected tags: %v", tags)
+		}
+	}
+
+	// skewed iterators are intersected by seeking
+	x, y := skewedLists(10000)
+	it, _ := NewAnd(nil, newBitmapIterator(x[:300]...), newBitmapIterator(y...)).Optimize()
+	if it.Type() != graph.ZigZag {
+		t.Errorf("expected skewed iterators to be intersected by seeking, got %v", it)
+	}
+}
+
+func BenchmarkAndBitmap(b *testing.B) {
+	lists := denseLists(rand.New(rand.NewSource(1)), 2, 20000, 0.5)
+	x, y := newBitmapIterator(lists[0]...), newBitmapIterator(lists[1]...)
+	bench := func(newIt func() graph.Iterator) func(b *testing.B) {
+		return func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				x.Reset()
+				y.Reset()
+				it := newIt()
+				for it.Next(context.TODO()) {
+				}
+			}
+		}
+	}
+	// not optimized, checks results of one iterator against the other
+	b.Run("and", bench(func() graph.Iterator { return NewAnd(nil, x, y) }))
+	b.Run("zigzag", bench(func() graph.Iterator { return NewZigZag(x, y) }))
+	b.Run("bitmap", bench(func() graph.Iterator { return NewAndBitmap(x, y) }))
+}
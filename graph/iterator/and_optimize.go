@@ -50,7 +50,10 @@ func (it *And) Optimize() (graph.Iterator, bool) {
 	// found them. it_list is the newly optimized versions of these, and changed
 	// is another list, of only the ones that have returned replacements and
 	// changed.
-	its := optimizeSubIterators(old)
+	//
+	// Lazy sub-iterators go last, so they are never built if one of the others
+	// is empty.
+	its := optimizeSubIterators(lazyLast(old), true)
 
 	// Close the replaced iterators (they ought to close themselves, but Close()
 	// is idempotent, so this just protects against any machinations).
@@ -67,11 +70,41 @@ func (it *And) Optimize() (graph.Iterator, bool) {
 		return out, true
 	}
 
+	// Estimating sub-iterators may be expensive for some backends, so each of them
+	// is asked for stats only once during this call. See statsCache.
+	stats := make(statsCache)
+
+	// If all subiterators can collect ids of their results into bitmaps, and have
+	// similar sizes, intersecting the bitmaps is faster than any of the methods below.
+	if it.tagPolicy == TagKeepLast && useBitmaps(its, stats) {
+		bitmaps := make([]Bitmapper, 0, len(its))
+		for _, sub := range its {
+			bitmaps = append(bitmaps, sub.(Bitmapper))
+		}
+		out := NewAndBitmap(bitmaps...)
+		out.tags.CopyFrom(it)
+		it.cleanUp()
+		return out, true
+	}
+
+	// If all subiterators are sorted by the same key, we can intersect them by
+	// seeking forward, instead of checking every value of one of them.
+	if it.tagPolicy == TagKeepLast && sortOrderOf(its) != "" {
+		sorted := make([]graph.Seekable, 0, len(its))
+		for _, sub := range its {
+			sorted = append(sorted, sub.(graph.Seekable))
+		}
+		out := NewZigZag(sorted...)
+		out.tags.CopyFrom(it)
+		it.cleanUp()
+		return out, true
+	}
+
 	// And now, without changing any of the iterators, we reorder them. it_list is
 	// now a permutation of itself, but the contents are unchanged.
-	its = it.optimizeOrder(its)
+	its = it.optimizeOrder(its, stats)
 
-	its = materializeIts(its)
+	its = materializeIts(its, stats)
 
 	// Okay! At this point we have an optimized order.
 
@@ -86,8 +119,9 @@ func (it *And) Optimize() (graph.Iterator, bool) {
 
 	// Move the tags hanging on us (like any good replacement).
 	newAnd.tags.CopyFrom(it)
+	newAnd.tagPolicy = it.tagPolicy
 
-	newAnd.optimizeContains()
+	newAnd.optimizeContains(stats)
 	if clog.V(3) {
 		clog.Infof("%v become %v", it.UID(), newAnd.UID())
 	}
@@ -109,6 +143,11 @@ func (it *And) Optimize() (graph.Iterator, bool) {
 			}
 			return newReplacement, true
 		}
+		// The quad store may also execute the whole subtree natively.
+		if out := pushdown(it.qs, newAnd); out != nil {
+			newAnd.Close()
+			return out, true
+		}
 	}
 
 	return newAnd, true
@@ -141,6 +180,10 @@ func (*And) optimizeReplacement(its []graph.Iterator) graph.Iterator {
 	if hasAnyNullIterators(its) {
 		return NewNull()
 	}
+	// The same is true if values must pass comparisons with contradictory bounds.
+	if hasDisjointComparisons(andComparisons(its)) {
+		return NewNull()
+	}
 
 	// If we have one useful iterator, use that.
 	it := hasOneUsefulIterator(its)
@@ -150,9 +193,28 @@ func (*And) optimizeReplacement(its []graph.Iterator) graph.Iterator {
 	return nil
 }
 
+// statsCache holds stats of sub-iterators for the duration of a single Optimize call,
+// keyed by the iterator UID. Picking an order compares each pair of sub-iterators,
+// and the cache makes sure each of them is estimated only once.
+type statsCache map[uint64]graph.IteratorStats
+
+// stats returns cached stats of the iterator, or asks the iterator if there are none.
+// A nil cache always asks the iterator.
+func (c statsCache) stats(it graph.Iterator) graph.IteratorStats {
+	if c == nil {
+		return it.Stats()
+	}
+	st, ok := c[it.UID()]
+	if !ok {
+		st = it.Stats()
+		c[it.UID()] = st
+	}
+	return st
+}
+
 // optimizeOrder(l) takes a list and returns a list, containing the same contents
 // but with a new ordering, however it wishes.
-func (it *And) optimizeOrder(its []graph.Iterator) []graph.Iterator {
+func (it *And) optimizeOrder(its []graph.Iterator, cache statsCache) []graph.Iterator {
 	var (
 		// bad contains iterators that can't be (efficiently) nexted, such as
 		// graph.Optional or graph.Not. Separate them out and tack them on at the end.
@@ -170,7 +232,7 @@ func (it *And) optimizeOrder(its []graph.Iterator) []graph.Iterator {
 			bad = append(bad, root)
 			continue
 		}
-		rootStats := root.Stats()
+		rootStats := cache.stats(root)
 		cost := rootStats.NextCost
 		for _, f := range its {
 			if !graph.CanNext(f) {
@@ -179,7 +241,7 @@ func (it *And) optimizeOrder(its []graph.Iterator) []graph.Iterator {
 			if f == root {
 				continue
 			}
-			stats := f.Stats()
+			stats := cache.stats(f)
 			cost += stats.ContainsCost * (1 + (rootStats.Size / (stats.Size + 1)))
 		}
 		cost *= rootStats.Size
@@ -219,21 +281,31 @@ func (it *And) optimizeOrder(its []graph.Iterator) []graph.Iterator {
 	return append(out, bad...)
 }
 
-type byCost []graph.Iterator
+type byCost struct {
+	its   []graph.Iterator
+	cache statsCache
+}
 
-func (c byCost) Len() int           { return len(c) }
-func (c byCost) Less(i, j int) bool { return c[i].Stats().ContainsCost < c[j].Stats().ContainsCost }
-func (c byCost) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byCost) Len() int { return len(c.its) }
+func (c byCost) Less(i, j int) bool {
+	return c.cache.stats(c.its[i]).ContainsCost < c.cache.stats(c.its[j]).ContainsCost
+}
+func (c byCost) Swap(i, j int) { c.its[i], c.its[j] = c.its[j], c.its[i] }
 
 // optimizeContains() creates an alternate check list, containing the same contents
 // but with a new ordering, however it wishes.
-func (it *And) optimizeContains() {
+// Stats are taken from the cache, if it's not nil.
+func (it *And) optimizeContains(cache statsCache) {
 	// GetSubIterators allocates, so this is currently safe.
 	// TODO(kortschak) Reuse it.checkList if possible.
 	// This involves providing GetSubIterators with a slice to fill.
 	// Generally this is a worthwhile thing to do in other places as well.
 	it.checkList = it.SubIterators()
-	sort.Sort(byCost(it.checkList))
+	if cache == nil {
+		// sorting compares stats of the same iterator multiple times
+		cache = make(statsCache)
+	}
+	sort.Sort(byCost{its: it.checkList, cache: cache})
 }
 
 // If we're replacing ourselves by a single iterator, we need to grab the
@@ -272,9 +344,15 @@ func moveTagsTo(dst graph.Iterator, src *And) {
 // of them. It returns two lists -- the first contains the same list as l, where
 // any replacements are made by Optimize() and the second contains the originals
 // which were replaced.
-func optimizeSubIterators(its []graph.Iterator) []graph.Iterator {
+//
+// If stopOnNull is set, it stops before building a lazy iterator, if any of the
+// previous iterators is Null.
+func optimizeSubIterators(its []graph.Iterator, stopOnNull bool) []graph.Iterator {
 	var optIts []graph.Iterator
 	for _, it := range its {
+		if stopOnNull && isLazy(it) && hasAnyNullIterators(optIts) {
+			break
+		}
 		o, changed := it.Optimize()
 		if changed {
 			optIts = append(optIts, o)
@@ -295,6 +373,15 @@ func hasAnyNullIterators(its []graph.Iterator) bool {
 	return false
 }
 
+// andComparisons returns all comparisons that are applied to results of the And.
+func andComparisons(its []graph.Iterator) []*Comparison {
+	var out []*Comparison
+	for _, it := range its {
+		out = append(out, comparisonChain(it)...)
+	}
+	return out
+}
+
 // There are two "not-useful" iterators -- namely graph.Null which returns
 // nothing, and graph.All which returns everything. Particularly, we want
 // to see if we're intersecting with a bunch of graph.All iterators, and,
@@ -330,13 +417,18 @@ func hasOneUsefulIterator(its []graph.Iterator) graph.Iterator {
 	return nil
 }
 
-func materializeIts(its []graph.Iterator) []graph.Iterator {
+func materializeIts(its []graph.Iterator, cache statsCache) []graph.Iterator {
 	var out []graph.Iterator
 
-	allStats := getStatsForSlice(its)
+	allStats := getStatsForSlice(its, cache)
 	out = append(out, its[0])
 	for _, it := range its[1:] {
-		stats := it.Stats()
+		if !graph.CanNext(it) {
+			// cannot be materialized
+			out = append(out, it)
+			continue
+		}
+		stats := cache.stats(it)
 		if stats.Size*stats.NextCost < (stats.ContainsCost * (1 + (stats.Size / (allStats.Size + 1)))) {
 			if graph.Height(it, graph.Materialize) > 10 {
 				out = append(out, NewMaterialize(it))
@@ -348,22 +440,40 @@ func materializeIts(its []graph.Iterator) []graph.Iterator {
 	return out
 }
 
-func getStatsForSlice(its []graph.Iterator) graph.IteratorStats {
+// restricts reports if an iterator can remove results of And. Optional iterator
+// matches everything, thus its size is the size of the And itself.
+func restricts(it graph.Iterator) bool {
+	return it.Type() != graph.Optional
+}
+
+func getStatsForSlice(its []graph.Iterator, cache statsCache) graph.IteratorStats {
 	primary := its[0]
-	primaryStats := primary.Stats()
+	primaryStats := cache.stats(primary)
 	ContainsCost := primaryStats.ContainsCost
 	NextCost := primaryStats.NextCost
-	Size := primaryStats.Size
-	ExactSize := primaryStats.ExactSize
-	for _, sub := range its[1:] {
-		stats := sub.Stats()
-		NextCost += stats.ContainsCost * (1 + (primaryStats.Size / (stats.Size + 1)))
-		ContainsCost += stats.ContainsCost
-		if Size > stats.Size {
+	Size := int64(-1)
+	ExactSize := false
+	for _, sub := range its {
+		if !restricts(sub) {
+			continue
+		}
+		if stats := cache.stats(sub); Size < 0 || Size > stats.Size {
 			Size = stats.Size
 			ExactSize = stats.ExactSize
 		}
 	}
+	if Size < 0 {
+		Size, ExactSize = primaryStats.Size, primaryStats.ExactSize
+	}
+	for _, sub := range its[1:] {
+		stats := cache.stats(sub)
+		if !restricts(sub) {
+			// checked once for each result
+			stats.Size = primaryStats.Size
+		}
+		NextCost += stats.ContainsCost * (1 + (primaryStats.Size / (stats.Size + 1)))
+		ContainsCost += stats.ContainsCost
+	}
 	return graph.IteratorStats{
 		ContainsCost: ContainsCost,
 		NextCost:     NextCost,
@@ -377,7 +487,7 @@ func getStatsForSlice(its []graph.Iterator) graph.IteratorStats {
 // in the future return different statistics based on how it is optimized.
 // For now, however, it's pretty static.
 func (it *And) Stats() graph.IteratorStats {
-	stats := getStatsForSlice(it.SubIterators())
+	stats := getStatsForSlice(it.SubIterators(), nil)
 	stats.Next = it.runstats.Next
 	stats.Contains = it.runstats.Contains
 	return stats
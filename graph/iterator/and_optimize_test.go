@@ -18,6 +18,7 @@ package iterator_test
 // nonetheless cover a lot of basic cases.
 
 import (
+	"context"
 	"reflect"
 	"sort"
 	"testing"
@@ -25,6 +26,7 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphmock"
 	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
 )
 
 func TestIteratorPromotion(t *testing.T) {
@@ -164,3 +166,143 @@ func TestAndStatistics(t *testing.T) {
 		t.Error("And didn't optimize. Next cost old ", stats1.NextCost, "and new ", stats2.NextCost)
 	}
 }
+
+func TestOptimizeEmpty(t *testing.T) {
+	qs := &graphmock.Oldstore{
+		Data: []string{},
+		Iter: NewFixed(),
+	}
+	cmp := func(it graph.Iterator, op Operator, v int64) graph.Iterator {
+		return NewComparison(it, op, quad.Int(v), qs)
+	}
+	var cases = []struct {
+		name  string
+		it    func() graph.Iterator
+		empty bool
+	}{
+		{
+			name:  "and with null",
+			it:    func() graph.Iterator { return NewAnd(qs, NewInt64(1, 3, true), NewFixed(Int64Node(2)), NewNull()) },
+			empty: true,
+		},
+		{
+			name:  "empty fixed",
+			it:    func() graph.Iterator { return NewAnd(qs, NewInt64(1, 3, true), NewFixed()) },
+			empty: true,
+		},
+		{
+			name:  "contradictory comparisons",
+			it:    func() graph.Iterator { return cmp(cmp(NewInt64(1, 10, true), CompareGT, 5), CompareLT, 3) },
+			empty: true,
+		},
+		{
+			name:  "contradictory comparisons strict",
+			it:    func() graph.Iterator { return cmp(cmp(NewInt64(1, 10, true), CompareGTE, 5), CompareLT, 5) },
+			empty: true,
+		},
+		{
+			name: "contradictory comparisons in and",
+			it: func() graph.Iterator {
+				return NewAnd(qs, cmp(NewInt64(1, 10, true), CompareLTE, 2), cmp(NewInt64(1, 10, true), CompareGT, 2))
+			},
+			empty: true,
+		},
+		{
+			name: "contradictory numeric comparisons",
+			it: func() graph.Iterator {
+				return NewComparison(cmp(NewInt64(1, 10, true), CompareGT, 5), CompareLT, quad.Float(3), qs)
+			},
+			empty: true,
+		},
+		{
+			name:  "or of empty",
+			it:    func() graph.Iterator { return NewAnd(qs, NewInt64(1, 3, true), NewOr(NewNull(), NewFixed())) },
+			empty: true,
+		},
+		{
+			name: "empty links",
+			it: func() graph.Iterator {
+				return NewLimit(NewUnique(NewHasA(qs, NewLinksTo(qs, NewFixed(), quad.Object), quad.Subject)), 10)
+			},
+			empty: true,
+		},
+		{
+			name: "comparisons range",
+			it:   func() graph.Iterator { return cmp(cmp(NewInt64(1, 10, true), CompareGTE, 5), CompareLTE, 5) },
+		},
+		{
+			name: "comparisons of different types",
+			it: func() graph.Iterator {
+				return NewComparison(cmp(NewInt64(1, 10, true), CompareGT, 5), CompareLT, quad.String("3"), qs)
+			},
+		},
+		{
+			name: "or with non-empty branch",
+			it:   func() graph.Iterator { return NewOr(NewNull(), NewFixed(Int64Node(2))) },
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			it, _ := c.it().Optimize()
+			if empty := it.Type() == graph.Null; empty != c.empty {
+				t.Errorf("unexpected optimization result: %s", it)
+			}
+		})
+	}
+}
+
+func TestAndOptimizeQueriesStatsOnce(t *testing.T) {
+	qs := &graphmock.Oldstore{
+		Data: []string{},
+		Iter: NewFixed(),
+	}
+	newTest := func(size int64) *graphmock.Iterator {
+		var vals []graph.Value
+		for i := int64(0); i < size; i++ {
+			vals = append(vals, Int64Node(i))
+		}
+		return graphmock.NewIterator(vals, graphmock.WithStats(graph.IteratorStats{
+			ContainsCost: 1 + size%3, NextCost: 1, Size: size, ExactSize: true,
+		}))
+	}
+	subs := []*graphmock.Iterator{newTest(7), newTest(3), newTest(5), newTest(10), newTest(4)}
+	it := NewAnd(qs, subs[0], subs[1], subs[2], NewOr(subs[3], subs[4]))
+
+	for i := 0; i < 2; i++ {
+		newIt, changed := it.Optimize()
+		if !changed || newIt.Type() != graph.And {
+			t.Fatalf("unexpected optimization result: %v", newIt)
+		}
+		for j, sub := range subs {
+			if n := sub.Calls.Size + sub.Calls.Stats; n > 1 {
+				t.Errorf("round %d: sub-iterator %d was estimated %d times", i, j, n)
+			}
+			*sub.Calls = graphmock.IteratorCalls{}
+		}
+		it = newIt.(*And)
+	}
+}
+
+func TestAndUsesContainsOnLargerIterator(t *testing.T) {
+	ctx := context.TODO()
+	small := graphmock.NewIterator([]graph.Value{Int64Node(2)})
+	large := graphmock.NewIterator([]graph.Value{Int64Node(1), Int64Node(2), Int64Node(3)},
+		graphmock.WithStats(graph.IteratorStats{Size: 1000, NextCost: 1, ContainsCost: 1}),
+	)
+	it, _ := NewAnd(nil, large, small).Optimize()
+	defer it.Close()
+
+	n := 0
+	for it.Next(ctx) {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+	if large.Calls.Next != 0 || large.Calls.Contains != 1 {
+		t.Errorf("expected larger iterator to be checked with Contains, got: %+v", *large.Calls)
+	}
+	if small.Calls.Next == 0 {
+		t.Errorf("expected smaller iterator to be iterated, got: %+v", *small.Calls)
+	}
+}
@@ -17,11 +17,13 @@ package iterator_test
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphmock"
 	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
 )
 
 // Make sure that tags work on the And.
@@ -167,7 +169,7 @@ func TestAndIteratorErr(t *testing.T) {
 		Iter: NewFixed(),
 	}
 	wantErr := errors.New("unique")
-	allErr := newTestIterator(false, wantErr)
+	allErr := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	and := NewAnd(qs,
 		allErr,
@@ -181,3 +183,105 @@ func TestAndIteratorErr(t *testing.T) {
 		t.Errorf("And iterator did not pass through underlying Err")
 	}
 }
+
+func TestAndIteratorSizeEarlyExit(t *testing.T) {
+	qs := &graphmock.Oldstore{
+		Data: []string{},
+		Iter: NewFixed(),
+	}
+	sib := graphmock.NewIterator([]graph.Value{Int64Node(1), Int64Node(2)})
+	and := NewAnd(qs, NewFixed(), sib)
+
+	if size, exact := and.Size(); size != 0 || !exact {
+		t.Errorf("Unexpected size: got:%d (exact: %v) expected:0 (exact)", size, exact)
+	}
+	if sib.Calls.Size != 0 {
+		t.Errorf("Sibling of an empty iterator was asked for size %d times", sib.Calls.Size)
+	}
+
+	sib = graphmock.NewIterator([]graph.Value{Int64Node(1), Int64Node(2)})
+	and = NewAnd(qs, NewFixed(Int64Node(1)), NewFixed(), sib)
+	if size, exact := and.Size(); size != 0 || !exact {
+		t.Errorf("Unexpected size: got:%d (exact: %v) expected:0 (exact)", size, exact)
+	}
+	if sib.Calls.Size != 0 {
+		t.Errorf("Sibling of an empty iterator was asked for size %d times", sib.Calls.Size)
+	}
+}
+
+func TestAndTagPolicy(t *testing.T) {
+	ctx := context.TODO()
+	var tests = []struct {
+		policy TagPolicy
+		expect graph.Value
+		err    bool
+	}{
+		{policy: TagKeepLast, expect: Int64Node(20)},
+		{policy: TagKeepFirst, expect: Int64Node(10)},
+		{policy: TagErrorOnConflict, err: true},
+		{policy: TagCollectAll, expect: TagValues{Int64Node(10), Int64Node(20)}},
+	}
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			newAnd := func() graph.Iterator {
+				fix1 := NewFixed(Int64Node(1), Int64Node(2))
+				fix1.Tagger().AddFixed("x", Int64Node(10))
+				fix1.Tagger().Add("id")
+				fix2 := NewFixed(Int64Node(1), Int64Node(2))
+				fix2.Tagger().AddFixed("x", Int64Node(20))
+				fix2.Tagger().Add("id")
+
+				and := NewAnd(nil, fix1, fix2)
+				and.SetTagPolicy(test.policy)
+				it, _ := and.Optimize()
+				return it
+			}
+			expectConflict := func(it graph.Iterator) {
+				if e, ok := it.Err().(*ErrTagConflict); !ok || e.Tag != "x" {
+					t.Errorf("expected tag conflict, got: %v", it.Err())
+				}
+			}
+			it := newAnd()
+			if test.err {
+				// conflicting result must not be returned
+				if it.Next(ctx) {
+					t.Error("expected iteration to stop on conflict")
+				}
+				expectConflict(it)
+				it = newAnd()
+				if it.Contains(ctx, Int64Node(1)) {
+					t.Error("expected contains to fail on conflict")
+				}
+				expectConflict(it)
+				return
+			}
+			if !it.Next(ctx) {
+				t.Fatal("And did not next")
+			}
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			if !reflect.DeepEqual(tags["x"], test.expect) {
+				t.Errorf("unexpected tag value: %v vs %v", tags["x"], test.expect)
+			}
+			if tags["id"] != Int64Node(1) {
+				t.Errorf("same values should not conflict: %v", tags["id"])
+			}
+			if !it.Next(ctx) || it.Err() != nil {
+				t.Errorf("unexpected end of iteration: %v", it.Err())
+			}
+		})
+	}
+}
+
+func TestTagValuesKey(t *testing.T) {
+	// values that are formatted the same way must have different keys
+	a := TagValues{graph.PreFetched(quad.String("ab")), graph.PreFetched(quad.String("c"))}
+	b := TagValues{graph.PreFetched(quad.String("a")), graph.PreFetched(quad.String("bc"))}
+	if a.Key() == b.Key() {
+		t.Error("different values have the same key")
+	}
+	c := TagValues{graph.PreFetched(quad.String("ab")), graph.PreFetched(quad.String("c"))}
+	if a.Key() != c.Key() {
+		t.Error("same values have different keys")
+	}
+}
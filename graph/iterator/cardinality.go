@@ -0,0 +1,202 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &CardinalityViolation{}
+
+type cardinalityGroup struct {
+	val   graph.Value
+	count int64
+}
+
+// CardinalityViolation iterator groups results of the subiterator and returns values that
+// were seen more than a given number of times, optionally tagging them with the count.
+//
+// It is usually used on top of a HasA iterator that returns a subject for each quad with
+// a given predicate; in this case, it returns subjects that have too many values for
+// a predicate that is expected to be single-valued.
+type CardinalityViolation struct {
+	uid     uint64
+	tags    graph.Tagger
+	subIt   graph.Iterator
+	max     int64
+	tag     string
+	groups  []cardinalityGroup
+	index   map[interface{}]int
+	hasRun  bool
+	cur     int
+	result  *cardinalityGroup
+	err     error
+	runstat graph.IteratorStats
+}
+
+// NewCardinalityViolation creates a new iterator that returns values that appear in the
+// subiterator more than max times. If tag is not empty, the count of each value is tagged
+// with it.
+func NewCardinalityViolation(subIt graph.Iterator, max int64, tag string) *CardinalityViolation {
+	return &CardinalityViolation{
+		uid:   NextUID(),
+		subIt: subIt,
+		max:   max,
+		tag:   tag,
+		cur:   -1,
+	}
+}
+
+func (it *CardinalityViolation) UID() uint64 {
+	return it.uid
+}
+
+// Reset rewinds the iterator. Grouped values are kept, the subiterator is not re-run.
+func (it *CardinalityViolation) Reset() {
+	it.cur = -1
+	it.result = nil
+}
+
+func (it *CardinalityViolation) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *CardinalityViolation) TagResults(dst map[string]graph.Value) {
+	if it.result == nil {
+		return
+	}
+	it.tags.TagResult(dst, it.result.val)
+	if it.tag != "" {
+		dst[it.tag] = graph.PreFetched(quad.Int(it.result.count))
+	}
+}
+
+func (it *CardinalityViolation) Clone() graph.Iterator {
+	out := NewCardinalityViolation(it.subIt.Clone(), it.max, it.tag)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *CardinalityViolation) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// group reads all results from the subiterator and counts the number of times each value was seen.
+func (it *CardinalityViolation) group(ctx context.Context) {
+	it.hasRun = true
+	counts := make(map[interface{}]int)
+	var all []cardinalityGroup
+	for it.subIt.Next(ctx) {
+		v := it.subIt.Result()
+		k := graph.ToKey(v)
+		i, ok := counts[k]
+		if !ok {
+			i = len(all)
+			counts[k] = i
+			all = append(all, cardinalityGroup{val: v})
+		}
+		all[i].count++
+	}
+	if it.err = it.subIt.Err(); it.err != nil {
+		return
+	}
+	it.index = make(map[interface{}]int)
+	for _, g := range all {
+		if g.count > it.max {
+			it.index[graph.ToKey(g.val)] = len(it.groups)
+			it.groups = append(it.groups, g)
+		}
+	}
+}
+
+// Next returns the next value that violates the cardinality constraint.
+func (it *CardinalityViolation) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.runstat.Next++
+	if !it.hasRun {
+		it.group(ctx)
+	}
+	if it.err != nil || it.cur+1 >= len(it.groups) {
+		it.result = nil
+		return graph.NextLogOut(it, false)
+	}
+	it.cur++
+	it.result = &it.groups[it.cur]
+	return graph.NextLogOut(it, true)
+}
+
+func (it *CardinalityViolation) Err() error {
+	return it.err
+}
+
+func (it *CardinalityViolation) Result() graph.Value {
+	if it.result == nil {
+		return nil
+	}
+	return it.result.val
+}
+
+// Contains checks if the value violates the cardinality constraint.
+func (it *CardinalityViolation) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.runstat.Contains++
+	if !it.hasRun {
+		it.group(ctx)
+	}
+	i, ok := it.index[graph.ToKey(val)]
+	if !ok {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = &it.groups[i]
+	return graph.ContainsLogOut(it, val, true)
+}
+
+// NextPath always returns false, since each value is returned only once.
+func (it *CardinalityViolation) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *CardinalityViolation) Close() error {
+	it.groups, it.index = nil, nil
+	it.hasRun = false
+	return it.subIt.Close()
+}
+
+func (it *CardinalityViolation) Type() graph.Type { return graph.CardinalityViolation }
+
+func (it *CardinalityViolation) Optimize() (graph.Iterator, bool) {
+	sub, optimized := it.subIt.Optimize()
+	it.subIt = sub
+	if sub.Type() == graph.Null {
+		return sub, true
+	}
+	return it, optimized
+}
+
+func (it *CardinalityViolation) Stats() graph.IteratorStats {
+	sub := it.subIt.Stats()
+	st := graph.IteratorStats{
+		NextCost:     sub.NextCost,
+		ContainsCost: sub.NextCost * sub.Size,
+		Size:         sub.Size / uniquenessFactor,
+		Next:         it.runstat.Next,
+		Contains:     it.runstat.Contains,
+	}
+	if it.hasRun {
+		st.ContainsCost = 1
+		st.Size, st.ExactSize = int64(len(it.groups)), true
+	}
+	return st
+}
+
+func (it *CardinalityViolation) Size() (int64, bool) {
+	st := it.Stats()
+	return st.Size, st.ExactSize
+}
+
+func (it *CardinalityViolation) String() string {
+	return fmt.Sprintf("CardinalityViolation(%d)", it.max)
+}
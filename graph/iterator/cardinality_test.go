@@ -0,0 +1,62 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestCardinalityViolation(t *testing.T) {
+	ctx := context.TODO()
+	newIt := func() *CardinalityViolation {
+		sub := NewFixed(
+			Int64Node(1), Int64Node(2), Int64Node(2), Int64Node(3),
+			Int64Node(3), Int64Node(3), Int64Node(4),
+		)
+		return NewCardinalityViolation(sub, 1, "count")
+	}
+
+	it := newIt()
+	counts := make(map[int64]int64)
+	var got []int
+	for it.Next(ctx) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		v := int64(it.Result().(Int64Node))
+		got = append(got, int(v))
+		counts[v] = int64(tags["count"].(graph.PreFetchedValue).NameOf().(quad.Int))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(got)
+	if expect := []int{2, 3}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: got:%v expected:%v", got, expect)
+	}
+	if expect := map[int64]int64{2: 2, 3: 3}; !reflect.DeepEqual(counts, expect) {
+		t.Errorf("unexpected counts: got:%v expected:%v", counts, expect)
+	}
+	if n, exact := it.Size(); n != 2 || !exact {
+		t.Errorf("unexpected size: %d, %v", n, exact)
+	}
+
+	it.Reset()
+	if got := iterated(it); len(got) != 2 {
+		t.Errorf("unexpected results after reset: %v", got)
+	}
+
+	it = newIt()
+	for _, c := range []struct {
+		v      Int64Node
+		expect bool
+	}{{1, false}, {2, true}, {3, true}, {4, false}, {5, false}} {
+		if ok := it.Contains(ctx, c.v); ok != c.expect {
+			t.Errorf("unexpected contains result for %v: %v", c.v, ok)
+		}
+	}
+}
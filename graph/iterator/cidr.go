@@ -0,0 +1,176 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &CIDRMatch{}
+
+// CIDRMatch is a unary operator -- a filter across the values in the relevant
+// subiterator. It reduces the iterator set to values whose string representation
+// is an IP address within a given network. Values that are not IP addresses are
+// skipped.
+type CIDRMatch struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	ipnet  *net.IPNet
+	qs     graph.QuadStore
+	result graph.Value
+	err    error
+}
+
+func NewCIDRMatch(sub graph.Iterator, ipnet *net.IPNet, qs graph.QuadStore) *CIDRMatch {
+	return &CIDRMatch{
+		uid:   NextUID(),
+		subIt: sub,
+		ipnet: ipnet,
+		qs:    qs,
+	}
+}
+
+func (it *CIDRMatch) testCIDR(val graph.Value) bool {
+	var s string
+	switch v := it.qs.NameOf(val).(type) {
+	case quad.String:
+		s = string(v)
+	case quad.TypedString:
+		s = string(v.Value)
+	default:
+		return false
+	}
+	ip := net.ParseIP(s)
+	return ip != nil && it.ipnet.Contains(ip)
+}
+
+func (it *CIDRMatch) UID() uint64 {
+	return it.uid
+}
+
+func (it *CIDRMatch) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *CIDRMatch) Reset() {
+	it.subIt.Reset()
+	it.err = nil
+	it.result = nil
+}
+
+func (it *CIDRMatch) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *CIDRMatch) Clone() graph.Iterator {
+	out := NewCIDRMatch(it.subIt.Clone(), it.ipnet, it.qs)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *CIDRMatch) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	for it.subIt.Next(ctx) {
+		val := it.subIt.Result()
+		if it.testCIDR(val) {
+			it.result = val
+			return graph.NextLogOut(it, true)
+		}
+	}
+	it.err = it.subIt.Err()
+	return graph.NextLogOut(it, false)
+}
+
+func (it *CIDRMatch) Err() error {
+	return it.err
+}
+
+func (it *CIDRMatch) Result() graph.Value {
+	return it.result
+}
+
+func (it *CIDRMatch) NextPath(ctx context.Context) bool {
+	for {
+		hasNext := it.subIt.NextPath(ctx)
+		if !hasNext {
+			it.err = it.subIt.Err()
+			return false
+		}
+		if it.testCIDR(it.subIt.Result()) {
+			break
+		}
+	}
+	it.result = it.subIt.Result()
+	return true
+}
+
+func (it *CIDRMatch) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *CIDRMatch) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.testCIDR(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	ok := it.subIt.Contains(ctx, val)
+	if !ok {
+		it.err = it.subIt.Err()
+	} else {
+		it.result = val
+	}
+	return graph.ContainsLogOut(it, val, ok)
+}
+
+func (it *CIDRMatch) Type() graph.Type {
+	return graph.CIDRMatch
+}
+
+func (it *CIDRMatch) String() string {
+	return fmt.Sprintf("CIDRMatch(%v)", it.ipnet)
+}
+
+// There's nothing to optimize, locally, for a CIDRMatch iterator.
+// Replace the underlying iterator if need be.
+func (it *CIDRMatch) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// We're only as expensive as our subiterator.
+func (it *CIDRMatch) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *CIDRMatch) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *CIDRMatch) Size() (int64, bool) {
+	sz, _ := it.subIt.Size()
+	return sz / 2, false
+}
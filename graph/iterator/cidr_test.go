@@ -0,0 +1,49 @@
+package iterator_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestCIDRMatch(t *testing.T) {
+	qs := &graphmock.Oldstore{Parse: true, Data: []string{
+		"10.0.0.1", "10.0.1.7", "192.168.0.1", "10.0.0.255", "foo", "42", "::1", "10.0.0.3.4",
+	}}
+	_, ipnet, err := net.ParseCIDR("10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFixed()
+	for i := range qs.Data {
+		f.Add(Int64Node(i))
+	}
+	it := NewCIDRMatch(f, ipnet, qs)
+
+	var got []quad.Value
+	for it.Next(context.TODO()) {
+		got = append(got, qs.NameOf(it.Result()))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []quad.Value{quad.String("10.0.0.1"), quad.String("10.0.0.255")}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: got:%v expected:%v", got, expect)
+	}
+
+	for i, exp := range []bool{true, false, false, true, false, false, false, false} {
+		if ok := it.Contains(context.TODO(), Int64Node(i)); ok != exp {
+			t.Errorf("unexpected Contains result for %q: %v", qs.Data[i], ok)
+		}
+	}
+	if it.Type() != graph.CIDRMatch {
+		t.Errorf("unexpected iterator type: %v", it.Type())
+	}
+}
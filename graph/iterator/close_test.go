@@ -0,0 +1,240 @@
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// cursorStats counts backend cursors opened and released by cursor iterators.
+type cursorStats struct {
+	opened, released int
+	// redundant is the number of Close calls on backend cursors that were already released.
+	redundant int
+}
+
+// cursor is an instrumented backend iterator. Like a real database cursor, it's opened
+// lazily on the first use, and must be released by Close.
+type cursor struct {
+	*graphmock.Iterator
+	stats   *cursorStats
+	open    bool
+	backend bool // cursor was returned by the quad store
+	used    bool
+}
+
+func newCursor(stats *cursorStats, vals []graph.Value, opts ...graphmock.IteratorOption) *cursor {
+	return &cursor{Iterator: graphmock.NewIterator(vals, opts...), stats: stats}
+}
+
+func (it *cursor) acquire() {
+	if !it.open {
+		it.open, it.used = true, true
+		it.stats.opened++
+	}
+}
+
+func (it *cursor) Next(ctx context.Context) bool {
+	it.acquire()
+	return it.Iterator.Next(ctx)
+}
+
+func (it *cursor) Contains(ctx context.Context, v graph.Value) bool {
+	it.acquire()
+	return it.Iterator.Contains(ctx, v)
+}
+
+func (it *cursor) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *cursor) Close() error {
+	if it.open {
+		it.open = false
+		it.stats.released++
+	} else if it.backend && it.used {
+		it.stats.redundant++
+	}
+	return it.Iterator.Close()
+}
+
+// cursorStore returns instrumented cursors for quad iterators.
+type cursorStore struct {
+	graphmock.Store
+	stats *cursorStats
+	fail  error
+}
+
+func (qs *cursorStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	vals := qs.Store.QuadIterator(d, v).(*Fixed).Values()
+	var opts []graphmock.IteratorOption
+	if qs.fail != nil {
+		opts = append(opts, graphmock.WithErr(qs.fail))
+	}
+	c := newCursor(qs.stats, vals, opts...)
+	c.backend = true
+	return c
+}
+
+func (qs *cursorStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
+
+func TestCloseReleasesCursors(t *testing.T) {
+	node := func(s string) graph.Value { return graph.PreFetched(quad.IRI(s)) }
+	data := []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "carol", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+		quad.MakeIRI("carol", "follows", "dani", ""),
+	}
+	errFailed := errors.New("failed")
+
+	for _, c := range []struct {
+		name  string
+		limit int
+		fail  error
+	}{
+		{name: "complete", limit: -1},
+		{name: "limit", limit: 1},
+		{name: "error", limit: -1, fail: errFailed},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			stats := &cursorStats{}
+			qs := &cursorStore{Store: graphmock.Store{Data: data}, stats: stats, fail: c.fail}
+			var opts []graphmock.IteratorOption
+			if c.fail != nil {
+				opts = append(opts, graphmock.WithErr(c.fail))
+			}
+			start := newCursor(stats, []graph.Value{node("alice"), node("bob"), node("carol")}, opts...)
+			followed := NewHasA(qs, NewLinksTo(qs, start, quad.Subject), quad.Object)
+			known := NewOr(
+				newCursor(stats, []graph.Value{node("bob")}),
+				newCursor(stats, []graph.Value{node("carol"), node("dani")}),
+			)
+			opt := NewOptional(NewHasA(qs, NewLinksTo(qs, newCursor(stats, []graph.Value{node("bob")}), quad.Subject), quad.Object))
+			it := NewAnd(qs, followed, known, opt)
+
+			ch := graph.Iterate(context.TODO(), it).Limit(c.limit)
+			n, err := ch.Count()
+			if c.fail != nil && err != c.fail {
+				t.Errorf("expected an error, got: %v", err)
+			} else if c.fail == nil && err != nil {
+				t.Fatal(err)
+			}
+			if c.limit > 0 && n != int64(c.limit) {
+				t.Errorf("unexpected number of results: %d", n)
+			} else if n == 0 {
+				t.Errorf("expected some results")
+			}
+			if stats.opened == 0 {
+				t.Fatal("no cursors were opened")
+			} else if stats.opened != stats.released {
+				t.Errorf("cursors leaked: opened %d, released %d", stats.opened, stats.released)
+			}
+			// closing again must not release anything twice
+			released := stats.released
+			if err := it.Close(); err != nil {
+				t.Error(err)
+			}
+			if stats.released != released {
+				t.Errorf("cursors were released twice: %d vs %d", stats.released, released)
+			} else if stats.redundant != 0 {
+				t.Errorf("backend cursors were closed more than once: %d", stats.redundant)
+			}
+		})
+	}
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	ctx := context.TODO()
+	stats := &cursorStats{}
+	qs := &cursorStore{Store: graphmock.Store{Data: []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+	}}, stats: stats}
+	alice := graph.PreFetched(quad.IRI("alice"))
+	hasa := NewHasA(qs, NewLinksTo(qs, NewFixed(alice), quad.Subject), quad.Object)
+
+	for i := 0; i < 2; i++ {
+		if !hasa.Next(ctx) || !hasa.Contains(ctx, graph.PreFetched(quad.IRI("bob"))) {
+			t.Fatal("expected a result")
+		}
+		hasa.Close()
+		hasa.Close()
+		if stats.opened != stats.released {
+			t.Fatalf("cursors leaked: opened %d, released %d", stats.opened, stats.released)
+		} else if stats.redundant != 0 {
+			t.Fatalf("backend cursors were closed more than once: %d", stats.redundant)
+		}
+		hasa.Reset()
+	}
+}
+
+func TestCloseOnError(t *testing.T) {
+	ctx := context.TODO()
+	errFailed := errors.New("failed")
+	nodes := func(vals ...int64) []graph.Value {
+		var out []graph.Value
+		for _, v := range vals {
+			out = append(out, Int64Node(v))
+		}
+		return out
+	}
+	expectClosed := func(t *testing.T, it graph.Iterator, subs ...*graphmock.Iterator) {
+		if err := it.Err(); err != errFailed {
+			t.Errorf("unexpected error: %v", err)
+		}
+		for i, sub := range subs {
+			if sub.Calls.Close == 0 {
+				t.Errorf("subiterator %d was not closed", i)
+			}
+		}
+		if it.Next(ctx) {
+			t.Error("expected no results after an error")
+		}
+	}
+
+	t.Run("and", func(t *testing.T) {
+		primary := graphmock.NewIterator(nodes(1, 2, 3))
+		sibling := graphmock.NewIterator(nodes(1, 2, 3))
+		failing := graphmock.NewIterator(nodes(1), graphmock.WithErr(errFailed))
+		it := NewAnd(nil, primary, sibling, failing)
+		if !it.Next(ctx) {
+			t.Fatal("expected a result")
+		} else if it.Next(ctx) {
+			t.Fatal("expected an error")
+		}
+		expectClosed(t, it, primary, sibling, failing)
+	})
+	t.Run("or", func(t *testing.T) {
+		failing := graphmock.NewIterator(nodes(1), graphmock.WithErr(errFailed))
+		sibling := graphmock.NewIterator(nodes(2))
+		it := NewOr(failing, sibling)
+		if !it.Next(ctx) {
+			t.Fatal("expected a result")
+		} else if it.Next(ctx) {
+			t.Fatal("expected an error")
+		}
+		expectClosed(t, it, failing, sibling)
+	})
+	t.Run("hasa", func(t *testing.T) {
+		stats := &cursorStats{}
+		qs := &cursorStore{Store: graphmock.Store{Data: []quad.Quad{
+			quad.MakeIRI("alice", "follows", "bob", ""),
+		}}, stats: stats}
+		failing := graphmock.NewIterator(nil, graphmock.WithErr(errFailed))
+		it := NewHasA(qs, failing, quad.Subject)
+		if it.Contains(ctx, graph.PreFetched(quad.IRI("alice"))) {
+			t.Fatal("expected an error")
+		}
+		expectClosed(t, it, failing)
+		if stats.opened == 0 {
+			t.Fatal("no cursors were opened")
+		} else if stats.opened != stats.released {
+			t.Errorf("cursors leaked: opened %d, released %d", stats.opened, stats.released)
+		}
+	})
+}
@@ -0,0 +1,366 @@
+package iterator
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &CycleDetect{}
+
+// CycleDetect iterator walks the graph from values of the sub-iterator by repeatedly
+// applying a morphism, and returns nodes that participate in a cycle. It's useful for
+// data-quality checks on hierarchies that must not have loops.
+//
+// Each node is returned once, even if it participates in multiple cycles. If a path tag
+// is set, nodes of one of the shortest cycles through the result are tagged as
+// "<tag>_0" (the result itself), "<tag>_1" and so on, in the order of the traversal.
+//
+// The iterator uses Tarjan's algorithm to find strongly connected components, thus all
+// nodes on cycles reachable from the sub-iterator are found, including disconnected
+// components. It keeps a set of visited nodes, and edges only for nodes on the current
+// depth-first search stack.
+//
+// Contains runs the whole iterator once and keeps all results in memory.
+type CycleDetect struct {
+	uid      uint64
+	tags     graph.Tagger
+	qs       graph.QuadStore
+	subIt    graph.Iterator
+	morphism graph.ApplyMorphism
+	pathTag  string
+
+	nodes map[interface{}]*cycleNode // visited nodes
+	index int
+	dfs   []*cycleFrame // depth-first search stack
+	stack []interface{} // nodes of components that are not finished yet
+	queue []cycleResult // found nodes that are not returned yet
+	res   cycleResult
+	err   error
+
+	// results collected for Contains
+	contains map[interface{}][]graph.Value
+}
+
+type cycleNode struct {
+	val        graph.Value
+	index, low int
+	onStack    bool
+	next       []interface{} // edges to nodes on the stack; dropped when the component is finished
+}
+
+type cycleFrame struct {
+	key  interface{}
+	node *cycleNode
+	it   graph.Iterator // expansion of the node
+}
+
+type cycleResult struct {
+	val  graph.Value
+	path []graph.Value
+}
+
+// NewCycleDetect creates an iterator that returns nodes on cycles reachable from values of
+// the sub-iterator, following the morphism.
+func NewCycleDetect(qs graph.QuadStore, sub graph.Iterator, morphism graph.ApplyMorphism) *CycleDetect {
+	return &CycleDetect{
+		uid:      NextUID(),
+		qs:       qs,
+		subIt:    sub,
+		morphism: morphism,
+		nodes:    make(map[interface{}]*cycleNode),
+	}
+}
+
+func (it *CycleDetect) UID() uint64 {
+	return it.uid
+}
+
+// SetPathTag sets a prefix of tags for nodes of a cycle through the result.
+func (it *CycleDetect) SetPathTag(tag string) {
+	it.pathTag = tag
+}
+
+func (it *CycleDetect) Reset() {
+	it.closeDFS()
+	it.subIt.Reset()
+	it.nodes = make(map[interface{}]*cycleNode)
+	it.index = 0
+	it.stack = nil
+	it.queue = nil
+	it.res = cycleResult{}
+	it.err = nil
+}
+
+func (it *CycleDetect) closeDFS() {
+	for _, f := range it.dfs {
+		f.it.Close()
+	}
+	it.dfs = nil
+}
+
+func (it *CycleDetect) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *CycleDetect) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	if it.pathTag == "" {
+		return
+	}
+	for i, v := range it.res.path {
+		dst[it.pathTag+"_"+strconv.Itoa(i)] = v
+	}
+}
+
+func (it *CycleDetect) Clone() graph.Iterator {
+	out := NewCycleDetect(it.qs, it.subIt.Clone(), it.morphism)
+	out.tags.CopyFrom(it)
+	out.pathTag = it.pathTag
+	return out
+}
+
+func (it *CycleDetect) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// expand builds an iterator for results of the morphism for a single node.
+func (it *CycleDetect) expand(v graph.Value) graph.Iterator {
+	sub := it.morphism(it.qs, NewFixed(v))
+	sub, _ = sub.Optimize()
+	if nsub, ok := it.qs.OptimizeIterator(sub); ok {
+		sub = nsub
+	}
+	return sub
+}
+
+// visit marks the node as visited and starts the search from it.
+func (it *CycleDetect) visit(k interface{}, v graph.Value) {
+	n := &cycleNode{val: v, index: it.index, low: it.index, onStack: true}
+	it.index++
+	it.nodes[k] = n
+	it.stack = append(it.stack, k)
+	it.dfs = append(it.dfs, &cycleFrame{key: k, node: n, it: it.expand(v)})
+}
+
+// step follows a single edge of the node on top of the search stack, or finishes the node.
+func (it *CycleDetect) step(ctx context.Context) error {
+	f := it.dfs[len(it.dfs)-1]
+	if f.it.Next(ctx) {
+		v := f.it.Result()
+		k := graph.ToKey(v)
+		if m, ok := it.nodes[k]; !ok {
+			f.node.next = append(f.node.next, k)
+			it.visit(k, v)
+		} else if m.onStack {
+			f.node.next = append(f.node.next, k)
+			if m.index < f.node.low {
+				f.node.low = m.index
+			}
+		}
+		return nil
+	}
+	err := f.it.Err()
+	f.it.Close()
+	it.dfs = it.dfs[:len(it.dfs)-1]
+	if err != nil {
+		return err
+	}
+	if len(it.dfs) != 0 {
+		if p := it.dfs[len(it.dfs)-1].node; f.node.low < p.low {
+			p.low = f.node.low
+		}
+	}
+	if f.node.low == f.node.index {
+		it.finish(f.key)
+	}
+	return nil
+}
+
+// finish removes a strongly connected component with a given root from the stack
+// and queues its nodes, if the component has a cycle.
+func (it *CycleDetect) finish(root interface{}) {
+	i := len(it.stack) - 1
+	for it.stack[i] != root {
+		i--
+	}
+	comp := it.stack[i:]
+	it.stack = it.stack[:i]
+
+	members := make(map[interface{}]*cycleNode, len(comp))
+	for _, k := range comp {
+		n := it.nodes[k]
+		n.onStack = false
+		members[k] = n
+	}
+	for _, k := range comp {
+		if path := shortestCycle(k, members); path != nil {
+			it.queue = append(it.queue, cycleResult{val: members[k].val, path: path})
+		}
+	}
+	for _, n := range members {
+		n.next = nil
+	}
+}
+
+// shortestCycle returns nodes of the shortest cycle that starts at a given node and
+// doesn't leave the component, or nil if there is no such cycle.
+func shortestCycle(start interface{}, members map[interface{}]*cycleNode) []graph.Value {
+	prev := make(map[interface{}]interface{})
+	front := []interface{}{start}
+	for len(front) != 0 {
+		var next []interface{}
+		for _, k := range front {
+			for _, nk := range members[k].next {
+				if _, ok := members[nk]; !ok {
+					continue
+				} else if nk == start {
+					var path []graph.Value
+					for c := k; c != start; c = prev[c] {
+						path = append(path, members[c].val)
+					}
+					path = append(path, members[start].val)
+					// reverse, so the path starts at the node
+					for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+						path[i], path[j] = path[j], path[i]
+					}
+					return path
+				} else if _, ok := prev[nk]; ok {
+					continue
+				}
+				prev[nk] = k
+				next = append(next, nk)
+			}
+		}
+		front = next
+	}
+	return nil
+}
+
+func (it *CycleDetect) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	for {
+		if len(it.queue) != 0 {
+			it.res = it.queue[0]
+			it.queue = it.queue[1:]
+			return graph.NextLogOut(it, true)
+		} else if it.err != nil {
+			return graph.NextLogOut(it, false)
+		}
+		if len(it.dfs) != 0 {
+			if err := it.step(ctx); err != nil {
+				it.err = err
+				it.closeDFS()
+			}
+			continue
+		}
+		if !it.subIt.Next(ctx) {
+			it.err = it.subIt.Err()
+			it.res = cycleResult{}
+			return graph.NextLogOut(it, false)
+		}
+		v := it.subIt.Result()
+		if k := graph.ToKey(v); it.nodes[k] == nil {
+			it.visit(k, v)
+		}
+	}
+}
+
+func (it *CycleDetect) Err() error {
+	return it.err
+}
+
+func (it *CycleDetect) Result() graph.Value {
+	return it.res.val
+}
+
+// collect runs a clone of the iterator and remembers all results.
+func (it *CycleDetect) collect(ctx context.Context) error {
+	c := it.Clone().(*CycleDetect)
+	defer c.Close()
+	it.contains = make(map[interface{}][]graph.Value)
+	for c.Next(ctx) {
+		it.contains[graph.ToKey(c.Result())] = c.res.path
+	}
+	return c.Err()
+}
+
+func (it *CycleDetect) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if it.contains == nil {
+		if err := it.collect(ctx); err != nil {
+			it.err = err
+			it.contains = nil
+			return graph.ContainsLogOut(it, val, false)
+		}
+	}
+	path, ok := it.contains[graph.ToKey(val)]
+	if !ok {
+		it.res = cycleResult{}
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.res = cycleResult{val: val, path: path}
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *CycleDetect) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *CycleDetect) Close() error {
+	it.closeDFS()
+	it.nodes = nil
+	it.stack = nil
+	it.queue = nil
+	it.contains = nil
+	return it.subIt.Close()
+}
+
+func (it *CycleDetect) Type() graph.Type { return graph.CycleDetect }
+
+func (it *CycleDetect) String() string {
+	return "CycleDetect"
+}
+
+func (it *CycleDetect) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		it.Close()
+		return NewNull(), true
+	}
+	return it, false
+}
+
+// expansionStats estimates costs of the morphism for a single node.
+func (it *CycleDetect) expansionStats() graph.IteratorStats {
+	ex := it.morphism(it.qs, NewFixed())
+	defer ex.Close()
+	return ex.Stats()
+}
+
+// Size returns an estimate of the number of results: the number of nodes
+// reachable from the sub-iterator in a single step.
+func (it *CycleDetect) Size() (int64, bool) {
+	n, exact := it.subIt.Size()
+	if exact && n == 0 {
+		return 0, true
+	}
+	return n * it.expansionStats().Size, false
+}
+
+func (it *CycleDetect) Stats() graph.IteratorStats {
+	sub := it.subIt.Stats()
+	ex := it.expansionStats()
+	size, _ := it.Size()
+	next := sub.NextCost + ex.NextCost
+	return graph.IteratorStats{
+		NextCost: next,
+		// all results are collected on the first call
+		ContainsCost: next * size,
+		Size:         size,
+	}
+}
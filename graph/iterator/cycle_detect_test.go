@@ -0,0 +1,163 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var cycleTestQS = &graphmock.Store{
+	Data: []quad.Quad{
+		// a -> b -> c -> a, c -> d -> e
+		quad.MakeRaw("a", "parent", "b", ""),
+		quad.MakeRaw("b", "parent", "c", ""),
+		quad.MakeRaw("c", "parent", "a", ""),
+		quad.MakeRaw("c", "parent", "d", ""),
+		quad.MakeRaw("d", "parent", "e", ""),
+		// f -> f
+		quad.MakeRaw("f", "parent", "f", ""),
+		// g -> h -> g, g -> i -> h
+		quad.MakeRaw("g", "parent", "h", ""),
+		quad.MakeRaw("h", "parent", "g", ""),
+		quad.MakeRaw("g", "parent", "i", ""),
+		quad.MakeRaw("i", "parent", "h", ""),
+		// tree
+		quad.MakeRaw("x", "parent", "y", ""),
+		quad.MakeRaw("x", "parent", "z", ""),
+		quad.MakeRaw("y", "parent", "z", ""),
+	},
+}
+
+var cycleDetectTests = []struct {
+	name   string
+	start  []string
+	expect []string // node: cycle path
+}{
+	{
+		name:   "cycle",
+		start:  []string{"a"},
+		expect: []string{"a: a b c", "b: b c a", "c: c a b"},
+	},
+	{
+		name:   "cycle reachable from the start",
+		start:  []string{"d", "c"},
+		expect: []string{"a: a b c", "b: b c a", "c: c a b"},
+	},
+	{
+		name:   "self loop",
+		start:  []string{"f"},
+		expect: []string{"f: f"},
+	},
+	{
+		name:   "nodes on different cycles",
+		start:  []string{"g"},
+		expect: []string{"g: g h", "h: h g", "i: i h g"},
+	},
+	{
+		name:   "disconnected components",
+		start:  []string{"x", "f", "e", "b"},
+		expect: []string{"a: a b c", "b: b c a", "c: c a b", "f: f"},
+	},
+	{
+		name:  "no cycles",
+		start: []string{"x", "d"},
+	},
+}
+
+func cycleDetectStart(names ...string) *Fixed {
+	start := NewFixed()
+	for _, name := range names {
+		start.Add(graph.PreFetched(quad.Raw(name)))
+	}
+	return start
+}
+
+func cycleResultString(qs graph.QuadStore, it graph.Iterator) string {
+	tags := make(map[string]graph.Value)
+	it.TagResults(tags)
+	var path []string
+	for i := 0; ; i++ {
+		v, ok := tags["cycle_"+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		path = append(path, quad.ToString(qs.NameOf(v)))
+	}
+	return quad.ToString(qs.NameOf(tags["id"])) + ": " + strings.Join(path, " ")
+}
+
+func TestCycleDetect(t *testing.T) {
+	ctx := context.TODO()
+	qs := cycleTestQS
+	for _, c := range cycleDetectTests {
+		t.Run(c.name, func(t *testing.T) {
+			it := NewCycleDetect(qs, cycleDetectStart(c.start...), singleHop("parent"))
+			it.Tagger().Add("id")
+			it.SetPathTag("cycle")
+			defer it.Close()
+
+			var got []string
+			for it.Next(ctx) {
+				got = append(got, cycleResultString(qs, it))
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("unexpected results: %q vs %q", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestCycleDetectContains(t *testing.T) {
+	ctx := context.TODO()
+	qs := cycleTestQS
+	it := NewCycleDetect(qs, cycleDetectStart("x", "g"), singleHop("parent"))
+	it.Tagger().Add("id")
+	it.SetPathTag("cycle")
+	defer it.Close()
+	for _, c := range []struct {
+		name   string
+		expect string
+	}{
+		{"i", "i: i h g"},
+		{"x", ""},
+		{"a", ""},
+		{"g", "g: g h"},
+	} {
+		ok := it.Contains(ctx, graph.PreFetched(quad.Raw(c.name)))
+		if ok != (c.expect != "") {
+			t.Errorf("unexpected result for %q: %v", c.name, ok)
+		} else if ok {
+			if got := cycleResultString(qs, it); got != c.expect {
+				t.Errorf("unexpected path for %q: %q vs %q", c.name, got, c.expect)
+			}
+		}
+	}
+}
+
+func TestCycleDetectReset(t *testing.T) {
+	ctx := context.TODO()
+	it := NewCycleDetect(cycleTestQS, cycleDetectStart("a", "f"), singleHop("parent"))
+	defer it.Close()
+	for i := 0; i < 2; i++ {
+		n := 0
+		for it.Next(ctx) {
+			n++
+		}
+		if n != 4 {
+			t.Errorf("unexpected number of results on run %d: %d", i, n)
+		}
+		it.Reset()
+	}
+}
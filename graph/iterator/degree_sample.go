@@ -0,0 +1,182 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &DegreeSample{}
+
+// DegreeSample iterator draws a random sample of nodes from the sub-iterator (see Sample)
+// and tags each of them with its degree: the number of quads that have the node in a given
+// direction. For example, the subject direction gives the out-degree of nodes.
+//
+// It allows to estimate degrees of nodes without reading all the quads (see Average).
+// The degree is tagged as an integer value (quad.Int), which can be rendered by any QuadStore.
+type DegreeSample struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     graph.QuadStore
+	sample *Sample
+	dir    quad.Direction
+	tag    string
+	degree int64
+	err    error
+}
+
+// NewDegreeSample creates a new DegreeSample iterator that samples at most n nodes of the
+// sub-iterator using a given seed, and tags their degrees in the direction with a given tag.
+func NewDegreeSample(qs graph.QuadStore, sub graph.Iterator, dir quad.Direction, n, seed int64, tag string) *DegreeSample {
+	return newDegreeSample(qs, NewSample(sub, n, seed), dir, tag)
+}
+
+func newDegreeSample(qs graph.QuadStore, sample *Sample, dir quad.Direction, tag string) *DegreeSample {
+	return &DegreeSample{
+		uid:    NextUID(),
+		qs:     qs,
+		sample: sample,
+		dir:    dir,
+		tag:    tag,
+	}
+}
+
+func (it *DegreeSample) UID() uint64 {
+	return it.uid
+}
+
+// Direction returns the direction in which quads of sampled nodes are counted.
+func (it *DegreeSample) Direction() quad.Direction { return it.dir }
+
+// DegreeTag returns the tag used for degrees of sampled nodes.
+func (it *DegreeSample) DegreeTag() string { return it.tag }
+
+// Reset rewinds the iterator to the beginning of the same sample.
+func (it *DegreeSample) Reset() {
+	it.sample.Reset()
+	it.degree = 0
+	it.err = nil
+}
+
+func (it *DegreeSample) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *DegreeSample) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.sample.TagResults(dst)
+	if it.Result() != nil {
+		dst[it.tag] = graph.PreFetched(quad.Int(it.degree))
+	}
+}
+
+func (it *DegreeSample) Clone() graph.Iterator {
+	out := newDegreeSample(it.qs, it.sample.Clone().(*Sample), it.dir, it.tag)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns the iterator of nodes the sample is drawn from.
+func (it *DegreeSample) SubIterators() []graph.Iterator {
+	return it.sample.SubIterators()
+}
+
+// countDegree counts quads of the current node. The size of the quad iterator is used,
+// if it's exact; otherwise quads are read one by one.
+func (it *DegreeSample) countDegree(ctx context.Context) bool {
+	qi := it.qs.QuadIterator(it.dir, it.sample.Result())
+	defer qi.Close()
+	if n, exact := qi.Size(); exact {
+		it.degree = n
+		return true
+	}
+	it.degree = 0
+	for qi.Next(ctx) {
+		it.degree++
+	}
+	it.err = qi.Err()
+	return it.err == nil
+}
+
+func (it *DegreeSample) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if it.err != nil || !it.sample.Next(ctx) {
+		return graph.NextLogOut(it, false)
+	}
+	return graph.NextLogOut(it, it.countDegree(ctx))
+}
+
+func (it *DegreeSample) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.sample.Err()
+}
+
+func (it *DegreeSample) Result() graph.Value {
+	return it.sample.Result()
+}
+
+// Contains checks if the value is a part of the sample and counts its degree.
+func (it *DegreeSample) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if it.err != nil || !it.sample.Contains(ctx, val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	return graph.ContainsLogOut(it, val, it.countDegree(ctx))
+}
+
+// NextPath returns the next path of the current node. It doesn't change the degree.
+func (it *DegreeSample) NextPath(ctx context.Context) bool {
+	return it.sample.NextPath(ctx)
+}
+
+func (it *DegreeSample) Close() error {
+	return it.sample.Close()
+}
+
+func (it *DegreeSample) Type() graph.Type { return graph.DegreeSample }
+
+func (it *DegreeSample) Optimize() (graph.Iterator, bool) {
+	if _, changed := it.sample.Optimize(); changed {
+		// sample can only be replaced by the Null iterator
+		return NewNull(), true
+	}
+	return it, false
+}
+
+// Stats accounts for an index lookup to count quads of each sampled node.
+func (it *DegreeSample) Stats() graph.IteratorStats {
+	st := it.sample.Stats()
+	st.NextCost++
+	st.ContainsCost++
+	return st
+}
+
+func (it *DegreeSample) Size() (int64, bool) {
+	return it.sample.Size()
+}
+
+func (it *DegreeSample) String() string {
+	return fmt.Sprintf("DegreeSample(%v, %d, seed=%d, %q)", it.dir, it.sample.size, it.sample.seed, it.tag)
+}
+
+// Average resets the iterator, reads all the sampled nodes and returns their average degree,
+// which is an estimate of the average degree of all the nodes of the sub-iterator.
+// It returns zero if the sample is empty.
+func (it *DegreeSample) Average(ctx context.Context) (float64, error) {
+	it.Reset()
+	var sum, n int64
+	for it.Next(ctx) {
+		sum += it.degree
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, nil
+	}
+	return float64(sum) / float64(n), nil
+}
@@ -0,0 +1,90 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestDegreeSample(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{
+		Data: []quad.Quad{
+			quad.MakeRaw("a", "follows", "b", ""),
+			quad.MakeRaw("a", "follows", "c", ""),
+			quad.MakeRaw("a", "likes", "d", ""),
+			quad.MakeRaw("b", "follows", "c", ""),
+			quad.MakeRaw("d", "follows", "a", ""),
+		},
+	}
+	nodes := func() *Fixed {
+		it := NewFixed()
+		for _, s := range []string{"a", "b", "c", "d"} {
+			it.Add(graph.PreFetched(quad.Raw(s)))
+		}
+		return it
+	}
+	degrees := func(it graph.Iterator) map[string]int64 {
+		out := make(map[string]int64)
+		for it.Next(ctx) {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			out[quad.ToString(qs.NameOf(it.Result()))] = int64(qs.NameOf(tags["deg"]).(quad.Int))
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	it := NewDegreeSample(qs, nodes(), quad.Subject, 10, 1, "deg")
+	expect := map[string]int64{"a": 3, "b": 1, "c": 0, "d": 1}
+	if got := degrees(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected out-degrees: %v vs %v", got, expect)
+	}
+	avg, err := it.Average(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if avg != 5.0/4 {
+		t.Errorf("unexpected average: %v", avg)
+	}
+	it.Close()
+
+	it = NewDegreeSample(qs, nodes(), quad.Object, 10, 1, "deg")
+	expect = map[string]int64{"a": 1, "b": 1, "c": 2, "d": 1}
+	if got := degrees(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected in-degrees: %v vs %v", got, expect)
+	}
+	it.Close()
+
+	// sample is reproducible for the same seed
+	keys := func(m map[string]int64) []string {
+		var out []string
+		for k := range m {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+		return out
+	}
+	it = NewDegreeSample(qs, nodes(), quad.Subject, 2, 42, "deg")
+	first := degrees(it)
+	if len(first) != 2 {
+		t.Fatalf("unexpected sample size: %v", first)
+	}
+	it2 := it.Clone()
+	if second := degrees(it2); !reflect.DeepEqual(keys(first), keys(second)) {
+		t.Errorf("sample is not reproducible: %v vs %v", first, second)
+	}
+	it.Close()
+	it2.Close()
+
+	if it, _ := NewDegreeSample(qs, nodes(), quad.Subject, 0, 1, "deg").Optimize(); it.Type() != graph.Null {
+		t.Errorf("expected empty sample to be optimized away: %v", it)
+	}
+}
@@ -0,0 +1,833 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Describe methods and builders that allow to serialize iterator trees and
+// rebuild them with graph.BuildFromDescription.
+//
+// Iterators that apply a morphism to each input, like Recursive, describe the
+// morphism as an iterator tree built from a MorphismInput placeholder. Validate
+// iterators hold Go functions, thus they cannot be rebuilt.
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var (
+	_ graph.Describer = &Fixed{}
+	_ graph.Describer = &Int64{}
+	_ graph.Describer = &HasA{}
+	_ graph.Describer = &LinksTo{}
+	_ graph.Describer = &And{}
+	_ graph.Describer = &Or{}
+	_ graph.Describer = &ZigZag{}
+	_ graph.Describer = &AndBitmap{}
+	_ graph.Describer = &Comparison{}
+	_ graph.Describer = &Regex{}
+	_ graph.Describer = &CIDRMatch{}
+	_ graph.Describer = &Limit{}
+	_ graph.Describer = &Skip{}
+	_ graph.Describer = &RateLimit{}
+	_ graph.Describer = &Sort{}
+	_ graph.Describer = &DistinctCount{}
+	_ graph.Describer = &Timeout{}
+	_ graph.Describer = &CardinalityViolation{}
+	_ graph.Describer = &Nearest{}
+	_ graph.Describer = &Page{}
+	_ graph.Describer = &SlidingCount{}
+	_ graph.Describer = &MergeSorted{}
+	_ graph.Describer = &RequireTags{}
+	_ graph.Describer = &Prefix{}
+	_ graph.Describer = &Sample{}
+	_ graph.Describer = &Enumerate{}
+	_ graph.Describer = &DegreeSample{}
+	_ graph.Describer = &DistinctPairs{}
+	_ graph.Describer = &Edge{}
+	_ graph.Describer = &Recursive{}
+	_ graph.Describer = &CycleDetect{}
+	_ graph.Describer = &LimitPerNode{}
+	_ graph.Describer = &morphismInput{}
+)
+
+// morphismInput marks the input of a morphism in its description. It wraps the
+// actual input once the morphism is rebuilt, see buildMorphism.
+type morphismInput struct {
+	graph.Iterator
+	bound bool
+}
+
+func (it *morphismInput) Clone() graph.Iterator {
+	return &morphismInput{Iterator: it.Iterator.Clone(), bound: it.bound}
+}
+
+func (it *morphismInput) Optimize() (graph.Iterator, bool) {
+	if it.bound {
+		return it.Iterator, true
+	}
+	return it, false
+}
+
+func (it *morphismInput) Size() (int64, bool) {
+	if it.bound {
+		return it.Iterator.Size()
+	}
+	// should not be treated as empty while the morphism is described
+	return 1, false
+}
+
+func (it *morphismInput) Stats() graph.IteratorStats {
+	if it.bound {
+		return it.Iterator.Stats()
+	}
+	return graph.IteratorStats{NextCost: 1, ContainsCost: 1, Size: 1}
+}
+
+func (it *morphismInput) Type() graph.Type { return graph.MorphismInput }
+
+func (it *morphismInput) Describe() graph.Description {
+	return graph.Description{Iterators: []graph.Description{}}
+}
+
+// describeMorphism applies a morphism to a placeholder input and describes the result.
+func describeMorphism(qs graph.QuadStore, m graph.ApplyMorphism) *graph.Description {
+	it := m(qs, &morphismInput{Iterator: NewFixed()})
+	defer it.Close()
+	d := graph.DescribeIterator(it)
+	return &d
+}
+
+// buildMorphism rebuilds a morphism described by describeMorphism.
+func buildMorphism(qs graph.QuadStore, d graph.Description) (graph.ApplyMorphism, error) {
+	if d.Morphism == nil {
+		return nil, fmt.Errorf("morphism is not set for %v", d.Type)
+	}
+	tmpl, err := graph.BuildFromDescription(qs, *d.Morphism)
+	if err != nil {
+		return nil, err
+	}
+	return func(qs graph.QuadStore, in graph.Iterator) graph.Iterator {
+		it := tmpl.Clone()
+		bindMorphism(it, in, false)
+		return it
+	}, nil
+}
+
+// bindMorphism sets the input of all placeholders in the tree. The first one
+// gets the input itself and the rest get its clones.
+func bindMorphism(it, in graph.Iterator, used bool) bool {
+	if p, ok := it.(*morphismInput); ok {
+		if used {
+			in = in.Clone()
+		}
+		p.Iterator, p.bound = in, true
+		return true
+	}
+	for _, sub := range it.SubIterators() {
+		if bindMorphism(sub, in, used) {
+			used = true
+		}
+	}
+	return used
+}
+
+func (it *Recursive) Describe() graph.Description {
+	return graph.Description{
+		Params: graph.Options{
+			"max_depth":  it.maxDepth,
+			"depth_tags": it.depthTags.Tags(),
+		},
+		Morphism: describeMorphism(it.qs, it.morphism),
+	}
+}
+
+func (it *CycleDetect) Describe() graph.Description {
+	return graph.Description{
+		Params:   graph.Options{"path_tag": it.pathTag},
+		Morphism: describeMorphism(it.qs, it.morphism),
+	}
+}
+
+func (it *LimitPerNode) Describe() graph.Description {
+	return graph.Description{
+		Params:   graph.Options{"limit": it.limit},
+		Morphism: describeMorphism(it.qs, it.morphism),
+	}
+}
+
+func (it *Fixed) Describe() graph.Description {
+	return graph.Description{Refs: it.values}
+}
+
+// Describe returns a description of the range as an iterator of all nodes or quads.
+func (it *Int64) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"nodes": it.node}}
+}
+
+func (it *HasA) Describe() graph.Description {
+	return graph.Description{Direction: it.dir}
+}
+
+func (it *LinksTo) Describe() graph.Description {
+	return graph.Description{Direction: it.dir}
+}
+
+func (it *And) Describe() graph.Description {
+	var d graph.Description
+	if it.tagPolicy != TagKeepLast {
+		d.Params = graph.Options{"tag_policy": int(it.tagPolicy)}
+	}
+	return d
+}
+
+func (it *Or) Describe() graph.Description {
+	var d graph.Description
+	if it.isShortCircuiting || it.timeout > 0 || it.adaptive {
+		d.Params = graph.Options{}
+	}
+	if it.isShortCircuiting {
+		d.Params["short_circuit"] = true
+	}
+	if it.timeout > 0 {
+		d.Params["branch_timeout"] = it.timeout.String()
+	}
+	if it.adaptive {
+		d.Params["adaptive"] = true
+	}
+	return d
+}
+
+// Describe returns a description of ZigZag as an And of its subiterators.
+func (it *ZigZag) Describe() graph.Description {
+	return graph.Description{Type: graph.And}
+}
+
+// Describe returns a description of AndBitmap as an And of its subiterators.
+func (it *AndBitmap) Describe() graph.Description {
+	return graph.Description{Type: graph.And}
+}
+
+func (it *Comparison) Describe() graph.Description {
+	return graph.Description{
+		Values: []string{graph.EncodeValue(it.val)},
+		Params: graph.Options{"op": it.op.String()},
+	}
+}
+
+func (it *Regex) Describe() graph.Description {
+	return graph.Description{
+		Params: graph.Options{"pattern": it.re.String(), "refs": it.allowRefs},
+	}
+}
+
+func (it *Prefix) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"prefix": it.prefix}}
+}
+
+func (it *CIDRMatch) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"cidr": it.ipnet.String()}}
+}
+
+func (it *Limit) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"limit": it.limit}}
+}
+
+func (it *Skip) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"skip": it.skip}}
+}
+
+func (it *RateLimit) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"rate": it.rate}}
+}
+
+func (it *Timeout) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"timeout": it.timeout.String()}}
+}
+
+func (it *Sample) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"size": it.size, "seed": it.seed}}
+}
+
+func (it *Sort) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"by": it.by, "desc": it.desc}}
+}
+
+func (it *Enumerate) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"tag": it.tag}}
+}
+
+func (it *DegreeSample) Describe() graph.Description {
+	return graph.Description{
+		Direction: it.dir,
+		Params:    graph.Options{"size": it.sample.size, "seed": it.sample.seed, "tag": it.tag},
+	}
+}
+
+func (it *DistinctPairs) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"first": it.first, "second": it.second}}
+}
+
+func (it *Edge) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"subject": it.subjectTag, "object": it.objectTag}}
+}
+
+func (it *DistinctCount) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"precision": int(it.precision)}}
+}
+
+func (it *CardinalityViolation) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"max": int(it.max), "tag": it.tag}}
+}
+
+func (it *Nearest) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"target": it.target, "k": it.k}}
+}
+
+// Describe returns a description of the page. The value that the page starts after is
+// stored in Values, if it's set.
+func (it *Page) Describe() graph.Description {
+	d := graph.Description{Params: graph.Options{"limit": int(it.limit)}}
+	if it.after != nil {
+		d.Values = []string{it.after.key}
+	}
+	return d
+}
+
+func (it *SlidingCount) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"by": it.by, "window": it.window, "as": it.as}}
+}
+
+func (it *MergeSorted) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"dedup": it.dedup}}
+}
+
+func (it *RequireTags) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"tags": it.required}}
+}
+
+func init() {
+	reg := graph.RegisterIteratorBuilder
+	reg(graph.Null, func(_ graph.QuadStore, _ graph.Description, _ []graph.Iterator) (graph.Iterator, error) {
+		return NewNull(), nil
+	})
+	reg(graph.All, func(qs graph.QuadStore, d graph.Description, _ []graph.Iterator) (graph.Iterator, error) {
+		nodes, err := d.Params.BoolKey("nodes", false)
+		if err != nil {
+			return nil, err
+		} else if nodes {
+			return qs.NodesAllIterator(), nil
+		}
+		return qs.QuadsAllIterator(), nil
+	})
+	reg(graph.Fixed, func(qs graph.QuadStore, d graph.Description, _ []graph.Iterator) (graph.Iterator, error) {
+		vals, err := d.DecodeValues(qs)
+		if err != nil {
+			return nil, err
+		}
+		it := NewFixed()
+		for _, v := range vals {
+			// values that are missing in the quad store cannot be returned
+			if v != nil {
+				it.Add(v)
+			}
+		}
+		return it, nil
+	})
+	reg(graph.HasA, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewHasA(qs, sub[0], d.Direction), nil
+	})
+	reg(graph.LinksTo, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewLinksTo(qs, sub[0], d.Direction), nil
+	})
+	reg(graph.And, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		p, err := d.Params.IntKey("tag_policy", int(TagKeepLast))
+		if err != nil {
+			return nil, err
+		}
+		it := NewAnd(qs, sub...)
+		it.SetTagPolicy(TagPolicy(p))
+		return it, nil
+	})
+	reg(graph.Or, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		short, err := d.Params.BoolKey("short_circuit", false)
+		if err != nil {
+			return nil, err
+		}
+		adaptive, err := d.Params.BoolKey("adaptive", false)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.Params.StringKey("branch_timeout", "")
+		if err != nil {
+			return nil, err
+		}
+		var timeout time.Duration
+		if s != "" {
+			if timeout, err = time.ParseDuration(s); err != nil {
+				return nil, err
+			}
+		}
+		it := NewOr()
+		if short {
+			it = NewShortCircuitOr()
+		}
+		it.SetBranchTimeout(timeout)
+		it.SetAdaptive(adaptive)
+		for _, s := range sub {
+			it.AddSubIterator(s)
+		}
+		return it, nil
+	})
+	reg(graph.Not, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 2); err != nil {
+			return nil, err
+		}
+		return NewNot(sub[0], sub[1]), nil
+	})
+	reg(graph.Optional, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewOptional(sub[0]), nil
+	})
+	reg(graph.Materialize, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewMaterialize(sub[0]), nil
+	})
+	reg(graph.Shared, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return MarkShared(sub[0]), nil
+	})
+	reg(graph.Sync, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewSyncIterator(sub[0]), nil
+	})
+	reg(graph.Unique, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewUnique(sub[0]), nil
+	})
+	reg(graph.Count, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewCount(sub[0], qs), nil
+	})
+	reg(graph.DistinctCount, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		p, err := d.Params.IntKey("precision", DefaultDistinctPrecision)
+		if err != nil {
+			return nil, err
+		}
+		return NewDistinctCount(sub[0], qs, p), nil
+	})
+	reg(graph.CardinalityViolation, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		max, err := d.Params.IntKey("max", 1)
+		if err != nil {
+			return nil, err
+		}
+		tag, err := d.Params.StringKey("tag", "")
+		if err != nil {
+			return nil, err
+		}
+		return NewCardinalityViolation(sub[0], int64(max), tag), nil
+	})
+	reg(graph.Limit, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		n, err := d.Params.IntKey("limit", 0)
+		if err != nil {
+			return nil, err
+		}
+		return NewLimit(sub[0], int64(n)), nil
+	})
+	reg(graph.Skip, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		n, err := d.Params.IntKey("skip", 0)
+		if err != nil {
+			return nil, err
+		}
+		return NewSkip(sub[0], int64(n)), nil
+	})
+	reg(graph.RateLimit, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		rate, ok := d.Params["rate"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid rate parameter: %T", d.Params["rate"])
+		}
+		return NewRateLimit(sub[0], rate), nil
+	})
+	reg(graph.Timeout, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		s, err := d.Params.StringKey("timeout", "")
+		if err != nil {
+			return nil, err
+		}
+		dt, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		return NewTimeout(sub[0], dt), nil
+	})
+	reg(graph.Sort, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		by, err := d.Params.StringKey("by", "")
+		if err != nil {
+			return nil, err
+		}
+		desc, err := d.Params.BoolKey("desc", false)
+		if err != nil {
+			return nil, err
+		}
+		return NewSort(qs, sub[0], by, desc), nil
+	})
+	reg(graph.Enumerate, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		tag, err := d.Params.StringKey("tag", "")
+		if err != nil {
+			return nil, err
+		}
+		return NewEnumerate(sub[0], tag), nil
+	})
+	reg(graph.Sample, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		n, err := d.Params.IntKey("size", 0)
+		if err != nil {
+			return nil, err
+		}
+		seed, err := d.Params.IntKey("seed", 0)
+		if err != nil {
+			return nil, err
+		}
+		return NewSample(sub[0], int64(n), int64(seed)), nil
+	})
+	reg(graph.DegreeSample, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		n, err := d.Params.IntKey("size", 0)
+		if err != nil {
+			return nil, err
+		}
+		seed, err := d.Params.IntKey("seed", 0)
+		if err != nil {
+			return nil, err
+		}
+		tag, err := d.Params.StringKey("tag", "")
+		if err != nil {
+			return nil, err
+		}
+		return NewDegreeSample(qs, sub[0], d.Direction, int64(n), int64(seed), tag), nil
+	})
+	reg(graph.DistinctPairs, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		first, err := d.Params.StringKey("first", "")
+		if err != nil {
+			return nil, err
+		}
+		second, err := d.Params.StringKey("second", "")
+		if err != nil {
+			return nil, err
+		}
+		return NewDistinctPairs(sub[0], first, second), nil
+	})
+	reg(graph.Edge, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		subject, err := d.Params.StringKey("subject", "")
+		if err != nil {
+			return nil, err
+		}
+		object, err := d.Params.StringKey("object", "")
+		if err != nil {
+			return nil, err
+		}
+		return NewEdge(qs, sub[0], subject, object), nil
+	})
+	reg(graph.Predicates, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		return NewPredicates(qs, sub[0]), nil
+	})
+	reg(graph.Nearest, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		target, ok := d.Params["target"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid target parameter: %T", d.Params["target"])
+		}
+		k, err := d.Params.IntKey("k", 0)
+		if err != nil {
+			return nil, err
+		}
+		return NewNearest(qs, sub[0], target, k), nil
+	})
+	reg(graph.Page, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		} else if len(d.Values) > 1 {
+			return nil, fmt.Errorf("expected at most one value for page, got %d", len(d.Values))
+		}
+		n, err := d.Params.IntKey("limit", 0)
+		if err != nil {
+			return nil, err
+		}
+		var after quad.Value
+		if len(d.Values) == 1 {
+			if after, err = graph.DecodeValue(d.Values[0]); err != nil {
+				return nil, err
+			}
+		}
+		return NewPage(qs, sub[0], after, int64(n)), nil
+	})
+	reg(graph.SlidingCount, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		by, err := d.Params.StringKey("by", "")
+		if err != nil {
+			return nil, err
+		}
+		as, err := d.Params.StringKey("as", "")
+		if err != nil {
+			return nil, err
+		}
+		window, ok := d.Params["window"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid window parameter: %T", d.Params["window"])
+		}
+		return NewSlidingCount(qs, sub[0], by, window, as), nil
+	})
+	reg(graph.MergeSorted, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		dedup, err := d.Params.BoolKey("dedup", false)
+		if err != nil {
+			return nil, err
+		}
+		its := make([]graph.Seekable, 0, len(sub))
+		for _, s := range sub {
+			si, ok := s.(graph.Seekable)
+			if !ok {
+				// iterators of this quad store are not sorted, return the same results in any order
+				var it graph.Iterator = NewOr(sub...)
+				if dedup {
+					it = NewUnique(it)
+				}
+				return it, nil
+			}
+			its = append(its, si)
+		}
+		return NewMergeSorted(dedup, its...), nil
+	})
+	reg(graph.RequireTags, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		tags, err := tagsParam(d, "tags")
+		if err != nil {
+			return nil, err
+		}
+		return NewRequireTags(sub[0], tags...), nil
+	})
+	reg(graph.MorphismInput, func(qs graph.QuadStore, d graph.Description, _ []graph.Iterator) (graph.Iterator, error) {
+		return &morphismInput{Iterator: NewNull()}, nil
+	})
+	reg(graph.Recursive, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		depth, err := d.Params.IntKey("max_depth", 0)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := tagsParam(d, "depth_tags")
+		if err != nil {
+			return nil, err
+		}
+		m, err := buildMorphism(qs, d)
+		if err != nil {
+			return nil, err
+		}
+		it := NewRecursive(qs, sub[0], m, depth)
+		for _, tag := range tags {
+			it.AddDepthTag(tag)
+		}
+		return it, nil
+	})
+	reg(graph.CycleDetect, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		tag, err := d.Params.StringKey("path_tag", "")
+		if err != nil {
+			return nil, err
+		}
+		m, err := buildMorphism(qs, d)
+		if err != nil {
+			return nil, err
+		}
+		it := NewCycleDetect(qs, sub[0], m)
+		it.SetPathTag(tag)
+		return it, nil
+	})
+	reg(graph.LimitPerNode, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		n, err := d.Params.IntKey("limit", 0)
+		if err != nil {
+			return nil, err
+		}
+		m, err := buildMorphism(qs, d)
+		if err != nil {
+			return nil, err
+		}
+		return NewLimitPerNode(qs, sub[0], m, int64(n)), nil
+	})
+	reg(graph.Comparison, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		} else if len(d.Values) != 1 {
+			return nil, fmt.Errorf("expected one value for comparison, got %d", len(d.Values))
+		}
+		val, err := graph.DecodeValue(d.Values[0])
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.Params.StringKey("op", "")
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range []Operator{CompareLT, CompareLTE, CompareGT, CompareGTE} {
+			if op.String() == s {
+				return NewComparison(sub[0], op, val, qs), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown comparison operator: %q", s)
+	})
+	reg(graph.Regex, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		s, err := d.Params.StringKey("pattern", "")
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := d.Params.BoolKey("refs", false)
+		if err != nil {
+			return nil, err
+		}
+		it := NewRegex(sub[0], re, qs)
+		it.AllowRefs(refs)
+		return it, nil
+	})
+	reg(graph.Prefix, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		prefix, err := d.Params.StringKey("prefix", "")
+		if err != nil {
+			return nil, err
+		}
+		return NewPrefix(sub[0], prefix, qs), nil
+	})
+	reg(graph.CIDRMatch, func(qs graph.QuadStore, d graph.Description, sub []graph.Iterator) (graph.Iterator, error) {
+		if err := checkSub(d, sub, 1); err != nil {
+			return nil, err
+		}
+		s, err := d.Params.StringKey("cidr", "")
+		if err != nil {
+			return nil, err
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		return NewCIDRMatch(sub[0], ipnet, qs), nil
+	})
+}
+
+// tagsParam returns a list of tags from the parameters of the description.
+func tagsParam(d graph.Description, key string) ([]string, error) {
+	var tags []string
+	switch v := d.Params[key].(type) {
+	case []string:
+		tags = v
+	case []interface{}:
+		// decoded from JSON
+		for _, t := range v {
+			s, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid tag: %T", t)
+			}
+			tags = append(tags, s)
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("invalid %s parameter: %T", key, v)
+	}
+	return tags, nil
+}
+
+func checkSub(d graph.Description, sub []graph.Iterator, n int) error {
+	if len(sub) != n {
+		return fmt.Errorf("expected %d subiterators for %v, got %d", n, d.Type, len(sub))
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"reflect"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &DistinctCount{}
+
+const (
+	// DefaultDistinctPrecision is the default precision of DistinctCount.
+	// It uses 16KB of memory and gives a standard error of about 0.8%.
+	DefaultDistinctPrecision = 14
+	// MinDistinctPrecision is the minimal precision of DistinctCount.
+	MinDistinctPrecision = 4
+	// MaxDistinctPrecision is the maximal precision of DistinctCount.
+	MaxDistinctPrecision = 18
+)
+
+// DistinctCount iterator returns one element with an estimated number of distinct
+// values of underlying iterator.
+//
+// Values are not materialized; instead, their keys are added to a HyperLogLog sketch
+// with 2^precision registers. Standard error of the estimation is about 1.04/sqrt(2^precision).
+type DistinctCount struct {
+	uid       uint64
+	it        graph.Iterator
+	precision uint8
+	done      bool
+	tags      graph.Tagger
+	result    quad.Value
+	qs        graph.QuadStore
+}
+
+// NewDistinctCount creates a new iterator to estimate a number of distinct results of
+// a provided subiterator. Precision is clamped to [MinDistinctPrecision, MaxDistinctPrecision].
+// qs may be nil - it's used to check if count Contains (is) a given value.
+func NewDistinctCount(it graph.Iterator, qs graph.QuadStore, precision int) *DistinctCount {
+	if precision < MinDistinctPrecision {
+		precision = MinDistinctPrecision
+	} else if precision > MaxDistinctPrecision {
+		precision = MaxDistinctPrecision
+	}
+	return &DistinctCount{
+		uid: NextUID(),
+		it:  it, qs: qs,
+		precision: uint8(precision),
+	}
+}
+
+func (it *DistinctCount) UID() uint64 {
+	return it.uid
+}
+
+// Precision returns a precision of the HyperLogLog sketch used by the iterator.
+func (it *DistinctCount) Precision() int {
+	return int(it.precision)
+}
+
+// Reset resets the internal iterators and the iterator itself.
+func (it *DistinctCount) Reset() {
+	it.done = false
+	it.result = nil
+	it.it.Reset()
+}
+
+func (it *DistinctCount) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *DistinctCount) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *DistinctCount) Clone() graph.Iterator {
+	it2 := NewDistinctCount(it.it.Clone(), it.qs, int(it.precision))
+	it2.Tagger().CopyFrom(it)
+	return it2
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *DistinctCount) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.it}
+}
+
+// Next estimates a number of distinct results in underlying iterator.
+func (it *DistinctCount) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	h := newHyperLogLog(it.precision)
+	for it.it.Next(ctx) {
+		h.Add(it.it.Result())
+	}
+	if it.it.Err() != nil {
+		return false
+	}
+	it.result = quad.Int(h.Count())
+	it.done = true
+	return true
+}
+
+func (it *DistinctCount) Err() error {
+	return it.it.Err()
+}
+
+func (it *DistinctCount) Result() graph.Value {
+	if it.result == nil {
+		return nil
+	}
+	return graph.PreFetched(it.result)
+}
+
+func (it *DistinctCount) Contains(ctx context.Context, val graph.Value) bool {
+	if !it.done {
+		it.Next(ctx)
+	}
+	if v, ok := val.(graph.PreFetchedValue); ok {
+		return v.NameOf() == it.result
+	}
+	if it.qs != nil {
+		return it.qs.NameOf(val) == it.result
+	}
+	return false
+}
+
+func (it *DistinctCount) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *DistinctCount) Close() error {
+	return it.it.Close()
+}
+
+func (it *DistinctCount) Type() graph.Type { return graph.DistinctCount }
+
+func (it *DistinctCount) Optimize() (graph.Iterator, bool) {
+	sub, optimized := it.it.Optimize()
+	it.it = sub
+	return it, optimized
+}
+
+func (it *DistinctCount) Stats() graph.IteratorStats {
+	sub := it.it.Stats()
+	stats := graph.IteratorStats{
+		NextCost:  sub.NextCost * sub.Size,
+		Size:      1,
+		ExactSize: true,
+	}
+	stats.ContainsCost = stats.NextCost
+	return stats
+}
+
+func (it *DistinctCount) Size() (int64, bool) {
+	return 1, true
+}
+
+func (it *DistinctCount) String() string {
+	return fmt.Sprintf("DistinctCount(%d)", it.precision)
+}
+
+// hyperLogLog is a HyperLogLog sketch for graph values.
+type hyperLogLog struct {
+	p    uint8
+	regs []uint8
+	h    hash.Hash64
+	num  [9]byte
+	sum  [quad.HashSize]byte
+	ids  map[interface{}]uint64 // sequential ids of keys that cannot be hashed by their contents
+}
+
+func newHyperLogLog(p uint8) *hyperLogLog {
+	return &hyperLogLog{p: p, regs: make([]uint8, 1<<p), h: fnv.New64a()}
+}
+
+// Kinds of hashed keys. A kind is written before the key, thus keys of different
+// kinds with the same binary representation get different hashes.
+const (
+	hllKeyInt = byte(iota)
+	hllKeyBytes
+	hllKeyID
+)
+
+func (s *hyperLogLog) writeUint(kind byte, v uint64) {
+	s.num[0] = kind
+	binary.LittleEndian.PutUint64(s.num[1:], v)
+	s.h.Write(s.num[:])
+}
+
+func (s *hyperLogLog) writeBytes(p []byte) {
+	s.num[0] = hllKeyBytes
+	s.h.Write(s.num[:1])
+	s.h.Write(p)
+}
+
+// hash returns a 64 bit hash of the value key.
+//
+// Integer, string and hash keys, as well as quad values, are hashed by their contents.
+// Other keys are assigned a sequential id on the first occurrence, which is hashed instead.
+func (s *hyperLogLog) hash(v graph.Value) uint64 {
+	s.h.Reset()
+	switch k := graph.ToKey(v).(type) {
+	case uint64:
+		s.writeUint(hllKeyInt, k)
+	case int64:
+		s.writeUint(hllKeyInt, uint64(k))
+	case Int64Node:
+		s.writeUint(hllKeyInt, uint64(k))
+	case Int64Quad:
+		s.writeUint(hllKeyInt, uint64(k))
+	case string:
+		s.writeBytes([]byte(k))
+	case graph.ValueHash:
+		s.writeBytes(k[:])
+	case graph.QuadHash:
+		for _, h := range k.Dirs() {
+			s.writeBytes(h[:])
+		}
+	case quad.Value:
+		quad.HashTo(k, s.sum[:])
+		s.writeBytes(s.sum[:])
+	default:
+		s.hashOther(k)
+	}
+	// FNV doesn't mix low bits well; apply a 64 bit finalizer from MurmurHash3
+	x := s.h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// hashOther writes a key of a type unknown to the sketch. Keys with integer or string
+// kinds are written by their contents, others by their sequential ids.
+func (s *hyperLogLog) hashOther(k interface{}) {
+	rv := reflect.ValueOf(k)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.writeUint(hllKeyInt, uint64(rv.Int()))
+		return
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.writeUint(hllKeyInt, rv.Uint())
+		return
+	case reflect.String:
+		s.writeBytes([]byte(rv.String()))
+		return
+	}
+	id, ok := s.ids[k]
+	if !ok {
+		if s.ids == nil {
+			s.ids = make(map[interface{}]uint64)
+		}
+		id = uint64(len(s.ids))
+		s.ids[k] = id
+	}
+	s.writeUint(hllKeyID, id)
+}
+
+// Add adds a value to the sketch.
+func (s *hyperLogLog) Add(v graph.Value) {
+	x := s.hash(v)
+	i := x >> (64 - s.p)
+	// rank of the first set bit in the rest of the hash; sentinel bit limits it
+	r := uint8(bits.LeadingZeros64(x<<s.p|1<<(s.p-1))) + 1
+	if r > s.regs[i] {
+		s.regs[i] = r
+	}
+}
+
+// Count returns an estimated number of distinct values added to the sketch.
+func (s *hyperLogLog) Count() int64 {
+	m := float64(len(s.regs))
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, r := range s.regs {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	var alpha float64
+	switch len(s.regs) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros != 0 {
+		// small range correction
+		est = m * math.Log(m/float64(zeros))
+	}
+	return int64(est + 0.5)
+}
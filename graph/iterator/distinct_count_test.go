@@ -0,0 +1,90 @@
+package iterator
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistinctCount(t *testing.T) {
+	ctx := context.TODO()
+	fixed := NewFixed(
+		graph.PreFetched(quad.String("a")),
+		graph.PreFetched(quad.String("b")),
+		graph.PreFetched(quad.String("a")),
+		graph.PreFetched(quad.String("c")),
+		graph.PreFetched(quad.String("b")),
+	)
+	it := NewDistinctCount(fixed, nil, DefaultDistinctPrecision)
+	require.True(t, it.Next(ctx))
+	require.Equal(t, graph.PreFetched(quad.Int(3)), it.Result())
+	require.False(t, it.Next(ctx))
+	require.True(t, it.Contains(ctx, graph.PreFetched(quad.Int(3))))
+	require.False(t, it.Contains(ctx, graph.PreFetched(quad.Int(5))))
+
+	it.Reset()
+	it.Tagger().Add("count")
+	require.True(t, it.Next(ctx))
+	m := make(map[string]graph.Value)
+	it.TagResults(m)
+	require.Equal(t, map[string]graph.Value{"count": graph.PreFetched(quad.Int(3))}, m)
+}
+
+func TestDistinctCountEstimate(t *testing.T) {
+	ctx := context.TODO()
+	const n = 100000
+	for _, p := range []int{10, DefaultDistinctPrecision} {
+		// each value is returned twice
+		it := NewDistinctCount(NewOr(NewInt64(1, n, true), NewInt64(1, n, true)), nil, p)
+		require.True(t, it.Next(ctx))
+		got := int64(it.Result().(graph.PreFetchedValue).NameOf().(quad.Int))
+		// allow 3 standard errors
+		maxErr := 3 * 1.04 / math.Sqrt(float64(int(1)<<uint(p)))
+		if e := math.Abs(float64(got-n)) / n; e > maxErr {
+			t.Errorf("precision %d: estimation error is too large: %d vs %d (%.3f > %.3f)", p, got, n, e, maxErr)
+		}
+	}
+}
+
+type distinctKey struct {
+	a, b int
+}
+
+type distinctValue distinctKey
+
+func (v distinctValue) Key() interface{} { return distinctKey(v) }
+
+func TestDistinctCountKeys(t *testing.T) {
+	ctx := context.TODO()
+	for _, c := range []struct {
+		name string
+		vals []graph.Value
+	}{
+		{"hashes", []graph.Value{
+			graph.ValueHash{1}, graph.ValueHash{2}, graph.ValueHash{1},
+		}},
+		{"structs", []graph.Value{
+			distinctValue{1, 2}, distinctValue{2, 1}, distinctValue{1, 2},
+		}},
+		{"mixed", []graph.Value{
+			Int64Node(1), graph.PreFetched(quad.Int(1)), Int64Node(1),
+		}},
+	} {
+		it := NewDistinctCount(NewFixed(c.vals...), nil, DefaultDistinctPrecision)
+		require.True(t, it.Next(ctx), c.name)
+		require.Equal(t, graph.PreFetched(quad.Int(2)), it.Result(), c.name)
+	}
+}
+
+func TestDistinctCountPrecision(t *testing.T) {
+	require.Equal(t, MinDistinctPrecision, NewDistinctCount(NewNull(), nil, 1).Precision())
+	require.Equal(t, MaxDistinctPrecision, NewDistinctCount(NewNull(), nil, 30).Precision())
+
+	it := NewDistinctCount(NewNull(), nil, 8)
+	require.True(t, it.Next(context.TODO()))
+	require.Equal(t, graph.PreFetched(quad.Int(0)), it.Result())
+}
@@ -0,0 +1,261 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &DistinctPairs{}
+
+// DistinctPairs iterator removes duplicate pairs of values bound to two tags by the
+// sub-iterator, regardless of their order. It is useful for symmetric relationships,
+// where each pair is found in both directions: (a, b) and (b, a) are returned only once.
+//
+// Pairs are canonicalized by ordering the keys of both values (see graph.ToKey).
+// Paths that do not bind both tags are skipped. If a result has multiple paths, only
+// the paths with pairs that were not seen before are returned.
+//
+// Seen pairs are accounted in the memory budget of the context (see graph.WithBudget).
+// If the budget is exceeded, iteration fails with graph.ErrBudgetExceeded.
+type DistinctPairs struct {
+	uid      uint64
+	tags     graph.Tagger
+	subIt    graph.Iterator
+	first    string
+	second   string
+	result   graph.Value
+	runstats graph.IteratorStats
+	err      error
+	seen     map[[2]interface{}]struct{}
+	budget   *graph.Budget
+	reserved int64
+}
+
+// NewDistinctPairs creates a new DistinctPairs iterator for pairs of values bound
+// to the given tags.
+func NewDistinctPairs(sub graph.Iterator, first, second string) *DistinctPairs {
+	return &DistinctPairs{
+		uid:    NextUID(),
+		subIt:  sub,
+		first:  first,
+		second: second,
+		seen:   make(map[[2]interface{}]struct{}),
+	}
+}
+
+func (it *DistinctPairs) UID() uint64 {
+	return it.uid
+}
+
+// PairTags returns the tags that bind the values of each pair.
+func (it *DistinctPairs) PairTags() (first, second string) {
+	return it.first, it.second
+}
+
+func (it *DistinctPairs) Reset() {
+	it.subIt.Reset()
+	it.result = nil
+	it.err = nil
+	it.seen = make(map[[2]interface{}]struct{})
+	it.release()
+}
+
+// release returns memory used by seen pairs to the budget.
+func (it *DistinctPairs) release() {
+	it.budget.Release(it.reserved)
+	it.budget, it.reserved = nil, 0
+}
+
+func (it *DistinctPairs) Close() error {
+	it.seen = nil
+	it.release()
+	return it.subIt.Close()
+}
+
+func (it *DistinctPairs) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *DistinctPairs) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+}
+
+func (it *DistinctPairs) Clone() graph.Iterator {
+	out := NewDistinctPairs(it.subIt.Clone(), it.first, it.second)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *DistinctPairs) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// pairKey returns a canonical key of the pair bound by the current path of the sub-iterator.
+func (it *DistinctPairs) pairKey() ([2]interface{}, bool) {
+	tags := make(map[string]graph.Value, 2)
+	it.subIt.TagResults(tags)
+	a, b := tags[it.first], tags[it.second]
+	if a == nil || b == nil {
+		return [2]interface{}{}, false
+	}
+	ka, kb := graph.ToKey(a), graph.ToKey(b)
+	if lessKey(kb, ka) {
+		ka, kb = kb, ka
+	}
+	return [2]interface{}{ka, kb}, true
+}
+
+// findPath moves the sub-iterator to the first path (starting from the current one)
+// with a pair that was not seen before, and marks the pair as seen.
+func (it *DistinctPairs) findPath(ctx context.Context) bool {
+	if it.budget == nil {
+		it.budget = graph.BudgetFromContext(ctx)
+	}
+	for {
+		if key, ok := it.pairKey(); ok {
+			if _, dup := it.seen[key]; !dup {
+				const sz = 2 * graph.AvgValueSize
+				if err := it.budget.Reserve(sz); err != nil {
+					it.err = err
+					it.seen = nil
+					it.release()
+					return false
+				}
+				it.reserved += sz
+				it.seen[key] = struct{}{}
+				return true
+			}
+		}
+		if !it.subIt.NextPath(ctx) {
+			it.err = it.subIt.Err()
+			return false
+		}
+	}
+}
+
+func (it *DistinctPairs) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.runstats.Next += 1
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	}
+	for it.subIt.Next(ctx) {
+		if it.findPath(ctx) {
+			it.result = it.subIt.Result()
+			return graph.NextLogOut(it, true)
+		} else if it.err != nil {
+			break
+		}
+	}
+	if it.err == nil {
+		it.err = it.subIt.Err()
+	}
+	it.result = nil
+	return graph.NextLogOut(it, false)
+}
+
+func (it *DistinctPairs) NextPath(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.subIt.NextPath(ctx) {
+		it.err = it.subIt.Err()
+		return false
+	}
+	return it.findPath(ctx)
+}
+
+// Contains checks if the value is a result of the sub-iterator with a pair that was
+// not seen before. The pair is marked as seen.
+func (it *DistinctPairs) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.runstats.Contains += 1
+	if it.err != nil {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if !it.findPath(ctx) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *DistinctPairs) Err() error {
+	return it.err
+}
+
+func (it *DistinctPairs) Result() graph.Value {
+	return it.result
+}
+
+func (it *DistinctPairs) Type() graph.Type { return graph.DistinctPairs }
+
+func (it *DistinctPairs) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
+	}
+	return it, false
+}
+
+// Stats assumes that a half of the pairs are duplicates, as in symmetric relationships.
+func (it *DistinctPairs) Stats() graph.IteratorStats {
+	st := it.subIt.Stats()
+	return graph.IteratorStats{
+		NextCost:     st.NextCost * uniquenessFactor,
+		ContainsCost: st.ContainsCost,
+		Size:         st.Size / uniquenessFactor,
+		ExactSize:    false,
+		Next:         it.runstats.Next,
+		Contains:     it.runstats.Contains,
+		ContainsNext: it.runstats.ContainsNext,
+	}
+}
+
+func (it *DistinctPairs) Size() (int64, bool) {
+	st := it.Stats()
+	return st.Size, st.ExactSize
+}
+
+func (it *DistinctPairs) String() string {
+	return fmt.Sprintf("DistinctPairs(%q, %q)", it.first, it.second)
+}
+
+// lessKey defines an arbitrary, but consistent order of value keys. Keys of different
+// types are ordered by the name of the type.
+func lessKey(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return a < b
+		}
+	case uint64:
+		if b, ok := b.(uint64); ok {
+			return a < b
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return a < b
+		}
+	case Int64Node:
+		if b, ok := b.(Int64Node); ok {
+			return a < b
+		}
+	}
+	ta, tb := fmt.Sprintf("%T", a), fmt.Sprintf("%T", b)
+	if ta != tb {
+		return ta < tb
+	}
+	return fmt.Sprintf("%#v", a) < fmt.Sprintf("%#v", b)
+}
@@ -0,0 +1,90 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestDistinctPairs(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{Data: []quad.Quad{
+		quad.MakeIRI("alice", "friend", "bob", ""),
+		quad.MakeIRI("bob", "friend", "alice", ""),
+		quad.MakeIRI("alice", "friend", "carol", ""),
+		quad.MakeIRI("carol", "friend", "alice", ""),
+		quad.MakeIRI("bob", "friend", "dave", ""),
+		quad.MakeIRI("dave", "knows", "bob", ""),
+	}}
+	val := func(s string) graph.Value { return graph.PreFetched(quad.IRI(s)) }
+	nodes := func(tag string) graph.Iterator {
+		it := NewFixed(val("alice"), val("bob"), val("carol"), val("dave"))
+		it.Tagger().Add(tag)
+		return it
+	}
+	// all friendship quads with subject and object tagged
+	newIt := func() graph.Iterator {
+		return NewAnd(qs,
+			NewLinksTo(qs, NewFixed(val("friend")), quad.Predicate),
+			NewLinksTo(qs, nodes("a"), quad.Subject),
+			NewLinksTo(qs, nodes("b"), quad.Object),
+		)
+	}
+	collect := func(it graph.Iterator) []string {
+		var out []string
+		for it.Next(ctx) {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			out = append(out, quad.StringOf(qs.NameOf(tags["a"]))+"-"+quad.StringOf(qs.NameOf(tags["b"])))
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	// canonical orders values of each pair, to compare results regardless
+	// of which direction of each pair was returned first
+	canonical := func(pairs []string) []string {
+		out := make([]string, 0, len(pairs))
+		for _, p := range pairs {
+			vals := strings.Split(p, "-")
+			sort.Strings(vals)
+			out = append(out, strings.Join(vals, "-"))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	if got := collect(newIt()); len(got) != 5 {
+		t.Fatalf("unexpected results of the sub-iterator: %v", got)
+	}
+	it := NewDistinctPairs(newIt(), "a", "b")
+	expect := []string{"<alice>-<bob>", "<alice>-<carol>", "<bob>-<dave>"}
+	got := collect(it)
+	if !reflect.DeepEqual(canonical(got), expect) {
+		t.Errorf("unexpected results: %v", got)
+	}
+	it.Reset()
+	if got2 := collect(it); !reflect.DeepEqual(got2, got) {
+		t.Errorf("unexpected results after reset: %v vs %v", got2, got)
+	}
+
+	// pairs of the same node are not collapsed with other pairs
+	it = NewDistinctPairs(newIt(), "a", "a")
+	if got := collect(it); len(got) != 3 {
+		t.Errorf("unexpected results for the same tag: %v", got)
+	}
+
+	// results without one of the tags are skipped
+	it = NewDistinctPairs(newIt(), "a", "c")
+	if got := collect(it); len(got) != 0 {
+		t.Errorf("expected no results, got: %v", got)
+	}
+}
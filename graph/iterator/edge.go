@@ -0,0 +1,162 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Edge{}
+
+// Edge iterator returns the quads of the sub-iterator, and binds both endpoints of
+// each quad to tags: the subject to one tag and the object to the other. It saves
+// composing two HasA iterators over the same quads to recover both endpoints.
+//
+// The sub-iterator is usually a quad iterator of the store, for example:
+//
+//	NewEdge(qs, qs.QuadIterator(quad.Predicate, pred), "from", "to")
+//
+// An empty tag name disables binding of the corresponding endpoint.
+type Edge struct {
+	uid        uint64
+	tags       graph.Tagger
+	qs         graph.QuadStore
+	subIt      graph.Iterator
+	subjectTag string
+	objectTag  string
+	result     graph.Value
+	runstats   graph.IteratorStats
+	err        error
+}
+
+// NewEdge creates a new Edge iterator over quads of the sub-iterator, that binds
+// subjects and objects of quads to given tags.
+func NewEdge(qs graph.QuadStore, sub graph.Iterator, subjectTag, objectTag string) *Edge {
+	return &Edge{
+		uid:        NextUID(),
+		qs:         qs,
+		subIt:      sub,
+		subjectTag: subjectTag,
+		objectTag:  objectTag,
+	}
+}
+
+func (it *Edge) UID() uint64 {
+	return it.uid
+}
+
+// EndpointTags returns the tags that bind the subject and the object of each quad.
+func (it *Edge) EndpointTags() (subject, object string) {
+	return it.subjectTag, it.objectTag
+}
+
+func (it *Edge) Reset() {
+	it.subIt.Reset()
+	it.result = nil
+	it.err = nil
+}
+
+func (it *Edge) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *Edge) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults binds the endpoints of the current quad. Endpoints are only looked up
+// when the results are tagged, thus iteration alone costs the same as the sub-iterator.
+func (it *Edge) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+	if it.result == nil {
+		return
+	}
+	if it.subjectTag != "" {
+		dst[it.subjectTag] = it.qs.QuadDirection(it.result, quad.Subject)
+	}
+	if it.objectTag != "" {
+		dst[it.objectTag] = it.qs.QuadDirection(it.result, quad.Object)
+	}
+}
+
+func (it *Edge) Clone() graph.Iterator {
+	out := NewEdge(it.qs, it.subIt.Clone(), it.subjectTag, it.objectTag)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Edge) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Edge) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.runstats.Next += 1
+	if it.subIt.Next(ctx) {
+		it.result = it.subIt.Result()
+		return graph.NextLogOut(it, true)
+	}
+	it.err = it.subIt.Err()
+	it.result = nil
+	return graph.NextLogOut(it, false)
+}
+
+func (it *Edge) NextPath(ctx context.Context) bool {
+	if !it.subIt.NextPath(ctx) {
+		it.err = it.subIt.Err()
+		return false
+	}
+	return true
+}
+
+func (it *Edge) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.runstats.Contains += 1
+	if !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *Edge) Err() error {
+	return it.err
+}
+
+func (it *Edge) Result() graph.Value {
+	return it.result
+}
+
+func (it *Edge) Type() graph.Type { return graph.Edge }
+
+func (it *Edge) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
+	}
+	return it, false
+}
+
+// Stats returns the stats of the sub-iterator. Lookups of endpoints are not accounted for.
+func (it *Edge) Stats() graph.IteratorStats {
+	st := it.subIt.Stats()
+	st.Next = it.runstats.Next
+	st.Contains = it.runstats.Contains
+	return st
+}
+
+func (it *Edge) Size() (int64, bool) {
+	return it.subIt.Size()
+}
+
+func (it *Edge) String() string {
+	return fmt.Sprintf("Edge(%q, %q)", it.subjectTag, it.objectTag)
+}
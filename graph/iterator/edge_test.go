@@ -0,0 +1,93 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestEdge(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{Data: []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+		quad.MakeIRI("alice", "likes", "carol", ""),
+	}}
+	follows := graph.PreFetched(quad.IRI("follows"))
+	newIt := func(subject, object string) graph.Iterator {
+		return NewEdge(qs, qs.QuadIterator(quad.Predicate, follows), subject, object)
+	}
+	collect := func(it graph.Iterator) []string {
+		var out []string
+		for it.Next(ctx) {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			var s string
+			for _, tag := range []string{"from", "to"} {
+				if v, ok := tags[tag]; ok {
+					s += tag + "=" + quad.StringOf(qs.NameOf(v)) + " "
+				}
+			}
+			out = append(out, s+qs.Quad(it.Result()).String())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	it := newIt("from", "to")
+	expect := []string{
+		"from=<alice> to=<bob> <alice> -- <follows> -> <bob>",
+		"from=<bob> to=<carol> <bob> -- <follows> -> <carol>",
+	}
+	if got := collect(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results:\n%q\nvs\n%q", got, expect)
+	}
+	it.Reset()
+	if got := collect(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results after reset: %q", got)
+	}
+	if got := collect(it.Clone()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results of a clone: %q", got)
+	}
+
+	// an empty tag disables the binding
+	expect = []string{
+		"to=<bob> <alice> -- <follows> -> <bob>",
+		"to=<carol> <bob> -- <follows> -> <carol>",
+	}
+	if got := collect(newIt("", "to")); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results without a subject tag:\n%q\nvs\n%q", got, expect)
+	}
+
+	// endpoints are bound on Contains as well
+	it = newIt("from", "to")
+	quads := qs.QuadIterator(quad.Object, graph.PreFetched(quad.IRI("carol")))
+	var likes, bobFollows graph.Value
+	for quads.Next(ctx) {
+		if qs.Quad(quads.Result()).Predicate == quad.IRI("likes") {
+			likes = quads.Result()
+		} else {
+			bobFollows = quads.Result()
+		}
+	}
+	if it.Contains(ctx, likes) {
+		t.Error("unexpected quad with a different predicate")
+	}
+	if !it.Contains(ctx, bobFollows) {
+		t.Fatal("expected the quad to be contained")
+	}
+	tags := make(map[string]graph.Value)
+	it.TagResults(tags)
+	if from, to := quad.StringOf(qs.NameOf(tags["from"])), quad.StringOf(qs.NameOf(tags["to"])); from != "<bob>" || to != "<carol>" {
+		t.Errorf("unexpected tags on contains: %v, %v", from, to)
+	}
+}
@@ -0,0 +1,134 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Enumerate{}
+
+// Enumerate iterator returns results of the sub-iterator and tags each of them with
+// its zero-based position. The position is tagged as an integer value (quad.Int),
+// which can be rendered by any QuadStore.
+//
+// The position only advances on Next: all paths returned by NextPath for the same
+// result share its position. Results of Contains are not tagged, since their position
+// is unknown. The counter restarts from zero on Reset.
+type Enumerate struct {
+	uid      uint64
+	tags     graph.Tagger
+	subIt    graph.Iterator
+	tag      string
+	index    int64
+	contains bool // last result was produced by Contains
+}
+
+// NewEnumerate creates a new Enumerate iterator that tags positions of results with a given tag.
+func NewEnumerate(sub graph.Iterator, tag string) *Enumerate {
+	return &Enumerate{
+		uid:   NextUID(),
+		subIt: sub,
+		tag:   tag,
+		index: -1,
+	}
+}
+
+func (it *Enumerate) UID() uint64 {
+	return it.uid
+}
+
+// IndexTag returns the tag used for positions of results.
+func (it *Enumerate) IndexTag() string { return it.tag }
+
+// Reset resets the internal iterators and the position counter.
+func (it *Enumerate) Reset() {
+	it.index = -1
+	it.contains = false
+	it.subIt.Reset()
+}
+
+func (it *Enumerate) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Enumerate) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+	if !it.contains && it.index >= 0 {
+		dst[it.tag] = graph.PreFetched(quad.Int(it.index))
+	}
+}
+
+func (it *Enumerate) Clone() graph.Iterator {
+	out := NewEnumerate(it.subIt.Clone(), it.tag)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Enumerate) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// Next advances the sub-iterator and the position counter.
+func (it *Enumerate) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.contains = false
+	if !it.subIt.Next(ctx) {
+		return graph.NextLogOut(it, false)
+	}
+	it.index++
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Enumerate) Err() error {
+	return it.subIt.Err()
+}
+
+func (it *Enumerate) Result() graph.Value {
+	return it.subIt.Result()
+}
+
+func (it *Enumerate) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.contains = true
+	return graph.ContainsLogOut(it, val, it.subIt.Contains(ctx, val))
+}
+
+// NextPath returns the next path of the current result. It doesn't change the position.
+func (it *Enumerate) NextPath(ctx context.Context) bool {
+	return it.subIt.NextPath(ctx)
+}
+
+func (it *Enumerate) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *Enumerate) Type() graph.Type { return graph.Enumerate }
+
+func (it *Enumerate) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		it.Close()
+		return NewNull(), true
+	}
+	return it, false
+}
+
+func (it *Enumerate) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *Enumerate) Size() (int64, bool) {
+	return it.subIt.Size()
+}
+
+func (it *Enumerate) String() string {
+	return fmt.Sprintf("Enumerate(%q)", it.tag)
+}
@@ -0,0 +1,85 @@
+package iterator_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestEnumerate(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{
+		Data: []quad.Quad{
+			quad.MakeRaw("a", "follows", "b", ""),
+			quad.MakeRaw("a", "follows", "c", ""),
+			quad.MakeRaw("d", "follows", "b", ""),
+		},
+	}
+	fixed := func(vals ...string) *Fixed {
+		it := NewFixed()
+		for _, v := range vals {
+			it.Add(graph.PreFetched(quad.Raw(v)))
+		}
+		return it
+	}
+	obj := fixed("b", "c")
+	obj.Tagger().Add("f")
+	sub := NewAnd(qs,
+		fixed("a", "d"),
+		NewHasA(qs, NewAnd(qs,
+			NewLinksTo(qs, fixed("follows"), quad.Predicate),
+			NewLinksTo(qs, obj, quad.Object),
+		), quad.Subject),
+	)
+	it := NewEnumerate(sub, "n")
+	defer it.Close()
+
+	var got []string
+	collect := func() {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		got = append(got, quad.ToString(qs.NameOf(it.Result()))+"-"+
+			quad.ToString(qs.NameOf(tags["f"]))+"-"+
+			fmt.Sprint(quad.NativeOf(qs.NameOf(tags["n"]))))
+	}
+	run := func() {
+		got = nil
+		for it.Next(ctx) {
+			collect()
+			for it.NextPath(ctx) {
+				collect()
+			}
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// all paths of a result share its position
+	expect := []string{"a-b-0", "a-c-0", "d-b-1"}
+	run()
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: %v vs %v", got, expect)
+	}
+
+	it.Reset()
+	run()
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results after reset: %v vs %v", got, expect)
+	}
+
+	// position of results of Contains is unknown
+	if !it.Contains(ctx, graph.PreFetched(quad.Raw("d"))) {
+		t.Fatal("expected the value to be found")
+	}
+	tags := make(map[string]graph.Value)
+	it.TagResults(tags)
+	if v, ok := tags["n"]; ok {
+		t.Errorf("unexpected position: %v", v)
+	}
+}
@@ -37,6 +37,7 @@ type Fixed struct {
 	values    []graph.Value
 	lastIndex int
 	result    graph.Value
+	interner  *Interner
 }
 
 // Creates a new Fixed iterator with a custom comparator.
@@ -75,6 +76,7 @@ func (it *Fixed) Clone() graph.Iterator {
 	vals := make([]graph.Value, len(it.values))
 	copy(vals, it.values)
 	out := NewFixed(vals...)
+	out.interner = it.interner
 	out.tags.CopyFrom(it)
 	return out
 }
@@ -82,7 +84,16 @@ func (it *Fixed) Clone() graph.Iterator {
 // Add a value to the iterator. The array now contains this value.
 // TODO(barakmich): This ought to be a set someday, disallowing repeated values.
 func (it *Fixed) Add(v graph.Value) {
-	it.values = append(it.values, v)
+	it.values = append(it.values, it.interner.Intern(v))
+}
+
+// SetInterner sets a pool of values used by the iterator. Values that are already stored
+// in the iterator, as well as values added later, are replaced with shared ones.
+func (it *Fixed) SetInterner(p *Interner) {
+	it.interner = p
+	for i, v := range it.values {
+		it.values[i] = p.Intern(v)
+	}
 }
 
 // Values returns a list of values stored in iterator. Slice should not be modified.
@@ -90,6 +101,17 @@ func (it *Fixed) Values() []graph.Value {
 	return it.values
 }
 
+// SetValues replaces all values stored in iterator and resets it.
+func (it *Fixed) SetValues(vals ...graph.Value) {
+	it.values = append(it.values[:0:0], vals...)
+	if it.interner != nil {
+		for i, v := range it.values {
+			it.values[i] = it.interner.Intern(v)
+		}
+	}
+	it.Reset()
+}
+
 func (it *Fixed) String() string {
 	return fmt.Sprintf("Fixed(%v)", it.values)
 }
@@ -146,7 +168,7 @@ func (it *Fixed) SubIterators() []graph.Iterator {
 // (so that other iterators upstream can treat this as null) or there is no
 // optimization.
 func (it *Fixed) Optimize() (graph.Iterator, bool) {
-	if len(it.values) == 1 && it.values[0] == nil {
+	if len(it.values) == 0 || (len(it.values) == 1 && it.values[0] == nil) {
 		return NewNull(), true
 	}
 
@@ -0,0 +1,161 @@
+package iterator
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var (
+	_ graph.Iterator = &Follow{}
+)
+
+// FollowStep is a single step of the Follow iterator.
+type FollowStep struct {
+	Morphism graph.ApplyMorphism
+	Tag      string // tag for results of the step; optional
+}
+
+// Follow iterator applies a sequence of morphisms to the sub-iterator, one after another,
+// and returns results of the last one. Results of each step are tagged with a tag of the step,
+// thus a path that leads to each result can be recovered, as in a multi-step Gremlin path.
+//
+// Morphisms are applied to iterators, not to individual values, thus the result is the same
+// as for a tree built by nesting the morphisms manually. If any step yields nothing, following
+// steps are not applied and the iterator is replaced with Null.
+type Follow struct {
+	uid   uint64
+	tags  graph.Tagger
+	qs    graph.QuadStore
+	subIt graph.Iterator
+	steps []FollowStep
+	it    graph.Iterator
+}
+
+// NewFollow creates an iterator that follows given steps starting from values of the sub-iterator.
+func NewFollow(qs graph.QuadStore, sub graph.Iterator, steps ...FollowStep) *Follow {
+	it := &Follow{
+		uid:   NextUID(),
+		qs:    qs,
+		steps: steps,
+	}
+	it.setSub(sub)
+	return it
+}
+
+// setSub applies all steps to a given sub-iterator.
+func (it *Follow) setSub(sub graph.Iterator) {
+	it.subIt = sub
+	cur := sub
+	for _, s := range it.steps {
+		if isEmpty(cur) {
+			it.it = NewNull()
+			return
+		}
+		cur = s.Morphism(it.qs, cur)
+		if s.Tag != "" {
+			cur.Tagger().Add(s.Tag)
+		}
+	}
+	if isEmpty(cur) {
+		cur = NewNull()
+	}
+	it.it = cur
+}
+
+// isEmpty reports if an iterator is known to yield nothing without iterating it.
+func isEmpty(it graph.Iterator) bool {
+	if it.Type() == graph.Null {
+		return true
+	}
+	n, exact := it.Size()
+	return exact && n == 0
+}
+
+func (it *Follow) UID() uint64 {
+	return it.uid
+}
+
+func (it *Follow) Reset() {
+	it.it.Reset()
+}
+
+func (it *Follow) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Follow) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.it.TagResults(dst)
+}
+
+func (it *Follow) Clone() graph.Iterator {
+	out := NewFollow(it.qs, it.subIt.Clone(), it.steps...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Follow) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Follow) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	return graph.NextLogOut(it, it.it.Next(ctx))
+}
+
+func (it *Follow) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	return graph.ContainsLogOut(it, val, it.it.Contains(ctx, val))
+}
+
+func (it *Follow) NextPath(ctx context.Context) bool {
+	return it.it.NextPath(ctx)
+}
+
+func (it *Follow) Err() error {
+	return it.it.Err()
+}
+
+func (it *Follow) Result() graph.Value {
+	return it.it.Result()
+}
+
+func (it *Follow) Close() error {
+	err := it.it.Close()
+	if err2 := it.subIt.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (it *Follow) Type() graph.Type { return graph.Follow }
+
+func (it *Follow) String() string {
+	return "Follow"
+}
+
+// Optimize optimizes the sub-iterator, applies the steps to it again and optimizes the result.
+// The iterator is replaced with Null, if any of the steps yields nothing.
+func (it *Follow) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.setSub(newSub)
+	}
+	if newIt, ok := it.it.Optimize(); ok {
+		it.it = newIt
+	}
+	if isEmpty(it.it) {
+		it.Close()
+		return NewNull(), true
+	}
+	return it, false
+}
+
+func (it *Follow) Size() (int64, bool) {
+	return it.it.Size()
+}
+
+func (it *Follow) Stats() graph.IteratorStats {
+	return it.it.Stats()
+}
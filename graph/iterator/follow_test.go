@@ -0,0 +1,102 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func followNames(t *testing.T, qs graph.QuadStore, it graph.Iterator, tags ...string) []string {
+	ctx := context.TODO()
+	var got []string
+	for it.Next(ctx) {
+		m := make(map[string]graph.Value)
+		it.TagResults(m)
+		s := ""
+		for _, tag := range tags {
+			v, ok := m[tag]
+			if !ok {
+				t.Fatalf("tag %q is not set: %v", tag, m)
+			}
+			s += quad.ToString(qs.NameOf(v)) + "/"
+		}
+		got = append(got, s+quad.ToString(qs.NameOf(it.Result())))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestFollow(t *testing.T) {
+	qs := rec_test_qs
+	start := NewFixed(graph.PreFetched(quad.Raw("alice")))
+	start.Tagger().Add("start")
+
+	it := NewFollow(qs, start,
+		FollowStep{Morphism: singleHop("parent"), Tag: "p1"},
+		FollowStep{Morphism: singleHop("parent"), Tag: "p2"},
+	)
+	got := followNames(t, qs, it, "start", "p1", "p2")
+	if exp := []string{"alice/bob/charlie/charlie"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected results of two steps: %v vs %v", got, exp)
+	}
+
+	it = NewFollow(qs, start.Clone(),
+		FollowStep{Morphism: singleHop("parent"), Tag: "p1"},
+		FollowStep{Morphism: singleHop("parent")},
+		FollowStep{Morphism: singleHop("parent"), Tag: "p3"},
+	)
+	it.Tagger().Add("res")
+	got = followNames(t, qs, it, "start", "p1", "p3", "res")
+	exp := []string{"alice/bob/bob/bob/bob", "alice/bob/dani/dani/dani"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected results of three steps: %v vs %v", got, exp)
+	}
+
+	ctx := context.TODO()
+	c := it.Clone()
+	if !c.Contains(ctx, graph.PreFetched(quad.Raw("dani"))) {
+		t.Error("expected a result of the last step to be found")
+	}
+	if c.Contains(ctx, graph.PreFetched(quad.Raw("charlie"))) {
+		t.Error("expected a result of the intermediate step to be rejected")
+	}
+}
+
+func TestFollowEmptyStep(t *testing.T) {
+	qs := rec_test_qs
+	applied := 0
+	count := func(m graph.ApplyMorphism) graph.ApplyMorphism {
+		return func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+			applied++
+			return m(qs, it)
+		}
+	}
+	start := NewFixed(graph.PreFetched(quad.Raw("alice")))
+	it := NewFollow(qs, start,
+		FollowStep{Morphism: count(singleHop("parent"))},
+		FollowStep{Morphism: count(func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+			return NewNull()
+		})},
+		FollowStep{Morphism: count(singleHop("parent"))},
+	)
+	if applied != 2 {
+		t.Errorf("expected steps after an empty one to be skipped, applied: %d", applied)
+	}
+	if it.Next(context.TODO()) {
+		t.Error("expected no results")
+	}
+	if n, exact := it.Size(); n != 0 || !exact {
+		t.Errorf("unexpected size: %d, %v", n, exact)
+	}
+	if nit, ok := it.Optimize(); !ok || nit.Type() != graph.Null {
+		t.Errorf("expected an iterator to be replaced with Null, got: %v", nit.Type())
+	}
+}
@@ -56,6 +56,7 @@ type HasA struct {
 	resultIt  graph.Iterator
 	result    graph.Value
 	runstats  graph.IteratorStats
+	io        graph.IOStats
 	err       error
 }
 
@@ -74,6 +75,17 @@ func (it *HasA) UID() uint64 {
 	return it.uid
 }
 
+var _ graph.IOStater = &HasA{}
+
+// IOStats implements graph.IOStater. It returns reads of the quad iterators created by Contains.
+func (it *HasA) IOStats() graph.IOStats {
+	st := it.io
+	if it.resultIt != nil {
+		st.Add(graph.TotalIOStats(it.resultIt))
+	}
+	return st
+}
+
 // Return our sole subiterator.
 func (it *HasA) SubIterators() []graph.Iterator {
 	return []graph.Iterator{it.primaryIt}
@@ -82,8 +94,10 @@ func (it *HasA) SubIterators() []graph.Iterator {
 func (it *HasA) Reset() {
 	it.primaryIt.Reset()
 	if it.resultIt != nil {
-		it.resultIt.Close()
+		closeInternal(&it.io, it.resultIt)
+		it.resultIt = nil
 	}
+	it.err = nil
 }
 
 func (it *HasA) Tagger() *graph.Tagger {
@@ -105,9 +119,9 @@ func (it *HasA) Optimize() (graph.Iterator, bool) {
 	newPrimary, changed := it.primaryIt.Optimize()
 	if changed {
 		it.primaryIt = newPrimary
-		if it.primaryIt.Type() == graph.Null {
-			return it.primaryIt, true
-		}
+	}
+	if it.primaryIt.Type() == graph.Null {
+		return it.primaryIt, true
 	}
 	// Ask the graph.QuadStore if we can be replaced. Often times, this is a great
 	// optimization opportunity (there's a fixed iterator underneath us, for
@@ -117,6 +131,10 @@ func (it *HasA) Optimize() (graph.Iterator, bool) {
 		it.Close()
 		return newReplacement, true
 	}
+	if out := pushdown(it.qs, it); out != nil {
+		it.Close()
+		return out, true
+	}
 	return it, false
 }
 
@@ -137,12 +155,15 @@ func (it *HasA) String() string {
 func (it *HasA) Contains(ctx context.Context, val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
 	it.runstats.Contains += 1
+	if it.err != nil {
+		return graph.ContainsLogOut(it, val, false)
+	}
 	if clog.V(4) {
 		clog.Infof("Id is %v", it.qs.NameOf(val))
 	}
 	// TODO(barakmich): Optimize this
 	if it.resultIt != nil {
-		it.resultIt.Close()
+		closeInternal(&it.io, it.resultIt)
 	}
 	it.resultIt = it.qs.QuadIterator(it.dir, val)
 	ok := it.NextContains(ctx)
@@ -168,13 +189,33 @@ func (it *HasA) NextContains(ctx context.Context) bool {
 		if it.primaryIt.Contains(ctx, link) {
 			it.result = it.qs.QuadDirection(link, it.dir)
 			return true
+		} else if it.setErr(it.primaryIt.Err()) {
+			return false
 		}
 	}
-	it.err = it.resultIt.Err()
+	it.setErr(it.resultIt.Err())
 	return false
 }
 
+// setErr records the first error of the subiterator or the result iterator. Both of them
+// are closed right away to release their resources, instead of waiting for an explicit Close.
+// It returns false if there is no error.
+func (it *HasA) setErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if it.err == nil {
+		it.err = err
+		it.Close()
+	}
+	return true
+}
+
 // Get the next result that matches this branch.
+//
+// Alternative paths of the current quad are exhausted first, and only then the
+// iterator moves to the next quad of the group opened by the last Contains.
+// After Next, the only alternative paths are the ones of the primary iterator.
 func (it *HasA) NextPath(ctx context.Context) bool {
 	// Order here is important. If the subiterator has a NextPath, then we
 	// need do nothing -- there is a next result, and we shouldn't move forward.
@@ -187,9 +228,7 @@ func (it *HasA) NextPath(ctx context.Context) bool {
 	}
 	if it.primaryIt.NextPath(ctx) {
 		return true
-	}
-	it.err = it.primaryIt.Err()
-	if it.err != nil {
+	} else if it.setErr(it.primaryIt.Err()) {
 		return false
 	}
 
@@ -209,12 +248,17 @@ func (it *HasA) NextPath(ctx context.Context) bool {
 func (it *HasA) Next(ctx context.Context) bool {
 	graph.NextLogIn(it)
 	it.runstats.Next += 1
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	}
+	// Quads from the last Contains are not alternative paths for results of Next.
 	if it.resultIt != nil {
-		it.resultIt.Close()
+		closeInternal(&it.io, it.resultIt)
+		it.resultIt = nil
 	}
 
 	if !it.primaryIt.Next(ctx) {
-		it.err = it.primaryIt.Err()
+		it.setErr(it.primaryIt.Err())
 		return graph.NextLogOut(it, false)
 	}
 	tID := it.primaryIt.Result()
@@ -262,10 +306,11 @@ func (it *HasA) Close() error {
 	err := it.primaryIt.Close()
 
 	if it.resultIt != nil {
-		_err := it.resultIt.Close()
+		_err := closeInternal(&it.io, it.resultIt)
 		if err == nil {
 			err = _err
 		}
+		it.resultIt = nil
 	}
 
 	return err
@@ -17,8 +17,11 @@ package iterator_test
 import (
 	"context"
 	"errors"
+	"sort"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
 	. "github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/quad"
 )
@@ -26,7 +29,7 @@ import (
 func TestHasAIteratorErr(t *testing.T) {
 	wantErr := errors.New("unique")
 	ctx := context.TODO()
-	errIt := newTestIterator(false, wantErr)
+	errIt := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	// TODO(andrew-d): pass a non-nil quadstore
 	hasa := NewHasA(nil, errIt, quad.Subject)
@@ -38,3 +41,64 @@ func TestHasAIteratorErr(t *testing.T) {
 		t.Errorf("HasA iterator did not pass through underlying Err")
 	}
 }
+
+func TestHasAIteratorNextPath(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{
+		Data: []quad.Quad{
+			quad.MakeRaw("a", "follows", "b", ""),
+			quad.MakeRaw("a", "follows", "c", ""),
+			quad.MakeRaw("a", "likes", "x", ""),
+			quad.MakeRaw("a", "likes", "y", ""),
+			quad.MakeRaw("a", "likes", "z", ""),
+			quad.MakeRaw("d", "follows", "b", ""),
+		},
+	}
+	fixed := func(vals ...string) *Fixed {
+		it := NewFixed()
+		for _, v := range vals {
+			it.Add(graph.PreFetched(quad.Raw(v)))
+		}
+		return it
+	}
+	// subjects that have a given predicate, with objects tagged
+	subjects := func(pred, tag string, objs ...string) graph.Iterator {
+		obj := fixed(objs...)
+		obj.Tagger().Add(tag)
+		return NewHasA(qs, NewAnd(qs,
+			NewLinksTo(qs, fixed(pred), quad.Predicate),
+			NewLinksTo(qs, obj, quad.Object),
+		), quad.Subject)
+	}
+
+	it := NewAnd(qs,
+		fixed("a", "d"),
+		subjects("follows", "f", "b", "c"),
+		subjects("likes", "l", "x", "y", "z"),
+	)
+	var got []string
+	collect := func() {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		got = append(got, quad.ToString(qs.NameOf(tags["f"]))+"-"+quad.ToString(qs.NameOf(tags["l"])))
+	}
+	for it.Next(ctx) {
+		collect()
+		for it.NextPath(ctx) {
+			collect()
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	expect := []string{"b-x", "b-y", "b-z", "c-x", "c-y", "c-z"}
+	if len(got) != len(expect) {
+		t.Fatalf("unexpected combinations: %v", got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Fatalf("unexpected combinations: %v", got)
+		}
+	}
+}
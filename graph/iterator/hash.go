@@ -0,0 +1,88 @@
+package iterator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sort"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// TreeHash returns a structural hash of the iterator tree.
+//
+// The hash includes types, tags, fixed values, directions and other parameters
+// of each iterator, as well as hashes of all subiterators, but not their UIDs or
+// runtime state. Thus two trees built in the same way will hash equally, and
+// it can be used as a cache key for query plans.
+func TreeHash(it graph.Iterator) uint64 {
+	h := fnv.New64a()
+	hashTree(h, it)
+	return h.Sum64()
+}
+
+func hashString(h hash.Hash64, s string) {
+	h.Write([]byte(s))
+	h.Write([]byte{0})
+}
+
+func hashTree(h hash.Hash64, it graph.Iterator) {
+	hashString(h, it.Type().String())
+	hashString(h, it.String())
+
+	tg := it.Tagger()
+	tags := append([]string{}, tg.Tags()...)
+	sort.Strings(tags)
+	for _, tag := range tags {
+		hashString(h, tag)
+	}
+	fixed := tg.Fixed()
+	names := make([]string, 0, len(fixed))
+	for tag := range fixed {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	for _, tag := range names {
+		hashString(h, tag)
+		hashValue(h, fixed[tag])
+	}
+
+	switch it := it.(type) {
+	case *Fixed:
+		for _, v := range it.Values() {
+			hashValue(h, v)
+		}
+	case *HasA:
+		hashString(h, it.Direction().String())
+	case *LinksTo:
+		hashString(h, it.Direction().String())
+	}
+
+	subs := it.SubIterators()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(len(subs)))
+	h.Write(buf[:])
+	for _, sub := range subs {
+		binary.LittleEndian.PutUint64(buf[:], TreeHash(sub))
+		h.Write(buf[:])
+	}
+}
+
+func hashValue(h hash.Hash64, v graph.Value) {
+	if v == nil {
+		hashString(h, "<nil>")
+		return
+	}
+	if pv, ok := v.(graph.PreFetchedValue); ok {
+		if qv := pv.NameOf(); qv != nil {
+			hashString(h, fmt.Sprintf("%T", qv))
+			hashString(h, quad.StringOf(qv))
+			return
+		}
+	}
+	k := graph.ToKey(v)
+	hashString(h, fmt.Sprintf("%T", k))
+	hashString(h, fmt.Sprintf("%v", k))
+}
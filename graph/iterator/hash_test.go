@@ -0,0 +1,42 @@
+package iterator_test
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestTreeHash(t *testing.T) {
+	links := func(tag string, d quad.Direction, vals ...graph.Value) graph.Iterator {
+		fixed := NewFixed(vals...)
+		fixed.Tagger().Add(tag)
+		return NewLinksTo(nil, fixed, d)
+	}
+	build := func(tag string, d quad.Direction, vals ...graph.Value) graph.Iterator {
+		return NewAnd(nil, NewInt64(1, 10, false), links(tag, d, vals...))
+	}
+	base := build("a", quad.Subject, Int64Node(1), Int64Node(2))
+	if h1, h2 := TreeHash(base), TreeHash(build("a", quad.Subject, Int64Node(1), Int64Node(2))); h1 != h2 {
+		t.Fatalf("structurally identical trees hash differently: %x vs %x", h1, h2)
+	}
+	if h1, h2 := TreeHash(base), TreeHash(base.Clone()); h1 != h2 {
+		t.Fatalf("clone hashes differently: %x vs %x", h1, h2)
+	}
+	for _, c := range []struct {
+		name string
+		it   graph.Iterator
+	}{
+		{"tag", build("b", quad.Subject, Int64Node(1), Int64Node(2))},
+		{"direction", build("a", quad.Object, Int64Node(1), Int64Node(2))},
+		{"values", build("a", quad.Subject, Int64Node(1), Int64Node(3))},
+		{"value types", build("a", quad.Subject, Int64Quad(1), Int64Quad(2))},
+		{"limit", NewLimit(base.Clone(), 5)},
+		{"order", NewAnd(nil, links("a", quad.Subject, Int64Node(1), Int64Node(2)), NewInt64(1, 10, false))},
+	} {
+		if TreeHash(base) == TreeHash(c.it) {
+			t.Errorf("different %s, but hashes are equal", c.name)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package iterator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// Interner is a pool of values that allows identical values (with the same graph.ToKey)
+// to share a single representation. It reduces the memory used by iterators that hold
+// a lot of repeated values, like Fixed and Materialize.
+//
+// Values are never removed from the pool, thus it should be scoped to a single query.
+// A nil Interner is valid and returns values as-is.
+type Interner struct {
+	mu   sync.Mutex
+	vals map[interface{}]graph.Value
+}
+
+// NewInterner creates a new empty pool of values.
+func NewInterner() *Interner {
+	return &Interner{vals: make(map[interface{}]graph.Value)}
+}
+
+// Intern returns a shared representation of the value. The value is added to the pool
+// if it was not seen before.
+func (p *Interner) Intern(v graph.Value) graph.Value {
+	if p == nil || v == nil {
+		return v
+	}
+	k := graph.ToKey(v)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if x, ok := p.vals[k]; ok {
+		return x
+	}
+	p.vals[k] = v
+	return v
+}
+
+// Len returns the number of distinct values in the pool.
+func (p *Interner) Len() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.vals)
+}
+
+type internerKey struct{}
+
+// WithInterner returns a context that carries a pool of values for a query.
+// Iterators that materialize values will use it to intern them.
+func WithInterner(ctx context.Context, p *Interner) context.Context {
+	return context.WithValue(ctx, internerKey{}, p)
+}
+
+// InternerFromContext returns a pool of values associated with the context, or nil.
+func InternerFromContext(ctx context.Context) *Interner {
+	p, _ := ctx.Value(internerKey{}).(*Interner)
+	return p
+}
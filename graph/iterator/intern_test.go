@@ -0,0 +1,121 @@
+package iterator_test
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// boxedValue is a value that is compared by pointer, unlike its key.
+type boxedValue struct {
+	name string
+}
+
+func (v *boxedValue) Key() interface{} { return v.name }
+
+func boxedValues(n, distinct int) []graph.Value {
+	vals := make([]graph.Value, n)
+	for i := range vals {
+		vals[i] = &boxedValue{name: strconv.Itoa(i % distinct)}
+	}
+	return vals
+}
+
+func TestInterner(t *testing.T) {
+	var p *Interner
+	v := &boxedValue{name: "a"}
+	if p.Intern(v) != graph.Value(v) || p.Len() != 0 {
+		t.Fatal("nil pool should return values as-is")
+	}
+
+	p = NewInterner()
+	fixed := NewFixed(boxedValues(10, 3)...)
+	fixed.SetInterner(p)
+	fixed.Add(&boxedValue{name: "1"})
+	if p.Len() != 3 {
+		t.Errorf("unexpected number of interned values: %d", p.Len())
+	}
+	first := make(map[string]graph.Value)
+	for _, v := range fixed.Values() {
+		k := v.(*boxedValue).name
+		if f, ok := first[k]; !ok {
+			first[k] = v
+		} else if f != v {
+			t.Errorf("value %q is not shared", k)
+		}
+	}
+
+	// pool from the context is shared with materialized values
+	ctx := WithInterner(context.TODO(), p)
+	m := NewMaterialize(NewFixed(boxedValues(10, 5)...))
+	n := 0
+	for m.Next(ctx) {
+		v := m.Result()
+		if f, ok := first[v.(*boxedValue).name]; ok && f != v {
+			t.Errorf("materialized value %v is not shared", v)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("unexpected number of distinct results: %d", n)
+	}
+	if p.Len() != 5 {
+		t.Errorf("unexpected number of interned values: %d", p.Len())
+	}
+}
+
+// freshIterator returns a newly allocated value on each call to Result.
+type freshIterator struct {
+	*Fixed
+	distinct int64
+}
+
+func (it *freshIterator) Result() graph.Value {
+	n := int64(it.Fixed.Result().(Int64Node)) % it.distinct
+	return graph.PreFetched(quad.String("value " + strconv.FormatInt(n, 10)))
+}
+
+func BenchmarkMaterializeInterner(b *testing.B) {
+	const distinct = 10
+	ctx := context.TODO()
+	nodes := make([]graph.Value, MaterializeLimit)
+	for i := range nodes {
+		nodes[i] = Int64Node(i)
+	}
+	newIt := func() graph.Iterator {
+		return NewMaterialize(&freshIterator{Fixed: NewFixed(nodes...), distinct: distinct})
+	}
+	run := func(b *testing.B, intern bool) {
+		b.ReportAllocs()
+		its := make([]graph.Iterator, 0, b.N)
+		var st1, st2 runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&st1)
+		for i := 0; i < b.N; i++ {
+			ctx := ctx
+			if intern {
+				ctx = WithInterner(ctx, NewInterner())
+			}
+			it := newIt()
+			if !it.Next(ctx) {
+				b.Fatal("no results")
+			}
+			its = append(its, it)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&st2)
+		b.ReportMetric(float64(st2.HeapAlloc-st1.HeapAlloc)/float64(b.N), "retained-B/op")
+		runtime.KeepAlive(its)
+	}
+	b.Run("plain", func(b *testing.B) {
+		run(b, false)
+	})
+	b.Run("interned", func(b *testing.B) {
+		run(b, true)
+	})
+}
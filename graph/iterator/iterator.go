@@ -24,9 +24,35 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 )
 
+// Costs reported by iterators in graph.IteratorStats are relative: a cost of 1 is
+// a single in-memory lookup (see Fixed and memstore), and backends that do I/O report
+// small multiples of it per operation. Iterators that wrap others add a small constant
+// to the costs of their subiterators. Custom iterators should report costs of the same
+// magnitude, so And can compare them when choosing the primary iterator.
+//
+// Operations that an iterator cannot perform efficiently, or at all, report MaxCost.
+var (
+	// MaxCost is a cost of an operation that must be avoided by the optimizer. For example,
+	// Optional reports it as a cost of Next, so it is never used as a primary iterator of And.
+	//
+	// It can be lowered to make such iterators less biased against, but it must stay much
+	// larger than costs of regular iterators multiplied by their sizes.
+	MaxCost = int64(1 << 62)
+)
+
 var nextIteratorID uint64
 
 func init() {
+	ResetUIDForTest()
+}
+
+// ResetUIDForTest resets the counter used by NextUID. Identical iterator trees built
+// after each reset get identical UIDs, which makes descriptions of query plans stable
+// in golden tests.
+//
+// It must only be used in tests, and not concurrently with building iterators,
+// since iterators built before and after the reset may get the same UID.
+func ResetUIDForTest() {
 	atomic.StoreUint64(&nextIteratorID, 1)
 }
 
@@ -34,6 +60,23 @@ func NextUID() uint64 {
 	return atomic.AddUint64(&nextIteratorID, 1) - 1
 }
 
+// pushdown offers an iterator subtree to the quad store, if it supports it.
+// It returns nil if the quad store declined to replace the subtree.
+func pushdown(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+	p, ok := qs.(graph.Pushdownable)
+	if !ok {
+		return nil
+	}
+	return p.Pushdown(it)
+}
+
+// closeInternal closes an iterator that was created internally by another iterator
+// (and is not one of its subiterators), and adds its backend reads to st.
+func closeInternal(st *graph.IOStats, it graph.Iterator) error {
+	st.Add(graph.TotalIOStats(it))
+	return it.Close()
+}
+
 var (
 	_ graph.Iterator = &Null{}
 	_ graph.Iterator = &Error{}
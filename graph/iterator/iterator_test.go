@@ -1,32 +1,44 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package iterator_test
 
 import (
-	"context"
+	"reflect"
+	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
 	. "github.com/cayleygraph/cayley/graph/iterator"
 )
 
-// A testing iterator that returns the given values for Next() and Err().
-type testIterator struct {
-	*Fixed
-
-	NextVal bool
-	ErrVal  error
-}
-
-func newTestIterator(next bool, err error) graph.Iterator {
-	return &testIterator{
-		Fixed:   NewFixed(),
-		NextVal: next,
-		ErrVal:  err,
+func TestResetUID(t *testing.T) {
+	build := func() graph.Description {
+		ResetUIDForTest()
+		vals := []graph.Value{Int64Node(1), Int64Node(2)}
+		it := NewOr(
+			NewFixed(vals...),
+			NewLimit(NewAnd(nil, graphmock.NewIterator(vals), graphmock.NewIterator(vals)), 1),
+		)
+		return graph.DescribeIterator(it)
+	}
+	d1 := build()
+	d2 := build()
+	if d1.UID == 0 {
+		t.Fatal("expected non-zero UID")
+	}
+	if !reflect.DeepEqual(d1, d2) {
+		t.Errorf("expected identical descriptions after reset:\n%#v\nvs\n%#v", d1, d2)
 	}
-}
-
-func (it *testIterator) Next(ctx context.Context) bool {
-	return it.NextVal
-}
-
-func (it *testIterator) Err() error {
-	return it.ErrVal
 }
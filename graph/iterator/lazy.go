@@ -0,0 +1,170 @@
+package iterator
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &Lazy{}
+
+// Lazy iterator builds its sub-iterator on the first use. It allows to pass iterators
+// that are expensive to construct to composite iterators, such as And, which may
+// never need them. For example, And that has an empty sub-iterator doesn't build
+// lazy sub-iterators during Optimize.
+//
+// The sub-iterator is built by Next, Contains, Optimize, Stats and Size. Optimize
+// replaces Lazy with the optimized sub-iterator.
+type Lazy struct {
+	uid   uint64
+	tags  graph.Tagger
+	build func() graph.Iterator
+	subIt graph.Iterator
+}
+
+// NewLazy creates a new Lazy iterator. The function may be called multiple times,
+// for each clone of the iterator.
+func NewLazy(build func() graph.Iterator) *Lazy {
+	return &Lazy{
+		uid:   NextUID(),
+		build: build,
+	}
+}
+
+func (it *Lazy) UID() uint64 {
+	return it.uid
+}
+
+// Built reports if the sub-iterator was already built.
+func (it *Lazy) Built() bool {
+	return it.subIt != nil
+}
+
+// sub returns the sub-iterator, building it if necessary.
+func (it *Lazy) sub() graph.Iterator {
+	if it.subIt == nil {
+		it.subIt = it.build()
+	}
+	return it.subIt
+}
+
+func (it *Lazy) Reset() {
+	if it.subIt != nil {
+		it.subIt.Reset()
+	}
+}
+
+func (it *Lazy) Close() error {
+	if it.subIt == nil {
+		return nil
+	}
+	return it.subIt.Close()
+}
+
+func (it *Lazy) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Lazy) TagResults(dst map[string]graph.Value) {
+	if it.subIt == nil {
+		return
+	}
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+}
+
+// Clone builds a clone lazily as well, unless the sub-iterator was already built.
+func (it *Lazy) Clone() graph.Iterator {
+	out := NewLazy(it.build)
+	if it.subIt != nil {
+		out.subIt = it.subIt.Clone()
+	}
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns the sub-iterator, only if it was already built.
+func (it *Lazy) SubIterators() []graph.Iterator {
+	if it.subIt == nil {
+		return nil
+	}
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Lazy) Next(ctx context.Context) bool {
+	return it.sub().Next(ctx)
+}
+
+func (it *Lazy) NextPath(ctx context.Context) bool {
+	if it.subIt == nil {
+		return false
+	}
+	return it.subIt.NextPath(ctx)
+}
+
+func (it *Lazy) Contains(ctx context.Context, val graph.Value) bool {
+	return it.sub().Contains(ctx, val)
+}
+
+func (it *Lazy) Err() error {
+	if it.subIt == nil {
+		return nil
+	}
+	return it.subIt.Err()
+}
+
+func (it *Lazy) Result() graph.Value {
+	if it.subIt == nil {
+		return nil
+	}
+	return it.subIt.Result()
+}
+
+func (it *Lazy) Type() graph.Type { return graph.Lazy }
+
+// Optimize builds and optimizes the sub-iterator, and replaces Lazy with it.
+func (it *Lazy) Optimize() (graph.Iterator, bool) {
+	sub := it.sub()
+	if out, changed := sub.Optimize(); changed {
+		sub.Close()
+		sub = out
+	}
+	it.subIt = nil
+	sub.Tagger().CopyFrom(it)
+	return sub, true
+}
+
+func (it *Lazy) Stats() graph.IteratorStats {
+	return it.sub().Stats()
+}
+
+func (it *Lazy) Size() (int64, bool) {
+	return it.sub().Size()
+}
+
+func (it *Lazy) String() string {
+	return "Lazy"
+}
+
+// isLazy reports if the iterator is not built yet.
+func isLazy(it graph.Iterator) bool {
+	l, ok := it.(*Lazy)
+	return ok && !l.Built()
+}
+
+// lazyLast returns iterators that are already built first, followed by iterators
+// that are not built yet.
+func lazyLast(its []graph.Iterator) []graph.Iterator {
+	out := make([]graph.Iterator, 0, len(its))
+	for _, it := range its {
+		if !isLazy(it) {
+			out = append(out, it)
+		}
+	}
+	for _, it := range its {
+		if isLazy(it) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
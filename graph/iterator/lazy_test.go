@@ -0,0 +1,65 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func TestLazy(t *testing.T) {
+	ctx := context.TODO()
+	built := 0
+	newLazy := func() *Lazy {
+		return NewLazy(func() graph.Iterator {
+			built++
+			return NewFixed(Int64Node(2), Int64Node(3))
+		})
+	}
+
+	// a cheap empty sibling proves that the And is empty
+	and := NewAnd(nil, newLazy(), NewFixed())
+	if sz, exact := and.Size(); sz != 0 || !exact {
+		t.Errorf("expected an empty And, got size %d", sz)
+	}
+	opt, _ := and.Optimize()
+	if opt.Type() != graph.Null {
+		t.Errorf("expected Null, got %v", opt.Type())
+	}
+	if n, _ := graph.Iterate(ctx, NewAnd(nil, NewFixed(), newLazy().Clone())).Count(); n != 0 {
+		t.Errorf("unexpected results: %d", n)
+	}
+	if built != 0 {
+		t.Errorf("lazy iterator was built %d times", built)
+	}
+
+	// otherwise, it's built once when needed
+	lazy := newLazy()
+	lazy.Tagger().Add("x")
+	and = NewAnd(nil, NewFixed(Int64Node(1), Int64Node(2)), lazy)
+	var got []graph.Value
+	for and.Next(ctx) {
+		tags := make(map[string]graph.Value)
+		and.TagResults(tags)
+		got = append(got, tags["x"])
+	}
+	if !reflect.DeepEqual(got, []graph.Value{Int64Node(2)}) {
+		t.Errorf("unexpected results: %v", got)
+	}
+	if built != 1 {
+		t.Errorf("lazy iterator was built %d times", built)
+	}
+	opt, _ = NewAnd(nil, NewFixed(Int64Node(1), Int64Node(2)), newLazy()).Optimize()
+	n := 0
+	for opt.Next(ctx) {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+	if built != 2 {
+		t.Errorf("lazy iterator was built %d times", built)
+	}
+}
@@ -7,7 +7,11 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 )
 
-var _ graph.Iterator = &Limit{}
+var (
+	_ graph.Iterator    = &Limit{}
+	_ graph.Truncater   = &Limit{}
+	_ graph.LimitHinter = &Limit{}
+)
 
 // Limit iterator will stop iterating if certain a number of values were encountered.
 // Zero and negative limit values means no limit.
@@ -16,6 +20,7 @@ type Limit struct {
 	limit     int64
 	count     int64
 	primaryIt graph.Iterator
+	truncated bool
 }
 
 func NewLimit(primaryIt graph.Iterator, limit int64) *Limit {
@@ -33,6 +38,7 @@ func (it *Limit) UID() uint64 {
 // Reset resets the internal iterators and the iterator itself.
 func (it *Limit) Reset() {
 	it.count = 0
+	it.truncated = false
 	it.primaryIt.Reset()
 }
 
@@ -57,6 +63,8 @@ func (it *Limit) SubIterators() []graph.Iterator {
 func (it *Limit) Next(ctx context.Context) bool {
 	graph.NextLogIn(it)
 	if it.limit > 0 && it.count >= it.limit {
+		// check if the limit has dropped any results
+		it.truncated = it.truncated || it.primaryIt.Next(ctx)
 		return graph.NextLogOut(it, false)
 	}
 	if it.primaryIt.Next(ctx) {
@@ -66,6 +74,12 @@ func (it *Limit) Next(ctx context.Context) bool {
 	return graph.NextLogOut(it, false)
 }
 
+// Truncated reports if the limit was reached and some results were dropped.
+// It is only known after an attempt to get a result past the limit.
+func (it *Limit) Truncated() bool {
+	return it.truncated
+}
+
 func (it *Limit) Err() error {
 	return it.primaryIt.Err()
 }
@@ -82,6 +96,7 @@ func (it *Limit) Contains(ctx context.Context, val graph.Value) bool {
 // if limit is not reached yet.
 func (it *Limit) NextPath(ctx context.Context) bool {
 	if it.limit > 0 && it.count >= it.limit {
+		it.truncated = it.truncated || it.primaryIt.NextPath(ctx)
 		return false
 	}
 	if it.primaryIt.NextPath(ctx) {
@@ -101,13 +116,26 @@ func (it *Limit) Type() graph.Type { return graph.Limit }
 
 func (it *Limit) Optimize() (graph.Iterator, bool) {
 	optimizedPrimaryIt, optimized := it.primaryIt.Optimize()
-	if it.limit <= 0 { // no limit
+	if it.limit <= 0 || optimizedPrimaryIt.Type() == graph.Null { // no limit, or nothing to limit
 		return optimizedPrimaryIt, true
 	}
 	it.primaryIt = optimizedPrimaryIt
+	it.SetLimitHint(it.limit + 1)
 	return it, optimized
 }
 
+// SetLimitHint implements graph.LimitHinter. It passes the hint to the primary iterator,
+// or the own limit, if it's lower. One more result than the limit is requested from the
+// primary iterator to check if results were truncated.
+func (it *Limit) SetLimitHint(n int64) {
+	if it.limit > 0 && (n <= 0 || n > it.limit+1) {
+		n = it.limit + 1
+	}
+	if h, ok := it.primaryIt.(graph.LimitHinter); ok && n > 0 {
+		h.SetLimitHint(n)
+	}
+}
+
 func (it *Limit) Stats() graph.IteratorStats {
 	primaryStats := it.primaryIt.Stats()
 	if it.limit > 0 && primaryStats.Size > it.limit {
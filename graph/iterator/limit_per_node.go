@@ -0,0 +1,257 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &LimitPerNode{}
+
+// LimitPerNode iterator applies a morphism to each value of the sub-iterator separately
+// and returns at most a given number of results for each of them. It is used to bound
+// the fan-out of a traversal step, for example to get a sample of accounts followed
+// by each of the users, instead of all of them.
+//
+// Expansion of a source value stops as soon as the limit is reached, and following
+// results are not read. Results are counted for each occurrence of the source value
+// in the sub-iterator. Alternative paths to the same result are not counted.
+//
+// Contains runs the whole iterator once and keeps all results in memory.
+type LimitPerNode struct {
+	uid      uint64
+	tags     graph.Tagger
+	qs       graph.QuadStore
+	subIt    graph.Iterator
+	morphism graph.ApplyMorphism
+	limit    int64
+
+	cur    graph.Iterator // expansion of the current source value
+	count  int64
+	result graph.Value
+	err    error
+
+	// results collected for Contains
+	contains map[interface{}][]map[string]graph.Value
+	paths    []map[string]graph.Value
+	pathInd  int
+}
+
+// NewLimitPerNode creates an iterator that returns at most limit results of the morphism
+// for each value of the sub-iterator. Zero or negative limit means no limit.
+func NewLimitPerNode(qs graph.QuadStore, sub graph.Iterator, morphism graph.ApplyMorphism, limit int64) *LimitPerNode {
+	return &LimitPerNode{
+		uid:      NextUID(),
+		qs:       qs,
+		subIt:    sub,
+		morphism: morphism,
+		limit:    limit,
+	}
+}
+
+func (it *LimitPerNode) UID() uint64 {
+	return it.uid
+}
+
+func (it *LimitPerNode) Reset() {
+	it.closeCur()
+	it.subIt.Reset()
+	it.result = nil
+	it.err = nil
+	it.paths = nil
+	it.pathInd = 0
+}
+
+func (it *LimitPerNode) closeCur() {
+	if it.cur != nil {
+		it.cur.Close()
+		it.cur = nil
+	}
+	it.count = 0
+}
+
+func (it *LimitPerNode) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *LimitPerNode) TagResults(dst map[string]graph.Value) {
+	if it.paths != nil {
+		for k, v := range it.paths[it.pathInd] {
+			dst[k] = v
+		}
+		return
+	}
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+	if it.cur != nil {
+		it.cur.TagResults(dst)
+	}
+}
+
+func (it *LimitPerNode) Clone() graph.Iterator {
+	out := NewLimitPerNode(it.qs, it.subIt.Clone(), it.morphism, it.limit)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *LimitPerNode) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// expand builds an iterator for results of the morphism for a single source value.
+func (it *LimitPerNode) expand(v graph.Value) graph.Iterator {
+	sub := it.morphism(it.qs, NewFixed(v))
+	sub, _ = sub.Optimize()
+	if nsub, ok := it.qs.OptimizeIterator(sub); ok {
+		sub = nsub
+	}
+	return sub
+}
+
+func (it *LimitPerNode) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.paths = nil
+	for {
+		if it.cur != nil {
+			if (it.limit <= 0 || it.count < it.limit) && it.cur.Next(ctx) {
+				it.count++
+				it.result = it.cur.Result()
+				return graph.NextLogOut(it, true)
+			}
+			it.err = it.cur.Err()
+			it.closeCur()
+			if it.err != nil {
+				return graph.NextLogOut(it, false)
+			}
+		}
+		if !it.subIt.Next(ctx) {
+			it.err = it.subIt.Err()
+			it.result = nil
+			return graph.NextLogOut(it, false)
+		}
+		it.cur = it.expand(it.subIt.Result())
+	}
+}
+
+func (it *LimitPerNode) Err() error {
+	return it.err
+}
+
+func (it *LimitPerNode) Result() graph.Value {
+	return it.result
+}
+
+// collect runs a clone of the iterator and remembers tags of all results.
+func (it *LimitPerNode) collect(ctx context.Context) error {
+	c := it.Clone().(*LimitPerNode)
+	defer c.Close()
+	it.contains = make(map[interface{}][]map[string]graph.Value)
+	for c.Next(ctx) {
+		for {
+			tags := make(map[string]graph.Value)
+			c.TagResults(tags)
+			k := graph.ToKey(c.Result())
+			it.contains[k] = append(it.contains[k], tags)
+			if !c.NextPath(ctx) {
+				break
+			}
+		}
+	}
+	return c.Err()
+}
+
+func (it *LimitPerNode) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if it.contains == nil {
+		if err := it.collect(ctx); err != nil {
+			it.err = err
+			it.contains = nil
+			return graph.ContainsLogOut(it, val, false)
+		}
+	}
+	it.closeCur()
+	it.pathInd = 0
+	it.paths = it.contains[graph.ToKey(val)]
+	if len(it.paths) == 0 {
+		it.paths = nil
+		it.result = nil
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *LimitPerNode) NextPath(ctx context.Context) bool {
+	if it.paths != nil {
+		if it.pathInd+1 >= len(it.paths) {
+			return false
+		}
+		it.pathInd++
+		return true
+	}
+	return it.cur != nil && it.cur.NextPath(ctx)
+}
+
+func (it *LimitPerNode) Close() error {
+	it.closeCur()
+	it.contains = nil
+	return it.subIt.Close()
+}
+
+func (it *LimitPerNode) Type() graph.Type { return graph.LimitPerNode }
+
+func (it *LimitPerNode) String() string {
+	return fmt.Sprintf("LimitPerNode(%d)", it.limit)
+}
+
+// Optimize optimizes the sub-iterator. If there is no limit, the iterator is replaced with
+// the morphism applied to the sub-iterator.
+func (it *LimitPerNode) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		it.Close()
+		return NewNull(), true
+	}
+	if it.limit <= 0 {
+		out, _ := it.morphism(it.qs, it.subIt).Optimize()
+		return out, true
+	}
+	return it, false
+}
+
+// expansionStats estimates costs of the morphism for a single source value.
+func (it *LimitPerNode) expansionStats() graph.IteratorStats {
+	ex := it.morphism(it.qs, NewFixed())
+	defer ex.Close()
+	return ex.Stats()
+}
+
+// Size returns an upper bound of the number of results: the size of the sub-iterator,
+// multiplied by the limit.
+func (it *LimitPerNode) Size() (int64, bool) {
+	n, exact := it.subIt.Size()
+	if exact && n == 0 {
+		return 0, true
+	}
+	if it.limit <= 0 {
+		return n * it.expansionStats().Size, false
+	}
+	return n * it.limit, false
+}
+
+func (it *LimitPerNode) Stats() graph.IteratorStats {
+	sub := it.subIt.Stats()
+	ex := it.expansionStats()
+	size, _ := it.Size()
+	next := sub.NextCost + ex.NextCost
+	return graph.IteratorStats{
+		NextCost: next,
+		// all results are collected on the first call
+		ContainsCost: next * size,
+		Size:         size,
+	}
+}
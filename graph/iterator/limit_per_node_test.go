@@ -0,0 +1,143 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func limitPerNodeStart(names ...string) *Fixed {
+	start := NewFixed()
+	for _, name := range names {
+		start.Add(graph.PreFetched(quad.Raw(name)))
+	}
+	start.Tagger().Add("src")
+	return start
+}
+
+var limitPerNodeTests = []struct {
+	name   string
+	start  []string
+	limit  int64
+	expect []string
+}{
+	{
+		name:   "limit below the number of links",
+		start:  []string{"charlie"},
+		limit:  1,
+		expect: []string{"charlie/?"},
+	},
+	{
+		name:   "limit equal to the number of links",
+		start:  []string{"charlie"},
+		limit:  2,
+		expect: []string{"charlie/bob", "charlie/dani"},
+	},
+	{
+		name:   "limit above the number of links",
+		start:  []string{"bob", "charlie"},
+		limit:  5,
+		expect: []string{"bob/charlie", "charlie/bob", "charlie/dani"},
+	},
+	{
+		name:   "limit applied to each source",
+		start:  []string{"alice", "bob", "charlie"},
+		limit:  1,
+		expect: []string{"alice/bob", "bob/charlie", "charlie/?"},
+	},
+	{
+		name:   "source without links",
+		start:  []string{"emily", "dani"},
+		limit:  1,
+		expect: []string{"dani/emily"},
+	},
+	{
+		name:   "no limit",
+		start:  []string{"bob", "charlie"},
+		limit:  0,
+		expect: []string{"bob/charlie", "charlie/bob", "charlie/dani"},
+	},
+}
+
+func TestLimitPerNode(t *testing.T) {
+	qs := rec_test_qs
+	for _, c := range limitPerNodeTests {
+		t.Run(c.name, func(t *testing.T) {
+			it := NewLimitPerNode(qs, limitPerNodeStart(c.start...), singleHop("parent"), c.limit)
+			defer it.Close()
+			got := followNames(t, qs, it, "src")
+			if len(got) != len(c.expect) {
+				t.Fatalf("unexpected results: %v vs %v", got, c.expect)
+			}
+			for i, s := range got {
+				// charlie has two parents, and either of them may be returned first
+				if exp := c.expect[i]; exp == "charlie/?" {
+					if s != "charlie/bob" && s != "charlie/dani" {
+						t.Errorf("unexpected result: %v", s)
+					}
+				} else if s != exp {
+					t.Errorf("unexpected results: %v vs %v", got, c.expect)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitPerNodeStopsExpansion(t *testing.T) {
+	qs := rec_test_qs
+	ctx := context.TODO()
+	var expanded []graph.Iterator
+	morphism := func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		out := singleHop("parent")(qs, it)
+		expanded = append(expanded, out)
+		return out
+	}
+	it := NewLimitPerNode(qs, limitPerNodeStart("charlie", "bob"), morphism, 1)
+	defer it.Close()
+	n := 0
+	for it.Next(ctx) {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 results, got %d", n)
+	}
+	if len(expanded) != 2 {
+		t.Errorf("expected each source to be expanded once, got %d expansions", len(expanded))
+	}
+}
+
+func TestLimitPerNodeContains(t *testing.T) {
+	qs := rec_test_qs
+	ctx := context.TODO()
+	it := NewLimitPerNode(qs, limitPerNodeStart("alice", "bob"), singleHop("parent"), 1)
+	defer it.Close()
+	for _, c := range []struct {
+		name string
+		ok   bool
+		src  string
+	}{
+		{name: "bob", ok: true, src: "alice"},
+		{name: "charlie", ok: true, src: "bob"},
+		{name: "dani", ok: false},
+	} {
+		if it.Contains(ctx, graph.PreFetched(quad.Raw(c.name))) != c.ok {
+			t.Errorf("unexpected Contains result for %q", c.name)
+			continue
+		} else if !c.ok {
+			continue
+		}
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		exp := map[string]graph.Value{"src": graph.PreFetched(quad.Raw(c.src))}
+		if !reflect.DeepEqual(tags, exp) {
+			t.Errorf("unexpected tags for %q: %v", c.name, tags)
+		}
+	}
+}
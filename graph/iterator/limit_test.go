@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph"
 	. "github.com/cayleygraph/cayley/graph/iterator"
 )
 
@@ -46,3 +47,64 @@ func TestLimitIteratorBasics(t *testing.T) {
 		}
 	}
 }
+
+func TestLimitIteratorTruncated(t *testing.T) {
+	newFixed := func() *Fixed {
+		return NewFixed(Int64Node(1), Int64Node(2), Int64Node(3))
+	}
+	for _, c := range []struct {
+		limit     int64
+		truncated bool
+	}{
+		{limit: 0, truncated: false},
+		{limit: 2, truncated: true},
+		{limit: 3, truncated: false},
+		{limit: 5, truncated: false},
+	} {
+		u := NewLimit(newFixed(), c.limit)
+		iterated(u)
+		if u.Truncated() != c.truncated {
+			t.Errorf("limit %d: unexpected truncated flag: %v", c.limit, u.Truncated())
+		}
+		u.Reset()
+		if u.Truncated() {
+			t.Errorf("limit %d: truncated flag should be cleared on reset", c.limit)
+		}
+	}
+
+	// should propagate through composite iterators
+	u := NewLimit(newFixed(), 1)
+	or := NewOr(u, NewFixed(Int64Node(4)))
+	iterated(or)
+	if !graph.IsTruncated(or) {
+		t.Error("truncated flag should propagate to parent iterators")
+	}
+}
+
+// hintedFixed records limit hints.
+type hintedFixed struct {
+	*Fixed
+	hint int64
+}
+
+func (it *hintedFixed) SetLimitHint(n int64) { it.hint = n }
+
+func (it *hintedFixed) Optimize() (graph.Iterator, bool) { return it, false }
+
+func TestLimitHint(t *testing.T) {
+	sub := &hintedFixed{Fixed: NewFixed(Int64Node(1), Int64Node(2), Int64Node(3))}
+	it, _ := NewLimit(sub, 2).Optimize()
+	if sub.hint != 3 {
+		t.Errorf("expected a hint for one more value than the limit, got: %d", sub.hint)
+	}
+	if n := len(iterated(it)); n != 2 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+
+	// the hint is passed through Skip and the lowest limit is used
+	sub = &hintedFixed{Fixed: NewFixed(Int64Node(1), Int64Node(2), Int64Node(3))}
+	NewLimit(NewLimit(NewSkip(sub, 1), 5), 2).Optimize()
+	if sub.hint != 4 {
+		t.Errorf("unexpected hint through skip: %d", sub.hint)
+	}
+}
@@ -51,6 +51,7 @@ type LinksTo struct {
 	nextIt    graph.Iterator
 	result    graph.Value
 	runstats  graph.IteratorStats
+	io        graph.IOStats
 	err       error
 }
 
@@ -73,7 +74,7 @@ func (it *LinksTo) UID() uint64 {
 func (it *LinksTo) Reset() {
 	it.primaryIt.Reset()
 	if it.nextIt != nil {
-		it.nextIt.Close()
+		closeInternal(&it.io, it.nextIt)
 	}
 	it.nextIt = &Null{}
 }
@@ -127,10 +128,10 @@ func (it *LinksTo) Optimize() (graph.Iterator, bool) {
 	newPrimary, changed := it.primaryIt.Optimize()
 	if changed {
 		it.primaryIt = newPrimary
-		if it.primaryIt.Type() == graph.Null {
-			it.nextIt.Close()
-			return it.primaryIt, true
-		}
+	}
+	if it.primaryIt.Type() == graph.Null {
+		closeInternal(&it.io, it.nextIt)
+		return it.primaryIt, true
 	}
 	// Ask the graph.QuadStore if we can be replaced. Often times, this is a great
 	// optimization opportunity (there's a fixed iterator underneath us, for
@@ -168,13 +169,25 @@ func (it *LinksTo) Next(ctx context.Context) bool {
 			// We're out of nodes in our subiterator, so we're done as well.
 			return graph.NextLogOut(it, false)
 		}
-		it.nextIt.Close()
+		closeInternal(&it.io, it.nextIt)
 		it.nextIt = it.qs.QuadIterator(it.dir, it.primaryIt.Result())
 
 		// Continue -- return the first in the next set.
 	}
 }
 
+var _ graph.IOStater = &LinksTo{}
+
+// IOStats implements graph.IOStater. It returns reads of the quad iterators created for
+// each value of the subiterator.
+func (it *LinksTo) IOStats() graph.IOStats {
+	st := it.io
+	if it.nextIt != nil {
+		st.Add(graph.TotalIOStats(it.nextIt))
+	}
+	return st
+}
+
 func (it *LinksTo) Err() error {
 	return it.err
 }
@@ -186,7 +199,8 @@ func (it *LinksTo) Result() graph.Value {
 // Close closes the iterator.  It closes all subiterators it can, but
 // returns the first error it encounters.
 func (it *LinksTo) Close() error {
-	err := it.nextIt.Close()
+	err := closeInternal(&it.io, it.nextIt)
+	it.nextIt = &Null{}
 
 	_err := it.primaryIt.Close()
 	if _err != nil && err == nil {
@@ -238,7 +252,7 @@ func (it *LinksTo) Size() (int64, bool) {
 		for _, v := range fixed.Values() {
 			sit := it.qs.QuadIterator(it.dir, v)
 			n, ex := sit.Size()
-			sit.Close()
+			closeInternal(&it.io, sit)
 			sz += n
 			exact = exact && ex
 		}
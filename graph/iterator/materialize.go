@@ -32,6 +32,9 @@ type result struct {
 	tags map[string]graph.Value
 }
 
+// Materialize iterator reads all results of the sub-iterator into memory. If the sub-iterator
+// has more than MaterializeLimit results, or the memory budget of the context is exceeded
+// (see graph.WithBudget), it falls back to iterating the sub-iterator directly.
 type Materialize struct {
 	uid         uint64
 	tags        graph.Tagger
@@ -46,6 +49,9 @@ type Materialize struct {
 	aborted     bool
 	runstats    graph.IteratorStats
 	err         error
+	interner    *Interner
+	budget      *graph.Budget
+	reserved    int64
 }
 
 func NewMaterialize(sub graph.Iterator) *Materialize {
@@ -62,6 +68,12 @@ func NewMaterializeWithSize(sub graph.Iterator, size int64) *Materialize {
 	}
 }
 
+// SetInterner sets a pool of values used to store materialized results and tags.
+// If not set, the pool associated with the context is used (see WithInterner).
+func (it *Materialize) SetInterner(p *Interner) {
+	it.interner = p
+}
+
 func (it *Materialize) UID() uint64 {
 	return it.uid
 }
@@ -75,9 +87,29 @@ func (it *Materialize) Close() error {
 	it.containsMap = nil
 	it.values = nil
 	it.hasRun = false
+	it.release()
 	return it.subIt.Close()
 }
 
+// reserve accounts memory for a materialized result with n tags in the budget.
+func (it *Materialize) reserve(n int) bool {
+	sz := graph.RowSize(n)
+	if err := it.budget.Reserve(sz); err != nil {
+		if clog.V(2) {
+			clog.Infof("Materialize: %v", err)
+		}
+		return false
+	}
+	it.reserved += sz
+	return true
+}
+
+// release returns memory used by materialized results to the budget.
+func (it *Materialize) release() {
+	it.budget.Release(it.reserved)
+	it.budget, it.reserved = nil, 0
+}
+
 func (it *Materialize) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -106,6 +138,7 @@ func (it *Materialize) TagResults(dst map[string]graph.Value) {
 
 func (it *Materialize) Clone() graph.Iterator {
 	out := NewMaterialize(it.subIt.Clone())
+	out.interner = it.interner
 	out.tags.CopyFrom(it)
 	if it.hasRun {
 		out.hasRun = true
@@ -149,9 +182,9 @@ func (it *Materialize) Optimize() (graph.Iterator, bool) {
 	newSub, changed := it.subIt.Optimize()
 	if changed {
 		it.subIt = newSub
-		if it.subIt.Type() == graph.Null {
-			return it.subIt, true
-		}
+	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
 	}
 	return it, false
 }
@@ -266,13 +299,18 @@ func (it *Materialize) NextPath(ctx context.Context) bool {
 func (it *Materialize) materializeSet(ctx context.Context) {
 	i := 0
 	mn := 0
+	p := it.interner
+	if p == nil {
+		p = InternerFromContext(ctx)
+	}
+	it.budget = graph.BudgetFromContext(ctx)
 	for it.subIt.Next(ctx) {
 		i++
 		if i > MaterializeLimit {
 			it.aborted = true
 			break
 		}
-		id := it.subIt.Result()
+		id := p.Intern(it.subIt.Result())
 		val := graph.ToKey(id)
 		if _, ok := it.containsMap[val]; !ok {
 			it.containsMap[val] = len(it.values)
@@ -281,6 +319,11 @@ func (it *Materialize) materializeSet(ctx context.Context) {
 		index := it.containsMap[val]
 		tags := make(map[string]graph.Value, mn)
 		it.subIt.TagResults(tags)
+		if !it.reserve(len(tags)) {
+			it.aborted = true
+			break
+		}
+		internTags(p, tags)
 		if n := len(tags); n > mn {
 			n = mn
 		}
@@ -294,12 +337,20 @@ func (it *Materialize) materializeSet(ctx context.Context) {
 			}
 			tags := make(map[string]graph.Value, mn)
 			it.subIt.TagResults(tags)
+			if !it.reserve(len(tags)) {
+				it.aborted = true
+				break
+			}
+			internTags(p, tags)
 			if n := len(tags); n > mn {
 				n = mn
 			}
 			it.values[index] = append(it.values[index], result{id: id, tags: tags})
 			it.actualSize += 1
 		}
+		if it.aborted {
+			break
+		}
 	}
 	it.err = it.subIt.Err()
 	if it.err == nil && it.aborted {
@@ -308,7 +359,18 @@ func (it *Materialize) materializeSet(ctx context.Context) {
 		}
 		it.values = nil
 		it.containsMap = nil
+		it.release()
 		it.subIt.Reset()
 	}
 	it.hasRun = true
 }
+
+// internTags replaces tagged values with shared ones from the pool.
+func internTags(p *Interner, tags map[string]graph.Value) {
+	if p == nil {
+		return
+	}
+	for k, v := range tags {
+		tags[k] = p.Intern(v)
+	}
+}
@@ -19,13 +19,15 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
 	. "github.com/cayleygraph/cayley/graph/iterator"
 )
 
 func TestMaterializeIteratorError(t *testing.T) {
 	ctx := context.TODO()
 	wantErr := errors.New("unique")
-	errIt := newTestIterator(false, wantErr)
+	errIt := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	// This tests that we properly return 0 results and the error when the
 	// underlying iterator returns an error.
@@ -42,7 +44,7 @@ func TestMaterializeIteratorError(t *testing.T) {
 func TestMaterializeIteratorErrorAbort(t *testing.T) {
 	ctx := context.TODO()
 	wantErr := errors.New("unique")
-	errIt := newTestIterator(false, wantErr)
+	errIt := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	// This tests that we properly return 0 results and the error when the
 	// underlying iterator is larger than our 'abort at' value, and then
@@ -74,3 +76,23 @@ func TestMaterializeIteratorErrorAbort(t *testing.T) {
 		t.Errorf("Materialize iterator did not pass through underlying Err")
 	}
 }
+
+func TestMaterializeBudget(t *testing.T) {
+	b := graph.NewBudget(graph.RowSize(0)*10, nil)
+	ctx := graph.WithBudget(context.TODO(), b)
+
+	// materialization is aborted, but all results are still returned
+	mIt := NewMaterialize(NewInt64(1, 100, true))
+	n := 0
+	for mIt.Next(ctx) {
+		n++
+	}
+	if err := mIt.Err(); err != nil {
+		t.Fatal(err)
+	} else if n != 100 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+	if n := b.Used(); n != 0 {
+		t.Errorf("memory was not released: %d", n)
+	}
+}
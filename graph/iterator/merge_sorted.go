@@ -0,0 +1,327 @@
+package iterator
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var (
+	_ graph.Iterator = &MergeSorted{}
+	_ graph.Seekable = &MergeSorted{}
+)
+
+// ErrSortOrder is returned by MergeSorted if its sub-iterators are not sorted in the same order.
+var ErrSortOrder = errors.New("merge sorted: sub-iterators are not sorted in the same order")
+
+// MergeSorted is a union of sorted iterators that returns results in their common
+// sort order. For example, it can merge sorted results from multiple partitions.
+//
+// It keeps a heap of sub-iterators positioned at their current results, thus only
+// one result of each sub-iterator is held at a time. Results with equal keys are
+// returned in the order of sub-iterators, or only once if deduplication is enabled.
+//
+// All sub-iterators must have the same sort order (see graph.Seekable). Otherwise, the
+// iteration stops with ErrSortOrder.
+type MergeSorted struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIts []graph.Seekable
+	dedup  bool
+
+	cursors    mergeHeap // sub-iterators positioned at results that were not returned yet
+	cur        []int     // indexes of sub-iterators that returned the current result
+	key        uint64
+	result     graph.Value
+	started    bool
+	positioned bool // all sub-iterators were advanced at least once
+	err        error
+}
+
+// NewMergeSorted creates a union of sorted iterators. If dedup is set, results with
+// equal keys are returned once.
+func NewMergeSorted(dedup bool, its ...graph.Seekable) *MergeSorted {
+	return &MergeSorted{
+		uid:    NextUID(),
+		subIts: its,
+		dedup:  dedup,
+	}
+}
+
+// mergeHeap is a min-heap of sub-iterators ordered by the key of the current result.
+// Equal keys are ordered by the index of the sub-iterator.
+type mergeHeap struct {
+	its []graph.Seekable
+	ind []int
+}
+
+func (h *mergeHeap) Len() int { return len(h.ind) }
+func (h *mergeHeap) Less(i, j int) bool {
+	ki, kj := h.its[h.ind[i]].SortKey(), h.its[h.ind[j]].SortKey()
+	if ki != kj {
+		return ki < kj
+	}
+	return h.ind[i] < h.ind[j]
+}
+func (h *mergeHeap) Swap(i, j int)      { h.ind[i], h.ind[j] = h.ind[j], h.ind[i] }
+func (h *mergeHeap) Push(x interface{}) { h.ind = append(h.ind, x.(int)) }
+func (h *mergeHeap) Pop() interface{} {
+	n := len(h.ind) - 1
+	x := h.ind[n]
+	h.ind = h.ind[:n]
+	return x
+}
+
+func (it *MergeSorted) UID() uint64 {
+	return it.uid
+}
+
+// Dedup reports if results with equal keys are returned once.
+func (it *MergeSorted) Dedup() bool { return it.dedup }
+
+func (it *MergeSorted) Reset() {
+	for _, sub := range it.subIts {
+		sub.Reset()
+	}
+	it.cursors = mergeHeap{}
+	it.cur = nil
+	it.result = nil
+	it.started = false
+	it.positioned = false
+	it.err = nil
+}
+
+func (it *MergeSorted) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *MergeSorted) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	for _, i := range it.cur {
+		it.subIts[i].TagResults(dst)
+	}
+}
+
+func (it *MergeSorted) Clone() graph.Iterator {
+	its := make([]graph.Seekable, 0, len(it.subIts))
+	for _, sub := range it.subIts {
+		its = append(its, sub.Clone().(graph.Seekable))
+	}
+	out := NewMergeSorted(it.dedup, its...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *MergeSorted) SubIterators() []graph.Iterator {
+	out := make([]graph.Iterator, 0, len(it.subIts))
+	for _, sub := range it.subIts {
+		out = append(out, sub)
+	}
+	return out
+}
+
+// advance moves sub-iterators that returned the current result forward, and puts them
+// back to the heap. If seek is set, they are skipped to results with keys >= k.
+func (it *MergeSorted) advance(ctx context.Context, seek bool, k uint64) bool {
+	for _, i := range it.cur {
+		sub := it.subIts[i]
+		var ok bool
+		if seek && it.positioned {
+			ok = sub.NextGE(ctx, k)
+		} else if ok = sub.Next(ctx); ok && seek && sub.SortKey() < k {
+			ok = sub.NextGE(ctx, k)
+		}
+		if ok {
+			it.cursors.ind = append(it.cursors.ind, i)
+		} else if it.err = sub.Err(); it.err != nil {
+			return false
+		}
+	}
+	it.cur = it.cur[:0]
+	it.positioned = true
+	return true
+}
+
+// start positions all sub-iterators at their first results.
+func (it *MergeSorted) start() bool {
+	it.started = true
+	if sortOrderOf(it.SubIterators()) == "" && len(it.subIts) != 0 {
+		it.err = ErrSortOrder
+		return false
+	}
+	it.cursors = mergeHeap{its: it.subIts}
+	it.cur = make([]int, 0, len(it.subIts))
+	for i := range it.subIts {
+		it.cur = append(it.cur, i)
+	}
+	return true
+}
+
+// pop takes the smallest result from the heap. If deduplication is enabled, all
+// sub-iterators with the same key are taken from the heap as well.
+func (it *MergeSorted) pop() bool {
+	if it.cursors.Len() == 0 {
+		it.result = nil
+		return false
+	}
+	i := heap.Pop(&it.cursors).(int)
+	it.cur = append(it.cur, i)
+	it.key, it.result = it.subIts[i].SortKey(), it.subIts[i].Result()
+	for it.dedup && it.cursors.Len() != 0 && it.subIts[it.cursors.ind[0]].SortKey() == it.key {
+		it.cur = append(it.cur, heap.Pop(&it.cursors).(int))
+	}
+	return true
+}
+
+func (it *MergeSorted) next(ctx context.Context, seek bool, k uint64) bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started && !it.start() {
+		return false
+	}
+	prev, dup := it.key, it.result != nil && it.dedup
+	for {
+		if !it.advance(ctx, seek, k) {
+			it.result = nil
+			return false
+		}
+		heap.Init(&it.cursors)
+		if !it.pop() {
+			return false
+		}
+		// a sub-iterator may return the same key multiple times
+		if !dup || it.key != prev {
+			return true
+		}
+		seek = false
+	}
+}
+
+func (it *MergeSorted) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	return graph.NextLogOut(it, it.next(ctx, false, 0))
+}
+
+func (it *MergeSorted) NextPath(ctx context.Context) bool {
+	for _, i := range it.cur {
+		sub := it.subIts[i]
+		if sub.NextPath(ctx) {
+			return true
+		}
+		if it.err = sub.Err(); it.err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// SortOrder implements graph.Seekable. Results are sorted in the order of sub-iterators.
+func (it *MergeSorted) SortOrder() string {
+	return sortOrderOf(it.SubIterators())
+}
+
+// SortKey implements graph.Seekable.
+func (it *MergeSorted) SortKey() uint64 {
+	return it.key
+}
+
+// NextGE implements graph.Seekable.
+func (it *MergeSorted) NextGE(ctx context.Context, k uint64) bool {
+	graph.NextLogIn(it)
+	if it.started {
+		// skip sub-iterators that are waiting in the heap as well
+		for _, i := range it.cursors.ind {
+			if it.subIts[i].SortKey() < k {
+				it.cur = append(it.cur, i)
+			}
+		}
+		n := 0
+		for _, i := range it.cursors.ind {
+			if it.subIts[i].SortKey() >= k {
+				it.cursors.ind[n] = i
+				n++
+			}
+		}
+		it.cursors.ind = it.cursors.ind[:n]
+	}
+	return graph.NextLogOut(it, it.next(ctx, true, k))
+}
+
+// Contains checks the value against all sub-iterators.
+func (it *MergeSorted) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	for i, sub := range it.subIts {
+		if sub.Contains(ctx, val) {
+			it.result = val
+			it.cur = append(it.cur[:0], i)
+			return graph.ContainsLogOut(it, val, true)
+		}
+		if it.err = sub.Err(); it.err != nil {
+			break
+		}
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+func (it *MergeSorted) Err() error {
+	return it.err
+}
+
+func (it *MergeSorted) Result() graph.Value {
+	return it.result
+}
+
+func (it *MergeSorted) Close() error {
+	var err error
+	for _, sub := range it.subIts {
+		if err2 := sub.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (it *MergeSorted) Type() graph.Type { return graph.MergeSorted }
+
+func (it *MergeSorted) String() string {
+	return fmt.Sprintf("MergeSorted(%d, dedup: %v)", len(it.subIts), it.dedup)
+}
+
+func (it *MergeSorted) Optimize() (graph.Iterator, bool) {
+	if len(it.subIts) == 0 {
+		return NewNull(), true
+	}
+	return it, false
+}
+
+// Size is the sum of sizes of sub-iterators. It's not exact if duplicates are removed.
+func (it *MergeSorted) Size() (int64, bool) {
+	var size int64
+	exact := !it.dedup
+	for _, sub := range it.subIts {
+		n, e := sub.Size()
+		size += n
+		exact = exact && e
+	}
+	return size, exact
+}
+
+// Stats assumes that each result requires a Next on one of the sub-iterators.
+func (it *MergeSorted) Stats() graph.IteratorStats {
+	var st graph.IteratorStats
+	for _, sub := range it.subIts {
+		s := sub.Stats()
+		st.NextCost += s.NextCost
+		st.ContainsCost += s.ContainsCost
+	}
+	if n := int64(len(it.subIts)); n != 0 {
+		// one more for the heap
+		st.NextCost = st.NextCost/n + 1
+	}
+	st.Size, st.ExactSize = it.Size()
+	return st
+}
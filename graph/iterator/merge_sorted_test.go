@@ -0,0 +1,127 @@
+package iterator_test
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+type otherOrderIterator struct {
+	*sortedIterator
+}
+
+func (it otherOrderIterator) SortOrder() string { return "other" }
+
+func TestMergeSorted(t *testing.T) {
+	ctx := context.TODO()
+	newSubs := func() []graph.Seekable {
+		return []graph.Seekable{
+			newSortedIterator(1, 3, 4, 7, 9),
+			newSortedIterator(2, 3, 7, 8),
+			newSortedIterator(),
+			newSortedIterator(3, 5, 10),
+		}
+	}
+
+	it := NewMergeSorted(false, newSubs()...)
+	expect := []int64{1, 2, 3, 3, 3, 4, 5, 7, 7, 8, 9, 10}
+	if got := collectInt64(t, it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: %v vs %v", got, expect)
+	}
+	it.Reset()
+	if got := collectInt64(t, it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results after reset: %v vs %v", got, expect)
+	}
+
+	it = NewMergeSorted(true, newSubs()...)
+	expect = []int64{1, 2, 3, 4, 5, 7, 8, 9, 10}
+	if got := collectInt64(t, it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected deduplicated results: %v vs %v", got, expect)
+	}
+
+	it = NewMergeSorted(true, newSubs()...)
+	if !it.Next(ctx) || it.SortKey() != 1 {
+		t.Fatal("expected the first result")
+	}
+	if !it.NextGE(ctx, 6) || it.SortKey() != 7 {
+		t.Fatalf("unexpected result after seeking: %v", it.Result())
+	}
+	if got := collectInt64(t, it); !reflect.DeepEqual(got, []int64{8, 9, 10}) {
+		t.Errorf("unexpected results after seeking: %v", got)
+	}
+
+	it = NewMergeSorted(true, newSubs()...)
+	if v, ok := SeekKey(ctx, it, 6); !ok || v != Int64Node(7) {
+		t.Fatalf("unexpected result after seeking by key: %v", v)
+	}
+	if v, ok := SeekKey(ctx, it, 2); !ok || v != Int64Node(7) {
+		t.Fatalf("seeking backward should not move the iterator: %v", v)
+	}
+	if got := collectInt64(t, it); !reflect.DeepEqual(got, []int64{8, 9, 10}) {
+		t.Errorf("unexpected results after seeking by key: %v", got)
+	}
+
+	// merged results can be intersected with other sorted iterators
+	and := NewAnd(nil, NewMergeSorted(true, newSubs()...), newSortedIterator(2, 3, 6, 10))
+	opt, _ := and.Optimize()
+	if opt.Type() != graph.ZigZag {
+		t.Errorf("expected ZigZag, got %v", opt.Type())
+	}
+	if got := collectInt64(t, opt); !reflect.DeepEqual(got, []int64{2, 3, 10}) {
+		t.Errorf("unexpected intersection: %v", got)
+	}
+
+	it = NewMergeSorted(false, newSortedIterator(1, 2), otherOrderIterator{newSortedIterator(1, 3)})
+	if it.Next(ctx) || it.Err() != ErrSortOrder {
+		t.Errorf("expected an error for different sort orders, got: %v", it.Err())
+	}
+}
+
+func TestMergeSortedRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		var (
+			subs   []graph.Seekable
+			expect []int64
+			seen   = make(map[int64]struct{})
+			unique []int64
+		)
+		for j := rnd.Intn(5) + 1; j > 0; j-- {
+			var vals []int64
+			v := int64(0)
+			for k := rnd.Intn(20); k > 0; k-- {
+				v += int64(rnd.Intn(3))
+				vals = append(vals, v)
+				expect = append(expect, v)
+				if _, ok := seen[v]; !ok {
+					seen[v] = struct{}{}
+					unique = append(unique, v)
+				}
+			}
+			subs = append(subs, newSortedIterator(vals...))
+		}
+		sort.Slice(expect, func(i, j int) bool { return expect[i] < expect[j] })
+		sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+
+		got := collectInt64(t, NewMergeSorted(false, subs...))
+		if len(got) != 0 || len(expect) != 0 {
+			if !reflect.DeepEqual(got, expect) {
+				t.Fatalf("unexpected results: %v vs %v", got, expect)
+			}
+		}
+		for _, sub := range subs {
+			sub.Reset()
+		}
+		got = collectInt64(t, NewMergeSorted(true, subs...))
+		if len(got) != 0 || len(unique) != 0 {
+			if !reflect.DeepEqual(got, unique) {
+				t.Fatalf("unexpected deduplicated results: %v vs %v", got, unique)
+			}
+		}
+	}
+}
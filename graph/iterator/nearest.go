@@ -0,0 +1,263 @@
+package iterator
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Nearest{}
+
+type nearestResult struct {
+	result
+	dist float64
+	seq  int // order of the result in the sub-iterator; used to break ties
+}
+
+// nearestHeap is a max-heap of results, ordered by the distance to the target.
+type nearestHeap []nearestResult
+
+func (h nearestHeap) less(i, j int) bool {
+	if h[i].dist != h[j].dist {
+		return h[i].dist < h[j].dist
+	}
+	return h[i].seq < h[j].seq
+}
+func (h nearestHeap) Len() int            { return len(h) }
+func (h nearestHeap) Less(i, j int) bool  { return h.less(j, i) }
+func (h nearestHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nearestHeap) Push(x interface{}) { *h = append(*h, x.(nearestResult)) }
+func (h *nearestHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	x := old[n]
+	*h = old[:n]
+	return x
+}
+
+// Nearest iterator returns at most K numeric values of the sub-iterator that are
+// the closest to a target number, ordered by the absolute difference with it.
+// Values that are not numbers are skipped.
+//
+// Only K results are kept in memory while scanning the sub-iterator.
+type Nearest struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     graph.QuadStore
+	subIt  graph.Iterator
+	target float64
+	k      int
+	values []nearestResult
+	index  map[interface{}]int
+	hasRun bool
+	cur    int
+	result *nearestResult
+	err    error
+}
+
+// NewNearest creates a new iterator that returns k values of the sub-iterator that
+// are the closest to the target.
+func NewNearest(qs graph.QuadStore, sub graph.Iterator, target float64, k int) *Nearest {
+	return &Nearest{
+		uid:    NextUID(),
+		qs:     qs,
+		subIt:  sub,
+		target: target,
+		k:      k,
+		cur:    -1,
+	}
+}
+
+func (it *Nearest) UID() uint64 {
+	return it.uid
+}
+
+// Target returns the number that values are compared with.
+func (it *Nearest) Target() float64 { return it.target }
+
+// K returns the maximal number of results.
+func (it *Nearest) K() int { return it.k }
+
+// Reset rewinds the iterator. Found values are kept, the sub-iterator is not re-run.
+func (it *Nearest) Reset() {
+	it.cur = -1
+	it.result = nil
+}
+
+func (it *Nearest) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Nearest) TagResults(dst map[string]graph.Value) {
+	if it.result == nil {
+		return
+	}
+	for tag, val := range it.result.tags {
+		dst[tag] = val
+	}
+	it.tags.TagResult(dst, it.result.id)
+}
+
+func (it *Nearest) Clone() graph.Iterator {
+	out := NewNearest(it.qs, it.subIt.Clone(), it.target, it.k)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Nearest) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// numericValue returns a float value of a number, or false if value is not a number.
+func numericValue(v quad.Value) (float64, bool) {
+	switch v := v.(type) {
+	case quad.Int:
+		return float64(v), true
+	case quad.Float:
+		return float64(v), !math.IsNaN(float64(v))
+	}
+	return 0, false
+}
+
+// run scans the sub-iterator and keeps k results closest to the target.
+func (it *Nearest) run(ctx context.Context) {
+	it.hasRun = true
+	if it.k <= 0 {
+		return
+	}
+	h := make(nearestHeap, 0, it.k)
+	seq := 0
+	for it.subIt.Next(ctx) {
+		id := it.subIt.Result()
+		f, ok := numericValue(it.qs.NameOf(id))
+		if !ok {
+			continue
+		}
+		r := nearestResult{dist: math.Abs(f - it.target), seq: seq}
+		seq++
+		if len(h) == it.k {
+			if top := h[0]; top.dist <= r.dist {
+				continue
+			}
+		}
+		tags := make(map[string]graph.Value)
+		it.subIt.TagResults(tags)
+		r.result = result{id: id, tags: tags}
+		if len(h) == it.k {
+			h[0] = r
+			heap.Fix(&h, 0)
+		} else {
+			heap.Push(&h, r)
+		}
+	}
+	if it.err = it.subIt.Err(); it.err != nil {
+		return
+	}
+	sort.Slice(h, h.less)
+	it.values = h
+	it.index = make(map[interface{}]int, len(h))
+	for i, r := range h {
+		k := graph.ToKey(r.id)
+		if _, ok := it.index[k]; !ok {
+			it.index[k] = i
+		}
+	}
+}
+
+// Next returns the next closest value.
+func (it *Nearest) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	if it.err != nil || it.cur+1 >= len(it.values) {
+		it.result = nil
+		return graph.NextLogOut(it, false)
+	}
+	it.cur++
+	it.result = &it.values[it.cur]
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Nearest) Err() error {
+	return it.err
+}
+
+func (it *Nearest) Result() graph.Value {
+	if it.result == nil {
+		return nil
+	}
+	return it.result.id
+}
+
+// Contains checks if the value is one of the closest values.
+func (it *Nearest) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	i, ok := it.index[graph.ToKey(val)]
+	if !ok {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = &it.values[i]
+	return graph.ContainsLogOut(it, val, true)
+}
+
+// NextPath always returns false, since only one path is kept for each result.
+func (it *Nearest) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *Nearest) Close() error {
+	it.values, it.index = nil, nil
+	it.hasRun = false
+	return it.subIt.Close()
+}
+
+func (it *Nearest) Type() graph.Type { return graph.Nearest }
+
+func (it *Nearest) Optimize() (graph.Iterator, bool) {
+	sub, optimized := it.subIt.Optimize()
+	it.subIt = sub
+	if sub.Type() == graph.Null {
+		return sub, true
+	}
+	return it, optimized
+}
+
+// Stats accounts for scanning all the results of the sub-iterator before the first one
+// can be returned.
+func (it *Nearest) Stats() graph.IteratorStats {
+	sub := it.subIt.Stats()
+	st := graph.IteratorStats{
+		NextCost:     sub.NextCost,
+		ContainsCost: sub.NextCost * sub.Size,
+		Size:         sub.Size,
+	}
+	if st.Size > int64(it.k) {
+		st.Size = int64(it.k)
+	}
+	if it.hasRun {
+		st.ContainsCost = 1
+		st.Size, st.ExactSize = int64(len(it.values)), true
+	} else {
+		st.NextCost += sub.NextCost * sub.Size
+	}
+	return st
+}
+
+func (it *Nearest) Size() (int64, bool) {
+	st := it.Stats()
+	return st.Size, st.ExactSize
+}
+
+func (it *Nearest) String() string {
+	return fmt.Sprintf("Nearest(%v, %d)", it.target, it.k)
+}
@@ -0,0 +1,68 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+var nearestStore = &graphmock.Oldstore{Data: []string{"10", "3", "7", "foo", "5", "8", "-2", "6"}, Parse: true}
+
+func nearestFixedIterator() *Fixed {
+	f := NewFixed()
+	for i := range nearestStore.Data {
+		f.Add(Int64Node(i))
+	}
+	return f
+}
+
+func TestNearest(t *testing.T) {
+	ctx := context.TODO()
+	for _, c := range []struct {
+		target float64
+		k      int
+		expect []int
+	}{
+		// ties are returned in the order of the sub-iterator
+		{target: 6, k: 3, expect: []int{7, 2, 4}},
+		{target: 6.4, k: 2, expect: []int{7, 2}},
+		{target: -100, k: 2, expect: []int{6, 1}},
+		{target: 6, k: 100, expect: []int{7, 2, 4, 5, 1, 0, 6}},
+		{target: 6, k: 0, expect: nil},
+	} {
+		it := NewNearest(nearestStore, nearestFixedIterator(), c.target, c.k)
+		if got := iterated(it); !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("unexpected results for %v, %d: got:%v expected:%v", c.target, c.k, got, c.expect)
+		}
+		if n, exact := it.Size(); n != int64(len(c.expect)) || !exact {
+			t.Errorf("unexpected size: %d, %v", n, exact)
+		}
+		it.Reset()
+		if got := iterated(it); !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("unexpected results after reset: %v", got)
+		}
+	}
+
+	it := NewNearest(nearestStore, nearestFixedIterator(), 6, 3)
+	for _, c := range []struct {
+		v      Int64Node
+		expect bool
+	}{{7, true}, {4, true}, {5, false}, {3, false}} {
+		if ok := it.Contains(ctx, c.v); ok != c.expect {
+			t.Errorf("unexpected contains result for %v: %v", c.v, ok)
+		}
+	}
+
+	d := graph.DescribeIteratorFor(nearestStore, it)
+	it2, err := graph.BuildFromDescription(nearestStore, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := iterated(it2); !reflect.DeepEqual(got, []int{7, 2, 4}) {
+		t.Errorf("unexpected results of a rebuilt iterator: %v", got)
+	}
+}
@@ -9,7 +9,9 @@ import (
 var _ graph.Iterator = &Not{}
 
 // Not iterator acts like a complement for the primary iterator.
-// It will return all the vertices which are not part of the primary iterator.
+// It will return all the vertices of the all iterator which are not part of the
+// primary iterator. The all iterator may be a subset of nodes, for example, nodes
+// of a given type (see NewNotOfType).
 type Not struct {
 	uid       uint64
 	tags      graph.Tagger
@@ -97,6 +99,12 @@ func (it *Not) Contains(ctx context.Context, val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
 	it.runstats.Contains += 1
 
+	// the all iterator only needs to be checked if it's a subset of nodes
+	if it.allIt.Type() != graph.All && !it.allIt.Contains(ctx, val) {
+		it.err = it.allIt.Err()
+		return graph.ContainsLogOut(it, val, false)
+	}
+
 	if it.primaryIt.Contains(ctx, val) {
 		return graph.ContainsLogOut(it, val, false)
 	}
@@ -138,6 +146,13 @@ func (it *Not) Optimize() (graph.Iterator, bool) {
 	if optimized {
 		it.primaryIt = optimizedPrimaryIt
 	}
+	if optimizedAllIt, optimized := it.allIt.Optimize(); optimized {
+		it.allIt = optimizedAllIt
+	}
+	if it.allIt.Type() == graph.Null {
+		it.primaryIt.Close()
+		return it.allIt, true
+	}
 	it.primaryIt = NewMaterialize(it.primaryIt)
 	return it, false
 }
@@ -145,10 +160,19 @@ func (it *Not) Optimize() (graph.Iterator, bool) {
 func (it *Not) Stats() graph.IteratorStats {
 	primaryStats := it.primaryIt.Stats()
 	allStats := it.allIt.Stats()
+	// excluded values may be missing from the all iterator
+	size := allStats.Size - primaryStats.Size
+	if size < 0 {
+		size = 0
+	}
+	containsCost := primaryStats.ContainsCost
+	if it.allIt.Type() != graph.All {
+		containsCost += allStats.ContainsCost
+	}
 	return graph.IteratorStats{
 		NextCost:     allStats.NextCost + primaryStats.ContainsCost,
-		ContainsCost: primaryStats.ContainsCost,
-		Size:         allStats.Size - primaryStats.Size,
+		ContainsCost: containsCost,
+		Size:         size,
 		ExactSize:    false,
 		Next:         it.runstats.Next,
 		Contains:     it.runstats.Contains,
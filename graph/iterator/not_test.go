@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph/graphmock"
 	. "github.com/cayleygraph/cayley/graph/iterator"
 )
 
@@ -53,7 +54,7 @@ func TestNotIteratorBasics(t *testing.T) {
 func TestNotIteratorErr(t *testing.T) {
 	ctx := context.TODO()
 	wantErr := errors.New("unique")
-	allIt := newTestIterator(false, wantErr)
+	allIt := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	toComplementIt := NewFixed()
 
@@ -64,6 +64,7 @@ func (it *Optional) UID() uint64 {
 func (it *Optional) Reset() {
 	it.subIt.Reset()
 	it.lastCheck = false
+	it.result = nil
 }
 
 func (it *Optional) Close() error {
@@ -88,6 +89,11 @@ func (it *Optional) Result() graph.Value {
 	return it.result
 }
 
+// Matched reports if the subiterator matched the last checked value.
+func (it *Optional) Matched() bool {
+	return it.lastCheck
+}
+
 // Optional iterator cannot be Next()'ed.
 func (it *Optional) Next(ctx context.Context) bool {
 	clog.Errorf("Nexting an un-nextable iterator: %T", it)
@@ -126,14 +132,15 @@ func (it *Optional) Contains(ctx context.Context, val graph.Value) bool {
 	return true
 }
 
-// If we failed the check, then the subiterator should not contribute to the result
-// set. Otherwise, go ahead and tag it.
+// If we failed the check, then neither the optional nor the subiterator should
+// contribute to the result set. Otherwise, go ahead and tag it. Nested optionals
+// are only asked for tags if the outer one matched, thus each level is scoped
+// to its own match.
 func (it *Optional) TagResults(dst map[string]graph.Value) {
-	it.tags.TagResult(dst, it.Result())
-
-	if it.lastCheck == false {
+	if !it.lastCheck {
 		return
 	}
+	it.tags.TagResult(dst, it.Result())
 	it.subIt.TagResults(dst)
 }
 
@@ -156,11 +163,15 @@ func (it *Optional) Optimize() (graph.Iterator, bool) {
 }
 
 // We're only as expensive as our subiterator. Except, we can't be nexted.
+//
+// Since an optional matches everything, the size is only an estimate of how many
+// values the subiterator matches. And ignores it, so the size of the optional is
+// effectively the size of the And it belongs to.
 func (it *Optional) Stats() graph.IteratorStats {
 	subStats := it.subIt.Stats()
 	return graph.IteratorStats{
 		ContainsCost: subStats.ContainsCost,
-		NextCost:     int64(1 << 62),
+		NextCost:     MaxCost,
 		// If it's empty, pretend like it's not.
 		Size:      subStats.Size + 1,
 		ExactSize: subStats.ExactSize,
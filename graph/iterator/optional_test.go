@@ -0,0 +1,123 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+// newNestedOptional builds All(1-4) & Optional(X & Optional(Y)), with X = {1, 2} and Y = {1, 3}.
+func newNestedOptional() (graph.Iterator, *Optional, *Optional) {
+	x := NewFixed(Int64Node(1), Int64Node(2))
+	x.Tagger().Add("x")
+	y := NewFixed(Int64Node(1), Int64Node(3))
+	y.Tagger().Add("y")
+	inner := NewOptional(y)
+	inner.Tagger().Add("inner")
+	outer := NewOptional(NewAnd(nil, x, inner))
+	outer.Tagger().Add("outer")
+	return NewAnd(nil, NewInt64(1, 4, true), outer), outer, inner
+}
+
+func TestNestedOptional(t *testing.T) {
+	ctx := context.TODO()
+	// all four combinations of matches for X and Y
+	expect := map[Int64Node][]string{
+		1: {"inner", "outer", "x", "y"},
+		2: {"outer", "x"},
+		3: nil,
+		4: nil,
+	}
+	for _, optimize := range []bool{false, true} {
+		it, outer, inner := newNestedOptional()
+		if optimize {
+			it, _ = it.Optimize()
+		}
+		n := 0
+		for it.Next(ctx) {
+			n++
+			v := it.Result().(Int64Node)
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			var got []string
+			for tag, tv := range tags {
+				if tv != v {
+					t.Errorf("unexpected value for tag %q: %v vs %v", tag, tv, v)
+				}
+				got = append(got, tag)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, expect[v]) {
+				t.Errorf("unexpected tags for %v (optimized: %v): %v vs %v", v, optimize, got, expect[v])
+			}
+			if !optimize {
+				if outer.Matched() != (v <= 2) {
+					t.Errorf("unexpected outer match for %v", v)
+				}
+				// inner level reports its own state only when the outer one matched
+				if v <= 2 && inner.Matched() != (v == 1) {
+					t.Errorf("unexpected inner match for %v", v)
+				}
+			}
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		} else if n != len(expect) {
+			t.Errorf("expected %d results, got %d", len(expect), n)
+		}
+	}
+}
+
+func TestOptionalStats(t *testing.T) {
+	sub := NewInt64(1, 3, true)
+	opt := NewOptional(sub)
+	st, sst := opt.Stats(), sub.Stats()
+	if st.ContainsCost != sst.ContainsCost {
+		t.Errorf("unexpected contains cost: %d vs %d", st.ContainsCost, sst.ContainsCost)
+	}
+	if graph.CanNext(opt) {
+		t.Error("optional should not be nexted")
+	}
+
+	// optional never restricts the results of And
+	base := NewInt64(1, 100, true)
+	and := NewAnd(nil, base, opt)
+	if sz, _ := and.Size(); sz != 100 {
+		t.Errorf("unexpected size: %d", sz)
+	}
+	if st := and.Stats(); st.Size != 100 {
+		t.Errorf("unexpected size in stats: %d", st.Size)
+	}
+	// even when the optional is the first sub-iterator
+	and = NewAnd(nil, NewOptional(NewInt64(1, 3, true)), NewInt64(1, 100, true))
+	opt2, _ := and.Optimize()
+	if sz, _ := opt2.Size(); sz != 100 {
+		t.Errorf("unexpected size: %d", sz)
+	}
+	if n, _ := graph.Iterate(context.TODO(), opt2).Count(); n != 100 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+}
+
+func TestOptionalMaxCost(t *testing.T) {
+	opt := NewOptional(NewFixed(Int64Node(1)))
+	if st := opt.Stats(); st.NextCost != MaxCost {
+		t.Errorf("expected Next cost of optional to be MaxCost, got %d", st.NextCost)
+	}
+
+	defer func(c int64) { MaxCost = c }(MaxCost)
+	MaxCost = 1000
+	if st := opt.Stats(); st.NextCost != 1000 {
+		t.Errorf("expected overridden MaxCost to be used, got %d", st.NextCost)
+	}
+	// optional must never become a primary iterator of And
+	and := NewAnd(nil, opt, NewInt64(1, 4, true))
+	it, _ := and.Optimize()
+	if sub := it.SubIterators()[0]; sub.Type() == graph.Optional {
+		t.Errorf("optional was chosen as a primary iterator: %v", it)
+	}
+}
@@ -20,14 +20,41 @@ package iterator
 //
 // Never reorders the iterators from the order they arrive. It is either the union or the first one.
 // May return the same value twice -- once for each branch.
+//
+// An Or without branches matches nothing, as Null does. Optimize replaces it with Null,
+// and an Or with a single branch is replaced with that branch.
+//
+// Optionally, Or can abandon branches which calls block for longer than a given timeout.
+// See SetBranchTimeout.
+//
+// Optionally, Or can check branches that match more often first in Contains. See SetAdaptive.
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
 )
 
-var _ graph.Iterator = &Or{}
+var (
+	_ graph.Iterator  = &Or{}
+	_ graph.Truncater = &Or{}
+)
+
+// ErrBranchTimeout is returned by Or with a branch timeout when some branches were
+// abandoned because their calls took too long. Results of other branches are
+// still returned, thus the error indicates that the result set is partial.
+type ErrBranchTimeout struct {
+	Branches []int // indexes of abandoned branches
+	Timeout  time.Duration
+}
+
+func (e *ErrBranchTimeout) Error() string {
+	return fmt.Sprintf("or: branches %v timed out after %v; results are partial", e.Branches, e.Timeout)
+}
 
 type Or struct {
 	uid               uint64
@@ -37,8 +64,30 @@ type Or struct {
 	currentIterator   int
 	result            graph.Value
 	err               error
+	checking          bool // last result was produced by Contains
+
+	timeout   time.Duration   // per-branch timeout of calls; zero means no timeout
+	workers   []*branchWorker // started on the first call of each branch, if timeout is set
+	abandoned map[int]struct{}
+	partial   *ErrBranchTimeout
+
+	adaptive bool
+	order    []int // order in which branches are checked by Contains
+	checkPos int   // position of the current branch in the order, if checking
+	matches  []branchRate
+	contains int // number of Contains calls since the last reorder
 }
 
+// branchRate records how many times a branch was checked and how many times it matched.
+type branchRate struct {
+	checks, hits int64
+}
+
+// adaptiveReorderEvery is the number of Contains calls after which an adaptive Or
+// reorders its branches.
+const adaptiveReorderEvery = 1000
+
+// NewOr creates a union of the given iterators. Nil iterators are ignored.
 func NewOr(sub ...graph.Iterator) *Or {
 	it := &Or{
 		uid:               NextUID(),
@@ -64,12 +113,86 @@ func (it *Or) UID() uint64 {
 	return it.uid
 }
 
-// Reset all internal iterators
+// SetBranchTimeout sets the maximal duration of a single Next, Contains or NextPath call
+// of a branch. If the call blocks for longer, the branch is abandoned and the iteration
+// continues with the next branch. In this case Err returns ErrBranchTimeout after all the
+// results of other branches were returned. Abandoned branches are closed as soon as their
+// pending call returns.
+//
+// With the timeout, calls of each branch are made by a separate goroutine, so the Or can
+// stop waiting for them. If the context is canceled, the pending call is not abandoned:
+// it's left to finish in the background, and following calls of the branch wait for it.
+//
+// Timeout is disabled by default, or if d is zero. It must be set before the iteration starts.
+func (it *Or) SetBranchTimeout(d time.Duration) {
+	it.timeout = d
+}
+
+// BranchTimeout returns the per-branch timeout of the iterator. See SetBranchTimeout.
+func (it *Or) BranchTimeout() time.Duration {
+	return it.timeout
+}
+
+// SetAdaptive enables or disables adaptive ordering of branches in Contains.
+//
+// An adaptive Or tracks how often each branch matches the checked values, and periodically
+// reorders branches to check the ones with the highest rate of matches first. It reduces the
+// number of checks made until the first matching branch in long Contains loops, if some
+// branches match more often than the others.
+//
+// Only the order of Contains checks is changed: Next and SubIterators keep the original
+// order of branches. Adaptive ordering is disabled by default.
+func (it *Or) SetAdaptive(v bool) {
+	it.adaptive = v
+}
+
+// Adaptive reports if adaptive ordering of branches is enabled. See SetAdaptive.
+func (it *Or) Adaptive() bool {
+	return it.adaptive
+}
+
+// ContainsOrder returns indexes of branches in the order they are checked by Contains.
+// The returned slice must not be modified.
+func (it *Or) ContainsOrder() []int {
+	return it.order
+}
+
+// reorder sorts branches by the rate of matches, and decays the statistics, so the order
+// can follow changes in the checked values.
+func (it *Or) reorder() {
+	it.contains = 0
+	rate := func(i int) branchRate { return it.matches[it.order[i]] }
+	sort.SliceStable(it.order, func(i, j int) bool {
+		a, b := rate(i), rate(j)
+		// a.hits/a.checks > b.hits/b.checks; branches that were never checked go last
+		return a.hits*b.checks > b.hits*a.checks || (a.checks != 0 && b.checks == 0)
+	})
+	for i := range it.matches {
+		it.matches[i].checks /= 2
+		it.matches[i].hits /= 2
+	}
+}
+
+func (it *Or) isAbandoned(i int) bool {
+	_, ok := it.abandoned[i]
+	return ok
+}
+
+// Reset all internal iterators. Abandoned branches are not restored.
 func (it *Or) Reset() {
-	for _, sub := range it.internalIterators {
-		sub.Reset()
+	for i, sub := range it.internalIterators {
+		if it.isAbandoned(i) {
+			continue
+		} else if w := it.worker(i); w != nil {
+			// the branch may still run a call that was interrupted by the context
+			w.send(branchCall{fn: resetBranch})
+		} else {
+			sub.Reset()
+		}
 	}
 	it.currentIterator = -1
+	it.checking = false
+	it.err = nil
 }
 
 func (it *Or) Tagger() *graph.Tagger {
@@ -83,6 +206,9 @@ func (it *Or) Clone() graph.Iterator {
 	} else {
 		or = NewOr()
 	}
+	or.timeout = it.timeout
+	or.adaptive = it.adaptive
+	// abandoned branches are cloned as well: the clone gives them another chance
 	for _, sub := range it.internalIterators {
 		or.AddSubIterator(sub.Clone())
 	}
@@ -100,6 +226,9 @@ func (it *Or) SubIterators() []graph.Iterator {
 func (it *Or) TagResults(dst map[string]graph.Value) {
 	it.tags.TagResult(dst, it.Result())
 
+	if it.currentIterator < 0 || it.currentIterator >= len(it.internalIterators) {
+		return
+	}
 	it.internalIterators[it.currentIterator].TagResults(dst)
 }
 
@@ -108,7 +237,13 @@ func (it *Or) String() string {
 }
 
 // Add a subiterator to this Or graph.iterator. Order matters.
+// Nil iterators are ignored.
 func (it *Or) AddSubIterator(sub graph.Iterator) {
+	if sub == nil {
+		return
+	}
+	it.order = append(it.order, len(it.internalIterators))
+	it.matches = append(it.matches, branchRate{})
 	it.internalIterators = append(it.internalIterators, sub)
 }
 
@@ -116,10 +251,15 @@ func (it *Or) AddSubIterator(sub graph.Iterator) {
 // subiterators, it must produce from all subiterators -- unless it it
 // shortcircuiting, in which case, it is the first one that returns anything.
 func (it *Or) Next(ctx context.Context) bool {
-	if it.currentIterator >= len(it.internalIterators) {
+	if len(it.internalIterators) == 0 {
+		it.result = nil
+		return false
+	}
+	if it.currentIterator >= len(it.internalIterators) || it.err != nil {
 		return false
 	}
 	graph.NextLogIn(it)
+	it.checking = false
 	var first bool
 	for {
 		if it.currentIterator == -1 {
@@ -128,13 +268,18 @@ func (it *Or) Next(ctx context.Context) bool {
 		}
 		curIt := it.internalIterators[it.currentIterator]
 
-		if curIt.Next(ctx) {
+		if it.isAbandoned(it.currentIterator) {
+			// skip it
+		} else if ok, done := it.callSub(ctx, it.currentIterator, nextBranch); !done {
+			if it.err != nil {
+				// context was canceled
+				return graph.NextLogOut(it, false)
+			}
+			// branch timed out, try the next one
+		} else if ok {
 			it.result = curIt.Result()
 			return graph.NextLogOut(it, true)
-		}
-
-		it.err = curIt.Err()
-		if it.err != nil {
+		} else if it.setErr(curIt.Err()) {
 			return graph.NextLogOut(it, false)
 		}
 
@@ -150,8 +295,177 @@ func (it *Or) Next(ctx context.Context) bool {
 	return graph.NextLogOut(it, false)
 }
 
+// branchCall is a single call of a branch made by its worker.
+type branchCall struct {
+	ctx    context.Context
+	fn     func(ctx context.Context, sub graph.Iterator) bool
+	res    chan bool // buffered; nil if the result is not awaited
+	cancel func()
+	last   bool // the worker stops after this call
+}
+
+// branchWorker makes all calls of a single branch in a dedicated goroutine, in the
+// order they were sent. Thus the Or can stop waiting for a call that takes too long,
+// while the branch is never accessed concurrently.
+type branchWorker struct {
+	sub     graph.Iterator
+	wake    chan struct{}
+	mu      sync.Mutex
+	queue   []branchCall
+	closing bool // Close was sent
+}
+
+func newBranchWorker(sub graph.Iterator) *branchWorker {
+	w := &branchWorker{sub: sub, wake: make(chan struct{}, 1)}
+	go w.run()
+	return w
+}
+
+func (w *branchWorker) send(c branchCall) {
+	w.mu.Lock()
+	w.queue = append(w.queue, c)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *branchWorker) pop() (branchCall, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.queue) == 0 {
+		return branchCall{}, false
+	}
+	c := w.queue[0]
+	w.queue = w.queue[1:]
+	return c, true
+}
+
+func (w *branchWorker) run() {
+	for range w.wake {
+		for {
+			c, ok := w.pop()
+			if !ok {
+				break
+			}
+			ctx := c.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			v := c.fn(ctx, w.sub)
+			if c.cancel != nil {
+				c.cancel()
+			}
+			if c.res != nil {
+				c.res <- v
+			}
+			if c.last {
+				return
+			}
+		}
+	}
+}
+
+func resetBranch(_ context.Context, sub graph.Iterator) bool {
+	sub.Reset()
+	return true
+}
+
+func nextBranch(ctx context.Context, sub graph.Iterator) bool {
+	return sub.Next(ctx)
+}
+
+func nextPathBranch(ctx context.Context, sub graph.Iterator) bool {
+	return sub.NextPath(ctx)
+}
+
+// worker returns a worker of the branch, or nil if it was not started.
+func (it *Or) worker(i int) *branchWorker {
+	if i < len(it.workers) {
+		return it.workers[i]
+	}
+	return nil
+}
+
+// startWorker returns a worker of the branch, starting it if the branch timeout is set.
+// It returns nil if the branch should be called directly.
+func (it *Or) startWorker(i int) *branchWorker {
+	if w := it.worker(i); w != nil {
+		return w
+	} else if it.timeout <= 0 {
+		return nil
+	}
+	for len(it.workers) < len(it.internalIterators) {
+		it.workers = append(it.workers, nil)
+	}
+	w := newBranchWorker(it.internalIterators[i])
+	it.workers[i] = w
+	return w
+}
+
+// callSub makes a call of the branch i, respecting the branch timeout. If the call takes
+// too long, the branch is abandoned. If the context is canceled, the error is recorded,
+// but the branch is kept. In both cases done is false.
+func (it *Or) callSub(ctx context.Context, i int, fn func(ctx context.Context, sub graph.Iterator) bool) (ok, done bool) {
+	w := it.startWorker(i)
+	if w == nil {
+		return fn(ctx, it.internalIterators[i]), true
+	}
+	// branch context is only canceled when we abandon it, to not affect its results
+	bctx, cancel := context.WithCancel(ctx)
+	res := make(chan bool, 1)
+	w.send(branchCall{ctx: bctx, fn: fn, res: res, cancel: cancel})
+	timer := time.NewTimer(it.timeout)
+	defer timer.Stop()
+	select {
+	case ok = <-res:
+		return ok, true
+	case <-timer.C:
+		cancel()
+		if it.partial == nil {
+			it.partial = &ErrBranchTimeout{Timeout: it.timeout}
+		}
+		it.partial.Branches = append(it.partial.Branches, i)
+		if it.abandoned == nil {
+			it.abandoned = make(map[int]struct{})
+		}
+		it.abandoned[i] = struct{}{}
+	case <-ctx.Done():
+		// the call will notice the cancellation as well; following calls are queued after it
+		it.err = ctx.Err()
+	}
+	return false, false
+}
+
+// setErr records the first error of branches. All branches are closed right away
+// to release their resources, instead of waiting for an explicit Close.
+// It returns false if there is no error.
+func (it *Or) setErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if it.err == nil {
+		it.err = err
+		it.Close()
+	}
+	return true
+}
+
+// Truncated reports if some branches were abandoned because of the branch timeout.
+func (it *Or) Truncated() bool {
+	return it.partial != nil
+}
+
+// Err returns an error of the iteration. If some branches were abandoned because of
+// the branch timeout, and no other error occurred, ErrBranchTimeout is returned.
 func (it *Or) Err() error {
-	return it.err
+	if it.err != nil {
+		return it.err
+	} else if it.partial != nil {
+		return it.partial
+	}
+	return nil
 }
 
 func (it *Or) Result() graph.Value {
@@ -160,11 +474,37 @@ func (it *Or) Result() graph.Value {
 
 // Checks a value against the iterators, in order.
 func (it *Or) subItsContain(ctx context.Context, val graph.Value) (bool, error) {
+	if it.adaptive {
+		if it.contains++; it.contains >= adaptiveReorderEvery {
+			it.reorder()
+		}
+	}
 	var subIsGood = false
-	for i, sub := range it.internalIterators {
-		subIsGood = sub.Contains(ctx, val)
+	for p, i := range it.order {
+		if it.isAbandoned(i) {
+			continue
+		}
+		sub := it.internalIterators[i]
+		ok, done := it.callSub(ctx, i, func(ctx context.Context, sub graph.Iterator) bool {
+			return sub.Contains(ctx, val)
+		})
+		if !done {
+			if it.err != nil {
+				return false, it.err
+			}
+			// branch timed out, check the next one
+			continue
+		}
+		subIsGood = ok
+		if it.adaptive {
+			it.matches[i].checks++
+		}
 		if subIsGood {
+			if it.adaptive {
+				it.matches[i].hits++
+			}
 			it.currentIterator = i
+			it.checkPos = p
 			break
 		}
 
@@ -179,13 +519,17 @@ func (it *Or) subItsContain(ctx context.Context, val graph.Value) (bool, error)
 // Check a value against the entire graph.iterator, in order.
 func (it *Or) Contains(ctx context.Context, val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
+	it.checking = false
+	if it.err != nil {
+		return graph.ContainsLogOut(it, val, false)
+	}
 	anyGood, err := it.subItsContain(ctx, val)
-	if err != nil {
-		it.err = err
+	if it.setErr(err) {
 		return false
 	} else if !anyGood {
 		return graph.ContainsLogOut(it, val, false)
 	}
+	it.checking = true
 	it.result = val
 	return graph.ContainsLogOut(it, val, true)
 }
@@ -220,16 +564,53 @@ func (it *Or) Size() (int64, bool) {
 
 // An Or has no NextPath of its own -- that is, there are no other values
 // which satisfy our previous result that are not the result itself. Our
-// subiterators might, however, so just pass the call recursively. In the case of
-// shortcircuiting, only allow new results from the currently checked graph.iterator
+// subiterators might, however, so just pass the call recursively.
+//
+// If the result was produced by Contains, other branches may contain the same
+// value with different tags. Thus, after paths of the current branch are exhausted,
+// the value is checked against the branches that follow it in the order of Contains
+// (in both normal and shortcircuiting modes), and their paths are returned as well. This is not needed
+// for Next, since the normal Or will return the value again for each branch,
+// while the shortcircuiting one only returns results of a single branch.
 func (it *Or) NextPath(ctx context.Context) bool {
-	if it.currentIterator != -1 {
+	if it.currentIterator == -1 || it.currentIterator >= len(it.internalIterators) {
+		return false
+	}
+	if !it.isAbandoned(it.currentIterator) {
 		currIt := it.internalIterators[it.currentIterator]
-		ok := currIt.NextPath(ctx)
-		if !ok {
-			it.err = currIt.Err()
+		if ok, done := it.callSub(ctx, it.currentIterator, nextPathBranch); !done {
+			if it.err != nil {
+				return false
+			}
+		} else if ok {
+			return true
+		} else if it.setErr(currIt.Err()) {
+			return false
+		}
+	}
+	if !it.checking {
+		return false
+	}
+	for p := it.checkPos + 1; p < len(it.order); p++ {
+		i := it.order[p]
+		if it.isAbandoned(i) {
+			continue
+		}
+		sub := it.internalIterators[i]
+		val := it.result
+		if ok, done := it.callSub(ctx, i, func(ctx context.Context, sub graph.Iterator) bool {
+			return sub.Contains(ctx, val)
+		}); !done {
+			if it.err != nil {
+				return false
+			}
+		} else if ok {
+			it.currentIterator = i
+			it.checkPos = p
+			return true
+		} else if it.setErr(sub.Err()) {
+			return false
 		}
-		return ok
 	}
 	return false
 }
@@ -245,8 +626,13 @@ func (it *Or) Close() error {
 	it.cleanUp()
 
 	var err error
-	for _, sub := range it.internalIterators {
-		_err := sub.Close()
+	for i, sub := range it.internalIterators {
+		var _err error
+		if w := it.worker(i); w != nil {
+			_err = it.closeWorker(i, w)
+		} else {
+			_err = sub.Close()
+		}
 		if _err != nil && err == nil {
 			err = _err
 		}
@@ -255,19 +641,67 @@ func (it *Or) Close() error {
 	return err
 }
 
+// closeWorker closes the branch by its worker, after all pending calls. Abandoned branches
+// are closed in the background, when their pending call returns. Other branches are waited
+// for, within the branch timeout.
+func (it *Or) closeWorker(i int, w *branchWorker) error {
+	w.mu.Lock()
+	closing := w.closing
+	w.closing = true
+	w.mu.Unlock()
+	if closing {
+		return nil
+	}
+	var err error
+	res := make(chan bool, 1)
+	w.send(branchCall{fn: func(_ context.Context, sub graph.Iterator) bool {
+		err = sub.Close()
+		return true
+	}, res: res, last: true})
+	if it.isAbandoned(i) {
+		return nil
+	}
+	timer := time.NewTimer(it.timeout)
+	defer timer.Stop()
+	select {
+	case <-res:
+		return err
+	case <-timer.C:
+		return nil
+	}
+}
+
 func (it *Or) Optimize() (graph.Iterator, bool) {
 	old := it.SubIterators()
-	optIts := optimizeSubIterators(old)
+	optIts := optimizeSubIterators(old, false)
 	// Close the replaced iterators (they ought to close themselves, but Close()
 	// is idempotent, so this just protects against any machinations).
 	closeIteratorList(old, nil)
 	newOr := NewOr()
 	newOr.isShortCircuiting = it.isShortCircuiting
+	newOr.timeout = it.timeout
+	newOr.adaptive = it.adaptive
 
-	// Add the subiterators in order.
+	// Add the subiterators in order, skipping the ones that are known to be empty.
 	for _, o := range optIts {
+		if o.Type() == graph.Null {
+			o.Close()
+			continue
+		}
 		newOr.AddSubIterator(o)
 	}
+	if len(newOr.internalIterators) == 0 {
+		it.cleanUp()
+		return NewNull(), true
+	}
+	// A single branch is equivalent to the Or itself, unless it may be abandoned
+	// because of the branch timeout.
+	if len(newOr.internalIterators) == 1 && newOr.timeout <= 0 {
+		out := newOr.internalIterators[0]
+		out.Tagger().CopyFrom(it)
+		it.cleanUp()
+		return out, true
+	}
 
 	// Move the tags hanging on us (like any good replacement).
 	newOr.tags.CopyFrom(it)
@@ -19,8 +19,10 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
 	. "github.com/cayleygraph/cayley/graph/iterator"
 )
 
@@ -162,7 +164,7 @@ func TestShortCircuitingOrBasics(t *testing.T) {
 func TestOrIteratorErr(t *testing.T) {
 	ctx := context.TODO()
 	wantErr := errors.New("unique")
-	orErr := newTestIterator(false, wantErr)
+	orErr := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	fix1 := NewFixed(Int64Node(1))
 
@@ -190,7 +192,7 @@ func TestOrIteratorErr(t *testing.T) {
 func TestShortCircuitOrIteratorErr(t *testing.T) {
 	ctx := context.TODO()
 	wantErr := errors.New("unique")
-	orErr := newTestIterator(false, wantErr)
+	orErr := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	or := NewOr(
 		orErr,
@@ -204,3 +206,410 @@ func TestShortCircuitOrIteratorErr(t *testing.T) {
 		t.Errorf("Or iterator did not pass through underlying Err")
 	}
 }
+
+// blockingIterator blocks on Next, Contains and NextPath until released.
+type blockingIterator struct {
+	*Fixed
+	release chan struct{}
+	started chan struct{} // signaled when a blocking call starts
+	closed  chan struct{}
+}
+
+func newBlockingIterator(vals ...graph.Value) *blockingIterator {
+	return &blockingIterator{
+		Fixed:   NewFixed(vals...),
+		release: make(chan struct{}),
+		started: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (it *blockingIterator) block() {
+	select {
+	case it.started <- struct{}{}:
+	default:
+	}
+	<-it.release
+}
+
+func (it *blockingIterator) Next(ctx context.Context) bool {
+	it.block()
+	return it.Fixed.Next(ctx)
+}
+
+func (it *blockingIterator) Contains(ctx context.Context, v graph.Value) bool {
+	it.block()
+	return it.Fixed.Contains(ctx, v)
+}
+
+func (it *blockingIterator) NextPath(ctx context.Context) bool {
+	it.block()
+	return it.Fixed.NextPath(ctx)
+}
+
+func (it *blockingIterator) Close() error {
+	close(it.closed)
+	return nil
+}
+
+// branchTimeout is long enough for branches that do not block to never time out.
+const branchTimeout = 200 * time.Millisecond
+
+func expectBranchTimeout(t testing.TB, or *Or, branches ...int) {
+	err, ok := or.Err().(*ErrBranchTimeout)
+	if !ok {
+		t.Fatalf("expected branch timeout error, got: %v", or.Err())
+	} else if !reflect.DeepEqual(err.Branches, branches) {
+		t.Errorf("unexpected abandoned branches: %v", err.Branches)
+	}
+}
+
+func TestOrIteratorBranchTimeout(t *testing.T) {
+	ctx := context.TODO()
+	slow := newBlockingIterator(Int64Node(5))
+	or := NewOr(
+		NewFixed(Int64Node(1)),
+		slow,
+		NewFixed(Int64Node(2), Int64Node(3)),
+	)
+	or.SetBranchTimeout(branchTimeout)
+
+	expect := []int{1, 2, 3}
+	if got := iterated(or); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate Or with timeout correctly, got:%v expect:%v", got, expect)
+	}
+	expectBranchTimeout(t, or, 1)
+	if or.Contains(ctx, Int64Node(5)) {
+		t.Error("abandoned branch should not be checked")
+	}
+	if err := or.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-slow.closed:
+		t.Fatal("abandoned branch closed while Next is pending")
+	default:
+	}
+	close(slow.release)
+	<-slow.closed
+}
+
+func TestOrIteratorBranchTimeoutContains(t *testing.T) {
+	ctx := context.TODO()
+	slow := newBlockingIterator(Int64Node(2))
+	defer close(slow.release)
+	or := NewOr(NewFixed(Int64Node(1)), slow, NewFixed(Int64Node(2)))
+	or.SetBranchTimeout(branchTimeout)
+	defer or.Close()
+
+	if !or.Contains(ctx, Int64Node(2)) {
+		t.Fatal("expected the value to be found in the last branch")
+	}
+	expectBranchTimeout(t, or, 1)
+	if or.NextPath(ctx) {
+		t.Error("unexpected path from an abandoned branch")
+	}
+}
+
+func TestOrIteratorBranchTimeoutNextPath(t *testing.T) {
+	ctx := context.TODO()
+	slow := newBlockingIterator(Int64Node(1))
+	defer close(slow.release)
+	or := NewOr(slow, NewFixed(Int64Node(1)))
+	or.SetBranchTimeout(branchTimeout)
+	defer or.Close()
+
+	// let Contains pass, but block NextPath
+	go func() { slow.release <- struct{}{} }()
+	if !or.Contains(ctx, Int64Node(1)) {
+		t.Fatal("expected the value to be found in the first branch")
+	}
+	if !or.NextPath(ctx) {
+		t.Fatal("expected a path from the second branch")
+	}
+	expectBranchTimeout(t, or, 0)
+}
+
+func TestOrIteratorBranchTimeoutCancel(t *testing.T) {
+	slow := newBlockingIterator(Int64Node(5))
+	or := NewOr(slow, NewFixed(Int64Node(1)))
+	or.SetBranchTimeout(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-slow.started
+		cancel()
+	}()
+	if or.Next(ctx) {
+		t.Fatal("expected no results after cancellation")
+	} else if err := or.Err(); err != context.Canceled {
+		t.Fatalf("expected cancellation error, got: %v", err)
+	}
+	select {
+	case <-slow.closed:
+		t.Fatal("branch should not be closed after cancellation")
+	default:
+	}
+
+	// the branch is not abandoned, and can be used after the pending call returns
+	close(slow.release)
+	or.Reset()
+	if got, expect := iterated(or), []int{5, 1}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results after reset: %v vs %v", got, expect)
+	}
+	if err := or.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := or.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-slow.closed
+}
+
+func TestOrIteratorBranchTimeoutClone(t *testing.T) {
+	slow := newBlockingIterator(Int64Node(5))
+	defer close(slow.release)
+	or := NewOr(NewFixed(Int64Node(1)), slow)
+	or.SetBranchTimeout(branchTimeout)
+	defer or.Close()
+	iterated(or)
+	expectBranchTimeout(t, or, 1)
+
+	c := or.Clone().(*Or)
+	if err := c.Err(); err != nil {
+		t.Errorf("clone should not inherit errors: %v", err)
+	}
+	if n := len(c.SubIterators()); n != 2 {
+		t.Errorf("expected all branches to be cloned, got: %d", n)
+	}
+	if c.BranchTimeout() != branchTimeout {
+		t.Errorf("unexpected timeout of the clone: %v", c.BranchTimeout())
+	}
+}
+
+func TestOrIteratorBranchTimeoutDisabled(t *testing.T) {
+	or := NewOr(
+		NewFixed(Int64Node(1)),
+		NewFixed(Int64Node(2)),
+	)
+	if got := iterated(or); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("Failed to iterate Or correctly, got:%v", got)
+	}
+	if err := or.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrIteratorNextPathAcrossBranches(t *testing.T) {
+	ctx := context.TODO()
+	for _, short := range []bool{false, true} {
+		branch := func(via int64) graph.Iterator {
+			it := NewFixed(Int64Node(1), Int64Node(2))
+			it.Tagger().AddFixed("via", Int64Node(via))
+			return it
+		}
+		or := NewOr()
+		if short {
+			or = NewShortCircuitOr()
+		}
+		or.AddSubIterator(branch(10))
+		or.AddSubIterator(NewFixed(Int64Node(3)))
+		or.AddSubIterator(branch(20))
+
+		and := NewAnd(nil, NewFixed(Int64Node(2)), or)
+		var got []int64
+		collect := func() {
+			tags := make(map[string]graph.Value)
+			and.TagResults(tags)
+			got = append(got, int64(tags["via"].(Int64Node)))
+		}
+		for and.Next(ctx) {
+			collect()
+			for and.NextPath(ctx) {
+				collect()
+			}
+		}
+		if err := and.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if expect := []int64{10, 20}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("unexpected tags (short circuit: %v): %v vs %v", short, got, expect)
+		}
+	}
+}
+
+func TestOrIteratorBranchTimeoutTruncated(t *testing.T) {
+	slow := newBlockingIterator(Int64Node(5))
+	defer close(slow.release)
+	or := NewOr(NewFixed(Int64Node(1)), slow)
+	or.SetBranchTimeout(branchTimeout)
+	defer or.Close()
+	if or.Truncated() {
+		t.Fatal("iterator should not be truncated before iteration")
+	}
+	iterated(or)
+	if !or.Truncated() {
+		t.Error("iterator should be truncated when a branch times out")
+	}
+}
+
+func TestOrIteratorEmpty(t *testing.T) {
+	ctx := context.TODO()
+	for _, or := range []*Or{NewOr(), NewShortCircuitOr()} {
+		if or.Next(ctx) {
+			t.Errorf("expected no results from empty Or, got: %v", or.Result())
+		}
+		if err := or.Err(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if or.Contains(ctx, Int64Node(1)) {
+			t.Error("expected empty Or to contain nothing")
+		}
+		if or.NextPath(ctx) {
+			t.Error("expected no paths from empty Or")
+		}
+		tags := make(map[string]graph.Value)
+		or.TagResults(tags)
+		if n, exact := or.Size(); n != 0 || !exact {
+			t.Errorf("expected exact zero size, got: %d, %v", n, exact)
+		}
+		opt, changed := or.Optimize()
+		if !changed || opt.Type() != graph.Null {
+			t.Errorf("expected empty Or to be optimized to Null, got: %v", opt)
+		}
+	}
+}
+
+func TestOrIteratorSingle(t *testing.T) {
+	ctx := context.TODO()
+	fix := NewFixed(Int64Node(1), Int64Node(2))
+	or := NewOr(fix)
+	or.Tagger().Add("foo")
+	opt, changed := or.Optimize()
+	if !changed || opt.Type() != fix.Type() {
+		t.Fatalf("expected Or to be optimized to its only branch, got: %v", opt)
+	}
+	if !opt.Next(ctx) {
+		t.Fatal("expected a result")
+	}
+	tags := make(map[string]graph.Value)
+	opt.TagResults(tags)
+	if exp := map[string]graph.Value{"foo": Int64Node(1)}; !reflect.DeepEqual(tags, exp) {
+		t.Errorf("expected tags to be moved to the branch, got: %v", tags)
+	}
+
+	or = NewOr(NewFixed(Int64Node(1)))
+	or.SetBranchTimeout(time.Second)
+	if opt, _ = or.Optimize(); opt.Type() != graph.Or {
+		t.Errorf("expected Or with branch timeout to be kept, got: %v", opt)
+	}
+}
+
+func TestOrIteratorNil(t *testing.T) {
+	or := NewOr(nil, NewFixed(Int64Node(1)), nil)
+	or.AddSubIterator(nil)
+	if n := len(or.SubIterators()); n != 1 {
+		t.Fatalf("expected nil iterators to be ignored, got %d branches", n)
+	}
+	if got, exp := iterated(or), []int{1}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected results: %v vs %v", got, exp)
+	}
+	if got := iterated(NewOr(nil)); len(got) != 0 {
+		t.Errorf("expected no results from Or of nil iterators, got: %v", got)
+	}
+}
+
+// skewedOr returns an Or with three branches, where the last one contains most
+// of the values in [0, n), and other ones contain only a single value each.
+func skewedOr(n int, adaptive bool) (*Or, []*graphmock.Iterator) {
+	branch := func(via int64, vals ...graph.Value) *graphmock.Iterator {
+		it := graphmock.NewIterator(vals)
+		it.Tagger().AddFixed("via", Int64Node(via))
+		return it
+	}
+	var vals []graph.Value
+	for i := 2; i < n; i++ {
+		vals = append(vals, Int64Node(i))
+	}
+	// the first value is also in the last branch
+	subs := []*graphmock.Iterator{
+		branch(10, Int64Node(0)),
+		branch(20, Int64Node(1)),
+		branch(30, append(vals, Int64Node(0))...),
+	}
+	or := NewOr()
+	or.SetAdaptive(adaptive)
+	for _, sub := range subs {
+		or.AddSubIterator(sub)
+	}
+	return or, subs
+}
+
+func TestOrIteratorAdaptive(t *testing.T) {
+	ctx := context.TODO()
+	const n = 3000
+	checks := func(adaptive bool) int {
+		or, subs := skewedOr(n, adaptive)
+		for i := 0; i < n; i++ {
+			if !or.Contains(ctx, Int64Node(i%n)) {
+				t.Fatalf("expected value %d to be found", i)
+			}
+		}
+		total := 0
+		for _, sub := range subs {
+			total += sub.Calls.Contains
+		}
+		if adaptive {
+			if order := or.ContainsOrder(); order[0] != 2 {
+				t.Errorf("expected the last branch to be checked first: %v", order)
+			}
+		} else if order := or.ContainsOrder(); !reflect.DeepEqual(order, []int{0, 1, 2}) {
+			t.Errorf("unexpected order of branches: %v", order)
+		}
+		return total
+	}
+	fixed, adaptive := checks(false), checks(true)
+	if adaptive >= fixed*2/3 {
+		t.Errorf("expected less checks with adaptive ordering: %d vs %d", adaptive, fixed)
+	}
+
+	// Next keeps the original order, and all paths are returned after reordering
+	or, _ := skewedOr(n, true)
+	for i := 2; i < n; i++ {
+		or.Contains(ctx, Int64Node(i))
+	}
+	or.Reset()
+	if got := iterated(or); len(got) != n+1 || got[0] != 0 || got[1] != 1 {
+		t.Errorf("unexpected results: %v", got[:3])
+	}
+	var via []int64
+	and := NewAnd(nil, NewFixed(Int64Node(0)), or)
+	for and.Next(ctx) {
+		for ok := true; ok; ok = and.NextPath(ctx) {
+			tags := make(map[string]graph.Value)
+			and.TagResults(tags)
+			via = append(via, int64(tags["via"].(Int64Node)))
+		}
+	}
+	if expect := []int64{30, 10}; !reflect.DeepEqual(via, expect) {
+		t.Errorf("unexpected tags: %v vs %v", via, expect)
+	}
+}
+
+func BenchmarkOrAdaptive(b *testing.B) {
+	ctx := context.TODO()
+	const n = 3000
+	for _, adaptive := range []bool{false, true} {
+		name := "fixed"
+		if adaptive {
+			name = "adaptive"
+		}
+		b.Run(name, func(b *testing.B) {
+			or, _ := skewedOr(n, adaptive)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				or.Contains(ctx, Int64Node(i%n))
+			}
+		})
+	}
+}
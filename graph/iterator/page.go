@@ -0,0 +1,308 @@
+package iterator
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Page{}
+
+// EncodeCursor encodes the last value of the page as an opaque cursor token.
+func EncodeCursor(v quad.Value) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(graph.EncodeValue(v)))
+}
+
+// DecodeCursor decodes a value from the cursor token. An empty token is decoded as a nil
+// value, meaning that the first page is requested.
+func DecodeCursor(s string) (quad.Value, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	return graph.DecodeValue(string(data))
+}
+
+type pageResult struct {
+	result
+	val quad.Value
+	key string // encoded value; breaks ties between values that compare as equal
+}
+
+// pageLess defines a total order of values for pagination.
+func pageLess(a, b *pageResult) bool {
+	if c := CompareValues(a.val, b.val); c != 0 {
+		return c < 0
+	}
+	return a.key < b.key
+}
+
+// pageHeap is a max-heap of results that keeps the smallest values of the sub-iterator.
+type pageHeap []pageResult
+
+func (h pageHeap) Len() int            { return len(h) }
+func (h pageHeap) Less(i, j int) bool  { return pageLess(&h[j], &h[i]) }
+func (h pageHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *pageHeap) Push(x interface{}) { *h = append(*h, x.(pageResult)) }
+func (h *pageHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	x := old[n]
+	*h = old[:n]
+	return x
+}
+
+// Page iterator returns one page of distinct values of the sub-iterator, ordered by value.
+//
+// The page starts strictly after a given value, thus the last value of the page can be used
+// as a cursor for the next one (see Cursor). Unlike Skip, the cursor does not depend on
+// the position of values in the sub-iterator, so values inserted between requests for
+// different pages never cause already-seen values to be returned again, and never cause
+// values to be skipped. New values that are ordered before the cursor will not be returned.
+//
+// Only limit+1 values are kept in memory while scanning the sub-iterator.
+type Page struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     graph.QuadStore
+	subIt  graph.Iterator
+	after  *pageResult
+	limit  int64
+	values []pageResult
+	index  map[string]int
+	more   bool
+	hasRun bool
+	cur    int
+	result *pageResult
+	err    error
+}
+
+// NewPage creates a new iterator that returns at most limit values of the sub-iterator that
+// are ordered after a given value. If after is nil, the first page is returned. If limit is
+// not positive, all the remaining values are returned.
+func NewPage(qs graph.QuadStore, sub graph.Iterator, after quad.Value, limit int64) *Page {
+	it := &Page{
+		uid:   NextUID(),
+		qs:    qs,
+		subIt: sub,
+		limit: limit,
+		cur:   -1,
+	}
+	if after != nil {
+		it.after = &pageResult{val: after, key: graph.EncodeValue(after)}
+	}
+	return it
+}
+
+func (it *Page) UID() uint64 {
+	return it.uid
+}
+
+// After returns the value that the page starts after, or nil for the first page.
+func (it *Page) After() quad.Value {
+	if it.after == nil {
+		return nil
+	}
+	return it.after.val
+}
+
+// Limit returns the maximal number of values on the page.
+func (it *Page) Limit() int64 { return it.limit }
+
+// Cursor returns a cursor token for the next page, or an empty string if this page
+// is the last one. It scans the sub-iterator, if it was not done yet.
+func (it *Page) Cursor(ctx context.Context) string {
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	if !it.more || len(it.values) == 0 {
+		return ""
+	}
+	return EncodeCursor(it.values[len(it.values)-1].val)
+}
+
+// Reset rewinds the iterator. The page is kept, the sub-iterator is not re-run.
+func (it *Page) Reset() {
+	it.cur = -1
+	it.result = nil
+}
+
+func (it *Page) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Page) TagResults(dst map[string]graph.Value) {
+	if it.result == nil {
+		return
+	}
+	for tag, val := range it.result.tags {
+		dst[tag] = val
+	}
+	it.tags.TagResult(dst, it.result.id)
+}
+
+func (it *Page) Clone() graph.Iterator {
+	out := NewPage(it.qs, it.subIt.Clone(), it.After(), it.limit)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Page) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// run scans the sub-iterator and keeps limit+1 smallest values after the cursor.
+// An additional value is only used to check if there are more pages.
+func (it *Page) run(ctx context.Context) {
+	it.hasRun = true
+	var (
+		h    pageHeap
+		seen = make(map[string]struct{})
+	)
+	for it.subIt.Next(ctx) {
+		id := it.subIt.Result()
+		v := it.qs.NameOf(id)
+		if v == nil {
+			continue
+		}
+		r := pageResult{val: v, key: graph.EncodeValue(v)}
+		if it.after != nil && !pageLess(it.after, &r) {
+			continue
+		} else if _, ok := seen[r.key]; ok {
+			continue
+		}
+		full := it.limit > 0 && int64(len(h)) > it.limit
+		if full && !pageLess(&r, &h[0]) {
+			continue
+		}
+		tags := make(map[string]graph.Value)
+		it.subIt.TagResults(tags)
+		r.result = result{id: id, tags: tags}
+		seen[r.key] = struct{}{}
+		if full {
+			delete(seen, h[0].key)
+			h[0] = r
+			heap.Fix(&h, 0)
+		} else {
+			heap.Push(&h, r)
+		}
+	}
+	if it.err = it.subIt.Err(); it.err != nil {
+		return
+	}
+	sort.Slice(h, func(i, j int) bool { return pageLess(&h[i], &h[j]) })
+	if it.limit > 0 && int64(len(h)) > it.limit {
+		it.more = true
+		h = h[:it.limit]
+	}
+	it.values = h
+	it.index = make(map[string]int, len(h))
+	for i, r := range h {
+		it.index[r.key] = i
+	}
+}
+
+func (it *Page) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	if it.err != nil || it.cur+1 >= len(it.values) {
+		it.result = nil
+		return graph.NextLogOut(it, false)
+	}
+	it.cur++
+	it.result = &it.values[it.cur]
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Page) Err() error {
+	return it.err
+}
+
+func (it *Page) Result() graph.Value {
+	if it.result == nil {
+		return nil
+	}
+	return it.result.id
+}
+
+// Contains checks if the value is on the page.
+func (it *Page) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	v := it.qs.NameOf(val)
+	if v == nil {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	i, ok := it.index[graph.EncodeValue(v)]
+	if !ok {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = &it.values[i]
+	return graph.ContainsLogOut(it, val, true)
+}
+
+// NextPath always returns false, since each value is returned only once.
+func (it *Page) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *Page) Close() error {
+	it.values, it.index = nil, nil
+	it.hasRun = false
+	return it.subIt.Close()
+}
+
+func (it *Page) Type() graph.Type { return graph.Page }
+
+func (it *Page) Optimize() (graph.Iterator, bool) {
+	sub, optimized := it.subIt.Optimize()
+	it.subIt = sub
+	if sub.Type() == graph.Null {
+		return sub, true
+	}
+	return it, optimized
+}
+
+// Stats accounts for scanning all the results of the sub-iterator before the first one
+// can be returned.
+func (it *Page) Stats() graph.IteratorStats {
+	sub := it.subIt.Stats()
+	st := graph.IteratorStats{
+		NextCost:     sub.NextCost + sub.NextCost*sub.Size,
+		ContainsCost: sub.NextCost * sub.Size,
+		Size:         sub.Size,
+	}
+	if it.limit > 0 && st.Size > it.limit {
+		st.Size = it.limit
+	}
+	if it.hasRun {
+		st.NextCost, st.ContainsCost = sub.NextCost, 1
+		st.Size, st.ExactSize = int64(len(it.values)), true
+	}
+	return st
+}
+
+func (it *Page) Size() (int64, bool) {
+	st := it.Stats()
+	return st.Size, st.ExactSize
+}
+
+func (it *Page) String() string {
+	if it.after == nil {
+		return fmt.Sprintf("Page(%d)", it.limit)
+	}
+	return fmt.Sprintf("Page(%d, after %v)", it.limit, it.after.val)
+}
@@ -0,0 +1,169 @@
+package iterator_test
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// shuffledValues returns an iterator over values in a random order, as a backend
+// would do after its offsets were shifted by inserts.
+func shuffledValues(r *rand.Rand, vals []quad.Value) graph.Iterator {
+	fixed := NewFixed()
+	for _, i := range r.Perm(len(vals)) {
+		fixed.Add(graph.PreFetched(vals[i]))
+	}
+	return fixed
+}
+
+func readPage(t *testing.T, qs graph.QuadStore, it *Page) []quad.Value {
+	ctx := context.TODO()
+	var out []quad.Value
+	for it.Next(ctx) {
+		out = append(out, qs.NameOf(it.Result()))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestPageConcurrentInserts(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{}
+	r := rand.New(rand.NewSource(1))
+
+	var vals []quad.Value
+	expect := make(map[quad.Value]bool)
+	add := func(v quad.Value, visible bool) {
+		vals = append(vals, v)
+		// duplicates must not change the result
+		vals = append(vals, v)
+		expect[v] = visible
+	}
+	for i := 0; i < 20; i++ {
+		add(quad.Int(i*10), true)
+	}
+	add(quad.String("a"), true)
+	add(quad.IRI("b"), true)
+
+	var (
+		got    []quad.Value
+		cursor string
+		pages  int
+	)
+	for {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it := NewPage(qs, shuffledValues(r, vals), after, 3)
+		page := readPage(t, qs, it)
+		if len(page) == 0 {
+			t.Fatal("empty page")
+		}
+		got = append(got, page...)
+		pages++
+		if cursor = it.Cursor(ctx); cursor == "" {
+			break
+		}
+		var last float64
+		switch v := page[len(page)-1].(type) {
+		case quad.Int:
+			last = float64(v)
+		case quad.Float:
+			last = float64(v)
+		default:
+			continue
+		}
+		// values before the cursor are never returned
+		add(quad.Int(-pages), false)
+		add(quad.Float(last-0.25), false)
+		// values after the cursor are returned on the next pages
+		add(quad.Float(last+0.5), true)
+		add(quad.Int(1000+pages), true)
+		if pages > 100 {
+			t.Fatal("too many pages")
+		}
+	}
+
+	seen := make(map[quad.Value]bool)
+	for i, v := range got {
+		if seen[v] {
+			t.Errorf("duplicate value: %v", v)
+		}
+		seen[v] = true
+		if i > 0 && CompareValues(got[i-1], v) >= 0 {
+			t.Errorf("values are not ordered: %v, %v", got[i-1], v)
+		}
+	}
+	for v, visible := range expect {
+		if visible && !seen[v] {
+			t.Errorf("value was skipped: %v", v)
+		} else if !visible && seen[v] {
+			t.Errorf("value inserted before the cursor was returned: %v", v)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	ctx := context.TODO()
+	vals := []quad.Value{quad.Int(3), quad.Int(1), quad.Float(1), quad.Int(2), quad.String("x")}
+	qs := &graphmock.Store{}
+	for _, v := range vals {
+		qs.Data = append(qs.Data, quad.Make(quad.IRI("s"), quad.IRI("p"), v, nil))
+	}
+	newIt := func(after quad.Value, limit int64) *Page {
+		fixed := NewFixed()
+		for _, v := range vals {
+			fixed.Add(graph.PreFetched(v))
+		}
+		return NewPage(qs, fixed, after, limit)
+	}
+
+	it := newIt(nil, 0)
+	all := readPage(t, qs, it)
+	if len(all) != len(vals) {
+		t.Fatalf("unexpected results: %v", all)
+	} else if c := it.Cursor(ctx); c != "" {
+		t.Errorf("unexpected cursor for the last page: %q", c)
+	}
+
+	// numbers that compare as equal are ordered by their encoded values
+	it = newIt(quad.Int(1), 2)
+	if got, expect := readPage(t, qs, it), []quad.Value{quad.Float(1), quad.Int(2)}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected page: %v vs %v", got, expect)
+	}
+	if !it.Contains(ctx, graph.PreFetched(quad.Int(2))) || it.Contains(ctx, graph.PreFetched(quad.Int(1))) {
+		t.Error("unexpected contains results")
+	}
+	it.Reset()
+	if got := readPage(t, qs, it); len(got) != 2 {
+		t.Errorf("unexpected page after reset: %v", got)
+	}
+	v, err := DecodeCursor(it.Cursor(ctx))
+	if err != nil {
+		t.Fatal(err)
+	} else if v != quad.Int(2) {
+		t.Errorf("unexpected cursor value: %#v", v)
+	}
+
+	d := graph.DescribeIteratorFor(qs, it)
+	it2, err := graph.BuildFromDescription(qs, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readPage(t, qs, it2.(*Page)); len(got) != 2 || got[0] != quad.Float(1) {
+		t.Errorf("unexpected results of a rebuilt iterator: %v", got)
+	}
+
+	if _, err = DecodeCursor("!"); err == nil {
+		t.Error("expected an error for invalid cursor")
+	}
+}
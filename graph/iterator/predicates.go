@@ -0,0 +1,160 @@
+package iterator
+
+import (
+	"context"
+	"math"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var (
+	_ graph.Iterator = &Predicates{}
+	_ graph.IOStater = &Predicates{}
+)
+
+// Predicates iterator returns distinct predicates of quads that have subjects from
+// the sub-iterator. It is used to discover a schema of nodes.
+//
+// It is an equivalent of Unique(HasA(LinksTo(sub, Subject), Predicate)), but the
+// size of the result is estimated as a number of distinct predicates.
+type Predicates struct {
+	uid   uint64
+	tags  graph.Tagger
+	qs    graph.QuadStore
+	subIt graph.Iterator
+	links *LinksTo
+	hasa  *HasA
+	it    *Unique
+}
+
+// NewPredicates creates an iterator of distinct predicates of given subjects.
+func NewPredicates(qs graph.QuadStore, sub graph.Iterator) *Predicates {
+	it := &Predicates{
+		uid: NextUID(),
+		qs:  qs,
+	}
+	it.setSub(sub)
+	return it
+}
+
+// setSub builds an internal iterator tree for a given sub-iterator.
+func (it *Predicates) setSub(sub graph.Iterator) {
+	it.subIt = sub
+	it.links = NewLinksTo(it.qs, sub, quad.Subject)
+	it.hasa = NewHasA(it.qs, it.links, quad.Predicate)
+	it.it = NewUnique(it.hasa)
+}
+
+func (it *Predicates) UID() uint64 {
+	return it.uid
+}
+
+func (it *Predicates) Reset() {
+	it.it.Reset()
+}
+
+func (it *Predicates) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Predicates) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.it.TagResults(dst)
+}
+
+func (it *Predicates) Clone() graph.Iterator {
+	out := NewPredicates(it.qs, it.subIt.Clone())
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Predicates) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// IOStats implements graph.IOStater. It returns reads of the internal LinksTo and HasA iterators.
+func (it *Predicates) IOStats() graph.IOStats {
+	st := it.links.IOStats()
+	st.Add(it.hasa.IOStats())
+	return st
+}
+
+func (it *Predicates) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	return graph.NextLogOut(it, it.it.Next(ctx))
+}
+
+// Contains checks if any of the subjects has a quad with a given predicate.
+func (it *Predicates) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	return graph.ContainsLogOut(it, val, it.it.Contains(ctx, val))
+}
+
+// NextPath always returns false, since only the first path to each predicate is kept.
+func (it *Predicates) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *Predicates) Err() error {
+	return it.it.Err()
+}
+
+func (it *Predicates) Result() graph.Value {
+	return it.it.Result()
+}
+
+func (it *Predicates) Close() error {
+	return it.it.Close()
+}
+
+func (it *Predicates) Type() graph.Type { return graph.Predicates }
+
+func (it *Predicates) String() string {
+	return "Predicates"
+}
+
+func (it *Predicates) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.setSub(newSub)
+	}
+	if it.subIt.Type() == graph.Null {
+		it.Close()
+		return NewNull(), true
+	}
+	return it, false
+}
+
+// predicateVocabulary estimates a number of distinct predicates in the quad store.
+// Vocabularies of real graphs grow much slower than the number of quads, thus
+// a square root of the number of quads is used as an upper bound.
+func predicateVocabulary(qs graph.QuadStore) int64 {
+	n := int64(math.Sqrt(float64(qs.Size())))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Size estimates a number of distinct predicates of the subjects. It is not greater
+// than the number of quads of the subjects, and than the predicate vocabulary of
+// the quad store.
+func (it *Predicates) Size() (int64, bool) {
+	n, exact := it.links.Size()
+	if exact && n == 0 {
+		return 0, true
+	}
+	if v := predicateVocabulary(it.qs); n > v {
+		n = v
+	}
+	return n, false
+}
+
+// Stats returns costs of the internal iterators and an estimate of the number of
+// distinct predicates.
+func (it *Predicates) Stats() graph.IteratorStats {
+	st := it.it.Stats()
+	st.Size, st.ExactSize = it.Size()
+	return st
+}
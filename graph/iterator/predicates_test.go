@@ -0,0 +1,76 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestPredicates(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{
+		Data: []quad.Quad{
+			quad.MakeRaw("a", "follows", "b", ""),
+			quad.MakeRaw("a", "follows", "c", ""),
+			quad.MakeRaw("a", "likes", "x", ""),
+			quad.MakeRaw("b", "likes", "y", ""),
+			quad.MakeRaw("b", "name", "B", ""),
+			quad.MakeRaw("d", "status", "x", ""),
+			quad.MakeRaw("x", "name", "X", ""),
+		},
+	}
+	subs := NewFixed(graph.PreFetched(quad.Raw("a")), graph.PreFetched(quad.Raw("b")))
+	subs.Tagger().Add("s")
+	it := NewPredicates(qs, subs)
+	it.Tagger().Add("p")
+
+	var got []string
+	for it.Next(ctx) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		if tags["p"] != it.Result() || tags["s"] == nil {
+			t.Errorf("unexpected tags: %v", tags)
+		}
+		got = append(got, quad.ToString(qs.NameOf(it.Result())))
+		if it.NextPath(ctx) {
+			t.Error("expected a single path for each predicate")
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if exp := []string{"follows", "likes", "name"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected predicates: %v vs %v", got, exp)
+	}
+
+	if !it.Contains(ctx, graph.PreFetched(quad.Raw("likes"))) {
+		t.Error("expected a predicate of the subjects to be found")
+	}
+	if it.Contains(ctx, graph.PreFetched(quad.Raw("status"))) {
+		t.Error("expected a predicate of other subjects to be rejected")
+	}
+
+	// 7 quads in the store gives an estimate of 2 distinct predicates
+	if n, exact := it.Size(); n != 2 || exact {
+		t.Errorf("unexpected size estimate: %d (%v)", n, exact)
+	}
+	if st := it.Stats(); st.Size != 2 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	it.Reset()
+	if !it.Next(ctx) {
+		t.Error("expected results after reset")
+	}
+
+	if nit, changed := NewPredicates(qs, NewNull()).Optimize(); !changed || nit.Type() != graph.Null {
+		t.Errorf("expected predicates of no subjects to be optimized away, got %v", nit)
+	}
+}
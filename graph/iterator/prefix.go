@@ -0,0 +1,191 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Prefix{}
+
+// Prefix is a unary operator -- a filter across the values in the relevant
+// subiterator. It reduces the iterator set to literals (strings, typed and
+// language-tagged strings) that start with a given prefix.
+//
+// Quad stores that support ordered scans of values may replace it with a range
+// scan during Optimize (see graph.Pushdownable). Otherwise all values of the
+// subiterator are checked.
+type Prefix struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	prefix string
+	qs     graph.QuadStore
+	result graph.Value
+	err    error
+}
+
+func NewPrefix(sub graph.Iterator, prefix string, qs graph.QuadStore) *Prefix {
+	return &Prefix{
+		uid:    NextUID(),
+		subIt:  sub,
+		prefix: prefix,
+		qs:     qs,
+	}
+}
+
+// Prefix returns the prefix that values must start with.
+func (it *Prefix) Prefix() string {
+	return it.prefix
+}
+
+// SubIterator returns the iterator of values that are filtered.
+func (it *Prefix) SubIterator() graph.Iterator {
+	return it.subIt
+}
+
+// HasPrefix checks if a value is a literal that starts with a given prefix.
+func HasPrefix(v quad.Value, prefix string) bool {
+	var s string
+	switch v := v.(type) {
+	case quad.String:
+		s = string(v)
+	case quad.TypedString:
+		s = string(v.Value)
+	case quad.LangString:
+		s = string(v.Value)
+	default:
+		return false
+	}
+	return strings.HasPrefix(s, prefix)
+}
+
+func (it *Prefix) testPrefix(val graph.Value) bool {
+	return HasPrefix(it.qs.NameOf(val), it.prefix)
+}
+
+func (it *Prefix) UID() uint64 {
+	return it.uid
+}
+
+func (it *Prefix) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *Prefix) Reset() {
+	it.subIt.Reset()
+	it.err = nil
+	it.result = nil
+}
+
+func (it *Prefix) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Prefix) Clone() graph.Iterator {
+	out := NewPrefix(it.subIt.Clone(), it.prefix, it.qs)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Prefix) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	for it.subIt.Next(ctx) {
+		val := it.subIt.Result()
+		if it.testPrefix(val) {
+			it.result = val
+			return graph.NextLogOut(it, true)
+		}
+	}
+	it.err = it.subIt.Err()
+	return graph.NextLogOut(it, false)
+}
+
+func (it *Prefix) Err() error {
+	return it.err
+}
+
+func (it *Prefix) Result() graph.Value {
+	return it.result
+}
+
+func (it *Prefix) NextPath(ctx context.Context) bool {
+	for {
+		if !it.subIt.NextPath(ctx) {
+			it.err = it.subIt.Err()
+			return false
+		}
+		if it.testPrefix(it.subIt.Result()) {
+			break
+		}
+	}
+	it.result = it.subIt.Result()
+	return true
+}
+
+func (it *Prefix) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Prefix) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.testPrefix(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	ok := it.subIt.Contains(ctx, val)
+	if !ok {
+		it.err = it.subIt.Err()
+	} else {
+		it.result = val
+	}
+	return graph.ContainsLogOut(it, val, ok)
+}
+
+func (it *Prefix) Type() graph.Type {
+	return graph.Prefix
+}
+
+func (it *Prefix) String() string {
+	return fmt.Sprintf("Prefix(%q)", it.prefix)
+}
+
+// Optimize offers the iterator to the quad store, which may replace it with a range
+// scan over values with the prefix, or add the prefix to its native query.
+func (it *Prefix) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
+	}
+	if nit, ok := it.qs.OptimizeIterator(it); ok {
+		it.Close()
+		return nit, true
+	}
+	if out := pushdown(it.qs, it); out != nil {
+		it.Close()
+		return out, true
+	}
+	return it, false
+}
+
+// We're only as expensive as our subiterator.
+func (it *Prefix) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *Prefix) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *Prefix) Size() (int64, bool) {
+	sz, _ := it.subIt.Size()
+	return sz / 2, false
+}
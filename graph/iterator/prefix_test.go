@@ -0,0 +1,138 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// nodesIterator is returned by orderedStore for all nodes.
+type nodesIterator struct {
+	*Fixed
+}
+
+func (it *nodesIterator) Type() graph.Type { return graph.All }
+
+// orderedStore keeps string values sorted and executes Prefix over all nodes as a range scan.
+type orderedStore struct {
+	graphmock.Store
+	names   []string // sorted
+	scanned int
+}
+
+var _ graph.Pushdownable = (*orderedStore)(nil)
+
+func (qs *orderedStore) NodesAllIterator() graph.Iterator {
+	it := NewFixed()
+	for _, s := range qs.names {
+		it.Add(graph.PreFetched(quad.String(s)))
+	}
+	return &nodesIterator{Fixed: it}
+}
+
+func (qs *orderedStore) Pushdown(it graph.Iterator) graph.Iterator {
+	p, ok := it.(*Prefix)
+	if !ok || p.SubIterator().Type() != graph.All {
+		return nil
+	}
+	out := NewFixed()
+	for i := sort.SearchStrings(qs.names, p.Prefix()); i < len(qs.names); i++ {
+		qs.scanned++
+		if !strings.HasPrefix(qs.names[i], p.Prefix()) {
+			break
+		}
+		out.Add(graph.PreFetched(quad.String(qs.names[i])))
+	}
+	out.Tagger().CopyFrom(it)
+	return out
+}
+
+func prefixResults(t *testing.T, qs graph.QuadStore, it graph.Iterator) []string {
+	ctx := context.TODO()
+	var out []string
+	for it.Next(ctx) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		if tags["v"] != it.Result() {
+			t.Errorf("unexpected tags: %v", tags)
+		}
+		out = append(out, qs.NameOf(it.Result()).String())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestPrefix(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("check", func(t *testing.T) {
+		qs := &graphmock.Store{}
+		vals := []quad.Value{
+			quad.String("apple"),
+			quad.IRI("app"),
+			quad.TypedString{Value: "appx", Type: "t"},
+			quad.LangString{Value: "apricot", Lang: "en"},
+			quad.String("banana"),
+			quad.Int(1),
+		}
+		fixed := NewFixed()
+		for _, v := range vals {
+			fixed.Add(graph.PreFetched(v))
+		}
+		it := NewPrefix(fixed, "ap", qs)
+		it.Tagger().Add("v")
+		opt, _ := it.Optimize()
+		if opt != it {
+			t.Fatalf("unexpected optimization: %v", opt)
+		}
+		got := prefixResults(t, qs, it)
+		expect := []string{`"apple"`, `"appx"^^<t>`, `"apricot"@en`}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("unexpected results: %v", got)
+		}
+		for _, v := range []quad.Value{quad.String("apple"), quad.LangString{Value: "apricot", Lang: "en"}} {
+			if !it.Contains(ctx, graph.PreFetched(v)) {
+				t.Errorf("expected %v to be found", v)
+			}
+		}
+		for _, v := range []quad.Value{quad.IRI("app"), quad.String("banana"), quad.String("apply")} {
+			if it.Contains(ctx, graph.PreFetched(v)) {
+				t.Errorf("expected %v to be filtered", v)
+			}
+		}
+		if d := graph.DescribeIterator(it); d.Params["prefix"] != "ap" {
+			t.Errorf("unexpected description: %v", d)
+		}
+	})
+	t.Run("range scan", func(t *testing.T) {
+		qs := &orderedStore{names: []string{"apple", "application", "apricot", "apt", "banana", "bar"}}
+		it := NewPrefix(qs.NodesAllIterator(), "app", qs)
+		it.Tagger().Add("v")
+		opt, ok := it.Optimize()
+		if !ok || opt.Type() != graph.Fixed {
+			t.Fatalf("expected prefix to be pushed down, got: %v", opt)
+		}
+		got := prefixResults(t, qs, opt)
+		if expect := []string{`"apple"`, `"application"`}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("unexpected results: %v", got)
+		}
+		if qs.scanned != 3 {
+			t.Errorf("expected only a range of values to be scanned, got: %d", qs.scanned)
+		}
+
+		// other subiterators are checked one by one
+		it = NewPrefix(NewFixed(graph.PreFetched(quad.String("bar")), graph.PreFetched(quad.String("apple"))), "app", qs)
+		if opt, _ := it.Optimize(); opt != it {
+			t.Fatalf("unexpected optimization: %v", opt)
+		}
+	})
+}
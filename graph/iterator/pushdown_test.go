@@ -0,0 +1,87 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator_test
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// pushdownStore executes HasA subtrees natively, if accept is set.
+type pushdownStore struct {
+	graphmock.Store
+	accept  bool
+	offered []graph.Type
+}
+
+var _ graph.Pushdownable = (*pushdownStore)(nil)
+
+func (qs *pushdownStore) Pushdown(it graph.Iterator) graph.Iterator {
+	qs.offered = append(qs.offered, it.Type())
+	if !qs.accept || it.Type() != graph.HasA {
+		return nil
+	}
+	return NewFixed(graph.PreFetched(quad.IRI("native")))
+}
+
+func TestPushdown(t *testing.T) {
+	data := []quad.Quad{
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("c", "follows", "b", ""),
+	}
+	build := func(qs graph.QuadStore) graph.Iterator {
+		fixed := NewFixed(graph.PreFetched(quad.IRI("b")))
+		return NewAnd(qs,
+			NewHasA(qs, NewLinksTo(qs, fixed, quad.Object), quad.Subject),
+			NewFixed(graph.PreFetched(quad.IRI("a")), graph.PreFetched(quad.IRI("c"))),
+		)
+	}
+
+	t.Run("accept", func(t *testing.T) {
+		qs := &pushdownStore{Store: graphmock.Store{Data: data}, accept: true}
+		it, _ := build(qs).Optimize()
+		if len(qs.offered) == 0 || qs.offered[0] != graph.HasA {
+			t.Fatalf("expected HasA to be offered first, got: %v", qs.offered)
+		}
+		var hasFixed bool
+		for _, sub := range it.SubIterators() {
+			if sub.Type() == graph.HasA {
+				t.Errorf("expected HasA to be replaced: %v", it.SubIterators())
+			}
+			hasFixed = hasFixed || sub.Type() == graph.Fixed
+		}
+		if !hasFixed {
+			t.Errorf("unexpected iterator: %v", it)
+		}
+	})
+	t.Run("decline", func(t *testing.T) {
+		qs := &pushdownStore{Store: graphmock.Store{Data: data}}
+		it, _ := build(qs).Optimize()
+		if len(qs.offered) != 2 || qs.offered[1] != graph.And {
+			t.Errorf("expected HasA and And to be offered, got: %v", qs.offered)
+		}
+		if it.Type() != graph.And {
+			t.Errorf("expected generic iterator, got: %v", it.Type())
+		}
+		ref, _ := build(&graphmock.Store{Data: data}).Optimize()
+		if got, exp := graph.DescribeIterator(it).Name, graph.DescribeIterator(ref).Name; got != exp {
+			t.Errorf("unexpected iterator: %v vs %v", got, exp)
+		}
+	})
+}
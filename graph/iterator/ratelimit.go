@@ -0,0 +1,171 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &RateLimit{}
+
+// RateLimit iterator throttles calls to Next, NextPath and Contains of the
+// primary iterator to a given number of operations per second.
+//
+// It uses a token bucket that holds at most one token, so operations are spread
+// evenly instead of being allowed in bursts. When the budget is exhausted, the
+// iterator blocks until the next token is available or the context is canceled.
+// Zero and negative rate values means no limit.
+type RateLimit struct {
+	uid       uint64
+	rate      float64
+	tokens    float64
+	last      time.Time
+	primaryIt graph.Iterator
+	err       error
+}
+
+// NewRateLimit creates a new RateLimit iterator allowing at most rate operations
+// per second on the primary iterator.
+func NewRateLimit(primaryIt graph.Iterator, rate float64) *RateLimit {
+	return &RateLimit{
+		uid:       NextUID(),
+		rate:      rate,
+		tokens:    1,
+		primaryIt: primaryIt,
+	}
+}
+
+func (it *RateLimit) UID() uint64 {
+	return it.uid
+}
+
+// Rate returns the number of operations per second allowed by the iterator.
+func (it *RateLimit) Rate() float64 {
+	return it.rate
+}
+
+// Reset resets the internal iterators and the iterator itself.
+// Token bucket state is preserved, since it reflects the load on the backend.
+func (it *RateLimit) Reset() {
+	it.err = nil
+	it.primaryIt.Reset()
+}
+
+func (it *RateLimit) Tagger() *graph.Tagger {
+	return it.primaryIt.Tagger()
+}
+
+func (it *RateLimit) TagResults(dst map[string]graph.Value) {
+	it.primaryIt.TagResults(dst)
+}
+
+func (it *RateLimit) Clone() graph.Iterator {
+	return NewRateLimit(it.primaryIt.Clone(), it.rate)
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *RateLimit) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.primaryIt}
+}
+
+// wait takes a single token from the bucket, blocking until one is available.
+// It returns false if the context was canceled while waiting.
+func (it *RateLimit) wait(ctx context.Context) bool {
+	if it.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	if !it.last.IsZero() {
+		it.tokens += now.Sub(it.last).Seconds() * it.rate
+		if it.tokens > 1 {
+			it.tokens = 1
+		}
+	}
+	it.last = now
+	if it.tokens >= 1 {
+		it.tokens--
+		return true
+	}
+	dt := time.Duration((1 - it.tokens) / it.rate * float64(time.Second))
+	t := time.NewTimer(dt)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		it.err = ctx.Err()
+		return false
+	case <-t.C:
+	}
+	// the token we waited for is consumed right away
+	it.last = time.Now()
+	it.tokens = 0
+	return true
+}
+
+// Next advances the RateLimit iterator. It will block if the rate limit was reached.
+func (it *RateLimit) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if !it.wait(ctx) {
+		return graph.NextLogOut(it, false)
+	}
+	return graph.NextLogOut(it, it.primaryIt.Next(ctx))
+}
+
+func (it *RateLimit) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.primaryIt.Err()
+}
+
+func (it *RateLimit) Result() graph.Value {
+	return it.primaryIt.Result()
+}
+
+// Contains checks the value against the primary iterator. It will block if the
+// rate limit was reached.
+func (it *RateLimit) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.wait(ctx) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	return graph.ContainsLogOut(it, val, it.primaryIt.Contains(ctx, val))
+}
+
+// NextPath checks whether there is another path. It will block if the rate
+// limit was reached.
+func (it *RateLimit) NextPath(ctx context.Context) bool {
+	if !it.wait(ctx) {
+		return false
+	}
+	return it.primaryIt.NextPath(ctx)
+}
+
+// Close closes the primary iterator.
+func (it *RateLimit) Close() error {
+	return it.primaryIt.Close()
+}
+
+func (it *RateLimit) Type() graph.Type { return graph.RateLimit }
+
+func (it *RateLimit) Optimize() (graph.Iterator, bool) {
+	optimizedPrimaryIt, optimized := it.primaryIt.Optimize()
+	if it.rate <= 0 { // no limit
+		return optimizedPrimaryIt, true
+	}
+	it.primaryIt = optimizedPrimaryIt
+	return it, optimized
+}
+
+func (it *RateLimit) Stats() graph.IteratorStats {
+	return it.primaryIt.Stats()
+}
+
+func (it *RateLimit) Size() (int64, bool) {
+	return it.primaryIt.Size()
+}
+
+func (it *RateLimit) String() string {
+	return fmt.Sprintf("RateLimit(%v/s)", it.rate)
+}
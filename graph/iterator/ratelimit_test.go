@@ -0,0 +1,68 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func TestRateLimitIteratorBasics(t *testing.T) {
+	allIt := NewFixed(
+		Int64Node(1),
+		Int64Node(2),
+		Int64Node(3),
+		Int64Node(4),
+		Int64Node(5),
+	)
+
+	u := NewRateLimit(allIt, 0)
+	expect := []int{1, 2, 3, 4, 5}
+	if got := iterated(u); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate RateLimit correctly: got:%v expected:%v", got, expect)
+	}
+	if it, _ := u.Optimize(); it.Type() == u.Type() {
+		t.Errorf("RateLimit without a rate should be optimized away")
+	}
+}
+
+func TestRateLimitIteratorRate(t *testing.T) {
+	const (
+		rate = 200.0
+		n    = 20
+	)
+	var vals []int
+	fixed := NewFixed()
+	for i := 0; i < n; i++ {
+		fixed.Add(Int64Node(i))
+		vals = append(vals, i)
+	}
+	u := NewRateLimit(fixed, rate)
+
+	start := time.Now()
+	if got := iterated(u); !reflect.DeepEqual(got, vals) {
+		t.Errorf("Failed to iterate RateLimit correctly: got:%v expected:%v", got, vals)
+	}
+	dt := time.Since(start)
+	// first operation is free, and the final Next returning false costs a token as well
+	if observed := float64(n) / dt.Seconds(); observed > rate {
+		t.Errorf("Rate limit exceeded: got:%v ops/s expected:%v ops/s", observed, rate)
+	}
+}
+
+func TestRateLimitIteratorCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	u := NewRateLimit(NewFixed(Int64Node(1), Int64Node(2)), 0.001)
+	if !u.Next(ctx) {
+		t.Fatal("Expected the first value to be returned immediately")
+	}
+	cancel()
+	if u.Next(ctx) {
+		t.Error("Expected Next to stop on canceled context")
+	}
+	if u.Err() != context.Canceled {
+		t.Errorf("Unexpected error: got:%v expected:%v", u.Err(), context.Canceled)
+	}
+}
@@ -66,6 +66,15 @@ func (it *Regex) AllowRefs(v bool) {
 	it.allowRefs = v
 }
 
+// Regexp returns the regular expression that values must match.
+func (it *Regex) Regexp() *regexp.Regexp { return it.re }
+
+// RefsAllowed reports if the iterator matches IRIs and BNodes (see AllowRefs).
+func (it *Regex) RefsAllowed() bool { return it.allowRefs }
+
+// SubIterator returns the iterator of values that are matched.
+func (it *Regex) SubIterator() graph.Iterator { return it.subIt }
+
 func (it *Regex) testRegex(val graph.Value) bool {
 	// Type switch to avoid coercing and testing numeric types
 	v := it.qs.NameOf(val)
@@ -178,6 +187,11 @@ func (it *Regex) Optimize() (graph.Iterator, bool) {
 		it.subIt.Close()
 		it.subIt = newSub
 	}
+	// quad store may evaluate the regexp as a part of its native query
+	if nit, ok := it.qs.OptimizeIterator(it); ok {
+		it.Close()
+		return nit, true
+	}
 	return it, false
 }
 
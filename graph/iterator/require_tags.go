@@ -0,0 +1,177 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &RequireTags{}
+
+// RequireTags iterator returns only the results of the sub-iterator that bind all of
+// the given tags to non-nil values. It is useful to drop incomplete results after
+// optional branches.
+//
+// If a result has multiple paths, only the paths that bind all the tags are returned.
+type RequireTags struct {
+	uid      uint64
+	tags     graph.Tagger
+	subIt    graph.Iterator
+	required []string
+	result   graph.Value
+	runstats graph.IteratorStats
+	err      error
+}
+
+// NewRequireTags creates a new RequireTags iterator.
+func NewRequireTags(sub graph.Iterator, tags ...string) *RequireTags {
+	return &RequireTags{
+		uid:      NextUID(),
+		subIt:    sub,
+		required: tags,
+	}
+}
+
+func (it *RequireTags) UID() uint64 {
+	return it.uid
+}
+
+// Required returns the tags that must be bound by each result.
+func (it *RequireTags) Required() []string {
+	return it.required
+}
+
+func (it *RequireTags) Reset() {
+	it.subIt.Reset()
+	it.result = nil
+	it.err = nil
+}
+
+func (it *RequireTags) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *RequireTags) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *RequireTags) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+}
+
+func (it *RequireTags) Clone() graph.Iterator {
+	out := NewRequireTags(it.subIt.Clone(), it.required...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *RequireTags) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// hasTags checks if the current path of the sub-iterator binds all the required tags.
+func (it *RequireTags) hasTags() bool {
+	tags := make(map[string]graph.Value, len(it.required))
+	it.subIt.TagResults(tags)
+	for _, tag := range it.required {
+		if tags[tag] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// findPath moves the sub-iterator to the first path (starting from the current one)
+// that binds all the required tags.
+func (it *RequireTags) findPath(ctx context.Context) bool {
+	for !it.hasTags() {
+		if !it.subIt.NextPath(ctx) {
+			it.err = it.subIt.Err()
+			return false
+		}
+	}
+	return true
+}
+
+func (it *RequireTags) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.runstats.Next += 1
+	for it.subIt.Next(ctx) {
+		if it.findPath(ctx) {
+			it.result = it.subIt.Result()
+			return graph.NextLogOut(it, true)
+		} else if it.err != nil {
+			break
+		}
+	}
+	if it.err == nil {
+		it.err = it.subIt.Err()
+	}
+	it.result = nil
+	return graph.NextLogOut(it, false)
+}
+
+func (it *RequireTags) NextPath(ctx context.Context) bool {
+	if !it.subIt.NextPath(ctx) {
+		it.err = it.subIt.Err()
+		return false
+	}
+	return it.findPath(ctx)
+}
+
+func (it *RequireTags) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.runstats.Contains += 1
+	if !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if !it.findPath(ctx) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *RequireTags) Err() error {
+	return it.err
+}
+
+func (it *RequireTags) Result() graph.Value {
+	return it.result
+}
+
+func (it *RequireTags) Type() graph.Type { return graph.RequireTags }
+
+func (it *RequireTags) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
+	}
+	return it, false
+}
+
+// Stats assumes that each result binds all the tags. Checking the tags is as expensive
+// as tagging the result, which is not accounted for.
+func (it *RequireTags) Stats() graph.IteratorStats {
+	st := it.subIt.Stats()
+	st.ExactSize = false
+	st.Next = it.runstats.Next
+	st.Contains = it.runstats.Contains
+	return st
+}
+
+func (it *RequireTags) Size() (int64, bool) {
+	sz, _ := it.subIt.Size()
+	return sz, false
+}
+
+func (it *RequireTags) String() string {
+	return fmt.Sprintf("RequireTags(%q)", it.required)
+}
@@ -0,0 +1,79 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestRequireTags(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{}
+	for _, s := range []string{"a", "b", "c", "d"} {
+		qs.Data = append(qs.Data, quad.Make(quad.IRI("n"), quad.IRI("is"), quad.String(s), nil))
+	}
+	val := func(s string) graph.Value { return graph.PreFetched(quad.String(s)) }
+	// all nodes are tagged as "node", only some of them have "name" and "age"
+	newIt := func() graph.Iterator {
+		all := NewFixed(val("a"), val("b"), val("c"), val("d"))
+		all.Tagger().Add("node")
+		names := NewFixed(val("a"), val("c"), val("d"))
+		names.Tagger().Add("name")
+		ages := NewFixed(val("a"), val("d"))
+		ages.Tagger().Add("age")
+		return NewAnd(nil, all, NewOptional(names), NewOptional(ages))
+	}
+	collect := func(it graph.Iterator) []string {
+		var out []string
+		for it.Next(ctx) {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			if tags["node"] == nil {
+				t.Errorf("tags of the sub-iterator are lost: %v", tags)
+			}
+			out = append(out, string(qs.NameOf(it.Result()).(quad.String)))
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	it := NewRequireTags(newIt(), "name")
+	if got := collect(it); !reflect.DeepEqual(got, []string{"a", "c", "d"}) {
+		t.Errorf("unexpected results: %v", got)
+	}
+	it = NewRequireTags(newIt(), "name", "age")
+	expect := []string{"a", "d"}
+	if got := collect(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: %v", got)
+	}
+	it.Reset()
+	if got := collect(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results after reset: %v", got)
+	}
+	if !it.Contains(ctx, val("d")) {
+		t.Error("expected value to be found")
+	}
+	if it.Contains(ctx, val("c")) {
+		t.Error("value without a tag should be filtered")
+	}
+
+	d := graph.DescribeIteratorFor(qs, it)
+	it2, err := graph.BuildFromDescription(qs, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(it2); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results of a rebuilt iterator: %v", got)
+	}
+
+	if got := collect(NewRequireTags(newIt(), "missing")); len(got) != 0 {
+		t.Errorf("expected no results, got: %v", got)
+	}
+}
@@ -0,0 +1,284 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &Sample{}
+
+// Sample iterator reads all results of the sub-iterator and returns a uniform random
+// sample of at most a given number of them, in no particular order.
+// All paths of a sampled value are kept.
+//
+// By default, the sample is reproducible: it depends only on the seed, and Reset
+// returns the same sample again. Use ResetSeed to draw a new sample on reuse.
+//
+// Buffered results are accounted in the memory budget of the context (see graph.WithBudget).
+// If the budget is exceeded, iteration fails with graph.ErrBudgetExceeded.
+type Sample struct {
+	uid      uint64
+	tags     graph.Tagger
+	subIt    graph.Iterator
+	size     int64
+	seed     int64
+	values   [][]result
+	index    int
+	subindex int
+	hasRun   bool
+	result   graph.Value
+	err      error
+	budget   *graph.Budget
+	reserved int64
+}
+
+// NewSample creates a new Sample iterator that returns at most n results of the
+// sub-iterator, chosen randomly using a given seed. Zero or negative n means no results.
+func NewSample(sub graph.Iterator, n int64, seed int64) *Sample {
+	return &Sample{
+		uid:   NextUID(),
+		subIt: sub,
+		size:  n,
+		seed:  seed,
+		index: -1,
+	}
+}
+
+func (it *Sample) UID() uint64 {
+	return it.uid
+}
+
+// Seed returns the seed used to draw the sample.
+func (it *Sample) Seed() int64 { return it.seed }
+
+// Reset rewinds the iterator to the beginning of the same sample.
+func (it *Sample) Reset() {
+	it.index = -1
+	it.subindex = 0
+	it.result = nil
+}
+
+// ResetSeed resets the iterator and changes the seed. A new sample will be drawn on the
+// next call to Next or Contains.
+func (it *Sample) ResetSeed(seed int64) {
+	it.Reset()
+	it.seed = seed
+	it.values = nil
+	it.hasRun = false
+	it.err = nil
+	it.release()
+}
+
+func (it *Sample) Close() error {
+	it.values = nil
+	it.hasRun = false
+	it.release()
+	return it.subIt.Close()
+}
+
+// release returns memory used by buffered results to the budget.
+func (it *Sample) release() {
+	it.budget.Release(it.reserved)
+	it.budget, it.reserved = nil, 0
+}
+
+func (it *Sample) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Sample) TagResults(dst map[string]graph.Value) {
+	if it.index >= 0 && it.index < len(it.values) {
+		for tag, val := range it.values[it.index][it.subindex].tags {
+			dst[tag] = val
+		}
+	}
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *Sample) Clone() graph.Iterator {
+	out := NewSample(it.subIt.Clone(), it.size, it.seed)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Sample) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Sample) Type() graph.Type { return graph.Sample }
+
+func (it *Sample) String() string {
+	return fmt.Sprintf("Sample(%d, seed=%d)", it.size, it.seed)
+}
+
+func (it *Sample) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	if it.size <= 0 || it.subIt.Type() == graph.Null {
+		it.subIt.Close()
+		return NewNull(), true
+	}
+	return it, false
+}
+
+// Size returns the size of the sample, if it was already drawn, or an estimate
+// based on the size of the sub-iterator.
+func (it *Sample) Size() (int64, bool) {
+	if it.hasRun {
+		return int64(len(it.values)), true
+	}
+	if it.size <= 0 {
+		return 0, true
+	}
+	n, exact := it.subIt.Size()
+	if n > it.size {
+		n = it.size
+	}
+	return n, exact
+}
+
+// Stats accounts for reading all the results of the sub-iterator before the first one
+// can be returned.
+func (it *Sample) Stats() graph.IteratorStats {
+	st := it.subIt.Stats()
+	subSize := st.Size
+	st.Size, st.ExactSize = it.Size()
+	if !it.hasRun {
+		st.NextCost += st.NextCost * subSize
+	}
+	return st
+}
+
+func (it *Sample) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	}
+	it.index++
+	it.subindex = 0
+	if it.index >= len(it.values) {
+		it.result = nil
+		return graph.NextLogOut(it, false)
+	}
+	it.result = it.values[it.index][0].id
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Sample) NextPath(ctx context.Context) bool {
+	if it.index < 0 || it.index >= len(it.values) {
+		return false
+	}
+	if it.subindex+1 >= len(it.values[it.index]) {
+		return false
+	}
+	it.subindex++
+	return true
+}
+
+// Contains checks if the value is a part of the sample. It draws the sample if
+// it was not drawn yet.
+func (it *Sample) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	if it.err != nil {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	key := graph.ToKey(val)
+	for i, vals := range it.values {
+		if graph.ToKey(vals[0].id) == key {
+			it.index, it.subindex = i, 0
+			it.result = vals[0].id
+			return graph.ContainsLogOut(it, val, true)
+		}
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+func (it *Sample) Err() error {
+	return it.err
+}
+
+func (it *Sample) Result() graph.Value {
+	return it.result
+}
+
+// reserve accounts memory used by the paths of a single value.
+func (it *Sample) reserve(paths []result) error {
+	var sz int64
+	for _, r := range paths {
+		sz += graph.RowSize(len(r.tags))
+	}
+	if err := it.budget.Reserve(sz); err != nil {
+		return err
+	}
+	it.reserved += sz
+	return nil
+}
+
+// unreserve returns memory used by the paths of a value dropped from the sample.
+func (it *Sample) unreserve(paths []result) {
+	var sz int64
+	for _, r := range paths {
+		sz += graph.RowSize(len(r.tags))
+	}
+	it.budget.Release(sz)
+	it.reserved -= sz
+}
+
+// run draws the sample using reservoir sampling.
+func (it *Sample) run(ctx context.Context) {
+	it.hasRun = true
+	it.values = nil
+	if it.size <= 0 {
+		return
+	}
+	it.subIt.Reset()
+	it.budget = graph.BudgetFromContext(ctx)
+	rnd := rand.New(rand.NewSource(it.seed))
+	for i := int64(0); it.subIt.Next(ctx); i++ {
+		j := i
+		if i >= it.size {
+			// only read paths of the value if it will replace one in the sample
+			if j = rnd.Int63n(i + 1); j >= it.size {
+				continue
+			}
+		}
+		var paths []result
+		for {
+			tags := make(map[string]graph.Value)
+			it.subIt.TagResults(tags)
+			paths = append(paths, result{id: it.subIt.Result(), tags: tags})
+			if !it.subIt.NextPath(ctx) {
+				break
+			}
+		}
+		if err := it.reserve(paths); err != nil {
+			it.err = err
+			it.values = nil
+			it.release()
+			return
+		}
+		if i < it.size {
+			it.values = append(it.values, paths)
+		} else {
+			it.unreserve(it.values[j])
+			it.values[j] = paths
+		}
+	}
+	if err := it.subIt.Err(); err != nil {
+		it.err = err
+		it.values = nil
+		it.release()
+	}
+}
@@ -0,0 +1,83 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func sampleValues(t *testing.T, it graph.Iterator) []int64 {
+	ctx := context.TODO()
+	var out []int64
+	for it.Next(ctx) {
+		out = append(out, int64(it.Result().(Int64Node)))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSample(t *testing.T) {
+	it := NewSample(NewInt64(1, 100, true), 10, 42)
+	first := sampleValues(t, it)
+	if len(first) != 10 {
+		t.Fatalf("unexpected sample size: %d", len(first))
+	}
+	seen := make(map[int64]bool)
+	for _, v := range first {
+		if v < 1 || v > 100 || seen[v] {
+			t.Fatalf("unexpected value in sample: %v", first)
+		}
+		seen[v] = true
+	}
+	ctx := context.TODO()
+	if !it.Contains(ctx, Int64Node(first[3])) {
+		t.Errorf("expected sampled value %d to be contained", first[3])
+	}
+	for v := int64(1); v <= 100; v++ {
+		if !seen[v] {
+			if it.Contains(ctx, Int64Node(v)) {
+				t.Errorf("value %d is not in the sample", v)
+			}
+			break
+		}
+	}
+
+	t.Run("reset", func(t *testing.T) {
+		it.Reset()
+		if got := sampleValues(t, it); !reflect.DeepEqual(got, first) {
+			t.Errorf("expected the same sample after reset: %v vs %v", got, first)
+		}
+		// the same seed gives the same sample
+		if got := sampleValues(t, NewSample(NewInt64(1, 100, true), 10, 42)); !reflect.DeepEqual(got, first) {
+			t.Errorf("expected the same sample for the same seed: %v vs %v", got, first)
+		}
+	})
+	t.Run("reseed", func(t *testing.T) {
+		it.ResetSeed(43)
+		second := sampleValues(t, it)
+		if len(second) != 10 {
+			t.Fatalf("unexpected sample size: %d", len(second))
+		}
+		if reflect.DeepEqual(second, first) {
+			t.Errorf("expected a new sample after reseed: %v", second)
+		}
+		it.ResetSeed(42)
+		if got := sampleValues(t, it); !reflect.DeepEqual(got, first) {
+			t.Errorf("expected the original sample: %v vs %v", got, first)
+		}
+	})
+	t.Run("small", func(t *testing.T) {
+		got := sampleValues(t, NewSample(NewInt64(1, 5, true), 10, 1))
+		if len(got) != 5 {
+			t.Errorf("expected all values to be sampled: %v", got)
+		}
+		if it, _ := NewSample(NewInt64(1, 5, true), 0, 1).Optimize(); it.Type() != graph.Null {
+			t.Errorf("expected empty sample to be optimized away, got %v", it.Type())
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package iterator
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &Shared{}
+
+// Shared iterator marks a sub-iterator that will be iterated multiple times, for example
+// a sub-query that is used in several branches of the tree, or checked with Contains
+// for each result of a large iterator. The cost model of the optimizer may not see it,
+// thus Optimize always replaces Shared with a Materialize iterator over the optimized
+// sub-iterator, instead of guessing.
+//
+// Without optimization, Shared returns the results of the sub-iterator as is.
+type Shared struct {
+	uid   uint64
+	tags  graph.Tagger
+	subIt graph.Iterator
+}
+
+// MarkShared marks the iterator as reused, so the optimizer materializes it. The hint
+// is carried by the returned iterator, which must be used in place of the original one.
+func MarkShared(it graph.Iterator) graph.Iterator {
+	switch it.Type() {
+	case graph.Shared, graph.Materialize, graph.Fixed, graph.Null:
+		// already marked, or stored in memory
+		return it
+	}
+	return &Shared{
+		uid:   NextUID(),
+		subIt: it,
+	}
+}
+
+func (it *Shared) UID() uint64 {
+	return it.uid
+}
+
+func (it *Shared) Reset() {
+	it.subIt.Reset()
+}
+
+// Close closes the sub-iterator, unless it was moved to a replacement by Optimize.
+func (it *Shared) Close() error {
+	if it.subIt == nil {
+		return nil
+	}
+	return it.subIt.Close()
+}
+
+func (it *Shared) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Shared) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+}
+
+func (it *Shared) Clone() graph.Iterator {
+	out := &Shared{uid: NextUID(), subIt: it.subIt.Clone()}
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Shared) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Shared) Next(ctx context.Context) bool {
+	return it.subIt.Next(ctx)
+}
+
+func (it *Shared) NextPath(ctx context.Context) bool {
+	return it.subIt.NextPath(ctx)
+}
+
+func (it *Shared) Contains(ctx context.Context, val graph.Value) bool {
+	return it.subIt.Contains(ctx, val)
+}
+
+func (it *Shared) Err() error {
+	return it.subIt.Err()
+}
+
+func (it *Shared) Result() graph.Value {
+	return it.subIt.Result()
+}
+
+func (it *Shared) Type() graph.Type { return graph.Shared }
+
+// Optimize optimizes the sub-iterator and replaces Shared with Materialize over it.
+// Sub-iterators that cannot be iterated with Next are returned as is.
+func (it *Shared) Optimize() (graph.Iterator, bool) {
+	sub := it.subIt
+	if out, changed := sub.Optimize(); changed {
+		sub.Close()
+		sub = out
+	}
+	it.subIt = nil
+	var out graph.Iterator = sub
+	switch sub.Type() {
+	case graph.Null, graph.Materialize, graph.Fixed:
+	default:
+		if graph.CanNext(sub) {
+			out = NewMaterialize(sub)
+		}
+	}
+	out.Tagger().CopyFrom(it)
+	return out, true
+}
+
+func (it *Shared) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *Shared) Size() (int64, bool) {
+	return it.subIt.Size()
+}
+
+func (it *Shared) String() string {
+	return "Shared"
+}
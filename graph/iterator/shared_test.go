@@ -0,0 +1,81 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestMarkShared(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{
+		Data: []quad.Quad{
+			quad.MakeIRI("a", "follows", "b", ""),
+			quad.MakeIRI("c", "follows", "b", ""),
+			quad.MakeIRI("c", "follows", "d", ""),
+		},
+	}
+	// followers of <b>; shallow enough to never be materialized by the cost model
+	newChild := func() graph.Iterator {
+		return NewHasA(qs, NewLinksTo(qs, NewFixed(graph.PreFetched(quad.IRI("b"))), quad.Object), quad.Subject)
+	}
+	newAnd := func(child graph.Iterator) graph.Iterator {
+		all := NewFixed(
+			graph.PreFetched(quad.IRI("a")),
+			graph.PreFetched(quad.IRI("c")),
+			graph.PreFetched(quad.IRI("d")),
+		)
+		return NewAnd(qs, all, child)
+	}
+	var hasMaterialize func(it graph.Iterator) bool
+	hasMaterialize = func(it graph.Iterator) bool {
+		if it.Type() == graph.Materialize {
+			return true
+		}
+		for _, sub := range it.SubIterators() {
+			if hasMaterialize(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	results := func(it graph.Iterator, tag string) []quad.Value {
+		var out []quad.Value
+		for it.Next(ctx) {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			out = append(out, qs.NameOf(tags[tag]))
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	expect := []quad.Value{quad.IRI("a"), quad.IRI("c")}
+
+	opt, _ := newAnd(newChild()).Optimize()
+	if hasMaterialize(opt) {
+		t.Fatalf("unexpected materialization: %v", opt)
+	}
+
+	shared := MarkShared(newChild())
+	shared.Tagger().Add("follower")
+	if MarkShared(shared) != shared {
+		t.Error("iterator was marked twice")
+	}
+	if got := results(newAnd(shared.Clone()), "follower"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results without optimization: %v", got)
+	}
+	opt, _ = newAnd(shared).Optimize()
+	if !hasMaterialize(opt) {
+		t.Fatalf("shared iterator was not materialized: %v", opt)
+	}
+	if got := results(opt, "follower"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: %v", got)
+	}
+}
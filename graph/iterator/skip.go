@@ -7,7 +7,10 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 )
 
-var _ graph.Iterator = &Skip{}
+var (
+	_ graph.Iterator    = &Skip{}
+	_ graph.LimitHinter = &Skip{}
+)
 
 // Skip iterator will skip certain number of values from primary iterator.
 type Skip struct {
@@ -100,13 +103,21 @@ func (it *Skip) Type() graph.Type { return graph.Skip }
 
 func (it *Skip) Optimize() (graph.Iterator, bool) {
 	optimizedPrimaryIt, optimized := it.primaryIt.Optimize()
-	if it.skip == 0 { // nothing to skip
+	if it.skip == 0 || optimizedPrimaryIt.Type() == graph.Null { // nothing to skip, or no results
 		return optimizedPrimaryIt, true
 	}
 	it.primaryIt = optimizedPrimaryIt
 	return it, optimized
 }
 
+// SetLimitHint implements graph.LimitHinter. Skipped results are requested from the
+// primary iterator as well.
+func (it *Skip) SetLimitHint(n int64) {
+	if h, ok := it.primaryIt.(graph.LimitHinter); ok && n > 0 {
+		h.SetLimitHint(n + it.skip)
+	}
+}
+
 func (it *Skip) Stats() graph.IteratorStats {
 	primaryStats := it.primaryIt.Stats()
 	primaryStats.Size -= it.skip
@@ -0,0 +1,266 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &SlidingCount{}
+
+// ErrUnsorted is returned by SlidingCount if keys of the sub-iterator are not in ascending order.
+var ErrUnsorted = errors.New("sliding count: results are not sorted")
+
+// SlidingCount iterator returns results of the sub-iterator, and for each of them counts
+// the results within a window that ends at its key: the results with keys in the range
+// (key-window, key], including the current one. The count is stored in a tag.
+//
+// Keys are numbers or times, resolved from a tag or from the result itself. Times are
+// converted to seconds, thus the window is set in seconds as well. Results without
+// a numeric key are skipped.
+//
+// The sub-iterator must return results sorted by the key in ascending order, for example
+// by using the Sort iterator. Only the keys within the window are kept in memory.
+// If a key is less than the previous one, the iteration stops with ErrUnsorted.
+type SlidingCount struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     graph.QuadStore
+	subIt  graph.Iterator
+	by     string
+	window float64
+	as     string
+
+	keys     []float64 // keys within the window, in ascending order
+	last     float64
+	count    int
+	result   graph.Value
+	resTags  map[string]graph.Value
+	contains bool                // last result was produced by Contains; take tags from subIt
+	counts   map[interface{}]int // counts for Contains, collected on the first call
+	err      error
+}
+
+// NewSlidingCount creates a new SlidingCount iterator. If by is empty, the values of
+// results are used as keys. The count for each result is stored in the tag as.
+func NewSlidingCount(qs graph.QuadStore, sub graph.Iterator, by string, window float64, as string) *SlidingCount {
+	return &SlidingCount{
+		uid:    NextUID(),
+		qs:     qs,
+		subIt:  sub,
+		by:     by,
+		window: window,
+		as:     as,
+	}
+}
+
+func (it *SlidingCount) UID() uint64 {
+	return it.uid
+}
+
+// KeyTag returns the tag used as a key, or an empty string if values of results are used.
+func (it *SlidingCount) KeyTag() string { return it.by }
+
+// Window returns the size of the window.
+func (it *SlidingCount) Window() float64 { return it.window }
+
+// CountTag returns the tag that holds the count.
+func (it *SlidingCount) CountTag() string { return it.as }
+
+func (it *SlidingCount) Reset() {
+	it.subIt.Reset()
+	it.keys = it.keys[:0]
+	it.count = 0
+	it.result = nil
+	it.resTags = nil
+	it.contains = false
+	it.err = nil
+}
+
+func (it *SlidingCount) Close() error {
+	it.keys = nil
+	it.counts = nil
+	return it.subIt.Close()
+}
+
+func (it *SlidingCount) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *SlidingCount) TagResults(dst map[string]graph.Value) {
+	if it.result == nil {
+		return
+	}
+	if it.contains {
+		it.subIt.TagResults(dst)
+	} else {
+		for tag, val := range it.resTags {
+			dst[tag] = val
+		}
+	}
+	if it.as != "" {
+		dst[it.as] = graph.PreFetched(quad.Int(it.count))
+	}
+	it.tags.TagResult(dst, it.result)
+}
+
+func (it *SlidingCount) Clone() graph.Iterator {
+	out := NewSlidingCount(it.qs, it.subIt.Clone(), it.by, it.window, it.as)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *SlidingCount) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// slidingKey converts a value to a number used as a key of the window.
+func slidingKey(v quad.Value) (float64, bool) {
+	if t, ok := v.(quad.Time); ok {
+		return float64(time.Time(t).UnixNano()) / float64(time.Second), true
+	}
+	return numericValue(v)
+}
+
+// key returns the key of the current result of a given iterator.
+func (it *SlidingCount) key(sub graph.Iterator, tags map[string]graph.Value) (float64, bool) {
+	v := sub.Result()
+	if it.by != "" {
+		var ok bool
+		if v, ok = tags[it.by]; !ok {
+			return 0, false
+		}
+	}
+	return slidingKey(it.qs.NameOf(v))
+}
+
+// push adds the key to the window and returns the number of keys within it.
+func (it *SlidingCount) push(k float64) (int, error) {
+	if len(it.keys) != 0 && k < it.last {
+		return 0, ErrUnsorted
+	}
+	it.last = k
+	i := 0
+	for i < len(it.keys) && it.keys[i] <= k-it.window {
+		i++
+	}
+	if i != 0 {
+		// reuse the memory for the keys that left the window
+		n := copy(it.keys, it.keys[i:])
+		it.keys = it.keys[:n]
+	}
+	it.keys = append(it.keys, k)
+	return len(it.keys), nil
+}
+
+func (it *SlidingCount) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.contains = false
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	}
+	for it.subIt.Next(ctx) {
+		tags := make(map[string]graph.Value)
+		it.subIt.TagResults(tags)
+		k, ok := it.key(it.subIt, tags)
+		if !ok {
+			continue
+		}
+		n, err := it.push(k)
+		if err != nil {
+			it.err = err
+			break
+		}
+		it.result, it.resTags, it.count = it.subIt.Result(), tags, n
+		return graph.NextLogOut(it, true)
+	}
+	if it.err == nil {
+		it.err = it.subIt.Err()
+	}
+	it.result, it.resTags = nil, nil
+	return graph.NextLogOut(it, false)
+}
+
+// NextPath always returns false; paths of the sub-iterator are not counted.
+func (it *SlidingCount) NextPath(ctx context.Context) bool {
+	return false
+}
+
+// collectCounts runs a copy of the sub-iterator to find counts for all results.
+func (it *SlidingCount) collectCounts(ctx context.Context) error {
+	sub := it.subIt.Clone()
+	defer sub.Close()
+	win := NewSlidingCount(it.qs, sub, it.by, it.window, it.as)
+	it.counts = make(map[interface{}]int)
+	for win.Next(ctx) {
+		it.counts[graph.ToKey(win.Result())] = win.count
+	}
+	return win.Err()
+}
+
+// Contains checks the value against the sub-iterator. To find the count, the first call
+// scans a copy of the sub-iterator and keeps counts for all results in memory.
+// If the value has multiple keys, the count for the last one is used.
+func (it *SlidingCount) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.contains = true
+	if it.counts == nil {
+		if err := it.collectCounts(ctx); err != nil {
+			it.err = err
+			return graph.ContainsLogOut(it, val, false)
+		}
+	}
+	n, ok := it.counts[graph.ToKey(val)]
+	if !ok || !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result, it.count = val, n
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *SlidingCount) Err() error {
+	return it.err
+}
+
+func (it *SlidingCount) Result() graph.Value {
+	return it.result
+}
+
+func (it *SlidingCount) Type() graph.Type { return graph.SlidingCount }
+
+func (it *SlidingCount) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
+	}
+	return it, false
+}
+
+// Stats accounts for scanning all the results of the sub-iterator on the first call to Contains.
+func (it *SlidingCount) Stats() graph.IteratorStats {
+	st := it.subIt.Stats()
+	if it.counts == nil {
+		st.ContainsCost += st.NextCost * st.Size
+	}
+	// results without a key are skipped
+	st.ExactSize = false
+	return st
+}
+
+func (it *SlidingCount) Size() (int64, bool) {
+	sz, _ := it.subIt.Size()
+	return sz, false
+}
+
+func (it *SlidingCount) String() string {
+	return fmt.Sprintf("SlidingCount(%q, %v, %q)", it.by, it.window, it.as)
+}
@@ -0,0 +1,114 @@
+package iterator_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func slidingCounts(t *testing.T, qs graph.QuadStore, it graph.Iterator) (keys []quad.Value, counts []int64) {
+	ctx := context.TODO()
+	for it.Next(ctx) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		keys = append(keys, qs.NameOf(it.Result()))
+		counts = append(counts, int64(qs.NameOf(tags["n"]).(quad.Int)))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return keys, counts
+}
+
+func TestSlidingCount(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{}
+	vals := []quad.Value{
+		quad.Int(1), quad.Int(2), quad.Float(3), quad.String("skipped"),
+		quad.Int(5), quad.Int(8), quad.Int(9), quad.Int(9), quad.Int(10),
+	}
+	for _, v := range vals {
+		qs.Data = append(qs.Data, quad.Make(quad.IRI("s"), quad.IRI("p"), v, nil))
+	}
+	newFixed := func() *Fixed {
+		fixed := NewFixed()
+		for _, v := range vals {
+			fixed.Add(graph.PreFetched(v))
+		}
+		return fixed
+	}
+
+	it := NewSlidingCount(qs, newFixed(), "", 3, "n")
+	keys, counts := slidingCounts(t, qs, it)
+	if len(keys) != len(vals)-1 {
+		t.Errorf("unexpected results: %v", keys)
+	}
+	// each result counts itself and the results with keys in (key-3, key]
+	expect := []int64{1, 2, 3, 2, 1, 2, 3, 4}
+	if !reflect.DeepEqual(counts, expect) {
+		t.Errorf("unexpected counts: %v vs %v", counts, expect)
+	}
+	it.Reset()
+	if _, counts = slidingCounts(t, qs, it); !reflect.DeepEqual(counts, expect) {
+		t.Errorf("unexpected counts after reset: %v", counts)
+	}
+
+	it = NewSlidingCount(qs, newFixed(), "", 3, "n")
+	if !it.Contains(ctx, graph.PreFetched(quad.Int(5))) {
+		t.Fatal("expected value to be found")
+	}
+	tags := make(map[string]graph.Value)
+	it.TagResults(tags)
+	if n := qs.NameOf(tags["n"]); n != quad.Int(2) {
+		t.Errorf("unexpected count for contains: %v", n)
+	}
+	if it.Contains(ctx, graph.PreFetched(quad.String("skipped"))) {
+		t.Error("values without a key should not be returned")
+	}
+
+	d := graph.DescribeIteratorFor(qs, it)
+	it2, err := graph.BuildFromDescription(qs, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, counts = slidingCounts(t, qs, it2); !reflect.DeepEqual(counts, expect) {
+		t.Errorf("unexpected counts of a rebuilt iterator: %v", counts)
+	}
+
+	unsorted := NewFixed(graph.PreFetched(quad.Int(2)), graph.PreFetched(quad.Int(1)))
+	it = NewSlidingCount(qs, unsorted, "", 3, "n")
+	for it.Next(ctx) {
+	}
+	if err := it.Err(); err != ErrUnsorted {
+		t.Errorf("expected an error for unsorted results, got: %v", err)
+	}
+}
+
+func TestSlidingCountByTag(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	var data []quad.Quad
+	for i, min := range []int{0, 1, 2, 10, 11} {
+		data = append(data, quad.Make(quad.IRI(fmt.Sprintf("e%d", i)), quad.IRI("at"), quad.Time(t0.Add(time.Duration(min)*time.Minute)), nil))
+	}
+	qs := &graphmock.Store{Data: data}
+
+	events := NewLinksTo(qs, NewFixed(graph.PreFetched(quad.IRI("at"))), quad.Predicate)
+	subj := NewHasA(qs, events, quad.Subject)
+	times := NewHasA(qs, NewLinksTo(qs, subj, quad.Subject), quad.Object)
+	times.Tagger().Add("t")
+	sorted := NewSort(qs, times, "t", false)
+
+	// count events within the last 5 minutes
+	it := NewSlidingCount(qs, sorted, "t", 5*60, "n")
+	_, counts := slidingCounts(t, qs, it)
+	if expect := []int64{1, 2, 3, 1, 2}; !reflect.DeepEqual(counts, expect) {
+		t.Errorf("unexpected counts: %v vs %v", counts, expect)
+	}
+}
@@ -0,0 +1,393 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Sort{}
+
+// Sort iterator reads all results of the sub-iterator and returns them ordered by
+// the value of the result, or by the value of one of its tags.
+//
+// When sorting by a tag, each path of the sub-iterator becomes a separate result,
+// since paths to the same value may have different values of the tag.
+// Results with no value for the tag are returned last.
+//
+// Buffered results are accounted in the memory budget of the context (see graph.WithBudget).
+// If the budget is exceeded, iteration fails with graph.ErrBudgetExceeded.
+type Sort struct {
+	uid      uint64
+	tags     graph.Tagger
+	qs       graph.QuadStore
+	subIt    graph.Iterator
+	by       string
+	desc     bool
+	values   [][]result
+	index    int
+	subindex int
+	hasRun   bool
+	contains bool // last result was produced by Contains; take tags from subIt
+	result   graph.Value
+	err      error
+	budget   *graph.Budget
+	reserved int64
+}
+
+// NewSort creates a new Sort iterator. If tag is empty, results will be sorted by
+// their own values.
+func NewSort(qs graph.QuadStore, sub graph.Iterator, tag string, desc bool) *Sort {
+	return &Sort{
+		uid:   NextUID(),
+		qs:    qs,
+		subIt: sub,
+		by:    tag,
+		desc:  desc,
+		index: -1,
+	}
+}
+
+func (it *Sort) UID() uint64 {
+	return it.uid
+}
+
+// SortBy returns the tag used for ordering, or an empty string if results are
+// ordered by their values.
+func (it *Sort) SortBy() string { return it.by }
+
+// Descending returns true if results are returned in descending order.
+func (it *Sort) Descending() bool { return it.desc }
+
+func (it *Sort) Reset() {
+	it.index = -1
+	it.subindex = 0
+	it.contains = false
+	it.result = nil
+}
+
+func (it *Sort) Close() error {
+	it.values = nil
+	it.hasRun = false
+	it.release()
+	return it.subIt.Close()
+}
+
+// release returns memory used by buffered results to the budget.
+func (it *Sort) release() {
+	it.budget.Release(it.reserved)
+	it.budget, it.reserved = nil, 0
+}
+
+func (it *Sort) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Sort) TagResults(dst map[string]graph.Value) {
+	if it.contains {
+		it.subIt.TagResults(dst)
+	} else if it.index >= 0 && it.index < len(it.values) {
+		for tag, val := range it.values[it.index][it.subindex].tags {
+			dst[tag] = val
+		}
+	}
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *Sort) Clone() graph.Iterator {
+	out := NewSort(it.qs, it.subIt.Clone(), it.by, it.desc)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Sort) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Sort) Type() graph.Type { return graph.Sort }
+
+func (it *Sort) String() string {
+	dir := "asc"
+	if it.desc {
+		dir = "desc"
+	}
+	if it.by == "" {
+		return fmt.Sprintf("Sort(%s)", dir)
+	}
+	return fmt.Sprintf("Sort(%q, %s)", it.by, dir)
+}
+
+func (it *Sort) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
+	}
+	return it, false
+}
+
+// Size is the same as the size of the sub-iterator.
+func (it *Sort) Size() (int64, bool) {
+	if it.hasRun {
+		n := 0
+		for _, vals := range it.values {
+			n += len(vals)
+		}
+		return int64(n), true
+	}
+	return it.subIt.Size()
+}
+
+// Stats accounts for sorting all the results of the sub-iterator before the first one
+// can be returned.
+func (it *Sort) Stats() graph.IteratorStats {
+	st := it.subIt.Stats()
+	st.Size, st.ExactSize = it.Size()
+	if !it.hasRun {
+		st.NextCost += st.NextCost * st.Size
+	}
+	return st
+}
+
+func (it *Sort) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.contains = false
+	if !it.hasRun {
+		it.run(ctx)
+	}
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	}
+	it.index++
+	it.subindex = 0
+	if it.index >= len(it.values) {
+		it.result = nil
+		return graph.NextLogOut(it, false)
+	}
+	it.result = it.values[it.index][0].id
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Sort) NextPath(ctx context.Context) bool {
+	if it.contains {
+		return it.subIt.NextPath(ctx)
+	}
+	if it.index < 0 || it.index >= len(it.values) {
+		return false
+	}
+	if it.subindex+1 >= len(it.values[it.index]) {
+		return false
+	}
+	it.subindex++
+	return true
+}
+
+// Contains checks the value against the sub-iterator, since the order of results
+// does not change the set of values.
+func (it *Sort) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.contains = true
+	if !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *Sort) Err() error {
+	return it.err
+}
+
+func (it *Sort) Result() graph.Value {
+	return it.result
+}
+
+// sortKey returns the value that will be used to order a given result.
+func (it *Sort) sortKey(r result) quad.Value {
+	v := r.id
+	if it.by != "" {
+		var ok bool
+		if v, ok = r.tags[it.by]; !ok {
+			return nil
+		}
+	}
+	return it.qs.NameOf(v)
+}
+
+func (it *Sort) run(ctx context.Context) {
+	it.hasRun = true
+	it.subIt.Reset()
+	it.budget = graph.BudgetFromContext(ctx)
+	for it.subIt.Next(ctx) {
+		var paths []result
+		for {
+			tags := make(map[string]graph.Value)
+			it.subIt.TagResults(tags)
+			sz := graph.RowSize(len(tags))
+			if err := it.budget.Reserve(sz); err != nil {
+				it.err = err
+				it.values = nil
+				it.release()
+				return
+			}
+			it.reserved += sz
+			paths = append(paths, result{id: it.subIt.Result(), tags: tags})
+			if !it.subIt.NextPath(ctx) {
+				break
+			}
+		}
+		if it.by == "" {
+			it.values = append(it.values, paths)
+			continue
+		}
+		for _, r := range paths {
+			it.values = append(it.values, []result{r})
+		}
+	}
+	if err := it.subIt.Err(); err != nil {
+		it.err = err
+		it.values = nil
+		it.release()
+		return
+	}
+	keys := make([]quad.Value, len(it.values))
+	for i, vals := range it.values {
+		keys[i] = it.sortKey(vals[0])
+	}
+	sort.Stable(sortResults{vals: it.values, keys: keys, desc: it.desc})
+}
+
+type sortResults struct {
+	vals [][]result
+	keys []quad.Value
+	desc bool
+}
+
+func (s sortResults) Len() int { return len(s.vals) }
+func (s sortResults) Less(i, j int) bool {
+	a, b := s.keys[i], s.keys[j]
+	// missing values are always last
+	if a == nil || b == nil {
+		return a != nil && b == nil
+	}
+	if s.desc {
+		return CompareValues(b, a) < 0
+	}
+	return CompareValues(a, b) < 0
+}
+func (s sortResults) Swap(i, j int) {
+	s.vals[i], s.vals[j] = s.vals[j], s.vals[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// valueKind defines an order of values of different types. Numbers are compared
+// with each other regardless of their type.
+func valueKind(v quad.Value) int {
+	switch v.(type) {
+	case quad.Int, quad.Float:
+		return 0
+	case quad.Time:
+		return 1
+	case quad.Bool:
+		return 2
+	case quad.String, quad.TypedString, quad.LangString:
+		return 3
+	case quad.IRI:
+		return 4
+	case quad.BNode:
+		return 5
+	}
+	return 6
+}
+
+// CompareValues returns an integer comparing two values. The result will be 0 if a == b,
+// -1 if a < b, and +1 if a > b. Values of different types are ordered by type:
+// numbers, times, booleans, strings, IRIs, blank nodes, and the rest.
+func CompareValues(a, b quad.Value) int {
+	if ka, kb := valueKind(a), valueKind(b); ka != kb {
+		if ka < kb {
+			return -1
+		}
+		return +1
+	}
+	switch a := a.(type) {
+	case quad.Int:
+		switch b := b.(type) {
+		case quad.Int:
+			return compareInts(int64(a), int64(b))
+		case quad.Float:
+			return compareIntFloat(int64(a), float64(b))
+		}
+	case quad.Float:
+		switch b := b.(type) {
+		case quad.Int:
+			return -compareIntFloat(int64(b), float64(a))
+		case quad.Float:
+			return compareFloats(float64(a), float64(b))
+		}
+	case quad.Time:
+		ta, tb := time.Time(a), time.Time(b.(quad.Time))
+		if ta.Before(tb) {
+			return -1
+		} else if ta.After(tb) {
+			return +1
+		}
+		return 0
+	case quad.Bool:
+		if ab, bb := bool(a), bool(b.(quad.Bool)); ab == bb {
+			return 0
+		} else if !ab {
+			return -1
+		}
+		return +1
+	}
+	return strings.Compare(quad.StringOf(a), quad.StringOf(b))
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return +1
+	}
+	return 0
+}
+
+// compareIntFloat compares an integer with a float without converting the integer
+// to float64, which loses precision for values above 2^53.
+func compareIntFloat(a int64, b float64) int {
+	const maxInt = float64(1 << 63)
+	switch {
+	case math.IsNaN(b):
+		return 0
+	case b >= maxInt:
+		return -1
+	case b < -maxInt:
+		return +1
+	}
+	t := math.Trunc(b)
+	if c := compareInts(a, int64(t)); c != 0 {
+		return c
+	}
+	// integer parts are equal; the fractional part decides
+	return compareFloats(0, b-t)
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return +1
+	}
+	return 0
+}
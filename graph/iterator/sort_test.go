@@ -0,0 +1,114 @@
+package iterator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestSortBudget(t *testing.T) {
+	// sorting all results would take gigabytes of memory
+	const limit = 1 << 20
+	b := graph.NewBudget(limit, nil)
+	ctx := graph.WithBudget(context.TODO(), b)
+
+	it := NewSort(&graphmock.Store{}, NewInt64(1, 1<<40, true), "", false)
+	if it.Next(ctx) {
+		t.Fatal("expected no results")
+	}
+	if err, ok := it.Err().(*graph.ErrBudgetExceeded); !ok {
+		t.Fatalf("unexpected error: %v", it.Err())
+	} else if err.Limit != limit || err.Global {
+		t.Errorf("unexpected error: %#v", err)
+	}
+	if n := b.Used(); n != 0 {
+		t.Errorf("memory was not released: %d", n)
+	}
+
+	// results that fit into the budget are sorted as usual
+	fixed := NewFixed()
+	for i := 0; i < 100; i++ {
+		fixed.Add(graph.PreFetched(quad.Int(i)))
+	}
+	it = NewSort(&graphmock.Store{}, fixed, "", false)
+	n := 0
+	for it.Next(ctx) {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	} else if n != 100 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+	if b.Used() == 0 {
+		t.Error("expected memory to be reserved")
+	}
+	it.Close()
+	if n := b.Used(); n != 0 {
+		t.Errorf("memory was not released: %d", n)
+	}
+}
+
+func TestSharedBudget(t *testing.T) {
+	const n = 100
+	newTree := func() graph.Iterator {
+		fixed := NewFixed()
+		for i := 0; i < n; i++ {
+			fixed.Add(graph.PreFetched(quad.Int(i)))
+		}
+		return NewSort(&graphmock.Store{}, NewUnique(fixed), "", false)
+	}
+	// both iterators buffer all values; each of them fits into the budget alone
+	perIt := int64(n) * graph.AvgValueSize
+	for _, c := range []struct {
+		name  string
+		limit int64
+		fail  bool
+	}{
+		{"fits", 2 * perIt, false},
+		{"exceeded", perIt + perIt/2, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := graph.NewBudget(c.limit, nil)
+			vals, err := graph.Iterate(context.TODO(), newTree()).UnOptimized().Budget(b).All()
+			if c.fail {
+				if _, ok := err.(*graph.ErrBudgetExceeded); !ok {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if len(vals) != n {
+				t.Errorf("unexpected number of results: %d", len(vals))
+			}
+			if used := b.Used(); used != 0 {
+				t.Errorf("memory was not released: %d", used)
+			}
+		})
+	}
+}
+
+func TestCompareNumbers(t *testing.T) {
+	const big = 1<<53 + 1
+	for _, c := range []struct {
+		a, b quad.Value
+		exp  int
+	}{
+		{quad.Int(big), quad.Int(big - 1), +1},
+		{quad.Int(big - 1), quad.Int(big), -1},
+		{quad.Int(big), quad.Float(1 << 53), +1},
+		{quad.Float(1 << 53), quad.Int(big), -1},
+		{quad.Int(2), quad.Float(2), 0},
+		{quad.Int(2), quad.Float(2.5), -1},
+		{quad.Int(-2), quad.Float(-2.5), +1},
+		{quad.Int(1<<63 - 1), quad.Float(1 << 63), -1},
+		{quad.Int(-1 << 63), quad.Float(-1 << 63), 0},
+	} {
+		if got := CompareValues(c.a, c.b); got != c.exp {
+			t.Errorf("compare(%v, %v): expected %d, got %d", c.a, c.b, c.exp, got)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package iterator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &SyncIterator{}
+
+// SyncIterator wraps an iterator and serializes all calls to its methods with a mutex,
+// thus it can be shared between goroutines without data races.
+//
+// It does not make iteration parallel: only one goroutine can use the underlying iterator
+// at a time, and others will wait for it. Also, each method is serialized separately, so
+// a pair of Next and Result calls made by one goroutine may interleave with calls made by
+// another one. Use NextResult to advance the iterator and read its result atomically.
+type SyncIterator struct {
+	uid uint64
+	mu  sync.Mutex
+	sub graph.Iterator
+}
+
+// NewSyncIterator wraps an iterator to make it safe for concurrent use.
+func NewSyncIterator(sub graph.Iterator) *SyncIterator {
+	return &SyncIterator{
+		uid: NextUID(),
+		sub: sub,
+	}
+}
+
+func (it *SyncIterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *SyncIterator) Reset() {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.sub.Reset()
+}
+
+func (it *SyncIterator) Tagger() *graph.Tagger {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Tagger()
+}
+
+func (it *SyncIterator) TagResults(dst map[string]graph.Value) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.sub.TagResults(dst)
+}
+
+// Clone returns a copy of the iterator with a separate lock.
+func (it *SyncIterator) Clone() graph.Iterator {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return NewSyncIterator(it.sub.Clone())
+}
+
+// SubIterators returns a slice of the sub iterators.
+//
+// Sub iterators are not protected by the lock and should not be used directly.
+func (it *SyncIterator) SubIterators() []graph.Iterator {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return []graph.Iterator{it.sub}
+}
+
+func (it *SyncIterator) Next(ctx context.Context) bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Next(ctx)
+}
+
+// NextResult advances the iterator and returns the next result. It holds the lock for
+// both operations, so the result cannot be changed by concurrent calls.
+func (it *SyncIterator) NextResult(ctx context.Context) (graph.Value, bool) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if !it.sub.Next(ctx) {
+		return nil, false
+	}
+	return it.sub.Result(), true
+}
+
+func (it *SyncIterator) Err() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Err()
+}
+
+func (it *SyncIterator) Result() graph.Value {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Result()
+}
+
+func (it *SyncIterator) Contains(ctx context.Context, val graph.Value) bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Contains(ctx, val)
+}
+
+func (it *SyncIterator) NextPath(ctx context.Context) bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.NextPath(ctx)
+}
+
+func (it *SyncIterator) Close() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Close()
+}
+
+func (it *SyncIterator) Type() graph.Type { return graph.Sync }
+
+// Optimize optimizes the wrapped iterator. The wrapper itself is always kept,
+// since the caller expects the result to be safe for concurrent use.
+func (it *SyncIterator) Optimize() (graph.Iterator, bool) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	sub, optimized := it.sub.Optimize()
+	it.sub = sub
+	return it, optimized
+}
+
+func (it *SyncIterator) Stats() graph.IteratorStats {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Stats()
+}
+
+func (it *SyncIterator) Size() (int64, bool) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.sub.Size()
+}
+
+func (it *SyncIterator) String() string {
+	return "Sync"
+}
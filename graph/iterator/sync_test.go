@@ -0,0 +1,66 @@
+package iterator_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func TestSyncIterator(t *testing.T) {
+	const n = 1000
+	vals := make([]graph.Value, n)
+	for i := range vals {
+		vals[i] = Int64Node(i)
+	}
+	it := NewSyncIterator(NewFixed(vals...))
+	if o, _ := it.Optimize(); o != graph.Iterator(it) {
+		t.Fatalf("sync iterator should not be removed by the optimizer")
+	}
+
+	ctx := context.TODO()
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got []int
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// sub-iterator is replaced concurrently with other calls
+		it.Optimize()
+	}()
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, ok := it.NextResult(ctx)
+				if !ok {
+					return
+				}
+				it.Size()
+				it.SubIterators()
+				mu.Lock()
+				got = append(got, int(v.(Int64Node)))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != n {
+		t.Fatalf("unexpected number of results: %d vs %d", len(got), n)
+	}
+	sort.Ints(got)
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("unexpected result at %d: %d", i, v)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var (
+	_ graph.Iterator  = &Timeout{}
+	_ graph.Truncater = &Timeout{}
+)
+
+// Timeout iterator stops iterating when a given duration has passed since the
+// first call to Next. Results that were returned before are kept, and the iterator
+// is marked as truncated. Zero and negative durations means no timeout.
+//
+// Timeout is only checked between calls to the primary iterator, thus a single
+// blocking call is not interrupted. Use context deadlines for this purpose.
+type Timeout struct {
+	uid       uint64
+	timeout   time.Duration
+	deadline  time.Time
+	primaryIt graph.Iterator
+	truncated bool
+}
+
+// NewTimeout creates a new Timeout iterator that stops the primary iterator after a given duration.
+func NewTimeout(primaryIt graph.Iterator, timeout time.Duration) *Timeout {
+	return &Timeout{
+		uid:       NextUID(),
+		timeout:   timeout,
+		primaryIt: primaryIt,
+	}
+}
+
+func (it *Timeout) UID() uint64 {
+	return it.uid
+}
+
+// Duration returns the timeout of the iterator.
+func (it *Timeout) Duration() time.Duration {
+	return it.timeout
+}
+
+// Reset resets the internal iterators and the iterator itself. The timeout is restarted
+// on the next call to Next.
+func (it *Timeout) Reset() {
+	it.deadline = time.Time{}
+	it.truncated = false
+	it.primaryIt.Reset()
+}
+
+func (it *Timeout) Tagger() *graph.Tagger {
+	return it.primaryIt.Tagger()
+}
+
+func (it *Timeout) TagResults(dst map[string]graph.Value) {
+	it.primaryIt.TagResults(dst)
+}
+
+func (it *Timeout) Clone() graph.Iterator {
+	return NewTimeout(it.primaryIt.Clone(), it.timeout)
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Timeout) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.primaryIt}
+}
+
+// expired checks if the timeout has passed, starting the timer on the first call.
+func (it *Timeout) expired() bool {
+	if it.timeout <= 0 {
+		return false
+	} else if it.truncated {
+		return true
+	}
+	now := time.Now()
+	if it.deadline.IsZero() {
+		it.deadline = now.Add(it.timeout)
+		return false
+	}
+	if now.After(it.deadline) {
+		it.truncated = true
+	}
+	return it.truncated
+}
+
+// Next advances the Timeout iterator. It will stop iteration if the timeout has passed.
+func (it *Timeout) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if it.expired() {
+		return graph.NextLogOut(it, false)
+	}
+	return graph.NextLogOut(it, it.primaryIt.Next(ctx))
+}
+
+func (it *Timeout) Err() error {
+	return it.primaryIt.Err()
+}
+
+func (it *Timeout) Result() graph.Value {
+	return it.primaryIt.Result()
+}
+
+func (it *Timeout) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if it.expired() {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	return graph.ContainsLogOut(it, val, it.primaryIt.Contains(ctx, val))
+}
+
+// NextPath checks whether there is another path. Will call primary iterator
+// if the timeout has not passed yet.
+func (it *Timeout) NextPath(ctx context.Context) bool {
+	if it.expired() {
+		return false
+	}
+	return it.primaryIt.NextPath(ctx)
+}
+
+// Truncated reports if the iteration was stopped because of the timeout.
+func (it *Timeout) Truncated() bool {
+	return it.truncated
+}
+
+// Close closes the primary iterator.
+func (it *Timeout) Close() error {
+	return it.primaryIt.Close()
+}
+
+func (it *Timeout) Type() graph.Type { return graph.Timeout }
+
+func (it *Timeout) Optimize() (graph.Iterator, bool) {
+	optimizedPrimaryIt, optimized := it.primaryIt.Optimize()
+	if it.timeout <= 0 || optimizedPrimaryIt.Type() == graph.Null { // no timeout, or nothing to iterate
+		return optimizedPrimaryIt, true
+	}
+	it.primaryIt = optimizedPrimaryIt
+	return it, optimized
+}
+
+func (it *Timeout) Stats() graph.IteratorStats {
+	return it.primaryIt.Stats()
+}
+
+func (it *Timeout) Size() (int64, bool) {
+	return it.primaryIt.Size()
+}
+
+func (it *Timeout) String() string {
+	return fmt.Sprintf("Timeout(%v)", it.timeout)
+}
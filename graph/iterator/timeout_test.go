@@ -0,0 +1,55 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+// slowIterator sleeps before each call to Next.
+type slowIterator struct {
+	*Fixed
+	delay time.Duration
+}
+
+func (it *slowIterator) Next(ctx context.Context) bool {
+	time.Sleep(it.delay)
+	return it.Fixed.Next(ctx)
+}
+
+func TestTimeoutIterator(t *testing.T) {
+	newFixed := func() *Fixed {
+		return NewFixed(Int64Node(1), Int64Node(2), Int64Node(3))
+	}
+
+	it := NewTimeout(newFixed(), time.Minute)
+	if got, expect := iterated(it), []int{1, 2, 3}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate Timeout correctly: got:%v expected:%v", got, expect)
+	}
+	if it.Truncated() {
+		t.Error("iterator should not be truncated before the timeout")
+	}
+
+	it = NewTimeout(&slowIterator{Fixed: newFixed(), delay: 20 * time.Millisecond}, 30*time.Millisecond)
+	got := iterated(it)
+	if len(got) == 0 || len(got) >= 3 {
+		t.Errorf("expected iteration to stop early, got: %v", got)
+	}
+	if !it.Truncated() || !graph.IsTruncated(NewOr(it)) {
+		t.Error("iterator should be truncated after the timeout")
+	}
+	it.Reset()
+	if it.Truncated() {
+		t.Error("truncated flag should be cleared on reset")
+	}
+
+	// no timeout
+	opt, _ := NewTimeout(newFixed(), 0).Optimize()
+	if opt.Type() != graph.Fixed {
+		t.Errorf("expected timeout to be removed, got: %v", opt)
+	}
+}
@@ -0,0 +1,33 @@
+package iterator
+
+import (
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+// NewTypeFilter returns nodes that have a given type, in other words, subjects of
+// quads with the rdf:type predicate and the type as an object.
+//
+// It returns the Null iterator if the type is not in the quad store.
+func NewTypeFilter(qs graph.QuadStore, typ quad.Value) graph.Iterator {
+	pred := qs.ValueOf(quad.IRI(rdf.Type))
+	obj := qs.ValueOf(typ)
+	if pred == nil || obj == nil {
+		return NewNull()
+	}
+	quads := NewAnd(qs,
+		NewLinksTo(qs, NewFixed(pred), quad.Predicate),
+		NewLinksTo(qs, NewFixed(obj), quad.Object),
+	)
+	// the type may be set multiple times, in different labels
+	return NewUnique(NewHasA(qs, quads, quad.Subject))
+}
+
+// NewNotOfType returns nodes of a given type that are not returned by the exclude
+// iterator. Unlike Not over all nodes of the quad store, only the nodes of the type
+// are iterated, and the size is estimated as the number of nodes of the type minus
+// the size of the exclude iterator.
+func NewNotOfType(qs graph.QuadStore, typ quad.Value, exclude graph.Iterator) graph.Iterator {
+	return NewNot(exclude, NewTypeFilter(qs, typ))
+}
@@ -0,0 +1,119 @@
+package iterator_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+func typedStore() graph.QuadStore {
+	typ := quad.IRI(rdf.Type)
+	return memstore.New(
+		quad.MakeIRI("alice", rdf.Type, "person", ""),
+		quad.MakeIRI("bob", rdf.Type, "person", ""),
+		quad.MakeIRI("bob", rdf.Type, "person", "g"),
+		quad.MakeIRI("carol", rdf.Type, "person", ""),
+		quad.MakeIRI("dave", rdf.Type, "person", ""),
+		quad.MakeIRI("acme", rdf.Type, "company", ""),
+		quad.MakeIRI("initech", rdf.Type, "company", ""),
+		quad.Quad{Subject: quad.IRI("person"), Predicate: typ, Object: quad.IRI("class")},
+		quad.MakeIRI("alice", "works_at", "acme", ""),
+		quad.MakeIRI("carol", "works_at", "initech", ""),
+		quad.MakeIRI("acme", "works_at", "initech", ""),
+	)
+}
+
+func nodeNames(t *testing.T, qs graph.QuadStore, it graph.Iterator) []string {
+	ctx := context.TODO()
+	var out []string
+	for it.Next(ctx) {
+		out = append(out, quad.StringOf(qs.NameOf(it.Result())))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// employees returns subjects of works_at quads.
+func employees(qs graph.QuadStore) graph.Iterator {
+	return NewHasA(qs,
+		NewLinksTo(qs, NewFixed(qs.ValueOf(quad.IRI("works_at"))), quad.Predicate),
+		quad.Subject,
+	)
+}
+
+func TestTypeFilter(t *testing.T) {
+	qs := typedStore()
+	it := NewTypeFilter(qs, quad.IRI("person"))
+	got := nodeNames(t, qs, it)
+	expect := []string{"<alice>", "<bob>", "<carol>", "<dave>"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected nodes: got: %v, expected: %v", got, expect)
+	}
+	if it := NewTypeFilter(qs, quad.IRI("robot")); it.Type() != graph.Null {
+		t.Errorf("expected Null for an unknown type, got: %v", it.Type())
+	}
+}
+
+func TestNotOfType(t *testing.T) {
+	ctx := context.TODO()
+	qs := typedStore()
+	newIt := func() graph.Iterator {
+		return NewNotOfType(qs, quad.IRI("person"), employees(qs))
+	}
+
+	// acme is an employee as well, but not a person
+	it := newIt()
+	got := nodeNames(t, qs, it)
+	expect := []string{"<bob>", "<dave>"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected nodes: got: %v, expected: %v", got, expect)
+	}
+
+	for name, exp := range map[string]bool{
+		"bob":     true,
+		"dave":    true,
+		"alice":   false,
+		"initech": false,
+		"person":  false,
+	} {
+		it.Reset()
+		if got := it.Contains(ctx, qs.ValueOf(quad.IRI(name))); got != exp {
+			t.Errorf("unexpected Contains for %q: got: %v, expected: %v", name, got, exp)
+		}
+	}
+
+	// the size is estimated from the size of the type filter, and never goes below zero
+	typeSize := NewTypeFilter(qs, quad.IRI("person")).Stats().Size
+	exclude := NewFixed(qs.ValueOf(quad.IRI("alice")))
+	if size := NewNotOfType(qs, quad.IRI("person"), exclude).Stats().Size; size != typeSize-1 {
+		t.Errorf("unexpected size: got: %d, expected: %d", size, typeSize-1)
+	}
+	exclude = NewFixed()
+	for i := int64(0); i <= typeSize; i++ {
+		exclude.Add(Int64Node(i))
+	}
+	if size := NewNotOfType(qs, quad.IRI("person"), exclude).Stats().Size; size != 0 {
+		t.Errorf("unexpected size: got: %d, expected: 0", size)
+	}
+
+	// the result is the same after optimization
+	opt, _ := newIt().Optimize()
+	if got := nodeNames(t, qs, opt); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected nodes after Optimize: got: %v, expected: %v", got, expect)
+	}
+
+	opt, _ = NewNotOfType(qs, quad.IRI("robot"), employees(qs)).Optimize()
+	if opt.Type() != graph.Null {
+		t.Errorf("expected Null for an unknown type, got: %v", opt.Type())
+	}
+}
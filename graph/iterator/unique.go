@@ -9,6 +9,9 @@ import (
 var _ graph.Iterator = &Unique{}
 
 // Unique iterator removes duplicate values from it's subiterator.
+//
+// Seen values are accounted in the memory budget of the context (see graph.WithBudget).
+// If the budget is exceeded, iteration fails with graph.ErrBudgetExceeded.
 type Unique struct {
 	uid      uint64
 	tags     graph.Tagger
@@ -17,6 +20,8 @@ type Unique struct {
 	runstats graph.IteratorStats
 	err      error
 	seen     map[interface{}]bool
+	budget   *graph.Budget
+	reserved int64
 }
 
 func NewUnique(subIt graph.Iterator) *Unique {
@@ -34,8 +39,16 @@ func (it *Unique) UID() uint64 {
 // Reset resets the internal iterators and the iterator itself.
 func (it *Unique) Reset() {
 	it.result = nil
+	it.err = nil
 	it.subIt.Reset()
 	it.seen = make(map[interface{}]bool)
+	it.release()
+}
+
+// release returns memory used by seen values to the budget.
+func (it *Unique) release() {
+	it.budget.Release(it.reserved)
+	it.budget, it.reserved = nil, 0
 }
 
 func (it *Unique) Tagger() *graph.Tagger {
@@ -67,11 +80,25 @@ func (it *Unique) SubIterators() []graph.Iterator {
 func (it *Unique) Next(ctx context.Context) bool {
 	graph.NextLogIn(it)
 	it.runstats.Next += 1
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	}
+	if it.budget == nil {
+		it.budget = graph.BudgetFromContext(ctx)
+	}
 
 	for it.subIt.Next(ctx) {
 		curr := it.subIt.Result()
 		key := graph.ToKey(curr)
 		if ok := it.seen[key]; !ok {
+			if err := it.budget.Reserve(graph.AvgValueSize); err != nil {
+				it.err = err
+				it.result = nil
+				it.seen = nil
+				it.release()
+				return graph.NextLogOut(it, false)
+			}
+			it.reserved += graph.AvgValueSize
 			it.result = curr
 			it.seen[key] = true
 			return graph.NextLogOut(it, true)
@@ -107,6 +134,7 @@ func (it *Unique) NextPath(ctx context.Context) bool {
 // Close closes the primary iterators.
 func (it *Unique) Close() error {
 	it.seen = nil
+	it.release()
 	return it.subIt.Close()
 }
 
@@ -117,6 +145,9 @@ func (it *Unique) Optimize() (graph.Iterator, bool) {
 	if optimized {
 		it.subIt = newIt
 	}
+	if it.subIt.Type() == graph.Null {
+		return it.subIt, true
+	}
 	return it, false
 }
 
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph"
 	. "github.com/cayleygraph/cayley/graph/iterator"
 )
 
@@ -34,3 +35,23 @@ func TestUniqueIteratorBasics(t *testing.T) {
 		}
 	}
 }
+
+func TestUniqueBudget(t *testing.T) {
+	b := graph.NewBudget(10*graph.AvgValueSize, nil)
+	ctx := graph.WithBudget(context.TODO(), b)
+
+	it := NewUnique(NewInt64(1, 100, true))
+	n := 0
+	for it.Next(ctx) {
+		n++
+	}
+	if _, ok := it.Err().(*graph.ErrBudgetExceeded); !ok {
+		t.Fatalf("unexpected error: %v", it.Err())
+	} else if n != 10 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+	if used := b.Used(); used != 0 {
+		t.Errorf("memory was not released: %d", used)
+	}
+	it.Close()
+}
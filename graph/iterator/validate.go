@@ -0,0 +1,252 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Validate{}
+
+// QuadRule checks a single quad and returns a description of the violation,
+// or an empty string if the quad is valid.
+type QuadRule func(ctx context.Context, qs graph.QuadStore, q graph.Value) string
+
+// NodesExist returns a rule that reports quads referencing nodes in given
+// directions that cannot be resolved by the quad store.
+func NodesExist(dirs ...quad.Direction) QuadRule {
+	return func(ctx context.Context, qs graph.QuadStore, q graph.Value) string {
+		var missing []string
+		for _, d := range dirs {
+			if qs.NameOf(qs.QuadDirection(q, d)) == nil {
+				missing = append(missing, d.String())
+			}
+		}
+		if len(missing) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%s node does not exist", strings.Join(missing, ", "))
+	}
+}
+
+// NodesIn returns a rule that reports quads which node in a given direction
+// is not contained in the nodes iterator.
+func NodesIn(d quad.Direction, nodes graph.Iterator) QuadRule {
+	return func(ctx context.Context, qs graph.QuadStore, q graph.Value) string {
+		if nodes.Contains(ctx, qs.QuadDirection(q, d)) {
+			return ""
+		}
+		return fmt.Sprintf("unexpected %s node: %v", d, qs.NameOf(qs.QuadDirection(q, d)))
+	}
+}
+
+// MaxCardinality returns a rule that reports quads with a given predicate if
+// the node in direction d has more than max quads with this predicate.
+//
+// Each node is checked once and the result is reused for all its quads, thus
+// the rule should not be reused after the quad store changes.
+func MaxCardinality(pred quad.Value, d quad.Direction, max int) QuadRule {
+	var (
+		mu      sync.Mutex
+		checked = make(map[interface{}]string) // violation reasons by node
+	)
+	return func(ctx context.Context, qs graph.QuadStore, q graph.Value) string {
+		p := qs.QuadDirection(q, quad.Predicate)
+		if qs.NameOf(p) != pred {
+			return ""
+		}
+		node := qs.QuadDirection(q, d)
+		key := graph.ToKey(node)
+		mu.Lock()
+		defer mu.Unlock()
+		if reason, ok := checked[key]; ok {
+			return reason
+		}
+		reason := ""
+		if countQuads(ctx, qs, d, node, p, max+1) > max {
+			reason = fmt.Sprintf("%v has more than %d values of %v", qs.NameOf(node), max, pred)
+		}
+		checked[key] = reason
+		return reason
+	}
+}
+
+// countQuads counts quads with a given predicate and a given node in direction d,
+// but stops after reaching the limit.
+func countQuads(ctx context.Context, qs graph.QuadStore, d quad.Direction, node, pred graph.Value, limit int) int {
+	var it graph.Iterator = NewAnd(qs,
+		qs.QuadIterator(d, node),
+		qs.QuadIterator(quad.Predicate, pred),
+	)
+	it, _ = it.Optimize()
+	if nit, ok := qs.OptimizeIterator(it); ok {
+		it = nit
+	}
+	defer it.Close()
+	n := 0
+	for n < limit && it.Next(ctx) {
+		n++
+	}
+	return n
+}
+
+// Validate iterator scans quads of the sub-iterator and returns only the ones
+// that violate at least one of the rules. Violation reasons are returned in a tag.
+type Validate struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	qs     graph.QuadStore
+	tag    string
+	rules  []QuadRule
+	result graph.Value
+	reason string
+	err    error
+}
+
+// NewValidate creates a new Validate iterator. Reasons of violations for each
+// quad will be saved to a given tag, if it is not empty.
+func NewValidate(qs graph.QuadStore, sub graph.Iterator, tag string, rules ...QuadRule) *Validate {
+	return &Validate{
+		uid:   NextUID(),
+		subIt: sub,
+		qs:    qs,
+		tag:   tag,
+		rules: rules,
+	}
+}
+
+func (it *Validate) UID() uint64 {
+	return it.uid
+}
+
+// Reason returns a description of all violations of the current quad.
+func (it *Validate) Reason() string {
+	return it.reason
+}
+
+// check runs all the rules on a quad and returns combined violation reasons.
+func (it *Validate) check(ctx context.Context, val graph.Value) string {
+	var reasons []string
+	for _, rule := range it.rules {
+		if r := rule(ctx, it.qs, val); r != "" {
+			reasons = append(reasons, r)
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func (it *Validate) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *Validate) Reset() {
+	it.subIt.Reset()
+	it.err = nil
+	it.result = nil
+	it.reason = ""
+}
+
+func (it *Validate) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Validate) Clone() graph.Iterator {
+	out := NewValidate(it.qs, it.subIt.Clone(), it.tag, it.rules...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Validate) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	for it.subIt.Next(ctx) {
+		val := it.subIt.Result()
+		if reason := it.check(ctx, val); reason != "" {
+			it.result, it.reason = val, reason
+			return graph.NextLogOut(it, true)
+		}
+	}
+	it.err = it.subIt.Err()
+	return graph.NextLogOut(it, false)
+}
+
+func (it *Validate) Err() error {
+	return it.err
+}
+
+func (it *Validate) Result() graph.Value {
+	return it.result
+}
+
+// NextPath returns other paths to the current quad. Quad was already validated.
+func (it *Validate) NextPath(ctx context.Context) bool {
+	if !it.subIt.NextPath(ctx) {
+		it.err = it.subIt.Err()
+		return false
+	}
+	return true
+}
+
+func (it *Validate) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Validate) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	reason := it.check(ctx, val)
+	if reason == "" {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result, it.reason = val, reason
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *Validate) Type() graph.Type {
+	return graph.Validate
+}
+
+func (it *Validate) String() string {
+	return fmt.Sprintf("Validate(%d rules)", len(it.rules))
+}
+
+func (it *Validate) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Stats assumes that each rule costs as much as a single Contains call on the quad store.
+func (it *Validate) Stats() graph.IteratorStats {
+	st := it.subIt.Stats()
+	cost := int64(len(it.rules))
+	st.NextCost += cost
+	st.ContainsCost += cost
+	st.Size, st.ExactSize = it.Size()
+	return st
+}
+
+func (it *Validate) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	if it.tag != "" && it.reason != "" {
+		dst[it.tag] = graph.PreFetched(quad.String(it.reason))
+	}
+	it.subIt.TagResults(dst)
+}
+
+// Size is an estimate, since we don't know how many quads are invalid.
+// In the worst case, all quads of the sub-iterator violate the rules.
+func (it *Validate) Size() (int64, bool) {
+	sz, _ := it.subIt.Size()
+	return sz, false
+}
@@ -0,0 +1,80 @@
+package iterator_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestValidateCardinality(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{
+		Data: []quad.Quad{
+			quad.MakeIRI("alice", "name", "Alice", ""),
+			quad.MakeIRI("bob", "name", "Bob", ""),
+			quad.MakeIRI("bob", "name", "Robert", ""),
+			quad.MakeIRI("bob", "follows", "alice", ""),
+			quad.MakeIRI("bob", "follows", "charlie", ""),
+		},
+	}
+	it := NewValidate(qs, qs.QuadsAllIterator(), "reason",
+		MaxCardinality(quad.IRI("name"), quad.Subject, 1),
+	)
+	defer it.Close()
+
+	var got []string
+	for it.Next(ctx) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		if tags["reason"] == nil {
+			t.Errorf("expected a reason for %v", qs.Quad(it.Result()))
+		}
+		if reason := qs.NameOf(tags["reason"]); reason != quad.String(it.Reason()) {
+			t.Errorf("unexpected reason tag: %v vs %q", reason, it.Reason())
+		}
+		got = append(got, qs.Quad(it.Result()).Object.String())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "<Bob>" || got[1] != "<Robert>" {
+		t.Errorf("unexpected invalid quads: %v", got)
+	}
+}
+
+func TestValidateNodesIn(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{
+		Data: []quad.Quad{
+			quad.MakeIRI("bob", "follows", "alice", ""),
+			quad.MakeIRI("bob", "follows", "charlie", ""),
+		},
+	}
+	known := NewFixed(graph.PreFetched(quad.IRI("alice")), graph.PreFetched(quad.IRI("bob")))
+	it := NewValidate(qs, qs.QuadsAllIterator(), "",
+		NodesExist(quad.Subject, quad.Object),
+		NodesIn(quad.Object, known),
+	)
+	defer it.Close()
+
+	if !it.Next(ctx) {
+		t.Fatal("expected an invalid quad")
+	}
+	if q := qs.Quad(it.Result()); q.Object != quad.IRI("charlie") {
+		t.Errorf("unexpected quad: %v", q)
+	}
+	if it.Next(ctx) {
+		t.Errorf("unexpected quad: %v", qs.Quad(it.Result()))
+	}
+	valid := qs.QuadsAllIterator()
+	valid.Next(ctx)
+	if it.Contains(ctx, valid.Result()) {
+		t.Errorf("valid quad should not be contained: %v", qs.Quad(valid.Result()))
+	}
+}
@@ -25,10 +25,16 @@ package iterator
 // from a sorted set -- some sort of value index, then go for it.
 //
 // In MQL terms, this is the [{"age>=": 21}] concept.
+//
+// Values are compared according to their datatypes (see compareValues). Values that
+// are not comparable with the operand, for example a number and a string, or strings
+// in different languages, are filtered out.
 
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -83,6 +89,22 @@ func NewComparison(sub graph.Iterator, op Operator, val quad.Value, qs graph.Qua
 	}
 }
 
+// NewRange returns an iterator of values of the sub-iterator that are in the given range,
+// with both bounds included. A nil bound means that the range is unbounded on that side;
+// if both bounds are nil, the sub-iterator is returned as is.
+//
+// The range is a chain of comparisons, thus values are compared by their datatypes,
+// the same way as in Comparison. In particular, negative numbers are ordered below zero.
+func NewRange(sub graph.Iterator, lower, upper quad.Value, qs graph.QuadStore) graph.Iterator {
+	if lower != nil {
+		sub = NewComparison(sub, CompareGTE, lower, qs)
+	}
+	if upper != nil {
+		sub = NewComparison(sub, CompareLTE, upper, qs)
+	}
+	return sub
+}
+
 func (it *Comparison) UID() uint64 {
 	return it.uid
 }
@@ -90,44 +112,19 @@ func (it *Comparison) UID() uint64 {
 func (it *Comparison) Value() quad.Value  { return it.val }
 func (it *Comparison) Operator() Operator { return it.op }
 
+// SubIterator returns the iterator of values that are compared.
+func (it *Comparison) SubIterator() graph.Iterator { return it.subIt }
+
 // Here's the non-boilerplate part of the ValueComparison iterator. Given a value
 // and our operator, determine whether or not we meet the requirement.
+//
+// Values that cannot be compared with the operand (see compareValues) never pass.
 func (it *Comparison) doComparison(val graph.Value) bool {
-	qval := it.qs.NameOf(val)
-	switch cVal := it.val.(type) {
-	case quad.Int:
-		if cVal2, ok := qval.(quad.Int); ok {
-			return RunIntOp(cVal2, it.op, cVal)
-		}
-		return false
-	case quad.Float:
-		if cVal2, ok := qval.(quad.Float); ok {
-			return RunFloatOp(cVal2, it.op, cVal)
-		}
-		return false
-	case quad.String:
-		if cVal2, ok := qval.(quad.String); ok {
-			return RunStrOp(string(cVal2), it.op, string(cVal))
-		}
-		return false
-	case quad.BNode:
-		if cVal2, ok := qval.(quad.BNode); ok {
-			return RunStrOp(string(cVal2), it.op, string(cVal))
-		}
-		return false
-	case quad.IRI:
-		if cVal2, ok := qval.(quad.IRI); ok {
-			return RunStrOp(string(cVal2), it.op, string(cVal))
-		}
-		return false
-	case quad.Time:
-		if cVal2, ok := qval.(quad.Time); ok {
-			return RunTimeOp(time.Time(cVal2), it.op, time.Time(cVal))
-		}
+	c, ok := compareValues(it.qs.NameOf(val), it.val)
+	if !ok {
 		return false
-	default:
-		return RunStrOp(quad.StringOf(qval), it.op, quad.StringOf(it.val))
 	}
+	return RunIntOp(quad.Int(c), it.op, 0)
 }
 
 func (it *Comparison) Close() error {
@@ -278,15 +275,249 @@ func (it *Comparison) String() string {
 // There's nothing to optimize, locally, for a value-comparison iterator.
 // Replace the underlying iterator if need be.
 // potentially replace it.
+//
+// If the subiterator is empty, or nested comparisons have contradictory bounds
+// (ex: "x > 5" and "x < 3"), the comparison is replaced with a Null iterator.
 func (it *Comparison) Optimize() (graph.Iterator, bool) {
 	newSub, changed := it.subIt.Optimize()
 	if changed {
 		it.subIt.Close()
 		it.subIt = newSub
 	}
+	if it.subIt.Type() == graph.Null || hasDisjointComparisons(comparisonChain(it)) {
+		it.Close()
+		return NewNull(), true
+	}
+	// quad store may evaluate the comparison as a part of its native query
+	if nit, ok := it.qs.OptimizeIterator(it); ok {
+		it.Close()
+		return nit, true
+	}
 	return it, false
 }
 
+// comparisonChain returns a list of nested comparisons, starting from a given iterator.
+func comparisonChain(it graph.Iterator) []*Comparison {
+	var out []*Comparison
+	for {
+		c, ok := it.(*Comparison)
+		if !ok {
+			return out
+		}
+		out = append(out, c)
+		it = c.subIt
+	}
+}
+
+// hasDisjointComparisons checks if no value can pass all the comparisons in the list.
+func hasDisjointComparisons(list []*Comparison) bool {
+	for i, a := range list {
+		for _, b := range list[i+1:] {
+			if disjointComparisons(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLower checks if the operator sets a lower bound of the range.
+func (op Operator) isLower() bool { return op == CompareGT || op == CompareGTE }
+
+// disjointComparisons checks if one comparison sets a lower bound, the other sets
+// an upper bound and there are no values between them. Only comparable bounds
+// are considered.
+func disjointComparisons(a, b *Comparison) bool {
+	if a.op.isLower() == b.op.isLower() {
+		return false
+	}
+	lo, hi := a, b
+	if !lo.op.isLower() {
+		lo, hi = b, a
+	}
+	c, ok := compareValues(lo.val, hi.val)
+	if !ok {
+		return false
+	}
+	return c > 0 || (c == 0 && (lo.op == CompareGT || hi.op == CompareLT))
+}
+
+const nsXSD = "http://www.w3.org/2001/XMLSchema#"
+
+// xsdConversions parses literals of XML Schema datatypes that are not converted to native
+// values automatically (see quad.RegisterStringConversion), but still have an order.
+var xsdConversions = map[quad.IRI]func(string) (quad.Value, error){
+	nsXSD + "decimal":            parseFloat,
+	nsXSD + "float":              parseFloat,
+	nsXSD + "double":             parseFloat,
+	nsXSD + "integer":            parseInt,
+	nsXSD + "long":               parseInt,
+	nsXSD + "int":                parseInt,
+	nsXSD + "short":              parseInt,
+	nsXSD + "byte":               parseInt,
+	nsXSD + "nonNegativeInteger": parseInt,
+	nsXSD + "nonPositiveInteger": parseInt,
+	nsXSD + "positiveInteger":    parseInt,
+	nsXSD + "negativeInteger":    parseInt,
+	nsXSD + "unsignedLong":       parseInt,
+	nsXSD + "unsignedInt":        parseInt,
+	nsXSD + "unsignedShort":      parseInt,
+	nsXSD + "unsignedByte":       parseInt,
+	nsXSD + "dateTime":           parseTime("2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999"),
+	nsXSD + "date":               parseTime("2006-01-02Z07:00", "2006-01-02"),
+}
+
+func parseFloat(s string) (quad.Value, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return quad.Float(v), nil
+}
+
+func parseInt(s string) (quad.Value, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		// out of int64 range
+		return parseFloat(s)
+	}
+	return quad.Int(v), nil
+}
+
+// parseTime returns a function that parses time in one of the layouts.
+// Time without a zone is assumed to be in UTC.
+func parseTime(layouts ...string) func(string) (quad.Value, error) {
+	return func(s string) (quad.Value, error) {
+		var err error
+		for _, l := range layouts {
+			var t time.Time
+			if t, err = time.Parse(l, s); err == nil {
+				return quad.Time(t), nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// comparableValue converts typed literals of known numeric and temporal datatypes
+// to native values. Other values, as well as literals that cannot be parsed
+// according to their datatype, are returned unchanged.
+func comparableValue(v quad.Value) quad.Value {
+	ts, ok := v.(quad.TypedString)
+	if !ok {
+		return v
+	}
+	if nv, err := ts.ParseValue(); err == nil {
+		if _, ok = nv.(quad.TypedString); !ok {
+			return nv
+		}
+	}
+	if conv := xsdConversions[ts.Type.Full()]; conv != nil {
+		if nv, err := conv(string(ts.Value)); err == nil {
+			return nv
+		}
+	}
+	return ts
+}
+
+// compareValues compares two values the same way as the Comparison does.
+//
+// Numbers (including typed literals of numeric datatypes) are compared numerically,
+// time values (including xsd:dateTime and xsd:date literals) are compared temporally,
+// language-tagged strings are only compared with strings of the same language, and
+// other typed literals are only compared with literals of the same datatype. Values
+// of the same kind are compared lexically.
+//
+// It returns false if values cannot be compared.
+func compareValues(a, b quad.Value) (int, bool) {
+	cmpStr := func(a, b string) (int, bool) {
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return +1, true
+		}
+		return 0, true
+	}
+	cmpFloat := func(a, b float64) (int, bool) {
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return +1, true
+		case a == b:
+			return 0, true
+		}
+		// NaN
+		return 0, false
+	}
+	a, b = comparableValue(a), comparableValue(b)
+	switch a := a.(type) {
+	case quad.Int:
+		switch b := b.(type) {
+		case quad.Int:
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return +1, true
+			}
+			return 0, true
+		case quad.Float:
+			return cmpFloat(float64(a), float64(b))
+		}
+	case quad.Float:
+		switch b := b.(type) {
+		case quad.Int:
+			return cmpFloat(float64(a), float64(b))
+		case quad.Float:
+			return cmpFloat(float64(a), float64(b))
+		}
+	case quad.Bool:
+		if b, ok := b.(quad.Bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case bool(b):
+				return -1, true
+			}
+			return +1, true
+		}
+	case quad.String:
+		if b, ok := b.(quad.String); ok {
+			return cmpStr(string(a), string(b))
+		}
+	case quad.LangString:
+		if b, ok := b.(quad.LangString); ok && strings.EqualFold(a.Lang, b.Lang) {
+			return cmpStr(string(a.Value), string(b.Value))
+		}
+	case quad.TypedString:
+		if b, ok := b.(quad.TypedString); ok && a.Type.Full() == b.Type.Full() {
+			return cmpStr(string(a.Value), string(b.Value))
+		}
+	case quad.BNode:
+		if b, ok := b.(quad.BNode); ok {
+			return cmpStr(string(a), string(b))
+		}
+	case quad.IRI:
+		if b, ok := b.(quad.IRI); ok {
+			return cmpStr(string(a), string(b))
+		}
+	case quad.Time:
+		if b, ok := b.(quad.Time); ok {
+			ta, tb := time.Time(a), time.Time(b)
+			switch {
+			case ta.Before(tb):
+				return -1, true
+			case ta.After(tb):
+				return +1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
 // We're only as expensive as our subiterator.
 // Again, optimized value comparison iterators should do better.
 func (it *Comparison) Stats() graph.IteratorStats {
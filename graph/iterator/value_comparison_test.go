@@ -19,6 +19,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphmock"
@@ -258,7 +259,7 @@ var comparisonIteratorTests = []struct {
 func TestComparisonIteratorErr(t *testing.T) {
 	ctx := context.TODO()
 	wantErr := errors.New("unique")
-	errIt := newTestIterator(false, wantErr)
+	errIt := graphmock.NewIterator(nil, graphmock.WithErr(wantErr))
 
 	for _, test := range comparisonIteratorTests {
 		vc := NewComparison(errIt, CompareLT, test.val, test.qs)
@@ -271,3 +272,121 @@ func TestComparisonIteratorErr(t *testing.T) {
 		}
 	}
 }
+
+func TestComparisonDatatypes(t *testing.T) {
+	ctx := context.TODO()
+	xsd := func(s, typ string) quad.TypedString {
+		return quad.TypedString{Value: quad.String(s), Type: quad.IRI("http://www.w3.org/2001/XMLSchema#" + typ)}
+	}
+	lang := func(s, l string) quad.LangString {
+		return quad.LangString{Value: quad.String(s), Lang: l}
+	}
+	tm := func(s string) quad.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return quad.Time(v)
+	}
+	data := []quad.Value{
+		quad.Int(5), quad.Float(2.5), xsd("3", "short"), xsd("10.5", "decimal"), xsd("abc", "integer"),
+		tm("2017-01-01T00:00:00Z"), xsd("2017-06-01T12:00:00", "dateTime"), xsd("2016-12-31", "date"),
+		quad.String("b"), lang("b", "en"), lang("a", "en"), lang("a", "de"),
+		xsd("b", "token"), xsd("a", "token"), quad.IRI("b"),
+	}
+	qs := &graphmock.Store{}
+	for _, c := range []struct {
+		name   string
+		op     Operator
+		val    quad.Value
+		expect []quad.Value
+	}{
+		{"numeric", CompareGT, quad.Int(3),
+			[]quad.Value{quad.Int(5), xsd("10.5", "decimal")}},
+		{"numeric typed operand", CompareLTE, xsd("3.0", "double"),
+			[]quad.Value{quad.Float(2.5), xsd("3", "short")}},
+		{"temporal", CompareGTE, tm("2017-01-01T00:00:00Z"),
+			[]quad.Value{tm("2017-01-01T00:00:00Z"), xsd("2017-06-01T12:00:00", "dateTime")}},
+		{"temporal typed operand", CompareLT, xsd("2017-01-01", "date"),
+			[]quad.Value{xsd("2016-12-31", "date")}},
+		{"language", CompareGT, lang("a", "EN"),
+			[]quad.Value{lang("b", "en")}},
+		{"plain string", CompareGTE, quad.String("a"),
+			[]quad.Value{quad.String("b")}},
+		{"same datatype", CompareLT, xsd("b", "token"),
+			[]quad.Value{xsd("a", "token")}},
+		{"invalid literal", CompareGTE, xsd("abc", "integer"),
+			[]quad.Value{xsd("abc", "integer")}},
+		{"unknown datatype", CompareGT, xsd("a", "unknown"), nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			f := NewFixed()
+			for _, v := range data {
+				f.Add(graph.PreFetched(v))
+			}
+			it := NewComparison(f, c.op, c.val, qs)
+			var got []quad.Value
+			for it.Next(ctx) {
+				got = append(got, qs.NameOf(it.Result()))
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("unexpected results:\n%v\nvs\n%v", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	ctx := context.TODO()
+	data := []quad.Value{
+		quad.Int(-10), quad.Float(-2.5), quad.Int(-1), quad.Int(0),
+		quad.Int(3), quad.Float(7.5), quad.Int(12), quad.String("5"),
+	}
+	qs := &graphmock.Store{}
+	for _, c := range []struct {
+		name         string
+		lower, upper quad.Value
+		expect       []quad.Value
+	}{
+		{"lower only", quad.Int(0), nil,
+			[]quad.Value{quad.Int(0), quad.Int(3), quad.Float(7.5), quad.Int(12)}},
+		{"negative lower only", quad.Int(-2), nil,
+			[]quad.Value{quad.Int(-1), quad.Int(0), quad.Int(3), quad.Float(7.5), quad.Int(12)}},
+		{"upper only", nil, quad.Int(3),
+			[]quad.Value{quad.Int(-10), quad.Float(-2.5), quad.Int(-1), quad.Int(0), quad.Int(3)}},
+		{"negative upper only", nil, quad.Float(-1.5),
+			[]quad.Value{quad.Int(-10), quad.Float(-2.5)}},
+		{"mixed sign", quad.Float(-2.5), quad.Int(3),
+			[]quad.Value{quad.Float(-2.5), quad.Int(-1), quad.Int(0), quad.Int(3)}},
+		{"negative", quad.Int(-10), quad.Int(-1),
+			[]quad.Value{quad.Int(-10), quad.Float(-2.5), quad.Int(-1)}},
+		{"unbounded", nil, nil, data},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			f := NewFixed()
+			for _, v := range data {
+				f.Add(graph.PreFetched(v))
+			}
+			it := NewRange(f, c.lower, c.upper, qs)
+			var got []quad.Value
+			for it.Next(ctx) {
+				got = append(got, qs.NameOf(it.Result()))
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("unexpected results:\n%v\nvs\n%v", got, c.expect)
+			}
+		})
+	}
+
+	// contradictory bounds are detected by the optimizer
+	it := NewRange(NewFixed(graph.PreFetched(quad.Int(1))), quad.Int(2), quad.Int(-2), qs)
+	if nit, _ := it.Optimize(); nit.Type() != graph.Null {
+		t.Errorf("expected an empty range, got: %v", nit)
+	}
+}
@@ -0,0 +1,273 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// SeekKey advances a sorted iterator to the first result with a key greater than
+// or equal to k, and returns it. If the current result already satisfies the
+// condition, the iterator is not advanced.
+func SeekKey(ctx context.Context, it graph.Seekable, k uint64) (graph.Value, bool) {
+	if it.Result() == nil && !it.Next(ctx) {
+		return nil, false
+	}
+	if it.SortKey() < k && !it.NextGE(ctx, k) {
+		return nil, false
+	}
+	return it.Result(), true
+}
+
+// sortOrderOf returns a common sort order of iterators, or an empty string if
+// they cannot be intersected by ZigZag.
+func sortOrderOf(its []graph.Iterator) string {
+	order := ""
+	for i, sub := range its {
+		s, ok := sub.(graph.Seekable)
+		if !ok {
+			return ""
+		}
+		if i == 0 {
+			order = s.SortOrder()
+		} else if s.SortOrder() != order {
+			return ""
+		}
+	}
+	return order
+}
+
+var (
+	_ graph.Iterator = &ZigZag{}
+	_ graph.Seekable = &ZigZag{}
+)
+
+// ZigZag is an intersection of sorted iterators.
+//
+// Instead of checking each result of one iterator against the others, as And
+// does, it seeks all the iterators forward to the largest result among them until
+// all of them agree (leapfrog intersection). This is much faster than And when the sub-iterators are
+// large and the intersection is small.
+type ZigZag struct {
+	uid     uint64
+	tags    graph.Tagger
+	subIts  []graph.Seekable
+	key     uint64
+	result  graph.Value
+	started bool
+	done    bool
+	err     error
+}
+
+// NewZigZag creates an intersection of sorted iterators. All iterators must have
+// the same sort order.
+func NewZigZag(its ...graph.Seekable) *ZigZag {
+	return &ZigZag{
+		uid:    NextUID(),
+		subIts: its,
+	}
+}
+
+func (it *ZigZag) UID() uint64 {
+	return it.uid
+}
+
+func (it *ZigZag) Reset() {
+	it.key, it.result = 0, nil
+	it.started = false
+	it.done = false
+	it.err = nil
+	for _, sub := range it.subIts {
+		sub.Reset()
+	}
+}
+
+func (it *ZigZag) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *ZigZag) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	for _, sub := range it.subIts {
+		sub.TagResults(dst)
+	}
+}
+
+func (it *ZigZag) Clone() graph.Iterator {
+	its := make([]graph.Seekable, 0, len(it.subIts))
+	for _, sub := range it.subIts {
+		its = append(its, sub.Clone().(graph.Seekable))
+	}
+	out := NewZigZag(its...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *ZigZag) SubIterators() []graph.Iterator {
+	out := make([]graph.Iterator, 0, len(it.subIts))
+	for _, sub := range it.subIts {
+		out = append(out, sub)
+	}
+	return out
+}
+
+// fail stops the iteration and records an error of a given sub-iterator.
+func (it *ZigZag) fail(sub graph.Iterator) bool {
+	it.done = true
+	it.result = nil
+	it.err = sub.Err()
+	return false
+}
+
+// align seeks all iterators forward until they point to the same result.
+func (it *ZigZag) align(ctx context.Context) bool {
+	key := it.subIts[0].SortKey()
+	// the iterator that returned the target agrees with it
+	for i, agreed := 1, 1; agreed < len(it.subIts); i++ {
+		sub := it.subIts[i%len(it.subIts)]
+		if sub.SortKey() < key && !sub.NextGE(ctx, key) {
+			return it.fail(sub)
+		}
+		if k := sub.SortKey(); k == key {
+			agreed++
+		} else {
+			key, agreed = k, 1
+		}
+	}
+	it.key, it.result = key, it.subIts[0].Result()
+	return true
+}
+
+func (it *ZigZag) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if it.done || len(it.subIts) == 0 {
+		return graph.NextLogOut(it, false)
+	}
+	if !it.started {
+		// first call - position all iterators
+		it.started = true
+		for _, sub := range it.subIts {
+			if !sub.Next(ctx) {
+				return graph.NextLogOut(it, it.fail(sub))
+			}
+		}
+	} else if sub := it.subIts[0]; !sub.Next(ctx) {
+		return graph.NextLogOut(it, it.fail(sub))
+	}
+	return graph.NextLogOut(it, it.align(ctx))
+}
+
+// SortOrder implements graph.Seekable. Results are returned in the order of sub-iterators.
+func (it *ZigZag) SortOrder() string {
+	return sortOrderOf(it.SubIterators())
+}
+
+// SortKey implements graph.Seekable.
+func (it *ZigZag) SortKey() uint64 {
+	return it.key
+}
+
+// NextGE implements graph.Seekable.
+func (it *ZigZag) NextGE(ctx context.Context, k uint64) bool {
+	graph.NextLogIn(it)
+	if it.done || len(it.subIts) == 0 {
+		return graph.NextLogOut(it, false)
+	}
+	if !it.started {
+		if !it.Next(ctx) {
+			return graph.NextLogOut(it, false)
+		} else if it.key >= k {
+			return graph.NextLogOut(it, true)
+		}
+	}
+	if sub := it.subIts[0]; !sub.NextGE(ctx, k) {
+		return graph.NextLogOut(it, it.fail(sub))
+	}
+	return graph.NextLogOut(it, it.align(ctx))
+}
+
+func (it *ZigZag) NextPath(ctx context.Context) bool {
+	for _, sub := range it.subIts {
+		if sub.NextPath(ctx) {
+			return true
+		}
+		if it.err = sub.Err(); it.err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// Contains checks the value against all sub-iterators.
+func (it *ZigZag) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	for _, sub := range it.subIts {
+		if !sub.Contains(ctx, val) {
+			it.err = sub.Err()
+			return graph.ContainsLogOut(it, val, false)
+		}
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *ZigZag) Err() error {
+	return it.err
+}
+
+func (it *ZigZag) Result() graph.Value {
+	return it.result
+}
+
+func (it *ZigZag) Close() error {
+	var err error
+	for _, sub := range it.subIts {
+		if err2 := sub.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (it *ZigZag) Type() graph.Type { return graph.ZigZag }
+
+func (it *ZigZag) String() string {
+	return fmt.Sprintf("ZigZag(%d)", len(it.subIts))
+}
+
+func (it *ZigZag) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+// Size is the size of the smallest sub-iterator.
+func (it *ZigZag) Size() (int64, bool) {
+	if len(it.subIts) == 0 {
+		return 0, true
+	} else if len(it.subIts) == 1 {
+		return it.subIts[0].Size()
+	}
+	var size int64 = -1
+	for _, sub := range it.subIts {
+		n, exact := sub.Size()
+		if exact && n == 0 {
+			return 0, true
+		}
+		if size < 0 || n < size {
+			size = n
+		}
+	}
+	return size, false
+}
+
+// Stats assumes that each result requires a skip on every sub-iterator.
+func (it *ZigZag) Stats() graph.IteratorStats {
+	var st graph.IteratorStats
+	for _, sub := range it.subIts {
+		s := sub.Stats()
+		st.NextCost += s.NextCost + s.ContainsCost
+		st.ContainsCost += s.ContainsCost
+	}
+	st.Size, st.ExactSize = it.Size()
+	return st
+}
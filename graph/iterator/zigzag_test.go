@@ -0,0 +1,190 @@
+package iterator_test
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	. "github.com/cayleygraph/cayley/graph/iterator"
+)
+
+// A testing iterator that returns sorted values and supports seeking.
+type sortedIterator struct {
+	*graphmock.Iterator
+	vals []int64
+	i    int
+	Ops  *int // calls to Next and NextGE, shared by clones
+}
+
+func newSortedIterator(vals ...int64) *sortedIterator {
+	gv := make([]graph.Value, 0, len(vals))
+	for _, v := range vals {
+		gv = append(gv, Int64Node(v))
+	}
+	return &sortedIterator{Iterator: graphmock.NewIterator(gv), vals: vals, i: -1, Ops: new(int)}
+}
+
+func (it *sortedIterator) Clone() graph.Iterator {
+	out := newSortedIterator(it.vals...)
+	out.Ops = it.Ops
+	return out
+}
+
+func (it *sortedIterator) Reset() { it.i = -1 }
+
+func (it *sortedIterator) Next(ctx context.Context) bool {
+	*it.Ops++
+	it.i++
+	return it.i < len(it.vals)
+}
+
+func (it *sortedIterator) Result() graph.Value {
+	if it.i < 0 || it.i >= len(it.vals) {
+		return nil
+	}
+	return Int64Node(it.vals[it.i])
+}
+
+func (it *sortedIterator) SortOrder() string { return "test" }
+func (it *sortedIterator) SortKey() uint64   { return uint64(it.vals[it.i]) }
+
+func (it *sortedIterator) NextGE(ctx context.Context, k uint64) bool {
+	*it.Ops++
+	if it.i < 0 {
+		it.i = 0
+	}
+	vals := it.vals[it.i:]
+	it.i += sort.Search(len(vals), func(i int) bool { return vals[i] >= int64(k) })
+	return it.i < len(it.vals)
+}
+
+func collectInt64(t testing.TB, it graph.Iterator) []int64 {
+	var out []int64
+	for it.Next(context.TODO()) {
+		out = append(out, int64(it.Result().(Int64Node)))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestZigZag(t *testing.T) {
+	a := newSortedIterator(1, 3, 4, 7, 9, 10, 15)
+	b := newSortedIterator(2, 3, 7, 8, 10, 11)
+	c := newSortedIterator(3, 5, 6, 7, 10, 20)
+
+	and := NewAnd(nil, a, b, c)
+	and.Tagger().Add("id")
+	it, changed := and.Optimize()
+	if !changed || it.Type() != graph.ZigZag {
+		t.Fatalf("expected And of sorted iterators to be replaced, got %v", it)
+	}
+	if got, exp := collectInt64(t, it), []int64{3, 7, 10}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected results: %v vs %v", got, exp)
+	}
+	it.Reset()
+	it.Next(context.TODO())
+	tags := make(map[string]graph.Value)
+	it.TagResults(tags)
+	if tags["id"] != Int64Node(3) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	if !it.Contains(context.TODO(), Int64Node(10)) || it.Contains(context.TODO(), Int64Node(11)) {
+		t.Error("unexpected Contains result")
+	}
+
+	// intersection is sorted as well, and can be intersected further
+	zz := it.Clone().(*ZigZag)
+	if zz.SortOrder() != "test" {
+		t.Errorf("unexpected sort order: %q", zz.SortOrder())
+	}
+	if !zz.NextGE(context.TODO(), 4) || zz.SortKey() != 7 {
+		t.Fatalf("unexpected result after seeking: %v", zz.Result())
+	}
+	if v, ok := SeekKey(context.TODO(), zz, 5); !ok || v != Int64Node(7) {
+		t.Fatalf("seeking backward should not move the iterator: %v", v)
+	}
+	if got := collectInt64(t, zz); !reflect.DeepEqual(got, []int64{10}) {
+		t.Errorf("unexpected results after seeking: %v", got)
+	}
+}
+
+func TestZigZagRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	gen := func(n int, max int64) []int64 {
+		set := make(map[int64]struct{})
+		for i := 0; i < n; i++ {
+			set[rnd.Int63n(max)] = struct{}{}
+		}
+		out := make([]int64, 0, len(set))
+		for v := range set {
+			out = append(out, v)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+		return out
+	}
+	for i := 0; i < 20; i++ {
+		a, b := gen(1000, 5000), gen(100, 5000)
+		expect := collectInt64(t, NewAnd(nil, graphmock.NewIterator(toValues(a)), graphmock.NewIterator(toValues(b))))
+		sort.Slice(expect, func(i, j int) bool { return expect[i] < expect[j] })
+
+		got := collectInt64(t, NewZigZag(newSortedIterator(a...), newSortedIterator(b...)))
+		if len(got) != len(expect) || (len(got) != 0 && !reflect.DeepEqual(got, expect)) {
+			t.Fatalf("unexpected results: %v vs %v", got, expect)
+		}
+	}
+}
+
+func toValues(vals []int64) []graph.Value {
+	out := make([]graph.Value, 0, len(vals))
+	for _, v := range vals {
+		out = append(out, Int64Node(v))
+	}
+	return out
+}
+
+// skewedLists returns two large sorted lists with a small overlap.
+func skewedLists(n int64) (x, y []int64) {
+	for i := int64(0); i < n; i++ {
+		x = append(x, i)
+		y = append(y, n-10+i)
+	}
+	return x, y
+}
+
+func TestZigZagSkips(t *testing.T) {
+	x, y := skewedLists(10000)
+
+	a, c := graphmock.NewIterator(toValues(x)), graphmock.NewIterator(toValues(y))
+	if got := collectInt64(t, NewAnd(nil, a, c)); len(got) != 10 {
+		t.Fatalf("unexpected results: %v", got)
+	}
+	andOps := a.Calls.Next + a.Calls.Contains + c.Calls.Next + c.Calls.Contains
+
+	sa, sc := newSortedIterator(x...), newSortedIterator(y...)
+	if got := collectInt64(t, NewZigZag(sa, sc)); len(got) != 10 {
+		t.Fatalf("unexpected results: %v", got)
+	}
+	if ops := *sa.Ops + *sc.Ops; ops*10 > andOps {
+		t.Errorf("expected an order of magnitude less operations: %d vs %d", ops, andOps)
+	}
+}
+
+func BenchmarkZigZag(b *testing.B) {
+	x, y := skewedLists(10000)
+	b.Run("and", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			collectInt64(b, NewAnd(nil, graphmock.NewIterator(toValues(x)), graphmock.NewIterator(toValues(y))))
+		}
+	})
+	b.Run("zigzag", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			collectInt64(b, NewZigZag(newSortedIterator(x...), newSortedIterator(y...)))
+		}
+	})
+}
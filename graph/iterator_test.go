@@ -0,0 +1,233 @@
+package graph_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestCheckTags(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{Data: []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+	}}
+	alice := graph.PreFetched(quad.IRI("alice"))
+	fixed := iterator.NewFixed(alice)
+	fixed.Tagger().Add("x")
+	hasa := iterator.NewHasA(qs, iterator.NewLinksTo(qs, fixed, quad.Subject), quad.Object)
+	hasa.Tagger().Add("x")
+
+	// the tag on the start node silently overwrites the tag on the result
+	if !hasa.Next(ctx) {
+		t.Fatal("expected a result")
+	}
+	tags := make(map[string]graph.Value)
+	hasa.TagResults(tags)
+	if got := qs.NameOf(tags["x"]); got != quad.IRI("alice") {
+		t.Fatalf("unexpected tag value: %v", got)
+	}
+
+	err := graph.CheckTags(hasa)
+	if e, ok := err.(*graph.ErrTagCollision); !ok {
+		t.Fatalf("expected tag collision, got: %v", err)
+	} else if !reflect.DeepEqual(e.Tags, []string{"x"}) {
+		t.Fatalf("unexpected tags: %v", e.Tags)
+	}
+
+	// different branches of Or never contribute to the same result
+	a := iterator.NewFixed(alice)
+	a.Tagger().Add("x")
+	b := iterator.NewFixed(alice)
+	b.Tagger().Add("x")
+	if err := graph.CheckTags(iterator.NewOr(a, b)); err != nil {
+		t.Fatal(err)
+	}
+
+	// wrappers share the tagger with the iterator they wrap
+	if err := graph.CheckTags(iterator.NewLimit(a, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// inexactIterator reports an estimated size, as most composite iterators do.
+type inexactIterator struct {
+	graph.Iterator
+}
+
+func (it inexactIterator) Size() (int64, bool) {
+	sz, _ := it.Iterator.Size()
+	return sz, false
+}
+
+func TestIterateTruncated(t *testing.T) {
+	ctx := context.TODO()
+	newFixed := func() graph.Iterator {
+		return iterator.NewFixed(iterator.Int64Node(1), iterator.Int64Node(2), iterator.Int64Node(3))
+	}
+	newInexact := func() graph.Iterator {
+		return inexactIterator{newFixed()}
+	}
+	for _, c := range []struct {
+		name      string
+		it        func() graph.Iterator
+		limit     int
+		truncated bool
+	}{
+		{name: "no limit", it: newFixed, limit: -1},
+		{name: "exact limit", it: newFixed, limit: 3},
+		{name: "chain limit", it: newFixed, limit: 2, truncated: true},
+		{name: "exact limit inexact size", it: newInexact, limit: 3},
+		{name: "chain limit inexact size", it: newInexact, limit: 2, truncated: true},
+		{
+			name: "limit iterator", limit: -1, truncated: true,
+			it: func() graph.Iterator { return iterator.NewLimit(newFixed(), 1) },
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ch := graph.Iterate(ctx, c.it()).Limit(c.limit)
+			if _, err := ch.All(); err != nil {
+				t.Fatal(err)
+			}
+			if ch.Truncated() != c.truncated {
+				t.Errorf("unexpected truncated flag: %v", ch.Truncated())
+			}
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	ctx := context.TODO()
+	qs := memstore.New(quad.MakeIRI("alice", "follows", "bob", ""))
+	alice := qs.ValueOf(quad.IRI("alice"))
+	andChain := func(depth int) graph.Iterator {
+		var it graph.Iterator = iterator.NewFixed(alice)
+		for i := 1; i < depth; i++ {
+			it = iterator.NewAnd(qs, it)
+		}
+		return it
+	}
+
+	vals, err := graph.Iterate(ctx, andChain(graph.MaxDepth)).All()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(vals) != 1 {
+		t.Errorf("unexpected results: %v", vals)
+	}
+	d := graph.DescribeIteratorFor(qs, andChain(graph.MaxDepth+1))
+	if _, err = graph.BuildFromDescription(qs, d); err == nil {
+		t.Error("expected an error for a deep description")
+	} else if _, ok := err.(*graph.ErrTooDeep); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = graph.Iterate(ctx, andChain(100*graph.MaxDepth)).All()
+	if _, ok := err.(*graph.ErrTooDeep); !ok {
+		t.Errorf("expected an error for a deep tree, got: %v", err)
+	}
+	if plan := graph.Iterate(ctx, andChain(100*graph.MaxDepth)).Explain(); len(plan.Iterators) != 0 {
+		t.Error("expected the plan to describe only the root")
+	}
+}
+
+func TestUnmarshalPlan(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "charlie", ""),
+		quad.MakeIRI("bob", "follows", "charlie", ""),
+	)
+	fixed := iterator.NewFixed(qs.ValueOf(quad.IRI("alice")))
+	fixed.Tagger().Add("start")
+	it := iterator.NewHasA(qs, iterator.NewAnd(qs,
+		iterator.NewLinksTo(qs, fixed, quad.Subject),
+		iterator.NewLinksTo(qs, iterator.NewFixed(qs.ValueOf(quad.IRI("follows"))), quad.Predicate),
+	), quad.Object)
+
+	data, err := graph.MarshalPlan(qs, it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it2, err := graph.UnmarshalPlan(data, qs)
+	if err != nil {
+		t.Fatalf("cannot rebuild plan: %v\n%s", err, data)
+	}
+	defer it2.Close()
+	var got []quad.Value
+	for it2.Next(context.TODO()) {
+		tags := make(map[string]graph.Value)
+		it2.TagResults(tags)
+		if v := qs.NameOf(tags["start"]); v != quad.IRI("alice") {
+			t.Errorf("unexpected tag value: %v", v)
+		}
+		got = append(got, qs.NameOf(it2.Result()))
+	}
+	if exp := []quad.Value{quad.IRI("bob"), quad.IRI("charlie")}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected results: %v vs %v\n%s", got, exp, data)
+	}
+
+	for _, data := range []string{
+		`{"Type":"no_such_iterator"}`,
+		`{"Type":"hasa","Iterators":[{"Type":"no_such_iterator"}]}`,
+		`{}`,
+	} {
+		_, err = graph.UnmarshalPlan([]byte(data), qs)
+		if _, ok := err.(*graph.ErrUnknownIterator); !ok {
+			t.Errorf("expected unknown iterator error for %s, got: %v", data, err)
+		}
+	}
+	if _, err = graph.UnmarshalPlan([]byte(`[`), qs); err == nil {
+		t.Error("expected an error for invalid plan")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Store{Data: []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+	}}
+	node := func(s string) graph.Value { return graph.PreFetched(quad.IRI(s)) }
+
+	first := iterator.NewFixed(node("alice"), node("bob"))
+	second := iterator.NewFixed(node("bob"), node("carol"))
+	links := iterator.NewLinksTo(qs, iterator.NewFixed(node("alice")), quad.Subject)
+	hasa := iterator.NewHasA(qs, links, quad.Object)
+	and := iterator.NewAnd(qs, first, second, hasa)
+
+	steps := graph.Trace(ctx, and, node("bob"))
+	if len(steps) != 6 {
+		t.Fatalf("unexpected trace: %v", steps)
+	}
+	for _, st := range steps {
+		switch st.UID {
+		case links.UID(), links.SubIterators()[0].UID():
+			if !st.Skipped || st.Contains || st.Depth < 2 {
+				t.Errorf("links should not be checked: %+v", st)
+			}
+		default:
+			if st.Skipped || !st.Contains {
+				t.Errorf("unexpected step: %+v", st)
+			}
+		}
+	}
+	if st := graph.RejectedBy(steps); st != nil {
+		t.Errorf("value should be accepted, got: %+v", st)
+	}
+
+	steps = graph.Trace(ctx, and, node("alice"))
+	if st := graph.RejectedBy(steps); st == nil || st.UID != second.UID() || st.Type != graph.Fixed {
+		t.Errorf("unexpected rejecting iterator: %+v", st)
+	}
+
+	excluded := iterator.NewFixed(node("alice"))
+	not := iterator.NewNot(excluded, iterator.NewFixed(node("alice"), node("bob")))
+	steps = graph.Trace(ctx, not, node("alice"))
+	if st := graph.RejectedBy(steps); st == nil || st.UID != not.UID() {
+		t.Errorf("unexpected rejecting iterator: %+v", st)
+	}
+}
@@ -34,9 +34,15 @@ type AllIterator struct {
 	err     error
 	uid     uint64
 	cons    *constraint
+	io      graph.IOStats
+	limit   int64 // see SetLimitHint
+	batch   int
 }
 
-var _ graph.Iterator = &AllIterator{}
+var (
+	_ graph.Iterator    = &AllIterator{}
+	_ graph.LimitHinter = &AllIterator{}
+)
 
 type constraint struct {
 	dir quad.Direction
@@ -62,6 +68,16 @@ func (it *AllIterator) UID() uint64 {
 
 func (it *AllIterator) Reset() {
 	it.id = 0
+	it.buf = nil
+	it.prim = nil
+	it.batch = 0
+}
+
+// SetLimitHint implements graph.LimitHinter. The first batch of primitives read from
+// the log is reduced to the limit.
+func (it *AllIterator) SetLimitHint(n int64) {
+	it.limit = n
+	it.batch = 0
 }
 
 func (it *AllIterator) Tagger() *graph.Tagger {
@@ -82,6 +98,13 @@ func (it *AllIterator) Close() error {
 	return nil
 }
 
+var _ graph.IOStater = &AllIterator{}
+
+// IOStats implements graph.IOStater. It counts primitives read from the log.
+func (it *AllIterator) IOStats() graph.IOStats {
+	return it.io
+}
+
 func (it *AllIterator) Err() error {
 	return it.err
 }
@@ -106,7 +129,32 @@ func (it *AllIterator) SubIterators() []graph.Iterator {
 
 const nextBatch = 100
 
+// batchSize returns the number of primitives to read in the next batch, given the size of
+// the previous batch (zero for the first one) and a limit hint. Batches start from the
+// limit and grow up to nextBatch, in case some of the primitives are filtered out.
+func batchSize(prev int, limit int64) int {
+	if prev == 0 {
+		if limit > 0 && limit < nextBatch {
+			return int(limit)
+		}
+		return nextBatch
+	} else if prev *= 2; prev > nextBatch {
+		return nextBatch
+	}
+	return prev
+}
+
 func (it *AllIterator) Next(ctx context.Context) bool {
+	if !it.next(ctx) {
+		// no current result
+		it.id = uint64(it.horizon) + 1
+		it.prim = nil
+		return false
+	}
+	return true
+}
+
+func (it *AllIterator) next(ctx context.Context) bool {
 	if it.err != nil {
 		return false
 	}
@@ -115,8 +163,9 @@ func (it *AllIterator) Next(ctx context.Context) bool {
 			if it.id+1 > uint64(it.horizon) {
 				return false
 			}
-			ids := make([]uint64, 0, nextBatch)
-			for i := 0; i < nextBatch; i++ {
+			it.batch = batchSize(it.batch, it.limit)
+			ids := make([]uint64, 0, it.batch)
+			for i := 0; i < it.batch; i++ {
 				it.id++
 				if it.id > uint64(it.horizon) {
 					break
@@ -126,7 +175,7 @@ func (it *AllIterator) Next(ctx context.Context) bool {
 			if len(ids) == 0 {
 				return false
 			}
-			it.buf, it.err = it.qs.getPrimitives(ctx, ids)
+			it.buf, it.err = it.qs.readPrimitives(ctx, ids, &it.io)
 			if it.err != nil || len(it.buf) == 0 {
 				return false
 			}
@@ -136,7 +185,10 @@ func (it *AllIterator) Next(ctx context.Context) bool {
 		for ; len(it.buf) > 0; it.buf = it.buf[1:] {
 			p := it.buf[0]
 			it.prim = p
-			if p == nil || p.Deleted {
+			if ok, err := it.qs.visible(ctx, nil, p); err != nil {
+				it.err = err
+				return false
+			} else if !ok {
 				continue
 			}
 			it.id = it.prim.ID
@@ -155,6 +207,31 @@ func (it *AllIterator) Next(ctx context.Context) bool {
 	}
 }
 
+var _ graph.Seekable = &AllIterator{}
+
+// SortOrder implements graph.Seekable. Primitives are read from the log in the order
+// of their IDs, thus quads are sorted in the same order as in QuadIterator.
+func (it *AllIterator) SortOrder() string {
+	if it.nodes {
+		return "kv_nodes"
+	}
+	return "kv"
+}
+
+// SortKey implements graph.Seekable.
+func (it *AllIterator) SortKey() uint64 {
+	return it.id
+}
+
+// NextGE implements graph.Seekable. Primitives with smaller IDs are not read.
+func (it *AllIterator) NextGE(ctx context.Context, k uint64) bool {
+	if k > 0 {
+		it.id = k - 1
+	}
+	it.buf = nil
+	return it.Next(ctx)
+}
+
 func (it *AllIterator) NextPath(ctx context.Context) bool {
 	return false
 }
@@ -183,8 +260,19 @@ func (it *AllIterator) Contains(ctx context.Context, v graph.Value) bool {
 	return true
 }
 
+// Size returns an estimate from statistics of the quad store: the number of nodes,
+// the number of quads with a given predicate, or the number of all quads otherwise.
 func (it *AllIterator) Size() (int64, bool) {
-	return it.qs.Size(), false
+	if it.nodes {
+		if n, ok := it.qs.stats.nodeCount(); ok {
+			return n, false
+		}
+	} else if it.cons != nil && it.cons.dir == quad.Predicate {
+		if n, ok := it.qs.stats.predicateCount(uint64(it.cons.val)); ok {
+			return n, false
+		}
+	}
+	return it.qs.estimateSize(), false
 }
 
 func (it *AllIterator) String() string {
@@ -199,6 +287,14 @@ func (it *AllIterator) Type() graph.Type {
 }
 func (it *AllIterator) Sorted() bool { return false }
 
+// Describe returns a description of a constrained iterator as a LinksTo of a single node.
+func (it *AllIterator) Describe() graph.Description {
+	if it.cons != nil {
+		return linksToDescription(it.cons.dir, it.cons.val)
+	}
+	return graph.Description{Params: graph.Options{"nodes": it.nodes}}
+}
+
 func (it *AllIterator) Optimize() (graph.Iterator, bool) {
 	return it, false
 }
@@ -19,6 +19,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/boltdb/bolt"
 
@@ -39,25 +40,51 @@ const (
 	Type = "bolt"
 )
 
+const boltFile = "indexes.bolt"
+
 func getBoltFile(cfgpath string) string {
-	return filepath.Join(cfgpath, "indexes.bolt")
+	return filepath.Join(cfgpath, boltFile)
+}
+
+// boltOptions returns options of the database and the size of the initial memory map.
+func boltOptions(opt graph.Options) (*bolt.Options, int, error) {
+	mb, err := opt.IntKey("mmap_size_mb", 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if mb <= 0 {
+		return nil, 0, nil
+	}
+	return &bolt.Options{InitialMmapSize: mb << 20}, mb << 20, nil
 }
 
-func Create(path string, _ graph.Options) (kv.BucketKV, error) {
-	err := os.MkdirAll(path, 0700)
+func Create(path string, opt graph.Options) (kv.BucketKV, error) {
+	bopt, mmap, err := boltOptions(opt)
 	if err != nil {
 		return nil, err
 	}
-	db, err := bolt.Open(getBoltFile(path), 0600, nil)
+	err = os.MkdirAll(path, 0700)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(getBoltFile(path), 0600, bopt)
 	if err != nil {
 		clog.Errorf("Error: couldn't create Bolt database: %v", err)
 		return nil, err
 	}
-	return &DB{DB: db}, nil
+	return &DB{DB: db, mmapSize: mmap}, nil
 }
 
 func Open(path string, opt graph.Options) (kv.BucketKV, error) {
-	db, err := bolt.Open(getBoltFile(path), 0600, nil)
+	// bolt creates a new file if there is none
+	if err := kv.CheckDir(path, boltFile, Type); err != nil {
+		return nil, err
+	}
+	bopt, mmap, err := boltOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(getBoltFile(path), 0600, bopt)
 	if err != nil {
 		clog.Errorf("Error, couldn't open! %v", err)
 		return nil, err
@@ -71,11 +98,13 @@ func Open(path string, opt graph.Options) (kv.BucketKV, error) {
 	if db.NoSync {
 		clog.Infof("Running in nosync mode")
 	}
-	return &DB{DB: db}, nil
+	return &DB{DB: db, mmapSize: mmap}, nil
 }
 
 type DB struct {
 	DB *bolt.DB
+	// mmapSize is the size of the initial memory map; snapshots are only supported if it's set
+	mmapSize int
 }
 
 func (db *DB) Type() string {
@@ -94,6 +123,74 @@ func (db *DB) Tx(update bool) (kv.BucketTx, error) {
 	return &Tx{Tx: tx}, nil
 }
 
+var _ kv.SnapshotKV = (*DB)(nil)
+
+// CanSnapshot implements kv.SnapshotKV. Snapshots are only supported if the size of
+// the initial memory map is set by the "mmap_size_mb" option.
+func (db *DB) CanSnapshot() bool {
+	return db.mmapSize > 0
+}
+
+// Snapshot implements kv.SnapshotKV. The snapshot keeps a read transaction open until
+// it's closed. While it's open, Bolt cannot reuse pages freed by writes, writes that
+// grow the database beyond the initial memory map wait for it, and so does closing
+// the database.
+func (db *DB) Snapshot() (kv.BucketKV, error) {
+	if !db.CanSnapshot() {
+		return nil, graph.ErrSnapshotNotSupported
+	}
+	tx, err := db.DB.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{tx: &Tx{Tx: tx}}, nil
+}
+
+// snapshot is a read-only database backed by a single read transaction.
+type snapshot struct {
+	tx *Tx
+	// mu serializes access to the transaction, since it's shared by all readers of the snapshot
+	mu sync.Mutex
+}
+
+func (s *snapshot) Type() string {
+	return Type
+}
+
+func (s *snapshot) Close() error {
+	return s.tx.Tx.Rollback()
+}
+
+func (s *snapshot) Tx(update bool) (kv.BucketTx, error) {
+	if update {
+		return nil, bolt.ErrTxNotWritable
+	}
+	return &snapshotTx{s: s}, nil
+}
+
+// snapshotTx is a transaction of a snapshot. It only shares the transaction
+// of the snapshot, thus committing or rolling it back does nothing.
+type snapshotTx struct {
+	s *snapshot
+}
+
+func (tx *snapshotTx) Get(ctx context.Context, keys []kv.BucketKey) ([][]byte, error) {
+	tx.s.mu.Lock()
+	defer tx.s.mu.Unlock()
+	return tx.s.tx.Get(ctx, keys)
+}
+
+func (tx *snapshotTx) Commit(ctx context.Context) error { return nil }
+func (tx *snapshotTx) Rollback() error                  { return nil }
+
+func (tx *snapshotTx) Bucket(name []byte) kv.Bucket {
+	tx.s.mu.Lock()
+	defer tx.s.mu.Unlock()
+	b := tx.s.tx.Bucket(name).(*Bucket)
+	b.mu = &tx.s.mu
+	return b
+}
+
 type Tx struct {
 	Tx  *bolt.Tx
 	err error
@@ -141,6 +238,8 @@ var _ kv.FillBucket = (*Bucket)(nil)
 type Bucket struct {
 	Bucket *bolt.Bucket
 	err    error
+	// mu is set for buckets of snapshots (see DB.Snapshot)
+	mu *sync.Mutex
 }
 
 func (b *Bucket) Get(ctx context.Context, keys [][]byte) ([][]byte, error) {
@@ -149,6 +248,10 @@ func (b *Bucket) Get(ctx context.Context, keys [][]byte) ([][]byte, error) {
 	} else if b.Bucket == nil {
 		return nil, kv.ErrNotFound
 	}
+	if b.mu != nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+	}
 	vals := make([][]byte, len(keys))
 	for i, k := range keys {
 		vals[i] = b.Bucket.Get(k)
@@ -171,6 +274,18 @@ func (b *Bucket) Scan(pref []byte) kv.KVIterator {
 	return &Iterator{b: b, pref: pref}
 }
 
+// cursor opens a new cursor. Cursors of a read transaction can be used concurrently,
+// but opening them cannot.
+func (b *Bucket) cursor() *bolt.Cursor {
+	if b.mu != nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+	}
+	return b.Bucket.Cursor()
+}
+
+var _ kv.KVSeeker = (*Iterator)(nil)
+
 type Iterator struct {
 	b    *Bucket
 	pref []byte
@@ -185,7 +300,7 @@ func (it *Iterator) Next(ctx context.Context) bool {
 		return false
 	}
 	if it.c == nil {
-		it.c = it.b.Bucket.Cursor()
+		it.c = it.b.cursor()
 		if len(it.pref) == 0 {
 			it.k, it.v = it.c.First()
 		} else {
@@ -200,6 +315,27 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	}
 	return ok
 }
+
+// Seek implements kv.KVSeeker.
+func (it *Iterator) Seek(ctx context.Context, k []byte) bool {
+	if it.b == nil {
+		return false
+	} else if it.b.err != nil {
+		return false
+	}
+	if it.c == nil {
+		it.c = it.b.cursor()
+	}
+	if bytes.Compare(k, it.pref) < 0 {
+		k = it.pref
+	}
+	it.k, it.v = it.c.Seek(k)
+	ok := it.k != nil && bytes.HasPrefix(it.k, it.pref)
+	if !ok {
+		it.b = nil
+	}
+	return ok
+}
 func (it *Iterator) Key() []byte { return it.k }
 func (it *Iterator) Val() []byte { return it.v }
 func (it *Iterator) Err() error {
@@ -17,19 +17,25 @@ package bolt
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/kv"
 	"github.com/cayleygraph/cayley/graph/kv/kvtest"
+	"github.com/stretchr/testify/require"
 )
 
 func makeBolt(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+	return makeBoltWith(t, nil)
+}
+
+func makeBoltWith(t testing.TB, opt graph.Options) (kv.BucketKV, graph.Options, func()) {
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test_"+Type)
 	if err != nil {
 		t.Fatalf("Could not create working directory: %v", err)
 	}
-	db, err := Create(tmpDir, nil)
+	db, err := Create(tmpDir, opt)
 	if err != nil {
 		os.RemoveAll(tmpDir)
 		t.Fatal("Failed to create Bolt database.", err)
@@ -44,6 +50,37 @@ func TestBolt(t *testing.T) {
 	kvtest.TestAll(t, makeBolt, nil)
 }
 
+func TestBoltSnapshots(t *testing.T) {
+	kvtest.TestAll(t, func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+		return makeBoltWith(t, graph.Options{"mmap_size_mb": 16})
+	}, nil)
+}
+
+func TestBoltOpenDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test_"+Type)
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	_, err = graph.NewQuadStore(Type, filepath.Join(tmpDir, "missing"), nil)
+	require.Equal(t, graph.ErrNotInitialized, err)
+	_, err = graph.NewQuadStore(Type, tmpDir, nil)
+	require.Equal(t, graph.ErrNotInitialized, err)
+	entries, err := ioutil.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "database should not be created on open")
+
+	other := filepath.Join(tmpDir, "other")
+	require.NoError(t, os.Mkdir(other, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(other, "data"), []byte("data"), 0600))
+	_, err = graph.NewQuadStore(Type, other, nil)
+	require.Equal(t, &graph.ErrWrongBackend{Expected: Type}, err)
+
+	require.NoError(t, graph.InitQuadStore(Type, tmpDir, nil))
+	qs, err := graph.NewQuadStore(Type, tmpDir, nil)
+	require.NoError(t, err)
+	require.NoError(t, qs.Close())
+}
+
 func BenchmarkBolt(b *testing.B) {
 	kvtest.BenchmarkAll(b, makeBolt, nil)
 }
@@ -139,6 +139,8 @@ func (b *Bucket) Scan(pref []byte) kv.KVIterator {
 	return &Iterator{b: b, pref: pref}
 }
 
+var _ kv.KVSeeker = (*Iterator)(nil)
+
 type Iterator struct {
 	b    *Bucket
 	pref []byte
@@ -164,6 +166,23 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	it.k, it.v = k, v
 	return true
 }
+
+// Seek implements kv.KVSeeker.
+func (it *Iterator) Seek(ctx context.Context, k []byte) bool {
+	if it.b == nil {
+		return false
+	} else if it.b.err != nil {
+		return false
+	}
+	if it.e != nil {
+		it.e.Close()
+	}
+	if bytes.Compare(k, it.pref) < 0 {
+		k = it.pref
+	}
+	it.e, _ = it.b.tree.Seek(k)
+	return it.Next(ctx)
+}
 func (it *Iterator) Key() []byte { return it.k }
 func (it *Iterator) Val() []byte { return it.v }
 func (it *Iterator) Err() error {
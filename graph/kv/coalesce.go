@@ -0,0 +1,205 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	optCoalesceWindow = "write_coalesce_ms"
+	optCoalesceSize   = "write_coalesce_size"
+
+	defaultCoalesceSize = 1000
+)
+
+// newCoalescerFromOptions returns a coalescer configured by quad store options,
+// or nil if write coalescing is disabled.
+func newCoalescerFromOptions(opt graph.Options, apply applyFunc) (*coalescer, error) {
+	ms, err := opt.IntKey(optCoalesceWindow, 0)
+	if err != nil {
+		return nil, err
+	} else if ms <= 0 {
+		return nil, nil
+	}
+	size, err := opt.IntKey(optCoalesceSize, defaultCoalesceSize)
+	if err != nil {
+		return nil, err
+	} else if size <= 0 {
+		size = defaultCoalesceSize
+	}
+	return newCoalescer(apply, time.Duration(ms)*time.Millisecond, size), nil
+}
+
+type applyFunc func(in []graph.Delta, opts graph.IgnoreOpts) error
+
+type writeRequest struct {
+	deltas []graph.Delta
+	opts   graph.IgnoreOpts
+	err    chan error
+}
+
+// quads returns hashes of all quads changed by the request.
+func (r *writeRequest) quads() []graph.QuadHash {
+	out := make([]graph.QuadHash, 0, len(r.deltas))
+	for _, d := range r.deltas {
+		var h graph.QuadHash
+		for _, dir := range quad.Directions {
+			if v := d.Quad.Get(dir); v != nil {
+				h.Set(dir, graph.HashOf(v))
+			}
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// coalescer groups concurrent writes that arrive within a short time window into a single
+// transaction. Each writer still waits for its own changes to be committed and receives
+// its own error.
+//
+// Within a transaction all quads are added before any of them are deleted, thus writes
+// that change the same quad are never committed together; they are applied in the order
+// they were received instead.
+type coalescer struct {
+	apply  applyFunc
+	window time.Duration
+	size   int // max number of deltas in a single transaction
+
+	reqs chan *writeRequest
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newCoalescer(apply applyFunc, window time.Duration, size int) *coalescer {
+	c := &coalescer{
+		apply:  apply,
+		window: window,
+		size:   size,
+		reqs:   make(chan *writeRequest),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Apply schedules deltas to be written and waits until they are committed.
+func (c *coalescer) Apply(in []graph.Delta, opts graph.IgnoreOpts) error {
+	r := &writeRequest{deltas: in, opts: opts, err: make(chan error, 1)}
+	select {
+	case c.reqs <- r:
+		return <-r.err
+	case <-c.done:
+		// coalescer is closed, write directly
+		return c.apply(in, opts)
+	}
+}
+
+// Close commits all pending writes and stops the coalescer.
+func (c *coalescer) Close() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+}
+
+func (c *coalescer) run() {
+	defer close(c.done)
+	var next *writeRequest
+	for {
+		if next == nil {
+			select {
+			case next = <-c.reqs:
+			case <-c.stop:
+				return
+			}
+		}
+		next = c.collect(next)
+	}
+}
+
+// collect gathers requests that can be committed together with the first one until the time
+// window ends or the batch is full, and commits them. It returns the first request that
+// cannot be a part of the batch, if any.
+func (c *coalescer) collect(first *writeRequest) *writeRequest {
+	batch := []*writeRequest{first}
+	n := len(first.deltas)
+	seen := make(map[graph.QuadHash]struct{}, n)
+	for _, h := range first.quads() {
+		seen[h] = struct{}{}
+	}
+	timer := time.NewTimer(c.window)
+	defer timer.Stop()
+	var next *writeRequest
+loop:
+	for n < c.size {
+		select {
+		case r := <-c.reqs:
+			if r.opts != first.opts || !addQuads(seen, r.quads()) {
+				next = r
+				break loop
+			}
+			batch = append(batch, r)
+			n += len(r.deltas)
+		case <-timer.C:
+			break loop
+		case <-c.stop:
+			break loop
+		}
+	}
+	c.commit(batch)
+	return next
+}
+
+// addQuads adds hashes to the set, unless one of them is already in it.
+func addQuads(seen map[graph.QuadHash]struct{}, quads []graph.QuadHash) bool {
+	for _, h := range quads {
+		if _, ok := seen[h]; ok {
+			return false
+		}
+	}
+	for _, h := range quads {
+		seen[h] = struct{}{}
+	}
+	return true
+}
+
+func (c *coalescer) commit(batch []*writeRequest) {
+	if len(batch) == 1 {
+		r := batch[0]
+		r.err <- c.apply(r.deltas, r.opts)
+		return
+	}
+	var all []graph.Delta
+	for _, r := range batch {
+		all = append(all, r.deltas...)
+	}
+	if err := c.apply(all, batch[0].opts); err == nil {
+		for _, r := range batch {
+			r.err <- nil
+		}
+		return
+	}
+	// failed transaction was rolled back; apply writes one by one to return errors to their callers
+	for _, r := range batch {
+		r.err <- c.apply(r.deltas, r.opts)
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/proto"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/pquads"
+)
+
+// Hash functions that can be used to derive keys of nodes (see "hash" option).
+const (
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+	HashFNV    = "fnv" // 64 bit FNV-1a
+)
+
+// Policies for values with colliding hash keys (see "hash_collisions" option).
+const (
+	// CollisionsIgnore assumes that hashes never collide. Values with the same hash are
+	// treated as the same node. It's the default for full-width cryptographic hashes.
+	CollisionsIgnore = "ignore"
+	// CollisionsFail rejects writes of values with the same hash as a different existing value.
+	// It's the default for truncated and non-cryptographic hashes.
+	CollisionsFail = "fail"
+	// CollisionsChain stores colliding values under the same hash with a disambiguator suffix.
+	CollisionsChain = "chain"
+)
+
+// Options of the node hashing.
+const (
+	optHash       = "hash"
+	optHashWidth  = "hash_width"
+	optCollisions = "hash_collisions"
+)
+
+// minHashWidth is the minimal width of hash keys. Two first bytes select a bucket of the node.
+const minHashWidth = 2
+
+var hashSizes = map[string]int{
+	HashSHA1:   quad.HashSize,
+	HashSHA256: sha256.Size,
+	HashFNV:    8,
+}
+
+// ErrHashCollision is returned when a value has the same hash key as a different value
+// that is already in the store, and the store is configured to fail on collisions.
+type ErrHashCollision struct {
+	Value quad.Value
+	Other quad.Value // value that is already in the store
+}
+
+func (e *ErrHashCollision) Error() string {
+	return fmt.Sprintf("kv: hash collision: %v and %v", e.Value, e.Other)
+}
+
+// hashConfig describes how keys of nodes are derived from their values.
+// It's set when the database is created, and recorded in its metadata.
+type hashConfig struct {
+	Func       string
+	Width      int
+	Collisions string
+}
+
+// legacyHash is a hash config of databases created before it was configurable.
+var legacyHash = hashConfig{Func: HashSHA1, Width: quad.HashSize, Collisions: CollisionsIgnore}
+
+// newHashConfig reads hash options and fills defaults.
+func newHashConfig(opt graph.Options) (hashConfig, error) {
+	var (
+		c   hashConfig
+		err error
+	)
+	c.Func, err = opt.StringKey(optHash, HashSHA1)
+	if err != nil {
+		return c, err
+	}
+	size, ok := hashSizes[c.Func]
+	if !ok {
+		return c, fmt.Errorf("kv: unsupported hash function: %q", c.Func)
+	}
+	c.Width, err = opt.IntKey(optHashWidth, size)
+	if err != nil {
+		return c, err
+	} else if c.Width < minHashWidth || c.Width > size {
+		return c, fmt.Errorf("kv: hash width of %s must be in [%d, %d], got %d", c.Func, minHashWidth, size, c.Width)
+	}
+	def := CollisionsFail
+	if c.Func != HashFNV && c.Width == size {
+		def = CollisionsIgnore
+	}
+	c.Collisions, err = opt.StringKey(optCollisions, def)
+	if err != nil {
+		return c, err
+	}
+	switch c.Collisions {
+	case CollisionsIgnore, CollisionsFail, CollisionsChain:
+	default:
+		return c, fmt.Errorf("kv: unsupported hash collisions policy: %q", c.Collisions)
+	}
+	return c, nil
+}
+
+// checkOptions returns an error if hash options are set and are different from the config.
+// Hashing cannot be changed after the database is created.
+func (c hashConfig) checkOptions(opt graph.Options) error {
+	for _, o := range []struct {
+		key string
+		val interface{}
+	}{
+		{optHash, c.Func},
+		{optHashWidth, c.Width},
+		{optCollisions, c.Collisions},
+	} {
+		if _, ok := opt[o.key]; !ok {
+			continue
+		}
+		var (
+			v   interface{}
+			err error
+		)
+		if _, ok := o.val.(int); ok {
+			v, err = opt.IntKey(o.key, 0)
+		} else {
+			v, err = opt.StringKey(o.key, "")
+		}
+		if err != nil {
+			return err
+		} else if v != o.val {
+			return fmt.Errorf("kv: database was created with %s=%v, cannot open it with %v", o.key, o.val, v)
+		}
+	}
+	return nil
+}
+
+// checked reports if values of nodes must be compared to find their keys.
+func (c hashConfig) checked() bool {
+	return c.Collisions != CollisionsIgnore
+}
+
+// key returns a hash key of a value. If the hash function is SHA1, h may be set to a
+// precalculated hash of the value.
+func (c hashConfig) key(v quad.Value, h *graph.ValueHash) []byte {
+	switch c.Func {
+	case HashSHA1:
+		if h == nil {
+			sum := graph.HashOf(v)
+			h = &sum
+		}
+		return append([]byte{}, h[:c.Width]...)
+	case HashSHA256:
+		sum := sha256.Sum256([]byte(quad.StringOf(v)))
+		return sum[:c.Width]
+	case HashFNV:
+		f := fnv.New64a()
+		f.Write([]byte(quad.StringOf(v)))
+		return f.Sum(nil)[:c.Width]
+	}
+	panic("unsupported hash: " + c.Func)
+}
+
+// nodeSlot is a location of a node entry in hash buckets.
+//
+// The first value with a given hash key is stored under the key itself. If collisions
+// are chained, the following values are stored under the same key with a suffix that
+// contains the number of the entry in the chain. Removed entries in the middle of the
+// chain are kept with a zero id, thus the chain ends at the first missing entry.
+type nodeSlot struct {
+	ID     uint64 // id of the node; zero if the value is not in the store
+	Prefix []byte // hash key of the value
+	N      int    // number of the entry in the chain; for missing values, a number of a free entry
+	Other  uint64 // id of a different node with the same hash key, if any
+}
+
+// Key returns a key of the node entry in hash buckets.
+func (s nodeSlot) Key() []byte {
+	return slotKey(s.Prefix, s.N)
+}
+
+func slotKey(prefix []byte, n int) []byte {
+	if n == 0 {
+		return prefix
+	}
+	var buf [binary.MaxVarintLen64]byte
+	sz := binary.PutUvarint(buf[:], uint64(n))
+	return append(append([]byte{}, prefix...), buf[:sz]...)
+}
+
+func bucketKeyForSlot(k []byte) BucketKey {
+	return BucketKey{Bucket: bucketForVal(k[0], k[1]), Key: k}
+}
+
+func bucketKeyForSlotRefs(k []byte) BucketKey {
+	return BucketKey{Bucket: bucketForValRefs(k[0], k[1]), Key: k}
+}
+
+// resolveNodes finds entries of nodes with given values and hash keys. Nil values are skipped.
+//
+// If the collisions are ignored, ids are read from entries of the keys directly.
+// Otherwise, values of nodes are compared to the requested ones, and chains of
+// entries are followed, if collisions are chained.
+func (qs *QuadStore) resolveNodes(ctx context.Context, tx BucketTx, vals []quad.Value, keys [][]byte) ([]nodeSlot, error) {
+	out := make([]nodeSlot, len(vals))
+	var (
+		pend []int
+		raw  = make([][]byte, len(vals))
+	)
+	for i, v := range vals {
+		if v == nil {
+			continue
+		}
+		out[i].Prefix = keys[i]
+		pend = append(pend, i)
+		if qs.hash.checked() {
+			b, err := pquads.MarshalValue(v)
+			if err != nil {
+				return nil, err
+			}
+			raw[i] = b
+		}
+	}
+	for len(pend) != 0 {
+		bkeys := make([]BucketKey, 0, len(pend))
+		for _, i := range pend {
+			bkeys = append(bkeys, bucketKeyForSlot(out[i].Key()))
+		}
+		resp, err := tx.Get(ctx, bkeys)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			next []int
+			cand []int
+			ids  []uint64
+		)
+		for j, b := range resp {
+			i := pend[j]
+			if len(b) == 0 {
+				continue // end of the chain; the value is not in the store
+			}
+			id, _ := binary.Uvarint(b)
+			if !qs.hash.checked() {
+				out[i].ID = id
+			} else if id == 0 {
+				// removed entry in the middle of the chain
+				out[i].N++
+				next = append(next, i)
+			} else {
+				cand = append(cand, i)
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) != 0 {
+			prims, err := qs.getPrimitivesFromLog(ctx, tx, ids)
+			if err != nil {
+				return nil, err
+			}
+			for j, i := range cand {
+				if p := prims[j]; p != nil && bytes.Equal(p.Value, raw[i]) {
+					out[i].ID = ids[j]
+					continue
+				}
+				if out[i].Other == 0 {
+					out[i].Other = ids[j]
+				}
+				if qs.hash.Collisions == CollisionsChain {
+					out[i].N++
+					next = append(next, i)
+				}
+			}
+		}
+		pend = next
+	}
+	return out, nil
+}
+
+// delNodeSlot removes an entry of the node from the hash bucket. Entries in the middle
+// of a chain are kept with a zero id.
+func (qs *QuadStore) delNodeSlot(ctx context.Context, tx BucketTx, n nodeSlot) error {
+	k := bucketKeyForSlot(n.Key())
+	b := tx.Bucket(k.Bucket)
+	if qs.hash.Collisions == CollisionsChain {
+		next := bucketKeyForSlot(slotKey(n.Prefix, n.N+1))
+		_, err := GetOne(ctx, tx.Bucket(next.Bucket), next.Key)
+		if err == nil {
+			return b.Put(k.Key, uint64toBytes(0))
+		} else if err != ErrNotFound {
+			return err
+		}
+	}
+	return b.Del(k.Key)
+}
+
+// HashCollision describes a node that shares a hash key with other nodes.
+type HashCollision struct {
+	ID    uint64
+	Value quad.Value
+	Key   []byte // hash key of the value
+	// Chained is set if the node is stored in a chain of colliding values. Otherwise,
+	// the node cannot be found by its value, since an entry of its key points to another node.
+	Chained bool
+}
+
+// verifyBatch is the number of nodes that are checked at once by VerifyHashes.
+const verifyBatch = 1000
+
+// VerifyHashes scans all nodes of the store and calls fn for each node that collides
+// with another node by its hash key, or that cannot be found by its value.
+//
+// Values that were merged with other values because of ignored collisions have no
+// nodes of their own, thus they cannot be detected.
+func (qs *QuadStore) VerifyHashes(ctx context.Context, fn func(c HashCollision) error) error {
+	return View(qs.db, func(tx BucketTx) error {
+		var (
+			ids  []uint64
+			vals []quad.Value
+			keys [][]byte
+		)
+		flush := func() error {
+			if len(vals) == 0 {
+				return nil
+			}
+			slots, err := qs.resolveNodes(ctx, tx, vals, keys)
+			if err != nil {
+				return err
+			}
+			for i, s := range slots {
+				if s.ID == ids[i] && s.N == 0 {
+					continue
+				}
+				c := HashCollision{ID: ids[i], Value: vals[i], Key: keys[i], Chained: s.ID == ids[i]}
+				if err := fn(c); err != nil {
+					return err
+				}
+			}
+			ids, vals, keys = ids[:0], vals[:0], keys[:0]
+			return nil
+		}
+		err := Each(ctx, tx.Bucket(logIndex), nil, func(k, v []byte) error {
+			var p proto.Primitive
+			if err := p.Unmarshal(v); err != nil {
+				return err
+			}
+			if !p.IsNode() {
+				return nil
+			}
+			val, err := pquads.UnmarshalValue(p.Value)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, p.ID)
+			vals = append(vals, val)
+			keys = append(keys, qs.hash.key(val, nil))
+			if len(vals) >= verifyBatch {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.DeltaLog = (*QuadStore)(nil)
+
+// Versions of history records. Records of all known versions can be read,
+// new records are always written with the latest one.
+const (
+	// historyV1 record: action (1 byte), timestamp (8 bytes), actor (rest).
+	historyV1 = 1
+
+	latestHistoryVersion = historyV1
+)
+
+const historyKeySize = 4*quad.HashSize + 8
+
+// historyEvent is a change of a single quad that is recorded in the history.
+type historyEvent struct {
+	hash  graph.QuadHash
+	id    uint64 // horizon of the change
+	delta graph.Delta
+}
+
+// historyPrefix returns a key prefix of all history records for a given quad.
+func historyPrefix(q graph.QuadHash) []byte {
+	key := make([]byte, 0, historyKeySize)
+	for _, h := range q.Dirs() {
+		key = append(key, h[:]...)
+	}
+	return key
+}
+
+func historyKey(q graph.QuadHash, id uint64) []byte {
+	key := historyPrefix(q)
+	key = key[:len(key)+8]
+	// big endian to keep records in the order of changes
+	quadKeyEnc.PutUint64(key[len(key)-8:], id)
+	return key
+}
+
+func encodeHistoryRecord(d graph.Delta) []byte {
+	buf := make([]byte, 10+len(d.Actor))
+	buf[0] = latestHistoryVersion
+	buf[1] = byte(d.Action)
+	binary.LittleEndian.PutUint64(buf[2:], uint64(d.Timestamp.UnixNano()))
+	copy(buf[10:], d.Actor)
+	return buf
+}
+
+func decodeHistoryRecord(b []byte, d *graph.Delta) error {
+	if len(b) == 0 {
+		return fmt.Errorf("kv: empty history record")
+	}
+	switch b[0] {
+	case historyV1:
+		if len(b) < 10 {
+			return fmt.Errorf("kv: unexpected history record size: %d", len(b))
+		}
+		d.Action = graph.Procedure(int8(b[1]))
+		d.Timestamp = time.Unix(0, int64(binary.LittleEndian.Uint64(b[2:])))
+		d.Actor = string(b[10:])
+	default:
+		return fmt.Errorf("kv: unsupported history record version: %d", b[0])
+	}
+	return nil
+}
+
+func (qs *QuadStore) addHistory(tx BucketTx, events []historyEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	b := tx.Bucket(historyBucket)
+	for _, e := range events {
+		if err := b.Put(historyKey(e.hash, e.id), encodeHistoryRecord(e.delta)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QuadHistory returns all additions and removals of a quad recorded since the history
+// was enabled for the store. Historical views only return changes made before their horizon.
+//
+// It returns graph.ErrHistoryNotSupported if the store was opened without the history option.
+func (qs *QuadStore) QuadHistory(ctx context.Context, q quad.Quad) ([]graph.Delta, error) {
+	if !qs.history {
+		return nil, graph.ErrHistoryNotSupported
+	}
+	var h graph.QuadHash
+	for _, dir := range quad.Directions {
+		if v := q.Get(dir); v != nil {
+			h.Set(dir, graph.HashOf(v))
+		}
+	}
+	var out []graph.Delta
+	err := View(qs.db, func(tx BucketTx) error {
+		return Each(ctx, tx.Bucket(historyBucket), historyPrefix(h), func(k, v []byte) error {
+			if len(k) != historyKeySize {
+				return fmt.Errorf("kv: unexpected history key size: %d", len(k))
+			}
+			id := quadKeyEnc.Uint64(k[len(k)-8:])
+			if qs.view && int64(id) > qs.asOf {
+				return nil
+			}
+			d := graph.Delta{ID: graph.NewSequentialKey(int64(id)), Quad: q}
+			if err := decodeHistoryRecord(v, &d); err != nil {
+				return err
+			}
+			out = append(out, d)
+			return nil
+		})
+	})
+	if err == ErrNoBucket {
+		// created by a version without history support
+		err = nil
+	}
+	return out, err
+}
@@ -35,11 +35,16 @@ import (
 var (
 	metaBucket = []byte("meta")
 	logIndex   = []byte("log")
+	tombBucket = []byte("tomb")
+	// historyBucket stores changes of quads, if history is enabled. See QuadHistory.
+	historyBucket = []byte("history")
 
 	// List of all buckets in the current version of the database.
 	buckets = [][]byte{
 		metaBucket,
 		logIndex,
+		tombBucket,
+		historyBucket,
 	}
 
 	DefaultQuadIndexes = []QuadIndex{
@@ -133,42 +138,40 @@ func (qs *QuadStore) incSize(ctx context.Context, tx BucketTx, size int64) error
 	return err
 }
 
-func (qs *QuadStore) resolveValDeltas(ctx context.Context, tx BucketTx, deltas []graphlog.NodeUpdate, fnc func(i int, id uint64)) error {
+func (qs *QuadStore) resolveValDeltas(ctx context.Context, tx BucketTx, deltas []graphlog.NodeUpdate, fnc func(i int, n nodeSlot)) error {
 	inds := make([]int, 0, len(deltas))
-	keys := make([]BucketKey, 0, len(deltas))
+	vals := make([]quad.Value, 0, len(deltas))
+	keys := make([][]byte, 0, len(deltas))
 	for i, d := range deltas {
+		if d.Val == nil {
+			fnc(i, nodeSlot{})
+			continue
+		}
+		key := qs.hash.key(d.Val, &deltas[i].Hash)
 		if iri, ok := d.Val.(quad.IRI); ok {
+			// only the first entries of hash keys are cached
 			if x, ok := qs.valueLRU.Get(string(iri)); ok {
-				fnc(i, x.(uint64))
+				fnc(i, nodeSlot{ID: x.(uint64), Prefix: key})
 				continue
 			}
-		} else if d.Val == nil {
-			fnc(i, 0)
-			continue
 		}
 		inds = append(inds, i)
-		keys = append(keys, bucketKeyForHash(d.Hash))
+		vals = append(vals, d.Val)
+		keys = append(keys, key)
 	}
-	if len(keys) == 0 {
+	if len(vals) == 0 {
 		return nil
 	}
-	resp, err := tx.Get(ctx, keys)
+	nodes, err := qs.resolveNodes(ctx, tx, vals, keys)
 	if err != nil {
 		return err
 	}
-	keys = nil
-	for i, b := range resp {
-		if len(b) == 0 {
-			fnc(inds[i], 0)
-			continue
-		}
+	for i, n := range nodes {
 		ind := inds[i]
-		id, _ := binary.Uvarint(b)
-		d := &deltas[ind]
-		if iri, ok := d.Val.(quad.IRI); ok && id != 0 {
-			qs.valueLRU.Put(string(iri), uint64(id))
+		if iri, ok := vals[i].(quad.IRI); ok && n.ID != 0 && n.N == 0 {
+			qs.valueLRU.Put(string(iri), n.ID)
 		}
-		fnc(ind, uint64(id))
+		fnc(ind, n)
 	}
 	return nil
 }
@@ -219,14 +222,14 @@ func (qs *QuadStore) genIDs(ctx context.Context, tx BucketTx, n int) (uint64, er
 
 type nodeUpdate struct {
 	Ind int
-	ID  uint64
+	nodeSlot
 	graphlog.NodeUpdate
 }
 
 func (qs *QuadStore) incNodesCnt(ctx context.Context, tx BucketTx, deltas []nodeUpdate) ([]int, error) {
 	keys := make([]BucketKey, 0, len(deltas))
 	for _, d := range deltas {
-		keys = append(keys, bucketKeyForHashRefs(d.Hash))
+		keys = append(keys, bucketKeyForSlotRefs(d.Key()))
 	}
 	sizes, err := tx.Get(ctx, keys)
 	if err != nil {
@@ -270,20 +273,23 @@ func (qs *QuadStore) incNodes(ctx context.Context, tx BucketTx, deltas []graphlo
 		upd = make([]nodeUpdate, 0, len(deltas))
 		ids = make(map[graph.ValueHash]resolvedNode, len(deltas))
 	)
-	err := qs.resolveValDeltas(ctx, tx, deltas, func(i int, id uint64) {
-		if id == 0 {
+	err := qs.resolveValDeltas(ctx, tx, deltas, func(i int, n nodeSlot) {
+		if n.ID == 0 {
 			// not exists, should create
-			ins = append(ins, nodeUpdate{Ind: i, NodeUpdate: deltas[i]})
+			ins = append(ins, nodeUpdate{Ind: i, nodeSlot: n, NodeUpdate: deltas[i]})
 		} else {
 			// exists, should update
-			upd = append(upd, nodeUpdate{Ind: i, ID: id, NodeUpdate: deltas[i]})
-			ids[deltas[i].Hash] = resolvedNode{ID: id}
+			upd = append(upd, nodeUpdate{Ind: i, nodeSlot: n, NodeUpdate: deltas[i]})
+			ids[deltas[i].Hash] = resolvedNode{ID: n.ID}
 		}
 	})
 	if err != nil {
 		return ids, err
 	}
 	if len(ins) != 0 {
+		if err := qs.allocSlots(ctx, tx, ins); err != nil {
+			return ids, err
+		}
 		// preallocate IDs
 		start, err := qs.genIDs(ctx, tx, len(ins))
 		if err != nil {
@@ -298,7 +304,7 @@ func (qs *QuadStore) incNodes(ctx context.Context, tx BucketTx, deltas []graphlo
 			}
 			node.ID = id
 			ids[iv.Hash] = resolvedNode{ID: id, New: true}
-			if err := qs.indexNode(tx, node, iv.Val); err != nil {
+			if err := qs.indexNode(tx, node, iv.Val, iv.nodeSlot); err != nil {
 				return ids, err
 			}
 			ins[i].ID = id
@@ -310,39 +316,91 @@ func (qs *QuadStore) incNodes(ctx context.Context, tx BucketTx, deltas []graphlo
 	_, err = qs.incNodesCnt(ctx, tx, upd)
 	return ids, err
 }
-func (qs *QuadStore) decNodes(ctx context.Context, tx BucketTx, deltas []graphlog.NodeUpdate, nodes map[graph.ValueHash]uint64) error {
+
+// allocSlots checks that new nodes do not collide with other nodes by their hash keys,
+// according to the collisions policy. If collisions are chained, it assigns entries
+// of the hash buckets to new nodes with the same key.
+func (qs *QuadStore) allocSlots(ctx context.Context, tx BucketTx, ins []nodeUpdate) error {
+	if !qs.hash.checked() {
+		return nil
+	}
+	used := make(map[string]quad.Value, len(ins))
+	for i := range ins {
+		n := &ins[i]
+		for {
+			other, ok := used[string(n.Key())]
+			if !ok {
+				break
+			} else if qs.hash.Collisions != CollisionsChain {
+				return &ErrHashCollision{Value: n.Val, Other: other}
+			}
+			// entries after the end of the chain are free
+			n.N++
+		}
+		if n.Other != 0 && qs.hash.Collisions == CollisionsFail {
+			other, err := qs.getValFromLog(ctx, tx, n.Other)
+			if err != nil {
+				return err
+			}
+			return &ErrHashCollision{Value: n.Val, Other: other}
+		}
+		used[string(n.Key())] = n.Val
+	}
+	return nil
+}
+
+// decNodes decrements reference counters of nodes and removes nodes that are no longer
+// referenced. It returns the number of removed nodes.
+func (qs *QuadStore) decNodes(ctx context.Context, tx BucketTx, deltas []graphlog.NodeUpdate, nodes map[graph.ValueHash]nodeSlot) (int, error) {
 	upds := make([]nodeUpdate, 0, len(deltas))
 	for i, d := range deltas {
-		id := nodes[d.Hash]
-		if id == 0 || d.RefInc == 0 {
+		n := nodes[d.Hash]
+		if n.ID == 0 || d.RefInc == 0 {
 			continue
 		}
-		upds = append(upds, nodeUpdate{Ind: i, ID: id, NodeUpdate: d})
+		upds = append(upds, nodeUpdate{Ind: i, nodeSlot: n, NodeUpdate: d})
 	}
 	del, err := qs.incNodesCnt(ctx, tx, upds)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	for _, i := range del {
 		d := upds[i]
-		bucket := tx.Bucket(bucketForVal(d.Hash[0], d.Hash[1]))
-		if err = bucket.Del(d.Hash[:]); err != nil {
-			return err
+		if err = qs.delNodeSlot(ctx, tx, d.nodeSlot); err != nil {
+			return 0, err
 		}
 		if iri, ok := d.Val.(quad.IRI); ok {
 			qs.valueLRU.Del(string(iri))
 		}
 		if err := qs.delLog(tx, d.ID); err != nil {
-			return err
+			return 0, err
 		}
 	}
-	return nil
+	return len(del), nil
 }
 
 func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	if qs.view {
+		return ErrReadOnlyView
+	}
+	if qs.coalesce != nil {
+		return qs.coalesce.Apply(in, ignoreOpts)
+	}
+	return qs.applyDeltas(in, ignoreOpts)
+}
+
+func (qs *QuadStore) applyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts) (err error) {
 	ctx := context.TODO()
 	qs.writer.Lock()
 	defer qs.writer.Unlock()
+	defer func() {
+		if err != nil {
+			// the cache may contain ids of nodes inserted by the failed transaction
+			qs.valueLRU.Purge()
+			// index entries of the failed transaction must not be written by the next one
+			qs.mapBucket = nil
+		}
+	}()
 	tx, err := qs.db.Tx(true)
 	if err != nil {
 		return err
@@ -354,14 +412,22 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 	}
 
 	deltas := graphlog.SplitDeltas(in)
+	// changes of statistics, applied after the commit
+	var sd statsDelta
 	// first add all new nodes
 	nodes, err := qs.incNodes(ctx, tx, deltas.IncNode)
 	if err != nil {
 		return err
 	}
+	for _, n := range nodes {
+		if n.New {
+			sd.nodes++
+		}
+	}
 	deltas.IncNode = nil
 	// resolve and insert all new quads
 	links := make([]proto.Primitive, 0, len(deltas.QuadAdd))
+	added := make([]graphlog.QuadUpdate, 0, len(deltas.QuadAdd))
 	qadd := make(map[[4]uint64]struct{}, len(deltas.QuadAdd))
 	for _, q := range deltas.QuadAdd {
 		var link proto.Primitive
@@ -385,7 +451,7 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 			if err != nil {
 				return err
 			}
-			if p != nil {
+			if p != nil && !p.Deleted {
 				if ignoreOpts.IgnoreDup {
 					continue // already exists, no need to insert
 				}
@@ -393,6 +459,7 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 			}
 		}
 		links = append(links, link)
+		added = append(added, q)
 	}
 	qadd = nil
 	deltas.QuadAdd = nil
@@ -401,26 +468,38 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 	if err != nil {
 		return err
 	}
+	var events []historyEvent
+	now := time.Now()
 	for i := range links {
+		d := in[added[i].Ind]
+		if d.Timestamp.IsZero() {
+			d.Timestamp = now
+		}
 		links[i].ID = qstart + uint64(i)
-		links[i].Timestamp = time.Now().UnixNano()
+		links[i].Timestamp = d.Timestamp.UnixNano()
+		sd.addQuad(&links[i], 1)
+		if qs.history {
+			events = append(events, historyEvent{hash: added[i].Quad, id: links[i].ID, delta: d})
+		}
 	}
 	if err := qs.indexLinks(ctx, tx, links); err != nil {
 		return err
 	}
 	links = links[:0]
+	added = nil
 
 	if len(deltas.QuadDel) != 0 || len(deltas.DecNode) != 0 {
 		// resolve all nodes that will be removed
-		dnodes := make(map[graph.ValueHash]uint64, len(deltas.DecNode))
-		if err := qs.resolveValDeltas(ctx, tx, deltas.DecNode, func(i int, id uint64) {
-			dnodes[deltas.DecNode[i].Hash] = id
+		dnodes := make(map[graph.ValueHash]nodeSlot, len(deltas.DecNode))
+		if err := qs.resolveValDeltas(ctx, tx, deltas.DecNode, func(i int, n nodeSlot) {
+			dnodes[deltas.DecNode[i].Hash] = n
 		}); err != nil {
 			return err
 		}
 
 		// check for existence and delete quads
 		fixNodes := make(map[graph.ValueHash]int)
+		removed := make([]graphlog.QuadUpdate, 0, len(deltas.QuadDel))
 		for _, q := range deltas.QuadDel {
 			var link proto.Primitive
 			exists := true
@@ -428,9 +507,9 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 				h := q.Quad.Get(dir)
 				n, ok := nodes[h]
 				if !ok {
-					var id uint64
-					id, ok = dnodes[h]
-					n.ID = id
+					var dn nodeSlot
+					dn, ok = dnodes[h]
+					n.ID = dn.ID
 				}
 				if !ok {
 					exists = exists && !h.Valid()
@@ -461,12 +540,27 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 				continue
 			}
 			links = append(links, link)
+			removed = append(removed, q)
 		}
 		deltas.QuadDel = nil
-		if err := qs.markLinksDead(ctx, tx, links); err != nil {
+		for i := range links {
+			sd.addQuad(&links[i], -1)
+		}
+		dh, err := qs.markLinksDead(ctx, tx, links)
+		if err != nil {
 			return err
 		}
+		if qs.history {
+			for _, q := range removed {
+				d := in[q.Ind]
+				if d.Timestamp.IsZero() {
+					d.Timestamp = now
+				}
+				events = append(events, historyEvent{hash: q.Quad, id: dh, delta: d})
+			}
+		}
 		links = nil
+		removed = nil
 		nodes = nil
 
 		// we decremented some nodes that has non-existent quads - let's fix this
@@ -478,36 +572,56 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 			}
 		}
 
-		// finally decrement and remove nodes
-		if err := qs.decNodes(ctx, tx, deltas.DecNode, dnodes); err != nil {
-			return err
+		// finally decrement and remove nodes; tombstones still reference them
+		if !qs.tombstones {
+			n, err := qs.decNodes(ctx, tx, deltas.DecNode, dnodes)
+			if err != nil {
+				return err
+			}
+			sd.nodes -= int64(n)
 		}
 		deltas = nil
 		dnodes = nil
 	}
+	if err = qs.addHistory(tx, events); err != nil {
+		return err
+	}
+	events = nil
 	// flush quad indexes and commit
 	err = qs.flushMapBucket(ctx, tx)
 	if err != nil {
 		return err
 	}
-	return tx.Commit(ctx)
-}
-
-func (qs *QuadStore) indexNode(tx BucketTx, p *proto.Primitive, val quad.Value) error {
-	var err error
-	if val == nil {
-		val, err = pquads.UnmarshalValue(p.Value)
-		if err != nil {
+	if !graph.HasCommitHooks() {
+		if err = tx.Commit(ctx); err != nil {
 			return err
 		}
+		qs.stats.apply(&sd)
+		return nil
+	}
+	h, err := qs.getMetaIntTx(ctx, tx, "horizon")
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	horizon := graph.NewSequentialKey(h)
+	if err = graph.BeforeCommit(in, horizon); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
 	}
-	hash := quad.HashOf(val)
-	bucket := tx.Bucket(bucketForVal(hash[0], hash[1]))
-	err = bucket.Put(hash, uint64toBytes(p.ID))
+	qs.stats.apply(&sd)
+	graph.AfterCommit(in, horizon)
+	return nil
+}
+
+func (qs *QuadStore) indexNode(tx BucketTx, p *proto.Primitive, val quad.Value, n nodeSlot) error {
+	k := bucketKeyForSlot(n.Key())
+	err := tx.Bucket(k.Bucket).Put(k.Key, uint64toBytes(p.ID))
 	if err != nil {
 		return err
 	}
-	if iri, ok := val.(quad.IRI); ok {
+	if iri, ok := val.(quad.IRI); ok && n.N == 0 {
 		qs.valueLRU.Put(string(iri), p.ID)
 	}
 	return qs.addToLog(tx, p)
@@ -542,7 +656,6 @@ func (qs *QuadStore) indexLink(tx BucketTx, p *proto.Primitive) error {
 
 func (qs *QuadStore) markAsDead(tx BucketTx, p *proto.Primitive) error {
 	p.Deleted = true
-	//TODO(barakmich): Add tombstone?
 	qs.bloomRemove(p)
 	return qs.addToLog(tx, p)
 }
@@ -551,13 +664,28 @@ func (qs *QuadStore) delLog(tx BucketTx, id uint64) error {
 	return tx.Bucket(logIndex).Del(uint64KeyBytes(id))
 }
 
-func (qs *QuadStore) markLinksDead(ctx context.Context, tx BucketTx, links []proto.Primitive) error {
+// markLinksDead deletes quads and returns the horizon of the deletion.
+func (qs *QuadStore) markLinksDead(ctx context.Context, tx BucketTx, links []proto.Primitive) (uint64, error) {
+	var h uint64
+	if (qs.tombstones || qs.history) && len(links) != 0 {
+		// all quads in a batch are deleted at the same horizon; it's only
+		// allocated if it's recorded in tombstones or in the history
+		var err error
+		if h, err = qs.genIDs(ctx, tx, 1); err != nil {
+			return 0, err
+		}
+	}
 	for _, p := range links {
 		if err := qs.markAsDead(tx, &p); err != nil {
-			return err
+			return 0, err
+		}
+		if qs.tombstones {
+			if err := qs.addTombstone(tx, p.ID, h); err != nil {
+				return 0, err
+			}
 		}
 	}
-	return qs.incSize(ctx, tx, -int64(len(links)))
+	return h, qs.incSize(ctx, tx, -int64(len(links)))
 }
 
 func (qs *QuadStore) getBucketIndexes(ctx context.Context, tx BucketTx, keys []BucketKey) ([][]uint64, error) {
@@ -797,29 +925,11 @@ func (qs *QuadStore) resolveQuadValue(ctx context.Context, tx BucketTx, v quad.V
 	return out[0], nil
 }
 
-func bucketKeyForVal(v quad.Value) BucketKey {
-	hash := graph.HashOf(v)
-	return bucketKeyForHash(hash)
-}
-
-func bucketKeyForHash(h graph.ValueHash) BucketKey {
-	return BucketKey{
-		Bucket: bucketForVal(h[0], h[1]),
-		Key:    h[:],
-	}
-}
-
-func bucketKeyForHashRefs(h graph.ValueHash) BucketKey {
-	return BucketKey{
-		Bucket: bucketForValRefs(h[0], h[1]),
-		Key:    h[:],
-	}
-}
-
 func (qs *QuadStore) resolveQuadValues(ctx context.Context, tx BucketTx, vals []quad.Value) ([]uint64, error) {
 	out := make([]uint64, len(vals))
 	inds := make([]int, 0, len(vals))
-	keys := make([]BucketKey, 0, len(vals))
+	keys := make([][]byte, 0, len(vals))
+	lookup := make([]quad.Value, 0, len(vals))
 	for i, v := range vals {
 		if iri, ok := v.(quad.IRI); ok {
 			if x, ok := qs.valueLRU.Get(string(iri)); ok {
@@ -830,23 +940,21 @@ func (qs *QuadStore) resolveQuadValues(ctx context.Context, tx BucketTx, vals []
 			continue
 		}
 		inds = append(inds, i)
-		keys = append(keys, bucketKeyForVal(v))
+		lookup = append(lookup, v)
+		keys = append(keys, qs.hash.key(v, nil))
 	}
 	if len(keys) == 0 {
 		return out, nil
 	}
-	resp, err := tx.Get(ctx, keys)
+	nodes, err := qs.resolveNodes(ctx, tx, lookup, keys)
 	if err != nil {
 		return out, err
 	}
-	for i, b := range resp {
-		if len(b) == 0 {
-			continue
-		}
+	for i, n := range nodes {
 		ind := inds[i]
-		out[ind], _ = binary.Uvarint(b)
-		if iri, ok := vals[ind].(quad.IRI); ok && out[ind] != 0 {
-			qs.valueLRU.Put(string(iri), uint64(out[ind]))
+		out[ind] = n.ID
+		if iri, ok := vals[ind].(quad.IRI); ok && n.ID != 0 && n.N == 0 {
+			qs.valueLRU.Put(string(iri), n.ID)
 		}
 	}
 	return out, nil
@@ -869,6 +977,11 @@ func uint64KeyBytes(x uint64) []byte {
 }
 
 func (qs *QuadStore) getPrimitivesFromLog(ctx context.Context, tx BucketTx, keys []uint64) ([]*proto.Primitive, error) {
+	return qs.readPrimitivesFromLog(ctx, tx, keys, nil)
+}
+
+// readPrimitivesFromLog is the same as getPrimitivesFromLog, but also counts the reads in st, if it's set.
+func (qs *QuadStore) readPrimitivesFromLog(ctx context.Context, tx BucketTx, keys []uint64, st *graph.IOStats) ([]*proto.Primitive, error) {
 	b := tx.Bucket(logIndex)
 	bkeys := make([][]byte, len(keys))
 	for i, k := range keys {
@@ -881,6 +994,10 @@ func (qs *QuadStore) getPrimitivesFromLog(ctx context.Context, tx BucketTx, keys
 	out := make([]*proto.Primitive, len(keys))
 	var last error
 	for i, v := range vals {
+		if st != nil {
+			st.Reads++
+			st.Bytes += int64(len(v))
+		}
 		if v == nil {
 			continue
 		}
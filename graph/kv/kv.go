@@ -43,6 +43,31 @@ type KVIterator interface {
 	Val() []byte
 }
 
+// KVSeeker is an optional interface for KVIterator that can skip forward to a given key
+// without reading the keys before it. All backends order keys bytewise; keys returned
+// after the seek are still limited by the prefix of the scan.
+type KVSeeker interface {
+	KVIterator
+	// Seek positions the iterator at the first key that is greater than or equal to k.
+	// It returns false if there is no such key. The key must be greater than the key
+	// of the current entry: Seek cannot be used to move backward.
+	Seek(ctx context.Context, k []byte) bool
+}
+
+// Seek positions the iterator at the first key that is greater than or equal to k.
+// If the iterator does not implement KVSeeker, it calls Next until such key is found.
+func Seek(ctx context.Context, it KVIterator, k []byte) bool {
+	if s, ok := it.(KVSeeker); ok {
+		return s.Seek(ctx, k)
+	}
+	for it.Next(ctx) {
+		if bytes.Compare(it.Key(), k) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
 type BucketKey struct {
 	Bucket, Key []byte
 }
@@ -73,6 +98,25 @@ type FlatKV interface {
 	Tx(update bool) (FlatTx, error)
 }
 
+// SnapshotKV is an optional interface for databases that can provide a consistent
+// read-only view of their content.
+type SnapshotKV interface {
+	BucketKV
+	// CanSnapshot reports if the database can provide snapshots in its current configuration.
+	CanSnapshot() bool
+	// Snapshot returns a read-only database that is not affected by writes committed
+	// after the call. Closing the snapshot releases it, but does not close the database.
+	//
+	// It returns graph.ErrSnapshotNotSupported if CanSnapshot returns false.
+	Snapshot() (BucketKV, error)
+}
+
+// canSnapshot checks if the database can provide snapshots (see SnapshotKV).
+func canSnapshot(db BucketKV) bool {
+	s, ok := db.(SnapshotKV)
+	return ok && s.CanSnapshot()
+}
+
 func Update(ctx context.Context, kv BucketKV, update func(tx BucketTx) error) error {
 	tx, err := kv.Tx(true)
 	if err != nil {
@@ -219,6 +263,14 @@ type prefIter struct {
 func (it *prefIter) Key() []byte {
 	return bytes.TrimPrefix(it.KVIterator.Key(), it.trim)
 }
+
+// Seek implements KVSeeker.
+func (it *prefIter) Seek(ctx context.Context, k []byte) bool {
+	key := make([]byte, len(it.trim)+len(k))
+	copy(key, it.trim)
+	copy(key[len(it.trim):], k)
+	return Seek(ctx, it.KVIterator, key)
+}
 func (b *flatBucket) Scan(pref []byte) KVIterator {
 	pref = b.key(pref)
 	return &prefIter{KVIterator: b.tx.Scan(pref), trim: b.pref}
@@ -2,8 +2,14 @@ package kvtest
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphtest"
@@ -18,6 +24,7 @@ type DatabaseFunc func(t testing.TB) (kv.BucketKV, graph.Options, func())
 
 type Config struct {
 	AlwaysRunIntegration bool
+	NoRollback           bool // database does not roll back failed transactions
 }
 
 func (c Config) quadStore() *graphtest.Config {
@@ -64,6 +71,45 @@ func TestAll(t *testing.T, gen DatabaseFunc, conf *Config) {
 	t.Run("optimize", func(t *testing.T) {
 		testOptimize(t, gen, conf)
 	})
+	t.Run("tombstones", func(t *testing.T) {
+		testTombstones(t, gen, conf)
+	})
+	t.Run("compact", func(t *testing.T) {
+		testCompact(t, gen, conf)
+	})
+	t.Run("snapshot", func(t *testing.T) {
+		testSnapshot(t, gen, conf)
+	})
+	t.Run("history", func(t *testing.T) {
+		testHistory(t, gen, conf)
+	})
+	t.Run("features", func(t *testing.T) {
+		testFeatures(t, gen, conf)
+	})
+	t.Run("open", func(t *testing.T) {
+		testOpen(t, gen, conf)
+	})
+	t.Run("io stats", func(t *testing.T) {
+		testIOStats(t, gen, conf)
+	})
+	t.Run("seek keys", func(t *testing.T) {
+		testSeekKeys(t, gen, conf)
+	})
+	t.Run("seek", func(t *testing.T) {
+		testSeek(t, gen, conf)
+	})
+	t.Run("hash collisions", func(t *testing.T) {
+		testHashCollisions(t, gen, conf)
+	})
+	t.Run("commit hooks", func(t *testing.T) {
+		testCommitHooks(t, gen, conf)
+	})
+	t.Run("limit hint", func(t *testing.T) {
+		testLimitHint(t, gen, conf)
+	})
+	t.Run("write coalescing", func(t *testing.T) {
+		testWriteCoalescing(t, gen, conf)
+	})
 }
 
 func testOptimize(t *testing.T, gen DatabaseFunc, _ *Config) {
@@ -105,6 +151,430 @@ func testOptimize(t *testing.T, gen DatabaseFunc, _ *Config) {
 	}
 }
 
+func testIOStats(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	qs, opts, closer := NewQuadStore(t, gen)
+	defer closer()
+
+	testutil.MakeWriter(t, qs, opts, graphtest.MakeQuadSet()...)
+
+	// nodes that C follows
+	newIt := func() graph.Iterator {
+		fixed := iterator.NewFixed(qs.ValueOf(quad.Raw("C")))
+		lto := iterator.NewLinksTo(qs, fixed, quad.Subject)
+		return iterator.NewHasA(qs, lto, quad.Object)
+	}
+	it := newIt()
+	n := 0
+	for it.Next(ctx) {
+		n++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, 2, n)
+	st := graph.TotalIOStats(it)
+	require.True(t, st.Reads > 0, "expected backend reads: %+v", st)
+	require.True(t, st.Bytes > 0, "expected bytes to be counted: %+v", st)
+
+	// reads of iterators created by Contains are counted as well
+	it.Reset()
+	require.True(t, it.Contains(ctx, qs.ValueOf(quad.Raw("B"))))
+	st2 := graph.TotalIOStats(it)
+	require.True(t, st2.Reads > st.Reads, "expected more reads: %+v vs %+v", st2, st)
+	require.NoError(t, it.Close())
+	require.Equal(t, st2, graph.TotalIOStats(it), "stats should be kept after Close")
+
+	c := graph.Iterate(ctx, newIt()).UnOptimized()
+	_, err := c.All()
+	require.NoError(t, err)
+	require.Equal(t, st, c.IOStats())
+}
+
+// noSeek hides the KVSeeker implementation of the iterator.
+type noSeek struct {
+	kv.KVIterator
+}
+
+func testSeekKeys(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	db, _, closer := gen(t)
+	defer closer()
+	defer db.Close()
+
+	bucket := []byte("seek")
+	err := kv.Update(ctx, db, func(tx kv.BucketTx) error {
+		b := tx.Bucket(bucket)
+		for _, k := range []string{"a1", "a3", "a5", "b1", "b2"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	for _, seeker := range []bool{true, false} {
+		t.Run(fmt.Sprint("seeker=", seeker), func(t *testing.T) {
+			err := kv.View(db, func(tx kv.BucketTx) error {
+				scan := func() kv.KVIterator {
+					it := tx.Bucket(bucket).Scan([]byte("a"))
+					if !seeker {
+						it = noSeek{it}
+					}
+					return it
+				}
+				it := scan()
+				require.True(t, kv.Seek(ctx, it, []byte("a2")))
+				require.Equal(t, "a3", string(it.Key()))
+				require.Equal(t, "a3", string(it.Val()))
+				require.True(t, it.Next(ctx))
+				require.Equal(t, "a5", string(it.Key()))
+				require.False(t, it.Next(ctx))
+				require.NoError(t, it.Close())
+
+				// seek is limited by the prefix of the scan
+				it = scan()
+				require.True(t, kv.Seek(ctx, it, []byte("0")))
+				require.Equal(t, "a1", string(it.Key()))
+				require.False(t, kv.Seek(ctx, it, []byte("a6")))
+				require.NoError(t, it.Close())
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func testSeek(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	qs, opts, closer := NewQuadStore(t, gen)
+	defer closer()
+
+	const (
+		nodes = 30
+		preds = 3
+	)
+	rnd := rand.New(rand.NewSource(1))
+	seen := make(map[quad.Quad]struct{})
+	var quads []quad.Quad
+	for len(quads) < 300 {
+		q := quad.MakeRaw(
+			fmt.Sprint("n", rnd.Intn(nodes)),
+			fmt.Sprint("p", rnd.Intn(preds)),
+			fmt.Sprint("n", rnd.Intn(nodes)),
+			"",
+		)
+		if _, ok := seen[q]; ok {
+			continue
+		}
+		seen[q] = struct{}{}
+		quads = append(quads, q)
+	}
+	testutil.MakeWriter(t, qs, opts, quads...)
+
+	links := func(d quad.Direction, v string) graph.Iterator {
+		return iterator.NewLinksTo(qs, iterator.NewFixed(qs.ValueOf(quad.Raw(v))), d)
+	}
+	for i := 0; i < 20; i++ {
+		s, o := fmt.Sprint("n", rnd.Intn(nodes)), fmt.Sprint("n", rnd.Intn(nodes))
+		p := fmt.Sprint("p", rnd.Intn(preds))
+		for _, sub := range [][2]graph.Iterator{
+			{links(quad.Subject, s), links(quad.Object, o)},
+			{links(quad.Subject, s), links(quad.Predicate, p)},
+		} {
+			naive := iterator.NewAnd(qs, sub[0].Clone(), sub[1].Clone())
+			expect := graphtest.IteratedQuads(t, qs, naive)
+
+			it, _ := iterator.NewAnd(qs, sub[0], sub[1]).Optimize()
+			require.Equal(t, graph.ZigZag, it.Type(), "expected sorted index scans to be intersected by seeking: %v", it)
+			require.Equal(t, expect, graphtest.IteratedQuads(t, qs, it), "%v vs %v", it, naive)
+			it.Close()
+		}
+	}
+
+	// seeking to a quad returns the first quad with the same or a greater ID
+	it, _ := links(quad.Subject, "n0").Optimize()
+	defer it.Close()
+	sk, ok := it.(graph.Seekable)
+	require.True(t, ok, "expected index scan to be seekable: %T", it)
+	require.Equal(t, "kv", sk.SortOrder())
+	var (
+		all  []graph.Value
+		keys []uint64
+	)
+	for it.Next(ctx) {
+		all = append(all, it.Result())
+		keys = append(keys, sk.SortKey())
+	}
+	require.NoError(t, it.Err())
+	require.True(t, len(all) > 2)
+	it.Reset()
+	v, ok := iterator.SeekKey(ctx, sk, keys[2])
+	require.True(t, ok)
+	require.Equal(t, graph.ToKey(all[2]), graph.ToKey(v))
+	v, ok = iterator.SeekKey(ctx, sk, keys[1])
+	require.True(t, ok)
+	require.Equal(t, graph.ToKey(all[2]), graph.ToKey(v), "seek should not move backward")
+	require.True(t, it.Next(ctx))
+	if len(all) > 3 {
+		require.Equal(t, graph.ToKey(all[3]), graph.ToKey(it.Result()))
+	}
+}
+
+func testFeatures(t *testing.T, gen DatabaseFunc, conf *Config) {
+	var dbSnapshots bool
+	qs, _, closer := NewQuadStore(t, func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+		db, opt, closer := gen(t)
+		s, ok := db.(kv.SnapshotKV)
+		dbSnapshots = ok && s.CanSnapshot()
+		return db, opt, closer
+	})
+	f := graph.FeaturesOf(qs)
+	closer()
+	require.False(t, f.DeltaLog, "unexpected features: %+v", f)
+	require.Equal(t, dbSnapshots, f.Snapshots, "unexpected features: %+v", f)
+
+	// history and snapshots are only available with the options, check them as well
+	extra := graph.Options{"tombstones": true, "history": true}
+	graphtest.TestFeatures(t, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		qs, opts, closer := newStoreWith(t, gen, extra)
+		f := qs.Features()
+		require.True(t, f.DeltaLog && f.Snapshots, "unexpected features: %+v", f)
+		return qs, opts, closer
+	}, conf.quadStore())
+}
+
+func newTombstoneStore(t testing.TB, gen DatabaseFunc) (*kv.QuadStore, graph.Options, func()) {
+	return newStoreWith(t, gen, graph.Options{"tombstones": true})
+}
+
+// newStoreWith creates a quad store with additional options.
+func newStoreWith(t testing.TB, gen DatabaseFunc, extra graph.Options) (*kv.QuadStore, graph.Options, func()) {
+	qs, opts, closer := NewQuadStore(t, func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+		db, opt, closer := gen(t)
+		nopt := graph.Options{}
+		for k, v := range extra {
+			nopt[k] = v
+		}
+		for k, v := range opt {
+			nopt[k] = v
+		}
+		return db, nopt, closer
+	})
+	return qs.(*kv.QuadStore), opts, closer
+}
+
+func testTombstones(t *testing.T, gen DatabaseFunc, _ *Config) {
+	qs, opts, closer := newTombstoneStore(t, gen)
+	defer closer()
+
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	q2 := quad.MakeIRI("b", "follows", "c", "")
+	w := testutil.MakeWriter(t, qs, opts, q1, q2)
+	h1 := qs.Horizon().Int()
+
+	err := w.RemoveQuad(q1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), qs.Size())
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q2}, true)
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadIterator(quad.Subject, qs.ValueOf(quad.IRI("a"))), nil, true)
+	require.NotNil(t, qs.ValueOf(quad.IRI("a")), "nodes of deleted quads should be kept")
+
+	// old state is still available
+	old := qs.AsOf(h1)
+	defer old.Close()
+	graphtest.ExpectIteratedQuads(t, old, old.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+	graphtest.ExpectIteratedQuads(t, old, old.QuadIterator(quad.Subject, old.ValueOf(quad.IRI("a"))), []quad.Quad{q1}, true)
+	require.Equal(t, kv.ErrReadOnlyView, old.ApplyDeltas([]graph.Delta{{Quad: q1, Action: graph.Add}}, graph.IgnoreOpts{}))
+
+	h2 := qs.Horizon().Int()
+	require.True(t, h2 > h1, "delete should move the horizon")
+
+	// same quad can be added again
+	err = w.AddQuad(q1)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), qs.Size())
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+
+	deleted := qs.AsOf(h2)
+	defer deleted.Close()
+	graphtest.ExpectIteratedQuads(t, deleted, deleted.QuadsAllIterator(), []quad.Quad{q2}, true)
+	graphtest.ExpectIteratedQuads(t, deleted, deleted.QuadIterator(quad.Subject, deleted.ValueOf(quad.IRI("a"))), nil, true)
+	graphtest.ExpectIteratedQuads(t, old, old.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+
+	// and deleted again
+	err = w.RemoveQuad(q1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), qs.Size())
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q2}, true)
+}
+
+func testHistory(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	q2 := quad.MakeIRI("b", "follows", "c", "")
+
+	t.Run("disabled", func(t *testing.T) {
+		qs, _, closer := NewQuadStore(t, gen)
+		defer closer()
+		_, err := graph.QuadHistory(ctx, qs, q1)
+		require.Equal(t, graph.ErrHistoryNotSupported, err)
+	})
+
+	qs, opts, closer := newStoreWith(t, gen, graph.Options{"history": true})
+	defer closer()
+
+	w := testutil.MakeWriter(t, qs, opts)
+	err := graph.WriterWithActor(w, "alice").AddQuadSet([]quad.Quad{q1, q2})
+	require.NoError(t, err)
+	h1 := qs.Horizon().Int()
+
+	err = graph.WriterWithActor(w, "bob").RemoveQuad(q1)
+	require.NoError(t, err)
+
+	ts := time.Unix(100, 0)
+	err = qs.ApplyDeltas([]graph.Delta{
+		{Quad: q1, Action: graph.Add, Timestamp: ts, Actor: "data.nq"},
+	}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+
+	hist, err := graph.QuadHistory(ctx, qs, q1)
+	require.NoError(t, err)
+	require.Len(t, hist, 3)
+	for i, exp := range []struct {
+		act   graph.Procedure
+		actor string
+	}{
+		{graph.Add, "alice"}, {graph.Delete, "bob"}, {graph.Add, "data.nq"},
+	} {
+		d := hist[i]
+		require.Equal(t, q1, d.Quad)
+		require.Equal(t, exp.act, d.Action, "event %d", i)
+		require.Equal(t, exp.actor, d.Actor, "event %d", i)
+		require.False(t, d.Timestamp.IsZero(), "event %d", i)
+		if i > 0 {
+			require.True(t, d.ID.Int() > hist[i-1].ID.Int(), "events should be ordered")
+		}
+	}
+	require.True(t, ts.Equal(hist[2].Timestamp), "timestamp of the delta should be kept")
+	require.True(t, hist[2].ID.Int() <= qs.Horizon().Int())
+
+	hist, err = graph.QuadHistory(ctx, qs, q2)
+	require.NoError(t, err)
+	require.Len(t, hist, 1)
+	require.Equal(t, "alice", hist[0].Actor)
+
+	hist, err = graph.QuadHistory(ctx, qs, quad.MakeIRI("a", "follows", "c", ""))
+	require.NoError(t, err)
+	require.Empty(t, hist)
+
+	// views only see changes before the horizon
+	view := qs.AsOf(h1)
+	defer view.Close()
+	hist, err = graph.QuadHistory(ctx, view, q1)
+	require.NoError(t, err)
+	require.Len(t, hist, 1)
+	require.Equal(t, graph.Add, hist[0].Action)
+}
+
+func testSnapshot(t *testing.T, gen DatabaseFunc, _ *Config) {
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	q2 := quad.MakeIRI("b", "follows", "c", "")
+	q3 := quad.MakeIRI("c", "follows", "d", "")
+
+	check := func(t *testing.T, qs *kv.QuadStore, opts graph.Options) {
+		w := testutil.MakeWriter(t, qs, opts, q1, q2)
+		snap, err := qs.Snapshot()
+		require.NoError(t, err)
+		defer snap.Close()
+		require.NoError(t, w.RemoveQuad(q1))
+		require.NoError(t, w.AddQuad(q3))
+
+		graphtest.ExpectIteratedQuads(t, snap, snap.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q2, q3}, true)
+		require.True(t, snap.(graph.Horizoner).Horizon().Int() < qs.Horizon().Int())
+		require.Equal(t, graph.ErrReadOnly, snap.ApplyDeltas([]graph.Delta{{Quad: q3, Action: graph.Add}}, graph.IgnoreOpts{}))
+	}
+
+	// without tombstones, snapshots are only supported by some databases
+	gqs, opts, closer := NewQuadStore(t, gen)
+	defer closer()
+	qs := gqs.(*kv.QuadStore)
+	if qs.Features().Snapshots {
+		check(t, qs, opts)
+	} else {
+		_, err := qs.Snapshot()
+		require.Equal(t, graph.ErrSnapshotNotSupported, err)
+	}
+
+	qs, opts, closer2 := newTombstoneStore(t, gen)
+	defer closer2()
+	check(t, qs, opts)
+}
+
+func testCompact(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	qs, opts, closer := newTombstoneStore(t, gen)
+	defer closer()
+
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	q2 := quad.MakeIRI("b", "follows", "c", "")
+	q3 := quad.MakeIRI("d", "knows", "e", "")
+	w := testutil.MakeWriter(t, qs, opts, q1, q2, q3)
+	h1 := qs.Horizon().Int()
+
+	require.NoError(t, w.RemoveQuad(q3))
+	h2 := qs.Horizon().Int()
+	require.NoError(t, w.RemoveQuad(q1))
+	require.NoError(t, w.AddQuad(q1))
+	h3 := qs.Horizon().Int()
+	require.NoError(t, w.RemoveQuad(q2))
+
+	// only the first deletion is purged
+	err := qs.Compact(ctx, h2)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), qs.Size())
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q1}, true)
+	for _, name := range []string{"d", "knows", "e"} {
+		require.Nil(t, qs.ValueOf(quad.IRI(name)), "node %q should be removed", name)
+	}
+	old := qs.AsOf(h1)
+	graphtest.ExpectIteratedQuads(t, old, old.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+	require.NoError(t, old.Close())
+	view := qs.AsOf(h3)
+	graphtest.ExpectIteratedQuads(t, view, view.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+
+	// compaction waits for open views
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	err = qs.Compact(tctx, qs.Horizon().Int())
+	cancel()
+	require.Equal(t, context.DeadlineExceeded, err)
+	graphtest.ExpectIteratedQuads(t, view, view.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+
+	done := make(chan error, 1)
+	go func() {
+		// purge everything
+		done <- qs.Compact(ctx, qs.Horizon().Int())
+	}()
+	require.NoError(t, view.Close())
+	require.NoError(t, view.Close(), "closing a view twice should be safe")
+	require.NoError(t, <-done)
+	require.Equal(t, int64(1), qs.Size())
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q1}, true)
+	require.Nil(t, qs.ValueOf(quad.IRI("c")))
+	graphtest.ExpectIteratedValues(t, qs, qs.NodesAllIterator(), []quad.Value{
+		quad.IRI("a"), quad.IRI("b"), quad.IRI("follows"),
+	}, true)
+
+	// counters are still correct after compaction
+	require.NoError(t, w.RemoveQuad(q1))
+	require.Equal(t, int64(0), qs.Size())
+	require.NoError(t, qs.Compact(ctx, qs.Horizon().Int()))
+	require.Equal(t, int64(0), qs.Size())
+	graphtest.ExpectIteratedValues(t, qs, qs.NodesAllIterator(), nil, true)
+	require.NoError(t, w.AddQuad(q1))
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q1}, true)
+}
+
 func BenchmarkAll(t *testing.B, gen DatabaseFunc, conf *Config) {
 	if conf == nil {
 		conf = &Config{}
@@ -114,3 +584,366 @@ func BenchmarkAll(t *testing.B, gen DatabaseFunc, conf *Config) {
 		graphtest.BenchmarkAll(t, qsgen, conf.quadStore())
 	})
 }
+
+func testOpen(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	db, opt, closer := gen(t)
+	defer closer()
+
+	_, err := kv.New(db, opt)
+	require.Equal(t, graph.ErrNotInitialized, err)
+
+	require.NoError(t, kv.Init(db, opt))
+	require.Equal(t, graph.ErrDatabaseExists, kv.Init(db, opt))
+	_, err = kv.New(db, opt)
+	require.NoError(t, err)
+
+	setMeta := func(key string, val []byte) {
+		err := kv.Update(ctx, db, func(tx kv.BucketTx) error {
+			return tx.Bucket([]byte("meta")).Put([]byte(key), val)
+		})
+		require.NoError(t, err)
+	}
+
+	setMeta("backend", []byte("other"))
+	_, err = kv.New(db, opt)
+	require.Equal(t, &graph.ErrWrongBackend{Found: "other", Expected: db.Type()}, err)
+
+	setMeta("backend", []byte(db.Type()))
+	var vers [8]byte
+	binary.LittleEndian.PutUint64(vers[:], 1)
+	setMeta("version", vers[:])
+	_, err = kv.New(db, opt)
+	verr, ok := err.(*graph.ErrIncompatibleVersion)
+	require.True(t, ok, "unexpected error: %v", err)
+	require.Equal(t, int64(1), verr.Found)
+	require.NotEqual(t, verr.Found, verr.Expected)
+}
+
+// collidingIRIs returns two IRIs with the same first bytes of SHA1 hashes.
+func collidingIRIs(width int) (quad.IRI, quad.IRI) {
+	seen := make(map[string]quad.IRI)
+	for i := 0; ; i++ {
+		iri := quad.IRI(fmt.Sprintf("n%d", i))
+		h := graph.HashOf(iri)
+		k := string(h[:width])
+		if prev, ok := seen[k]; ok {
+			return prev, iri
+		}
+		seen[k] = iri
+	}
+}
+
+func testHashCollisions(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	// a tiny hash width forces the collision
+	a, b := collidingIRIs(2)
+	q1 := quad.MakeIRI(string(a), "follows", "x", "")
+	q2 := quad.MakeIRI(string(b), "follows", "y", "")
+
+	verify := func(qs *kv.QuadStore) []kv.HashCollision {
+		var out []kv.HashCollision
+		err := qs.VerifyHashes(ctx, func(c kv.HashCollision) error {
+			out = append(out, c)
+			return nil
+		})
+		require.NoError(t, err)
+		return out
+	}
+
+	t.Run("chain", func(t *testing.T) {
+		qs, opts, closer := newStoreWith(t, gen, graph.Options{"hash_width": 2, "hash_collisions": kv.CollisionsChain})
+		defer closer()
+		w := testutil.MakeWriter(t, qs, opts, q1, q2)
+
+		va, vb := qs.ValueOf(a), qs.ValueOf(b)
+		require.NotNil(t, va)
+		require.NotNil(t, vb)
+		require.NotEqual(t, va, vb, "colliding values should be different nodes")
+		require.Equal(t, a, qs.NameOf(va))
+		require.Equal(t, b, qs.NameOf(vb))
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadIterator(quad.Subject, va), []quad.Quad{q1}, true)
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadIterator(quad.Subject, vb), []quad.Quad{q2}, true)
+
+		found := verify(qs)
+		require.Len(t, found, 1)
+		require.True(t, found[0].Chained)
+		// which of the values is chained depends on the order of node creation
+		require.Contains(t, []quad.Value{a, b}, found[0].Value)
+
+		// removing the first value of the chain keeps the second one reachable
+		require.NoError(t, w.RemoveQuad(q1))
+		require.Nil(t, qs.ValueOf(a))
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadIterator(quad.Subject, qs.ValueOf(b)), []quad.Quad{q2}, true)
+
+		require.NoError(t, w.AddQuad(q1))
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadIterator(quad.Subject, qs.ValueOf(a)), []quad.Quad{q1}, true)
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadIterator(quad.Subject, qs.ValueOf(b)), []quad.Quad{q2}, true)
+
+		require.NoError(t, w.RemoveQuad(q2))
+		require.NoError(t, w.RemoveQuad(q1))
+		require.Nil(t, qs.ValueOf(a))
+		require.Nil(t, qs.ValueOf(b))
+		require.Empty(t, verify(qs))
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		// collisions are rejected by default for truncated hashes
+		qs, opts, closer := newStoreWith(t, gen, graph.Options{"hash_width": 2})
+		defer closer()
+		w := testutil.MakeWriter(t, qs, opts, q1)
+
+		err := w.AddQuad(q2)
+		cerr, ok := err.(*kv.ErrHashCollision)
+		require.True(t, ok, "unexpected error: %v", err)
+		require.Equal(t, quad.Value(b), cerr.Value)
+		require.Equal(t, quad.Value(a), cerr.Other)
+		require.Nil(t, qs.ValueOf(b))
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q1}, true)
+
+		// values of the same batch collide as well
+		require.NoError(t, w.RemoveQuad(q1))
+		err = w.AddQuadSet([]quad.Quad{q1, q2})
+		_, ok = err.(*kv.ErrHashCollision)
+		require.True(t, ok, "unexpected error: %v", err)
+		require.Equal(t, int64(0), qs.Size())
+		require.Empty(t, verify(qs))
+	})
+
+	t.Run("open", func(t *testing.T) {
+		db, opt, closer := gen(t)
+		defer closer()
+		nopt := graph.Options{"hash": kv.HashFNV, "hash_width": 2}
+		for k, v := range opt {
+			nopt[k] = v
+		}
+		require.NoError(t, kv.Init(db, nopt))
+
+		nopt["hash_width"] = 4
+		_, err := kv.New(db, nopt)
+		require.Error(t, err, "hash options cannot be changed")
+
+		_, err = kv.New(db, graph.Options{"hash": kv.HashSHA1})
+		require.Error(t, err, "hash options cannot be changed")
+
+		// options recorded by Init are used if none are set
+		gqs, err := kv.New(db, opt)
+		require.NoError(t, err)
+		qs := gqs.(*kv.QuadStore)
+		defer qs.Close()
+		testutil.MakeWriter(t, qs, opt, q1, q2)
+		graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), []quad.Quad{q1, q2}, true)
+		require.Empty(t, verify(qs))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, o := range []graph.Options{
+			{"hash": "md5"},
+			{"hash_width": 1},
+			{"hash_width": 21},
+			{"hash_collisions": "merge"},
+		} {
+			db, _, closer := gen(t)
+			require.Error(t, kv.Init(db, o), "%v", o)
+			db.Close()
+			closer()
+		}
+	})
+}
+
+func testCommitHooks(t *testing.T, gen DatabaseFunc, conf *Config) {
+	qs, opts, closer := NewQuadStore(t, gen)
+	defer closer()
+	w := testutil.MakeWriter(t, qs, opts)
+
+	var (
+		order    []string
+		horizons []int64
+	)
+	errHook := errors.New("hook failed")
+	defer graph.AddCommitHook(func(deltas []graph.Delta, h graph.PrimaryKey) error {
+		order = append(order, "hook")
+		horizons = append(horizons, h.Int())
+		if deltas[0].Quad.Predicate == quad.IRI("broken") {
+			return errHook
+		}
+		return nil
+	})()
+	defer graph.AddCriticalCommitHook(func(deltas []graph.Delta, h graph.PrimaryKey) error {
+		order = append(order, "critical")
+		for _, d := range deltas {
+			if d.Quad.Predicate == quad.IRI("forbidden") {
+				return errHook
+			}
+		}
+		return nil
+	})()
+
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	err := w.AddQuad(q1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"critical", "hook"}, order)
+	require.Equal(t, []int64{qs.(graph.Horizoner).Horizon().Int()}, horizons)
+
+	// critical hooks roll back the transaction
+	order = nil
+	err = w.AddQuadSet([]quad.Quad{
+		quad.MakeIRI("b", "follows", "c", ""),
+		quad.MakeIRI("c", "forbidden", "d", ""),
+	})
+	require.Equal(t, errHook, err)
+	require.Equal(t, []string{"critical"}, order)
+	if !conf.NoRollback {
+		require.Equal(t, int64(1), qs.Size())
+		require.Nil(t, qs.ValueOf(quad.IRI("c")))
+	}
+
+	// other hooks are only counted
+	order = nil
+	n := graph.CommitHookErrors()
+	err = w.AddQuad(quad.MakeIRI("b", "broken", "c", ""))
+	require.NoError(t, err)
+	require.Equal(t, []string{"critical", "hook"}, order)
+	require.Equal(t, n+1, graph.CommitHookErrors())
+	require.NotNil(t, qs.ValueOf(quad.IRI("broken")))
+}
+
+func testLimitHint(t *testing.T, gen DatabaseFunc, _ *Config) {
+	ctx := context.TODO()
+	qs, opts, closer := NewQuadStore(t, gen)
+	defer closer()
+
+	const n = 150
+	var quads []quad.Quad
+	for i := 0; i < n; i++ {
+		quads = append(quads, quad.MakeIRI(fmt.Sprintf("n%d", i), "follows", "b", ""))
+	}
+	testutil.MakeWriter(t, qs, opts, quads...)
+
+	scan := func() graph.Iterator {
+		return qs.QuadIterator(quad.Object, qs.ValueOf(quad.IRI("b")))
+	}
+	count := func(it graph.Iterator) (int, graph.IOStats) {
+		cnt := 0
+		for it.Next(ctx) {
+			cnt++
+		}
+		require.NoError(t, it.Err())
+		st := graph.TotalIOStats(it)
+		it.Close()
+		return cnt, st
+	}
+
+	it := iterator.NewLimit(scan(), 5)
+	nit, _ := it.Optimize()
+	cnt, limited := count(nit)
+	require.Equal(t, 5, cnt)
+
+	cnt, full := count(iterator.NewLimit(scan(), 5))
+	require.Equal(t, 5, cnt)
+	require.True(t, limited.Reads < full.Reads, "expected the scan to stop early: %d vs %d", limited.Reads, full.Reads)
+	require.True(t, limited.Reads <= 10, "expected the scan to stop early: %d", limited.Reads)
+
+	// the hint must not drop results
+	sc := scan()
+	sc.(graph.LimitHinter).SetLimitHint(5)
+	cnt, _ = count(sc)
+	require.Equal(t, n, cnt)
+}
+
+func testWriteCoalescing(t *testing.T, gen DatabaseFunc, conf *Config) {
+	if conf.NoRollback {
+		t.Skip("failed writes are retried one by one, which requires a rollback")
+	}
+	qs, _, closer := newStoreWith(t, gen, graph.Options{"write_coalesce_ms": 2})
+	defer closer()
+
+	const n = 30
+	shared := quad.MakeIRI("a", "follows", "b", "")
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		added, del int
+		errs       []error
+	)
+	apply := func(q quad.Quad, act graph.Procedure) error {
+		return qs.ApplyDeltas([]graph.Delta{{Quad: q, Action: act}}, graph.IgnoreOpts{})
+	}
+	// two writers add and remove the same quad, only one of them can succeed at a time
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				err := apply(shared, graph.Add)
+				mu.Lock()
+				if err == nil {
+					added++
+				} else if !graph.IsQuadExist(err) {
+					errs = append(errs, err)
+				}
+				mu.Unlock()
+				err = apply(shared, graph.Delete)
+				mu.Lock()
+				if err == nil {
+					del++
+				} else if !graph.IsQuadNotExist(err) {
+					errs = append(errs, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	// other writers change unrelated quads, so the writes are committed together
+	var expect []quad.Quad
+	for w := 0; w < 4; w++ {
+		var quads []quad.Quad
+		for i := 0; i < n; i++ {
+			quads = append(quads, quad.MakeIRI(fmt.Sprintf("w%d", w), "follows", fmt.Sprintf("n%d", i), ""))
+		}
+		expect = append(expect, quads...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, q := range quads {
+				if err := apply(q, graph.Add); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Empty(t, errs)
+	require.True(t, added > 0 && (added == del || added == del+1), "unexpected writes: %d added, %d deleted", added, del)
+	if added > del {
+		expect = append(expect, shared)
+	}
+	require.Equal(t, int64(len(expect)), qs.Size())
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), expect, true)
+	if added == del {
+		require.Nil(t, qs.ValueOf(quad.IRI("b")), "node of the removed quad should be deleted")
+	}
+
+	// a failed write doesn't affect other writes committed with it
+	errc := make(chan error, 2)
+	for _, d := range []graph.Delta{
+		{Quad: expect[0], Action: graph.Add},
+		{Quad: quad.MakeIRI("c", "follows", "d", ""), Action: graph.Add},
+	} {
+		go func(d graph.Delta) {
+			errc <- qs.ApplyDeltas([]graph.Delta{d}, graph.IgnoreOpts{})
+		}(d)
+	}
+	var failed int
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			require.True(t, graph.IsQuadExist(err), "unexpected error: %v", err)
+			failed++
+		}
+	}
+	require.Equal(t, 1, failed)
+	require.NotNil(t, qs.ValueOf(quad.IRI("d")))
+}
@@ -67,6 +67,10 @@ func Create(path string, m graph.Options) (kv.BucketKV, error) {
 }
 
 func Open(path string, m graph.Options) (kv.BucketKV, error) {
+	// leveldb creates the directory if there is none
+	if err := kv.CheckDir(path, "CURRENT", Type); err != nil {
+		return nil, err
+	}
 	db, err := leveldb.OpenFile(path, &opt.Options{
 		ErrorIfMissing: true,
 	})
@@ -170,6 +174,8 @@ func (tx *Tx) Scan(pref []byte) kv.KVIterator {
 	return &Iterator{it: it, first: true}
 }
 
+var _ kv.KVSeeker = (*Iterator)(nil)
+
 type Iterator struct {
 	it    iterator.Iterator
 	first bool
@@ -182,6 +188,12 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	}
 	return it.it.Next()
 }
+
+// Seek implements kv.KVSeeker.
+func (it *Iterator) Seek(ctx context.Context, k []byte) bool {
+	it.first = false
+	return it.it.Seek(k)
+}
 func (it *Iterator) Key() []byte { return it.it.Key() }
 func (it *Iterator) Val() []byte { return it.it.Value() }
 func (it *Iterator) Err() error {
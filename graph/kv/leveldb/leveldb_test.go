@@ -15,13 +15,18 @@
 package leveldb
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/kv"
 	"github.com/cayleygraph/cayley/graph/kv/kvtest"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
 )
 
 func makeLeveldb(t testing.TB) (kv.BucketKV, graph.Options, func()) {
@@ -44,6 +49,64 @@ func TestLeveldb(t *testing.T) {
 	kvtest.TestAll(t, makeLeveldb, nil)
 }
 
+func TestLeveldbOpenDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test_"+Type)
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	_, err = graph.NewQuadStore(Type, filepath.Join(tmpDir, "missing"), nil)
+	require.Equal(t, graph.ErrNotInitialized, err)
+	_, err = graph.NewQuadStore(Type, tmpDir, nil)
+	require.Equal(t, graph.ErrNotInitialized, err)
+	entries, err := ioutil.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "database should not be created on open")
+
+	other := filepath.Join(tmpDir, "other")
+	require.NoError(t, os.Mkdir(other, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(other, "data"), []byte("data"), 0600))
+	_, err = graph.NewQuadStore(Type, other, nil)
+	require.Equal(t, &graph.ErrWrongBackend{Expected: Type}, err)
+
+	require.NoError(t, graph.InitQuadStore(Type, tmpDir, nil))
+	qs, err := graph.NewQuadStore(Type, tmpDir, nil)
+	require.NoError(t, err)
+	require.NoError(t, qs.Close())
+}
+
 func BenchmarkLeveldb(b *testing.B) {
 	kvtest.BenchmarkAll(b, makeLeveldb, nil)
 }
+
+func BenchmarkLeveldbWriteCoalescing(b *testing.B) {
+	for _, c := range []struct {
+		name string
+		opts graph.Options
+	}{
+		{"direct", nil},
+		{"coalesced", graph.Options{"write_coalesce_ms": 5}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			db, _, closer := makeLeveldb(b)
+			defer closer()
+			require.NoError(b, kv.Init(db, c.opts))
+			qs, err := kv.New(db, c.opts)
+			require.NoError(b, err)
+			defer qs.Close()
+
+			var n int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := atomic.AddInt64(&n, 1)
+					q := quad.MakeIRI(fmt.Sprintf("n%d", i), "follows", fmt.Sprintf("n%d", i+1), "")
+					err := qs.ApplyDeltas([]graph.Delta{{Quad: q, Action: graph.Add}}, graph.IgnoreOpts{})
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
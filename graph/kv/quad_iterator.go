@@ -17,10 +17,12 @@ package kv
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/graph/proto"
+	"github.com/cayleygraph/cayley/quad"
 )
 
 type QuadIterator struct {
@@ -42,9 +44,16 @@ type QuadIterator struct {
 	ids  []uint64
 	buf  []*proto.Primitive
 	prim *proto.Primitive
+	io   graph.IOStats
+
+	limit int64 // see SetLimitHint
+	batch int
 }
 
-var _ graph.Iterator = &QuadIterator{}
+var (
+	_ graph.Iterator    = &QuadIterator{}
+	_ graph.LimitHinter = &QuadIterator{}
+)
 
 func NewQuadIterator(qs *QuadStore, ind QuadIndex, vals []uint64) *QuadIterator {
 	return &QuadIterator{
@@ -66,12 +75,20 @@ func (it *QuadIterator) Reset() {
 	it.ids = nil
 	it.buf = nil
 	it.done = false
+	it.batch = 0
 	if it.it != nil {
 		it.it.Close()
 		it.it = it.b.Scan(it.ind.Key(it.vals))
 	}
 }
 
+// SetLimitHint implements graph.LimitHinter. The first batch of quads read from the
+// log is reduced to the limit.
+func (it *QuadIterator) SetLimitHint(n int64) {
+	it.limit = n
+	it.batch = 0
+}
+
 func (it *QuadIterator) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -103,6 +120,13 @@ func (it *QuadIterator) Close() error {
 	return it.err
 }
 
+var _ graph.IOStater = &QuadIterator{}
+
+// IOStats implements graph.IOStater. It counts index keys and quads read from the log.
+func (it *QuadIterator) IOStats() graph.IOStats {
+	return it.io
+}
+
 func (it *QuadIterator) Err() error {
 	return it.err
 }
@@ -152,16 +176,19 @@ func (it *QuadIterator) Next(ctx context.Context) bool {
 					it.done = true
 					return false
 				}
+				it.io.Reads++
+				it.io.Bytes += int64(len(it.it.Key()) + len(it.it.Val()))
 				it.ids, it.err = decodeIndex(it.it.Val())
 				if it.err != nil {
 					return false
 				}
 			}
 			ids := it.ids[it.off:]
-			if len(ids) > nextBatch {
-				ids = ids[:nextBatch]
+			it.batch = batchSize(it.batch, it.limit)
+			if len(ids) > it.batch {
+				ids = ids[:it.batch]
 			}
-			it.buf, it.err = it.qs.getPrimitivesFromLog(ctx, it.tx, ids)
+			it.buf, it.err = it.qs.readPrimitivesFromLog(ctx, it.tx, ids, &it.io)
 			if it.err != nil {
 				return false
 			}
@@ -170,7 +197,10 @@ func (it *QuadIterator) Next(ctx context.Context) bool {
 		}
 		for ; len(it.buf) > 0; it.buf, it.off = it.buf[1:], it.off+1 {
 			p := it.buf[0]
-			if p == nil || p.Deleted {
+			if ok, err := it.qs.visible(ctx, it.tx, p); err != nil {
+				it.err = err
+				return false
+			} else if !ok {
 				continue
 			}
 			it.prim = p
@@ -179,6 +209,40 @@ func (it *QuadIterator) Next(ctx context.Context) bool {
 	}
 }
 
+var _ graph.Seekable = &QuadIterator{}
+
+// SortOrder implements graph.Seekable. Quads are sorted by their IDs only if
+// values for all directions of the index are set, since there is a single list
+// of quads for this key. IDs are assigned in the order of insertion, thus the
+// order is shared with quads returned by AllIterator.
+func (it *QuadIterator) SortOrder() string {
+	if len(it.vals) != len(it.ind.Dirs) {
+		return ""
+	}
+	return "kv"
+}
+
+// SortKey implements graph.Seekable.
+func (it *QuadIterator) SortKey() uint64 {
+	if it.prim == nil {
+		return 0
+	}
+	return it.prim.ID
+}
+
+// NextGE implements graph.Seekable.
+func (it *QuadIterator) NextGE(ctx context.Context, k uint64) bool {
+	if it.err != nil || it.done || it.it == nil || len(it.buf) == 0 {
+		return it.Next(ctx)
+	}
+	// skip all the quads with smaller IDs; the current one is one of them
+	ids := it.ids[it.off:]
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= k })
+	it.off += i
+	it.buf = nil
+	return it.Next(ctx)
+}
+
 func (it *QuadIterator) NextPath(ctx context.Context) bool {
 	return false
 }
@@ -228,7 +292,7 @@ func (it *QuadIterator) Size() (int64, bool) {
 		it.size = int64(len(ids))
 		return it.size, true
 	}
-	return 1 + it.qs.Size()/2, false
+	return 1 + it.qs.estimateSize()/2, false
 }
 
 func (it *QuadIterator) String() string {
@@ -238,6 +302,26 @@ func (it *QuadIterator) String() string {
 func (it *QuadIterator) Type() graph.Type { return "kv_quad" }
 func (it *QuadIterator) Sorted() bool     { return true }
 
+// Describe returns a description of the index scan as a LinksTo of a single node
+// for each direction of the index prefix.
+func (it *QuadIterator) Describe() graph.Description {
+	links := make([]graph.Description, 0, len(it.vals))
+	for i, v := range it.vals {
+		links = append(links, linksToDescription(it.ind.Dirs[i], Int64Value(v)))
+	}
+	if len(links) == 1 {
+		return links[0]
+	}
+	return graph.Description{Type: graph.And, Iterators: links}
+}
+
+func linksToDescription(d quad.Direction, v graph.Value) graph.Description {
+	return graph.Description{
+		Type: graph.LinksTo, Direction: d,
+		Iterators: []graph.Description{{Type: graph.Fixed, Refs: []graph.Value{v}}},
+	}
+}
+
 func (it *QuadIterator) Optimize() (graph.Iterator, bool) {
 	return it, false
 }
@@ -17,9 +17,13 @@ package kv
 import (
 	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
@@ -72,6 +76,33 @@ func Register(name string, r Registration) {
 	})
 }
 
+// CheckDir checks that the directory contains a database of the backend, identified by
+// a given file name. It returns graph.ErrNotInitialized if the directory is missing or
+// empty, and graph.ErrWrongBackend if it contains other files.
+//
+// Persistent backends should call it before opening the database, since most of them
+// silently create a new database if there is none.
+func CheckDir(dir, file, backend string) error {
+	if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return graph.ErrNotInitialized
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Readdirnames(1); err == io.EOF {
+		return graph.ErrNotInitialized
+	} else if err != nil {
+		return err
+	}
+	return &graph.ErrWrongBackend{Expected: backend}
+}
+
 const (
 	latestDataVersion = 2
 	nilDataVersion    = 1
@@ -91,18 +122,43 @@ type QuadStore struct {
 
 	valueLRU *lru.Cache
 
+	// hash describes how keys of nodes are derived from their values.
+	hash hashConfig
+
+	// tombstones enables soft deletes: deleted quads are kept until compaction.
+	tombstones bool
+	// history enables recording of all changes of quads, with their metadata.
+	history bool
+	// view is set for read-only historical views of the store at asOf horizon.
+	view bool
+	asOf int64
+	// views tracks open historical views; it's shared by the store and its views.
+	views *viewSet
+	// released is set once the view is closed.
+	released int32
+	// dbSnapshot is set if the view reads from a snapshot of the database, which is
+	// closed with the view (see Snapshot).
+	dbSnapshot bool
+
 	writer    sync.Mutex
 	mapBucket map[string]map[string][]uint64
+	// coalesce groups concurrent writes into a single transaction, if enabled.
+	coalesce *coalescer
+	// stats of the quad store used by the optimizer; shared with views (see stats.go).
+	stats *stats
 
-	exists struct {
-		sync.Mutex
-		buf []byte
-		*boom.DeletableBloomFilter
-	}
+	exists *existsFilter
+}
+
+// existsFilter is a bloom filter used to detect duplicate quads.
+type existsFilter struct {
+	sync.Mutex
+	buf []byte
+	*boom.DeletableBloomFilter
 }
 
 func newQuadStore(kv BucketKV) *QuadStore {
-	qs := &QuadStore{db: kv}
+	qs := &QuadStore{db: kv, hash: legacyHash, exists: &existsFilter{}, views: &viewSet{}}
 	qs.indexes.all = DefaultQuadIndexes
 	return qs
 }
@@ -119,39 +175,115 @@ func Init(kv BucketKV, opt graph.Options) error {
 	if err != nil {
 		return err
 	}
-	if err := qs.createBuckets(ctx, upfront); err != nil {
+	hash, err := newHashConfig(opt)
+	if err != nil {
 		return err
 	}
-	if err := setVersion(ctx, qs.db, latestDataVersion); err != nil {
+	if err := qs.createBuckets(ctx, upfront); err != nil {
 		return err
 	}
-	return nil
+	// Metadata is written last, in a single transaction. If initialization fails before
+	// that, the database is still reported as not initialized and can be initialized again.
+	return writeMetadata(ctx, qs.db, metadata{
+		Version: latestDataVersion,
+		Backend: kv.Type(),
+		Created: time.Now(),
+		Hash:    hash,
+	})
 }
 
-func New(kv BucketKV, _ graph.Options) (graph.QuadStore, error) {
+func New(kv BucketKV, opt graph.Options) (graph.QuadStore, error) {
 	ctx := context.TODO()
 	qs := newQuadStore(kv)
-	if vers, err := qs.getMetadata(ctx); err == ErrNoBucket {
+	tombstones, err := opt.BoolKey("tombstones", false)
+	if err != nil {
+		return nil, err
+	}
+	qs.tombstones = tombstones
+	history, err := opt.BoolKey("history", false)
+	if err != nil {
+		return nil, err
+	}
+	qs.history = history
+	if meta, err := qs.getMetadata(ctx); err == ErrNoBucket {
 		return nil, graph.ErrNotInitialized
 	} else if err != nil {
 		return nil, err
-	} else if vers != latestDataVersion {
-		return nil, errors.New("kv: data version is out of date. Run cayleyupgrade for your config to update the data.")
+	} else if err = meta.check(kv.Type()); err != nil {
+		return nil, err
+	} else if err = meta.Hash.checkOptions(opt); err != nil {
+		return nil, err
+	} else {
+		qs.hash = meta.Hash
 	}
 	qs.valueLRU = lru.New(2000)
 	if err := qs.initBloomFilter(ctx); err != nil {
 		return nil, err
 	}
+	if qs.coalesce, err = newCoalescerFromOptions(opt, qs.applyDeltas); err != nil {
+		return nil, err
+	}
+	sconf, err := statsConfigFromOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err = qs.loadStats(ctx, sconf); err != nil {
+		return nil, err
+	}
 	return qs, nil
 }
 
-func setVersion(ctx context.Context, kv BucketKV, version int64) error {
+// Keys of the metadata record in the meta bucket.
+const (
+	metaVersion = "version"
+	metaBackend = "backend"
+	metaCreated = "created"
+	// hash options are stored under the names of the options
+	metaHash       = optHash
+	metaHashWidth  = optHashWidth
+	metaCollisions = optCollisions
+)
+
+// metadata describes the database. It's written by Init and verified when the database is opened.
+type metadata struct {
+	Version int64
+	Backend string // empty for databases created before the backend was recorded
+	Created time.Time
+	Hash    hashConfig // legacyHash for databases created before hashing was configurable
+}
+
+// check returns an error if the database cannot be opened by a given backend.
+func (m metadata) check(backend string) error {
+	if m.Backend != "" && m.Backend != backend {
+		return &graph.ErrWrongBackend{Found: m.Backend, Expected: backend}
+	}
+	if m.Version != latestDataVersion {
+		return &graph.ErrIncompatibleVersion{Found: m.Version, Expected: latestDataVersion}
+	}
+	return nil
+}
+
+func writeMetadata(ctx context.Context, kv BucketKV, m metadata) error {
 	return Update(ctx, kv, func(tx BucketTx) error {
-		var buf [8]byte
-		binary.LittleEndian.PutUint64(buf[:], uint64(version))
+		var vers, created, width [8]byte
+		binary.LittleEndian.PutUint64(vers[:], uint64(m.Version))
+		binary.LittleEndian.PutUint64(created[:], uint64(m.Created.UnixNano()))
+		binary.LittleEndian.PutUint64(width[:], uint64(m.Hash.Width))
 		b := tx.Bucket(metaBucket)
-		if err := b.Put([]byte("version"), buf[:]); err != nil {
-			return fmt.Errorf("couldn't write version: %v", err)
+		for _, f := range []struct {
+			key string
+			val []byte
+		}{
+			{metaVersion, vers[:]},
+			{metaBackend, []byte(m.Backend)},
+			{metaCreated, created[:]},
+			{metaHash, []byte(m.Hash.Func)},
+			{metaHashWidth, width[:]},
+			{metaCollisions, []byte(m.Hash.Collisions)},
+		} {
+			if err := b.Put([]byte(f.key), f.val); err != nil {
+				return fmt.Errorf("couldn't write %s: %v", f.key, err)
+			}
 		}
 		return nil
 	})
@@ -185,16 +317,38 @@ func (qs *QuadStore) Size() int64 {
 }
 
 func (qs *QuadStore) Close() error {
+	if qs.view {
+		// historical views share the database with the store
+		if atomic.CompareAndSwapInt32(&qs.released, 0, 1) {
+			qs.views.release()
+			if qs.dbSnapshot {
+				return qs.db.Close()
+			}
+		}
+		return nil
+	}
+	if qs.coalesce != nil {
+		// commit pending writes first
+		qs.coalesce.Close()
+	}
+	if err := qs.closeStats(); err != nil {
+		clog.Errorf("kv: cannot save statistics: %v", err)
+	}
 	return qs.db.Close()
 }
 
-func (qs *QuadStore) getMetadata(ctx context.Context) (int64, error) {
-	var vers int64
+func (qs *QuadStore) getMetadata(ctx context.Context) (metadata, error) {
+	var m metadata
 	err := View(qs.db, func(tx BucketTx) error {
 		b := tx.Bucket(metaBucket)
 		var err error
 		vals, err := b.Get(ctx, [][]byte{
-			[]byte("version"),
+			[]byte(metaVersion),
+			[]byte(metaBackend),
+			[]byte(metaCreated),
+			[]byte(metaHash),
+			[]byte(metaHashWidth),
+			[]byte(metaCollisions),
 		})
 		if err == ErrNotFound {
 			return ErrNoBucket
@@ -203,13 +357,29 @@ func (qs *QuadStore) getMetadata(ctx context.Context) (int64, error) {
 		} else if vals[0] == nil {
 			return ErrNoBucket
 		}
-		vers, err = asInt64(vals[0], nilDataVersion)
+		m.Version, err = asInt64(vals[0], nilDataVersion)
 		if err != nil {
-			return err
+			return fmt.Errorf("kv: corrupted metadata: %v", err)
+		}
+		m.Backend = string(vals[1])
+		if vals[2] != nil {
+			created, err := asInt64(vals[2], 0)
+			if err != nil {
+				return fmt.Errorf("kv: corrupted metadata: %v", err)
+			}
+			m.Created = time.Unix(0, created)
+		}
+		m.Hash = legacyHash
+		if vals[3] != nil {
+			width, err := asInt64(vals[4], 0)
+			if err != nil {
+				return fmt.Errorf("kv: corrupted metadata: %v", err)
+			}
+			m.Hash = hashConfig{Func: string(vals[3]), Width: int(width), Collisions: string(vals[5])}
 		}
 		return nil
 	})
-	return vers, err
+	return m, err
 }
 
 func asInt64(b []byte, empty int64) (int64, error) {
@@ -222,8 +392,34 @@ func asInt64(b []byte, empty int64) (int64, error) {
 	return v, nil
 }
 
+var _ graph.FeatureReporter = (*QuadStore)(nil)
+
+// Features implements graph.FeatureReporter. Snapshots depend on the database or on
+// the tombstone mode, the history of changes is only kept with the history option, and
+// the label lookups are served by an index only if it was configured for the database.
+func (qs *QuadStore) Features() graph.Features {
+	f := graph.Features{
+		Ordered:    true,
+		Seek:       true,
+		BulkLookup: true,
+		DeltaLog:   qs.history,
+		Snapshots:  qs.tombstones || canSnapshot(qs.db),
+	}
+	qs.indexes.RLock()
+	for _, ind := range qs.indexes.all {
+		if len(ind.Dirs) == 1 && ind.Dirs[0] == quad.Label {
+			f.LabelIndex = true
+		}
+	}
+	qs.indexes.RUnlock()
+	return f
+}
+
 func (qs *QuadStore) horizon(ctx context.Context) int64 {
 	h, _ := qs.getMetaInt(ctx, "horizon")
+	if qs.view && qs.asOf < h {
+		return qs.asOf
+	}
 	return h
 }
 
@@ -383,12 +579,17 @@ func (qs *QuadStore) QuadDirection(val graph.Value, d quad.Direction) graph.Valu
 }
 
 func (qs *QuadStore) getPrimitives(ctx context.Context, vals []uint64) ([]*proto.Primitive, error) {
+	return qs.readPrimitives(ctx, vals, nil)
+}
+
+// readPrimitives is the same as getPrimitives, but also counts the reads in st, if it's set.
+func (qs *QuadStore) readPrimitives(ctx context.Context, vals []uint64, st *graph.IOStats) ([]*proto.Primitive, error) {
 	tx, err := qs.db.Tx(false)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
-	return qs.getPrimitivesFromLog(ctx, tx, vals)
+	return qs.readPrimitivesFromLog(ctx, tx, vals, st)
 }
 
 type Int64Value uint64
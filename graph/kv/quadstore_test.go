@@ -58,8 +58,18 @@ const (
 )
 
 var (
-	kVers = []byte("version")
-	vVers = le(2)
+	kVers    = []byte("version")
+	vVers    = le(2)
+	kBackend = []byte("backend")
+	vBackend = []byte(btree.Type)
+	kCreated = []byte("created")
+	kHash    = []byte("hash")
+	vHash    = []byte("sha1")
+	kWidth   = []byte("hash_width")
+	vWidth   = le(20)
+	kColl    = []byte("hash_collisions")
+	vColl    = []byte("ignore")
+	kStats   = []byte("stats")
 
 	vAuto = []byte("auto")
 )
@@ -118,6 +128,11 @@ func TestApplyDeltas(t *testing.T) {
 
 	expect(Ops{
 		{opPut, bMeta, kVers, vVers, nil},
+		{opPut, bMeta, kBackend, vBackend, nil},
+		{opPut, bMeta, kCreated, vAuto, nil},
+		{opPut, bMeta, kHash, vHash, nil},
+		{opPut, bMeta, kWidth, vWidth, nil},
+		{opPut, bMeta, kColl, vColl, nil},
 	})
 
 	qs, err := kv.New(hook, nil)
@@ -126,6 +141,14 @@ func TestApplyDeltas(t *testing.T) {
 
 	expect(Ops{
 		{opGet, bMeta, kVers, vVers, nil},
+		{opGet, bMeta, kBackend, vBackend, nil},
+		{opGet, bMeta, kCreated, vAuto, nil},
+		{opGet, bMeta, kHash, vHash, nil},
+		{opGet, bMeta, kWidth, vWidth, nil},
+		{opGet, bMeta, kColl, vColl, nil},
+		{opGet, bMeta, kStats, nil, nil},
+		{opGet, bMeta, []byte("size"), nil, nil},
+		{opGet, bMeta, []byte("horizon"), nil, nil},
 	})
 
 	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
@@ -163,6 +186,8 @@ func TestApplyDeltas(t *testing.T) {
 		{opPut, "o", be(3), hex("04"), nil},
 		{opGet, "s", be(1), nil, nil},
 		{opPut, "s", be(1), hex("04"), nil},
+		// horizon for commit hooks
+		{opGet, bMeta, []byte("horizon"), le(4), nil},
 	})
 
 	err = qw.AddQuad(quad.MakeIRI("a", "b", "e", ""))
@@ -194,6 +219,7 @@ func TestApplyDeltas(t *testing.T) {
 		{opPut, "o", be(5), hex("06"), nil},
 		{opGet, "s", be(1), hex("04"), nil},
 		{opPut, "s", be(1), hex("0406"), nil},
+		{opGet, bMeta, []byte("horizon"), le(6), nil},
 	})
 
 	err = qw.RemoveQuad(quad.MakeIRI("a", "b", "c", ""))
@@ -212,6 +238,7 @@ func TestApplyDeltas(t *testing.T) {
 		{opDel, iric("c"), irih("c"), nil, nil},
 		{opDel, irib("c"), irih("c"), nil, nil},
 		{opDel, bLog, be(3), nil, nil},
+		{opGet, bMeta, []byte("horizon"), le(6), nil},
 	})
 	require.NoError(t, err)
 }
@@ -0,0 +1,520 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/proto"
+)
+
+// Statistics of the quad store (the number of nodes and quads, and the number of
+// quads for each predicate) are kept in memory and updated incrementally after each
+// commit. A snapshot of them is persisted in the meta bucket periodically and when
+// the store is closed, thus they are available right after the database is opened.
+//
+// Incremental updates are lost if the process crashes, and the snapshot only keeps
+// the most used predicates. A background refresher re-estimates statistics from a
+// sample of the log when they drift too far from the last estimate.
+
+const (
+	optStatsRefresh = "stats_refresh_ms"
+	optStatsDrift   = "stats_drift_pct"
+	optStatsSample  = "stats_sample"
+	optStatsTop     = "stats_top"
+
+	defaultStatsRefresh = 60 * 1000
+	defaultStatsDrift   = 10
+	defaultStatsSample  = 1000
+	defaultStatsTop     = 32
+
+	metaStats = "stats"
+	metaSize  = "size"
+
+	// statsBatch is the number of log entries read at once when sampling.
+	statsBatch = 100
+)
+
+var _ graph.StatisticsReporter = (*QuadStore)(nil)
+
+type statsConfig struct {
+	refresh time.Duration // zero disables the refresher
+	drift   float64       // fraction of changed quads that makes statistics stale
+	sample  int           // number of log entries to read for an estimate
+	top     int           // number of predicates to persist
+}
+
+func statsConfigFromOptions(opt graph.Options) (statsConfig, error) {
+	var (
+		c   statsConfig
+		err error
+		v   int
+	)
+	if v, err = opt.IntKey(optStatsRefresh, defaultStatsRefresh); err != nil {
+		return c, err
+	} else if v > 0 {
+		c.refresh = time.Duration(v) * time.Millisecond
+	}
+	if v, err = opt.IntKey(optStatsDrift, defaultStatsDrift); err != nil {
+		return c, err
+	} else if v <= 0 {
+		v = defaultStatsDrift
+	}
+	c.drift = float64(v) / 100
+	if c.sample, err = opt.IntKey(optStatsSample, defaultStatsSample); err != nil {
+		return c, err
+	} else if c.sample <= 0 {
+		c.sample = defaultStatsSample
+	}
+	if c.top, err = opt.IntKey(optStatsTop, defaultStatsTop); err != nil {
+		return c, err
+	} else if c.top <= 0 {
+		c.top = defaultStatsTop
+	}
+	return c, nil
+}
+
+// statsSnapshot is the persistent form of statistics, stored as JSON in the meta bucket.
+type statsSnapshot struct {
+	Nodes      int64            `json:"nodes"` // -1 if unknown
+	Quads      int64            `json:"quads"`
+	Predicates []predicateCount `json:"predicates,omitempty"`
+	Horizon    int64            `json:"horizon"` // horizon of the last estimate
+	Updated    int64            `json:"updated"` // time of the last estimate, in nanoseconds
+	Changes    int64            `json:"changes"` // quads changed since the last estimate
+	Synced     int64            `json:"synced"`  // horizon at which the snapshot was written
+}
+
+type predicateCount struct {
+	ID    uint64 `json:"id"`
+	Quads int64  `json:"quads"`
+}
+
+// statsDelta is a change of statistics made by a single transaction.
+type statsDelta struct {
+	nodes   int64
+	quads   int64
+	changes int64
+	preds   map[uint64]int64
+}
+
+func (d *statsDelta) addQuad(p *proto.Primitive, n int64) {
+	if d.preds == nil {
+		d.preds = make(map[uint64]int64)
+	}
+	d.quads += n
+	d.changes++
+	d.preds[p.Predicate] += n
+}
+
+// stats holds statistics of the quad store in memory.
+type stats struct {
+	conf statsConfig
+
+	mu      sync.Mutex
+	nodes   int64 // -1 if unknown
+	quads   int64
+	preds   map[uint64]int64 // all predicates seen since the last estimate
+	horizon int64
+	updated time.Time
+	changes int64
+	dirty   bool // changed since the snapshot was persisted
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// apply adds changes of a committed transaction.
+func (s *stats) apply(d *statsDelta) {
+	if s == nil || (d.nodes == 0 && d.changes == 0) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nodes >= 0 {
+		s.nodes += d.nodes
+		if s.nodes < 0 {
+			s.nodes = 0
+		}
+	}
+	s.quads += d.quads
+	s.changes += d.changes
+	for p, n := range d.preds {
+		if n = s.preds[p] + n; n > 0 {
+			s.preds[p] = n
+		} else {
+			delete(s.preds, p)
+		}
+	}
+	s.dirty = true
+}
+
+// reset replaces statistics with a new estimate made at a given horizon.
+func (s *stats) reset(nodes, quads int64, preds map[uint64]int64, horizon int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes, s.quads, s.preds = nodes, quads, preds
+	s.horizon = horizon
+	s.updated = time.Now()
+	s.changes = 0
+	s.dirty = true
+}
+
+// stale reports if statistics have drifted too far since the last estimate.
+func (s *stats) stale() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.staleLocked()
+}
+
+func (s *stats) staleLocked() bool {
+	if s.nodes < 0 {
+		return true
+	}
+	base := s.quads
+	if base < 1 {
+		base = 1
+	}
+	return float64(s.changes)/float64(base) > s.conf.drift
+}
+
+// topLocked returns the most used predicates, ordered by the number of quads.
+func (s *stats) topLocked(n int) []predicateCount {
+	out := make([]predicateCount, 0, len(s.preds))
+	for p, c := range s.preds {
+		out = append(out, predicateCount{ID: p, Quads: c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Quads != out[j].Quads {
+			return out[i].Quads > out[j].Quads
+		}
+		return out[i].ID < out[j].ID
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// quadCount returns the number of quads, if statistics are available.
+func (s *stats) quadCount() (int64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quads, true
+}
+
+// nodeCount returns the estimated number of nodes, if it's known.
+func (s *stats) nodeCount() (int64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nodes, s.nodes >= 0
+}
+
+// predicateCount returns the estimated number of quads with a given predicate, if it's known.
+func (s *stats) predicateCount(p uint64) (int64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.preds[p]
+	return n, ok
+}
+
+// estimateSize returns the number of quads for the query optimizer. It's taken from
+// statistics, to avoid reading the counter from the database on each call.
+func (qs *QuadStore) estimateSize() int64 {
+	if n, ok := qs.stats.quadCount(); ok {
+		return n
+	}
+	return qs.Size()
+}
+
+// loadStats reads the statistics snapshot and starts the refresher, if it's enabled.
+func (qs *QuadStore) loadStats(ctx context.Context, conf statsConfig) error {
+	var (
+		snap      *statsSnapshot
+		size, cur int64
+	)
+	err := View(qs.db, func(tx BucketTx) error {
+		vals, err := tx.Bucket(metaBucket).Get(ctx, [][]byte{
+			[]byte(metaStats),
+			[]byte(metaSize),
+			[]byte("horizon"),
+		})
+		if err != nil {
+			return err
+		}
+		if vals[0] != nil {
+			snap = new(statsSnapshot)
+			if err = json.Unmarshal(vals[0], snap); err != nil {
+				return fmt.Errorf("kv: corrupted statistics: %v", err)
+			}
+		}
+		if size, err = asInt64(vals[1], 0); err != nil {
+			return err
+		}
+		cur, err = asInt64(vals[2], 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s := &stats{conf: conf, quads: size, horizon: cur, preds: make(map[uint64]int64)}
+	switch {
+	case snap != nil:
+		s.nodes = snap.Nodes
+		s.horizon = snap.Horizon
+		s.changes = snap.Changes
+		if snap.Updated != 0 {
+			s.updated = time.Unix(0, snap.Updated)
+		}
+		for _, p := range snap.Predicates {
+			s.preds[p.ID] = p.Quads
+		}
+		if snap.Synced < cur {
+			// writes after the snapshot were not accounted for; each of them
+			// allocated at least one horizon value
+			s.changes += cur - snap.Synced
+			s.dirty = true
+		}
+	case cur == 0:
+		// new database
+	default:
+		// the database was created before statistics were kept
+		s.nodes = -1
+	}
+	qs.stats = s
+	if conf.refresh > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go qs.runStatsRefresher(s)
+	}
+	return nil
+}
+
+func (qs *QuadStore) runStatsRefresher(s *stats) {
+	defer close(s.done)
+	t := time.NewTicker(s.conf.refresh)
+	defer t.Stop()
+	ctx := context.Background()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+		}
+		var err error
+		if s.stale() {
+			err = qs.RefreshStats(ctx)
+		} else {
+			err = qs.saveStats(ctx)
+		}
+		if err != nil {
+			clog.Errorf("kv: cannot refresh statistics: %v", err)
+		}
+	}
+}
+
+// closeStats stops the refresher and persists statistics.
+func (qs *QuadStore) closeStats() error {
+	s := qs.stats
+	if s == nil {
+		return nil
+	}
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	return qs.saveStats(context.Background())
+}
+
+// saveStats persists the statistics snapshot, if it has changed.
+func (qs *QuadStore) saveStats(ctx context.Context) error {
+	s := qs.stats
+	if s == nil {
+		return nil
+	}
+	// the horizon must match the writes accounted for in statistics
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	snap := statsSnapshot{
+		Nodes:      s.nodes,
+		Quads:      s.quads,
+		Predicates: s.topLocked(s.conf.top),
+		Horizon:    s.horizon,
+		Changes:    s.changes,
+	}
+	if !s.updated.IsZero() {
+		snap.Updated = s.updated.UnixNano()
+	}
+	s.dirty = false
+	s.mu.Unlock()
+	err := Update(ctx, qs.db, func(tx BucketTx) error {
+		h, err := qs.getMetaIntTx(ctx, tx, "horizon")
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		snap.Synced = h
+		data, err := json.Marshal(snap)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put([]byte(metaStats), data)
+	})
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// RefreshStats re-estimates statistics from a sample of the log and persists them.
+// The number of nodes and quads for each predicate are extrapolated from the sample,
+// unless the whole log fits into it. Writes are blocked while the sample is read.
+func (qs *QuadStore) RefreshStats(ctx context.Context) error {
+	if qs.view {
+		return ErrReadOnlyView
+	} else if qs.stats == nil {
+		return nil
+	}
+	qs.writer.Lock()
+	err := qs.estimateStats(ctx)
+	qs.writer.Unlock()
+	if err != nil {
+		return err
+	}
+	return qs.saveStats(ctx)
+}
+
+// estimateStats reads a sample of the log and replaces statistics with an estimate.
+// The caller must hold the writer lock.
+func (qs *QuadStore) estimateStats(ctx context.Context) error {
+	return View(qs.db, func(tx BucketTx) error {
+		vals, err := tx.Bucket(metaBucket).Get(ctx, [][]byte{
+			[]byte(metaSize),
+			[]byte("horizon"),
+		})
+		if err != nil {
+			return err
+		}
+		size, err := asInt64(vals[0], 0)
+		if err != nil {
+			return err
+		}
+		h, err := asInt64(vals[1], 0)
+		if err != nil {
+			return err
+		}
+		ids := sampleIDs(h, qs.stats.conf.sample)
+		var (
+			nodes, links int64
+			preds        = make(map[uint64]int64)
+		)
+		for len(ids) != 0 {
+			batch := ids
+			if len(batch) > statsBatch {
+				batch = batch[:statsBatch]
+			}
+			ids = ids[len(batch):]
+			prims, err := qs.readPrimitivesFromLog(ctx, tx, batch, nil)
+			if err != nil {
+				return err
+			}
+			for _, p := range prims {
+				if p == nil {
+					continue
+				} else if p.IsNode() {
+					nodes++
+				} else if !p.Deleted {
+					links++
+					preds[p.Predicate]++
+				}
+			}
+		}
+		if n := int64(qs.stats.conf.sample); h > n {
+			// extrapolate the sample to the whole log
+			nodes = nodes * h / n
+		}
+		for p, n := range preds {
+			preds[p] = (n*size + links/2) / links
+		}
+		qs.stats.reset(nodes, size, preds, h)
+		return nil
+	})
+}
+
+// sampleIDs returns ids of log entries to read for an estimate: all of them, if there
+// are at most n entries, or one random id from each of n equal ranges otherwise.
+func sampleIDs(h int64, n int) []uint64 {
+	if h <= int64(n) {
+		ids := make([]uint64, h)
+		for i := range ids {
+			ids[i] = uint64(i) + 1
+		}
+		return ids
+	}
+	ids := make([]uint64, n)
+	for i := range ids {
+		lo := h * int64(i) / int64(n)
+		hi := h * int64(i+1) / int64(n)
+		ids[i] = uint64(lo+rand.Int63n(hi-lo)) + 1
+	}
+	return ids
+}
+
+// Statistics implements graph.StatisticsReporter.
+func (qs *QuadStore) Statistics(ctx context.Context) (graph.Statistics, error) {
+	s := qs.stats
+	if s == nil {
+		return graph.Statistics{Nodes: -1, Quads: qs.Size(), Horizon: qs.horizon(ctx)}, nil
+	}
+	s.mu.Lock()
+	st := graph.Statistics{
+		Nodes:   s.nodes,
+		Quads:   s.quads,
+		Horizon: s.horizon,
+		Updated: s.updated,
+		Changes: s.changes,
+		Stale:   s.staleLocked(),
+	}
+	top := s.topLocked(s.conf.top)
+	s.mu.Unlock()
+	refs := make([]graph.Value, 0, len(top))
+	for _, p := range top {
+		refs = append(refs, Int64Value(p.ID))
+	}
+	names, err := qs.ValuesOf(ctx, refs)
+	if err != nil {
+		return st, err
+	}
+	for i, p := range top {
+		if names[i] == nil {
+			continue
+		}
+		st.Predicates = append(st.Predicates, graph.PredicateStats{Predicate: names[i], Quads: p.Quads})
+	}
+	return st, nil
+}
@@ -0,0 +1,127 @@
+package kv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/kv"
+	"github.com/cayleygraph/cayley/graph/kv/btree"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func openStats(t testing.TB, db kv.BucketKV, opt graph.Options) *kv.QuadStore {
+	qs, err := kv.New(db, opt)
+	require.NoError(t, err)
+	return qs.(*kv.QuadStore)
+}
+
+func writeQuads(t testing.TB, qs graph.QuadStore, action graph.Procedure, quads []quad.Quad) {
+	deltas := make([]graph.Delta, 0, len(quads))
+	for _, q := range quads {
+		deltas = append(deltas, graph.Delta{Quad: q, Action: action})
+	}
+	require.NoError(t, qs.ApplyDeltas(deltas, graph.IgnoreOpts{}))
+}
+
+// statsQuads returns n quads that link n/2 subjects to 10 objects with one of three
+// predicates: half of quads have the first predicate, and a quarter each the others.
+func statsQuads(from, n int) []quad.Quad {
+	preds := []string{"p1", "p1", "p2", "p3"}
+	out := make([]quad.Quad, 0, n)
+	for i := from; i < from+n; i++ {
+		out = append(out, quad.MakeIRI(
+			fmt.Sprintf("s%d", i/2), preds[i%len(preds)], fmt.Sprintf("o%d", i%10), "",
+		))
+	}
+	return out
+}
+
+func predicateStats(st graph.Statistics) map[string]int64 {
+	out := make(map[string]int64)
+	for _, p := range st.Predicates {
+		out[quad.StringOf(p.Predicate)] = p.Quads
+	}
+	return out
+}
+
+func TestStatsIncremental(t *testing.T) {
+	ctx := context.TODO()
+	db := btree.New()
+	require.NoError(t, kv.Init(db, nil))
+	opt := graph.Options{"stats_refresh_ms": 0}
+	qs := openStats(t, db, opt)
+
+	writeQuads(t, qs, graph.Add, statsQuads(0, 40))
+	writeQuads(t, qs, graph.Delete, statsQuads(0, 4))
+	expect := graph.Statistics{Nodes: 18 + 10 + 3, Quads: 36, Changes: 44, Stale: true}
+	expectPreds := map[string]int64{"<p1>": 18, "<p2>": 9, "<p3>": 9}
+	check := func() graph.Statistics {
+		st, err := qs.Statistics(ctx)
+		require.NoError(t, err)
+		require.Equal(t, expectPreds, predicateStats(st))
+		st.Predicates, st.Horizon = nil, 0
+		return st
+	}
+	require.Equal(t, expect, check())
+	sz, _ := qs.NodesAllIterator().Size()
+	require.Equal(t, expect.Nodes, sz)
+
+	// the snapshot is loaded when the store is opened again
+	require.NoError(t, qs.Close())
+	qs = openStats(t, db, opt)
+	defer qs.Close()
+	require.Equal(t, expect, check())
+
+	// a refresh of a small store reads the whole log, thus it's exact
+	require.NoError(t, qs.RefreshStats(ctx))
+	st := check()
+	require.False(t, st.Stale)
+	require.False(t, st.Updated.IsZero())
+	require.Equal(t, int64(0), st.Changes)
+	require.Equal(t, expect.Nodes, st.Nodes)
+}
+
+func TestStatsRefresh(t *testing.T) {
+	ctx := context.TODO()
+	db := btree.New()
+	require.NoError(t, kv.Init(db, nil))
+	opt := graph.Options{"stats_refresh_ms": 0, "stats_sample": 2000}
+	qs := openStats(t, db, opt)
+	writeQuads(t, qs, graph.Add, statsQuads(0, 100))
+	require.NoError(t, qs.RefreshStats(ctx))
+	require.NoError(t, qs.Close())
+
+	// the process crashes after more writes, thus they are not in the snapshot
+	qs = openStats(t, db, opt)
+	writeQuads(t, qs, graph.Add, statsQuads(100, 2900))
+
+	qs = openStats(t, db, opt)
+	st, err := qs.Statistics(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(3000), st.Quads)
+	require.Equal(t, int64(50+10+3), st.Nodes)
+	require.True(t, st.Stale)
+	require.NoError(t, qs.Close())
+
+	opt["stats_refresh_ms"] = 10
+	qs = openStats(t, db, opt)
+	defer qs.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for st.Stale && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		st, err = qs.Statistics(ctx)
+		require.NoError(t, err)
+	}
+	require.False(t, st.Stale, "statistics were not refreshed")
+	require.InEpsilon(t, 1500+10+3, st.Nodes, 0.2)
+	preds := predicateStats(st)
+	require.Len(t, preds, 3)
+	require.InEpsilon(t, 1500, preds["<p1>"], 0.2)
+	require.InEpsilon(t, 750, preds["<p2>"], 0.2)
+	require.InEpsilon(t, 750, preds["<p3>"], 0.2)
+}
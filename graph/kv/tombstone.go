@@ -0,0 +1,424 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/proto"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/pquads"
+)
+
+// ErrReadOnlyView is returned when trying to modify a historical view of the quad store.
+// It is the same as graph.ErrReadOnly.
+var ErrReadOnlyView = graph.ErrReadOnly
+
+var _ graph.Snapshotter = (*QuadStore)(nil)
+
+// Horizon returns the current horizon of the quad store. It grows with each
+// added node or quad, and with each batch of deletions in tombstone mode or
+// if the history is enabled.
+func (qs *QuadStore) Horizon() graph.PrimaryKey {
+	return graph.NewSequentialKey(qs.horizon(context.TODO()))
+}
+
+// Snapshot returns a read-only view of the quad store at the current horizon.
+//
+// If the database supports snapshots (see SnapshotKV), the view reads from a snapshot
+// of it. Otherwise, the view is a historical one, and since deleted quads are visible
+// in historical views only in tombstone mode, snapshots are not supported without it.
+func (qs *QuadStore) Snapshot() (graph.QuadStore, error) {
+	if canSnapshot(qs.db) {
+		db, err := qs.db.(SnapshotKV).Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		v := qs.AsOf(math.MaxInt64)
+		v.db, v.dbSnapshot = db, true
+		// writes might be committed after the current horizon was read,
+		// thus the horizon of the view is read from the snapshot
+		v.asOf = v.horizon(context.TODO())
+		return v, nil
+	}
+	if !qs.tombstones {
+		return nil, graph.ErrSnapshotNotSupported
+	}
+	return qs.AsOf(qs.horizon(context.TODO())), nil
+}
+
+// AsOf returns a read-only view of the quad store as it was at a given horizon.
+//
+// Quads added after the horizon are hidden. Quads deleted after the horizon are
+// visible in the view only if the store runs in tombstone mode and they were
+// not yet removed by Compact. Compact waits until all views are closed, thus
+// views must be closed when they are no longer needed.
+func (qs *QuadStore) AsOf(h int64) *QuadStore {
+	if h < 0 {
+		h = 0
+	}
+	qs.views.acquire()
+	v := &QuadStore{
+		db:         qs.db,
+		valueLRU:   qs.valueLRU,
+		hash:       qs.hash,
+		tombstones: qs.tombstones,
+		history:    qs.history,
+		view:       true,
+		asOf:       h,
+		views:      qs.views,
+		coalesce:   qs.coalesce,
+		stats:      qs.stats,
+		exists:     qs.exists,
+	}
+	if qs.view && h > qs.asOf {
+		// a view cannot see past the horizon of its parent
+		v.asOf = qs.asOf
+	}
+	qs.indexes.RLock()
+	v.indexes.all = qs.indexes.all
+	v.indexes.exists = qs.indexes.exists
+	qs.indexes.RUnlock()
+	qs.writer.Lock()
+	v.mapBucket = qs.mapBucket
+	qs.writer.Unlock()
+	return v
+}
+
+// viewSet counts open historical views of the quad store. Compact waits until
+// all of them are closed, and new views cannot be opened while it runs.
+type viewSet struct {
+	mu sync.Mutex
+	n  int
+	// idle is closed when the last view is released.
+	idle chan struct{}
+}
+
+func (s *viewSet) acquire() {
+	s.mu.Lock()
+	s.n++
+	s.mu.Unlock()
+}
+
+func (s *viewSet) release() {
+	s.mu.Lock()
+	s.n--
+	if s.n == 0 && s.idle != nil {
+		close(s.idle)
+		s.idle = nil
+	}
+	s.mu.Unlock()
+}
+
+// lock waits until there are no open views and blocks opening of new ones until unlock is called.
+func (s *viewSet) lock(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.n == 0 {
+			return nil
+		}
+		if s.idle == nil {
+			s.idle = make(chan struct{})
+		}
+		idle := s.idle
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-idle:
+		}
+	}
+}
+
+func (s *viewSet) unlock() {
+	s.mu.Unlock()
+}
+
+func (qs *QuadStore) addTombstone(tx BucketTx, id uint64, h uint64) error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, h)
+	return tx.Bucket(tombBucket).Put(uint64KeyBytes(id), buf)
+}
+
+// tombstoneHorizon returns a horizon at which the quad was deleted, or 0 if it has no tombstone.
+// If tx is nil, a new read transaction is used.
+func (qs *QuadStore) tombstoneHorizon(ctx context.Context, tx BucketTx, id uint64) (int64, error) {
+	if tx == nil {
+		var h int64
+		err := View(qs.db, func(tx BucketTx) error {
+			var err error
+			h, err = qs.tombstoneHorizon(ctx, tx, id)
+			return err
+		})
+		return h, err
+	}
+	v, err := GetOne(ctx, tx.Bucket(tombBucket), uint64KeyBytes(id))
+	if err == ErrNotFound || err == ErrNoBucket {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return asInt64(v, 0)
+}
+
+// visible checks if a quad primitive should be returned by iterators.
+// In the latest state, only live quads are visible. In historical views,
+// quads that were deleted after the view horizon are visible as well.
+func (qs *QuadStore) visible(ctx context.Context, tx BucketTx, p *proto.Primitive) (bool, error) {
+	if p == nil {
+		return false, nil
+	} else if !qs.view {
+		return !p.Deleted, nil
+	} else if p.ID > uint64(qs.asOf) {
+		return false, nil
+	} else if !p.Deleted {
+		return true, nil
+	}
+	h, err := qs.tombstoneHorizon(ctx, tx, p.ID)
+	if err != nil {
+		return false, err
+	}
+	return h > qs.asOf, nil
+}
+
+type compactNode struct {
+	id  uint64
+	val quad.Value
+}
+
+// Compact physically removes quads that were deleted at or before a given horizon,
+// as well as nodes that are no longer referenced by any quad or tombstone.
+// Quads deleted without tombstones are always removed. Node reference counters
+// and the size of the quad store are rebuilt from scratch.
+//
+// Compaction waits until all historical views of the store are closed, since it
+// removes data that is still visible in them.
+func (qs *QuadStore) Compact(ctx context.Context, h int64) error {
+	if qs.view {
+		return ErrReadOnlyView
+	}
+	if err := qs.views.lock(ctx); err != nil {
+		return err
+	}
+	defer qs.views.unlock()
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	tx, err := qs.db.Tx(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tombs := make(map[uint64]int64)
+	err = Each(ctx, tx.Bucket(tombBucket), nil, func(k, v []byte) error {
+		if len(k) != 8 {
+			return fmt.Errorf("unexpected tombstone key size: %d", len(k))
+		}
+		dh, err := asInt64(v, 0)
+		if err != nil {
+			return err
+		}
+		tombs[quadKeyEnc.Uint64(k)] = dh
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// collect quads to remove and count references to nodes from the rest of them
+	var (
+		purge []*proto.Primitive
+		nodes []compactNode
+		size  int64
+	)
+	refs := make(map[uint64]int64)
+	preds := make(map[uint64]int64)
+	err = Each(ctx, tx.Bucket(logIndex), nil, func(k, v []byte) error {
+		p := &proto.Primitive{}
+		if err := p.Unmarshal(v); err != nil {
+			return err
+		}
+		if p.IsNode() {
+			val, err := pquads.UnmarshalValue(p.Value)
+			if err != nil {
+				return err
+			}
+			nodes = append(nodes, compactNode{id: p.ID, val: val})
+			return nil
+		}
+		if p.Deleted {
+			if dh, ok := tombs[p.ID]; !ok || dh <= h {
+				purge = append(purge, p)
+				return nil
+			}
+		} else {
+			size++
+			preds[p.Predicate]++
+		}
+		for _, dir := range quad.Directions {
+			if id := p.GetDirection(dir); id != 0 {
+				refs[id]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = qs.purgeLinks(ctx, tx, purge); err != nil {
+		return err
+	}
+	purge = nil
+
+	slots, err := qs.compactSlots(ctx, tx, nodes)
+	if err != nil {
+		return err
+	}
+	var buf [binary.MaxVarintLen64]byte
+	live := int64(len(nodes))
+	for i, n := range nodes {
+		if slots[i].ID != n.id {
+			// the node cannot be found by its value (see VerifyHashes),
+			// thus the entries of its hash key belong to another node
+			if refs[n.id] == 0 {
+				if err := qs.delLog(tx, n.id); err != nil {
+					return err
+				}
+				live--
+			}
+			continue
+		}
+		k := bucketKeyForSlotRefs(slots[i].Key())
+		if cnt := refs[n.id]; cnt > 0 {
+			sz := binary.PutUvarint(buf[:], uint64(cnt))
+			if err := tx.Bucket(k.Bucket).Put(k.Key, append([]byte{}, buf[:sz]...)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Bucket(k.Bucket).Del(k.Key); err != nil {
+			return err
+		}
+		if err := qs.delNodeSlot(ctx, tx, slots[i]); err != nil {
+			return err
+		}
+		if iri, ok := n.val.(quad.IRI); ok {
+			qs.valueLRU.Del(string(iri))
+		}
+		if err := qs.delLog(tx, n.id); err != nil {
+			return err
+		}
+		live--
+	}
+
+	sz := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sz, uint64(size))
+	if err = tx.Bucket(metaBucket).Put([]byte("size"), sz); err != nil {
+		return err
+	}
+	horizon, err := qs.getMetaIntTx(ctx, tx, "horizon")
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	// all quads and nodes were counted, thus statistics are exact
+	qs.stats.reset(live, size, preds, horizon)
+	return nil
+}
+
+// compactSlots returns entries of nodes in hash buckets.
+func (qs *QuadStore) compactSlots(ctx context.Context, tx BucketTx, nodes []compactNode) ([]nodeSlot, error) {
+	vals := make([]quad.Value, len(nodes))
+	keys := make([][]byte, len(nodes))
+	for i, n := range nodes {
+		vals[i] = n.val
+		keys[i] = qs.hash.key(n.val, nil)
+	}
+	if !qs.hash.checked() {
+		// keys of values are known without reading the entries
+		slots := make([]nodeSlot, len(nodes))
+		for i, n := range nodes {
+			slots[i] = nodeSlot{ID: n.id, Prefix: keys[i]}
+		}
+		return slots, nil
+	}
+	return qs.resolveNodes(ctx, tx, vals, keys)
+}
+
+// purgeLinks removes quads from all indexes, the log and the list of tombstones.
+func (qs *QuadStore) purgeLinks(ctx context.Context, tx BucketTx, links []*proto.Primitive) error {
+	if len(links) == 0 {
+		return nil
+	}
+	qs.indexes.RLock()
+	all := qs.indexes.all
+	qs.indexes.RUnlock()
+
+	del := make(map[uint64]struct{}, len(links))
+	for _, p := range links {
+		del[p.ID] = struct{}{}
+	}
+	for _, ind := range all {
+		b := tx.Bucket(ind.Bucket())
+		seen := make(map[string]struct{})
+		for _, p := range links {
+			key := ind.KeyFor(p)
+			if _, ok := seen[string(key)]; ok {
+				continue
+			}
+			seen[string(key)] = struct{}{}
+			vals, err := b.Get(ctx, [][]byte{key})
+			if err != nil {
+				return err
+			}
+			list, err := decodeIndex(vals[0])
+			if err != nil {
+				return err
+			}
+			out := list[:0]
+			for _, id := range list {
+				if _, ok := del[id]; !ok {
+					out = append(out, id)
+				}
+			}
+			if len(out) == 0 {
+				err = b.Del(key)
+			} else {
+				err = b.Put(key, appendIndex(nil, out))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	tombs := tx.Bucket(tombBucket)
+	for _, p := range links {
+		if err := qs.delLog(tx, p.ID); err != nil {
+			return err
+		}
+		if err := tombs.Del(uint64KeyBytes(p.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
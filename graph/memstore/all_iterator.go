@@ -35,6 +35,7 @@ type AllIterator struct {
 	i    int // index into qs.all
 	cur  *primitive
 	done bool
+	io   graph.IOStats
 }
 
 func newAllIterator(qs *QuadStore, nodes bool, maxid int64) *AllIterator {
@@ -45,6 +46,13 @@ func newAllIterator(qs *QuadStore, nodes bool, maxid int64) *AllIterator {
 	}
 }
 
+var _ graph.IOStater = &AllIterator{}
+
+// IOStats implements graph.IOStater. It counts lookups of primitives.
+func (it *AllIterator) IOStats() graph.IOStats {
+	return it.io
+}
+
 func (it *AllIterator) Clone() graph.Iterator {
 	it2 := newAllIterator(it.qs, it.nodes, it.maxid)
 	it2.tags.CopyFrom(it)
@@ -69,6 +77,7 @@ func (it *AllIterator) ok(p *primitive) bool {
 }
 
 func (it *AllIterator) Next(ctx context.Context) bool {
+	it.io.Reads++
 	it.cur = nil
 	if it.done {
 		return false
@@ -94,6 +103,7 @@ func (it *AllIterator) Next(ctx context.Context) bool {
 }
 
 func (it *AllIterator) Contains(ctx context.Context, v graph.Value) bool {
+	it.io.Reads++
 	it.cur = nil
 	if it.done {
 		return false
@@ -143,6 +153,9 @@ func (it *AllIterator) UID() uint64 {
 	return it.uid
 }
 func (it *AllIterator) Type() graph.Type { return graph.All }
+func (it *AllIterator) Describe() graph.Description {
+	return graph.Description{Params: graph.Options{"nodes": it.nodes}}
+}
 func (it *AllIterator) String() string {
 	return "MemStoreAll"
 }
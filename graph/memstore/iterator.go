@@ -40,6 +40,7 @@ type Iterator struct {
 
 	d     quad.Direction
 	value int64
+	io    graph.IOStats
 }
 
 func NewIterator(tree *Tree, qs *QuadStore, d quad.Direction, value int64) *Iterator {
@@ -58,7 +59,7 @@ func (it *Iterator) UID() uint64 {
 }
 
 func (it *Iterator) Reset() {
-	it.iter = nil
+	it.closeIter()
 	it.err = nil
 	it.cur = nil
 }
@@ -71,18 +72,35 @@ func (it *Iterator) TagResults(dst map[string]graph.Value) {
 	it.tags.TagResult(dst, it.Result())
 }
 
+var _ graph.IOStater = &Iterator{}
+
+// IOStats implements graph.IOStater. It counts index lookups.
+func (it *Iterator) IOStats() graph.IOStats {
+	return it.io
+}
+
 func (it *Iterator) Clone() graph.Iterator {
 	m := NewIterator(it.tree, it.qs, it.d, it.value)
 	m.tags.CopyFrom(it)
 	return m
 }
 
+// closeIter returns the current enumerator to the pool.
+func (it *Iterator) closeIter() {
+	if it.iter != nil {
+		it.iter.Close()
+		it.iter = nil
+	}
+}
+
 func (it *Iterator) Close() error {
+	it.closeIter()
 	return nil
 }
 
 func (it *Iterator) Next(ctx context.Context) bool {
 	graph.NextLogIn(it)
+	it.io.Reads++
 	if it.iter == nil {
 		it.iter, it.err = it.tree.SeekFirst()
 		if it.err == io.EOF || it.iter == nil {
@@ -98,6 +116,7 @@ func (it *Iterator) Next(ctx context.Context) bool {
 			if err != io.EOF {
 				it.err = err
 			}
+			it.cur = nil
 			return graph.NextLogOut(it, false)
 		}
 		it.cur = p
@@ -105,6 +124,71 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	}
 }
 
+var _ graph.Seekable = &Iterator{}
+
+// SortOrder implements graph.Seekable. All iterators are sorted by primitive IDs,
+// which are assigned to nodes and quads in the order of insertion.
+func (it *Iterator) SortOrder() string { return "memstore" }
+
+// SortKey implements graph.Seekable.
+func (it *Iterator) SortKey() uint64 {
+	if it.cur == nil {
+		return 0
+	}
+	return uint64(it.cur.ID)
+}
+
+// NextGE implements graph.Seekable.
+func (it *Iterator) NextGE(ctx context.Context, k uint64) bool {
+	graph.NextLogIn(it)
+	it.io.Reads++
+	it.closeIter()
+	it.iter, _ = it.tree.Seek(int64(k))
+	_, p, err := it.iter.Next()
+	if err != nil {
+		if err != io.EOF {
+			it.err = err
+		}
+		it.cur = nil
+		return graph.NextLogOut(it, false)
+	}
+	it.cur = p
+	return graph.NextLogOut(it, true)
+}
+
+var _ iterator.Bitmapper = &Iterator{}
+
+// AddIDs implements iterator.Bitmapper. Primitive IDs are assigned sequentially,
+// thus the id space is dense.
+func (it *Iterator) AddIDs(ctx context.Context, b *iterator.Bitmap) error {
+	it.io.Reads++
+	e, err := it.tree.SeekFirst()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer e.Close()
+	for {
+		id, _, err := e.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		b.Add(uint64(id))
+	}
+}
+
+// ValueOfID implements iterator.Bitmapper.
+func (it *Iterator) ValueOfID(id uint64) graph.Value {
+	p := it.qs.prim[int64(id)]
+	if p == nil {
+		return nil
+	}
+	return qprim{p: p}
+}
+
 func (it *Iterator) Err() error {
 	return it.err
 }
@@ -131,6 +215,7 @@ func (it *Iterator) Size() (int64, bool) {
 
 func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
 	graph.ContainsLogIn(it, v)
+	it.io.Reads++
 	if v == nil {
 		return graph.ContainsLogOut(it, v, false)
 	}
@@ -155,6 +240,14 @@ func (it *Iterator) String() string {
 
 func (it *Iterator) Type() graph.Type { return "b+tree" }
 
+// Describe returns a description of the index scan as a LinksTo of a single node.
+func (it *Iterator) Describe() graph.Description {
+	return graph.Description{
+		Type: graph.LinksTo, Direction: it.d,
+		Iterators: []graph.Description{{Type: graph.Fixed, Refs: []graph.Value{bnode(it.value)}}},
+	}
+}
+
 func (it *Iterator) Sorted() bool { return true }
 
 func (it *Iterator) Optimize() (graph.Iterator, bool) {
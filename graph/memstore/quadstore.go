@@ -28,8 +28,14 @@ const QuadStoreType = "memstore"
 
 func init() {
 	graph.RegisterQuadStore(QuadStoreType, graph.QuadStoreRegistration{
-		NewFunc: func(string, graph.Options) (graph.QuadStore, error) {
-			return newQuadStore(), nil
+		NewFunc: func(_ string, opt graph.Options) (graph.QuadStore, error) {
+			snapshots, err := opt.BoolKey("snapshots", false)
+			if err != nil {
+				return nil, err
+			}
+			qs := newQuadStore()
+			qs.snapshots = snapshots
+			return qs, nil
 		},
 		UpgradeFunc:  nil,
 		InitFunc:     nil,
@@ -140,6 +146,10 @@ type QuadStore struct {
 	reading bool         // someone else might be reading "all" slice - next insert/delete should clone it
 	index   QuadDirectionIndex
 	horizon int64 // used only to assign ids to tx
+	// snapshots enables the snapshot mode (see Snapshot)
+	snapshots bool
+	// readOnly is set for snapshots
+	readOnly bool
 	// vip_index map[string]map[int64]map[string]map[int64]*b.Tree
 }
 
@@ -368,6 +378,9 @@ func (qs *QuadStore) findQuad(q quad.Quad) (int64, internalQuad, bool) {
 }
 
 func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	if qs.readOnly {
+		return graph.ErrReadOnly
+	}
 	// Precheck the whole transaction (if required)
 	if !ignoreOpts.IgnoreDup || !ignoreOpts.IgnoreMissing {
 		for _, d := range deltas {
@@ -390,6 +403,17 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 		}
 	}
 
+	for _, d := range deltas {
+		switch d.Action {
+		case graph.Add, graph.Delete:
+		default:
+			return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
+		}
+	}
+	horizon := graph.NewSequentialKey(qs.horizon + 1)
+	if err := graph.BeforeCommit(deltas, horizon); err != nil {
+		return err
+	}
 	for _, d := range deltas {
 		switch d.Action {
 		case graph.Add:
@@ -404,9 +428,59 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 		}
 	}
 	qs.horizon++
+	graph.AfterCommit(deltas, horizon)
 	return nil
 }
 
+var _ graph.Horizoner = (*QuadStore)(nil)
+
+// Horizon returns the number of transactions applied to the quad store.
+func (qs *QuadStore) Horizon() graph.PrimaryKey {
+	return graph.NewSequentialKey(qs.horizon)
+}
+
+var _ graph.Snapshotter = (*QuadStore)(nil)
+
+// Snapshot returns a read-only copy of the quad store at the current horizon.
+//
+// Taking a snapshot copies all the indexes of the store, thus it's only supported in
+// the snapshot mode, enabled by the "snapshots" option.
+func (qs *QuadStore) Snapshot() (graph.QuadStore, error) {
+	if !qs.snapshots {
+		return nil, graph.ErrSnapshotNotSupported
+	}
+	s := newQuadStore()
+	s.last, s.horizon = qs.last, qs.horizon
+	s.snapshots, s.readOnly = true, true
+	for k, id := range qs.vals {
+		s.vals[k] = id
+	}
+	// primitives are not modified once added, except for reference counters
+	// that are not used by a read-only store
+	for id, p := range qs.prim {
+		s.prim[id] = p
+	}
+	for q, id := range qs.quads {
+		s.quads[q] = id
+		p := qs.prim[id]
+		for _, t := range s.indexesForQuad(q) {
+			t.Set(id, p)
+		}
+	}
+	// the next write to the store will copy the slice
+	s.all = qs.cloneAll()
+	return s, nil
+}
+
+var _ graph.FeatureReporter = (*QuadStore)(nil)
+
+// Features implements graph.FeatureReporter. Quads are indexed in all directions,
+// and index iterators can seek, but the store keeps no history. Snapshots are only
+// available in the snapshot mode.
+func (qs *QuadStore) Features() graph.Features {
+	return graph.Features{Seek: true, LabelIndex: true, Snapshots: qs.snapshots}
+}
+
 func asID(v graph.Value) (int64, bool) {
 	switch v := v.(type) {
 	case bnode:
@@ -16,6 +16,7 @@ package memstore
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -87,6 +88,40 @@ func TestMemstore(t *testing.T) {
 	})
 }
 
+func TestMemstoreSnapshots(t *testing.T) {
+	graphtest.TestFeatures(t, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		qs, err := graph.NewQuadStore(QuadStoreType, "", graph.Options{"snapshots": true})
+		require.NoError(t, err)
+		return qs, nil, func() {}
+	}, &graphtest.Config{AlwaysRunIntegration: true})
+
+	qs, w, _ := makeTestStore(simpleGraph)
+	_, err := qs.Snapshot()
+	require.Equal(t, graph.ErrSnapshotNotSupported, err)
+
+	qs.snapshots = true
+	snap, err := qs.Snapshot()
+	require.NoError(t, err)
+	defer snap.Close()
+
+	removed := simpleGraph[len(simpleGraph)-1]
+	require.NoError(t, w.RemoveQuad(removed))
+	require.NoError(t, w.AddQuad(quad.MakeRaw("E", "follows", "G", "")))
+
+	graphtest.ExpectIteratedQuads(t, snap, snap.QuadsAllIterator(), simpleGraph, true)
+	graphtest.ExpectIteratedQuads(t, snap, snap.QuadIterator(quad.Subject, snap.ValueOf(quad.Raw("G"))), []quad.Quad{removed}, false)
+	require.True(t, snap.(graph.Horizoner).Horizon().Int() < qs.Horizon().Int())
+
+	err = snap.ApplyDeltas([]graph.Delta{{Quad: removed, Action: graph.Delete}}, graph.IgnoreOpts{})
+	require.Equal(t, graph.ErrReadOnly, err)
+}
+
+func BenchmarkMemstore(b *testing.B) {
+	graphtest.BenchmarkSkewedIntersection(b, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		return New(), nil, func() {}
+	})
+}
+
 type pair struct {
 	query string
 	value int64
@@ -187,6 +222,58 @@ func TestLinksToOptimization(t *testing.T) {
 	}
 }
 
+func TestAndZigZagOptimization(t *testing.T) {
+	ctx := context.TODO()
+	qs, _, _ := makeTestStore(simpleGraph)
+
+	links := func(v string, d quad.Direction) graph.Iterator {
+		return iterator.NewLinksTo(qs, iterator.NewFixed(qs.ValueOf(quad.Raw(v))), d)
+	}
+	and := iterator.NewAnd(qs, links("B", quad.Subject), links("follows", quad.Predicate))
+	it, _ := and.Optimize()
+	defer it.Close()
+	if it.Type() != graph.ZigZag {
+		t.Fatalf("expected sorted iterators to be intersected with ZigZag, got: %v", it)
+	}
+	var got []quad.Quad
+	for it.Next(ctx) {
+		got = append(got, qs.Quad(it.Result()))
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []quad.Quad{quad.MakeRaw("B", "follows", "F", "")}, got)
+}
+
+func TestAndBitmapOptimization(t *testing.T) {
+	ctx := context.TODO()
+	// all quads point to the same object, and every other one has the same predicate
+	var data []quad.Quad
+	for i := 0; i < 1000; i++ {
+		p := "a"
+		if i%2 == 1 {
+			p = fmt.Sprint("b", i)
+		}
+		data = append(data, quad.MakeRaw(fmt.Sprint("n", i), p, "x", ""))
+	}
+	qs, _, _ := makeTestStore(data)
+
+	links := func(v string, d quad.Direction) graph.Iterator {
+		return iterator.NewLinksTo(qs, iterator.NewFixed(qs.ValueOf(quad.Raw(v))), d)
+	}
+	and := iterator.NewAnd(qs, links("x", quad.Object), links("a", quad.Predicate))
+	it, _ := and.Optimize()
+	defer it.Close()
+	if it.Type() != graph.AndBitmap {
+		t.Fatalf("expected large iterators to be intersected with bitmaps, got: %v", it)
+	}
+	n := 0
+	for it.Next(ctx) {
+		require.Equal(t, quad.Raw("a"), qs.Quad(it.Result()).Predicate)
+		n++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, 500, n)
+}
+
 func TestRemoveQuad(t *testing.T) {
 	ctx := context.TODO()
 	qs, w, _ := makeTestStore(simpleGraph)
@@ -245,3 +332,36 @@ func TestTransaction(t *testing.T) {
 		t.Error("Appended a new quad in a failed transaction")
 	}
 }
+
+func TestExplainDoesNotRead(t *testing.T) {
+	ctx := context.TODO()
+	qs, _, _ := makeTestStore(simpleGraph)
+
+	newIt := func() graph.Iterator {
+		and := iterator.NewAnd(qs,
+			iterator.NewLinksTo(qs, iterator.NewFixed(qs.ValueOf(quad.Raw("G"))), quad.Object),
+			iterator.NewLinksTo(qs, iterator.NewFixed(qs.ValueOf(quad.Raw("follows"))), quad.Predicate),
+		)
+		return iterator.NewHasA(qs, and, quad.Subject)
+	}
+
+	chain := graph.Iterate(ctx, newIt())
+	plan := chain.Explain()
+	if n := chain.IOStats().Reads; n != 0 {
+		t.Fatalf("expected no reads in explain mode, got %d", n)
+	}
+	require.Equal(t, graph.HasA, plan.Type)
+	require.NotNil(t, plan.Stats)
+	require.Len(t, plan.Iterators, 1)
+	for _, sub := range plan.Iterators[0].Iterators {
+		require.NotNil(t, sub.Stats)
+	}
+
+	chain = graph.Iterate(ctx, newIt())
+	n, err := chain.Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+	if chain.IOStats().Reads == 0 {
+		t.Fatal("expected reads when running the query")
+	}
+}
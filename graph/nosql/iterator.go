@@ -91,14 +91,16 @@ func (it *Iterator) UID() uint64 {
 
 func (it *Iterator) Reset() {
 	it.Close()
-	it.iter = it.makeIterator()
 }
 
 func (it *Iterator) Close() error {
-	if it.iter != nil {
-		return it.iter.Close()
+	if it.iter == nil {
+		return nil
 	}
-	return nil
+	// cursor is opened again on the next call to Next
+	err := it.iter.Close()
+	it.iter = nil
+	return err
 }
 
 func (it *Iterator) Tagger() *graph.Tagger {
@@ -150,6 +152,12 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	} else {
 		id, _ := doc[fldHash].(String)
 		it.result = NodeHash(id)
+		// node document already holds the value; cache it to save a lookup in NameOf
+		if dv, ok := doc[fldValue].(Document); ok && id != "" {
+			if qv, err := it.qs.opt.toQuadValue(dv); err == nil && qv != nil {
+				it.qs.ids.Put(string(id), qv)
+			}
+		}
 	}
 	return true
 }
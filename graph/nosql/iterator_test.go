@@ -0,0 +1,182 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+var errReadOnly = errors.New("read-only database")
+
+// nodesDB is a read-only in-memory database of nodes that records filters of all queries.
+type nodesDB struct {
+	docs    []Document
+	queries [][]FieldFilter
+}
+
+func (db *nodesDB) Insert(ctx context.Context, col string, key Key, d Document) (Key, error) {
+	return nil, errReadOnly
+}
+func (db *nodesDB) FindByKey(ctx context.Context, col string, key Key) (Document, error) {
+	for _, d := range db.docs {
+		if d[fldHash] == String(key[0]) {
+			return d, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+func (db *nodesDB) Query(col string) Query { return &nodesQuery{db: db} }
+func (db *nodesDB) Update(col string, key Key) Update {
+	panic(errReadOnly)
+}
+func (db *nodesDB) Delete(col string) Delete {
+	panic(errReadOnly)
+}
+func (db *nodesDB) EnsureIndex(ctx context.Context, col string, primary Index, secondary []Index) error {
+	return nil
+}
+func (db *nodesDB) Close() error { return nil }
+
+type nodesQuery struct {
+	db      *nodesDB
+	filters []FieldFilter
+}
+
+func (q *nodesQuery) WithFields(filters ...FieldFilter) Query {
+	q.filters = append(q.filters, filters...)
+	return q
+}
+func (q *nodesQuery) Limit(n int) Query { return q }
+func (q *nodesQuery) find() []Document {
+	q.db.queries = append(q.db.queries, q.filters)
+	var out []Document
+next:
+	for _, d := range q.db.docs {
+		for _, f := range q.filters {
+			if !f.Matches(d) {
+				continue next
+			}
+		}
+		out = append(out, d)
+	}
+	return out
+}
+func (q *nodesQuery) Count(ctx context.Context) (int64, error) {
+	return int64(len(q.find())), nil
+}
+func (q *nodesQuery) One(ctx context.Context) (Document, error) {
+	if docs := q.find(); len(docs) != 0 {
+		return docs[0], nil
+	}
+	return nil, ErrNotFound
+}
+func (q *nodesQuery) Iterate() DocIterator {
+	return &nodesIterator{docs: q.find(), i: -1}
+}
+
+type nodesIterator struct {
+	docs []Document
+	i    int
+}
+
+func (it *nodesIterator) Next(ctx context.Context) bool {
+	it.i++
+	return it.i < len(it.docs)
+}
+func (it *nodesIterator) Err() error    { return nil }
+func (it *nodesIterator) Close() error  { return nil }
+func (it *nodesIterator) Key() Key      { return Key{string(it.docs[it.i][fldHash].(String))} }
+func (it *nodesIterator) Doc() Document { return it.docs[it.i] }
+
+func TestOptimizeValueFilters(t *testing.T) {
+	ctx := context.TODO()
+	db := &nodesDB{}
+	qs, err := NewQuadStore(db, nil, nil)
+	require.NoError(t, err)
+	for _, v := range []quad.Value{
+		quad.IRI("a"), quad.IRI("ab"), quad.IRI("b"), quad.BNode("ab"),
+		quad.String("a"), quad.String("ab"), quad.String("abc"), quad.String("b"),
+		quad.LangString{Value: "abd", Lang: "en"}, quad.TypedString{Value: "abe", Type: "t"},
+		quad.Int(5), quad.Float(6.5),
+	} {
+		doc := qs.opt.toDocumentValue(v)
+		doc[fldHash] = String(qs.ValueOf(v).(NodeHash))
+		db.docs = append(db.docs, doc)
+	}
+	values := func(it graph.Iterator) []string {
+		defer it.Close()
+		var out []string
+		for it.Next(ctx) {
+			out = append(out, quad.StringOf(qs.NameOf(it.Result())))
+		}
+		require.NoError(t, it.Err())
+		sort.Strings(out)
+		return out
+	}
+
+	for _, c := range []struct {
+		name   string
+		it     func() graph.Iterator
+		pushed bool
+	}{
+		{
+			name: "gt iri",
+			it: func() graph.Iterator {
+				return iterator.NewComparison(qs.NodesAllIterator(), iterator.CompareGT, quad.IRI("a"), qs)
+			},
+			pushed: true,
+		},
+		{
+			name: "gte string",
+			it: func() graph.Iterator {
+				return iterator.NewComparison(qs.NodesAllIterator(), iterator.CompareGTE, quad.String("ab"), qs)
+			},
+			pushed: true,
+		},
+		{
+			name: "regexp",
+			it: func() graph.Iterator {
+				return iterator.NewRegex(qs.NodesAllIterator(), regexp.MustCompile("^ab"), qs)
+			},
+			pushed: true,
+		},
+		{
+			name: "prefix",
+			it: func() graph.Iterator {
+				return iterator.NewPrefix(qs.NodesAllIterator(), "ab", qs)
+			},
+			pushed: true,
+		},
+		{
+			name: "gt int",
+			it: func() graph.Iterator {
+				return iterator.NewComparison(qs.NodesAllIterator(), iterator.CompareGT, quad.Int(4), qs)
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			expect := values(c.it())
+			require.NotEmpty(t, expect)
+
+			it, ok := c.it().Optimize()
+			require.Equal(t, c.pushed, ok)
+			db.queries = nil
+			require.Equal(t, expect, values(it))
+			require.Len(t, db.queries, 1)
+			if c.pushed {
+				require.NotEmpty(t, db.queries[0], "expected a filtered query")
+				st := it.Stats()
+				require.True(t, st.Size < int64(len(db.docs)), "expected the size of the filtered query, got: %+v", st)
+			} else {
+				require.Empty(t, db.queries[0])
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ const Type = "mongo"
 
 var (
 	_ nosql.BatchInserter = (*DB)(nil)
+	_ nosql.BatchUpserter = (*DB)(nil)
+	_ nosql.LogHorizoner  = (*DB)(nil)
 )
 
 func init() {
@@ -317,6 +319,35 @@ func (db *DB) FindByKey(ctx context.Context, col string, key nosql.Key) (nosql.D
 	}
 	return c.convDoc(m), nil
 }
+
+// LogHorizon returns the ObjectID of the latest log entry in hex form, which preserves the order
+// of writes. Hex-encoded ObjectIDs never collide with the text form of sequential horizons,
+// since they are too large for int64 even if they consist only of digits.
+func (db *DB) LogHorizon(ctx context.Context, col string) (graph.PrimaryKey, error) {
+	c, ok := db.colls[col]
+	if !ok {
+		return graph.PrimaryKey{}, fmt.Errorf("collection %q is not initialized", col)
+	}
+	var m bson.M
+	// ObjectIDs start with a timestamp followed by a counter, so they already follow the order
+	// of writes; sorting only by the id lets the query use the default index on it
+	err := c.c.Find(nil).Select(bson.M{idField: 1}).Sort("-" + idField).One(&m)
+	if err == mgo.ErrNotFound {
+		return graph.NewUniqueKey(""), nil
+	} else if err != nil {
+		return graph.PrimaryKey{}, err
+	}
+	key := c.getKey(m)
+	if len(key) != 1 {
+		return graph.PrimaryKey{}, fmt.Errorf("unexpected log key: %q", key)
+	}
+	if b, err := base64.StdEncoding.DecodeString(key[0]); err == nil && len(b) == 12 {
+		return graph.NewUniqueKey(bson.ObjectId(b).Hex()), nil
+	}
+	// log entries with custom keys
+	return graph.NewUniqueKey(key[0]), nil
+}
+
 func (db *DB) Query(col string) nosql.Query {
 	c := db.colls[col]
 	return &Query{c: &c}
@@ -405,7 +436,7 @@ func (q *Query) build() *mgo.Query {
 	if q.query != nil {
 		m = q.query
 	}
-	qu := q.c.c.Find(m)
+	qu := q.c.c.Find(m).Batch(queryBatchSize)
 	if q.limit > 0 {
 		qu = qu.Limit(q.limit)
 	}
@@ -549,7 +580,10 @@ func (db *DB) BatchInsert(col string) nosql.DocWriter {
 	return &inserter{col: &c}
 }
 
-const batchSize = 100
+const (
+	batchSize      = 100
+	queryBatchSize = 1000 // number of documents fetched by a cursor in a single round trip
+)
 
 type inserter struct {
 	col   *collection
@@ -594,3 +628,57 @@ func (w *inserter) Close() error {
 	w.buf = nil
 	return w.err
 }
+
+func (db *DB) BatchUpsert(col string) nosql.UpsertWriter {
+	c := db.colls[col]
+	return &upserter{col: &c}
+}
+
+type upserter struct {
+	col *collection
+	buf []interface{}
+	err error
+}
+
+func (w *upserter) Upsert(ctx context.Context, key nosql.Key, d nosql.Document, field string, dn int) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf) >= 2*batchSize {
+		if err := w.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	update := bson.M{"$inc": bson.M{field: dn}}
+	m := toBsonDoc(d)
+	if m == nil {
+		m = make(bson.M)
+	}
+	w.col.setKey(m, key)
+	if len(m) != 0 {
+		update["$setOnInsert"] = m
+	}
+	// bulk upserts are passed as selector and update pairs
+	w.buf = append(w.buf, bson.M{idField: compKey(key)}, update)
+	return nil
+}
+
+func (w *upserter) Flush(ctx context.Context) error {
+	if len(w.buf) == 0 || w.err != nil {
+		return w.err
+	}
+	// keep the bulk ordered, since the same document may be updated more than once
+	b := w.col.c.Bulk()
+	b.Upsert(w.buf...)
+	if _, err := b.Run(); err != nil {
+		w.err = err
+		return err
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *upserter) Close() error {
+	w.buf = nil
+	return w.err
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/cayleygraph/cayley/graph/nosql"
 	"github.com/cayleygraph/cayley/graph/nosql/nosqltest"
 	"github.com/cayleygraph/cayley/internal/dock"
+	"github.com/stretchr/testify/require"
 )
 
 func makeMongo(t testing.TB) (nosql.Database, *nosql.Options, graph.Options, func()) {
@@ -42,3 +43,24 @@ func TestMongo(t *testing.T) {
 func BenchmarkMongo(t *testing.B) {
 	nosqltest.BenchmarkAll(t, makeMongo, conf)
 }
+
+func TestMongoIndexes(t *testing.T) {
+	db, _, opt, closer := makeMongo(t)
+	defer closer()
+	require.NoError(t, nosql.Init(db, opt))
+
+	inds, err := db.(*DB).db.C("quads").Indexes()
+	require.NoError(t, err)
+	var keys [][]string
+	for _, ind := range inds {
+		keys = append(keys, ind.Key)
+	}
+	// reverse traversals and lookups by predicate and object must be covered
+	for _, exp := range [][]string{
+		{"object"},
+		{"label"},
+		{"predicate", "object"},
+	} {
+		require.Contains(t, keys, exp)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"regexp"
 
 	"github.com/pborman/uuid"
+
+	"github.com/cayleygraph/cayley/graph"
 )
 
 var (
@@ -269,6 +271,63 @@ type BatchInserter interface {
 	BatchInsert(col string) DocWriter
 }
 
+// BatchUpsert returns a streaming upsert writer for database or emulates it if database has no support for batch updates.
+func BatchUpsert(db Database, col string) UpsertWriter {
+	if bu, ok := db.(BatchUpserter); ok {
+		return bu.BatchUpsert(col)
+	}
+	return &seqUpsert{db: db, col: col}
+}
+
+type seqUpsert struct {
+	db  Database
+	col string
+	err error
+}
+
+func (w *seqUpsert) Upsert(ctx context.Context, key Key, d Document, field string, dn int) error {
+	if w.err != nil {
+		return w.err
+	}
+	err := w.db.Update(w.col, key).Upsert(d).Inc(field, dn).Do(ctx)
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+func (w *seqUpsert) Flush(ctx context.Context) error {
+	return w.err
+}
+
+func (w *seqUpsert) Close() error {
+	return w.err
+}
+
+// UpsertWriter is an interface for upserting documents in streaming manner.
+type UpsertWriter interface {
+	// Upsert prepares an update that increments field by dn for a document with a given key.
+	// If the document does not exist, it is created from d first. Write becomes valid only after Flush.
+	Upsert(ctx context.Context, key Key, d Document, field string, dn int) error
+	// Flush waits for all writes to complete.
+	Flush(ctx context.Context) error
+	// Close closes writer and discards any unflushed updates.
+	Close() error
+}
+
+// BatchUpserter is an optional interface for databases that can upsert documents in batches.
+type BatchUpserter interface {
+	BatchUpsert(col string) UpsertWriter
+}
+
+// LogHorizoner is an optional interface for databases that can natively report the key
+// of the latest document written to a log collection.
+type LogHorizoner interface {
+	// LogHorizon returns the key of the latest document in the collection. Keys must grow
+	// with each write.
+	LogHorizon(ctx context.Context, col string) (graph.PrimaryKey, error)
+}
+
 // IndexType is a type of index for collection.
 type IndexType int
 
@@ -3,6 +3,7 @@ package nosqltest
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"math/rand"
 	"sync"
 	"testing"
@@ -91,6 +92,33 @@ func BenchmarkAll(t *testing.B, gen DatabaseFunc, conf *Config) {
 			return NewQuadStore(t, gen)
 		}, conf.quadStore())
 	})
+	t.Run("load", func(t *testing.B) {
+		benchmarkLoad(t, gen)
+	})
+}
+
+// benchmarkLoad writes batches of 100 quads per operation. Quads share most of
+// their nodes, thus each batch creates a few nodes and updates the rest of them.
+func benchmarkLoad(b *testing.B, gen DatabaseFunc) {
+	const batch = 100
+	qs, opts, closer := NewQuadStore(b, gen)
+	defer closer()
+	w := testutil.MakeWriter(b, qs, opts)
+
+	quads := make([]quad.Quad, batch)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range quads {
+			quads[j] = quad.Make(
+				fmt.Sprintf("s%d", i),
+				fmt.Sprintf("p%d", j%10),
+				fmt.Sprintf("o%d", j),
+				nil,
+			)
+		}
+		err := w.AddQuadSet(quads)
+		require.NoError(b, err)
+	}
 }
 
 func randString() string {
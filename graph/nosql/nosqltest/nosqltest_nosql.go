@@ -84,6 +84,7 @@ var testsNoSQLKey = []struct {
 	{name: "insert", t: testInsert},
 	{name: "delete by key", t: testDeleteByKey},
 	{name: "update", t: testUpdate},
+	{name: "batch upsert", t: testBatchUpsert},
 	{name: "delete query", t: testDeleteQuery},
 }
 
@@ -481,6 +482,49 @@ func testUpdate(t *testing.T, c tableConf) {
 	c.expectAll(t, exp)
 }
 
+func testBatchUpsert(t *testing.T, c tableConf) {
+	ctx := context.TODO()
+	c.ensurePK(t)
+
+	docs := []nosql.Document{
+		{"a": nosql.String("A")},
+		{"a": nosql.String("B")},
+	}
+	keys := []nosql.Key{c.kt.Gen(), c.kt.Gen()}
+	_, err := c.Insert(keys[1], nosql.Document{
+		"a": nosql.String("B"),
+		"n": nosql.Int(1),
+	})
+	require.NoError(t, err)
+
+	w := nosql.BatchUpsert(c.db, c.col)
+	defer w.Close()
+	// the first document is created by the first update in the batch
+	// and must be incremented by the second one
+	for _, i := range []int{0, 1, 0} {
+		err = w.Upsert(ctx, keys[i], docs[i], "n", 2)
+		require.NoError(t, err)
+	}
+	err = w.Flush(ctx)
+	require.NoError(t, err)
+
+	exp := []nosql.Document{
+		{
+			"a": nosql.String("A"),
+			"n": nosql.Int(4),
+		},
+		{
+			"a": nosql.String("B"),
+			"n": nosql.Int(3),
+		},
+	}
+	for i, k := range keys {
+		c.kt.SetKey(exp[i], k)
+		fixDoc(c.conf, exp[i])
+	}
+	c.expectAll(t, exp)
+}
+
 func testDeleteQuery(t *testing.T, c tableConf) {
 	ctx := context.TODO()
 	c.ensurePK(t)
@@ -193,6 +193,8 @@ func ensureIndexes(ctx context.Context, db Database) error {
 		{Fields: []string{fldPredicate}, Type: StringExact},
 		{Fields: []string{fldObject}, Type: StringExact},
 		{Fields: []string{fldLabel}, Type: StringExact},
+		// covers In/Out lookups by predicate with a fixed object
+		{Fields: []string{fldPredicate, fldObject}, Type: StringExact},
 	})
 	if err != nil {
 		return err
@@ -222,12 +224,12 @@ func (qs *QuadStore) nameToKey(name quad.Value) Key {
 	return node.key()
 }
 
-func (qs *QuadStore) updateNodeBy(ctx context.Context, key Key, name quad.Value, inc int) error {
+func (qs *QuadStore) updateNodeBy(ctx context.Context, w UpsertWriter, key Key, name quad.Value, inc int) error {
 	if inc == 0 {
 		return nil
 	}
 	d := qs.opt.toDocumentValue(name)
-	err := qs.db.Update(colNodes, key).Upsert(d).Inc(fldSize, inc).Do(ctx)
+	err := w.Upsert(ctx, key, d, fldSize, inc)
 	if err != nil {
 		return fmt.Errorf("error updating node: %v", err)
 	}
@@ -246,7 +248,7 @@ func (qs *QuadStore) cleanupNodes(ctx context.Context, keys []Key) error {
 	return err
 }
 
-func (qs *QuadStore) updateQuad(ctx context.Context, q quad.Quad, proc graph.Procedure) error {
+func (qs *QuadStore) updateQuad(ctx context.Context, w UpsertWriter, q quad.Quad, proc graph.Procedure) error {
 	var setname string
 	if proc == graph.Add {
 		setname = fldQuadAdded
@@ -261,8 +263,7 @@ func (qs *QuadStore) updateQuad(ctx context.Context, q quad.Quad, proc graph.Pro
 	if l := hashOf(q.Label); l != "" {
 		doc[fldLabel] = String(l)
 	}
-	err := qs.db.Update(colQuads, getKeyForQuad(q)).Upsert(doc).
-		Inc(setname, 1).Do(ctx)
+	err := w.Upsert(ctx, getKeyForQuad(q), doc, setname, 1)
 	if err != nil {
 		err = fmt.Errorf("quad update failed: %v", err)
 	}
@@ -291,6 +292,10 @@ func (qs *QuadStore) batchInsert(col string) DocWriter {
 	return BatchInsert(qs.db, col)
 }
 
+func (qs *QuadStore) batchUpsert(col string) UpsertWriter {
+	return BatchUpsert(qs.db, col)
+}
+
 func (qs *QuadStore) appendLog(ctx context.Context, deltas []graph.Delta) ([]Key, error) {
 	w := qs.batchInsert(colLog)
 	defer w.Close()
@@ -381,9 +386,11 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 	// make sure to create all nodes before writing any quads
 	// concurrent reads may observe broken quads in other case
 	var gc []Key
+	nw := qs.batchUpsert(colNodes)
+	defer nw.Close()
 	for name, dn := range ids {
 		key := qs.nameToKey(name)
-		err := qs.updateNodeBy(ctx, key, name, dn)
+		err := qs.updateNodeBy(ctx, nw, key, name, dn)
 		if err != nil {
 			return err
 		}
@@ -391,16 +398,24 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 			gc = append(gc, key)
 		}
 	}
+	if err := nw.Flush(ctx); err != nil {
+		return fmt.Errorf("error updating nodes: %v", err)
+	}
 	// gc nodes that has negative ref counter
 	if err := qs.cleanupNodes(ctx, gc); err != nil {
 		return err
 	}
+	qw := qs.batchUpsert(colQuads)
+	defer qw.Close()
 	for _, d := range deltas {
-		err := qs.updateQuad(ctx, d.Quad, d.Action)
+		err := qs.updateQuad(ctx, qw, d.Quad, d.Action)
 		if err != nil {
 			return &graph.DeltaError{Delta: d, Err: err}
 		}
 	}
+	if err := qw.Flush(ctx); err != nil {
+		return &graph.DeltaError{Err: fmt.Errorf("quad update failed: %v", err)}
+	}
 	return nil
 }
 
@@ -632,6 +647,24 @@ func (qs *QuadStore) Size() int64 {
 	return count
 }
 
+var _ graph.Horizoner = (*QuadStore)(nil)
+
+// Horizon returns the key of the latest entry in the delta log. The key is opaque and
+// is provided by the database, thus it returns an invalid key if the database does not
+// implement LogHorizoner.
+func (qs *QuadStore) Horizon() graph.PrimaryKey {
+	h, ok := qs.db.(LogHorizoner)
+	if !ok {
+		return graph.PrimaryKey{}
+	}
+	key, err := h.LogHorizon(context.TODO(), colLog)
+	if err != nil {
+		clog.Errorf("couldn't get the horizon: %v", err)
+		return graph.PrimaryKey{}
+	}
+	return key
+}
+
 func (qs *QuadStore) Close() error {
 	return qs.db.Close()
 }
@@ -3,6 +3,7 @@ package nosql
 import (
 	"fmt"
 	"math"
+	"regexp"
 	"strconv"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -12,7 +13,108 @@ import (
 )
 
 func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
-	return it, false // everything done is shapes
+	// most things are done in shapes, but value filters might be built directly
+	switch it.Type() {
+	case graph.Comparison, graph.Regex, graph.Prefix:
+		return qs.optimizeValueFilter(it)
+	}
+	return it, false
+}
+
+// optimizeValueFilter adds conditions of a value filter iterator to the query of a native
+// iterator over nodes. The filter iterator is kept on top of the new native iterator, unless
+// the query matches exactly the same values.
+func (qs *QuadStore) optimizeValueFilter(it graph.Iterator) (graph.Iterator, bool) {
+	var (
+		sub     graph.Iterator
+		filters []FieldFilter
+		exact   bool
+		wrap    func(sub graph.Iterator) graph.Iterator
+	)
+	fieldPath := func(s string) []string {
+		return []string{fldValue, s}
+	}
+	switch f := it.(type) {
+	case *iterator.Comparison:
+		sub = f.SubIterator()
+		switch f.Value().(type) {
+		case quad.IRI, quad.BNode:
+			exact = true
+		case quad.String:
+			// language-tagged and typed strings are matched as well
+		default:
+			// numbers and times are compared with typed literals of the same kind as well
+			return it, false
+		}
+		var ok bool
+		filters, ok = qs.opt.toFieldFilter(shape.Comparison{Op: f.Operator(), Val: f.Value()})
+		if !ok {
+			return it, false
+		}
+		wrap = func(sub graph.Iterator) graph.Iterator {
+			return iterator.NewComparison(sub, f.Operator(), f.Value(), qs)
+		}
+	case *iterator.Regex:
+		// regexp dialect of the database may differ
+		sub = f.SubIterator()
+		filters = []FieldFilter{
+			{Path: fieldPath(fldValData), Filter: Regexp, Value: String(f.Regexp().String())},
+		}
+		if !f.RefsAllowed() {
+			filters = append(filters, []FieldFilter{
+				{Path: fieldPath(fldIRI), Filter: NotEqual, Value: Bool(true)},
+				{Path: fieldPath(fldBNode), Filter: NotEqual, Value: Bool(true)},
+			}...)
+		}
+		wrap = func(sub graph.Iterator) graph.Iterator {
+			rit := iterator.NewRegex(sub, f.Regexp(), qs)
+			rit.AllowRefs(f.RefsAllowed())
+			return rit
+		}
+	case *iterator.Prefix:
+		sub = f.SubIterator()
+		filters = []FieldFilter{
+			{Path: fieldPath(fldValData), Filter: Regexp, Value: String("^" + regexp.QuoteMeta(f.Prefix()))},
+			{Path: fieldPath(fldIRI), Filter: NotEqual, Value: Bool(true)},
+			{Path: fieldPath(fldBNode), Filter: NotEqual, Value: Bool(true)},
+		}
+		exact = isPlainPattern(f.Prefix())
+		wrap = func(sub graph.Iterator) graph.Iterator {
+			return iterator.NewPrefix(sub, f.Prefix(), qs)
+		}
+	default:
+		return it, false
+	}
+	nodes, ok := sub.(*Iterator)
+	if !ok || nodes.collection != colNodes || nodes.limit > 0 {
+		return it, false
+	}
+	constraint := make([]FieldFilter, 0, len(nodes.constraint)+len(filters))
+	constraint = append(constraint, nodes.constraint...)
+	constraint = append(constraint, filters...)
+	nit := NewIterator(qs, colNodes, constraint...)
+	nit.tags.CopyFrom(nodes)
+	if exact {
+		nit.tags.CopyFrom(it)
+		return nit, true
+	}
+	out := wrap(nit)
+	out.Tagger().CopyFrom(it)
+	return out, true
+}
+
+// isPlainPattern checks if a string has no characters that are special in regexp
+// dialects of supported databases, thus it matches the same values in all of them.
+func isPlainPattern(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == ' ', r == '_', r == '-', r == '/', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 var _ shape.Optimizer = (*QuadStore)(nil)
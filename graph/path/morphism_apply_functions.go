@@ -16,6 +16,7 @@ package path
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
@@ -152,6 +153,37 @@ func inMorphism(tags []string, via ...interface{}) morphism {
 	}
 }
 
+// limitedInOutMorphism is like inMorphism and outMorphism, but follows at most limit quads
+// from each of the nodes. The reversed morphism follows all quads, since the limit cannot
+// be reversed.
+func limitedInOutMorphism(tags []string, limit int64, in bool, via ...interface{}) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			if in {
+				return outMorphism(tags, via...), ctx
+			}
+			return inMorphism(tags, via...), ctx
+		},
+		Apply: func(from shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			labels := ctx.labelSet
+			return morphismShape{
+				In: from,
+				step: func(s shape.Shape) shape.Shape {
+					if in {
+						return shape.In(s, buildVia(via...), labels, tags...)
+					}
+					return shape.Out(s, buildVia(via...), labels, tags...)
+				},
+				optimize: true,
+				build: func(qs graph.QuadStore, from graph.Iterator, step graph.ApplyMorphism) graph.Iterator {
+					return iterator.NewLimitPerNode(qs, from, step, limit)
+				},
+			}, ctx
+		},
+		tags: tags,
+	}
+}
+
 func bothMorphism(tags []string, via ...interface{}) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return bothMorphism(tags, via...), ctx },
@@ -196,7 +228,7 @@ func labelsMorphism() morphism {
 			panic("not implemented")
 		},
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.Labels(in), ctx
+			return shape.LabelsIn(in, ctx.labelSet), ctx
 		},
 	}
 }
@@ -209,7 +241,7 @@ func predicatesMorphism(isIn bool) morphism {
 			panic("not implemented: need a function from predicates to their associated edges")
 		},
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.Predicates(in, isIn), ctx
+			return shape.PredicatesLabels(in, ctx.labelSet, isIn), ctx
 		},
 	}
 }
@@ -222,7 +254,7 @@ func savePredicatesMorphism(isIn bool, tag string) morphism {
 			return savePredicatesMorphism(isIn, tag), ctx
 		},
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.SavePredicates(in, isIn, tag), ctx
+			return shape.SavePredicatesLabels(in, ctx.labelSet, isIn, tag), ctx
 		},
 	}
 }
@@ -277,13 +309,71 @@ func followMorphism(p *Path) morphism {
 	}
 }
 
-type iteratorBuilder func(qs graph.QuadStore) graph.Iterator
+var _ shape.ParamShape = morphismShape{}
 
-func (s iteratorBuilder) BuildIterator(qs graph.QuadStore) graph.Iterator {
-	return s(qs)
+// morphismShape builds an iterator that applies a morphism to results of the input
+// during execution. It keeps the shape of the morphism, thus parameters used in it
+// can be bound on execution of a prepared query.
+type morphismShape struct {
+	In shape.Shape
+	// step returns a shape of the morphism applied to a given input.
+	step func(in shape.Shape) shape.Shape
+	// optimize sets if optimizations should be applied to the input and to each step.
+	optimize bool
+	params   map[string]quad.Value
+	build    func(qs graph.QuadStore, in graph.Iterator, m graph.ApplyMorphism) graph.Iterator
 }
-func (s iteratorBuilder) Optimize(r shape.Optimizer) (shape.Shape, bool) {
-	return s, false
+
+func (s morphismShape) buildShape(qs graph.QuadStore, sh shape.Shape) graph.Iterator {
+	if s.optimize {
+		return shape.BuildIterator(qs, sh)
+	}
+	return sh.BuildIterator(qs)
+}
+
+func (s morphismShape) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	m := func(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+		sh := s.step(iteratorShape{it})
+		if s.params != nil {
+			var err error
+			if sh, err = shape.SubstParams(sh, s.params); err != nil {
+				return iterator.NewError(err)
+			}
+		}
+		return s.buildShape(qs, sh)
+	}
+	return s.build(qs, s.buildShape(qs, s.In), m)
+}
+func (s morphismShape) Optimize(r shape.Optimizer) (shape.Shape, bool) {
+	if r == nil {
+		return s, false
+	}
+	return r.OptimizeShape(s)
+}
+func (s morphismShape) Params() []string {
+	if s.params != nil {
+		return nil
+	}
+	names := shape.ParamsOf(s.In)
+	for _, name := range shape.ParamsOf(s.step(shape.AllNodes{})) {
+		if i := sort.SearchStrings(names, name); i >= len(names) || names[i] != name {
+			names = append(names, name)
+			sort.Strings(names)
+		}
+	}
+	return names
+}
+func (s morphismShape) BindParams(params map[string]quad.Value) (shape.Shape, error) {
+	in, err := shape.SubstParams(s.In, params)
+	if err != nil {
+		return nil, err
+	}
+	// check the morphism early, instead of failing on execution
+	if _, err = shape.SubstParams(s.step(shape.AllNodes{}), params); err != nil {
+		return nil, err
+	}
+	s.In, s.params = in, params
+	return s, nil
 }
 
 func followRecursiveMorphism(p *Path, maxDepth int, depthTags []string) morphism {
@@ -292,14 +382,36 @@ func followRecursiveMorphism(p *Path, maxDepth int, depthTags []string) morphism
 			return followRecursiveMorphism(p.Reverse(), maxDepth, depthTags), ctx
 		},
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return iteratorBuilder(func(qs graph.QuadStore) graph.Iterator {
-				in := in.BuildIterator(qs)
-				it := iterator.NewRecursive(qs, in, p.Morphism(), maxDepth)
-				for _, s := range depthTags {
-					it.AddDepthTag(s)
-				}
-				return it
-			}), ctx
+			return morphismShape{
+				In:   in,
+				step: p.ShapeFrom,
+				build: func(qs graph.QuadStore, in graph.Iterator, m graph.ApplyMorphism) graph.Iterator {
+					it := iterator.NewRecursive(qs, in, m, maxDepth)
+					for _, s := range depthTags {
+						it.AddDepthTag(s)
+					}
+					return it
+				},
+			}, ctx
+		},
+	}
+}
+
+func cyclesMorphism(p *Path, pathTag string) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			return cyclesMorphism(p.Reverse(), pathTag), ctx
+		},
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return morphismShape{
+				In:   in,
+				step: p.ShapeFrom,
+				build: func(qs graph.QuadStore, in graph.Iterator, m graph.ApplyMorphism) graph.Iterator {
+					it := iterator.NewCycleDetect(qs, in, m)
+					it.SetPathTag(pathTag)
+					return it
+				},
+			}, ctx
 		},
 	}
 }
@@ -338,7 +450,7 @@ func saveReverseMorphism(via interface{}, tag string) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return saveReverseMorphism(via, tag), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.SaveVia(in, buildVia(via), tag, true, false), ctx
+			return shape.SaveViaLabels(in, buildVia(via), ctx.labelSet, tag, true, false), ctx
 		},
 		tags: []string{tag},
 	}
@@ -348,7 +460,7 @@ func saveOptionalMorphism(via interface{}, tag string) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return saveOptionalMorphism(via, tag), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.SaveVia(in, buildVia(via), tag, false, true), ctx
+			return shape.SaveViaLabels(in, buildVia(via), ctx.labelSet, tag, false, true), ctx
 		},
 		tags: []string{tag},
 	}
@@ -358,7 +470,7 @@ func saveOptionalReverseMorphism(via interface{}, tag string) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return saveOptionalReverseMorphism(via, tag), ctx },
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
-			return shape.SaveVia(in, buildVia(via), tag, true, true), ctx
+			return shape.SaveViaLabels(in, buildVia(via), ctx.labelSet, tag, true, true), ctx
 		},
 		tags: []string{tag},
 	}
@@ -380,15 +492,32 @@ func buildVia(via ...interface{}) shape.Shape {
 			return shape.Lookup(p)
 		}
 	}
-	nodes := make([]quad.Value, 0, len(via))
+	var (
+		nodes = make([]quad.Value, 0, len(via))
+		paths shape.Union
+	)
 	for _, v := range via {
+		switch p := v.(type) {
+		case *Path:
+			// embed the query instead of resolving predicates in advance
+			paths = append(paths, p.Shape())
+			continue
+		case []quad.Value:
+			nodes = append(nodes, p...)
+			continue
+		}
 		qv, ok := quad.AsValue(v)
 		if !ok {
 			panic(fmt.Errorf("Invalid type passed to buildViaPath: %v (%T)", v, v))
 		}
 		nodes = append(nodes, qv)
 	}
-	return shape.Lookup(nodes)
+	if len(paths) == 0 {
+		return shape.Lookup(nodes)
+	} else if len(nodes) != 0 {
+		paths = append(shape.Union{shape.Lookup(nodes)}, paths...)
+	}
+	return paths
 }
 
 // skipMorphism will skip a number of values-- if there are none, this function
@@ -421,6 +550,58 @@ func limitMorphism(v int64) morphism {
 	}
 }
 
+// orderMorphism will sort values by their own value or by a value of a given tag.
+func orderMorphism(tag string, desc bool) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return orderMorphism(tag, desc), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.Sort{From: in, By: tag, Desc: desc}, ctx
+		},
+	}
+}
+
+// countDistinctMorphism will return an estimated count of distinct values.
+func countDistinctMorphism(precision int) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return countDistinctMorphism(precision), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.DistinctCount{Values: in, Precision: precision}, ctx
+		},
+	}
+}
+
+func isAll(s shape.Shape) bool {
+	_, ok := s.(shape.AllNodes)
+	return ok
+}
+
+// cardinalityViolationMorphism will return nodes that have more than max values for a predicate.
+func cardinalityViolationMorphism(via interface{}, max int64, tag string) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			return cardinalityViolationMorphism(via, max, tag), ctx
+		},
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			quads := make(shape.Quads, 0, 3)
+			if !isAll(in) {
+				quads = append(quads, shape.QuadFilter{Dir: quad.Subject, Values: in})
+			}
+			if p := buildVia(via); !isAll(p) {
+				quads = append(quads, shape.QuadFilter{Dir: quad.Predicate, Values: p})
+			}
+			if ctx.labelSet != nil && !isAll(ctx.labelSet) {
+				quads = append(quads, shape.QuadFilter{Dir: quad.Label, Values: ctx.labelSet})
+			}
+			if len(quads) == 0 {
+				// count all quads of each subject
+				quads = append(quads, shape.QuadFilter{Dir: quad.Subject, Values: in})
+			}
+			from := shape.NodesFrom{Dir: quad.Subject, Quads: quads}
+			return shape.CardinalityViolation{Values: from, Max: max, Tag: tag}, ctx
+		},
+	}
+}
+
 // countMorphism will return count of values.
 func countMorphism() morphism {
 	return morphism{
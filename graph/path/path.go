@@ -16,7 +16,9 @@ package path
 
 import (
 	"context"
+	"errors"
 	"regexp"
+	"sort"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
@@ -195,6 +197,30 @@ func (p *Path) Tag(tags ...string) *Path {
 	return np
 }
 
+// CheckTags returns graph.ErrTagCollision if the same tag is declared more than once
+// by steps of the path, for example, by Tag("x").Out().Tag("x"). A later binding of
+// such tag silently overwrites the earlier one in results.
+//
+// Tags declared by paths that are combined with this one, for example with And, Or or
+// Follow, are not checked, since each of these paths binds its tags independently.
+func (p *Path) CheckTags() error {
+	seen := make(map[string]bool)
+	var dup []string
+	for _, m := range p.stack {
+		for _, tag := range m.tags {
+			if seen[tag] {
+				dup = append(dup, tag)
+			}
+			seen[tag] = true
+		}
+	}
+	if len(dup) == 0 {
+		return nil
+	}
+	sort.Strings(dup)
+	return &graph.ErrTagCollision{Tags: dup}
+}
+
 // Out updates this Path to represent the nodes that are adjacent to the
 // current nodes, via the given outbound predicate.
 //
@@ -241,6 +267,26 @@ func (p *Path) OutWithTags(tags []string, via ...interface{}) *Path {
 	return np
 }
 
+// InWithLimit is like InWithTags, but follows at most limit quads into each of the
+// current nodes. It bounds the number of results when some nodes have too many links.
+func (p *Path) InWithLimit(limit int64, tags []string, via ...interface{}) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, limitedInOutMorphism(tags, limit, true, via...))
+	return np
+}
+
+// OutWithLimit is like OutWithTags, but follows at most limit quads from each of the
+// current nodes.
+//
+// For example:
+//  // Return at most 10 accounts followed by each of the users.
+//  StartPath(qs, users...).OutWithLimit(10, nil, "follows")
+func (p *Path) OutWithLimit(limit int64, tags []string, via ...interface{}) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, limitedInOutMorphism(tags, limit, false, via...))
+	return np
+}
+
 // Both updates this path following both inbound and outbound predicates.
 //
 // For example:
@@ -264,7 +310,7 @@ func (p *Path) BothWithTags(tags []string, via ...interface{}) *Path {
 }
 
 // Labels updates this path to represent the nodes of the labels
-// of inbound and outbound quads.
+// of inbound and outbound quads. Only labels from the current LabelContext are returned.
 func (p *Path) Labels() *Path {
 	np := p.clone()
 	np.stack = append(np.stack, labelsMorphism())
@@ -393,6 +439,29 @@ func (p *Path) FollowRecursive(via interface{}, maxDepth int, depthTags []string
 	return np
 }
 
+// Cycles will repeatedly follow the given string predicate or Path object
+// starting from the given node(s), and return nodes that participate in a
+// cycle. For example, it finds loops in a "parent" hierarchy that should be a tree.
+//
+// If pathTag is not empty, nodes of a cycle through each result are tagged as
+// "<pathTag>_0" (the result), "<pathTag>_1" and so on, in the order of the traversal.
+func (p *Path) Cycles(via interface{}, pathTag string) *Path {
+	var path *Path
+	switch v := via.(type) {
+	case string:
+		path = StartMorphism().Out(v)
+	case quad.Value:
+		path = StartMorphism().Out(v)
+	case *Path:
+		path = v
+	default:
+		panic("did not pass a string predicate or a Path to Cycles")
+	}
+	np := p.clone()
+	np.stack = append(p.stack, cyclesMorphism(path, pathTag))
+	return np
+}
+
 // Save will, from the current nodes in the path, retrieve the node
 // one linkage away (given by either a path or a predicate), add the given
 // tag, and propagate that to the result set.
@@ -452,8 +521,9 @@ func (p *Path) HasFilter(via interface{}, rev bool, filt ...shape.ValueFilter) *
 	return np
 }
 
-// LabelContext restricts the following operations (such as In, Out) to only
-// traverse edges that match the given set of labels.
+// LabelContext restricts the following operations (In, Out, Both, Has, Save and
+// its variants, predicates and labels lookups) to only traverse edges that match
+// the given set of labels. Calling it without arguments removes the restriction.
 func (p *Path) LabelContext(via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, labelContextMorphism(nil, via...))
@@ -513,6 +583,50 @@ func (p *Path) BuildIteratorOn(qs graph.QuadStore) graph.Iterator {
 	return shape.BuildIterator(qs, p.Shape())
 }
 
+// ErrNotTraversal is returned when links are requested for a path that does not end with a traversal.
+var ErrNotTraversal = errors.New("path: last step is not a traversal")
+
+// linksOf returns a shape of quads that are followed by the last traversal in a given shape.
+func linksOf(s shape.Shape) (shape.Shape, bool) {
+	switch s := s.(type) {
+	case shape.NodesFrom:
+		return s.Quads, true
+	case shape.Save:
+		return linksOf(s.From)
+	case shape.Union:
+		out := make(shape.Union, 0, len(s))
+		for _, sub := range s {
+			q, ok := linksOf(sub)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, q)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// LinksShape returns a shape of quads that were followed by the last step of the path.
+// The last step must be a traversal, like Out, In or Both.
+func (p *Path) LinksShape() (shape.Shape, error) {
+	s, ok := linksOf(p.Shape())
+	if !ok {
+		return nil, ErrNotTraversal
+	}
+	return s, nil
+}
+
+// BuildLinksIteratorOn returns an iterator of quads that were followed by the last step of the path.
+// See LinksShape for details.
+func (p *Path) BuildLinksIteratorOn(qs graph.QuadStore) (graph.Iterator, error) {
+	s, err := p.LinksShape()
+	if err != nil {
+		return nil, err
+	}
+	return shape.BuildIterator(qs, s), nil
+}
+
 // Morphism returns the morphism of this path.  The returned value is a
 // function that, when given a QuadStore and an existing Iterator, will
 // return a new Iterator that yields the subset of values from the existing
@@ -535,12 +649,48 @@ func (p *Path) Limit(v int64) *Path {
 	return p
 }
 
+// Order will sort values in result set in ascending order.
+func (p *Path) Order() *Path {
+	p.stack = append(p.stack, orderMorphism("", false))
+	return p
+}
+
+// OrderDesc will sort values in result set in descending order.
+func (p *Path) OrderDesc() *Path {
+	p.stack = append(p.stack, orderMorphism("", true))
+	return p
+}
+
+// OrderBy will sort results by a value of a given tag. Results without the tag are returned last.
+func (p *Path) OrderBy(tag string, desc bool) *Path {
+	p.stack = append(p.stack, orderMorphism(tag, desc))
+	return p
+}
+
 // Count will count a number of results as it's own result set.
 func (p *Path) Count() *Path {
 	p.stack = append(p.stack, countMorphism())
 	return p
 }
 
+// CountDistinct will estimate a number of distinct results as it's own result set.
+// Precision controls the accuracy and memory usage of the estimation (see iterator.DistinctCount);
+// zero means the default precision.
+func (p *Path) CountDistinct(precision int) *Path {
+	p.stack = append(p.stack, countDistinctMorphism(precision))
+	return p
+}
+
+// CardinalityViolation limits the paths to nodes that have more than max values for the
+// given predicate. It is useful for finding nodes that break an expected cardinality,
+// for example, multiple values for a single-valued property. If tag is not empty,
+// the number of values is saved with it.
+func (p *Path) CardinalityViolation(via interface{}, max int64, tag string) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, cardinalityViolationMorphism(via, max, tag))
+	return np
+}
+
 // Iterate is an shortcut for graph.Iterate.
 func (p *Path) Iterate(ctx context.Context) *graph.IterateChain {
 	return shape.Iterate(ctx, p.qs, p.Shape())
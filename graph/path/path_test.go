@@ -15,12 +15,41 @@
 package path_test
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph"
 	_ "github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/graph/path/pathtest"
+	"github.com/cayleygraph/cayley/quad"
 )
 
 func TestMorphisms(t *testing.T) {
 	pathtest.RunTestMorphisms(t, nil)
 }
+
+func TestCheckTags(t *testing.T) {
+	// the same tag declared twice by steps of a single path
+	p := path.StartMorphism().Tag("x").Out(quad.IRI("follows")).Tag("x")
+	err := p.CheckTags()
+	if e, ok := err.(*graph.ErrTagCollision); !ok {
+		t.Fatalf("expected tag collision, got: %v", err)
+	} else if !reflect.DeepEqual(e.Tags, []string{"x"}) {
+		t.Fatalf("unexpected tags: %v", e.Tags)
+	}
+	p = path.StartMorphism().Save(quad.IRI("follows"), "x").Save(quad.IRI("status"), "x")
+	if err := p.CheckTags(); err == nil {
+		t.Fatal("expected tag collision")
+	}
+
+	// paths combined with the intersection bind their tags independently
+	a := path.StartMorphism(quad.IRI("alice")).Tag("x")
+	b := path.StartMorphism(quad.IRI("bob")).Tag("x")
+	if err := a.And(b).CheckTags(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Or(b).CheckTags(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,6 +16,7 @@ package pathtest
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"regexp"
 	"sort"
@@ -176,6 +177,28 @@ func testSet(qs graph.QuadStore) []test {
 			path:    StartPath(qs, quad.Raw(vBob.String())).Out(StartPath(qs, quad.Raw(vPredicate.String())).Out(quad.Raw(vAre.String()))),
 			expect:  []quad.Value{vFred, vCool},
 		},
+		{
+			message: "out multiple predicates",
+			path:    StartPath(qs, vDani).Out(vFollows, vStatus),
+			expect:  []quad.Value{vBob, vGreg, vCool},
+		},
+		{
+			message: "out multiple predicates with tags",
+			path:    StartPath(qs, vDani).OutWithTags([]string{"pred"}, vFollows, vStatus),
+			expect:  []quad.Value{vFollows, vFollows, vStatus},
+			tag:     "pred",
+		},
+		{
+			message: "in path and predicate",
+			path:    StartPath(qs, vCool).In(StartPath(qs, vPredicate).Out(vAre).Is(vStatus), vFollows),
+			expect:  []quad.Value{vBob, vDani, vGreg},
+		},
+		{
+			message: "out path and predicate with tags",
+			path:    StartPath(qs, vDani).OutWithTags([]string{"pred"}, StartPath(qs, vPredicate).Out(vAre).Is(vStatus), vFollows),
+			expect:  []quad.Value{vFollows, vFollows, vStatus},
+			tag:     "pred",
+		},
 		{
 			message: "And",
 			path: StartPath(qs, vDani).Out(vFollows).And(
@@ -304,6 +327,22 @@ func testSet(qs graph.QuadStore) []test {
 			path:    StartPath(qs).Has(vStatus).Count(),
 			expect:  []quad.Value{quad.Int(5)},
 		},
+		{
+			message: "CountDistinct",
+			path:    StartPath(qs).Out(vFollows).CountDistinct(0),
+			expect:  []quad.Value{quad.Int(4)},
+		},
+		{
+			message: "CardinalityViolation",
+			path:    StartPath(qs).CardinalityViolation(vFollows, 1, ""),
+			expect:  []quad.Value{vCharlie, vDani},
+		},
+		{
+			message: "CardinalityViolation with count",
+			path:    StartPath(qs, vBob, vCharlie).CardinalityViolation(vFollows, 1, "n"),
+			tag:     "n",
+			expect:  []quad.Value{quad.Int(2)},
+		},
 		{
 			message: "double Has",
 			path:    StartPath(qs).Has(vStatus, vCool).Has(vFollows, vFred),
@@ -416,6 +455,16 @@ func testSet(qs graph.QuadStore) []test {
 			path:    StartPath(qs, vCharlie).FollowRecursive(vFollows, 1, nil),
 			expect:  []quad.Value{vBob, vDani},
 		},
+		{
+			message: "cycles (no loops)",
+			path:    StartPath(qs, vCharlie).Cycles(vFollows, ""),
+			expect:  nil,
+		},
+		{
+			message: "cycles (undirected)",
+			path:    StartPath(qs, vCharlie).Cycles(StartMorphism().Both(vFollows), ""),
+			expect:  []quad.Value{vAlice, vBob, vCharlie, vDani, vEmily, vFred, vGreg},
+		},
 		{
 			message: "find non-existent",
 			path:    StartPath(qs, quad.IRI("<not-existing>")),
@@ -427,6 +476,11 @@ func testSet(qs graph.QuadStore) []test {
 func RunTestMorphisms(t *testing.T, fnc testutil.DatabaseFunc) {
 	for _, ftest := range []func(*testing.T, testutil.DatabaseFunc){
 		testFollowRecursive,
+		testOrder,
+		testPrepared,
+		testLinks,
+		testLabelContext,
+		testDescribe,
 	} {
 		ftest(t, fnc)
 	}
@@ -448,6 +502,10 @@ func RunTestMorphisms(t *testing.T, fnc testutil.DatabaseFunc) {
 					err error
 				)
 				start := time.Now()
+				if err = test.path.CheckTags(); err != nil {
+					t.Error(err)
+					return
+				}
 				if test.tag == "" {
 					got, err = runTopLevel(qs, test.path, opt)
 				} else {
@@ -522,3 +580,399 @@ func testFollowRecursive(t *testing.T, fnc testutil.DatabaseFunc) {
 		})
 	}
 }
+
+func testLinks(t *testing.T, fnc testutil.DatabaseFunc) {
+	qs, closer := makeTestStore(t, fnc, []quad.Quad{
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("a", "follows", "c", "g"),
+		quad.MakeIRI("a", "status", "cool", ""),
+		quad.MakeIRI("d", "follows", "a", ""),
+	}...)
+	defer closer()
+
+	for _, c := range []struct {
+		name   string
+		path   *Path
+		expect []quad.Quad
+		err    error
+	}{
+		{
+			name: "out",
+			path: StartPath(qs, quad.IRI("a")).Out(quad.IRI("follows")),
+			expect: []quad.Quad{
+				quad.MakeIRI("a", "follows", "b", ""),
+				quad.MakeIRI("a", "follows", "c", "g"),
+			},
+		},
+		{
+			name: "tagged in",
+			path: StartPath(qs, quad.IRI("a")).In(quad.IRI("follows")).Tag("x"),
+			expect: []quad.Quad{
+				quad.MakeIRI("d", "follows", "a", ""),
+			},
+		},
+		{
+			name: "both",
+			path: StartPath(qs, quad.IRI("a")).Both(quad.IRI("follows")),
+			expect: []quad.Quad{
+				quad.MakeIRI("a", "follows", "b", ""),
+				quad.MakeIRI("a", "follows", "c", "g"),
+				quad.MakeIRI("d", "follows", "a", ""),
+			},
+		},
+		{
+			name: "not a traversal",
+			path: StartPath(qs, quad.IRI("a")).Out(quad.IRI("follows")).Is(quad.IRI("b")),
+			err:  ErrNotTraversal,
+		},
+	} {
+		t.Run("links "+c.name, func(t *testing.T) {
+			it, err := c.path.BuildLinksIteratorOn(qs)
+			if err != c.err {
+				t.Fatalf("unexpected error: %v", err)
+			} else if err != nil {
+				return
+			}
+			defer it.Close()
+			var got []quad.Quad
+			for it.Next(context.TODO()) {
+				got = append(got, qs.Quad(it.Result()))
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			sort.Sort(quad.ByQuadString(got))
+			sort.Sort(quad.ByQuadString(c.expect))
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("got: %v expected: %v", got, c.expect)
+			}
+		})
+	}
+}
+
+func testLabelContext(t *testing.T, fnc testutil.DatabaseFunc) {
+	qs, closer := makeTestStore(t, fnc, []quad.Quad{
+		quad.MakeIRI("a", "follows", "b", "g1"),
+		quad.MakeIRI("a", "follows", "b", "g2"),
+		quad.MakeIRI("a", "follows", "c", "g1"),
+		quad.MakeIRI("a", "status", "cool", "g2"),
+		quad.MakeIRI("d", "follows", "a", "g2"),
+		quad.MakeIRI("b", "likes", "a", "g1"),
+	}...)
+	defer closer()
+
+	var (
+		vA, vB, vC, vD = quad.IRI("a"), quad.IRI("b"), quad.IRI("c"), quad.IRI("d")
+		vG1, vG2       = quad.IRI("g1"), quad.IRI("g2")
+		vFollows       = quad.IRI("follows")
+		vLikes         = quad.IRI("likes")
+		vStatus        = quad.IRI("status")
+	)
+	start := func() *Path { return StartPath(qs, vA) }
+
+	for _, c := range []struct {
+		name   string
+		path   *Path
+		tag    string
+		expect []quad.Value
+	}{
+		{name: "out", path: start().LabelContext(vG1).Out(vFollows), expect: []quad.Value{vB, vC}},
+		{name: "in", path: start().LabelContext(vG1).In(vFollows), expect: nil},
+		{name: "both", path: start().LabelContext(vG2).Both(vFollows), expect: []quad.Value{vB, vD}},
+		{name: "cleared", path: start().LabelContext(vG2).LabelContext().Out(vFollows), expect: []quad.Value{vB, vB, vC}},
+		{name: "has", path: StartPath(qs).LabelContext(vG1).Has(vFollows, vC), expect: []quad.Value{vA}},
+		{name: "has other", path: StartPath(qs).LabelContext(vG2).Has(vFollows, vC), expect: nil},
+		{name: "save", path: start().LabelContext(vG2).Save(vFollows, "x"), tag: "x", expect: []quad.Value{vB}},
+		{name: "save reverse", path: start().LabelContext(vG2).SaveReverse(vFollows, "x"), tag: "x", expect: []quad.Value{vD}},
+		{name: "save reverse other", path: start().LabelContext(vG1).SaveReverse(vFollows, "x"), expect: nil},
+		{name: "save optional", path: start().LabelContext(vG1).SaveOptional(vStatus, "x"), expect: []quad.Value{vA}},
+		{name: "save optional tag", path: start().LabelContext(vG2).SaveOptional(vStatus, "x"), tag: "x", expect: []quad.Value{quad.IRI("cool")}},
+		{name: "save optional reverse", path: start().LabelContext(vG2).SaveOptionalReverse(vLikes, "x"), tag: "x", expect: nil},
+		{name: "out predicates", path: start().LabelContext(vG1).OutPredicates(), expect: []quad.Value{vFollows}},
+		{name: "in predicates", path: start().LabelContext(vG2).InPredicates(), expect: []quad.Value{vFollows}},
+		{name: "save predicates", path: start().LabelContext(vG1).SavePredicates(true, "p"), tag: "p", expect: []quad.Value{vLikes}},
+		{name: "labels", path: StartPath(qs, vC).Labels(), expect: []quad.Value{vG1}},
+		{name: "labels in context", path: start().LabelContext(vG2).Labels(), expect: []quad.Value{vG2}},
+		{name: "labels all", path: start().Labels(), expect: []quad.Value{vG1, vG2}},
+	} {
+		for _, opt := range []bool{true, false} {
+			name := "label context " + c.name
+			if !opt {
+				name += " (unoptimized)"
+			}
+			t.Run(name, func(t *testing.T) {
+				var (
+					got []quad.Value
+					err error
+				)
+				if c.tag == "" {
+					got, err = runTopLevel(qs, c.path, opt)
+				} else {
+					got, err = runTag(qs, c.path, c.tag, opt)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				sort.Sort(quad.ByValueString(got))
+				sort.Sort(quad.ByValueString(c.expect))
+				if !reflect.DeepEqual(got, c.expect) {
+					t.Errorf("got: %v expected: %v", got, c.expect)
+				}
+			})
+		}
+	}
+}
+
+// collectResults returns all results of the iterator with their tags as strings.
+func collectResults(t testing.TB, qs graph.QuadStore, it graph.Iterator) []string {
+	ctx := context.TODO()
+	var out []string
+	add := func() {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		r := quad.StringOf(qs.NameOf(it.Result()))
+		for _, k := range keys {
+			r += fmt.Sprintf(" %s=%v", k, qs.NameOf(tags[k]))
+		}
+		out = append(out, r)
+	}
+	for it.Next(ctx) {
+		add()
+		for it.NextPath(ctx) {
+			add()
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func testDescribe(t *testing.T, fnc testutil.DatabaseFunc) {
+	qs, closer := makeTestStore(t, fnc)
+	defer closer()
+	qs2, closer2 := makeTestStore(t, fnc)
+	defer closer2()
+
+	for _, test := range testSet(qs) {
+		t.Run("describe "+test.message, func(t *testing.T) {
+			if test.skip {
+				t.SkipNow()
+			}
+			it := test.path.BuildIteratorOn(qs)
+			if nit, ok := it.Optimize(); ok {
+				it = nit
+			}
+			defer it.Close()
+
+			data, err := graph.MarshalPlan(qs, it)
+			if err != nil {
+				t.Fatal(err)
+			}
+			it2, err := graph.UnmarshalPlan(data, qs2)
+			if err != nil {
+				t.Fatalf("cannot rebuild iterator: %v\n%s", err, data)
+			}
+			defer it2.Close()
+
+			exp := collectResults(t, qs, it)
+			got := collectResults(t, qs2, it2)
+			if !reflect.DeepEqual(got, exp) {
+				t.Errorf("unexpected results of rebuilt iterator:\n%v\nvs\n%v\n%s", got, exp, data)
+			}
+		})
+	}
+}
+
+func testOrder(t *testing.T, fnc testutil.DatabaseFunc) {
+	vAge := quad.IRI("age")
+	qs, closer := makeTestStore(t, fnc, []quad.Quad{
+		quad.Make(vAlice, vAge, quad.Int(30), nil),
+		quad.Make(vBob, vAge, quad.Int(25), nil),
+		quad.Make(vCharlie, vAge, quad.Int(35), nil),
+		quad.Make(vDani, vFollows, vAlice, nil),
+	}...)
+	defer closer()
+
+	for _, c := range []struct {
+		message string
+		path    *Path
+		expect  []quad.Value
+	}{
+		{
+			message: "order by value",
+			path:    StartPath(qs).Has(vAge).Order(),
+			expect:  []quad.Value{vAlice, vBob, vCharlie},
+		},
+		{
+			message: "order by value desc",
+			path:    StartPath(qs).Has(vAge).OrderDesc(),
+			expect:  []quad.Value{vCharlie, vBob, vAlice},
+		},
+		{
+			message: "order numbers",
+			path:    StartPath(qs).Out(vAge).Order(),
+			expect:  []quad.Value{quad.Int(25), quad.Int(30), quad.Int(35)},
+		},
+		{
+			message: "order by tag",
+			path:    StartPath(qs).Save(vAge, "age").OrderBy("age", false),
+			expect:  []quad.Value{vBob, vAlice, vCharlie},
+		},
+		{
+			message: "order by tag desc",
+			path:    StartPath(qs).Save(vAge, "age").OrderBy("age", true),
+			expect:  []quad.Value{vCharlie, vAlice, vBob},
+		},
+		{
+			message: "limit after order",
+			path:    StartPath(qs).Save(vAge, "age").OrderBy("age", true).Limit(2),
+			expect:  []quad.Value{vCharlie, vAlice},
+		},
+	} {
+		for _, opt := range []bool{true, false} {
+			unopt := ""
+			if !opt {
+				unopt = " (unoptimized)"
+			}
+			t.Run(c.message+unopt, func(t *testing.T) {
+				got, err := runTopLevel(qs, c.path, opt)
+				if err != nil {
+					t.Errorf("Failed to check %s%s: %v", c.message, unopt, err)
+					return
+				}
+				if !reflect.DeepEqual(got, c.expect) {
+					t.Errorf("Failed to %s%s, got: %v(%d) expected: %v(%d)", c.message, unopt, got, len(got), c.expect, len(c.expect))
+				}
+			})
+		}
+	}
+}
+
+func testPrepared(t *testing.T, fnc testutil.DatabaseFunc) {
+	qs, closer := makeTestStore(t, fnc)
+	defer closer()
+
+	ctx := context.TODO()
+	run := func(p *Prepared, params map[string]quad.Value) ([]quad.Value, error) {
+		pb, err := p.Iterate(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		got, err := pb.Paths(false).AllValues(qs)
+		sort.Sort(quad.ByValueString(got))
+		return got, err
+	}
+
+	pr := StartPath(qs, shape.Param("who")).Out(vFollows).Prepare()
+	defer pr.Close()
+	if params := pr.Params(); !reflect.DeepEqual(params, []string{"who"}) {
+		t.Fatalf("unexpected params: %v", params)
+	}
+	for _, c := range []struct {
+		who    quad.Value
+		expect []quad.Value
+	}{
+		{who: vBob, expect: []quad.Value{vFred}},
+		{who: vCharlie, expect: []quad.Value{vBob, vDani}},
+		{who: quad.IRI("<not-existing>"), expect: nil},
+	} {
+		got, err := run(pr, map[string]quad.Value{"who": c.who})
+		if err != nil {
+			t.Errorf("Failed to run prepared query for %v: %v", c.who, err)
+		} else if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("Failed to run prepared query for %v, got: %v expected: %v", c.who, got, c.expect)
+		}
+	}
+	if _, err := run(pr, nil); err == nil {
+		t.Error("expected an error for missing parameter")
+	}
+	if _, err := run(pr, map[string]quad.Value{"who": vBob, "what": vFollows}); err == nil {
+		t.Error("expected an error for unknown parameter")
+	}
+
+	// plan resolves "zed" node, thus it should be rebuilt when the store changes
+	pr = StartPath(qs, quad.IRI("zed")).Has(vFollows, shape.Param("who")).Prepare()
+	defer pr.Close()
+	params := map[string]quad.Value{"who": vAlice}
+	if got, err := run(pr, params); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 0 {
+		t.Fatalf("unexpected results: %v", got)
+	}
+	w := testutil.MakeWriter(t, qs, nil)
+	if err := w.AddQuad(quad.Make(quad.IRI("zed"), vFollows, vAlice, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := run(pr, params); err != nil {
+		t.Fatal(err)
+	} else if expect := []quad.Value{quad.IRI("zed")}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("stale plan, got: %v expected: %v", got, expect)
+	}
+
+	// plan is kept until the store advances by more than MaxStale;
+	// stores count the advance differently, thus it's measured for a single write
+	position := func() (int64, bool) {
+		if h, ok := graph.Unwrap(qs).(graph.Horizoner); ok {
+			if k := h.Horizon(); k.Valid() {
+				if !k.IsSequential() {
+					return 0, false
+				}
+				return k.Int(), true
+			}
+		}
+		return qs.Size(), true
+	}
+	pr = StartPath(qs, quad.IRI("yan")).Has(vFollows, shape.Param("who")).Prepare()
+	defer pr.Close()
+	before, sequential := position()
+	if err := w.AddQuad(quad.Make(quad.IRI("yan"), vFollows, vAlice, nil)); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := position()
+	pr.MaxStale = after - before
+	if got, err := run(pr, params); err != nil {
+		t.Fatal(err)
+	} else if sequential && len(got) != 0 {
+		t.Errorf("plan was rebuilt too early: %v", got)
+	}
+	if err := w.AddQuad(quad.Make(quad.IRI("yan"), vFollows, vBob, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := run(pr, params); err != nil {
+		t.Fatal(err)
+	} else if expect := []quad.Value{quad.IRI("yan")}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("stale plan, got: %v expected: %v", got, expect)
+	}
+
+	// parameters of recursive morphisms are bound on each execution
+	pr = StartPath(qs, shape.Param("who")).FollowRecursive(
+		StartMorphism().Out(shape.Param("via")), 0, nil,
+	).Prepare()
+	defer pr.Close()
+	if params := pr.Params(); !reflect.DeepEqual(params, []string{"via", "who"}) {
+		t.Fatalf("unexpected params: %v", params)
+	}
+	expect, err := StartPath(qs, vCharlie).FollowRecursive(vFollows, 0, nil).Iterate(ctx).Paths(false).AllValues(qs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(quad.ByValueString(expect))
+	if len(expect) == 0 {
+		t.Fatal("expected results for a recursive query")
+	}
+	if got, err := run(pr, map[string]quad.Value{"who": vCharlie, "via": vFollows}); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results of recursive query, got: %v expected: %v", got, expect)
+	}
+	if _, err := run(pr, map[string]quad.Value{"who": vCharlie}); err == nil {
+		t.Error("expected an error for missing parameter")
+	}
+}
@@ -0,0 +1,179 @@
+package path
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Prepared is a path with a pre-built iterator tree that can be executed
+// multiple times with different parameters (see shape.Param).
+//
+// Each execution clones the tree, replaces parameter placeholders with nodes and
+// applies iterator optimizations. Plans that depend on the content of the quad
+// store are rebuilt once the horizon of the store advances by more than MaxStale.
+//
+// Parameters used in parts of the query that are built during execution, for example
+// in FollowRecursive, cannot be bound in a pre-built tree. For such queries the tree
+// is built on each execution, after parameters are substituted.
+type Prepared struct {
+	// MaxStale is the maximal advance of the quad store horizon before the plan is rebuilt.
+	// For stores with opaque horizons any advance rebuilds the plan. For stores that do
+	// not track their horizon, it's the maximal difference in the number of quads.
+	// Negative value disables re-planning.
+	MaxStale int64
+
+	qs     graph.QuadStore
+	s      shape.Shape
+	params []string
+	deps   bool // plan depends on the content of the quad store
+	subst  bool // params must be substituted before building the tree
+
+	mu      sync.Mutex
+	it      graph.Iterator
+	horizon graph.PrimaryKey
+	size    int64 // used if the store doesn't track its horizon
+}
+
+// Prepare builds an iterator tree for the path and returns a prepared query.
+func (p *Path) Prepare() *Prepared {
+	if p.IsMorphism() {
+		panic("Preparing a morphism. Bind a QuadStore with PrepareOn(qs)")
+	}
+	return p.PrepareOn(p.qs)
+}
+
+// PrepareOn builds an iterator tree for the path on the given QuadStore and
+// returns a prepared query.
+func (p *Path) PrepareOn(qs graph.QuadStore) *Prepared {
+	s := p.Shape()
+	_, deps := graph.Unwrap(qs).(shape.Optimizer)
+	if !deps {
+		shape.Walk(s, func(s shape.Shape) bool {
+			if l, ok := s.(shape.Lookup); ok {
+				for _, v := range l {
+					if _, ok := v.(shape.Param); !ok {
+						deps = true
+						break
+					}
+				}
+			}
+			return !deps
+		})
+	}
+	pr := &Prepared{qs: qs, s: s, params: shape.ParamsOf(s), deps: deps}
+	if shape.HasHiddenParams(s) {
+		pr.subst = true
+	} else {
+		pr.plan()
+	}
+	return pr
+}
+
+// currentHorizon returns the horizon of the quad store, or an invalid key if it's not tracked.
+func (p *Prepared) currentHorizon() graph.PrimaryKey {
+	if h, ok := graph.Unwrap(p.qs).(graph.Horizoner); ok {
+		return h.Horizon()
+	}
+	return graph.PrimaryKey{}
+}
+
+// plan builds a new iterator tree. Caller must hold the lock.
+func (p *Prepared) plan() {
+	if p.it != nil {
+		p.it.Close()
+	}
+	p.horizon = p.currentHorizon()
+	if !p.horizon.Valid() {
+		p.size = p.qs.Size()
+	}
+	p.it = shape.BuildIterator(p.qs, p.s)
+}
+
+// isStale checks if the plan must be rebuilt. Caller must hold the lock.
+func (p *Prepared) isStale() bool {
+	if !p.deps || p.MaxStale < 0 {
+		return false
+	}
+	if !p.horizon.Valid() {
+		d := p.qs.Size() - p.size
+		if d < 0 {
+			d = -d
+		}
+		return d > p.MaxStale
+	}
+	h := p.currentHorizon()
+	if !h.Valid() || h.Compare(p.horizon) <= 0 {
+		return false
+	}
+	if !h.IsSequential() || !p.horizon.IsSequential() {
+		return true
+	}
+	return h.Int()-p.horizon.Int() > p.MaxStale
+}
+
+// Params returns a sorted list of parameter names of the query.
+func (p *Prepared) Params() []string {
+	return append([]string{}, p.params...)
+}
+
+// BuildIterator returns a new iterator with parameters replaced by given values.
+// An error is returned if some parameters are missing or unknown.
+func (p *Prepared) BuildIterator(params map[string]quad.Value) (graph.Iterator, error) {
+	for _, name := range p.params {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("no value for parameter %q", name)
+		}
+	}
+	if len(params) > len(p.params) {
+		for name := range params {
+			if i := sort.SearchStrings(p.params, name); i >= len(p.params) || p.params[i] != name {
+				return nil, fmt.Errorf("unknown parameter %q", name)
+			}
+		}
+	}
+	if p.subst {
+		s, err := shape.SubstParams(p.s, params)
+		if err != nil {
+			return nil, err
+		}
+		return shape.BuildIterator(p.qs, s), nil
+	}
+	p.mu.Lock()
+	if p.it == nil || p.isStale() {
+		p.plan()
+	}
+	it := p.it.Clone()
+	p.mu.Unlock()
+	if err := shape.BindParams(p.qs, it, params); err != nil {
+		it.Close()
+		return nil, err
+	}
+	return it, nil
+}
+
+// Iterate is an analog of Path.Iterate for prepared queries.
+func (p *Prepared) Iterate(ctx context.Context, params map[string]quad.Value) (*graph.IterateChain, error) {
+	it, err := p.BuildIterator(params)
+	if err != nil {
+		return nil, err
+	}
+	return graph.Iterate(ctx, it).On(p.qs), nil
+}
+
+// Close releases the iterator tree of the prepared query.
+func (p *Prepared) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.it == nil {
+		return nil
+	}
+	err := p.it.Close()
+	p.it = nil
+	return err
+}
@@ -0,0 +1,129 @@
+package path
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// DefaultSubgraphLimit is the default maximal number of quads returned by Subgraph.
+const DefaultSubgraphLimit = 10000
+
+// SubgraphOptions controls how Subgraph expands seed nodes.
+type SubgraphOptions struct {
+	// Depth is the number of hops to expand from seed nodes. Zero value only
+	// returns quads of seed nodes.
+	Depth int
+	// Dir is a direction of the expansion: quad.Subject follows links from subjects
+	// to objects (outgoing), quad.Object follows links from objects to subjects
+	// (incoming), and quad.Any follows links in both directions.
+	Dir quad.Direction
+	// Limit is the maximal number of quads to return. Zero value means DefaultSubgraphLimit.
+	Limit int
+}
+
+// SubgraphStats describes the result of Subgraph.
+type SubgraphStats struct {
+	Nodes     int  // number of expanded nodes
+	Quads     int  // number of quads written
+	Truncated bool // set if the limit was reached before the expansion was done
+}
+
+// Subgraph runs a bounded breadth-first search from seed nodes and writes all quads
+// of nodes within the expansion to w. Each quad is written once.
+//
+// Nodes are expanded up to opt.Depth hops from seeds in a given direction, and for each
+// of them, quads that have the node as a subject (outgoing direction), an object
+// (incoming direction), or either of them (both directions) are written. Predicates and
+// labels are never expanded.
+//
+// The search stops when opt.Limit quads were written. It's not an error, but the result
+// is marked as truncated.
+func Subgraph(ctx context.Context, qs graph.QuadStore, seeds []graph.Value, opt SubgraphOptions, w quad.Writer) (SubgraphStats, error) {
+	var dirs []quad.Direction
+	switch opt.Dir {
+	case quad.Subject:
+		dirs = []quad.Direction{quad.Subject}
+	case quad.Object:
+		dirs = []quad.Direction{quad.Object}
+	case quad.Any:
+		dirs = []quad.Direction{quad.Subject, quad.Object}
+	default:
+		return SubgraphStats{}, fmt.Errorf("unsupported subgraph direction: %v", opt.Dir)
+	}
+	if opt.Depth < 0 {
+		return SubgraphStats{}, fmt.Errorf("invalid subgraph depth: %d", opt.Depth)
+	}
+	limit := opt.Limit
+	if limit <= 0 {
+		limit = DefaultSubgraphLimit
+	}
+	var (
+		st      SubgraphStats
+		visited = make(map[interface{}]struct{})
+		written = make(map[interface{}]struct{})
+		front   []graph.Value
+	)
+	for _, v := range seeds {
+		if v == nil {
+			continue
+		}
+		if _, ok := visited[graph.ToKey(v)]; ok {
+			continue
+		}
+		visited[graph.ToKey(v)] = struct{}{}
+		front = append(front, v)
+	}
+	for depth := 0; len(front) != 0; depth++ {
+		var next []graph.Value
+		for _, node := range front {
+			st.Nodes++
+			for _, d := range dirs {
+				it := qs.QuadIterator(d, node)
+				for it.Next(ctx) {
+					qv := it.Result()
+					key := graph.ToKey(qv)
+					if _, ok := written[key]; ok {
+						continue
+					}
+					if len(written) >= limit {
+						st.Truncated = true
+						break
+					}
+					written[key] = struct{}{}
+					if err := w.WriteQuad(qs.Quad(qv)); err != nil {
+						it.Close()
+						return st, err
+					}
+					st.Quads++
+					if depth >= opt.Depth {
+						continue
+					}
+					other := quad.Object
+					if d == quad.Object {
+						other = quad.Subject
+					}
+					nv := qs.QuadDirection(qv, other)
+					if nv == nil {
+						continue
+					}
+					if _, ok := visited[graph.ToKey(nv)]; !ok {
+						visited[graph.ToKey(nv)] = struct{}{}
+						next = append(next, nv)
+					}
+				}
+				err := it.Err()
+				it.Close()
+				if err != nil {
+					return st, err
+				} else if st.Truncated {
+					return st, nil
+				}
+			}
+		}
+		front = next
+	}
+	return st, ctx.Err()
+}
@@ -0,0 +1,83 @@
+package path_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+type quadList []quad.Quad
+
+func (l *quadList) WriteQuad(q quad.Quad) error {
+	*l = append(*l, q)
+	return nil
+}
+
+func (l quadList) Strings() []string {
+	out := make([]string, 0, len(l))
+	for _, q := range l {
+		out = append(out, q.NQuad())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestSubgraph(t *testing.T) {
+	var (
+		ab = quad.MakeIRI("a", "follows", "b", "")
+		bc = quad.MakeIRI("b", "follows", "c", "")
+		cd = quad.MakeIRI("c", "follows", "d", "")
+		ea = quad.MakeIRI("e", "follows", "a", "")
+		xy = quad.MakeIRI("x", "likes", "y", "")
+	)
+	qs := memstore.New(ab, bc, cd, ea, xy)
+	seeds := []graph.Value{qs.ValueOf(quad.IRI("a"))}
+
+	for _, c := range []struct {
+		name      string
+		opt       path.SubgraphOptions
+		expect    quadList
+		nodes     int
+		truncated bool
+	}{
+		{name: "depth 0", opt: path.SubgraphOptions{Depth: 0, Dir: quad.Any},
+			expect: quadList{ab, ea}, nodes: 1},
+		{name: "depth 1", opt: path.SubgraphOptions{Depth: 1, Dir: quad.Any},
+			expect: quadList{ab, ea, bc}, nodes: 3},
+		{name: "depth 2", opt: path.SubgraphOptions{Depth: 2, Dir: quad.Any},
+			expect: quadList{ab, ea, bc, cd}, nodes: 4},
+		{name: "depth 2 out", opt: path.SubgraphOptions{Depth: 2, Dir: quad.Subject},
+			expect: quadList{ab, bc, cd}, nodes: 3},
+		{name: "depth 2 in", opt: path.SubgraphOptions{Depth: 2, Dir: quad.Object},
+			expect: quadList{ea}, nodes: 2},
+		{name: "limit", opt: path.SubgraphOptions{Depth: 2, Dir: quad.Any, Limit: 2},
+			nodes: 1, truncated: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var out quadList
+			st, err := path.Subgraph(context.TODO(), qs, seeds, c.opt, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.truncated {
+				if !st.Truncated || len(out) != c.opt.Limit {
+					t.Fatalf("expected %d quads and truncation, got: %d (%v)", c.opt.Limit, len(out), st.Truncated)
+				}
+				return
+			}
+			if got, exp := out.Strings(), c.expect.Strings(); !reflect.DeepEqual(got, exp) {
+				t.Errorf("unexpected quads:\n%q\nvs\n%q", got, exp)
+			}
+			expect := path.SubgraphStats{Nodes: c.nodes, Quads: len(c.expect)}
+			if st != expect {
+				t.Errorf("unexpected stats: %+v vs %+v", st, expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type pkType uint8
+
+const (
+	pkNone = pkType(iota)
+	pkSequential
+	pkUnique
+)
+
+// PrimaryKey identifies a position in the history of writes to the quad store, e.g. its horizon.
+//
+// A key is either a sequential int64 counter (used by KV stores and memstore), or an opaque token
+// assigned by the backend (for example, Mongo ObjectIDs). Tokens are compared lexicographically,
+// thus backends should encode them in a way that preserves the order of writes.
+//
+// Zero value of PrimaryKey is not a valid key and means that the horizon is unknown.
+type PrimaryKey struct {
+	typ   pkType
+	seq   int64
+	token string
+}
+
+// NewSequentialKey creates a sequential primary key from an int64 counter.
+func NewSequentialKey(n int64) PrimaryKey {
+	return PrimaryKey{typ: pkSequential, seq: n}
+}
+
+// NewUniqueKey creates a primary key from an opaque token.
+//
+// Token must not be a decimal integer, since it will be parsed as a sequential key.
+func NewUniqueKey(token string) PrimaryKey {
+	return PrimaryKey{typ: pkUnique, token: token}
+}
+
+// ParsePrimaryKey parses a text form of the primary key. It accepts both decimal sequential
+// keys (the legacy horizon encoding) and opaque tokens.
+func ParsePrimaryKey(s string) (PrimaryKey, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return PrimaryKey{}, fmt.Errorf("empty primary key")
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return NewSequentialKey(n), nil
+	}
+	return NewUniqueKey(s), nil
+}
+
+// Valid checks if the key was set.
+func (p PrimaryKey) Valid() bool {
+	return p.typ != pkNone
+}
+
+// IsSequential checks if the key is an int64 counter.
+func (p PrimaryKey) IsSequential() bool {
+	return p.typ == pkSequential
+}
+
+// Int returns the value of a sequential key. It returns 0 for other key types.
+func (p PrimaryKey) Int() int64 {
+	return p.seq
+}
+
+// Next returns the smallest key that is greater than the current one.
+//
+// For sequential keys it increments the counter. For opaque tokens it returns an immediate
+// lexicographic successor, which may not correspond to any write.
+func (p PrimaryKey) Next() PrimaryKey {
+	switch p.typ {
+	case pkSequential:
+		return NewSequentialKey(p.seq + 1)
+	case pkUnique:
+		return NewUniqueKey(p.token + "\x00")
+	}
+	return p
+}
+
+// Compare returns -1, 0 or 1 if the key is less than, equal or greater than a given key.
+//
+// Keys of different types are ordered by type: invalid keys first, then sequential keys
+// and opaque tokens.
+func (p PrimaryKey) Compare(o PrimaryKey) int {
+	if p.typ != o.typ {
+		if p.typ < o.typ {
+			return -1
+		}
+		return 1
+	}
+	switch p.typ {
+	case pkSequential:
+		if p.seq < o.seq {
+			return -1
+		} else if p.seq > o.seq {
+			return 1
+		}
+	case pkUnique:
+		return strings.Compare(p.token, o.token)
+	}
+	return 0
+}
+
+func (p PrimaryKey) String() string {
+	switch p.typ {
+	case pkSequential:
+		return strconv.FormatInt(p.seq, 10)
+	case pkUnique:
+		return p.token
+	}
+	return ""
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p PrimaryKey) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. See ParsePrimaryKey.
+//
+// Unlike ParsePrimaryKey, it decodes an empty string as an empty opaque token.
+func (p *PrimaryKey) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*p = NewUniqueKey("")
+		return nil
+	}
+	v, err := ParsePrimaryKey(string(b))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Sequential keys are encoded as numbers for
+// compatibility with existing clients, opaque tokens are encoded as strings.
+func (p PrimaryKey) MarshalJSON() ([]byte, error) {
+	switch p.typ {
+	case pkSequential:
+		return []byte(strconv.FormatInt(p.seq, 10)), nil
+	case pkUnique:
+		return json.Marshal(p.token)
+	}
+	return []byte("null"), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts both numbers and strings.
+func (p *PrimaryKey) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*p = PrimaryKey{}
+		return nil
+	}
+	if len(b) != 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		return p.UnmarshalText([]byte(s))
+	}
+	var n int64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("invalid primary key: %v", err)
+	}
+	*p = NewSequentialKey(n)
+	return nil
+}
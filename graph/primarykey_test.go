@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPrimaryKeyCompare(t *testing.T) {
+	for _, c := range []struct {
+		a, b PrimaryKey
+		exp  int
+	}{
+		{a: NewSequentialKey(1), b: NewSequentialKey(1), exp: 0},
+		{a: NewSequentialKey(1), b: NewSequentialKey(2), exp: -1},
+		{a: NewSequentialKey(10), b: NewSequentialKey(2), exp: 1},
+		{a: NewUniqueKey("5a0b"), b: NewUniqueKey("5a0c"), exp: -1},
+		{a: NewUniqueKey("5a0b"), b: NewUniqueKey("5a0b"), exp: 0},
+		{a: PrimaryKey{}, b: NewSequentialKey(0), exp: -1},
+		{a: NewUniqueKey("a"), b: NewSequentialKey(100), exp: 1},
+	} {
+		if got := c.a.Compare(c.b); got != c.exp {
+			t.Errorf("compare(%v, %v): got %d, expected %d", c.a, c.b, got, c.exp)
+		}
+		if got := c.b.Compare(c.a); got != -c.exp {
+			t.Errorf("compare(%v, %v): got %d, expected %d", c.b, c.a, got, -c.exp)
+		}
+	}
+}
+
+func TestPrimaryKeyNext(t *testing.T) {
+	for _, k := range []PrimaryKey{
+		NewSequentialKey(0), NewSequentialKey(41), NewUniqueKey(""), NewUniqueKey("5a0b"),
+	} {
+		if k.Next().Compare(k) <= 0 {
+			t.Errorf("next key of %v is not greater: %v", k, k.Next())
+		}
+	}
+	if n := NewSequentialKey(41).Next().Int(); n != 42 {
+		t.Errorf("unexpected next sequential key: %d", n)
+	}
+}
+
+func TestPrimaryKeyEncoding(t *testing.T) {
+	for _, c := range []struct {
+		key  PrimaryKey
+		text string
+		json string
+	}{
+		{key: NewSequentialKey(42), text: "42", json: `42`},
+		{key: NewUniqueKey("5a0b0c7e9d3f"), text: "5a0b0c7e9d3f", json: `"5a0b0c7e9d3f"`},
+		{key: NewUniqueKey(""), text: "", json: `""`},
+	} {
+		b, err := c.key.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		} else if string(b) != c.text {
+			t.Errorf("unexpected text: %q vs %q", b, c.text)
+		}
+		var k PrimaryKey
+		if err = k.UnmarshalText(b); err != nil {
+			t.Fatal(err)
+		} else if k != c.key {
+			t.Errorf("unexpected key: %#v vs %#v", k, c.key)
+		}
+
+		b, err = json.Marshal(c.key)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(b) != c.json {
+			t.Errorf("unexpected json: %s vs %s", b, c.json)
+		}
+		k = PrimaryKey{}
+		if err = json.Unmarshal(b, &k); err != nil {
+			t.Fatal(err)
+		} else if k != c.key {
+			t.Errorf("unexpected key: %#v vs %#v", k, c.key)
+		}
+	}
+
+	// legacy horizon encoding
+	for _, s := range []string{`7`, `"7"`} {
+		var k PrimaryKey
+		if err := json.Unmarshal([]byte(s), &k); err != nil {
+			t.Fatal(err)
+		} else if k != NewSequentialKey(7) {
+			t.Errorf("unexpected key for %s: %#v", s, k)
+		}
+	}
+	if _, err := ParsePrimaryKey(""); err == nil {
+		t.Error("expected an error for an empty key")
+	}
+}
@@ -36,7 +36,7 @@ type BatchQuadStore interface {
 }
 
 func ValuesOf(ctx context.Context, qs QuadStore, vals []Value) ([]quad.Value, error) {
-	if bq, ok := qs.(BatchQuadStore); ok {
+	if bq, ok := Unwrap(qs).(BatchQuadStore); ok && FeaturesOf(qs).BulkLookup {
 		return bq.ValuesOf(ctx, vals)
 	}
 	out := make([]quad.Value, len(vals))
@@ -47,7 +47,7 @@ func ValuesOf(ctx context.Context, qs QuadStore, vals []Value) ([]quad.Value, er
 }
 
 func RefsOf(ctx context.Context, qs QuadStore, nodes []quad.Value) ([]Value, error) {
-	if bq, ok := qs.(BatchQuadStore); ok {
+	if bq, ok := Unwrap(qs).(BatchQuadStore); ok && FeaturesOf(qs).BulkLookup {
 		return bq.RefsOf(ctx, nodes)
 	}
 	values := make([]Value, len(nodes))
@@ -111,6 +111,27 @@ type QuadStore interface {
 	QuadDirection(id Value, d quad.Direction) Value
 }
 
+// Horizoner is an optional interface for quad stores that track their horizon.
+// Horizon is a value that grows with every write to the quad store.
+type Horizoner interface {
+	// Horizon returns the current horizon of the quad store.
+	// It returns an invalid key if the horizon cannot be determined.
+	Horizon() PrimaryKey
+}
+
+// Snapshotter is an optional interface for quad stores that can provide a consistent
+// read-only view of their content.
+type Snapshotter interface {
+	Horizoner
+	// Snapshot returns a read-only view of the quad store at the current horizon.
+	// Writes to the quad store are not visible in the snapshot. Closing the snapshot
+	// releases its resources, but does not close the quad store.
+	//
+	// It returns ErrSnapshotNotSupported if the quad store cannot provide the snapshot
+	// in its current configuration.
+	Snapshot() (QuadStore, error)
+}
+
 type Options map[string]interface{}
 
 var (
@@ -156,8 +177,46 @@ func (d Options) BoolKey(key string, def bool) (bool, error) {
 var (
 	ErrDatabaseExists = errors.New("quadstore: cannot init; database already exists")
 	ErrNotInitialized = errors.New("quadstore: not initialized")
+
+	ErrSnapshotNotSupported = errors.New("quadstore: snapshots are not supported")
 )
 
+// ErrWrongBackend is returned when opening a database that was created by a different backend.
+type ErrWrongBackend struct {
+	Found    string // empty if the backend that created the database is not known
+	Expected string
+}
+
+func (e *ErrWrongBackend) Error() string {
+	if e.Found == "" {
+		return fmt.Sprintf("quadstore: database was not created by %q backend", e.Expected)
+	}
+	return fmt.Sprintf("quadstore: database was created by %q backend, not %q", e.Found, e.Expected)
+}
+
+// ErrIncompatibleVersion is returned when opening a database with a data format version
+// that is not supported by the backend.
+type ErrIncompatibleVersion struct {
+	Found    int64
+	Expected int64
+}
+
+func (e *ErrIncompatibleVersion) Error() string {
+	return fmt.Sprintf("quadstore: incompatible data version %d, expected %d", e.Found, e.Expected)
+}
+
+// Pushdownable is an optional interface for quad stores that can execute
+// iterator subtrees natively, for example as a single database query.
+type Pushdownable interface {
+	// Pushdown offers an optimized iterator subtree to the quad store. It returns
+	// a native iterator that replaces the subtree, or nil to decline.
+	//
+	// The returned iterator must produce the same results and tags as the subtree.
+	// The quad store must not modify the subtree. If the subtree is replaced, it is
+	// closed by the caller, thus the returned iterator must not reference it.
+	Pushdown(it Iterator) Iterator
+}
+
 type BulkLoader interface {
 	// BulkLoad loads Quads from a quad.Unmarshaler in bulk to the QuadStore.
 	// It returns ErrCannotBulkLoad if bulk loading is not possible. For example if
@@ -25,6 +25,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 
 	"github.com/cayleygraph/cayley/quad"
 )
@@ -48,9 +49,18 @@ const (
 	Delete Procedure = -1
 )
 
+// Delta is a single change of the quad store.
+//
+// Besides the quad and the action, a delta carries metadata of the write. The writer
+// sets the Timestamp if it's not set by the caller, and the Actor if it was wrapped with
+// WriterWithActor. The ID is assigned by quad stores that keep a history of changes,
+// and is zero for deltas that were not yet applied.
 type Delta struct {
-	Quad   quad.Quad
-	Action Procedure
+	ID        PrimaryKey
+	Quad      quad.Quad
+	Action    Procedure
+	Timestamp time.Time
+	Actor     string // optional; a user or a source of the change
 }
 
 // Unwrap returns an original QuadStore value if it was wrapped by Handle.
@@ -77,13 +87,44 @@ func (h *Handle) Close() error {
 	return err
 }
 
+// NamedHandle is a graph handle addressed by its name, when a single process
+// serves several databases.
+type NamedHandle struct {
+	Name     string
+	Handle   *Handle
+	ReadOnly bool // reject writes to this handle
+}
+
 var (
 	ErrQuadExists    = errors.New("quad exists")
 	ErrQuadNotExist  = errors.New("quad does not exist")
 	ErrInvalidAction = errors.New("invalid action")
 	ErrNodeNotExists = errors.New("node does not exist")
+
+	// ErrHistoryNotSupported is returned by QuadHistory for quad stores that don't
+	// keep a history of changes, or when it is disabled for the store.
+	ErrHistoryNotSupported = errors.New("history of changes is not supported by this quad store")
 )
 
+// DeltaLog is an optional interface for quad stores that keep a history of changes.
+type DeltaLog interface {
+	// QuadHistory returns all recorded additions and removals of a given quad,
+	// in the order they were applied.
+	QuadHistory(ctx context.Context, q quad.Quad) ([]Delta, error)
+}
+
+// QuadHistory returns all recorded additions and removals of a given quad.
+// It returns ErrHistoryNotSupported if the quad store doesn't keep a history of changes.
+func QuadHistory(ctx context.Context, qs QuadStore, q quad.Quad) ([]Delta, error) {
+	if !FeaturesOf(qs).DeltaLog {
+		return nil, ErrHistoryNotSupported
+	}
+	if l, ok := Unwrap(qs).(DeltaLog); ok {
+		return l.QuadHistory(ctx, q)
+	}
+	return nil, ErrHistoryNotSupported
+}
+
 // DeltaError records an error and the delta that caused it.
 type DeltaError struct {
 	Delta Delta
@@ -188,49 +229,257 @@ func WriterMethods() []string {
 	return t
 }
 
+// WriterWithActor returns a QuadWriter that sets a given actor on all deltas
+// without one. Quads removed by RemoveNode are not attributed to the actor.
+func WriterWithActor(qw QuadWriter, actor string) QuadWriter {
+	if actor == "" {
+		return qw
+	}
+	return &actorWriter{QuadWriter: qw, actor: actor}
+}
+
+type actorWriter struct {
+	QuadWriter
+	actor string
+}
+
+func (w *actorWriter) AddQuad(q quad.Quad) error {
+	return w.AddQuadSet([]quad.Quad{q})
+}
+
+func (w *actorWriter) AddQuadSet(set []quad.Quad) error {
+	tx := NewTransactionN(len(set))
+	for _, q := range set {
+		tx.AddQuad(q)
+	}
+	return w.ApplyTransaction(tx)
+}
+
+func (w *actorWriter) RemoveQuad(q quad.Quad) error {
+	tx := NewTransactionN(1)
+	tx.RemoveQuad(q)
+	return w.ApplyTransaction(tx)
+}
+
+func (w *actorWriter) ApplyTransaction(t *Transaction) error {
+	tx := NewTransactionN(len(t.Deltas))
+	for _, d := range t.Deltas {
+		if d.Actor == "" {
+			d.Actor = w.actor
+		}
+		tx.addDelta(d)
+	}
+	return w.QuadWriter.ApplyTransaction(tx)
+}
+
 type BatchWriter interface {
 	quad.WriteCloser
 	quad.BatchWriter
 	Flush() error
 }
 
-// NewWriter creates a quad writer for a given QuadStore.
+// DuplicatePolicy defines how Writer handles quads that already exist in the store.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesDefault leaves duplicate quads to the QuadWriter (see IgnoreOpts).
+	DuplicatesDefault = DuplicatePolicy(iota)
+	// DuplicatesIgnore skips quads that already exist in the store or that are repeated
+	// in the same batch, even if the QuadWriter reports them as errors.
+	DuplicatesIgnore
+)
+
+// WriteProgress is reported by Writer each time a batch of quads is committed.
+type WriteProgress struct {
+	Written int64 // number of quads written so far
+	Skipped int64 // number of duplicate quads skipped so far (see DuplicatesIgnore)
+}
+
+// WriterOptions configures a quad writer created by NewWriter.
+type WriterOptions struct {
+	// Batch is the maximal number of quads written in a single transaction.
+	// Default is quad.DefaultBatch.
+	Batch int
+	// Validation is applied to all quads before they are written. Validation is disabled if nil.
+	Validation *quad.Validation
+	// Duplicates defines how quads that already exist in the store are handled.
+	Duplicates DuplicatePolicy
+	// OnProgress is called after each committed batch.
+	OnProgress func(WriteProgress)
+}
+
+// NewWriter creates a quad writer for a given QuadStore. Options may be nil.
+//
+// WriteQuad buffers quads and writes them in batches. WriteQuads writes quads immediately,
+// together with buffered ones. Invalid quads are rejected with *quad.ValidationError and
+// do not affect other quads. If a batch cannot be written, none of its quads are written
+// and all subsequent calls return the same error.
 //
 // Caller must call Flush or Close to flush an internal buffer.
-func NewWriter(qs QuadWriter) BatchWriter {
-	return &batchWriter{qs: qs}
+func NewWriter(qs QuadWriter, opts *WriterOptions) BatchWriter {
+	w := &batchWriter{qs: qs}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.Batch <= 0 {
+		w.opts.Batch = quad.DefaultBatch
+	}
+	return w
 }
 
 type batchWriter struct {
-	qs  QuadWriter
-	buf []quad.Quad
+	qs   QuadWriter
+	opts WriterOptions
+	buf  []quad.Quad
+	prog WriteProgress
+	err  error
 }
 
+// validate applies validation rules to the quad, if they are set.
+func (w *batchWriter) validate(q quad.Quad) (quad.Quad, error) {
+	if w.opts.Validation == nil {
+		return q, nil
+	}
+	return w.opts.Validation.Apply(q)
+}
+
+// flushBuffer writes buffered quads in batches. Unless forced, it writes only full batches.
 func (w *batchWriter) flushBuffer(force bool) error {
-	if !force && len(w.buf) < quad.DefaultBatch {
-		return nil
+	if w.err != nil {
+		return w.err
 	}
-	_, err := w.WriteQuads(w.buf)
-	w.buf = w.buf[:0]
-	return err
+	for len(w.buf) >= w.opts.Batch || (force && len(w.buf) > 0) {
+		n := len(w.buf)
+		if n > w.opts.Batch {
+			n = w.opts.Batch
+		}
+		if err := w.writeBatch(w.buf[:n]); err != nil {
+			w.err = err
+			w.buf = nil
+			return err
+		}
+		w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	}
+	return nil
+}
+
+// writeBatch writes quads in a single transaction and reports the progress.
+func (w *batchWriter) writeBatch(quads []quad.Quad) error {
+	if w.opts.Duplicates == DuplicatesIgnore {
+		return w.writeIgnoreDup(quads)
+	}
+	if err := w.qs.AddQuadSet(quads); err != nil {
+		return err
+	}
+	w.progress(len(quads), 0)
+	return nil
+}
+
+// writeIgnoreDup writes quads, removing the ones that are repeated in the batch or
+// reported to exist by the QuadWriter. Failed transaction is retried without the quad.
+func (w *batchWriter) writeIgnoreDup(quads []quad.Quad) error {
+	uniq := make([]quad.Quad, 0, len(quads))
+	seen := make(map[QuadHash]struct{}, len(quads))
+	for _, q := range quads {
+		h := hashQuad(q)
+		if _, ok := seen[h]; !ok {
+			seen[h] = struct{}{}
+			uniq = append(uniq, q)
+		}
+	}
+	for {
+		err := w.qs.AddQuadSet(uniq)
+		if err == nil {
+			break
+		}
+		de, ok := err.(*DeltaError)
+		if !ok || de.Err != ErrQuadExists {
+			return err
+		}
+		i := indexOfQuad(uniq, de.Delta.Quad)
+		if i < 0 {
+			return err
+		}
+		uniq = append(uniq[:i], uniq[i+1:]...)
+	}
+	w.progress(len(uniq), len(quads)-len(uniq))
+	return nil
+}
+
+func (w *batchWriter) progress(written, skipped int) {
+	w.prog.Written += int64(written)
+	w.prog.Skipped += int64(skipped)
+	if w.opts.OnProgress != nil {
+		w.opts.OnProgress(w.prog)
+	}
+}
+
+func hashQuad(q quad.Quad) QuadHash {
+	var h QuadHash
+	for _, d := range quad.Directions {
+		if v := q.Get(d); v != nil {
+			h.Set(d, HashOf(v))
+		}
+	}
+	return h
+}
+
+func indexOfQuad(quads []quad.Quad, q quad.Quad) int {
+	h := hashQuad(q)
+	for i, q2 := range quads {
+		if hashQuad(q2) == h {
+			return i
+		}
+	}
+	return -1
 }
 
 func (w *batchWriter) WriteQuad(q quad.Quad) error {
-	if err := w.flushBuffer(false); err != nil {
+	if w.err != nil {
+		return w.err
+	}
+	q, err := w.validate(q)
+	if err != nil {
 		return err
 	}
 	w.buf = append(w.buf, q)
-	return nil
+	return w.flushBuffer(false)
 }
+
+// WriteQuads writes all the quads and buffered quads. It returns the number of quads
+// from the slice that were written.
 func (w *batchWriter) WriteQuads(quads []quad.Quad) (int, error) {
-	if err := w.qs.AddQuadSet(quads); err != nil {
-		return 0, err
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for i, q := range quads {
+		q, err := w.validate(q)
+		if err != nil {
+			if err2 := w.flushBuffer(true); err2 != nil {
+				return written, err2
+			}
+			return i, err
+		}
+		w.buf = append(w.buf, q)
+		if len(w.buf) >= w.opts.Batch {
+			// buffer is written completely, since it never exceeds the batch size
+			if err = w.flushBuffer(false); err != nil {
+				return written, err
+			}
+			written = i + 1
+		}
+	}
+	if err := w.flushBuffer(true); err != nil {
+		return written, err
 	}
 	return len(quads), nil
 }
+
 func (w *batchWriter) Flush() error {
 	return w.flushBuffer(true)
 }
+
 func (w *batchWriter) Close() error {
 	return w.Flush()
 }
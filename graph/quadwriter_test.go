@@ -2,7 +2,10 @@ package graph
 
 import (
 	"errors"
+	"reflect"
 	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
 )
 
 func TestIsQuadExist(t *testing.T) {
@@ -61,3 +64,205 @@ func TestIsInvalidAction(t *testing.T) {
 		}
 	}
 }
+
+// batchStore is a QuadWriter that records written batches. It fails on quads that were
+// written before, and on the batch with a given index, if set. Failed batches are not written.
+type batchStore struct {
+	batches [][]quad.Quad
+	failAt  int
+	calls   int
+}
+
+var errBatch = errors.New("batch failed")
+
+func (s *batchStore) has(q quad.Quad) bool {
+	for _, b := range s.batches {
+		for _, q2 := range b {
+			if q2 == q {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *batchStore) AddQuad(q quad.Quad) error { return s.AddQuadSet([]quad.Quad{q}) }
+func (s *batchStore) AddQuadSet(quads []quad.Quad) error {
+	s.calls++
+	if s.failAt != 0 && s.calls == s.failAt {
+		return errBatch
+	}
+	for i, q := range quads {
+		if s.has(q) {
+			return &DeltaError{Delta: Delta{Quad: q, Action: Add}, Err: ErrQuadExists}
+		}
+		for _, q2 := range quads[:i] {
+			if q2 == q {
+				return &DeltaError{Delta: Delta{Quad: q, Action: Add}, Err: ErrQuadExists}
+			}
+		}
+	}
+	s.batches = append(s.batches, append([]quad.Quad(nil), quads...))
+	return nil
+}
+func (s *batchStore) RemoveQuad(quad.Quad) error          { return ErrInvalidAction }
+func (s *batchStore) ApplyTransaction(*Transaction) error { return ErrInvalidAction }
+func (s *batchStore) RemoveNode(quad.Value) error         { return ErrInvalidAction }
+func (s *batchStore) Close() error                        { return nil }
+
+func (s *batchStore) sizes() []int {
+	var out []int
+	for _, b := range s.batches {
+		out = append(out, len(b))
+	}
+	return out
+}
+
+func testQuads(n int) []quad.Quad {
+	out := make([]quad.Quad, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, quad.Make(quad.IRI("s"), quad.IRI("p"), quad.Int(i), nil))
+	}
+	return out
+}
+
+func TestWriterFlushOnClose(t *testing.T) {
+	s := &batchStore{}
+	var prog []WriteProgress
+	w := NewWriter(s, &WriterOptions{
+		Batch:      10,
+		OnProgress: func(p WriteProgress) { prog = append(prog, p) },
+	})
+	for _, q := range testQuads(25) {
+		if err := w.WriteQuad(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.sizes(); !reflect.DeepEqual(got, []int{10, 10}) {
+		t.Fatalf("unexpected batches before close: %v", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.sizes(); !reflect.DeepEqual(got, []int{10, 10, 5}) {
+		t.Fatalf("unexpected batches after close: %v", got)
+	}
+	expect := []WriteProgress{{Written: 10}, {Written: 20}, {Written: 25}}
+	if !reflect.DeepEqual(prog, expect) {
+		t.Fatalf("unexpected progress: %v", prog)
+	}
+
+	// WriteQuads writes quads immediately, together with buffered ones
+	s = &batchStore{}
+	w = NewWriter(s, &WriterOptions{Batch: 10})
+	quads := testQuads(18)
+	if err := w.WriteQuad(quads[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.WriteQuads(quads[1:]); err != nil {
+		t.Fatal(err)
+	} else if n != 17 {
+		t.Fatalf("unexpected number of written quads: %d", n)
+	}
+	if got := s.sizes(); !reflect.DeepEqual(got, []int{10, 8}) {
+		t.Fatalf("unexpected batches: %v", got)
+	}
+}
+
+func TestWriterBatchError(t *testing.T) {
+	s := &batchStore{failAt: 2}
+	w := NewWriter(s, &WriterOptions{Batch: 10})
+	quads := testQuads(25)
+	var err error
+	i := 0
+	for ; i < len(quads); i++ {
+		if err = w.WriteQuad(quads[i]); err != nil {
+			break
+		}
+	}
+	if err != errBatch {
+		t.Fatalf("unexpected error: %v", err)
+	} else if i != 19 {
+		t.Fatalf("expected the second batch to fail, failed at: %d", i)
+	}
+	if err = w.WriteQuad(quads[20]); err != errBatch {
+		t.Fatalf("expected the error to be returned again, got: %v", err)
+	}
+	if _, err = w.WriteQuads(quads[21:]); err != errBatch {
+		t.Fatalf("expected the error to be returned again, got: %v", err)
+	}
+	if err = w.Close(); err != errBatch {
+		t.Fatalf("expected the error on close, got: %v", err)
+	}
+	if got := s.sizes(); !reflect.DeepEqual(got, []int{10}) {
+		t.Fatalf("unexpected batches: %v", got)
+	}
+
+	s = &batchStore{failAt: 2}
+	w = NewWriter(s, &WriterOptions{Batch: 10})
+	if n, err := w.WriteQuads(quads); err != errBatch {
+		t.Fatalf("unexpected error: %v", err)
+	} else if n != 10 {
+		t.Fatalf("unexpected number of written quads: %d", n)
+	}
+}
+
+func TestWriterValidation(t *testing.T) {
+	s := &batchStore{}
+	w := NewWriter(s, &WriterOptions{Batch: 10, Validation: &quad.Validation{Mode: quad.ValidateStrict}})
+	quads := testQuads(5)
+	quads[3].Subject = nil
+	if n, err := w.WriteQuads(quads); err == nil {
+		t.Fatal("expected an error")
+	} else if _, ok := err.(*quad.ValidationError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	} else if n != 3 {
+		t.Fatalf("unexpected number of written quads: %d", n)
+	}
+	// invalid quads do not affect subsequent writes
+	if err := w.WriteQuad(quads[4]); err != nil {
+		t.Fatal(err)
+	} else if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.sizes(); !reflect.DeepEqual(got, []int{3, 1}) {
+		t.Fatalf("unexpected batches: %v", got)
+	}
+}
+
+func TestWriterDuplicates(t *testing.T) {
+	quads := testQuads(6)
+	// store already has the first two quads, the last one is repeated in the batch
+	input := append(append([]quad.Quad{}, quads...), quads[5])
+	newStore := func() *batchStore {
+		return &batchStore{batches: [][]quad.Quad{quads[:2]}}
+	}
+
+	s := newStore()
+	w := NewWriter(s, &WriterOptions{Batch: 10})
+	if _, err := w.WriteQuads(input); !IsQuadExist(err) {
+		t.Fatalf("expected duplicate error, got: %v", err)
+	}
+	if got := s.sizes(); !reflect.DeepEqual(got, []int{2}) {
+		t.Fatalf("unexpected batches: %v", got)
+	}
+
+	s = newStore()
+	var last WriteProgress
+	w = NewWriter(s, &WriterOptions{
+		Batch:      10,
+		Duplicates: DuplicatesIgnore,
+		OnProgress: func(p WriteProgress) { last = p },
+	})
+	if n, err := w.WriteQuads(input); err != nil {
+		t.Fatal(err)
+	} else if n != len(input) {
+		t.Fatalf("unexpected number of written quads: %d", n)
+	}
+	if !reflect.DeepEqual(s.batches[1], quads[2:]) {
+		t.Fatalf("unexpected quads written: %v", s.batches[1])
+	}
+	if expect := (WriteProgress{Written: 4, Skipped: 3}); last != expect {
+		t.Fatalf("unexpected progress: %+v", last)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Formats supported by WriteResults.
+const (
+	ResultsJSON = "json" // one JSON value or quad object per line
+	ResultsTSV  = "tsv"  // one value or quad per line, directions separated by tabs
+)
+
+// resultsFlushEvery is the number of results after which the buffered output is flushed.
+const resultsFlushEvery = 1000
+
+// ResultKind defines how WriteResults interprets results of an iterator.
+type ResultKind int
+
+const (
+	// ResultNodes writes results as node values.
+	ResultNodes = ResultKind(iota)
+	// ResultQuads writes results as full quads; it must only be used for iterators
+	// that return quads, for example LinksTo or iterators of all quads.
+	ResultQuads
+)
+
+// WriteResults drains the iterator and writes each result to w in a given format.
+// Values are resolved with NameOf; results that have no name are skipped.
+//
+// Results are written as nodes or as quads, depending on the kind. JSON quads are
+// written as objects with direction names as keys, TSV quads are written as subject,
+// predicate, object and label separated by tabs.
+//
+// Each result is written once, even if the iterator has multiple paths to it.
+// Output is flushed periodically. Writing stops on the first error.
+func WriteResults(ctx context.Context, w io.Writer, it Iterator, qs QuadStore, format string, kind ResultKind) error {
+	var write func(bw *bufio.Writer, v Value) error
+	quads := kind == ResultQuads
+	switch format {
+	case ResultsJSON:
+		write = func(bw *bufio.Writer, v Value) error {
+			var o interface{}
+			if quads {
+				o = qs.Quad(v)
+			} else if nv := qs.NameOf(v); nv != nil {
+				o = quad.ToString(nv)
+			} else {
+				return nil
+			}
+			data, err := json.Marshal(o)
+			if err != nil {
+				return err
+			}
+			bw.Write(data)
+			return bw.WriteByte('\n')
+		}
+	case ResultsTSV:
+		write = func(bw *bufio.Writer, v Value) error {
+			if !quads {
+				if nv := qs.NameOf(v); nv != nil {
+					bw.WriteString(nv.String())
+					return bw.WriteByte('\n')
+				}
+				return nil
+			}
+			q := qs.Quad(v)
+			for i, d := range quad.Directions {
+				if i != 0 {
+					bw.WriteByte('\t')
+				}
+				bw.WriteString(quad.StringOf(q.Get(d)))
+			}
+			return bw.WriteByte('\n')
+		}
+	default:
+		return fmt.Errorf("unsupported results format: %q", format)
+	}
+
+	bw := bufio.NewWriter(w)
+	n := 0
+	done := ctx.Done()
+	for it.Next(ctx) {
+		select {
+		case <-done:
+			return ctx.Err()
+		default:
+		}
+		if err := write(bw, it.Result()); err != nil {
+			return err
+		}
+		if n++; n%resultsFlushEvery == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
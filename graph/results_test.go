@@ -0,0 +1,97 @@
+package graph_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestWriteResults(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.Quad{Subject: quad.IRI("bob"), Predicate: quad.IRI("name"), Object: quad.String("Bob\tB."), Label: quad.IRI("people")},
+	)
+	nodes := func() graph.Iterator {
+		return iterator.NewFixed(qs.ValueOf(quad.IRI("alice")), qs.ValueOf(quad.String("Bob\tB.")))
+	}
+	quads := func() graph.Iterator {
+		return qs.QuadIterator(quad.Subject, qs.ValueOf(quad.IRI("bob")))
+	}
+	// alice is reached by both branches of the Or, thus it has two paths
+	paths := func() graph.Iterator {
+		alice := qs.ValueOf(quad.IRI("alice"))
+		return iterator.NewAnd(qs, iterator.NewFixed(alice), iterator.NewOr(
+			iterator.NewFixed(alice), iterator.NewFixed(alice),
+		))
+	}
+	for _, c := range []struct {
+		name   string
+		it     graph.Iterator
+		kind   graph.ResultKind
+		format string
+		expect string
+	}{
+		{
+			name: "json values", it: nodes(), format: graph.ResultsJSON,
+			expect: "\"\\u003calice\\u003e\"\n\"Bob\\tB.\"\n",
+		},
+		{
+			name: "tsv values", it: nodes(), format: graph.ResultsTSV,
+			expect: "<alice>\n\"Bob\\tB.\"\n",
+		},
+		{
+			name: "json quads", it: quads(), kind: graph.ResultQuads, format: graph.ResultsJSON,
+			expect: `{"subject":"\u003cbob\u003e","predicate":"\u003cname\u003e","object":"Bob\tB.","label":"\u003cpeople\u003e"}` + "\n",
+		},
+		{
+			name: "tsv quads", it: quads(), kind: graph.ResultQuads, format: graph.ResultsTSV,
+			expect: "<bob>\t<name>\t\"Bob\\tB.\"\t<people>\n",
+		},
+		{
+			name: "multiple paths", it: paths(), format: graph.ResultsTSV,
+			expect: "<alice>\n",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer c.it.Close()
+			var buf bytes.Buffer
+			if err := graph.WriteResults(context.TODO(), &buf, c.it, qs, c.format, c.kind); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != c.expect {
+				t.Errorf("unexpected output:\n%q\nvs\n%q", got, c.expect)
+			}
+		})
+	}
+}
+
+var errWrite = errors.New("write failed")
+
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.n++
+	return 0, errWrite
+}
+
+func TestWriteResultsError(t *testing.T) {
+	qs := memstore.New(quad.MakeIRI("alice", "follows", "bob", ""))
+	it := iterator.NewFixed()
+	for i := 0; i < 10000; i++ {
+		it.Add(qs.ValueOf(quad.IRI("alice")))
+	}
+	w := &failingWriter{}
+	if err := graph.WriteResults(context.TODO(), w, it, qs, graph.ResultsTSV, graph.ResultNodes); err != errWrite {
+		t.Fatalf("expected write error, got: %v", err)
+	} else if w.n != 1 {
+		t.Fatalf("expected writing to stop after the first error, got %d writes", w.n)
+	}
+}
@@ -0,0 +1,202 @@
+package shape
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ quad.Value = Param("")
+
+// Param is a placeholder for a value that will be provided on query execution.
+// It can be used in place of any value in Lookup.
+//
+// Params are kept in the tree by Optimize and are replaced with nodes by BindParams.
+// Building an iterator directly from a Lookup with params will skip them, thus shapes
+// that build a part of the tree during execution must implement ParamShape.
+type Param string
+
+func (p Param) String() string      { return "$" + string(p) }
+func (p Param) Native() interface{} { return p }
+
+var _ graph.Value = paramValue{}
+
+// paramValue is a placeholder for a node in the Fixed iterator.
+type paramValue struct {
+	name string
+}
+
+func (v paramValue) Key() interface{} { return v }
+func (v paramValue) String() string   { return "$" + v.name }
+
+// ParamFixed is a static set of nodes, some of which are parameter placeholders.
+// It is never folded by optimizations, since the actual values are not yet known.
+type ParamFixed []graph.Value
+
+func (s ParamFixed) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	return iterator.NewFixed(s...)
+}
+func (s ParamFixed) Optimize(r Optimizer) (Shape, bool) {
+	return s, false
+}
+
+// ParamShape is implemented by shapes that build a part of the iterator tree during
+// execution, for example by applying a morphism to each result. Parameters used in such
+// shapes are not visible to Walk and cannot be bound in a pre-built tree by BindParams.
+type ParamShape interface {
+	Shape
+	// Params returns names of all parameters used by the shape.
+	Params() []string
+	// BindParams returns a copy of the shape with parameters replaced by given values.
+	BindParams(params map[string]quad.Value) (Shape, error)
+}
+
+// ParamsOf returns a sorted list of parameter names used in Lookups of the shape.
+func ParamsOf(s Shape) []string {
+	seen := make(map[string]struct{})
+	Walk(s, func(s Shape) bool {
+		switch s := s.(type) {
+		case Lookup:
+			for _, v := range s {
+				if p, ok := v.(Param); ok {
+					seen[string(p)] = struct{}{}
+				}
+			}
+		case ParamShape:
+			for _, name := range s.Params() {
+				seen[name] = struct{}{}
+			}
+		}
+		return true
+	})
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasHiddenParams checks if the shape contains a ParamShape that uses parameters.
+// Such shapes must be bound with SubstParams before building an iterator tree.
+func HasHiddenParams(s Shape) bool {
+	found := false
+	Walk(s, func(s Shape) bool {
+		if ps, ok := s.(ParamShape); ok && len(ps.Params()) != 0 {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// paramSubst is an optimizer that replaces parameters in Lookups and ParamShapes.
+type paramSubst struct {
+	params map[string]quad.Value
+	err    error
+}
+
+func (r *paramSubst) OptimizeShape(s Shape) (Shape, bool) {
+	if r.err != nil {
+		return s, false
+	}
+	switch s := s.(type) {
+	case Lookup:
+		var out Lookup
+		for i, v := range s {
+			p, ok := v.(Param)
+			if !ok {
+				if out != nil {
+					out = append(out, v)
+				}
+				continue
+			}
+			pv, ok := r.params[string(p)]
+			if !ok {
+				r.err = fmt.Errorf("no value for parameter %q", string(p))
+				return s, false
+			}
+			if out == nil {
+				out = append(make(Lookup, 0, len(s)), s[:i]...)
+			}
+			out = append(out, pv)
+		}
+		if out == nil {
+			return s, false
+		}
+		return out, true
+	case ParamShape:
+		ns, err := s.BindParams(r.params)
+		if err != nil {
+			r.err = err
+			return s, false
+		}
+		return ns, true
+	}
+	return s, false
+}
+
+// SubstParams returns a copy of the shape with parameters in Lookups and ParamShapes
+// replaced by given values. Unlike BindParams, it works on shapes, thus the iterator
+// tree must be built after the substitution.
+//
+// It returns an error if a value for one of the parameters is missing.
+func SubstParams(s Shape, params map[string]quad.Value) (Shape, error) {
+	if s == nil {
+		return nil, nil
+	}
+	r := &paramSubst{params: params}
+	ns, _ := s.Optimize(r)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if ns == nil {
+		return Null{}, nil
+	}
+	return ns, nil
+}
+
+// BindParams replaces all parameter placeholders in Fixed iterators of the tree
+// with corresponding nodes. Values that do not exist in the quad store will match nothing.
+//
+// It returns an error if a value for one of the parameters is missing. Iterator
+// tree is modified in place, thus it should be cloned first if it will be reused.
+func BindParams(qs graph.QuadStore, it graph.Iterator, params map[string]quad.Value) error {
+	var walk func(it graph.Iterator) error
+	walk = func(it graph.Iterator) error {
+		if fx, ok := it.(*iterator.Fixed); ok {
+			var (
+				vals    []graph.Value
+				changed bool
+			)
+			for _, v := range fx.Values() {
+				p, ok := v.(paramValue)
+				if !ok {
+					vals = append(vals, v)
+					continue
+				}
+				changed = true
+				pv, ok := params[p.name]
+				if !ok {
+					return fmt.Errorf("no value for parameter %q", p.name)
+				}
+				if gv := qs.ValueOf(pv); gv != nil {
+					vals = append(vals, gv)
+				}
+			}
+			if changed {
+				fx.SetValues(vals...)
+			}
+		}
+		for _, sub := range it.SubIterators() {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(it)
+}
@@ -31,6 +31,16 @@ func UnionShapes(s1, s2 Shape) Union {
 	return Union{s1, s2}
 }
 
+// withLabels adds a constraint on the label of quads, unless labels are nil or AllNodes.
+func withLabels(quads Quads, labels Shape) Quads {
+	if labels == nil {
+		return quads
+	} else if _, ok := labels.(AllNodes); ok {
+		return quads
+	}
+	return append(quads, QuadFilter{Dir: quad.Label, Values: labels})
+}
+
 func buildOut(from, via, labels Shape, tags []string, in bool) Shape {
 	start, goal := quad.Subject, quad.Object
 	if in {
@@ -51,13 +61,7 @@ func buildOut(from, via, labels Shape, tags []string, in bool) Shape {
 			Dir: quad.Predicate, Values: via,
 		})
 	}
-	if labels != nil {
-		if _, ok := labels.(AllNodes); !ok {
-			quads = append(quads, QuadFilter{
-				Dir: quad.Label, Values: labels,
-			})
-		}
-	}
+	quads = withLabels(quads, labels)
 	return NodesFrom{Quads: quads, Dir: goal}
 }
 
@@ -72,19 +76,29 @@ func In(from, via, labels Shape, tags ...string) Shape {
 // InWithTags, OutWithTags, Both, BothWithTags
 
 func Predicates(from Shape, in bool) Shape {
+	return PredicatesLabels(from, nil, in)
+}
+
+// PredicatesLabels is like Predicates, but only considers quads with given labels.
+func PredicatesLabels(from, labels Shape, in bool) Shape {
 	dir := quad.Subject
 	if in {
 		dir = quad.Object
 	}
 	return Unique{NodesFrom{
-		Quads: Quads{
+		Quads: withLabels(Quads{
 			{Dir: dir, Values: from},
-		},
+		}, labels),
 		Dir: quad.Predicate,
 	}}
 }
 
 func SavePredicates(from Shape, in bool, tag string) Shape {
+	return SavePredicatesLabels(from, nil, in, tag)
+}
+
+// SavePredicatesLabels is like SavePredicates, but only considers quads with given labels.
+func SavePredicatesLabels(from, labels Shape, in bool, tag string) Shape {
 	preds := Save{
 		From: AllNodes{},
 		Tags: []string{tag},
@@ -95,23 +109,28 @@ func SavePredicates(from Shape, in bool, tag string) Shape {
 	}
 
 	var save Shape = NodesFrom{
-		Quads: Quads{
+		Quads: withLabels(Quads{
 			{Dir: quad.Predicate, Values: preds},
-		},
+		}, labels),
 		Dir: start,
 	}
 	return IntersectShapes(from, save)
 }
 
 func Labels(from Shape) Shape {
+	return LabelsIn(from, nil)
+}
+
+// LabelsIn is like Labels, but only returns labels from a given set.
+func LabelsIn(from, labels Shape) Shape {
 	return Unique{NodesFrom{
 		Quads: Union{
-			Quads{
+			withLabels(Quads{
 				{Dir: quad.Subject, Values: from},
-			},
-			Quads{
+			}, labels),
+			withLabels(Quads{
 				{Dir: quad.Object, Values: from},
-			},
+			}, labels),
 		},
 		Dir: quad.Label,
 	}}
@@ -135,13 +154,7 @@ func SaveViaLabels(from, via, labels Shape, tag string, rev, opt bool) Shape {
 		{Dir: goal, Values: nodes},
 		{Dir: quad.Predicate, Values: via},
 	}
-	if labels != nil {
-		if _, ok := labels.(AllNodes); !ok {
-			quads = append(quads, QuadFilter{
-				Dir: quad.Label, Values: labels,
-			})
-		}
-	}
+	quads = withLabels(quads, labels)
 
 	var save Shape = NodesFrom{
 		Quads: quads,
@@ -174,13 +187,7 @@ func HasLabels(from, via, nodes, labels Shape, rev bool) Shape {
 			Dir: quad.Predicate, Values: via,
 		})
 	}
-	if labels != nil {
-		if _, ok := labels.(AllNodes); !ok {
-			quads = append(quads, QuadFilter{
-				Dir: quad.Label, Values: labels,
-			})
-		}
-	}
+	quads = withLabels(quads, labels)
 	if len(quads) == 0 {
 		panic("empty has")
 	}
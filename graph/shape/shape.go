@@ -43,7 +43,7 @@ type resolveValues struct {
 
 func (r resolveValues) OptimizeShape(s Shape) (Shape, bool) {
 	if l, ok := s.(Lookup); ok {
-		return l.resolve(r.qs), true
+		return l.resolve(r.qs, true), true
 	}
 	return s, false
 }
@@ -212,7 +212,12 @@ func BuildIterator(qs graph.QuadStore, s Shape) graph.Iterator {
 	if IsNull(s) {
 		return iterator.NewNull()
 	}
-	return s.BuildIterator(qs)
+	it := s.BuildIterator(qs)
+	if err := graph.CheckDepth(it); err != nil {
+		it.Close()
+		return iterator.NewError(err)
+	}
+	return it
 }
 
 // Null represent an empty set. Mostly used as a safe alias for nil shape.
@@ -426,6 +431,72 @@ func (s Count) Optimize(r Optimizer) (Shape, bool) {
 	return s, opt
 }
 
+// DistinctCount returns an estimated number of distinct objects in source as a single value.
+// It always returns exactly one value. See iterator.DistinctCount.
+type DistinctCount struct {
+	Values    Shape
+	Precision int // precision of the estimation; zero means the default
+}
+
+func (s DistinctCount) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	var it graph.Iterator
+	if IsNull(s.Values) {
+		it = iterator.NewNull()
+	} else {
+		it = s.Values.BuildIterator(qs)
+	}
+	p := s.Precision
+	if p == 0 {
+		p = iterator.DefaultDistinctPrecision
+	}
+	return iterator.NewDistinctCount(it, qs, p)
+}
+func (s DistinctCount) Optimize(r Optimizer) (Shape, bool) {
+	if IsNull(s.Values) {
+		return Fixed{graph.PreFetched(quad.Int(0))}, true
+	}
+	var opt bool
+	s.Values, opt = s.Values.Optimize(r)
+	if IsNull(s.Values) {
+		return Fixed{graph.PreFetched(quad.Int(0))}, true
+	}
+	if r != nil {
+		ns, nopt := r.OptimizeShape(s)
+		return ns, opt || nopt
+	}
+	return s, opt
+}
+
+// CardinalityViolation returns values that appear in source more than Max times.
+// See iterator.CardinalityViolation.
+type CardinalityViolation struct {
+	Values Shape
+	Max    int64
+	Tag    string // tag for the number of times each value appears; optional
+}
+
+func (s CardinalityViolation) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	if IsNull(s.Values) {
+		return iterator.NewNull()
+	}
+	return iterator.NewCardinalityViolation(s.Values.BuildIterator(qs), s.Max, s.Tag)
+}
+func (s CardinalityViolation) Optimize(r Optimizer) (Shape, bool) {
+	if IsNull(s.Values) {
+		return nil, true
+	}
+	var opt bool
+	s.Values, opt = s.Values.Optimize(r)
+	if IsNull(s.Values) {
+		return nil, true
+	}
+	if r != nil {
+		ns, nopt := r.OptimizeShape(s)
+		return ns, opt || nopt
+	}
+	return s, opt
+}
+
 // QuadFilter is a constraint used to filter quads that have a certain set of values on a given direction.
 // Analog of LinksTo iterator.
 type QuadFilter struct {
@@ -804,21 +875,33 @@ type valueResolver interface {
 	ValueOf(v quad.Value) graph.Value
 }
 
-func (s Lookup) resolve(qs valueResolver) Shape {
+// resolve converts values to nodes. If params is set, all Param values will be
+// kept as placeholders, otherwise they are treated as nonexistent nodes.
+func (s Lookup) resolve(qs valueResolver, params bool) Shape {
 	// TODO: check if QS supports batch lookup
 	vals := make([]graph.Value, 0, len(s))
+	hasParams := false
 	for _, v := range s {
+		if p, ok := v.(Param); ok {
+			if params {
+				vals = append(vals, paramValue{name: string(p)})
+				hasParams = true
+			}
+			continue
+		}
 		if gv := qs.ValueOf(v); gv != nil {
 			vals = append(vals, gv)
 		}
 	}
 	if len(vals) == 0 {
 		return nil
+	} else if hasParams {
+		return ParamFixed(vals)
 	}
 	return Fixed(vals)
 }
 func (s Lookup) BuildIterator(qs graph.QuadStore) graph.Iterator {
-	f := s.resolve(qs)
+	f := s.resolve(qs, false)
 	if IsNull(f) {
 		return iterator.NewNull()
 	}
@@ -833,7 +916,7 @@ func (s Lookup) Optimize(r Optimizer) (Shape, bool) {
 		return ns, true
 	}
 	if qs, ok := r.(valueResolver); ok {
-		ns, opt = s.resolve(qs), true
+		ns, opt = s.resolve(qs, true), true
 	}
 	return ns, opt
 }
@@ -1241,6 +1324,36 @@ func (s Unique) Optimize(r Optimizer) (Shape, bool) {
 	return s, opt
 }
 
+// Sort orders query results by their values or by a value of a given tag.
+type Sort struct {
+	From Shape
+	By   string // tag to sort on; empty means the value itself
+	Desc bool
+}
+
+func (s Sort) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	if IsNull(s.From) {
+		return iterator.NewNull()
+	}
+	it := s.From.BuildIterator(qs)
+	return iterator.NewSort(qs, it, s.By, s.Desc)
+}
+func (s Sort) Optimize(r Optimizer) (Shape, bool) {
+	if IsNull(s.From) {
+		return nil, true
+	}
+	var opt bool
+	s.From, opt = s.From.Optimize(r)
+	if IsNull(s.From) {
+		return nil, true
+	}
+	if r != nil {
+		ns, nopt := r.OptimizeShape(s)
+		return ns, opt || nopt
+	}
+	return s, opt
+}
+
 // Save tags a results of query with provided tags.
 type Save struct {
 	Tags []string
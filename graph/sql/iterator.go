@@ -27,10 +27,89 @@ import (
 )
 
 func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
-	// everything is done in shapes optimizer
+	// most things are done in shapes optimizer, but value filters might be built directly
+	switch it.Type() {
+	case graph.Comparison, graph.Regex, graph.Prefix:
+		return qs.optimizeValueFilter(it)
+	}
 	return it, false
 }
 
+// optimizeValueFilter adds conditions of a value filter iterator to the WHERE clause of a native
+// iterator over nodes. The filter iterator is kept on top of the new native iterator, unless
+// the query matches exactly the same values.
+func (qs *QuadStore) optimizeValueFilter(it graph.Iterator) (graph.Iterator, bool) {
+	var (
+		sub    graph.Iterator
+		where  []Where
+		params []Value
+		exact  bool
+		wrap   func(sub graph.Iterator) graph.Iterator
+		ok     bool
+	)
+	switch f := it.(type) {
+	case *iterator.Comparison:
+		sub = f.SubIterator()
+		switch f.Value().(type) {
+		case quad.IRI, quad.BNode, quad.String:
+			exact = true
+		default:
+			// numbers and times are compared with typed literals of the same kind as well
+			return it, false
+		}
+		where, params, ok = qs.opt.optimizeFilter(shape.AllNodes{}, shape.Comparison{Op: f.Operator(), Val: f.Value()})
+		wrap = func(sub graph.Iterator) graph.Iterator {
+			return iterator.NewComparison(sub, f.Operator(), f.Value(), qs)
+		}
+	case *iterator.Regex:
+		// regexp dialect of the database may differ
+		sub = f.SubIterator()
+		where, params, ok = qs.opt.optimizeFilter(shape.AllNodes{}, shape.Regexp{Re: f.Regexp(), Refs: f.RefsAllowed()})
+		wrap = func(sub graph.Iterator) graph.Iterator {
+			rit := iterator.NewRegex(sub, f.Regexp(), qs)
+			rit.AllowRefs(f.RefsAllowed())
+			return rit
+		}
+	case *iterator.Prefix:
+		// LIKE may be case-insensitive, depending on collation
+		sub = f.SubIterator()
+		where = []Where{
+			{Field: "value_string", Op: OpLike, Value: Placeholder{}},
+			{Field: "iri", Op: OpIsNull},
+			{Field: "bnode", Op: OpIsNull},
+		}
+		params = []Value{StringVal(escapeLike(f.Prefix()) + "%")}
+		ok = true
+		wrap = func(sub graph.Iterator) graph.Iterator {
+			return iterator.NewPrefix(sub, f.Prefix(), qs)
+		}
+	}
+	if !ok {
+		return it, false
+	}
+	nodes, ok := sub.(*Iterator)
+	if !ok || !nodes.query.isNodes() {
+		return it, false
+	}
+	sel := nodes.query.Clone()
+	sel.Where = append(sel.Where, where...)
+	sel.Params = append(sel.Params, params...)
+	nit := qs.NewIterator(sel)
+	nit.tagger.CopyFrom(nodes)
+	if exact {
+		nit.tagger.CopyFrom(it)
+		return nit, true
+	}
+	out := wrap(nit)
+	out.Tagger().CopyFrom(it)
+	return out, true
+}
+
+// escapeLike escapes special characters of LIKE patterns.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
 var _ shape.Optimizer = (*QuadStore)(nil)
 
 func (qs *QuadStore) OptimizeShape(s shape.Shape) (shape.Shape, bool) {
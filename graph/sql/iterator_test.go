@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimizeValueFilters(t *testing.T) {
+	dialect := DefaultDialect
+	dialect.Placeholder = func(i int) string {
+		return fmt.Sprintf("$%d", i)
+	}
+	qs := &QuadStore{opt: NewOptimizer()}
+	qs.opt.SetRegexpOp("~")
+
+	const nodes = `SELECT hash AS ` + tagNode + ` FROM nodes WHERE `
+	for _, c := range []struct {
+		name string
+		it   func() graph.Iterator
+		typ  graph.Type // type of the iterator on top of the native one
+		qu   string
+		args []Value
+	}{
+		{
+			name: "gt iri",
+			it: func() graph.Iterator {
+				return iterator.NewComparison(qs.NodesAllIterator(), iterator.CompareGT, quad.IRI("a"), qs)
+			},
+			qu:   nodes + `value_string > $1 AND iri IS true`,
+			args: []Value{StringVal("a")},
+		},
+		{
+			name: "string range",
+			it: func() graph.Iterator {
+				it := iterator.NewComparison(qs.NodesAllIterator(), iterator.CompareGTE, quad.String("a"), qs)
+				return iterator.NewComparison(it, iterator.CompareLT, quad.String("c"), qs)
+			},
+			qu: nodes + `value_string >= $1 AND iri IS NULL AND bnode IS NULL AND datatype IS NULL AND language IS NULL` +
+				` AND value_string < $2 AND iri IS NULL AND bnode IS NULL AND datatype IS NULL AND language IS NULL`,
+			args: []Value{StringVal("a"), StringVal("c")},
+		},
+		{
+			name: "regexp",
+			it: func() graph.Iterator {
+				return iterator.NewRegex(qs.NodesAllIterator(), regexp.MustCompile("^a.c"), qs)
+			},
+			typ:  graph.Regex,
+			qu:   nodes + `value_string ~ $1 AND iri IS NULL AND bnode IS NULL`,
+			args: []Value{StringVal("^a.c")},
+		},
+		{
+			name: "prefix",
+			it: func() graph.Iterator {
+				return iterator.NewPrefix(qs.NodesAllIterator(), "a_b%", qs)
+			},
+			typ:  graph.Prefix,
+			qu:   nodes + `value_string LIKE $1 AND iri IS NULL AND bnode IS NULL`,
+			args: []Value{StringVal(`a\_b\%%`)},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			it, ok := c.it().Optimize()
+			require.True(t, ok)
+			if c.typ != "" {
+				require.Equal(t, c.typ, it.Type())
+				it = it.SubIterators()[0]
+			}
+			sit, ok := it.(*Iterator)
+			require.True(t, ok, "%T", it)
+			require.Equal(t, c.qu, sit.query.SQL(NewBuilder(dialect)))
+			require.Equal(t, c.args, sit.query.Args())
+		})
+	}
+
+	// numbers are compared with typed literals in Go, thus they are not pushed down
+	it := iterator.NewComparison(qs.NodesAllIterator(), iterator.CompareGT, quad.Int(42), qs)
+	_, ok := it.Optimize()
+	require.False(t, ok)
+}
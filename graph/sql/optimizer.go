@@ -208,6 +208,10 @@ func (opt *Optimizer) optimizeLookup(s shape.Lookup) (shape.Shape, bool) {
 		// TODO: support for IN
 		return s, false
 	}
+	if _, ok := s[0].(shape.Param); ok {
+		// parameters are bound to the iterator tree, thus the lookup must be kept as-is
+		return s, false
+	}
 	sel := SelectValue(s[0], OpEqual)
 	if sel == nil {
 		return s, false
@@ -222,6 +222,7 @@ const (
 	OpLTE    = CmpOp("<=")
 	OpIsNull = CmpOp("IS NULL")
 	OpIsTrue = CmpOp("IS true")
+	OpLike   = CmpOp("LIKE")
 )
 
 type Expr interface {
@@ -280,6 +281,15 @@ func (s Select) isAll() bool {
 	return len(s.From) == 1 && len(s.Where) == 0 && len(s.Params) == 0 && !s.onlyAsSubquery()
 }
 
+// isNodes checks if the query selects nodes from the nodes table, possibly with additional conditions.
+func (s Select) isNodes() bool {
+	if len(s.From) != 1 || len(s.Fields) != 1 || s.onlyAsSubquery() {
+		return false
+	}
+	t, ok := s.From[0].(Table)
+	return ok && t.Name == "nodes" && t.Alias == "" && s.Fields[0].Alias == tagNode
+}
+
 // onlyAsSubquery indicates that query cannot be merged into existing SELECT because of some specific properties of query.
 // An example of such properties might be LIMIT, DISTINCT, etc.
 func (s Select) onlyAsSubquery() bool {
@@ -377,3 +377,11 @@ func TestSQLShapes(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLShapesKeepParams(t *testing.T) {
+	// parameters are bound to the iterator tree, thus lookups must not be converted to SQL
+	s := shape.Lookup{shape.Param("x")}
+	ns, ok := NewOptimizer().OptimizeShape(s)
+	require.False(t, ok)
+	require.Equal(t, s, ns)
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Statistics is a snapshot of statistics of a quad store. Quad stores that maintain
+// statistics update them incrementally on each write and re-estimate them from time
+// to time, thus some of the values may be approximate.
+type Statistics struct {
+	// Nodes is the number of nodes, or -1 if unknown.
+	Nodes int64
+	// Quads is the number of quads.
+	Quads int64
+	// Predicates lists the most used predicates, ordered by the number of quads.
+	Predicates []PredicateStats
+	// Horizon is the horizon of the quad store at the last re-estimate.
+	Horizon int64
+	// Updated is the time of the last re-estimate, zero if statistics were never estimated.
+	Updated time.Time
+	// Changes is the number of quads added or deleted since the last re-estimate.
+	Changes int64
+	// Stale is set if statistics have drifted too far since the last re-estimate,
+	// and are waiting to be refreshed.
+	Stale bool
+}
+
+// PredicateStats is the number of quads with a given predicate.
+type PredicateStats struct {
+	Predicate quad.Value
+	Quads     int64
+}
+
+// StatisticsReporter is an optional interface for quad stores that maintain statistics.
+type StatisticsReporter interface {
+	// Statistics returns the current snapshot of statistics of the quad store.
+	Statistics(ctx context.Context) (Statistics, error)
+}
+
+// StatisticsOf returns statistics of a quad store. If the quad store doesn't implement
+// StatisticsReporter, only the number of quads is returned.
+func StatisticsOf(ctx context.Context, qs QuadStore) (Statistics, error) {
+	qs = Unwrap(qs)
+	if r, ok := qs.(StatisticsReporter); ok {
+		return r.Statistics(ctx)
+	}
+	return Statistics{Nodes: -1, Quads: qs.Size()}, nil
+}
@@ -0,0 +1,80 @@
+package graph
+
+import "context"
+
+// TraceStep is a result of checking a value against a single iterator of the tree.
+type TraceStep struct {
+	Depth    int // depth of the iterator in the tree; the root has depth 0
+	UID      uint64
+	Type     Type
+	Name     string
+	Contains bool // result of Contains for the value
+	// Skipped is set for iterators that were not checked, because their results are not
+	// comparable to the results of the parent. For example, HasA returns nodes, while
+	// its sub-iterator returns quads.
+	Skipped bool
+}
+
+// traceSkipsSubIterators reports if sub-iterators of a given type return values of
+// a different kind than the iterator itself.
+func traceSkipsSubIterators(t Type) bool {
+	switch t {
+	case HasA, LinksTo, Recursive, Count, DistinctCount, Predicates, Follow, LimitPerNode, CycleDetect:
+		return true
+	}
+	return false
+}
+
+// Trace checks a value against each iterator of the tree and returns results in
+// depth-first order, starting from the root. It helps to find out why a specific
+// value was or wasn't returned by a query. See RejectedBy.
+//
+// Trace only relies on the Contains method, thus it changes the state of iterators
+// the same way as Contains does. Iterators should be reset before they are reused.
+func Trace(ctx context.Context, it Iterator, v Value) []TraceStep {
+	return traceIterator(ctx, nil, it, v, 0, false)
+}
+
+func traceIterator(ctx context.Context, out []TraceStep, it Iterator, v Value, depth int, skip bool) []TraceStep {
+	st := TraceStep{
+		Depth: depth,
+		UID:   it.UID(), Type: it.Type(), Name: it.String(),
+		Skipped: skip,
+	}
+	if !skip {
+		st.Contains = it.Contains(ctx, v)
+	}
+	out = append(out, st)
+	skip = skip || traceSkipsSubIterators(st.Type)
+	for _, sub := range it.SubIterators() {
+		out = traceIterator(ctx, out, sub, v, depth+1, skip)
+	}
+	return out
+}
+
+// RejectedBy returns a step of the trace for the iterator that rejected the value, or nil
+// if the value was accepted by the root iterator.
+//
+// Starting from the root, it follows the first sub-iterator that rejected the value, and
+// returns the last iterator on this path. For example, for And it's the first sub-iterator
+// that does not contain the value, and for Not it's the Not iterator itself, if its
+// sub-iterators accepted the value.
+func RejectedBy(steps []TraceStep) *TraceStep {
+	if len(steps) == 0 || steps[0].Contains {
+		return nil
+	}
+	cur := 0
+	for {
+		next := -1
+		for i := cur + 1; i < len(steps) && steps[i].Depth > steps[cur].Depth; i++ {
+			if st := steps[i]; st.Depth == steps[cur].Depth+1 && !st.Skipped && !st.Contains {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return &steps[cur]
+		}
+		cur = next
+	}
+}
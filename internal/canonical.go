@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+var _ quad.ReadCloser = (*CanonicalQuads)(nil)
+
+// CanonicalQuads is a stream of distinct quads in canonical order: quads are sorted
+// by subject, predicate, object and label, compared by their N-Quads representation.
+// Blank nodes are relabeled in order of their first appearance in the stream.
+//
+// Original labels of blank nodes do not affect the order: each blank node is sorted
+// by a signature computed from all quads it appears in, with other blank nodes masked.
+// Thus two streams with the same set of quads produce the same canonical stream,
+// regardless of the order of quads in them and of the labels of blank nodes, unless
+// some blank nodes cannot be told apart by their signatures.
+type CanonicalQuads struct {
+	s      *SortedQuads
+	bnodes map[quad.BNode]quad.BNode
+}
+
+// Canonicalize reads all quads from qr and returns them in canonical order.
+// Parameters chunk and dir have the same meaning as for SortQuads.
+// Returned stream must be closed to remove temporary files.
+func Canonicalize(qr quad.Reader, chunk int, dir string) (*CanonicalQuads, error) {
+	s, err := SortQuads(qr, chunk, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	f, err := ioutil.TempFile(dir, "cayley_canonical")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	// distinct quads are copied to a file, since signatures are only known after reading all of them
+	sigs := make(map[quad.BNode]uint64)
+	w := bufio.NewWriter(f)
+	for {
+		l, err := s.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		q, err := nquads.Parse(l)
+		if err != nil {
+			return nil, err
+		}
+		signBNodes(sigs, q)
+		w.WriteString(l)
+		w.WriteByte('\n')
+	}
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cs, err := SortQuads(signedReader{r: nquads.NewReader(f, false), sigs: sigs}, chunk, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &CanonicalQuads{s: cs, bnodes: make(map[quad.BNode]quad.BNode)}, nil
+}
+
+// signBNodes adds the quad to signatures of its blank nodes. For each blank node, the quad
+// is hashed with this node replaced by a fixed label, and all other blank nodes masked.
+// Hashes are summed, thus the signature doesn't depend on the order of quads.
+func signBNodes(sigs map[quad.BNode]uint64, q quad.Quad) {
+	for _, d := range quad.Directions {
+		b, ok := q.Get(d).(quad.BNode)
+		if !ok {
+			continue
+		} else if hasBNodeBefore(q, d, b) {
+			continue
+		}
+		m := q
+		for _, d2 := range quad.Directions {
+			if v, ok := q.Get(d2).(quad.BNode); !ok {
+				continue
+			} else if v == b {
+				m.Set(d2, quad.BNode("a"))
+			} else {
+				m.Set(d2, quad.BNode("z"))
+			}
+		}
+		h := fnv.New64a()
+		h.Write([]byte(m.NQuad()))
+		sigs[b] += h.Sum64()
+	}
+}
+
+// hasBNodeBefore checks if the blank node appears in the quad before direction d.
+func hasBNodeBefore(q quad.Quad, d quad.Direction, b quad.BNode) bool {
+	for _, d2 := range quad.Directions {
+		if d2 == d {
+			return false
+		} else if v, ok := q.Get(d2).(quad.BNode); ok && v == b {
+			return true
+		}
+	}
+	return false
+}
+
+// signedReader replaces labels of blank nodes with their signatures. Original labels
+// are kept as a suffix to distinguish nodes with the same signature.
+type signedReader struct {
+	r    quad.Reader
+	sigs map[quad.BNode]uint64
+}
+
+func (r signedReader) ReadQuad() (quad.Quad, error) {
+	q, err := r.r.ReadQuad()
+	if err != nil {
+		return q, err
+	}
+	for _, d := range quad.Directions {
+		if b, ok := q.Get(d).(quad.BNode); ok {
+			q.Set(d, quad.BNode(fmt.Sprintf("h%016x_%s", r.sigs[b], string(b))))
+		}
+	}
+	return q, nil
+}
+
+func (r *CanonicalQuads) bnode(v quad.Value) quad.Value {
+	b, ok := v.(quad.BNode)
+	if !ok {
+		return v
+	}
+	nb, ok := r.bnodes[b]
+	if !ok {
+		nb = quad.BNode("b" + strconv.Itoa(len(r.bnodes)))
+		r.bnodes[b] = nb
+	}
+	return nb
+}
+
+// ReadQuad returns the next quad, or io.EOF if there are no more quads.
+func (r *CanonicalQuads) ReadQuad() (quad.Quad, error) {
+	l, err := r.s.Next()
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	q, err := nquads.Parse(l)
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	// relabel in the same order as the nodes appear in the quad line
+	q.Subject = r.bnode(q.Subject)
+	q.Predicate = r.bnode(q.Predicate)
+	q.Object = r.bnode(q.Object)
+	if q.Label != nil {
+		q.Label = r.bnode(q.Label)
+	}
+	return q, nil
+}
+
+// Close releases memory and removes temporary files.
+func (r *CanonicalQuads) Close() error {
+	r.bnodes = nil
+	return r.s.Close()
+}
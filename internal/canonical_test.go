@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/kv/leveldb"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+var canonicalTestQuads = []quad.Quad{
+	quad.MakeIRI("alice", "follows", "bob", ""),
+	{Subject: quad.BNode("x"), Predicate: quad.IRI("name"), Object: quad.String("dani")},
+	{Subject: quad.IRI("bob"), Predicate: quad.IRI("follows"), Object: quad.BNode("x")},
+	{Subject: quad.IRI("alice"), Predicate: quad.IRI("age"), Object: quad.Int(30), Label: quad.IRI("people")},
+	{Subject: quad.BNode("y"), Predicate: quad.IRI("follows"), Object: quad.BNode("x"), Label: quad.BNode("g")},
+	quad.MakeIRI("alice", "follows", "charlie", "people"),
+	{Subject: quad.IRI("charlie"), Predicate: quad.IRI("status"), Object: quad.String("cool\n\"person\"")},
+}
+
+// relabelBNodes returns a copy of quads with blank nodes renamed.
+func relabelBNodes(quads []quad.Quad, names map[quad.BNode]quad.BNode) []quad.Quad {
+	out := make([]quad.Quad, 0, len(quads))
+	for _, q := range quads {
+		for _, d := range quad.Directions {
+			if b, ok := q.Get(d).(quad.BNode); ok {
+				q.Set(d, names[b])
+			}
+		}
+		out = append(out, q)
+	}
+	return out
+}
+
+func dumpCanonical(t *testing.T, qs graph.QuadStore, chunk int) string {
+	qr := graph.NewQuadStoreReader(qs)
+	defer qr.Close()
+	cr, err := Canonicalize(qr, chunk, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cr.Close()
+	buf := bytes.NewBuffer(nil)
+	qw := nquads.NewWriter(buf)
+	if _, err = quad.Copy(qw, cr); err != nil {
+		t.Fatal(err)
+	}
+	if err = qw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCanonicalDump(t *testing.T) {
+	mem := memstore.New(canonicalTestQuads...)
+
+	dir, err := ioutil.TempDir("", "cayley_canonical")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = graph.InitQuadStore(leveldb.Type, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	ldb, err := graph.NewQuadStore(leveldb.Type, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ldb.Close()
+	qw, err := writer.NewSingleReplication(ldb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := len(canonicalTestQuads) - 1; i >= 0; i-- {
+		if err = qw.AddQuad(canonicalTestQuads[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const expect = `<alice> <age> "30"^^<schema:Integer> <people> .
+<alice> <follows> <bob> .
+<alice> <follows> <charlie> <people> .
+<bob> <follows> _:b0 .
+<charlie> <status> "cool\n\"person\"" .
+_:b0 <name> "dani" .
+_:b1 <follows> _:b0 _:b2 .
+`
+	// original labels sort in the opposite order
+	relabeled := memstore.New(relabelBNodes(canonicalTestQuads, map[quad.BNode]quad.BNode{
+		"x": "z1", "y": "a1", "g": "m1",
+	})...)
+	for _, chunk := range []int{0, 2} {
+		if got := dumpCanonical(t, mem, chunk); got != expect {
+			t.Errorf("unexpected memstore dump (chunk %d):\n%s\nvs\n%s", chunk, got, expect)
+		}
+		if got := dumpCanonical(t, relabeled, chunk); got != expect {
+			t.Errorf("unexpected dump of relabeled quads (chunk %d):\n%s\nvs\n%s", chunk, got, expect)
+		}
+		if got := dumpCanonical(t, ldb, chunk); got != expect {
+			t.Errorf("unexpected leveldb dump (chunk %d):\n%s\nvs\n%s", chunk, got, expect)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal/decompressor"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+// DefaultCheckpointEvery is the default number of batches written between checkpoints.
+const DefaultCheckpointEvery = 100
+
+// checkpointBlock is the size of the block at the start of the file that is hashed
+// to detect that the file was changed.
+const checkpointBlock = 64 << 10
+
+// ErrCheckpointMismatch is returned when resuming a load from a checkpoint that was
+// saved for a different file or a different quad store.
+var ErrCheckpointMismatch = errors.New("checkpoint does not match the load")
+
+// Checkpoint records a progress of loading a quad file. It allows to resume a load
+// that was interrupted. See LoadWithCheckpoints.
+type Checkpoint struct {
+	// Quads is the number of quads read from the file and written to the quad store.
+	Quads int64 `json:"quads"`
+	// Offset is the position in the file right after the last written quad.
+	// It is zero if the position is unknown, e.g. for compressed files.
+	Offset int64 `json:"offset,omitempty"`
+	// Horizon is the horizon of the quad store after the last write, if it is known.
+	Horizon string `json:"horizon,omitempty"`
+	// Size is the size of the file.
+	Size int64 `json:"size"`
+	// Hash is a SHA-256 hash of the first block of the file.
+	Hash string `json:"hash"`
+	// BNodes is a blank nodes mode of the load, and Scope is a scope for blank node labels.
+	BNodes string `json:"bnodes"`
+	Scope  string `json:"scope,omitempty"`
+}
+
+// CheckpointPath returns a path of the checkpoint file for a given quad file.
+func CheckpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// ReadCheckpoint reads a checkpoint of a given quad file. It returns nil if the
+// file has no checkpoint.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(CheckpointPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("cannot read checkpoint: %v", err)
+	}
+	return &cp, nil
+}
+
+// writeCheckpoint saves a checkpoint of a given quad file. The file is replaced
+// atomically, thus a checkpoint is never left half-written.
+func writeCheckpoint(path string, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	dst := CheckpointPath(path)
+	f, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+".")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// fileHeader returns a size of the file and a hash of its first block.
+func fileHeader(f *os.File) (int64, string, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, io.LimitReader(f, checkpointBlock)); err != nil {
+		return 0, "", err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	return fi.Size(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CheckpointOptions controls checkpoints of a load. See LoadWithCheckpoints.
+type CheckpointOptions struct {
+	// Every is the number of batches written between checkpoints.
+	// If zero, DefaultCheckpointEvery is used.
+	Every int
+	// Resume continues the load from the last checkpoint, if there is one.
+	// Otherwise, the load starts from the beginning of the file.
+	// Duplicate quads are ignored when resuming (see graph.DuplicatesIgnore).
+	Resume bool
+	// Horizon is an optional horizon of the quad store. If set, it is saved with
+	// checkpoints, and resuming fails if the quad store is behind the checkpoint.
+	Horizon graph.Horizoner
+}
+
+// countingReader counts bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// progressReader tracks the number of quads read from the file and the position
+// in the file after the last quad.
+type progressReader struct {
+	quad.Reader
+	quads  int64
+	offset func() int64 // nil if the position is unknown
+}
+
+func (r *progressReader) ReadQuad() (quad.Quad, error) {
+	q, err := r.Reader.ReadQuad()
+	if err == nil {
+		r.quads++
+	}
+	return q, err
+}
+
+// checkpointWriter saves a checkpoint after every n successful batches.
+type checkpointWriter struct {
+	graph.BatchWriter
+	path    string
+	cp      Checkpoint
+	src     *progressReader
+	horizon graph.Horizoner
+	every   int
+	batches int
+}
+
+func (w *checkpointWriter) WriteQuads(quads []quad.Quad) (int, error) {
+	n, err := w.BatchWriter.WriteQuads(quads)
+	if err != nil || len(quads) == 0 {
+		return n, err
+	}
+	w.batches++
+	if w.batches%w.every != 0 {
+		return n, nil
+	}
+	// quad.CopyBatch writes quads right after reading them, so the reader
+	// is positioned exactly after the last written quad
+	w.cp.Quads = w.src.quads
+	if w.src.offset != nil {
+		w.cp.Offset = w.src.offset()
+	}
+	if w.horizon != nil {
+		w.cp.Horizon = w.horizon.Horizon().String()
+	}
+	if err = writeCheckpoint(w.path, &w.cp); err != nil {
+		return n, fmt.Errorf("cannot save checkpoint: %v", err)
+	}
+	return n, nil
+}
+
+// resumeFrom validates a checkpoint against the file and the quad store.
+func resumeFrom(cp *Checkpoint, size int64, hash string, bnodes quad.BNodeMode, h graph.Horizoner) error {
+	if cp.Size != size || cp.Hash != hash {
+		return fmt.Errorf("%v: file was changed", ErrCheckpointMismatch)
+	}
+	if cp.BNodes != bnodes.String() {
+		return fmt.Errorf("%v: blank nodes mode was %q", ErrCheckpointMismatch, cp.BNodes)
+	}
+	if h == nil || cp.Horizon == "" {
+		return nil
+	}
+	cur := h.Horizon()
+	if !cur.Valid() {
+		return nil
+	}
+	exp, err := graph.ParsePrimaryKey(cp.Horizon)
+	if err != nil {
+		return err
+	}
+	if cur.Compare(exp) < 0 {
+		return fmt.Errorf("%v: quad store horizon %v is behind the checkpoint (%v)", ErrCheckpointMismatch, cur, exp)
+	}
+	return nil
+}
+
+// LoadWithCheckpoints loads a local quad file like DecompressAndLoad, but periodically
+// saves a progress of the load to a checkpoint file next to it (see CheckpointPath).
+// If the load is interrupted, it can be resumed from the last checkpoint by setting
+// opts.Resume. The checkpoint is removed once the load succeeds.
+//
+// On resume, the checkpoint is validated against the size and the first block of the
+// file and against the horizon of the quad store. Uncompressed N-Quads files are read
+// from the position saved in the checkpoint. Other files, including compressed ones,
+// cannot be seeked, so they are read from the start and quads up to the checkpoint
+// are skipped.
+//
+// Quads written after the last checkpoint are written again on resume, thus duplicate
+// quads are always ignored when resuming, regardless of the settings of the writer.
+func LoadWithCheckpoints(qw graph.QuadWriter, batch int, path, typ string, bnodes quad.BNodeMode, v quad.Validation, opts CheckpointOptions) error {
+	if path == "-" {
+		return errors.New("checkpoints are not supported for stdin")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size, hash, err := fileHeader(f)
+	if err != nil {
+		return err
+	}
+	cp := &Checkpoint{Size: size, Hash: hash, BNodes: bnodes.String()}
+	if opts.Resume {
+		last, err := ReadCheckpoint(path)
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			if err = resumeFrom(last, size, hash, bnodes, opts.Horizon); err != nil {
+				return err
+			}
+			clog.Infof("resuming load of %q after %d quads", path, last.Quads)
+			cp = last
+		}
+	}
+	if cp.Scope == "" && bnodes != quad.BNodePreserve {
+		cp.Scope = quad.NewBNodeScope()
+	}
+
+	start := int64(0)
+	if cp.Offset > 0 {
+		if start, err = f.Seek(cp.Offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	cr := &countingReader{r: f}
+	br := bufio.NewReader(cr)
+	var r io.Reader = br
+	// data at the checkpoint offset is never compressed
+	compressed := cp.Offset == 0 && decompressor.IsCompressed(br)
+	if compressed {
+		if r, err = decompressor.New(br); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	qr, err := quadReader(r, path, typ)
+	if err != nil {
+		return err
+	}
+	defer qr.Close()
+
+	src := &progressReader{Reader: qr}
+	// N-Quads reader reads lines from the buffered reader directly (it reuses bufio.Reader
+	// passed to it), so the position after a quad is known exactly
+	if _, ok := qr.(*nquads.Reader); ok && !compressed {
+		src.offset = func() int64 {
+			return start + cr.n - int64(br.Buffered())
+		}
+	}
+	if cp.Offset > 0 {
+		src.quads = cp.Quads
+	} else {
+		for src.quads < cp.Quads {
+			if _, err = src.ReadQuad(); err == io.EOF {
+				return fmt.Errorf("%v: file ends before the checkpoint", ErrCheckpointMismatch)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	every := opts.Every
+	if every <= 0 {
+		every = DefaultCheckpointEvery
+	}
+	wopts := writerOptions(batch, v)
+	if opts.Resume {
+		// quads written after the last checkpoint are already in the store
+		wopts.Duplicates = graph.DuplicatesIgnore
+	}
+	dest := &checkpointWriter{
+		BatchWriter: graph.NewWriter(qw, wopts),
+		path:        path,
+		cp:          *cp,
+		src:         src,
+		horizon:     opts.Horizon,
+		every:       every,
+	}
+	if err = loadFrom(dest, batch, quad.ScopeBNodesIn(src, bnodes, cp.Scope)); err != nil {
+		return err
+	}
+	if err = os.Remove(CheckpointPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
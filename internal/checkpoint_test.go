@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+var errKilled = errors.New("killed")
+
+// killedWriter writes a given number of batches and fails after that, as if the
+// process was killed right after the last write, but before the checkpoint was saved.
+type killedWriter struct {
+	graph.QuadWriter
+	n int
+}
+
+func (w *killedWriter) AddQuadSet(quads []quad.Quad) error {
+	if err := w.QuadWriter.AddQuadSet(quads); err != nil {
+		return err
+	}
+	if w.n--; w.n <= 0 {
+		return errKilled
+	}
+	return nil
+}
+
+func checkpointData(n int) (string, []string) {
+	var (
+		buf   strings.Builder
+		lines []string
+	)
+	for i := 0; i < n; i++ {
+		line := fmt.Sprintf("_:b%d <p> \"%d\" .", i%3, i)
+		lines = append(lines, line)
+		buf.WriteString(line)
+		switch i % 7 {
+		case 0:
+			buf.WriteString("\r\n# comment\n\n")
+		default:
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String(), lines
+}
+
+func sortedQuads(t testing.TB, qs graph.QuadStore) []string {
+	qr := graph.NewQuadStoreReader(qs)
+	defer qr.Close()
+	quads, err := quad.ReadAll(qr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, q := range quads {
+		out = append(out, q.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestLoadResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, lines := checkpointData(95)
+	plain := filepath.Join(dir, "data.nq")
+	if err = ioutil.WriteFile(plain, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gz := filepath.Join(dir, "data.nq.gz")
+	f, err := os.Create(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(data))
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	newStore := func() (*memstore.QuadStore, graph.QuadWriter) {
+		qs := memstore.New()
+		// resumed loads must skip quads written after the last checkpoint on their own
+		qw, err := writer.NewSingleReplication(qs, graph.Options{"ignore_duplicate": false})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return qs, qw
+	}
+
+	qs, qw := newStore()
+	if err = DecompressAndLoad(qw, 10, plain, "", quad.BNodePreserve, quad.Validation{}); err != nil {
+		t.Fatal(err)
+	}
+	expect := sortedQuads(t, qs)
+
+	for _, c := range []struct {
+		name   string
+		path   string
+		bnodes quad.BNodeMode
+		seek   bool
+	}{
+		{name: "seek", path: plain, bnodes: quad.BNodePreserve, seek: true},
+		{name: "skip", path: gz, bnodes: quad.BNodePreserve},
+		{name: "scope", path: plain, bnodes: quad.BNodeScope, seek: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			qs, qw := newStore()
+			opts := CheckpointOptions{Every: 2, Horizon: qs}
+			err := LoadWithCheckpoints(&killedWriter{QuadWriter: qw, n: 5}, 10, c.path, "", c.bnodes, quad.Validation{}, opts)
+			if err == nil || !strings.Contains(err.Error(), errKilled.Error()) {
+				t.Fatalf("expected the load to fail, got: %v", err)
+			}
+			cp, err := ReadCheckpoint(c.path)
+			if err != nil {
+				t.Fatal(err)
+			} else if cp == nil {
+				t.Fatal("expected a checkpoint")
+			}
+			// the last batch was written, but the checkpoint was not updated
+			if cp.Quads != 40 {
+				t.Errorf("unexpected number of quads in the checkpoint: %d", cp.Quads)
+			} else if n := len(sortedQuads(t, qs)); n != 50 {
+				t.Errorf("unexpected number of written quads: %d", n)
+			}
+			if !c.seek {
+				if cp.Offset != 0 {
+					t.Errorf("unexpected offset for a compressed file: %d", cp.Offset)
+				}
+			} else if !strings.HasSuffix(data[:cp.Offset], lines[39]+"\n") {
+				t.Errorf("unexpected offset in the checkpoint: %d", cp.Offset)
+			}
+
+			// a store that was not written to cannot be resumed
+			qs2, qw2 := newStore()
+			err = LoadWithCheckpoints(qw2, 10, c.path, "", c.bnodes, quad.Validation{}, CheckpointOptions{Resume: true, Horizon: qs2})
+			if err == nil || !strings.Contains(err.Error(), ErrCheckpointMismatch.Error()) {
+				t.Errorf("expected a horizon mismatch, got: %v", err)
+			}
+
+			opts.Resume = true
+			if err = LoadWithCheckpoints(qw, 10, c.path, "", c.bnodes, quad.Validation{}, opts); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = os.Stat(CheckpointPath(c.path)); !os.IsNotExist(err) {
+				t.Errorf("expected the checkpoint to be removed: %v", err)
+			}
+			if c.bnodes == quad.BNodePreserve {
+				if got := sortedQuads(t, qs); !reflect.DeepEqual(got, expect) {
+					t.Errorf("resumed load differs from an uninterrupted one:\n%v\nvs\n%v", got, expect)
+				}
+			} else {
+				if n := len(sortedQuads(t, qs)); n != len(expect) {
+					t.Errorf("unexpected number of quads: %d vs %d", n, len(expect))
+				}
+				if n := len(subjectsOf(t, qs)); n != 3 {
+					t.Errorf("expected blank nodes to keep their scope, got %d subjects", n)
+				}
+			}
+		})
+	}
+
+	t.Run("changed file", func(t *testing.T) {
+		path := filepath.Join(dir, "changed.nq")
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, qw := newStore()
+		err := LoadWithCheckpoints(&killedWriter{QuadWriter: qw, n: 3}, 10, path, "", quad.BNodePreserve, quad.Validation{}, CheckpointOptions{Every: 1})
+		if err == nil {
+			t.Fatal("expected the load to fail")
+		}
+		if err = ioutil.WriteFile(path, []byte(strings.Replace(data, "<p>", "<q>", 1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err = LoadWithCheckpoints(qw, 10, path, "", quad.BNodePreserve, quad.Validation{}, CheckpointOptions{Resume: true})
+		if err == nil || !strings.Contains(err.Error(), ErrCheckpointMismatch.Error()) {
+			t.Errorf("expected a file mismatch, got: %v", err)
+		}
+	})
+}
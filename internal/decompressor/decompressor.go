@@ -44,3 +44,10 @@ func New(r io.Reader) (io.Reader, error) {
 		return br, nil
 	}
 }
+
+// IsCompressed checks if the data in the reader starts with a header of one of
+// the supported compression formats. It does not consume any data.
+func IsCompressed(br *bufio.Reader) bool {
+	buf, _ := br.Peek(3)
+	return bytes.HasPrefix(buf, []byte(gzipMagic)) || bytes.HasPrefix(buf, []byte(b2zipMagic))
+}
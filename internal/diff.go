@@ -0,0 +1,314 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// DefaultSortChunk is the default number of quads that SortQuads keeps in memory.
+const DefaultSortChunk = 1 << 20
+
+// IsQuadFile checks if the path points to a quad file that can be read with QuadReaderFor,
+// based on its extension.
+func IsQuadFile(path string) bool {
+	return path == "-" || quad.FormatByExt(trimExt(path)) != nil
+}
+
+// SkipBNodes returns a reader that drops all quads that contain blank nodes.
+func SkipBNodes(qr quad.Reader) quad.Reader {
+	return skipBNodes{qr}
+}
+
+type skipBNodes struct {
+	quad.Reader
+}
+
+func (r skipBNodes) ReadQuad() (quad.Quad, error) {
+	for {
+		q, err := r.Reader.ReadQuad()
+		if err != nil {
+			return q, err
+		}
+		if !hasBNode(q) {
+			return q, nil
+		}
+	}
+}
+
+func hasBNode(q quad.Quad) bool {
+	for _, v := range []quad.Value{q.Subject, q.Predicate, q.Object, q.Label} {
+		if _, ok := v.(quad.BNode); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SortedQuads is a stream of distinct quads in canonical order. Each quad is returned
+// as a line in N-Quads format, without a trailing newline.
+type SortedQuads struct {
+	mem   []string
+	files []*os.File
+	h     lineHeap
+	last  string
+	read  bool
+	err   error
+}
+
+// SortQuads reads all quads from qr and sorts them by their N-Quads representation.
+//
+// At most chunk quads are kept in memory. Larger inputs are split into sorted chunks
+// that are spilled to temporary files in dir (or in the default temporary directory if
+// dir is empty), and merged on read. Returned stream must be closed to remove those files.
+func SortQuads(qr quad.Reader, chunk int, dir string) (*SortedQuads, error) {
+	if chunk <= 0 {
+		chunk = DefaultSortChunk
+	}
+	s := &SortedQuads{}
+	buf := make([]string, 0, chunk)
+	for {
+		q, err := qr.ReadQuad()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			s.Close()
+			return nil, err
+		}
+		buf = append(buf, q.NQuad())
+		if len(buf) < chunk {
+			continue
+		}
+		if err = s.spill(buf, dir); err != nil {
+			s.Close()
+			return nil, err
+		}
+		buf = buf[:0]
+	}
+	sort.Strings(buf)
+	if len(s.files) == 0 {
+		s.mem = buf
+		return s, nil
+	}
+	if len(buf) != 0 {
+		if err := s.spill(buf, dir); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, f := range s.files {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			s.Close()
+			return nil, err
+		}
+		if err := s.h.push(bufio.NewReader(f)); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// spill sorts lines and writes them to a new temporary file.
+func (s *SortedQuads) spill(lines []string, dir string) error {
+	sort.Strings(lines)
+	f, err := ioutil.TempFile(dir, "cayley_sort")
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, f)
+	w := bufio.NewWriter(f)
+	for _, l := range lines {
+		w.WriteString(l)
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// Next returns the next quad line, or io.EOF if there are no more quads.
+// Duplicate quads are returned only once.
+func (s *SortedQuads) Next() (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	for {
+		var l string
+		if s.files == nil {
+			if len(s.mem) == 0 {
+				return "", io.EOF
+			}
+			l, s.mem = s.mem[0], s.mem[1:]
+		} else {
+			if s.h.Len() == 0 {
+				return "", io.EOF
+			}
+			l = s.h.lines[0].line
+			if s.err = s.h.advance(); s.err != nil {
+				return "", s.err
+			}
+		}
+		if s.read && l == s.last {
+			continue
+		}
+		s.read, s.last = true, l
+		return l, nil
+	}
+}
+
+// Close releases memory and removes temporary files.
+func (s *SortedQuads) Close() error {
+	var first error
+	for _, f := range s.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+		if err := os.Remove(f.Name()); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.files, s.mem, s.h.lines = nil, nil, nil
+	return first
+}
+
+type chunkLine struct {
+	line string
+	r    *bufio.Reader
+}
+
+// lineHeap merges sorted chunks by keeping the current line of each of them.
+type lineHeap struct {
+	lines []chunkLine
+}
+
+func (h *lineHeap) Len() int           { return len(h.lines) }
+func (h *lineHeap) Less(i, j int) bool { return h.lines[i].line < h.lines[j].line }
+func (h *lineHeap) Swap(i, j int)      { h.lines[i], h.lines[j] = h.lines[j], h.lines[i] }
+func (h *lineHeap) Push(x interface{}) { h.lines = append(h.lines, x.(chunkLine)) }
+func (h *lineHeap) Pop() interface{} {
+	n := len(h.lines) - 1
+	x := h.lines[n]
+	h.lines = h.lines[:n]
+	return x
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	l, err := r.ReadString('\n')
+	if err == io.EOF && l != "" {
+		err = nil
+	}
+	return strings.TrimSuffix(l, "\n"), err
+}
+
+// push adds a new chunk to the heap, if it's not empty.
+func (h *lineHeap) push(r *bufio.Reader) error {
+	l, err := readLine(r)
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	heap.Push(h, chunkLine{line: l, r: r})
+	return nil
+}
+
+// advance reads the next line from the chunk with the smallest line.
+func (h *lineHeap) advance() error {
+	l, err := readLine(h.lines[0].r)
+	if err == io.EOF {
+		heap.Pop(h)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	h.lines[0].line = l
+	heap.Fix(h, 0)
+	return nil
+}
+
+// DiffStats contains the number of distinct quads on each side of a diff.
+type DiffStats struct {
+	Source     int // quads in the source
+	Target     int // quads in the target
+	OnlySource int // quads that are present only in the source
+	OnlyTarget int // quads that are present only in the target
+}
+
+// Changed checks if any differences were found.
+func (st DiffStats) Changed() bool {
+	return st.OnlySource != 0 || st.OnlyTarget != 0
+}
+
+// DiffQuads compares two sorted quad streams. Lines that are present only in the source
+// are passed to onlySource, and lines that are present only in the target are passed
+// to onlyTarget. Any of the callbacks can be nil.
+func DiffQuads(source, target *SortedQuads, onlySource, onlyTarget func(line string) error) (DiffStats, error) {
+	var st DiffStats
+	next := func(s *SortedQuads, cnt *int) (string, bool, error) {
+		l, err := s.Next()
+		if err == io.EOF {
+			return "", false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+		*cnt++
+		return l, true, nil
+	}
+	call := func(fnc func(string) error, l string, cnt *int) error {
+		*cnt++
+		if fnc == nil {
+			return nil
+		}
+		return fnc(l)
+	}
+	ls, okS, err := next(source, &st.Source)
+	if err != nil {
+		return st, err
+	}
+	lt, okT, err := next(target, &st.Target)
+	if err != nil {
+		return st, err
+	}
+	for okS || okT {
+		switch {
+		case okS && (!okT || ls < lt):
+			if err = call(onlySource, ls, &st.OnlySource); err != nil {
+				return st, err
+			}
+			ls, okS, err = next(source, &st.Source)
+		case okT && (!okS || lt < ls):
+			if err = call(onlyTarget, lt, &st.OnlyTarget); err != nil {
+				return st, err
+			}
+			lt, okT, err = next(target, &st.Target)
+		default:
+			ls, okS, err = next(source, &st.Source)
+			if err == nil {
+				lt, okT, err = next(target, &st.Target)
+			}
+		}
+		if err != nil {
+			return st, err
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func diffQuads(n, mod int) []quad.Quad {
+	var out []quad.Quad
+	for i := n - 1; i >= 0; i-- {
+		if mod != 0 && i%mod == 0 {
+			continue
+		}
+		out = append(out, quad.MakeIRI(fmt.Sprintf("n%d", i), "follows", fmt.Sprintf("n%d", i+1), ""))
+	}
+	return out
+}
+
+func sortTestQuads(t *testing.T, quads []quad.Quad, chunk int, dir string) *SortedQuads {
+	s, err := SortQuads(quad.NewReader(quads), chunk, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSortQuads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	quads := diffQuads(100, 0)
+	quads = append(quads, quads[:10]...) // duplicates
+	var expect []string
+	for _, q := range quads[:100] {
+		expect = append(expect, q.NQuad())
+	}
+	sort.Strings(expect)
+
+	for _, chunk := range []int{0, 7, 1000} {
+		s := sortTestQuads(t, quads, chunk, dir)
+		var got []string
+		for {
+			l, err := s.Next()
+			if err != nil {
+				break
+			}
+			got = append(got, l)
+		}
+		if err = s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("unexpected results for chunk %d:\n%q\nvs\n%q", chunk, got, expect)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("temporary files were not removed: %d", len(files))
+	}
+}
+
+func TestDiffQuads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := diffQuads(100, 3)
+	dst := append(diffQuads(100, 5), quad.MakeIRI("a", "b", "c", ""))
+
+	var opened []*SortedQuads
+	defer func() {
+		for _, s := range opened {
+			s.Close()
+		}
+	}()
+	sorted := func(quads []quad.Quad, chunk int) *SortedQuads {
+		s := sortTestQuads(t, quads, chunk, dir)
+		opened = append(opened, s)
+		return s
+	}
+
+	var onlySrc, onlyDst []string
+	st, err := DiffQuads(sorted(src, 10), sorted(dst, 10),
+		func(l string) error {
+			onlySrc = append(onlySrc, l)
+			return nil
+		}, func(l string) error {
+			onlyDst = append(onlyDst, l)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// multiples of 5 but not of 3 are only in source
+	// multiples of 3 but not of 5 are only in target
+	expect := DiffStats{Source: len(src), Target: len(dst), OnlySource: 13, OnlyTarget: 27 + 1}
+	if st != expect {
+		t.Errorf("unexpected stats: %+v vs %+v", st, expect)
+	}
+	if len(onlySrc) != st.OnlySource || len(onlyDst) != st.OnlyTarget {
+		t.Errorf("unexpected number of reported quads: %d, %d", len(onlySrc), len(onlyDst))
+	}
+	if !st.Changed() {
+		t.Error("expected changes")
+	}
+
+	st, err = DiffQuads(sorted(src, 10), sorted(src, 0), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if st.Changed() || st.Source != len(src) || st.Target != len(src) {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	for _, s := range opened {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+	opened = nil
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("temporary files were not removed: %d", len(files))
+	}
+}
+
+func TestSkipBNodes(t *testing.T) {
+	qr := SkipBNodes(quad.NewReader([]quad.Quad{
+		quad.Make(quad.BNode("a"), quad.IRI("name"), quad.String("A"), nil),
+		quad.Make(quad.IRI("b"), quad.IRI("name"), quad.String("B"), nil),
+		quad.Make(quad.IRI("c"), quad.IRI("knows"), quad.BNode("a"), nil),
+	}))
+	quads, err := quad.ReadAll(qr)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(quads) != 1 || quads[0].Subject != quad.IRI("b") {
+		t.Errorf("unexpected quads: %v", quads)
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+const (
+	// detectSize is the maximal size of the data peeked by DetectFormat.
+	detectSize = 64 << 10
+	// detectLines is the number of statements checked by DetectFormat.
+	detectLines = 16
+)
+
+// DetectFormat checks the first statements of a line-based quad file and returns
+// the name of its format: "nquads", "ntriples" or "turtle". It returns an empty
+// string if the format cannot be detected. Data is not consumed from the reader.
+//
+// The file is detected as N-Triples only if none of the checked statements have a label.
+// Only the data that is already buffered or fits into the buffer is checked.
+func DetectFormat(r *bufio.Reader) string {
+	buf, err := r.Peek(detectSize)
+	eof := err == io.EOF
+	if err != nil && !eof && err != bufio.ErrBufferFull {
+		return ""
+	}
+	lines := bytes.Split(buf, []byte("\n"))
+	if !eof {
+		// last line might be incomplete
+		lines = lines[:len(lines)-1]
+	}
+	format, n := "", 0
+	for _, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if isTurtleDirective(line) {
+			return "turtle"
+		}
+		q, err := nquads.ParseRaw(string(line))
+		if err != nil {
+			if last := line[len(line)-1]; last == ';' || last == ',' {
+				// predicate or object lists
+				return "turtle"
+			}
+			return format
+		} else if q.Label != nil {
+			return "nquads"
+		}
+		format = "ntriples"
+		if n++; n >= detectLines {
+			break
+		}
+	}
+	return format
+}
+
+// isTurtleDirective checks if the line is a prefix or base declaration
+// in either Turtle or SPARQL syntax.
+func isTurtleDirective(line []byte) bool {
+	for _, p := range []string{"@prefix", "@base", "prefix ", "base "} {
+		if len(line) >= len(p) && bytes.EqualFold(line[:len(p)], []byte(p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		data   string
+		expect string
+	}{
+		{"ntriples", "# comment\n<a> <b> <c> .\n\n<a> <b> \"d\"@en .\n", "ntriples"},
+		{"nquads", "<a> <b> <c> .\n<a> <b> <c> <g> .\n", "nquads"},
+		{"nquads no eol", "<a> <b> <c> <g> .", "nquads"},
+		{"turtle prefix", "@prefix ex: <http://example.org/> .\nex:a ex:b ex:c .\n", "turtle"},
+		{"turtle sparql prefix", "PREFIX ex: <http://example.org/>\nex:a ex:b ex:c .\n", "turtle"},
+		{"turtle lists", "<a> <b> <c> .\n<a> <b> <c> ;\n\t<d> <e> .\n", "turtle"},
+		{"empty", "# comment only\n", ""},
+		{"unknown", "{\"subject\": \"a\"}\n", ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(c.data), detectSize)
+			if got := DetectFormat(r); got != c.expect {
+				t.Errorf("unexpected format: %q vs %q", got, c.expect)
+			}
+			// data must not be consumed
+			if data, _ := ioutil.ReadAll(r); string(data) != c.data {
+				t.Errorf("unexpected data: %q", data)
+			}
+		})
+	}
+}
+
+func TestQuadReaderDetect(t *testing.T) {
+	qr, err := quadReader(strings.NewReader("<a> <b> <c> <g> .\n"), "data", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := qr.ReadQuad()
+	if err != nil {
+		t.Fatal(err)
+	} else if q.Label == nil {
+		t.Errorf("unexpected quad: %v", q)
+	}
+
+	_, err = quadReader(strings.NewReader("@prefix ex: <http://example.org/> .\n"), "data.nt", "")
+	if err == nil || !strings.Contains(err.Error(), "Turtle") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// explicit format disables the detection
+	if _, err = quadReader(strings.NewReader("@prefix ex: <http://example.org/> .\n"), "data", "nquads"); err != nil {
+		t.Fatal(err)
+	}
+}
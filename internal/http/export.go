@@ -0,0 +1,124 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+// DefaultExportLimit is the default maximal number of quads returned by the export endpoint.
+const DefaultExportLimit = path.DefaultSubgraphLimit
+
+// exportOptions parses parameters of the export request.
+func (api *API) exportOptions(r *http.Request) (opt path.SubgraphOptions, format *quad.Format, err error) {
+	par := r.URL.Query()
+	opt.Depth = 1
+	if s := par.Get("depth"); s != "" {
+		if opt.Depth, err = strconv.Atoi(s); err != nil || opt.Depth < 0 {
+			return opt, nil, fmt.Errorf("invalid depth: %q", s)
+		}
+	}
+	switch s := par.Get("dir"); s {
+	case "", "both":
+		opt.Dir = quad.Any
+	case "out":
+		opt.Dir = quad.Subject
+	case "in":
+		opt.Dir = quad.Object
+	default:
+		return opt, nil, fmt.Errorf("invalid direction: %q", s)
+	}
+	max := api.config.ExportLimit
+	if max <= 0 {
+		max = DefaultExportLimit
+	}
+	opt.Limit = max
+	if s := par.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return opt, nil, fmt.Errorf("invalid limit: %q", s)
+		}
+		if n < max {
+			opt.Limit = n
+		}
+	}
+	name := par.Get("format")
+	if name == "" {
+		name = "nquads"
+	}
+	format = quad.FormatByName(name)
+	if format == nil || format.Writer == nil {
+		return opt, nil, fmt.Errorf("unsupported format: %q", name)
+	}
+	return opt, format, nil
+}
+
+// ServeV1Export runs a query and writes all quads within a given number of hops from
+// nodes returned by it. The query is passed in the body, and the language is set by
+// the "lang" parameter. Quads are written in a registered format set by the "format"
+// parameter, N-Quads by default. See path.Subgraph for details.
+//
+// If the number of quads reaches the limit, the response is truncated, which is
+// reported in the X-Cayley-Truncated trailer.
+func (api *API) ServeV1Export(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	ctx, cancel := api.contextForRequest(r)
+	defer cancel()
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		lang = "gizmo"
+	}
+	l := query.GetLanguage(lang)
+	if l == nil || l.Session == nil {
+		jsonResponse(w, http.StatusBadRequest, "Unknown query language.")
+		return
+	}
+	opt, format, err := api.exportOptions(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	defer r.Body.Close()
+	code, err := readLimit(r.Body)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	qs := h.QuadStore
+	seeds, err := query.CollectNodes(ctx, l.Session(qs), string(code), opt.Limit)
+	if err != nil {
+		jsonResponse(w, errorStatus(err), err)
+		return
+	}
+
+	if len(format.Mime) != 0 {
+		w.Header().Set("Content-Type", format.Mime[0])
+	}
+	w.Header().Set("Trailer", HeaderTruncated)
+	qw := format.Writer(w)
+	st, err := path.Subgraph(ctx, qs, seeds, opt, qw)
+	if err != nil && st.Quads == 0 {
+		jsonResponse(w, errorStatus(err), err)
+		return
+	} else if err == nil {
+		err = qw.Close()
+	}
+	if err != nil {
+		clog.Warningf("export failed after %d quads: %v", st.Quads, err)
+		return
+	}
+	if st.Truncated {
+		w.Header().Set(HeaderTruncated, "true")
+	}
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/query/gizmo"
+)
+
+func TestExport(t *testing.T) {
+	quads := []quad.Quad{
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("b", "follows", "c", ""),
+		quad.MakeIRI("c", "follows", "d", ""),
+		quad.MakeIRI("e", "follows", "a", ""),
+		quad.MakeIRI("x", "likes", "y", ""),
+	}
+	handle, _ := newTestHandle(t, quads...)
+	h, err := NewHandler(handle, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := func(qs ...quad.Quad) []string {
+		out := make([]string, 0, len(qs))
+		for _, q := range qs {
+			out = append(out, q.NQuad())
+		}
+		sort.Strings(out)
+		return out
+	}
+	const query = `g.V("<a>").All()`
+	for _, c := range []struct {
+		name      string
+		url       string
+		code      int
+		expect    []string
+		truncated bool
+	}{
+		{name: "depth 0", url: "/api/v1/export?depth=0",
+			expect: lines(quads[0], quads[3])},
+		{name: "depth 1", url: "/api/v1/export?lang=gizmo",
+			expect: lines(quads[0], quads[1], quads[3])},
+		{name: "depth 2", url: "/api/v1/export?depth=2&dir=both",
+			expect: lines(quads[0], quads[1], quads[2], quads[3])},
+		{name: "out", url: "/api/v1/export?depth=2&dir=out",
+			expect: lines(quads[0], quads[1], quads[2])},
+		{name: "limit", url: "/api/v1/export?depth=2&limit=1",
+			expect: lines(quads[0]), truncated: true},
+		{name: "bad depth", url: "/api/v1/export?depth=-1", code: http.StatusBadRequest},
+		{name: "bad dir", url: "/api/v1/export?dir=up", code: http.StatusBadRequest},
+		{name: "bad format", url: "/api/v1/export?format=none", code: http.StatusBadRequest},
+		{name: "bad lang", url: "/api/v1/export?lang=none", code: http.StatusBadRequest},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("POST", c.url, strings.NewReader(query)))
+			if c.code != 0 {
+				if w.Code != c.code {
+					t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/n-quads" {
+				t.Errorf("unexpected content type: %q", ct)
+			}
+			got := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("unexpected quads:\n%q\nvs\n%q", got, c.expect)
+			}
+			if tr := w.Result().Trailer.Get(HeaderTruncated) == "true"; tr != c.truncated {
+				t.Errorf("unexpected truncation: %v", tr)
+			}
+		})
+	}
+}
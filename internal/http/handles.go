@@ -0,0 +1,112 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// apiPrefixes are path prefixes of API versions that support named handles.
+var apiPrefixes = []string{"/api/v1/", "/api/v2/"}
+
+// reservedHandleNames cannot be used as handle names, since they are
+// the first path elements of API routes.
+var reservedHandleNames = map[string]struct{}{
+	"query": {}, "shape": {}, "write": {}, "delete": {},
+	"read": {}, "formats": {}, "node": {}, "history": {}, "status": {},
+}
+
+// checkHandleNames verifies that handles can be addressed by their names.
+func checkHandleNames(handles []graph.NamedHandle) error {
+	seen := make(map[string]struct{}, len(handles))
+	for _, h := range handles {
+		if h.Name == "" || strings.ContainsAny(h.Name, "/?#") {
+			return fmt.Errorf("invalid handle name: %q", h.Name)
+		} else if _, ok := reservedHandleNames[h.Name]; ok {
+			return fmt.Errorf("handle name is reserved: %q", h.Name)
+		} else if _, ok := seen[h.Name]; ok {
+			return fmt.Errorf("duplicate handle name: %q", h.Name)
+		} else if h.Handle == nil {
+			return fmt.Errorf("handle %q is not set", h.Name)
+		}
+		seen[h.Name] = struct{}{}
+	}
+	return nil
+}
+
+// handleMux routes requests with a handle name after the API prefix (/api/v1/<name>/...)
+// to the routes of that handle. All other requests are passed to the default routes.
+type handleMux struct {
+	def   http.Handler
+	named map[string]http.Handler
+}
+
+func (m *handleMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, prefix := range apiPrefixes {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			continue
+		}
+		rest := r.URL.Path[len(prefix):]
+		i := strings.IndexByte(rest, '/')
+		if i < 0 {
+			break
+		}
+		h, ok := m.named[rest[:i]]
+		if !ok {
+			break
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = prefix + rest[i+1:]
+		u.RawPath = ""
+		r2.URL = &u
+		h.ServeHTTP(w, r2)
+		return
+	}
+	m.def.ServeHTTP(w, r)
+}
+
+// withHandles adds routes of named handles from the config to the default routes.
+func withHandles(def http.Handler, cfg *Config) (http.Handler, error) {
+	if len(cfg.Handles) == 0 {
+		return def, nil
+	}
+	if err := checkHandleNames(cfg.Handles); err != nil {
+		return nil, err
+	}
+	m := &handleMux{def: def, named: make(map[string]http.Handler, len(cfg.Handles))}
+	for _, h := range cfg.Handles {
+		hcfg := *cfg
+		hcfg.Handles = nil
+		hcfg.ReadOnly = cfg.ReadOnly || h.ReadOnly
+		m.named[h.Name] = newRouter(h.Handle, &hcfg)
+	}
+	return m, nil
+}
+
+// NewHandler returns an HTTP handler serving the API for the default handle and for
+// named handles from the config. If the default handle is nil, the first named handle
+// is used as the default one.
+func NewHandler(handle *graph.Handle, cfg *Config) (http.Handler, error) {
+	handle, cfg, err := defaultHandle(handle, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return withHandles(newRouter(handle, cfg), cfg)
+}
+
+// defaultHandle returns a handle and a config for the legacy routes without a handle name.
+func defaultHandle(handle *graph.Handle, cfg *Config) (*graph.Handle, *Config, error) {
+	if handle != nil {
+		return handle, cfg, nil
+	} else if len(cfg.Handles) == 0 {
+		return nil, nil, fmt.Errorf("no handles to serve")
+	}
+	h := cfg.Handles[0]
+	dcfg := *cfg
+	dcfg.ReadOnly = cfg.ReadOnly || h.ReadOnly
+	return h.Handle, &dcfg, nil
+}
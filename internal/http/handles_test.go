@@ -0,0 +1,178 @@
+package http
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+func newTestHandle(t testing.TB, quads ...quad.Quad) (*graph.Handle, graph.QuadStore) {
+	qs := memstore.New(quads...)
+	qw, err := writer.NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &graph.Handle{QuadStore: qs, QuadWriter: qw}, qs
+}
+
+func nquadFileBody(t testing.TB, data string) (*bytes.Buffer, string) {
+	buf := bytes.NewBuffer(nil)
+	mw := multipart.NewWriter(buf)
+	fw, err := mw.CreateFormFile("NQuadFile", "data.nq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(data))
+	if err = mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf, mw.FormDataContentType()
+}
+
+func TestNamedHandles(t *testing.T) {
+	def, qsDef := newTestHandle(t, quad.MakeIRI("c1", "p", "x", ""))
+	ha, qsA := newTestHandle(t, quad.MakeIRI("a1", "p", "x", ""))
+	hb, qsB := newTestHandle(t, quad.MakeIRI("b1", "p", "x", ""))
+	h, err := NewHandler(def, &Config{Handles: []graph.NamedHandle{
+		{Name: "a", Handle: ha},
+		{Name: "b", Handle: hb, ReadOnly: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const mqlQuery = `[{"id": null, "<p>": "<x>"}]`
+	fileBody := func() (*bytes.Buffer, string) { return nquadFileBody(t, "<a4> <p> <x> .\n") }
+
+	for _, c := range []struct {
+		name    string
+		method  string
+		url     string
+		ct      string
+		body    func() (*bytes.Buffer, string)
+		code    int
+		expect  string // expected substring of the response
+		reject  string // unexpected substring of the response
+		changed graph.QuadStore
+		quads   int
+	}{
+		{name: "v1 query default", url: "/api/v1/query/mql", ct: "application/json", expect: "c1", reject: "a1"},
+		{name: "v1 query a", url: "/api/v1/a/query/mql", ct: "application/json", expect: "a1", reject: "b1"},
+		{name: "v1 query b", url: "/api/v1/b/query/mql", ct: "application/json", expect: "b1", reject: "a1"},
+		{name: "v1 query unknown", url: "/api/v1/z/query/mql", ct: "application/json", code: http.StatusNotFound},
+		{name: "v1 shape a", url: "/api/v1/a/shape/mql", ct: "application/json", expect: "nodes"},
+		{name: "v1 write a", url: "/api/v1/a/write",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("<a2> <p> <x> .\n<a3> <p> <x> .\n"), "application/n-quads"
+			},
+			changed: qsA, quads: 3},
+		{name: "v1 write b", url: "/api/v1/b/write",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("<b2> <p> <x> .\n"), "application/n-quads"
+			},
+			code: http.StatusForbidden, changed: qsB, quads: 1},
+		{name: "v1 delete a", url: "/api/v1/a/delete",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString(`[{"subject": "<a2>", "predicate": "<p>", "object": "<x>"}]`), "application/json"
+			},
+			changed: qsA, quads: 2},
+		{name: "v1 write file a", url: "/api/v1/a/write/file/nquad", body: fileBody, changed: qsA, quads: 3},
+		{name: "v1 delete match a", url: "/api/v1/a/delete/match",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString(`{"subject": "<a4>", "confirm": true}`), "application/json"
+			},
+			changed: qsA, quads: 2},
+		{name: "v2 read a", method: "GET", url: "/api/v2/a/read", expect: "<a3>", reject: "<b1>"},
+		{name: "v2 read b", method: "GET", url: "/api/v2/b/read", expect: "<b1>", reject: "<a1>"},
+		{name: "v2 write a", url: "/api/v2/a/write",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("<a5> <p> <x> .\n"), "application/n-quads"
+			},
+			changed: qsA, quads: 3},
+		{name: "v2 write b", url: "/api/v2/b/write",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("<b2> <p> <x> .\n"), "application/n-quads"
+			},
+			// write routes are not registered for read-only handles
+			code: http.StatusNotFound, changed: qsB, quads: 1},
+		{name: "v2 delete a", url: "/api/v2/a/delete",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("<a5> <p> <x> .\n"), "application/n-quads"
+			},
+			changed: qsA, quads: 2},
+		{name: "v2 query a", url: "/api/v2/a/query?lang=mql", expect: "a3", reject: "c1"},
+		{name: "v2 query default", url: "/api/v2/query?lang=mql", expect: "c1", reject: "a3"},
+		{name: "v2 formats a", method: "GET", url: "/api/v2/a/formats", expect: "nquads"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			method := c.method
+			if method == "" {
+				method = "POST"
+			}
+			body, ct := bytes.NewBufferString(mqlQuery), c.ct
+			if c.body != nil {
+				body, ct = c.body()
+			}
+			req := httptest.NewRequest(method, c.url, body)
+			if ct != "" {
+				req.Header.Set("Content-Type", ct)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			code := c.code
+			if code == 0 {
+				code = http.StatusOK
+			}
+			out := w.Body.String()
+			if w.Code != code {
+				t.Fatalf("unexpected status: %d vs %d: %s", w.Code, code, out)
+			}
+			if c.expect != "" && !strings.Contains(out, c.expect) {
+				t.Errorf("expected %q in response: %s", c.expect, out)
+			}
+			if c.reject != "" && strings.Contains(out, c.reject) {
+				t.Errorf("unexpected %q in response: %s", c.reject, out)
+			}
+			if c.changed != nil {
+				if n := countQuads(t, c.changed); n != c.quads {
+					t.Errorf("unexpected number of quads: %d vs %d", n, c.quads)
+				}
+			}
+		})
+	}
+	for _, c := range []struct {
+		name string
+		qs   graph.QuadStore
+		n    int
+	}{
+		{"default", qsDef, 1}, {"a", qsA, 2}, {"b", qsB, 1},
+	} {
+		if n := countQuads(t, c.qs); n != c.n {
+			t.Errorf("unexpected number of quads in %q: %d vs %d", c.name, n, c.n)
+		}
+	}
+}
+
+func TestNamedHandlesInvalid(t *testing.T) {
+	def, _ := newTestHandle(t)
+	for _, names := range [][]string{
+		{""}, {"a/b"}, {"query"}, {"write"}, {"a", "a"},
+	} {
+		var handles []graph.NamedHandle
+		for _, name := range names {
+			hn, _ := newTestHandle(t)
+			handles = append(handles, graph.NamedHandle{Name: name, Handle: hn})
+		}
+		if _, err := NewHandler(def, &Config{Handles: handles}); err == nil {
+			t.Errorf("expected an error for handles %q", names)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+// historyEvent is a single change of a quad returned by the history endpoint.
+type historyEvent struct {
+	ID        graph.PrimaryKey `json:"id"`
+	Action    string           `json:"action"`
+	Timestamp time.Time        `json:"timestamp"`
+	Actor     string           `json:"actor,omitempty"`
+}
+
+// ServeV1History returns all recorded additions and removals of a single quad.
+// The quad is passed in the "quad" parameter as an N-Quads line.
+func (api *API) ServeV1History(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	line := strings.TrimSpace(r.URL.Query().Get("quad"))
+	if line == "" {
+		jsonResponse(w, 400, "Quad is not set.")
+		return
+	}
+	q, err := nquads.NewReader(strings.NewReader(line+"\n"), false).ReadQuad()
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	hist, err := graph.QuadHistory(r.Context(), h.QuadStore, q)
+	if err == graph.ErrHistoryNotSupported {
+		jsonResponse(w, http.StatusNotImplemented, err)
+		return
+	} else if err != nil {
+		jsonResponse(w, 500, err)
+		return
+	}
+	events := make([]historyEvent, 0, len(hist))
+	for _, d := range hist {
+		events = append(events, historyEvent{
+			ID:        d.ID,
+			Action:    d.Action.String(),
+			Timestamp: d.Timestamp,
+			Actor:     d.Actor,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": events})
+}
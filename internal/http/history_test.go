@@ -0,0 +1,112 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/kv"
+	"github.com/cayleygraph/cayley/graph/kv/btree"
+	cayleyhttp "github.com/cayleygraph/cayley/server/http"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+func newHistoryHandle(t testing.TB) *graph.Handle {
+	db := btree.New()
+	opts := graph.Options{"history": true}
+	if err := kv.Init(db, opts); err != nil {
+		t.Fatal(err)
+	}
+	qs, err := kv.New(db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qw, err := writer.NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &graph.Handle{QuadStore: qs, QuadWriter: qw}
+}
+
+func TestHistory(t *testing.T) {
+	// requests created by httptest are sent from 192.0.2.1
+	trusted, err := cayleyhttp.ParseTrustedProxies([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandler(newHistoryHandle(t), &Config{TrustedProxies: trusted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path, body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/n-quads")
+		}
+		if user != "" {
+			req.Header.Set(cayleyhttp.HeaderActor, user)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	const line = "<a> <follows> <b> ."
+	if w := do("POST", "/api/v1/write", line+"\n", "alice"); w.Code != http.StatusOK {
+		t.Fatalf("write failed: %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/api/v2/delete", line+"\n", "bob"); w.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("GET", "/api/v1/history?quad="+url.QueryEscape(line), "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Result []historyEvent `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Result) != 2 {
+		t.Fatalf("unexpected events: %s", w.Body.String())
+	}
+	for i, exp := range []historyEvent{
+		{Action: "add", Actor: "alice"}, {Action: "delete", Actor: "bob"},
+	} {
+		got := out.Result[i]
+		if got.Action != exp.Action || got.Actor != exp.Actor || got.Timestamp.IsZero() {
+			t.Errorf("unexpected event %d: %+v", i, got)
+		}
+	}
+
+	for _, c := range []struct {
+		path string
+		code int
+	}{
+		{"/api/v1/history", http.StatusBadRequest},
+		{"/api/v1/history?quad=" + url.QueryEscape("<a> <follows>"), http.StatusBadRequest},
+	} {
+		if w := do("GET", c.path, "", ""); w.Code != c.code {
+			t.Errorf("unexpected status for %q: %d vs %d: %s", c.path, w.Code, c.code, w.Body.String())
+		}
+	}
+}
+
+func TestHistoryNotSupported(t *testing.T) {
+	def, _ := newTestHandle(t)
+	h, err := NewHandler(def, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/api/v1/history?quad="+url.QueryEscape("<a> <follows> <b> ."), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+}
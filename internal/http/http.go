@@ -27,6 +27,7 @@ import (
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/internal/gephi"
+	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/server/http"
 )
 
@@ -72,6 +73,7 @@ type statusWriter struct {
 
 func (w *statusWriter) WriteHeader(code int) {
 	*(w.code) = code
+	w.ResponseWriter.WriteHeader(code)
 }
 
 func LogRequest(handler httprouter.Handle) httprouter.Handle {
@@ -92,13 +94,17 @@ func LogRequest(handler httprouter.Handle) httprouter.Handle {
 	}
 }
 
+// jsonResponse writes an error with a given status code. If the class of the error
+// is known, the status code is replaced with the one for the class (see cayleyhttp.ErrorStatus).
 func jsonResponse(w http.ResponseWriter, code int, err interface{}) {
+	resp := ErrorQueryWrapper{Error: fmt.Sprint(err)}
+	if e, ok := err.(error); ok {
+		resp.ErrorCode = graph.ErrorCode(e)
+		code = cayleyhttp.ErrorStatus(e, code)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	w.Write([]byte(`{"error": `))
-	data, _ := json.Marshal(fmt.Sprint(err))
-	w.Write(data)
-	w.Write([]byte(`}`))
+	json.NewEncoder(w).Encode(resp)
 }
 
 type TemplateRequestHandler struct {
@@ -117,18 +123,19 @@ func (h *TemplateRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 }
 
 type API struct {
-	config *Config
-	handle *graph.Handle
+	config   *Config
+	handle   *graph.Handle
+	prepared preparedQueries
 }
 
 func (api *API) GetHandleForRequest(r *http.Request) (*graph.Handle, error) {
-	return cayleyhttp.HandleForRequest(api.handle, "single", nil, r)
+	return cayleyhttp.HandleForRequest(api.handle, "single", nil, r, api.config.TrustedProxies)
 }
 
 func (api *API) RWOnly(handler httprouter.Handle) httprouter.Handle {
 	if api.config.ReadOnly {
 		return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
-			jsonResponse(w, http.StatusForbidden, "Database is read-only.")
+			jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
 		}
 	}
 	return handler
@@ -139,7 +146,7 @@ func CORSFunc(w http.ResponseWriter, req *http.Request, params httprouter.Params
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
 		w.Header().Set("Access-Control-Allow-Headers",
-			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, "+cayleyhttp.HeaderActor)
 	}
 }
 
@@ -152,19 +159,64 @@ func CORS(h httprouter.Handle) httprouter.Handle {
 
 func (api *API) APIv1(r *httprouter.Router) {
 	r.POST("/api/v1/query/:query_lang", CORS(LogRequest(api.ServeV1Query)))
+	r.POST("/api/v1/query/:query_lang/:handle", CORS(LogRequest(api.ServeV1Run)))
 	r.POST("/api/v1/shape/:query_lang", CORS(LogRequest(api.ServeV1Shape)))
 	r.POST("/api/v1/write", CORS(api.RWOnly(LogRequest(api.ServeV1Write))))
 	r.POST("/api/v1/write/file/nquad", CORS(api.RWOnly(LogRequest(api.ServeV1WriteNQuad))))
 	r.POST("/api/v1/delete", CORS(api.RWOnly(LogRequest(api.ServeV1Delete))))
+	r.POST("/api/v1/delete/match", CORS(api.RWOnly(LogRequest(api.ServeV1DeleteMatch))))
+	r.GET("/api/v1/history", CORS(LogRequest(api.ServeV1History)))
+	r.GET("/api/v1/status", CORS(LogRequest(api.ServeV1Status)))
+	r.GET("/api/v1/stats", CORS(LogRequest(api.ServeV1Stats)))
+	r.POST("/api/v1/export", CORS(LogRequest(api.ServeV1Export)))
 }
 
 type Config struct {
 	ReadOnly bool
 	Timeout  time.Duration
 	Batch    int
+
+	// QueryMemory limits an approximate memory size of results buffered by a single query.
+	// Zero value means no limit. See graph.Budget.
+	QueryMemory int64
+
+	// Validation defines how quads are checked and normalized before they are written.
+	// It's applied to all write endpoints. Zero value disables validation.
+	Validation quad.Validation
+
+	// PreparedTTL is the time after which unused prepared queries are removed.
+	// Zero value means DefaultPreparedTTL.
+	PreparedTTL time.Duration
+	// PreparedMaxStale is the advance of the store horizon after which prepared
+	// queries are re-planned. See query.PrepareOptions.
+	PreparedMaxStale int64
+
+	// StreamBuffer is the number of results buffered between the query and the client
+	// for streamed responses. Zero value means DefaultStreamBuffer.
+	StreamBuffer int
+	// StreamFlushInterval is the maximal time between flushes of a streamed response.
+	// Zero value means DefaultStreamFlushInterval.
+	StreamFlushInterval time.Duration
+	// StallTimeout is the time after which a streamed query is cancelled, if the client
+	// does not read any results. Zero value means DefaultStallTimeout.
+	StallTimeout time.Duration
+
+	// ExportLimit is the maximal number of quads written by a single export request.
+	// Zero value means DefaultExportLimit.
+	ExportLimit int
+
+	// TrustedProxies are reverse proxies that authenticate clients. The actor recorded
+	// with changes is only taken from requests sent by them (see cayleyhttp.ActorForRequest).
+	TrustedProxies cayleyhttp.TrustedProxies
+
+	// Handles are additional databases served under /api/v1/<name>/ and /api/v2/<name>/.
+	// Routes without a handle name use the default handle. Writes to a handle are
+	// rejected if either the handle or the config is read-only.
+	Handles []graph.NamedHandle
 }
 
-func SetupRoutes(handle *graph.Handle, cfg *Config) error {
+// newRouter registers API routes for a single graph handle.
+func newRouter(handle *graph.Handle, cfg *Config) *httprouter.Router {
 	r := httprouter.New()
 	api := &API{config: cfg, handle: handle}
 	r.OPTIONS("/*path", CORSFunc)
@@ -174,7 +226,18 @@ func SetupRoutes(handle *graph.Handle, cfg *Config) error {
 	api2.SetReadOnly(cfg.ReadOnly)
 	api2.SetBatchSize(cfg.Batch)
 	api2.SetQueryTimeout(cfg.Timeout)
+	api2.SetQueryMemory(cfg.QueryMemory)
+	api2.SetTrustedProxies(cfg.TrustedProxies)
 	api2.RegisterOn(r, CORS, LogRequest)
+	return r
+}
+
+func SetupRoutes(handle *graph.Handle, cfg *Config) error {
+	handle, cfg, err := defaultHandle(handle, cfg)
+	if err != nil {
+		return err
+	}
+	r := newRouter(handle, cfg)
 
 	gs := &gephi.GraphStreamHandler{QS: handle.QuadStore}
 	const gephiPath = "/gephi/gs"
@@ -195,6 +258,10 @@ func SetupRoutes(handle *graph.Handle, cfg *Config) error {
 		http.Handle("/static/", http.StripPrefix("/static", http.FileServer(http.Dir(fmt.Sprint(assets, "/static/")))))
 	}
 
-	http.Handle("/", r)
+	h, err := withHandles(r, cfg)
+	if err != nil {
+		return err
+	}
+	http.Handle("/", h)
 	return nil
 }
@@ -0,0 +1,193 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+// DefaultPreparedTTL is the time after which unused prepared queries are removed.
+const DefaultPreparedTTL = 10 * time.Minute
+
+type preparedQuery struct {
+	lang *query.Language
+	qs   graph.QuadStore
+	q    query.PreparedQuery
+	last time.Time
+}
+
+// preparedQueries holds prepared queries by their handles.
+type preparedQueries struct {
+	mu      sync.Mutex
+	queries map[string]*preparedQuery
+}
+
+func (api *API) preparedTTL() time.Duration {
+	if api.config.PreparedTTL > 0 {
+		return api.config.PreparedTTL
+	}
+	return DefaultPreparedTTL
+}
+
+// expire removes all queries that were not used for a given time. Caller must hold the lock.
+func (p *preparedQueries) expire(now time.Time, ttl time.Duration) {
+	for h, pq := range p.queries {
+		if now.Sub(pq.last) > ttl {
+			pq.q.Close()
+			delete(p.queries, h)
+		}
+	}
+}
+
+func (p *preparedQueries) add(pq *preparedQuery, ttl time.Duration) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	h := hex.EncodeToString(b[:])
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pq.last = time.Now()
+	p.expire(pq.last, ttl)
+	if p.queries == nil {
+		p.queries = make(map[string]*preparedQuery)
+	}
+	p.queries[h] = pq
+	return h, nil
+}
+
+func (p *preparedQueries) get(h string, ttl time.Duration) *preparedQuery {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.expire(now, ttl)
+	pq := p.queries[h]
+	if pq != nil {
+		pq.last = now
+	}
+	return pq
+}
+
+type PreparedQueryWrapper struct {
+	Handle string   `json:"handle"`
+	Params []string `json:"params"`
+}
+
+type RunQueryRequest struct {
+	Params map[string]string `json:"params"`
+}
+
+// ServeV1Prepare prepares a query for later execution with ServeV1Run.
+// Query language is passed in "lang" URL parameter and defaults to Gizmo.
+func (api *API) ServeV1Prepare(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	par, _ := url.ParseQuery(r.URL.RawQuery)
+	lang := par.Get("lang")
+	if lang == "" {
+		lang = "gizmo"
+	}
+	l := query.GetLanguage(lang)
+	if l == nil {
+		jsonResponse(w, http.StatusBadRequest, "Unknown query language.")
+		return
+	} else if l.HTTP == nil {
+		jsonResponse(w, http.StatusBadRequest, "HTTP interface is not supported for this query language.")
+		return
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	ses, ok := l.HTTP(h.QuadStore).(query.Preparer)
+	if !ok {
+		jsonResponse(w, http.StatusBadRequest, "Prepared queries are not supported for this query language.")
+		return
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	q, err := ses.Prepare(string(bodyBytes), query.PrepareOptions{MaxStale: api.config.PreparedMaxStale})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		WriteError(w, err)
+		return
+	}
+	handle, err := api.prepared.add(&preparedQuery{lang: l, qs: h.QuadStore, q: q}, api.preparedTTL())
+	if err != nil {
+		q.Close()
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	_ = WriteResult(w, PreparedQueryWrapper{Handle: handle, Params: q.Params()})
+}
+
+// ServeV1Run executes a prepared query with given parameters.
+func (api *API) ServeV1Run(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if params.ByName("query_lang") != "run" {
+		jsonResponse(w, http.StatusNotFound, "Unknown method.")
+		return
+	}
+	ctx, cancel := api.contextForRequest(r)
+	defer cancel()
+	pq := api.prepared.get(params.ByName("handle"), api.preparedTTL())
+	if pq == nil {
+		jsonResponse(w, http.StatusNotFound, "Prepared query not found or expired.")
+		return
+	}
+	var req RunQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	vals := make(map[string]quad.Value, len(req.Params))
+	for k, v := range req.Params {
+		vals[k] = quad.StringToValue(v)
+	}
+
+	par, _ := url.ParseQuery(r.URL.RawQuery)
+	limit, _ := strconv.Atoi(par.Get("limit"))
+	if limit == 0 {
+		limit = 100
+	}
+	envelope := true
+	if v, err := strconv.ParseBool(par.Get("envelope")); err == nil {
+		envelope = v
+	}
+
+	ses := pq.lang.HTTP(pq.qs)
+	// prepared queries are bound to the quad store, thus it can only be tracked, not pinned
+	tracker := query.TrackHorizon(pq.qs, false)
+	defer tracker.Done()
+	start := time.Now()
+	c := make(chan query.Result, 5)
+	go pq.q.Execute(ctx, vals, c, limit)
+	defer stopQuery(cancel, c)
+
+	for res := range c {
+		if err := res.Err(); err != nil {
+			defaultErrorFunc(w, err)
+			return
+		}
+		ses.Collate(res)
+	}
+	output, err := ses.Results()
+	if err != nil {
+		defaultErrorFunc(w, err)
+		return
+	}
+	_ = writeQueryResult(w, output, queryMeta(tracker, ses, output, start), envelope)
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/query/gizmo"
+)
+
+func TestPreparedQueries(t *testing.T) {
+	handle, _ := newTestHandle(t,
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("b", "follows", "c", ""),
+		quad.MakeIRI("c", "follows", "d", ""),
+	)
+	newHandler := func(t *testing.T, conf *Config) http.Handler {
+		h, err := NewHandler(handle, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	call := func(t *testing.T, h http.Handler, url, body string, code int) []byte {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", url, strings.NewReader(body)))
+		if w.Code != code {
+			t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.Bytes()
+	}
+	prepare := func(t *testing.T, h http.Handler, q string) PreparedQueryWrapper {
+		var resp struct {
+			Result PreparedQueryWrapper `json:"result"`
+		}
+		if err := json.Unmarshal(call(t, h, "/api/v1/query/prepare", q, http.StatusOK), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Result.Handle == "" {
+			t.Fatal("no handle returned")
+		}
+		return resp.Result
+	}
+	run := func(t *testing.T, h http.Handler, handle, params string) []string {
+		var resp struct {
+			Result []map[string]interface{} `json:"result"`
+		}
+		if err := json.Unmarshal(call(t, h, "/api/v1/query/run/"+handle, params, http.StatusOK), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, r := range resp.Result {
+			id, _ := r["id"].(string)
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	t.Run("params", func(t *testing.T) {
+		h := newHandler(t, &Config{})
+		pq := prepare(t, h, `g.V(param("who")).Out("<follows>").All()`)
+		if !reflect.DeepEqual(pq.Params, []string{"who"}) {
+			t.Fatalf("unexpected params: %v", pq.Params)
+		}
+		for who, expect := range map[string][]string{
+			"<a>": {"<b>"},
+			"<b>": {"<c>"},
+			"<x>": nil,
+		} {
+			if got := run(t, h, pq.Handle, `{"params": {"who": "`+who+`"}}`); !reflect.DeepEqual(got, expect) {
+				t.Errorf("unexpected results for %s: %v vs %v", who, got, expect)
+			}
+		}
+		call(t, h, "/api/v1/query/run/"+pq.Handle, `{}`, http.StatusBadRequest)
+		call(t, h, "/api/v1/query/run/"+pq.Handle, `{"params": {"who": "<a>", "x": "<b>"}}`, http.StatusBadRequest)
+		call(t, h, "/api/v1/query/run/"+pq.Handle, `{"params"`, http.StatusBadRequest)
+	})
+	t.Run("recursive", func(t *testing.T) {
+		h := newHandler(t, &Config{})
+		pq := prepare(t, h, `g.V(param("who")).FollowRecursive(g.M().Out(param("via"))).All()`)
+		if !reflect.DeepEqual(pq.Params, []string{"via", "who"}) {
+			t.Fatalf("unexpected params: %v", pq.Params)
+		}
+		got := run(t, h, pq.Handle, `{"params": {"who": "<a>", "via": "<follows>"}}`)
+		if expect := []string{"<b>", "<c>", "<d>"}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("unexpected results: %v vs %v", got, expect)
+		}
+	})
+	t.Run("bad query", func(t *testing.T) {
+		h := newHandler(t, &Config{})
+		call(t, h, "/api/v1/query/prepare", `g.V(`, http.StatusBadRequest)
+		call(t, h, "/api/v1/query/prepare?lang=none", `g.V()`, http.StatusBadRequest)
+	})
+	t.Run("unknown handle", func(t *testing.T) {
+		h := newHandler(t, &Config{})
+		call(t, h, "/api/v1/query/run/0000", `{}`, http.StatusNotFound)
+	})
+	t.Run("expired", func(t *testing.T) {
+		h := newHandler(t, &Config{PreparedTTL: time.Millisecond})
+		pq := prepare(t, h, `g.V(param("who")).All()`)
+		time.Sleep(5 * time.Millisecond)
+		call(t, h, "/api/v1/query/run/"+pq.Handle, `{"params": {"who": "<a>"}}`, http.StatusNotFound)
+	})
+	t.Run("re-plan", func(t *testing.T) {
+		const q = `g.V("<z>").Out(param("via")).All()`
+		params := `{"params": {"via": "<follows>"}}`
+
+		stale := newHandler(t, &Config{PreparedMaxStale: -1})
+		fresh := newHandler(t, &Config{})
+		spq, fpq := prepare(t, stale, q), prepare(t, fresh, q)
+		if got := run(t, fresh, fpq.Handle, params); len(got) != 0 {
+			t.Fatalf("unexpected results: %v", got)
+		}
+		if err := handle.QuadWriter.AddQuad(quad.MakeIRI("z", "follows", "a", "")); err != nil {
+			t.Fatal(err)
+		}
+		if got := run(t, stale, spq.Handle, params); len(got) != 0 {
+			t.Errorf("expected a stale plan, got: %v", got)
+		}
+		if got, expect := run(t, fresh, fpq.Handle, params), []string{"<a>"}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("plan was not rebuilt: %v vs %v", got, expect)
+		}
+	})
+}
@@ -15,6 +15,7 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -23,30 +24,103 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/server/http"
 )
 
+// HeaderTruncated is set to "true" if query results are partial, for example
+// because of the results limit.
+const HeaderTruncated = "X-Cayley-Truncated"
+
 type SuccessQueryWrapper struct {
 	Result interface{} `json:"result"`
+	Meta   *query.Meta `json:"meta,omitempty"`
 }
 
+// ErrorQueryWrapper is a JSON response with an error. ErrorCode is a stable
+// machine-readable class of the error, see graph.ErrorCode.
 type ErrorQueryWrapper struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	ErrorCode string `json:"error_code,omitempty"`
 }
 
 func WriteError(w io.Writer, err error) error {
 	enc := json.NewEncoder(w)
 	//enc.SetIndent("", " ")
-	return enc.Encode(ErrorQueryWrapper{err.Error()})
+	return enc.Encode(ErrorQueryWrapper{Error: err.Error(), ErrorCode: graph.ErrorCode(err)})
 }
 
 func WriteResult(w io.Writer, result interface{}) error {
+	return WriteResultMeta(w, result, nil)
+}
+
+// WriteResultMeta is the same as WriteResult, but also writes query metadata, if any.
+func WriteResultMeta(w io.Writer, result interface{}, meta *query.Meta) error {
 	enc := json.NewEncoder(w)
 	//enc.SetIndent("", " ")
-	return enc.Encode(SuccessQueryWrapper{result})
+	return enc.Encode(SuccessQueryWrapper{Result: result, Meta: meta})
+}
+
+// queryMeta returns metadata for results of a query executed by a session.
+func queryMeta(tracker *query.HorizonTracker, ses interface{}, output interface{}, start time.Time) *query.Meta {
+	meta := tracker.Done()
+	if meta == nil {
+		meta = &query.Meta{}
+	}
+	meta.Elapsed = float64(time.Since(start)) / float64(time.Millisecond)
+	switch out := output.(type) {
+	case []interface{}:
+		meta.Count = len(out)
+	case []graph.Description:
+		meta.Count = len(out)
+	}
+	if t, ok := ses.(query.Truncater); ok {
+		meta.Truncated = t.Truncated()
+	}
+	if wr, ok := ses.(query.Warner); ok {
+		meta.Warnings = wr.Warnings()
+	}
+	return meta
+}
+
+// stopQuery cancels the query and waits for the session to close the results channel.
+// The backend is not read by the query after it returns, thus the snapshot can be released.
+func stopQuery(cancel func(), c <-chan query.Result) {
+	cancel()
+	for range c {
+	}
+}
+
+// writeQueryResult writes query results with metadata. If envelope is false,
+// only results are written, in a format used before metadata was introduced.
+//
+// Results are encoded before anything is written, thus an encoding error is returned
+// to the client with a proper status.
+func writeQueryResult(w http.ResponseWriter, output interface{}, meta *query.Meta, envelope bool) error {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	output = cayleyhttp.JSONValue(output)
+	if !envelope {
+		err = WriteResult(&buf, output)
+	} else {
+		err = WriteResultMeta(&buf, output, meta)
+	}
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return err
+	}
+	if meta.Truncated {
+		w.Header().Set(HeaderTruncated, "true")
+	}
+	_, err = buf.WriteTo(w)
+	return err
 }
 
 func GetQueryShape(q string, ses query.HTTP) ([]byte, error) {
@@ -59,23 +133,39 @@ func GetQueryShape(q string, ses query.HTTP) ([]byte, error) {
 
 func (api *API) contextForRequest(r *http.Request) (context.Context, func()) {
 	ctx := context.TODO() // TODO(dennwc): get from request
-	cancel := func() {}
+	// the context is always cancellable, thus queries can be stopped on errors
+	var cancel func()
 	if api.config.Timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, api.config.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
-	return ctx, cancel
+	// memory of each query is accounted separately, but is limited by the global budget as well
+	budget := graph.NewBudget(api.config.QueryMemory, graph.GlobalBudget)
+	ctx = graph.WithBudget(ctx, budget)
+	return ctx, func() {
+		cancel()
+		budget.Close()
+	}
+}
+
+// errorStatus returns an HTTP status code for a query error.
+func errorStatus(err error) int {
+	return cayleyhttp.ErrorStatus(err, http.StatusBadRequest)
 }
 
 func defaultErrorFunc(w query.ResponseWriter, err error) {
-	data, _ := json.Marshal(err.Error())
-	w.WriteHeader(http.StatusBadRequest)
-	w.Write([]byte(`{"error" : `))
-	w.Write(data)
-	w.Write([]byte(`}`))
+	w.WriteHeader(errorStatus(err))
+	WriteError(w, err)
 }
 
 // TODO(barakmich): Turn this into proper middleware.
 func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if params.ByName("query_lang") == "prepare" {
+		// router does not allow static paths to share a prefix with parameters
+		api.ServeV1Prepare(w, r, params)
+		return
+	}
 	ctx, cancel := api.contextForRequest(r)
 	defer cancel()
 	l := query.GetLanguage(params.ByName("query_lang"))
@@ -98,9 +188,22 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 		errFunc(w, err)
 		return
 	}
-	if l.HTTPQuery != nil {
+	par, _ := url.ParseQuery(r.URL.RawQuery)
+	explain, _ := strconv.ParseBool(par.Get("explain"))
+	envelope := true
+	if v, err := strconv.ParseBool(par.Get("envelope")); err == nil {
+		envelope = v
+	}
+
+	tracker := query.TrackHorizon(h.QuadStore, true)
+	defer func() {
+		// the query must be stopped before the snapshot is released
+		cancel()
+		tracker.Done()
+	}()
+	if l.HTTPQuery != nil && !explain {
 		defer r.Body.Close()
-		l.HTTPQuery(ctx, h.QuadStore, w, r.Body)
+		l.HTTPQuery(ctx, tracker.QuadStore(), w, r.Body)
 		return
 	}
 	if l.HTTP == nil {
@@ -108,13 +211,12 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 		return
 	}
 
-	par, _ := url.ParseQuery(r.URL.RawQuery)
 	limit, _ := strconv.Atoi(par.Get("limit"))
 	if limit == 0 {
 		limit = 100
 	}
 
-	ses := l.HTTP(h.QuadStore)
+	ses := l.HTTP(tracker.QuadStore())
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		errFunc(w, err)
@@ -122,8 +224,39 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 	}
 	code := string(bodyBytes)
 
+	start := time.Now()
+	if explain {
+		ex, ok := ses.(query.Explainer)
+		if !ok {
+			errFunc(w, errors.New("Explain is not supported for this query language."))
+			return
+		}
+		plans, err := ex.Explain(ctx, code)
+		if err != nil {
+			errFunc(w, err)
+			return
+		}
+		_ = writeQueryResult(w, plans, queryMeta(tracker, nil, plans, start), envelope)
+		return
+	}
+
+	if stream, _ := strconv.ParseBool(par.Get("stream")); stream {
+		st, ok := ses.(query.Streamer)
+		if !ok {
+			errFunc(w, errors.New("Streaming is not supported for this query language."))
+			return
+		}
+		api.streamQuery(ctx, w, ses, st, code, limit, errFunc, func(n int) *query.Meta {
+			meta := queryMeta(tracker, ses, nil, start)
+			meta.Count = n
+			return meta
+		})
+		return
+	}
+
 	c := make(chan query.Result, 5)
 	go ses.Execute(ctx, code, c, limit)
+	defer stopQuery(cancel, c)
 
 	for res := range c {
 		if err := res.Err(); err != nil {
@@ -140,7 +273,7 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 		errFunc(w, err)
 		return
 	}
-	_ = WriteResult(w, output)
+	_ = writeQueryResult(w, output, queryMeta(tracker, ses, output, start), envelope)
 }
 
 func (api *API) ServeV1Shape(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -0,0 +1,377 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+	_ "github.com/cayleygraph/cayley/query/mql"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+func TestQueryEnvelope(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("a", "follows", "c", ""),
+		quad.MakeIRI("a", "follows", "d", ""),
+	)
+	qw, err := writer.NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &API{config: &Config{}, handle: &graph.Handle{QuadStore: qs, QuadWriter: qw}}
+	const q = `[{"id": "<a>", "<follows>": [{"id": null}]}]`
+
+	run := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", url, bytes.NewBufferString(q))
+		w := httptest.NewRecorder()
+		api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	t.Run("envelope", func(t *testing.T) {
+		w := run(t, "/api/v1/query/mql")
+		var resp struct {
+			Result []interface{}          `json:"result"`
+			Meta   map[string]interface{} `json:"meta"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Result) != 1 {
+			t.Errorf("unexpected result: %v", resp.Result)
+		}
+		for _, k := range []string{"elapsed_ms", "count", "truncated", "horizon_start", "horizon_end"} {
+			if _, ok := resp.Meta[k]; !ok {
+				t.Errorf("no %q in metadata: %v", k, resp.Meta)
+			}
+		}
+		if c := resp.Meta["count"]; c != float64(1) {
+			t.Errorf("unexpected count: %v", c)
+		}
+		if tr := resp.Meta["truncated"]; tr != false {
+			t.Errorf("unexpected truncated flag: %v", tr)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		w := run(t, "/api/v1/query/mql?limit=2")
+		var resp struct {
+			Meta struct {
+				Truncated bool `json:"truncated"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Meta.Truncated || w.Header().Get(HeaderTruncated) != "true" {
+			t.Errorf("results should be truncated: %s", w.Body.String())
+		}
+	})
+	t.Run("no envelope", func(t *testing.T) {
+		w := run(t, "/api/v1/query/mql?envelope=false")
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := resp["meta"]; ok || len(resp) != 1 {
+			t.Errorf("unexpected response: %s", w.Body.String())
+		}
+		if _, ok := resp["result"]; !ok {
+			t.Errorf("no result in response: %s", w.Body.String())
+		}
+	})
+}
+
+// sortSession sorts all the values of a huge range, which would take gigabytes of memory.
+type sortSession struct{}
+
+func (sortSession) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(out)
+	it := iterator.NewSort(nil, iterator.NewInt64(1, 1<<40, true), "", false)
+	if err := graph.Iterate(ctx, it).Each(func(graph.Value) {}); err != nil {
+		out <- query.ErrorResult(err)
+	}
+}
+
+func (sortSession) ShapeOf(string) (interface{}, error) { return nil, nil }
+func (sortSession) Collate(query.Result)                {}
+func (sortSession) Results() (interface{}, error)       { return nil, nil }
+
+func TestQueryMemory(t *testing.T) {
+	query.RegisterLanguage(query.Language{
+		Name: "test-sort",
+		HTTP: func(qs graph.QuadStore) query.HTTP { return sortSession{} },
+	})
+	api := &API{config: &Config{QueryMemory: 1 << 20}, handle: &graph.Handle{QuadStore: memstore.New()}}
+	req := httptest.NewRequest("POST", "/api/v1/query/test-sort", bytes.NewBufferString("q"))
+	w := httptest.NewRecorder()
+	api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "test-sort"}})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "memory limit exceeded") {
+		t.Errorf("unexpected error: %s", w.Body.String())
+	}
+	if n := graph.GlobalBudget.Used(); n != 0 {
+		t.Errorf("memory was not released: %d", n)
+	}
+}
+
+// errSession fails every query with an error of the class named by the query text.
+type errSession map[string]error
+
+func (s errSession) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(out)
+	out <- query.ErrorResult(s[qu])
+}
+
+func (errSession) ShapeOf(string) (interface{}, error) { return nil, nil }
+func (errSession) Collate(query.Result)                {}
+func (errSession) Results() (interface{}, error)       { return nil, nil }
+
+func TestQueryErrorCodes(t *testing.T) {
+	errs := errSession{
+		"query":     &graph.QueryError{Language: "test-err", Line: 1, Column: 2, Err: errors.New("bad")},
+		"read_only": graph.ErrReadOnly,
+		"not_exist": &graph.DeltaError{Err: graph.ErrQuadNotExist},
+		"exists":    graph.ErrDatabaseExists,
+		"cancelled": context.Canceled,
+		"timeout":   context.DeadlineExceeded,
+		"budget":    &graph.ErrBudgetExceeded{Limit: 1},
+		"init":      graph.ErrNotInitialized,
+		"backend":   &graph.ErrWrongBackend{Found: "bolt", Expected: "leveldb"},
+		"version":   &graph.ErrIncompatibleVersion{Found: 3, Expected: 2},
+		"unknown":   errors.New("unknown"),
+	}
+	query.RegisterLanguage(query.Language{
+		Name: "test-err",
+		HTTP: func(qs graph.QuadStore) query.HTTP { return errs },
+	})
+	api := &API{config: &Config{}, handle: &graph.Handle{QuadStore: memstore.New()}}
+	run := func(t *testing.T, lang, qu string) (int, ErrorQueryWrapper) {
+		req := httptest.NewRequest("POST", "/api/v1/query/"+lang, bytes.NewBufferString(qu))
+		w := httptest.NewRecorder()
+		api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: lang}})
+		var resp ErrorQueryWrapper
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%v: %s", err, w.Body.String())
+		}
+		return w.Code, resp
+	}
+	for _, c := range []struct {
+		query  string
+		status int
+		code   string
+	}{
+		{"query", http.StatusBadRequest, graph.CodeQuery},
+		{"read_only", http.StatusForbidden, graph.CodeReadOnly},
+		{"not_exist", http.StatusNotFound, graph.CodeQuadNotExist},
+		{"exists", http.StatusConflict, graph.CodeDatabaseExists},
+		{"cancelled", http.StatusServiceUnavailable, graph.CodeCancelled},
+		{"timeout", http.StatusGatewayTimeout, graph.CodeTimeout},
+		{"budget", http.StatusRequestEntityTooLarge, graph.CodeBudgetExceeded},
+		{"init", http.StatusServiceUnavailable, graph.CodeNotInitialized},
+		{"backend", http.StatusInternalServerError, graph.CodeWrongBackend},
+		{"version", http.StatusInternalServerError, graph.CodeIncompatibleVersion},
+		{"unknown", http.StatusBadRequest, ""},
+	} {
+		status, resp := run(t, "test-err", c.query)
+		if status != c.status || resp.ErrorCode != c.code {
+			t.Errorf("%s: unexpected response: %d %q", c.query, status, resp.ErrorCode)
+		}
+		if resp.Error != errs[c.query].Error() {
+			t.Errorf("%s: unexpected error: %q", c.query, resp.Error)
+		}
+	}
+	t.Run("syntax", func(t *testing.T) {
+		status, resp := run(t, "mql", "[{\"id\": null,\n\"<follows>\" []}]")
+		if status != http.StatusBadRequest || resp.ErrorCode != graph.CodeQuery {
+			t.Fatalf("unexpected response: %d %q", status, resp.ErrorCode)
+		}
+		if !strings.Contains(resp.Error, "line 2") {
+			t.Errorf("no position in the error: %q", resp.Error)
+		}
+	})
+}
+
+// snapStore records the last snapshot taken from it.
+type snapStore struct {
+	*memstore.QuadStore
+	snap *closeSnapshot
+}
+
+func (s *snapStore) Snapshot() (graph.QuadStore, error) {
+	qs, err := s.QuadStore.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	s.snap = &closeSnapshot{QuadStore: qs}
+	return s.snap, nil
+}
+
+type closeSnapshot struct {
+	graph.QuadStore
+	closed int32
+}
+
+func (s *closeSnapshot) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	return s.QuadStore.Close()
+}
+
+// lateSession fails the query, but keeps reading the quad store until the query is cancelled.
+type lateSession struct {
+	qs     *closeSnapshot
+	closed bool // set if the snapshot was closed while the query was running
+	done   chan struct{}
+}
+
+func (s *lateSession) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(s.done)
+	defer close(out)
+	out <- query.ErrorResult(errors.New("failed"))
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	s.closed = atomic.LoadInt32(&s.qs.closed) != 0
+}
+
+func (s *lateSession) FormatResult(r query.Result) (interface{}, bool) { return nil, false }
+func (s *lateSession) ShapeOf(string) (interface{}, error)             { return nil, nil }
+func (s *lateSession) Collate(query.Result)                            {}
+func (s *lateSession) Results() (interface{}, error)                   { return nil, nil }
+
+func TestQuerySnapshotRelease(t *testing.T) {
+	var ses *lateSession
+	query.RegisterLanguage(query.Language{
+		Name: "test-late",
+		HTTP: func(qs graph.QuadStore) query.HTTP {
+			ses = &lateSession{qs: qs.(*closeSnapshot), done: make(chan struct{})}
+			return ses
+		},
+	})
+	mem, err := graph.NewQuadStore(memstore.QuadStoreType, "", graph.Options{"snapshots": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := &snapStore{QuadStore: mem.(*memstore.QuadStore)}
+	api := &API{config: &Config{}, handle: &graph.Handle{QuadStore: qs}}
+	for _, stream := range []bool{false, true} {
+		target := "/api/v1/query/test-late"
+		if stream {
+			target += "?stream=true"
+		}
+		req := httptest.NewRequest("POST", target, bytes.NewBufferString("q"))
+		w := httptest.NewRecorder()
+		api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "test-late"}})
+		if w.Code == http.StatusOK {
+			t.Fatalf("expected an error, got: %s", w.Body.String())
+		}
+		<-ses.done
+		if ses.closed {
+			t.Errorf("stream=%v: snapshot was released while the query was running", stream)
+		}
+		if atomic.LoadInt32(&qs.snap.closed) == 0 {
+			t.Errorf("stream=%v: snapshot was not released", stream)
+		}
+	}
+}
+
+func TestQueryTypedResults(t *testing.T) {
+	date := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	handle, _ := newTestHandle(t,
+		quad.Quad{Subject: quad.IRI("a"), Predicate: quad.IRI("age"), Object: quad.Int(21)},
+		quad.Quad{Subject: quad.IRI("a"), Predicate: quad.IRI("cool"), Object: quad.Bool(true)},
+		quad.Quad{Subject: quad.IRI("a"), Predicate: quad.IRI("born"), Object: quad.Time(date)},
+		quad.Quad{Subject: quad.IRI("a"), Predicate: quad.IRI("score"), Object: quad.Float(math.Inf(1))},
+		quad.MakeIRI("a", "follows", "b", "g"),
+	)
+	h, err := NewHandler(handle, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(t *testing.T, url, q string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", url, strings.NewReader(q)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	result := func(t *testing.T, body string) interface{} {
+		var resp struct {
+			Result interface{} `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatalf("%v: %s", err, body)
+		}
+		return resp.Result
+	}
+	const typed = `g.V("<a>").Tag("s").Out("<age>").Tag("age").Back("s").Out("<cool>").Tag("cool").
+		Back("s").Out("<born>").Tag("born").Back("s").Out("<score>").All()`
+	expectTyped := map[string]interface{}{
+		"s":        "<a>",
+		"age":      float64(21),
+		"age@raw":  "21",
+		"cool":     true,
+		"cool@raw": "true",
+		"born":     "2018-06-01T10:00:00Z",
+		"born@raw": "2018-06-01T10:00:00Z",
+		// infinite floats have no JSON representation
+		"id":     "INF",
+		"id@raw": "INF",
+	}
+	expectQuad := map[string]interface{}{
+		"subject": "<a>", "predicate": "<follows>", "object": "<b>", "label": "<g>",
+	}
+
+	got := result(t, run(t, "/api/v1/query/gizmo", typed))
+	if expect := []interface{}{expectTyped}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected typed results:\n%v\nvs\n%v", got, expect)
+	}
+	got = result(t, run(t, "/api/v1/query/gizmo", `g.V("<a>").Out("<follows>").GetQuads()`))
+	if expect := []interface{}{expectQuad}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected quads:\n%v\nvs\n%v", got, expect)
+	}
+
+	// streamed results are written one per line, followed by metadata
+	lines := strings.Split(strings.TrimSpace(run(t, "/api/v1/query/gizmo?stream=true", typed)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected response: %q", lines)
+	}
+	if got := result(t, lines[0]); !reflect.DeepEqual(got, expectTyped) {
+		t.Errorf("unexpected streamed result:\n%v\nvs\n%v", got, expectTyped)
+	}
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// ServeV1Status returns capabilities of the quad store, so clients can check
+// why an optional feature (for example, snapshots or history) is not available.
+func (api *API) ServeV1Status(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"features": graph.FeaturesOf(h.QuadStore),
+	})
+}
+
+type predicateStats struct {
+	Predicate string `json:"predicate"`
+	Quads     int64  `json:"quads"`
+}
+
+type statsResponse struct {
+	Nodes      int64            `json:"nodes"`
+	Quads      int64            `json:"quads"`
+	Predicates []predicateStats `json:"predicates"`
+	Horizon    int64            `json:"horizon"`
+	Updated    *time.Time       `json:"updated,omitempty"`
+	Changes    int64            `json:"changes"`
+	Stale      bool             `json:"stale"`
+}
+
+// ServeV1Stats returns statistics of the quad store, and how stale they are.
+func (api *API) ServeV1Stats(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	st, err := graph.StatisticsOf(r.Context(), h.QuadStore)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := statsResponse{
+		Nodes:      st.Nodes,
+		Quads:      st.Quads,
+		Predicates: make([]predicateStats, 0, len(st.Predicates)),
+		Horizon:    st.Horizon,
+		Changes:    st.Changes,
+		Stale:      st.Stale,
+	}
+	if !st.Updated.IsZero() {
+		resp.Updated = &st.Updated
+	}
+	for _, p := range st.Predicates {
+		resp.Predicates = append(resp.Predicates, predicateStats{
+			Predicate: quad.StringOf(p.Predicate), Quads: p.Quads,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
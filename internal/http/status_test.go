@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestStatus(t *testing.T) {
+	mem, _ := newTestHandle(t)
+	for _, c := range []struct {
+		name   string
+		handle *graph.Handle
+		expect graph.Features
+	}{
+		{"history", newHistoryHandle(t), graph.Features{
+			Ordered: true, Seek: true, BulkLookup: true, DeltaLog: true,
+		}},
+		{"memstore", mem, graph.Features{
+			Seek: true, LabelIndex: true,
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h, err := NewHandler(c.handle, &Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/status", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+			}
+			var out struct {
+				Features graph.Features `json:"features"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Features != c.expect {
+				t.Errorf("unexpected features: %+v vs %+v", out.Features, c.expect)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	handle := newHistoryHandle(t)
+	err := handle.QuadWriter.AddQuadSet([]quad.Quad{
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("b", "follows", "c", ""),
+		quad.MakeIRI("a", "likes", "c", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, qs := newTestHandle(t, quad.MakeIRI("a", "follows", "b", ""))
+	for _, c := range []struct {
+		name   string
+		handle *graph.Handle
+		expect statsResponse
+	}{
+		{"kv", handle, statsResponse{
+			Nodes: 5, Quads: 3,
+			Predicates: []predicateStats{
+				{Predicate: "<follows>", Quads: 2},
+				{Predicate: "<likes>", Quads: 1},
+			},
+			Changes: 3, Stale: true,
+		}},
+		{"memstore", mem, statsResponse{
+			Nodes: -1, Quads: qs.Size(), Predicates: []predicateStats{},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h, err := NewHandler(c.handle, &Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+			}
+			var out statsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			out.Horizon = 0
+			if !reflect.DeepEqual(out, c.expect) {
+				t.Errorf("unexpected stats: %+v vs %+v", out, c.expect)
+			}
+		})
+	}
+}
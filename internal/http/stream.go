@@ -0,0 +1,192 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/server/http"
+)
+
+const (
+	// DefaultStreamBuffer is the default number of results buffered for streamed responses.
+	DefaultStreamBuffer = 100
+	// DefaultStreamFlushInterval is the default maximal time between flushes of streamed responses.
+	DefaultStreamFlushInterval = 100 * time.Millisecond
+	// DefaultStallTimeout is the default time after which a streamed query is cancelled
+	// if the client does not read results.
+	DefaultStallTimeout = 30 * time.Second
+)
+
+// contentTypeNDJSON is a content type of streamed responses: one JSON object per line.
+const contentTypeNDJSON = "application/x-ndjson"
+
+// ErrStalled is reported in the last line of a streamed response, if the client was
+// not reading results and the query was cancelled.
+var ErrStalled = errors.New("client is not reading results, query was cancelled")
+
+// streamLine is a single line of a streamed response. Each result is written as a separate
+// line, and the last line contains either query metadata or an error.
+type streamLine struct {
+	Result    interface{} `json:"result,omitempty"`
+	Meta      *query.Meta `json:"meta,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// streamWriter encodes lines of a streamed response. The header is only written
+// with the first line, thus an error can still be returned with a different status
+// if no results were written.
+type streamWriter struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	started bool
+	last    time.Time
+	err     error
+}
+
+func newStreamWriter(w http.ResponseWriter) *streamWriter {
+	return &streamWriter{w: w, enc: json.NewEncoder(w), last: time.Now()}
+}
+
+func (sw *streamWriter) write(l streamLine) {
+	if sw.err != nil {
+		return
+	}
+	if !sw.started {
+		sw.started = true
+		sw.w.Header().Set("Content-Type", contentTypeNDJSON)
+		sw.w.WriteHeader(http.StatusOK)
+	}
+	sw.err = sw.enc.Encode(l)
+}
+
+func (sw *streamWriter) flush() {
+	sw.last = time.Now()
+	if f, ok := sw.w.(http.Flusher); ok && sw.started && sw.err == nil {
+		f.Flush()
+	}
+}
+
+func (api *API) streamConfig() (size int, interval, stall time.Duration) {
+	size, interval, stall = api.config.StreamBuffer, api.config.StreamFlushInterval, api.config.StallTimeout
+	if size <= 0 {
+		size = DefaultStreamBuffer
+	}
+	if interval <= 0 {
+		interval = DefaultStreamFlushInterval
+	}
+	if stall <= 0 {
+		stall = DefaultStallTimeout
+	}
+	return
+}
+
+// streamQuery executes the query and writes each result as soon as it's available.
+//
+// Results are passed to the client through a bounded buffer. If the buffer stays full
+// for longer than the stall timeout, the query is cancelled, which stops and closes
+// its iterators, and the response is terminated with a truncation marker.
+func (api *API) streamQuery(ctx context.Context, w http.ResponseWriter, ses query.Session, st query.Streamer,
+	code string, limit int, errFunc func(query.ResponseWriter, error), meta func(n int) *query.Meta) {
+	size, interval, stall := api.streamConfig()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := make(chan query.Result, 5)
+	go ses.Execute(ctx, code, c, limit)
+
+	var (
+		sw     = newStreamWriter(w)
+		buf    = make(chan interface{}, size)
+		abort  = make(chan struct{}) // closed to drop buffered results
+		failed = make(chan struct{}) // closed if the client has gone away
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for v := range buf {
+			if sw.err != nil {
+				continue
+			}
+			select {
+			case <-abort:
+				continue
+			default:
+			}
+			sw.write(streamLine{Result: cayleyhttp.JSONValue(v)})
+			if sw.err != nil {
+				close(failed)
+				continue
+			}
+			if len(buf) == 0 || time.Since(sw.last) >= interval {
+				sw.flush()
+			}
+		}
+	}()
+
+	var stalled bool
+	send := func(v interface{}) bool {
+		select {
+		case buf <- v:
+			return true
+		default:
+		}
+		t := time.NewTimer(stall)
+		defer t.Stop()
+		select {
+		case buf <- v:
+			return true
+		case <-failed:
+			return false
+		case <-t.C:
+			stalled = true
+			return false
+		}
+	}
+
+	var (
+		n   int
+		err error
+	)
+	for res := range c {
+		if err = res.Err(); err != nil {
+			break
+		}
+		v, ok := st.FormatResult(res)
+		if !ok {
+			continue
+		}
+		if !send(v) {
+			break
+		}
+		n++
+	}
+	// release the backend as soon as possible
+	stopQuery(cancel, c)
+	if stalled {
+		close(abort)
+	}
+	close(buf)
+	<-done
+
+	switch {
+	case sw.err != nil:
+		clog.Warningf("streaming query results failed: %v", sw.err)
+		return
+	case stalled:
+		sw.write(streamLine{Error: ErrStalled.Error(), Truncated: true})
+	case err != nil && !sw.started:
+		errFunc(w, err)
+		return
+	case err != nil:
+		sw.write(streamLine{Error: err.Error(), Truncated: true})
+	default:
+		sw.write(streamLine{Meta: meta(n)})
+	}
+	sw.flush()
+}
@@ -0,0 +1,176 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/query"
+)
+
+type streamResult struct {
+	v graph.Value
+}
+
+func (r streamResult) Result() interface{} { return r.v }
+func (r streamResult) Err() error          { return nil }
+
+type closeIterator struct {
+	*iterator.Fixed
+	closed bool
+}
+
+func (it *closeIterator) Close() error {
+	it.closed = true
+	return it.Fixed.Close()
+}
+
+// streamSession returns a fixed number of results by running an iterator.
+type streamSession struct {
+	n    int
+	it   *closeIterator
+	err  error // context error when the query has finished
+	done chan struct{}
+}
+
+func (s *streamSession) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(s.done)
+	defer close(out)
+	s.it = &closeIterator{Fixed: iterator.NewFixed()}
+	for i := 0; i < s.n; i++ {
+		s.it.Add(iterator.Int64Node(i))
+	}
+	graph.Iterate(ctx, s.it).UnOptimized().Paths(false).Each(func(v graph.Value) {
+		select {
+		case out <- streamResult{v: v}:
+		case <-ctx.Done():
+		}
+	})
+	s.err = ctx.Err()
+}
+
+func (s *streamSession) FormatResult(r query.Result) (interface{}, bool) {
+	return int64(r.Result().(iterator.Int64Node)), true
+}
+
+func (s *streamSession) ShapeOf(string) (interface{}, error) { return nil, nil }
+func (s *streamSession) Collate(query.Result)                {}
+func (s *streamSession) Results() (interface{}, error)       { return nil, nil }
+
+// slowWriter blocks all writes until it's released.
+type slowWriter struct {
+	*httptest.ResponseRecorder
+	release chan struct{}
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+func readStream(t *testing.T, body []byte) []streamLine {
+	var out []streamLine
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		var l streamLine
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("cannot decode line %q: %v", sc.Text(), err)
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func TestQueryStream(t *testing.T) {
+	var ses *streamSession
+	query.RegisterLanguage(query.Language{
+		Name: "test-stream",
+		HTTP: func(qs graph.QuadStore) query.HTTP { return ses },
+	})
+	qs := memstore.New()
+	api := &API{config: &Config{
+		StreamBuffer: 4,
+		StallTimeout: 50 * time.Millisecond,
+	}, handle: &graph.Handle{QuadStore: qs}}
+	params := httprouter.Params{{Key: "query_lang", Value: "test-stream"}}
+	newReq := func() *http.Request {
+		return httptest.NewRequest("POST", "/api/v1/query/test-stream?stream=true&limit=-1", bytes.NewBufferString("q"))
+	}
+
+	t.Run("all", func(t *testing.T) {
+		ses = &streamSession{n: 10, done: make(chan struct{})}
+		w := httptest.NewRecorder()
+		api.ServeV1Query(w, newReq(), params)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+		} else if ct := w.Header().Get("Content-Type"); ct != contentTypeNDJSON {
+			t.Errorf("unexpected content type: %q", ct)
+		}
+		lines := readStream(t, w.Body.Bytes())
+		if len(lines) != 11 {
+			t.Fatalf("unexpected number of lines: %d", len(lines))
+		}
+		for i, l := range lines[:10] {
+			if l.Result != float64(i) {
+				t.Errorf("unexpected result: %v", l.Result)
+			}
+		}
+		last := lines[10]
+		if last.Meta == nil || last.Meta.Count != 10 || last.Meta.Truncated || last.Truncated {
+			t.Errorf("unexpected last line: %#v", last)
+		}
+		if !ses.it.closed {
+			t.Error("iterator was not closed")
+		}
+	})
+	t.Run("stalled", func(t *testing.T) {
+		ses = &streamSession{n: 10000, done: make(chan struct{})}
+		w := &slowWriter{ResponseRecorder: httptest.NewRecorder(), release: make(chan struct{})}
+		served := make(chan struct{})
+		go func() {
+			defer close(served)
+			api.ServeV1Query(w, newReq(), params)
+		}()
+		select {
+		case <-ses.done:
+		case <-time.After(5 * time.Second):
+			close(w.release)
+			t.Fatal("query was not cancelled")
+		}
+		if ses.err != context.Canceled {
+			t.Errorf("unexpected query error: %v", ses.err)
+		}
+		if !ses.it.closed {
+			t.Error("iterator was not closed")
+		}
+		close(w.release)
+		<-served
+
+		lines := readStream(t, w.Body.Bytes())
+		if len(lines) < 2 || len(lines) >= 100 {
+			t.Fatalf("unexpected number of lines: %d", len(lines))
+		}
+		last := lines[len(lines)-1]
+		if !last.Truncated || last.Error != ErrStalled.Error() || last.Meta != nil {
+			t.Errorf("unexpected last line: %#v", last)
+		}
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/query/mql?stream=true", bytes.NewBufferString(`[{"id": null}]`))
+		api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status: %d", w.Code)
+		}
+	})
+}
@@ -15,13 +15,16 @@
 package http
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 
@@ -69,12 +72,185 @@ func readLimit(r io.Reader) ([]byte, error) {
 	return data, err
 }
 
+// isNQuadsRequest checks if the body of the write request is an N-Quads document
+// rather than a JSON list of quads.
+func isNQuadsRequest(r *http.Request) bool {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct == "text/plain" {
+		return r.URL.Query().Get("format") == "nquads"
+	}
+	f := quad.FormatByMime(ct)
+	return f != nil && f.Name == "nquads"
+}
+
+// writeParams returns the batch size and the blank node mode requested for the write.
+func writeParams(r *http.Request) (int, quad.BNodeMode, error) {
+	blockSize, err := strconv.Atoi(r.URL.Query().Get("block_size"))
+	if err != nil || blockSize <= 0 {
+		blockSize = quad.DefaultBatch
+	}
+	bnodes := quad.BNodeScope
+	if s := r.URL.Query().Get("bnodes"); s != "" {
+		if bnodes, err = quad.BNodeModeByName(s); err != nil {
+			return 0, bnodes, err
+		}
+	}
+	return blockSize, bnodes, nil
+}
+
+// writeValidation returns validation rules for the write request. The validation
+// mode from the config can be overridden with the "validate" parameter.
+func (api *API) writeValidation(r *http.Request) (quad.Validation, error) {
+	v := api.config.Validation
+	if s := r.URL.Query().Get("validate"); s != "" {
+		mode, err := quad.ValidationModeByName(s)
+		if err != nil {
+			return v, err
+		}
+		v.Mode = mode
+	}
+	return v, nil
+}
+
+// maxWriteErrors is the maximal number of parse errors reported for a single write request.
+const maxWriteErrors = 100
+
+type lineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// validationErrorResponse is returned when a quad of a JSON write request is not valid.
+type validationErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	Index int    `json:"index"`
+}
+
+func validationCode(err error) string {
+	if verr, ok := err.(*quad.ValidationError); ok {
+		return string(verr.Code)
+	}
+	return ""
+}
+
+type writeErrorResponse struct {
+	Error   string      `json:"error"`
+	Written int         `json:"written"`
+	Failed  int         `json:"failed"`
+	Errors  []lineError `json:"errors"`
+}
+
+// serveNQuadsWrite streams an N-Quads request body into the quad store in batches.
+// Lines that fail to parse or to pass the validation are skipped and reported in the response.
+//
+// Since the body is not buffered, batches that were already flushed stay written if the
+// request fails later. If only some of the quads were written, the response has the
+// 207 Multi-Status code and lists the errors. The number of written quads is reported
+// for failed requests as well.
+func (api *API) serveNQuadsWrite(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	switch enc := strings.ToLower(r.Header.Get("Content-Encoding")); enc {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			jsonResponse(w, 400, err)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		jsonResponse(w, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content encoding: %q", enc))
+		return
+	}
+	blockSize, bnodes, err := writeParams(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	valid, err := api.writeValidation(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	var resp writeErrorResponse
+	writeResp := func(code int) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(resp)
+	}
+	qw := graph.NewWriter(h.QuadWriter, &graph.WriterOptions{
+		Batch:      blockSize,
+		Validation: &valid,
+		OnProgress: func(p graph.WriteProgress) {
+			resp.Written = int(p.Written)
+		},
+	})
+	fail := func(err error) {
+		// buffered quads are dropped, only flushed batches are reported
+		resp.Error = err.Error()
+		writeResp(errorStatus(err))
+	}
+	dec := nquads.NewReader(body, false)
+	qr := quad.ScopeBNodes(dec, bnodes)
+	for {
+		q, err := qr.ReadQuad()
+		if err == io.EOF {
+			break
+		} else if perr, ok := err.(*nquads.ParseError); ok {
+			resp.Failed++
+			if len(resp.Errors) < maxWriteErrors {
+				resp.Errors = append(resp.Errors, lineError{Line: perr.Line, Error: perr.Err.Error()})
+			}
+			continue
+		} else if err != nil {
+			fail(err)
+			return
+		}
+		if err = qw.WriteQuad(q); err != nil {
+			if _, ok := err.(*quad.ValidationError); !ok {
+				fail(err)
+				return
+			}
+			resp.Failed++
+			if len(resp.Errors) < maxWriteErrors {
+				resp.Errors = append(resp.Errors, lineError{Line: dec.Line(), Error: err.Error(), Code: validationCode(err)})
+			}
+		}
+	}
+	if err = qw.Close(); err != nil {
+		resp.Error = err.Error()
+		writeResp(errorStatus(err))
+		return
+	}
+	if resp.Failed != 0 {
+		resp.Error = fmt.Sprintf("Failed to write %d quads.", resp.Failed)
+		if resp.Written != 0 {
+			writeResp(http.StatusMultiStatus)
+		} else {
+			writeResp(http.StatusBadRequest)
+		}
+		return
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully wrote %d quads.\"}", resp.Written)
+}
+
 func (api *API) ServeV1Write(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	if api.config.ReadOnly {
-		jsonResponse(w, 400, "Database is read-only.")
+		jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
+		return
+	}
+	if isNQuadsRequest(r) {
+		api.serveNQuadsWrite(w, r)
 		return
 	}
-	// TODO: streaming reader
 	bodyBytes, err := readLimit(r.Body)
 	if err != nil {
 		jsonResponse(w, 400, err)
@@ -85,12 +261,31 @@ func (api *API) ServeV1Write(w http.ResponseWriter, r *http.Request, _ httproute
 		jsonResponse(w, 400, err)
 		return
 	}
+	valid, err := api.writeValidation(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	for i, q := range quads {
+		if quads[i], err = valid.Apply(q); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(validationErrorResponse{
+				Error: fmt.Sprintf("invalid quad at index %d: %v", i, err),
+				Code:  validationCode(err),
+				Index: i,
+			})
+			return
+		}
+	}
 	h, err := api.GetHandleForRequest(r)
 	if err != nil {
 		jsonResponse(w, 400, err)
 		return
 	}
-	if err = h.QuadWriter.AddQuadSet(quads); err != nil {
+	// quads are written in a single batch, thus either all of them are written, or none
+	qw := graph.NewWriter(h.QuadWriter, &graph.WriterOptions{Batch: len(quads)})
+	if _, err = qw.WriteQuads(quads); err != nil {
 		jsonResponse(w, 400, err)
 		return
 	}
@@ -99,7 +294,7 @@ func (api *API) ServeV1Write(w http.ResponseWriter, r *http.Request, _ httproute
 
 func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	if api.config.ReadOnly {
-		jsonResponse(w, 400, "Database is read-only.")
+		jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
 		return
 	}
 
@@ -111,9 +306,15 @@ func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params
 	}
 	defer formFile.Close()
 
-	blockSize, blockErr := strconv.Atoi(r.URL.Query().Get("block_size"))
-	if blockErr != nil {
-		blockSize = quad.DefaultBatch
+	blockSize, bnodes, err := writeParams(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	valid, err := api.writeValidation(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
 	}
 
 	quadReader, err := decompressor.New(formFile)
@@ -125,8 +326,8 @@ func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params
 		jsonResponse(w, 400, err)
 		return
 	}
-	qw := graph.NewWriter(h.QuadWriter)
-	n, err := quad.CopyBatch(qw, dec, blockSize)
+	qw := graph.NewWriter(h.QuadWriter, &graph.WriterOptions{Batch: blockSize, Validation: &valid})
+	n, err := quad.CopyBatch(qw, quad.ScopeBNodes(dec, bnodes), blockSize)
 	if err != nil {
 		jsonResponse(w, 400, err)
 		return
@@ -141,7 +342,7 @@ func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params
 
 func (api *API) ServeV1Delete(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	if api.config.ReadOnly {
-		jsonResponse(w, 400, "Database is read-only.")
+		jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
 		return
 	}
 	bodyBytes, err := readLimit(r.Body)
@@ -168,3 +369,70 @@ func (api *API) ServeV1Delete(w http.ResponseWriter, r *http.Request, params htt
 	}
 	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d quads.\"}", len(quads))
 }
+
+// deleteMatchRequest is a body of the delete by pattern request. Empty values of the
+// pattern match any value.
+type deleteMatchRequest struct {
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Object    string `json:"object"`
+	Label     string `json:"label"`
+
+	// Confirm must be set to prevent accidental deletions.
+	Confirm bool `json:"confirm"`
+	// Force allows an empty pattern that deletes all quads.
+	Force bool `json:"force"`
+}
+
+func (api *API) ServeV1DeleteMatch(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if api.config.ReadOnly {
+		jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
+		return
+	}
+	bodyBytes, err := readLimit(r.Body)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	var req deleteMatchRequest
+	if err = json.Unmarshal(bodyBytes, &req); err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	if !req.Confirm {
+		jsonResponse(w, 400, "Deletion must be confirmed with \"confirm\": true.")
+		return
+	}
+	blockSize, _, err := writeParams(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	h, err := api.GetHandleForRequest(r)
+	if err != nil {
+		jsonResponse(w, 400, err)
+		return
+	}
+	pattern := quad.Quad{
+		Subject:   quad.StringToValue(req.Subject),
+		Predicate: quad.StringToValue(req.Predicate),
+		Object:    quad.StringToValue(req.Object),
+		Label:     quad.StringToValue(req.Label),
+	}
+	n, err := graph.DeleteMatching(r.Context(), h, pattern, graph.DeleteOptions{
+		BatchSize: blockSize,
+		Force:     req.Force,
+		Progress: func(n int) {
+			clog.Infof("deleted %d quads matching %v", n, pattern)
+		},
+	})
+	if err == graph.ErrDeleteAll {
+		jsonResponse(w, 400, "Pattern matches all quads; set \"force\": true to delete everything.")
+		return
+	} else if err != nil {
+		// batches that were already applied stay deleted
+		jsonResponse(w, 400, fmt.Sprintf("deleted %d quads: %v", n, err))
+		return
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d quads.\", \"count\": %d}", n, n)
+}
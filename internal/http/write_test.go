@@ -0,0 +1,322 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+const (
+	testWriteLines = 5000
+	testWriteBad   = 7 // every Nth line is broken
+)
+
+// makeNQuadsBody returns an N-Quads document with a given number of lines,
+// and line numbers of broken quads.
+func makeNQuadsBody(n int) ([]byte, []int) {
+	var (
+		buf bytes.Buffer
+		bad []int
+	)
+	for i := 1; i <= n; i++ {
+		if i%testWriteBad == 0 {
+			fmt.Fprintf(&buf, "<n%d> <follows> .\n", i)
+			bad = append(bad, i)
+			continue
+		}
+		fmt.Fprintf(&buf, "<n%d> <follows> <n%d> .\n", i, i+1)
+	}
+	return buf.Bytes(), bad
+}
+
+func newTestWriteAPI(t testing.TB) (*API, graph.QuadStore) {
+	qs := memstore.New()
+	qw, err := writer.NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &API{config: &Config{}, handle: &graph.Handle{QuadStore: qs, QuadWriter: qw}}, qs
+}
+
+func countQuads(t testing.TB, qs graph.QuadStore) int {
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	n := 0
+	for it.Next(context.TODO()) {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWriteNQuads(t *testing.T) {
+	body, bad := makeNQuadsBody(testWriteLines)
+	var zbody bytes.Buffer
+	zw := gzip.NewWriter(&zbody)
+	zw.Write(body)
+	zw.Close()
+
+	for _, c := range []struct {
+		name string
+		ct   string
+		enc  string
+		url  string
+		body []byte
+	}{
+		{name: "nquads", ct: "application/n-quads", url: "/api/v1/write", body: body},
+		{name: "text", ct: "text/plain; charset=utf-8", url: "/api/v1/write?format=nquads", body: body},
+		{name: "gzip", ct: "application/n-quads", enc: "gzip", url: "/api/v1/write?block_size=100", body: zbody.Bytes()},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			api, qs := newTestWriteAPI(t)
+			req := httptest.NewRequest("POST", c.url, bytes.NewReader(c.body))
+			req.Header.Set("Content-Type", c.ct)
+			if c.enc != "" {
+				req.Header.Set("Content-Encoding", c.enc)
+			}
+			w := httptest.NewRecorder()
+			api.ServeV1Write(w, req, nil)
+			if w.Code != http.StatusMultiStatus {
+				t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+			}
+			var resp writeErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			expect := testWriteLines - len(bad)
+			if resp.Written != expect {
+				t.Errorf("unexpected number of written quads: %d vs %d", resp.Written, expect)
+			}
+			if n := countQuads(t, qs); n != expect {
+				t.Errorf("unexpected number of quads in the store: %d vs %d", n, expect)
+			}
+			if resp.Failed != len(bad) {
+				t.Errorf("unexpected number of failed quads: %d vs %d", resp.Failed, len(bad))
+			}
+			if len(resp.Errors) != maxWriteErrors {
+				t.Fatalf("unexpected number of reported errors: %d", len(resp.Errors))
+			}
+			for i, e := range resp.Errors {
+				if e.Line != bad[i] {
+					t.Errorf("unexpected error line: %d vs %d", e.Line, bad[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteNQuadsValid(t *testing.T) {
+	api, qs := newTestWriteAPI(t)
+	body := "<a> <follows> <b> .\n<b> <follows> <c> .\n"
+	req := httptest.NewRequest("POST", "/api/v1/write", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/n-quads")
+	w := httptest.NewRecorder()
+	api.ServeV1Write(w, req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	if n := countQuads(t, qs); n != 2 {
+		t.Errorf("unexpected number of quads in the store: %d", n)
+	}
+
+	// unknown encodings are rejected
+	req = httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(nil))
+	req.Header.Set("Content-Type", "application/n-quads")
+	req.Header.Set("Content-Encoding", "br")
+	w = httptest.NewRecorder()
+	api.ServeV1Write(w, req, nil)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWriteValidation(t *testing.T) {
+	api, qs := newTestWriteAPI(t)
+	body := `[
+		{"subject": " alice ", "predicate": "<name>", "object": "A", "label": "  "},
+		{"subject": "<b>", "predicate": "<name>", "object": "B\u0007"}
+	]`
+	// quads are written as-is by default
+	req := httptest.NewRequest("POST", "/api/v1/write", bytes.NewBufferString(`[{"subject": "<a>", "predicate": "<name>", "object": " A\u0007"}]`))
+	w := httptest.NewRecorder()
+	api.ServeV1Write(w, req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	} else if qs.ValueOf(quad.String(" A\u0007")) == nil {
+		t.Error("value was changed without validation")
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/write?validate=lenient", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	api.ServeV1Write(w, req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	for _, v := range []quad.Value{quad.String("alice"), quad.String("B")} {
+		if qs.ValueOf(v) == nil {
+			t.Errorf("normalized value %v was not written", v)
+		}
+	}
+	if n := countQuads(t, qs); n != 3 {
+		t.Errorf("unexpected number of quads in the store: %d", n)
+	}
+
+	// strict mode rejects the whole JSON request
+	req = httptest.NewRequest("POST", "/api/v1/write?validate=strict", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	api.ServeV1Write(w, req, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	var verr validationErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&verr); err != nil {
+		t.Fatal(err)
+	} else if verr.Code != string(quad.CodeWhitespace) || verr.Index != 0 {
+		t.Errorf("unexpected error: %+v", verr)
+	}
+
+	// N-Quads lines are reported separately
+	nq := "<c> <name> \"C\" .\n<d> \"full name\" \"D\" .\n<e> <name> \"E\\u0000\" .\n"
+	req = httptest.NewRequest("POST", "/api/v1/write?validate=strict", bytes.NewBufferString(nq))
+	req.Header.Set("Content-Type", "application/n-quads")
+	w = httptest.NewRecorder()
+	api.ServeV1Write(w, req, nil)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	var resp writeErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	expect := []lineError{
+		{Line: 2, Code: string(quad.CodeLiteralPredicate)},
+		{Line: 3, Code: string(quad.CodeControlChar)},
+	}
+	if resp.Written != 1 || len(resp.Errors) != len(expect) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	for i, e := range expect {
+		if got := resp.Errors[i]; got.Line != e.Line || got.Code != e.Code {
+			t.Errorf("unexpected error: %+v vs %+v", got, e)
+		}
+	}
+
+	// nothing was written
+	req = httptest.NewRequest("POST", "/api/v1/write?validate=strict", bytes.NewBufferString("<f> <name> \"F\u0000\" .\n<g> .\n"))
+	req.Header.Set("Content-Type", "application/n-quads")
+	w = httptest.NewRecorder()
+	api.ServeV1Write(w, req, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	resp = writeErrorResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Written != 0 || resp.Failed != 2 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestDeleteMatch(t *testing.T) {
+	api, qs := newTestWriteAPI(t)
+	body, _ := makeNQuadsBody(100)
+	req := httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/n-quads")
+	api.ServeV1Write(httptest.NewRecorder(), req, nil)
+	total := countQuads(t, qs)
+	if err := api.handle.QuadWriter.AddQuad(quad.MakeIRI("n1", "likes", "n2", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	deleteMatch := func(url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", url, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		api.ServeV1DeleteMatch(w, req, nil)
+		return w
+	}
+
+	// deletion must be confirmed
+	if w := deleteMatch("/api/v1/delete/match", `{"predicate": "<follows>"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	w := deleteMatch("/api/v1/delete/match?block_size=10", `{"predicate": "<follows>", "confirm": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Count != total {
+		t.Errorf("unexpected number of deleted quads: %d vs %d", resp.Count, total)
+	}
+	if n := countQuads(t, qs); n != 1 {
+		t.Errorf("unexpected number of quads in the store: %d", n)
+	}
+
+	// empty pattern must be forced
+	if w := deleteMatch("/api/v1/delete/match", `{"confirm": true}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	} else if n := countQuads(t, qs); n != 1 {
+		t.Errorf("unexpected number of quads in the store: %d", n)
+	}
+	if w := deleteMatch("/api/v1/delete/match", `{"confirm": true, "force": true}`); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	} else if n := countQuads(t, qs); n != 0 {
+		t.Errorf("unexpected number of quads in the store: %d", n)
+	}
+}
+
+func TestWriteReadOnly(t *testing.T) {
+	api, qs := newTestWriteAPI(t)
+	api.config.ReadOnly = true
+	body := `[{"subject": "<a>", "predicate": "<follows>", "object": "<b>"}]`
+	for _, fnc := range []func(http.ResponseWriter, *http.Request, httprouter.Params){
+		api.ServeV1Write, api.ServeV1Delete,
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/write", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		fnc(w, req, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+		}
+		var resp ErrorQueryWrapper
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		} else if resp.ErrorCode != graph.CodeReadOnly {
+			t.Errorf("unexpected error: %+v", resp)
+		}
+	}
+	if n := countQuads(t, qs); n != 0 {
+		t.Errorf("unexpected number of quads in the store: %d", n)
+	}
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,13 +14,14 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/internal/decompressor"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/csv"
 	"github.com/cayleygraph/cayley/quad/nquads"
 )
 
-// Load loads a graph from the given path and write it to qw.  See
-// DecompressAndLoad for more information.
+// Load loads a graph from the given path and write it to qw. Blank nodes are
+// renamed to be unique for this load. See DecompressAndLoad for more information.
 func Load(qw graph.QuadWriter, batch int, path, typ string) error {
-	return DecompressAndLoad(qw, batch, path, typ, nil)
+	return DecompressAndLoad(qw, batch, path, typ, quad.BNodeScope, quad.Validation{})
 }
 
 type readCloser struct {
@@ -41,7 +43,9 @@ type nopCloser struct {
 
 func (r nopCloser) Close() error { return nil }
 
-func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
+// openSource opens a local file, stdin or a remote resource and decompresses it.
+// It returns a nil reader if the source is empty.
+func openSource(path string) (io.Reader, io.Closer, error) {
 	var (
 		r io.Reader
 		c io.Closer
@@ -56,15 +60,15 @@ func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
 		}
 		f, err := os.Open(path)
 		if os.IsNotExist(err) {
-			return nil, err
+			return nil, nil, err
 		} else if err != nil {
-			return nil, fmt.Errorf("could not open file %q: %v", path, err)
+			return nil, nil, fmt.Errorf("could not open file %q: %v", path, err)
 		}
 		r, c = f, f
 	} else {
 		res, err := http.Get(path)
 		if err != nil {
-			return nil, fmt.Errorf("could not get resource <%s>: %v", u, err)
+			return nil, nil, fmt.Errorf("could not get resource <%s>: %v", u, err)
 		}
 		// TODO(dennwc): save content type for format auto-detection
 		r, c = res.Body, res.Body
@@ -76,52 +80,130 @@ func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
 			c.Close()
 		}
 		if err == io.EOF {
-			return nopCloser{quad.NewReader(nil)}, nil
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return r, c, nil
+}
+
+// trimExt returns a file extension of the path, ignoring compression extensions.
+func trimExt(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, ".bz2")
+	return filepath.Ext(name)
+}
+
+func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
+	r, c, err := openSource(path)
+	if err != nil {
+		return nil, err
+	} else if r == nil {
+		return nopCloser{quad.NewReader(nil)}, nil
+	}
+	qr, err := quadReader(r, path, typ)
+	if err != nil {
+		if c != nil {
+			c.Close()
 		}
 		return nil, err
 	}
+	if c != nil {
+		return readCloser{ReadCloser: qr, close: c.Close}, nil
+	}
+	return qr, nil
+}
 
-	var qr quad.ReadCloser
+// quadReader returns a reader for decompressed data of a quad file. Format is detected
+// by the file extension if typ is empty. Line-based files are detected by their content.
+func quadReader(r io.Reader, path, typ string) (quad.ReadCloser, error) {
 	switch typ {
 	case "cquad", "nquad": // legacy
-		qr = nquads.NewReader(r, false)
-	default:
-		var format *quad.Format
-		if typ == "" {
-			name := filepath.Base(path)
-			name = strings.TrimSuffix(name, ".gz")
-			name = strings.TrimSuffix(name, ".bz2")
-			format = quad.FormatByExt(filepath.Ext(name))
-			if format == nil {
-				typ = "nquads"
+		return nquads.NewReader(r, false), nil
+	}
+	var format *quad.Format
+	if typ == "" {
+		format = quad.FormatByExt(trimExt(path))
+		if format == nil || format.Name == "nquads" || format.Name == "ntriples" {
+			// reuse buffered readers, so the position of quads is known to the caller
+			br, ok := r.(*bufio.Reader)
+			if !ok {
+				br = bufio.NewReaderSize(r, detectSize)
+				r = br
 			}
-		}
-		if format == nil {
-			format = quad.FormatByName(typ)
-		}
-		if format == nil {
-			err = fmt.Errorf("unknown quad format %q", typ)
-		} else if format.Reader == nil {
-			err = fmt.Errorf("decoding of %q is not supported", typ)
-		}
-		if err != nil {
-			if c != nil {
-				c.Close()
+			if name := DetectFormat(br); name != "" {
+				clog.Infof("detected %s format of %q", name, path)
+				format, typ = nil, name
+			} else if format == nil {
+				typ = "nquads"
 			}
-			return nil, err
 		}
-		qr = format.Reader(r)
+	}
+	if format == nil {
+		format = quad.FormatByName(typ)
+	}
+	if format == nil && typ == "turtle" {
+		return nil, fmt.Errorf("%q looks like a Turtle file, which is not supported; set the format explicitly, if it's not", path)
+	} else if format == nil {
+		return nil, fmt.Errorf("unknown quad format %q", typ)
+	} else if format.Reader == nil {
+		return nil, fmt.Errorf("decoding of %q is not supported", typ)
+	}
+	return format.Reader(r), nil
+}
+
+// TableReaderFor returns a reader that converts rows of a CSV or TSV table to quads
+// using a given mapping. Table type is detected by the file extension if typ is empty.
+//
+// If onErr is set, rows that cannot be converted are reported to it and skipped.
+// Otherwise, reader fails on the first such row.
+func TableReaderFor(path, typ string, m csv.Mapping, onErr func(err *csv.RowError)) (quad.ReadCloser, error) {
+	if typ == "" {
+		typ = strings.TrimPrefix(trimExt(path), ".")
+	}
+	if typ != "csv" && typ != "tsv" {
+		return nil, fmt.Errorf("unknown table format %q", typ)
+	}
+	r, c, err := openSource(path)
+	if err != nil {
+		return nil, err
+	} else if r == nil {
+		return nopCloser{quad.NewReader(nil)}, nil
+	}
+	var qr quad.Reader
+	if typ == "tsv" {
+		qr = csv.NewTSVReader(r, m)
+	} else {
+		qr = csv.NewReader(r, m)
+	}
+	if onErr != nil {
+		qr = csv.SkipRowErrors(qr, onErr)
 	}
 	if c != nil {
-		return readCloser{ReadCloser: qr, close: c.Close}, nil
+		return readCloser{ReadCloser: nopCloser{qr}, close: c.Close}, nil
 	}
-	return qr, nil
+	return nopCloser{qr}, nil
+}
+
+// LoadTable loads quads converted from a CSV or TSV table. See TableReaderFor for details.
+//
+// Quads are checked and normalized according to v. See quad.Validation.
+func LoadTable(qw graph.QuadWriter, batch int, path, typ string, m csv.Mapping, onErr func(err *csv.RowError), v quad.Validation) error {
+	qr, err := TableReaderFor(path, typ, m, onErr)
+	if err != nil {
+		return err
+	}
+	defer qr.Close()
+	return loadFrom(graph.NewWriter(qw, writerOptions(batch, v)), batch, qr)
 }
 
 // DecompressAndLoad will load or fetch a graph from the given path, decompress
-// it, and then call the given load function to process the decompressed graph.
-// If no loadFn is provided, db.Load is called.
-func DecompressAndLoad(qw graph.QuadWriter, batch int, path, typ string, writerFunc func(graph.QuadWriter) graph.BatchWriter) error {
+// it, and then write it to qw.
+//
+// Blank nodes are handled according to bnodes mode. See quad.ScopeBNodes.
+// Quads are checked and normalized according to v. See quad.Validation.
+func DecompressAndLoad(qw graph.QuadWriter, batch int, path, typ string, bnodes quad.BNodeMode, v quad.Validation) error {
 	if path == "" {
 		return nil
 	}
@@ -130,29 +212,41 @@ func DecompressAndLoad(qw graph.QuadWriter, batch int, path, typ string, writerF
 		return err
 	}
 	defer qr.Close()
+	return loadFrom(graph.NewWriter(qw, writerOptions(batch, v)), batch, quad.ScopeBNodes(qr, bnodes))
+}
 
-	if writerFunc == nil {
-		writerFunc = graph.NewWriter
+// writerOptions returns options of the quad writer used for loads. Progress is logged
+// at verbosity level 2.
+func writerOptions(batch int, v quad.Validation) *graph.WriterOptions {
+	return &graph.WriterOptions{
+		Batch:      batch,
+		Validation: &v,
+		OnProgress: func(p graph.WriteProgress) {
+			if clog.V(2) {
+				clog.Infof("Wrote %d quads.", p.Written)
+			}
+		},
 	}
-	dest := writerFunc(qw)
+}
 
-	_, err = quad.CopyBatch(&batchLogger{BatchWriter: dest}, qr, batch)
-	if err != nil {
-		return fmt.Errorf("db: failed to load data: %v", err)
-	}
-	return dest.Close()
+// loadError is returned when a load fails. The class of the underlying error
+// is preserved (see graph.ErrorCode).
+type loadError struct {
+	err error
 }
 
-type batchLogger struct {
-	cnt int
-	quad.BatchWriter
+func (e *loadError) Error() string {
+	return "db: failed to load data: " + e.err.Error()
 }
 
-func (w *batchLogger) WriteQuads(quads []quad.Quad) (int, error) {
-	n, err := w.BatchWriter.WriteQuads(quads)
-	if clog.V(2) {
-		w.cnt += n
-		clog.Infof("Wrote %d quads.", w.cnt)
+func (e *loadError) Cause() error {
+	return e.err
+}
+
+func loadFrom(dest graph.BatchWriter, batch int, qr quad.Reader) error {
+	_, err := quad.CopyBatch(dest, qr, batch)
+	if err != nil {
+		return &loadError{err: err}
 	}
-	return n, err
+	return dest.Close()
 }
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/csv"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+func loadBNodeFiles(t *testing.T, mode quad.BNodeMode) *memstore.QuadStore {
+	dir, err := ioutil.TempDir("", "cayley_load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	qs := memstore.New()
+	qw, err := writer.NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range []string{
+		"_:b0 <name> \"Alice\" .\n",
+		"_:b0 <name> \"Bob\" .\n",
+	} {
+		path := filepath.Join(dir, string('a'+rune(i))+".nq")
+		if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = DecompressAndLoad(qw, 0, path, "", mode, quad.Validation{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return qs
+}
+
+func subjectsOf(t *testing.T, qs graph.QuadStore) map[quad.Value]struct{} {
+	qr := graph.NewQuadStoreReader(qs)
+	defer qr.Close()
+	quads, err := quad.ReadAll(qr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[quad.Value]struct{})
+	for _, q := range quads {
+		out[q.Subject] = struct{}{}
+	}
+	return out
+}
+
+func TestLoadBNodes(t *testing.T) {
+	for _, c := range []struct {
+		mode  quad.BNodeMode
+		nodes int
+	}{
+		{mode: quad.BNodeScope, nodes: 2},
+		{mode: quad.BNodeSkolemize, nodes: 2},
+		{mode: quad.BNodePreserve, nodes: 1},
+	} {
+		t.Run(c.mode.String(), func(t *testing.T) {
+			qs := loadBNodeFiles(t, c.mode)
+			if n := len(subjectsOf(t, qs)); n != c.nodes {
+				t.Errorf("expected %d distinct subjects, got %d", c.nodes, n)
+			}
+		})
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.nq")
+	data := "<a> <name> \"Cafe\\u0301\\u0000\"@fr .\n<b> <name> \"B\" .\n"
+	if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	load := func(v quad.Validation) (*memstore.QuadStore, error) {
+		qs := memstore.New()
+		qw, err := writer.NewSingleReplication(qs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return qs, DecompressAndLoad(qw, 0, path, "", quad.BNodePreserve, v)
+	}
+
+	qs, err := load(quad.Validation{Mode: quad.ValidateLenient, CanonicalOptions: quad.CanonicalOptions{NFC: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qs.ValueOf(quad.LangString{Value: "Café", Lang: "fr"}) == nil {
+		t.Error("normalized literal was not written")
+	}
+	if qs.ValueOf(quad.IRI("b")) == nil {
+		t.Error("valid quad was not written")
+	}
+
+	if _, err = load(quad.Validation{Mode: quad.ValidateStrict}); err == nil {
+		t.Error("expected an error in strict mode")
+	} else if !strings.Contains(err.Error(), string(quad.CodeControlChar)) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTableReaderStdin(t *testing.T) {
+	f, err := ioutil.TempFile("", "cayley_table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err = f.WriteString("id,name\na,Alice\n"); err != nil {
+		t.Fatal(err)
+	} else if _, err = f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+	os.Stdin = f
+
+	m := csv.Mapping{Subject: "id", Columns: []csv.Column{{Name: "name", Predicate: "name"}}}
+	qr, err := TableReaderFor("-", "csv", m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quads, err := quad.ReadAll(qr)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(quads) != 1 {
+		t.Errorf("unexpected quads: %v", quads)
+	}
+	if err = qr.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -21,16 +21,16 @@ import (
 
 // TODO(kortschak) Reimplement without container/list.
 
-// cache implements an LRU cache.
+// cache implements an LRU cache. Keys must be comparable.
 type Cache struct {
 	mu       sync.Mutex
-	cache    map[string]*list.Element
+	cache    map[interface{}]*list.Element
 	priority *list.List
 	maxSize  int
 }
 
 type kv struct {
-	key   string
+	key   interface{}
 	value interface{}
 }
 
@@ -38,11 +38,11 @@ func New(size int) *Cache {
 	return &Cache{
 		maxSize:  size,
 		priority: list.New(),
-		cache:    make(map[string]*list.Element),
+		cache:    make(map[interface{}]*list.Element),
 	}
 }
 
-func (lru *Cache) Put(key string, value interface{}) {
+func (lru *Cache) Put(key interface{}, value interface{}) {
 	if _, ok := lru.Get(key); ok {
 		return
 	}
@@ -57,7 +57,7 @@ func (lru *Cache) Put(key string, value interface{}) {
 	lru.cache[key] = lru.priority.Front()
 }
 
-func (lru *Cache) Del(key string) {
+func (lru *Cache) Del(key interface{}) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 	e := lru.cache[key]
@@ -68,7 +68,7 @@ func (lru *Cache) Del(key string) {
 	lru.priority.Remove(e)
 }
 
-func (lru *Cache) Get(key string) (interface{}, bool) {
+func (lru *Cache) Get(key interface{}) (interface{}, bool) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 	if element, ok := lru.cache[key]; ok {
@@ -77,3 +77,11 @@ func (lru *Cache) Get(key string) (interface{}, bool) {
 	}
 	return nil, false
 }
+
+// Purge removes all entries from the cache.
+func (lru *Cache) Purge() {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.priority.Init()
+	lru.cache = make(map[interface{}]*list.Element)
+}
@@ -18,6 +18,7 @@ package repl
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -34,24 +35,22 @@ import (
 	"github.com/cayleygraph/cayley/query"
 )
 
-func trace(s string) (string, time.Time) {
-	return s, time.Now()
-}
-
-func un(s string, startTime time.Time) {
-	endTime := time.Now()
-
-	fmt.Printf(s, float64(endTime.UnixNano()-startTime.UnixNano())/float64(1E6))
+// formatMeta returns a line with query metadata that is printed after results.
+func formatMeta(m *query.Meta) string {
+	out := fmt.Sprintf("Elapsed time: %g ms", m.Elapsed)
+	if m.Truncated {
+		out += " (results truncated)"
+	}
+	out += "\n"
+	for _, w := range m.Warnings {
+		out += fmt.Sprintf("Warning: %s\n", w)
+	}
+	return out + "\n"
 }
 
 func Run(ctx context.Context, qu string, ses query.REPLSession) error {
 	nResults := 0
-	startTrace, startTime := trace("Elapsed time: %g ms\n\n")
-	defer func() {
-		if nResults > 0 {
-			un(startTrace, startTime)
-		}
-	}()
+	start := time.Now()
 	fmt.Printf("\n")
 	c := make(chan query.Result, 5)
 	go ses.Execute(ctx, qu, c, 100)
@@ -62,6 +61,16 @@ func Run(ctx context.Context, qu string, ses query.REPLSession) error {
 		fmt.Print(ses.FormatREPL(res))
 		nResults++
 	}
+	meta := &query.Meta{
+		Elapsed: float64(time.Since(start)) / float64(time.Millisecond),
+		Count:   nResults,
+	}
+	if t, ok := ses.(query.Truncater); ok {
+		meta.Truncated = t.Truncated()
+	}
+	if w, ok := ses.(query.Warner); ok {
+		meta.Warnings = w.Warnings()
+	}
 	if nResults > 0 {
 		results := "Result"
 		if nResults > 1 {
@@ -69,6 +78,9 @@ func Run(ctx context.Context, qu string, ses query.REPLSession) error {
 		}
 		fmt.Printf("-----------\n%d %s\n", nResults, results)
 	}
+	if nResults > 0 || meta.Truncated || len(meta.Warnings) != 0 {
+		fmt.Print(formatMeta(meta))
+	}
 	return nil
 }
 
@@ -81,15 +93,45 @@ const (
 	history = ".cayley_history"
 )
 
-func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout time.Duration) error {
+// defaultHandleName refers to the unnamed handle passed to Repl.
+const defaultHandleName = "default"
+
+// findHandle returns a handle with a given name. The unnamed handle can be
+// selected with defaultHandleName.
+func findHandle(def *graph.Handle, handles []graph.NamedHandle, name string) (graph.NamedHandle, error) {
+	if name == defaultHandleName {
+		if def == nil {
+			return graph.NamedHandle{}, fmt.Errorf("no default handle")
+		}
+		return graph.NamedHandle{Name: defaultHandleName, Handle: def}, nil
+	}
+	for _, h := range handles {
+		if h.Name == name {
+			return h, nil
+		}
+	}
+	return graph.NamedHandle{}, fmt.Errorf("unknown handle: %q", name)
+}
+
+// Repl runs an interactive query loop on a handle. Named handles can be selected
+// with the :use command. If h is nil, the first named handle is used.
+func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout time.Duration, handles ...graph.NamedHandle) error {
 	if queryLanguage == "" {
 		queryLanguage = defaultLanguage
 	}
-	l := query.GetLanguage(queryLanguage)
-	if l == nil || l.REPL == nil {
-		return fmt.Errorf("unsupported query language: %q", queryLanguage)
+	h0 := h // unnamed handle, if any
+	cur := graph.NamedHandle{Name: defaultHandleName, Handle: h}
+	if h == nil {
+		if len(handles) == 0 {
+			return fmt.Errorf("no handles to query")
+		}
+		cur = handles[0]
+		h = cur.Handle
+	}
+	ses, err := newSession(queryLanguage, h.QuadStore)
+	if err != nil {
+		return err
 	}
-	ses := l.REPL(h.QuadStore)
 
 	term, err := terminal(history)
 	if os.IsNotExist(err) {
@@ -163,6 +205,10 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 				continue
 
 			case ":a":
+				if cur.ReadOnly {
+					fmt.Printf("Error: handle %q is read-only\n", cur.Name)
+					continue
+				}
 				quad, err := nquads.Parse(args)
 				if err == nil {
 					err = h.QuadWriter.AddQuad(quad)
@@ -174,6 +220,10 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 				continue
 
 			case ":d":
+				if cur.ReadOnly {
+					fmt.Printf("Error: handle %q is read-only\n", cur.Name)
+					continue
+				}
 				quad, err := nquads.Parse(args)
 				if err != nil {
 					fmt.Printf("Error: not a valid quad: %v\n", err)
@@ -185,8 +235,81 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 				}
 				continue
 
+			case ":explain":
+				ex, ok := ses.(query.Explainer)
+				if !ok {
+					fmt.Printf("Error: explain is not supported for %q\n", queryLanguage)
+					continue
+				}
+				ctx, cancel := newCtx()
+				plans, err := ex.Explain(ctx, args)
+				cancel()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				data, err := json.MarshalIndent(plans, "", "  ")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				fmt.Println(string(data))
+				continue
+
+			case ":lang":
+				args = strings.TrimSpace(args)
+				if args == "" {
+					for _, name := range languages() {
+						if name == queryLanguage {
+							name += " (current)"
+						}
+						fmt.Println(name)
+					}
+					continue
+				}
+				nses, err := newSession(args, h.QuadStore)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				ses, queryLanguage = nses, args
+				fmt.Printf("Query language set to %q\n", queryLanguage)
+				continue
+
+			case ":use":
+				args = strings.TrimSpace(args)
+				if args == "" {
+					var names []string
+					if h0 != nil {
+						names = append(names, defaultHandleName)
+					}
+					for _, nh := range handles {
+						names = append(names, nh.Name)
+					}
+					for _, name := range names {
+						if name == cur.Name {
+							name += " (current)"
+						}
+						fmt.Println(name)
+					}
+					continue
+				}
+				nh, err := findHandle(h0, handles, args)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				nses, err := newSession(queryLanguage, nh.Handle.QuadStore)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				ses, cur, h = nses, nh, nh.Handle
+				fmt.Printf("Using handle %q\n", cur.Name)
+				continue
+
 			case "help":
-				fmt.Printf("Help\n\texit // Exit\n\thelp // this help\n\td: <quad> // delete quad\n\ta: <quad> // add quad\n\t:debug [t|f]\n")
+				fmt.Printf("Help\n\texit // Exit\n\thelp // this help\n\td: <quad> // delete quad\n\ta: <quad> // add quad\n\t:debug [t|f]\n\t:explain <query> // show query plan without running it\n\t:lang [name] // list query languages or switch to another one\n\t:use [handle] // list graph handles or switch to another one\n")
 				continue
 
 			case "exit":
@@ -217,6 +340,26 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 	}
 }
 
+// languages returns sorted names of registered query languages that support the REPL.
+func languages() []string {
+	var out []string
+	for _, name := range query.Languages() {
+		if l := query.GetLanguage(name); l != nil && l.REPL != nil {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// newSession creates a REPL session for a registered query language.
+func newSession(lang string, qs graph.QuadStore) (query.REPLSession, error) {
+	l := query.GetLanguage(lang)
+	if l == nil || l.REPL == nil {
+		return nil, fmt.Errorf("unsupported query language: %q", lang)
+	}
+	return l.REPL(qs), nil
+}
+
 // Splits a line into a command and its arguments
 // e.g. ":a b c d ." will be split into ":a" and " b c d ."
 func splitLine(line string) (string, string) {
@@ -15,7 +15,13 @@
 package repl
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/query"
 )
 
 var testSplitLines = []struct {
@@ -64,3 +70,111 @@ func TestSplitLines(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatMeta(t *testing.T) {
+	for _, c := range []struct {
+		meta   query.Meta
+		expect string
+	}{
+		{
+			meta:   query.Meta{Elapsed: 1.5, Count: 2},
+			expect: "Elapsed time: 1.5 ms\n\n",
+		},
+		{
+			meta:   query.Meta{Elapsed: 2, Count: 100, Truncated: true, Warnings: []string{"a", "b"}},
+			expect: "Elapsed time: 2 ms (results truncated)\nWarning: a\nWarning: b\n\n",
+		},
+	} {
+		if got := formatMeta(&c.meta); got != c.expect {
+			t.Errorf("unexpected meta line: %q vs %q", got, c.expect)
+		}
+	}
+}
+
+// toySession is a minimal query language that is registered outside of the query
+// package. It returns each word of the query as a separate result.
+type toySession struct{}
+
+type toyResult string
+
+func (r toyResult) Result() interface{} { return string(r) }
+func (toyResult) Err() error            { return nil }
+
+func (toySession) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(out)
+	for _, w := range strings.Fields(qu) {
+		select {
+		case out <- toyResult(w):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (toySession) FormatREPL(r query.Result) string {
+	return fmt.Sprintln(r.Result())
+}
+
+func TestLanguages(t *testing.T) {
+	query.RegisterLanguage(query.Language{
+		Name:    "test-toy",
+		Session: func(graph.QuadStore) query.Session { return toySession{} },
+		REPL:    func(graph.QuadStore) query.REPLSession { return toySession{} },
+	})
+	query.RegisterLanguage(query.Language{
+		Name:    "test-toy-norepl",
+		Session: func(graph.QuadStore) query.Session { return toySession{} },
+	})
+	var found bool
+	for _, name := range languages() {
+		if name == "test-toy-norepl" {
+			t.Errorf("language without REPL support is listed")
+		}
+		found = found || name == "test-toy"
+	}
+	if !found {
+		t.Fatalf("registered language is not listed: %v", languages())
+	}
+	ses, err := newSession("test-toy", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Run(context.TODO(), "a b", ses); err != nil {
+		t.Error(err)
+	}
+	if _, err = newSession("test-toy-norepl", nil); err == nil {
+		t.Error("expected an error for a language without REPL support")
+	}
+}
+
+func TestFindHandle(t *testing.T) {
+	def, a, b := &graph.Handle{}, &graph.Handle{}, &graph.Handle{}
+	handles := []graph.NamedHandle{
+		{Name: "a", Handle: a},
+		{Name: "b", Handle: b, ReadOnly: true},
+	}
+	for _, c := range []struct {
+		name   string
+		def    *graph.Handle
+		expect *graph.Handle
+		ro     bool
+	}{
+		{name: "default", def: def, expect: def},
+		{name: "default"},
+		{name: "a", def: def, expect: a},
+		{name: "b", expect: b, ro: true},
+		{name: "c", def: def},
+	} {
+		h, err := findHandle(c.def, handles, c.name)
+		if c.expect == nil {
+			if err == nil {
+				t.Errorf("expected an error for %q", c.name)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("unexpected error for %q: %v", c.name, err)
+		} else if h.Handle != c.expect || h.ReadOnly != c.ro {
+			t.Errorf("unexpected handle for %q: %+v", c.name, h)
+		}
+	}
+}
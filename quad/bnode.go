@@ -0,0 +1,160 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// BNodeMode defines how blank nodes are handled when quads are read from separate sources.
+type BNodeMode int
+
+const (
+	// BNodeScope renames blank nodes with a prefix that is unique for each source.
+	// Blank nodes with the same label from different sources are never merged.
+	BNodeScope = BNodeMode(iota)
+	// BNodeSkolemize replaces blank nodes with IRIs that are unique for each source.
+	// See SkolemBase.
+	BNodeSkolemize
+	// BNodePreserve keeps labels of blank nodes as-is. Blank nodes with the same
+	// label from different sources will refer to the same node.
+	BNodePreserve
+)
+
+var bnodeModeNames = []string{
+	BNodeScope:     "scope",
+	BNodeSkolemize: "skolem",
+	BNodePreserve:  "preserve",
+}
+
+func (m BNodeMode) String() string {
+	if int(m) < 0 || int(m) >= len(bnodeModeNames) {
+		return fmt.Sprintf("BNodeMode(%d)", int(m))
+	}
+	return bnodeModeNames[m]
+}
+
+// BNodeModeByName returns a blank node mode by its name ("scope", "skolem" or "preserve").
+func BNodeModeByName(name string) (BNodeMode, error) {
+	for i, s := range bnodeModeNames {
+		if s == name {
+			return BNodeMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown blank node mode: %q", name)
+}
+
+// SkolemPrefix is the well-known path of Skolem IRIs defined by RDF 1.1.
+// IRIs generated for blank nodes in BNodeSkolemize mode start with SkolemBase
+// followed by this path.
+const SkolemPrefix = "/.well-known/genid/"
+
+// SkolemBase is an IRI of the authority for which Skolem IRIs are generated
+// (ex: "http://example.com"). RDF 1.1 requires Skolem IRIs to be absolute, thus it
+// should be set to an authority controlled by the user. If it's empty, generated
+// IRIs are relative.
+var SkolemBase = ""
+
+// skolemPrefix returns a prefix of IRIs generated for blank nodes.
+func skolemPrefix() string {
+	return strings.TrimSuffix(SkolemBase, "/") + SkolemPrefix
+}
+
+// NewBNodeScope returns a new unique scope for blank node labels. See ScopeBNodesIn.
+func NewBNodeScope() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:]) + "_"
+}
+
+// ScopeBNodes wraps a quad reader to handle blank nodes according to a given mode.
+// A new unique scope is generated for each call, thus blank nodes from readers
+// wrapped separately stay distinct (unless mode is BNodePreserve).
+func ScopeBNodes(r Reader, mode BNodeMode) Reader {
+	return ScopeBNodesIn(r, mode, NewBNodeScope())
+}
+
+// ScopeBNodesIn is like ScopeBNodes, but uses a given scope instead of generating a new one.
+// Readers wrapped with the same scope produce the same blank nodes, which allows to continue
+// reading a source that was partially read before, e.g. when resuming an interrupted load.
+func ScopeBNodesIn(r Reader, mode BNodeMode, scope string) Reader {
+	if mode == BNodePreserve {
+		return r
+	}
+	br := &bnodeReader{r: r, prefix: scope}
+	if mode == BNodeSkolemize {
+		br.skolem = skolemPrefix()
+	}
+	return br
+}
+
+type bnodeReader struct {
+	r      Reader
+	skolem string // prefix of Skolem IRIs, if blank nodes are skolemized
+	prefix string
+}
+
+func (r *bnodeReader) rename(v Value) Value {
+	b, ok := v.(BNode)
+	if !ok {
+		return v
+	}
+	label := r.prefix + string(b)
+	if r.skolem != "" {
+		return IRI(r.skolem + label)
+	}
+	return BNode(label)
+}
+
+func (r *bnodeReader) ReadQuad() (Quad, error) {
+	q, err := r.r.ReadQuad()
+	if err != nil {
+		return q, err
+	}
+	for _, d := range Directions {
+		q.Set(d, r.rename(q.Get(d)))
+	}
+	return q, nil
+}
+
+// Unskolemize wraps a quad reader to convert IRIs generated in BNodeSkolemize mode
+// back to blank nodes. Blank nodes keep their scoped labels. IRIs are recognized by
+// the current SkolemBase.
+func Unskolemize(r Reader) Reader {
+	return unskolemReader{r: r, prefix: skolemPrefix()}
+}
+
+type unskolemReader struct {
+	r      Reader
+	prefix string
+}
+
+func (r unskolemReader) ReadQuad() (Quad, error) {
+	q, err := r.r.ReadQuad()
+	if err != nil {
+		return q, err
+	}
+	for _, d := range Directions {
+		if iri, ok := q.Get(d).(IRI); ok && strings.HasPrefix(string(iri), r.prefix) {
+			q.Set(d, BNode(strings.TrimPrefix(string(iri), r.prefix)))
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,85 @@
+package quad
+
+import (
+	"strings"
+	"testing"
+)
+
+func readScoped(t *testing.T, mode BNodeMode, quads ...Quad) []Quad {
+	out, err := ReadAll(ScopeBNodes(NewReader(quads), mode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestScopeBNodes(t *testing.T) {
+	q := Quad{BNode("b0"), IRI("name"), String("x"), BNode("b1")}
+
+	a := readScoped(t, BNodeScope, q, q)
+	b := readScoped(t, BNodeScope, q)
+	if a[0] != a[1] {
+		t.Errorf("blank nodes should be renamed consistently within a scope: %v vs %v", a[0], a[1])
+	}
+	if a[0].Subject == b[0].Subject {
+		t.Errorf("blank nodes from different scopes should be distinct: %v", a[0].Subject)
+	}
+	if _, ok := a[0].Subject.(BNode); !ok {
+		t.Errorf("expected a blank node, got: %#v", a[0].Subject)
+	}
+	if a[0].Predicate != q.Predicate || a[0].Object != q.Object {
+		t.Errorf("only blank nodes should be renamed: %v", a[0])
+	}
+
+	if p := readScoped(t, BNodePreserve, q); p[0] != q {
+		t.Errorf("blank nodes should be preserved: %v", p[0])
+	}
+
+	s := readScoped(t, BNodeSkolemize, q)
+	iri, ok := s[0].Subject.(IRI)
+	if !ok || !strings.HasPrefix(string(iri), SkolemPrefix) {
+		t.Fatalf("expected a skolem IRI, got: %#v", s[0].Subject)
+	}
+	u, err := ReadAll(Unskolemize(NewReader(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bn, ok := u[0].Subject.(BNode); !ok || !strings.HasSuffix(string(bn), "b0") {
+		t.Errorf("expected skolem IRI to be converted back to a blank node, got: %#v", u[0].Subject)
+	} else if u[0].Label != BNode(strings.TrimSuffix(string(bn), "b0")+"b1") {
+		t.Errorf("unexpected label: %#v", u[0].Label)
+	}
+}
+
+func TestSkolemBase(t *testing.T) {
+	defer func(base string) { SkolemBase = base }(SkolemBase)
+	SkolemBase = "http://example.com/"
+
+	q := Quad{Subject: BNode("b0"), Predicate: IRI("p"), Object: String("o")}
+	s := readScoped(t, BNodeSkolemize, q)
+	iri, ok := s[0].Subject.(IRI)
+	if !ok || !strings.HasPrefix(string(iri), "http://example.com"+SkolemPrefix) {
+		t.Fatalf("expected an absolute skolem IRI, got: %#v", s[0].Subject)
+	}
+	u, err := ReadAll(Unskolemize(NewReader(s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := u[0].Subject.(BNode); !ok {
+		t.Errorf("expected skolem IRI to be converted back to a blank node, got: %#v", u[0].Subject)
+	}
+}
+
+func TestBNodeModeByName(t *testing.T) {
+	for _, m := range []BNodeMode{BNodeScope, BNodeSkolemize, BNodePreserve} {
+		got, err := BNodeModeByName(m.String())
+		if err != nil {
+			t.Fatal(err)
+		} else if got != m {
+			t.Errorf("unexpected mode: %v vs %v", got, m)
+		}
+	}
+	if _, err := BNodeModeByName("unknown"); err == nil {
+		t.Error("expected an error for unknown mode")
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package csv converts rows of CSV and TSV tables to quads.
+//
+// Unlike other quad formats, tables need a Mapping that describes how columns
+// are converted to quads, thus this format is not registered in the quad package.
+package csv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Column describes how values of a single column are converted to quads.
+//
+// Each non-empty value of the column produces a quad with the row subject,
+// the column predicate and the value as an object.
+type Column struct {
+	// Name is the name of the column in the table header.
+	Name string `json:"column"`
+	// Predicate is an IRI of the predicate for values of this column.
+	Predicate string `json:"predicate"`
+	// Datatype is an optional IRI of the value type (ex: "xsd:integer").
+	Datatype string `json:"datatype,omitempty"`
+	// Lang is an optional language of string values.
+	Lang string `json:"lang,omitempty"`
+	// IRI indicates that values are IRIs, not strings.
+	IRI bool `json:"iri,omitempty"`
+}
+
+// Mapping describes how rows of a table are converted to quads.
+type Mapping struct {
+	// Subject is either the name of a column with subject IRIs, or a template
+	// that references columns as "{{name}}" (ex: "person:{{id}}").
+	// Subjects that start with "_:" are blank nodes.
+	Subject string `json:"subject"`
+	// Columns is a list of columns that are converted to quads.
+	Columns []Column `json:"columns"`
+	// Label is an optional IRI of the label for all quads.
+	Label string `json:"label,omitempty"`
+}
+
+// ReadMapping reads a JSON mapping definition.
+func ReadMapping(r io.Reader) (*Mapping, error) {
+	var m Mapping
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+var reTemplateVar = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// columnNames returns names of all columns referenced by the mapping.
+func (m *Mapping) columnNames() []string {
+	var names []string
+	if !strings.Contains(m.Subject, "{{") {
+		names = append(names, m.Subject)
+	} else {
+		for _, sub := range reTemplateVar.FindAllStringSubmatch(m.Subject, -1) {
+			names = append(names, sub[1])
+		}
+	}
+	for _, c := range m.Columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Validate checks if the mapping is correct.
+func (m *Mapping) Validate() error {
+	if m.Subject == "" {
+		return errors.New("csv: subject is not set")
+	}
+	for _, c := range m.Columns {
+		if c.Name == "" {
+			return errors.New("csv: column name is not set")
+		} else if c.Predicate == "" {
+			return fmt.Errorf("csv: predicate is not set for column %q", c.Name)
+		} else if c.Lang != "" && (c.Datatype != "" || c.IRI) {
+			return fmt.Errorf("csv: language can only be set for string values (column %q)", c.Name)
+		} else if c.Datatype != "" && c.IRI {
+			return fmt.Errorf("csv: datatype cannot be set for IRI values (column %q)", c.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Mapping) subject(row map[string]string) quad.Value {
+	var s string
+	if !strings.Contains(m.Subject, "{{") {
+		s = row[m.Subject]
+	} else {
+		empty := false
+		s = reTemplateVar.ReplaceAllStringFunc(m.Subject, func(v string) string {
+			name := reTemplateVar.FindStringSubmatch(v)[1]
+			val := row[name]
+			if val == "" {
+				empty = true
+			}
+			return val
+		})
+		if empty {
+			return nil
+		}
+	}
+	if s == "" {
+		return nil
+	} else if strings.HasPrefix(s, "_:") {
+		return quad.BNode(s[2:])
+	}
+	return quad.IRI(s).Full()
+}
+
+func (c *Column) value(s string) (quad.Value, error) {
+	switch {
+	case c.IRI:
+		if strings.HasPrefix(s, "_:") {
+			return quad.BNode(s[2:]), nil
+		}
+		return quad.IRI(s).Full(), nil
+	case c.Lang != "":
+		return quad.LangString{Value: quad.String(s), Lang: c.Lang}, nil
+	case c.Datatype != "":
+		v := quad.TypedString{Value: quad.String(s), Type: quad.IRI(c.Datatype).Full()}
+		// only check that the value can be parsed
+		if _, err := v.ParseValue(); err != nil {
+			return nil, fmt.Errorf("column %q: %v", c.Name, err)
+		}
+		return v, nil
+	}
+	return quad.String(s), nil
+}
+
+// Quads converts a single row to quads. Row is a map from column names to their values.
+// No quads are returned if the subject of the row is empty.
+func (m *Mapping) Quads(row map[string]string) ([]quad.Quad, error) {
+	s := m.subject(row)
+	if s == nil {
+		return nil, nil
+	}
+	var label quad.Value
+	if m.Label != "" {
+		label = quad.IRI(m.Label).Full()
+	}
+	quads := make([]quad.Quad, 0, len(m.Columns))
+	for i := range m.Columns {
+		c := &m.Columns[i]
+		str := row[c.Name]
+		if str == "" {
+			continue
+		}
+		v, err := c.value(str)
+		if err != nil {
+			return nil, err
+		}
+		quads = append(quads, quad.Quad{
+			Subject:   s,
+			Predicate: quad.IRI(c.Predicate).Full(),
+			Object:    v,
+			Label:     label,
+		})
+	}
+	return quads, nil
+}
+
+// RowError is returned when a row of the table cannot be converted to quads.
+// Reading can continue after this error.
+type RowError struct {
+	Line int // line on which the row starts; the header is on line 1
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("csv: line %d: %v", e.Line, e.Err)
+}
+
+var _ quad.ReadCloser = (*Reader)(nil)
+
+// Reader converts rows of a table to quads. The first row of the table must be
+// a header with column names.
+type Reader struct {
+	m      Mapping
+	r      *csv.Reader
+	header []string
+	line   int // number of rows read so far
+	buf    []quad.Quad
+	err    error
+}
+
+// NewReader creates a reader that converts rows of CSV table to quads.
+func NewReader(r io.Reader, m Mapping) *Reader {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	return &Reader{m: m, r: cr}
+}
+
+// NewTSVReader is the same as NewReader, but reads a tab-separated table.
+func NewTSVReader(r io.Reader, m Mapping) *Reader {
+	qr := NewReader(r, m)
+	qr.r.Comma = '\t'
+	qr.r.LazyQuotes = true
+	return qr
+}
+
+func (r *Reader) readHeader() error {
+	if err := r.m.Validate(); err != nil {
+		return err
+	}
+	rec, err := r.r.Read()
+	if err == io.EOF {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("csv: cannot read header: %v", err)
+	}
+	r.line++
+	r.header = append([]string{}, rec...)
+	known := make(map[string]struct{}, len(r.header))
+	for _, name := range r.header {
+		known[name] = struct{}{}
+	}
+	for _, name := range r.m.columnNames() {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("csv: column %q is not in the header", name)
+		}
+	}
+	return nil
+}
+
+func (r *Reader) readRow() error {
+	rec, err := r.r.Read()
+	if err == io.EOF {
+		return err
+	}
+	r.line++
+	if perr, ok := err.(*csv.ParseError); ok {
+		if perr.Err != csv.ErrFieldCount {
+			// cannot continue after syntax errors
+			return perr
+		}
+		return &RowError{Line: perr.Line, Err: perr.Err}
+	} else if err != nil {
+		return err
+	}
+	row := make(map[string]string, len(r.header))
+	for i, name := range r.header {
+		row[name] = rec[i]
+	}
+	quads, err := r.m.Quads(row)
+	if err != nil {
+		return &RowError{Line: r.rowLine(), Err: err}
+	}
+	r.buf = quads
+	return nil
+}
+
+// ReadQuad returns the next quad from the table. Rows with an empty subject are skipped.
+//
+// It returns *RowError if a row cannot be converted. Reading can continue after this error.
+func (r *Reader) ReadQuad() (quad.Quad, error) {
+	if r.err != nil {
+		return quad.Quad{}, r.err
+	}
+	if r.header == nil {
+		if err := r.readHeader(); err != nil {
+			r.err = err
+			return quad.Quad{}, err
+		}
+	}
+	for len(r.buf) == 0 {
+		if err := r.readRow(); err != nil {
+			if _, ok := err.(*RowError); !ok {
+				r.err = err
+			}
+			return quad.Quad{}, err
+		}
+	}
+	q := r.buf[0]
+	r.buf = r.buf[1:]
+	return q, nil
+}
+
+func (r *Reader) Close() error { return nil }
+
+// SkipRowErrors wraps a quad reader and skips rows that return *RowError.
+// Each skipped row is reported to a given function, if it is set.
+func SkipRowErrors(r quad.Reader, fnc func(err *RowError)) quad.Reader {
+	return &skipReader{r: r, fnc: fnc}
+}
+
+type skipReader struct {
+	r   quad.Reader
+	fnc func(err *RowError)
+}
+
+func (r *skipReader) ReadQuad() (quad.Quad, error) {
+	for {
+		q, err := r.r.ReadQuad()
+		if e, ok := err.(*RowError); ok {
+			if r.fnc != nil {
+				r.fnc(e)
+			}
+			continue
+		}
+		return q, err
+	}
+}
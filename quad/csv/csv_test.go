@@ -0,0 +1,126 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const testMapping = `{
+	"subject": "person:{{id}}",
+	"label": "people",
+	"columns": [
+		{"column": "name", "predicate": "name", "lang": "en"},
+		{"column": "age", "predicate": "age", "datatype": "http://www.w3.org/2001/XMLSchema#integer"},
+		{"column": "friend", "predicate": "knows", "iri": true}
+	]
+}`
+
+func readAll(t *testing.T, r quad.Reader) ([]quad.Quad, error) {
+	var out []quad.Quad
+	for {
+		q, err := r.ReadQuad()
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return out, err
+		}
+		out = append(out, q)
+	}
+}
+
+func TestReader(t *testing.T) {
+	m, err := ReadMapping(strings.NewReader(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const data = "id,name,age,friend\n" +
+		"1,Alice,21,person:2\n" +
+		",Nobody,1,\n" +
+		"2,Bob,,\n"
+	got, err := readAll(t, NewReader(strings.NewReader(data), *m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	label := quad.IRI("people")
+	expect := []quad.Quad{
+		{Subject: quad.IRI("person:1"), Predicate: quad.IRI("name"), Object: quad.LangString{Value: "Alice", Lang: "en"}, Label: label},
+		{Subject: quad.IRI("person:1"), Predicate: quad.IRI("age"), Object: quad.TypedString{Value: "21", Type: "http://www.w3.org/2001/XMLSchema#integer"}, Label: label},
+		{Subject: quad.IRI("person:1"), Predicate: quad.IRI("knows"), Object: quad.IRI("person:2"), Label: label},
+		{Subject: quad.IRI("person:2"), Predicate: quad.IRI("name"), Object: quad.LangString{Value: "Bob", Lang: "en"}, Label: label},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected quads:\n%v\nvs\n%v", got, expect)
+	}
+}
+
+func TestReaderTSV(t *testing.T) {
+	m := Mapping{
+		Subject: "id",
+		Columns: []Column{{Name: "name", Predicate: "name"}},
+	}
+	got, err := readAll(t, NewTSVReader(strings.NewReader("id\tname\n_:a\tAlice \"A\"\n"), m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []quad.Quad{
+		{Subject: quad.BNode("a"), Predicate: quad.IRI("name"), Object: quad.String(`Alice "A"`)},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected quads:\n%v\nvs\n%v", got, expect)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	m, err := ReadMapping(strings.NewReader(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const data = "id,name,age,friend\n" +
+		"1,Alice,old,\n" +
+		"2,Bob\n" +
+		"3,Charlie,,\n"
+
+	r := NewReader(strings.NewReader(data), *m)
+	_, err = readAll(t, r)
+	if e, ok := err.(*RowError); !ok || e.Line != 2 {
+		t.Fatalf("expected an error on the second line, got: %v", err)
+	}
+
+	var lines []int
+	r = NewReader(strings.NewReader(data), *m)
+	got, err := readAll(t, SkipRowErrors(r, func(err *RowError) {
+		lines = append(lines, err.Line)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 3}) {
+		t.Errorf("unexpected error lines: %v", lines)
+	}
+	if len(got) != 1 || got[0].Subject != quad.IRI("person:3") {
+		t.Errorf("unexpected quads: %v", got)
+	}
+
+	_, err = readAll(t, NewReader(strings.NewReader("id,name\n"), *m))
+	if err == nil || !strings.Contains(err.Error(), `"age"`) {
+		t.Errorf("expected an error for a missing column, got: %v", err)
+	}
+}
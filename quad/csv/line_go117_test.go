@@ -0,0 +1,52 @@
+//go:build go1.17
+// +build go1.17
+
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReaderErrorLines(t *testing.T) {
+	m, err := ReadMapping(strings.NewReader(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// quoted value of the first row spans two lines
+	const data = "id,name,age,friend\n" +
+		"0,\"Zed\nZimmerman\",,\n" +
+		"1,Alice,old,\n" +
+		"2,Bob\n" +
+		"3,Charlie,,\n"
+
+	var lines []int
+	r := NewReader(strings.NewReader(data), *m)
+	got, err := readAll(t, SkipRowErrors(r, func(err *RowError) {
+		lines = append(lines, err.Line)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lines, []int{4, 5}) {
+		t.Errorf("unexpected error lines: %v", lines)
+	}
+	if len(got) != 2 {
+		t.Errorf("unexpected quads: %v", got)
+	}
+}
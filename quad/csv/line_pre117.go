@@ -0,0 +1,24 @@
+//go:build !go1.17
+// +build !go1.17
+
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+// rowLine returns the line on which the last row starts. Positions of records are
+// not available in this Go version, thus it assumes that each row is on a single line.
+func (r *Reader) rowLine() int {
+	return r.line
+}
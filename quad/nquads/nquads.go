@@ -28,6 +28,7 @@ package nquads
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -49,41 +50,70 @@ var DecodeRaw = false
 func init() {
 	quad.RegisterFormat(quad.Format{
 		Name: "nquads",
-		Ext:  []string{".nq", ".nt"},
-		Mime: []string{"application/n-quads", "application/n-triples"},
+		Ext:  []string{".nq"},
+		Mime: []string{"application/n-quads"},
 		Reader: func(r io.Reader) quad.ReadCloser {
 			return NewReader(r, DecodeRaw)
 		},
-		Writer: func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
-		MarshalValue: func(v quad.Value) ([]byte, error) {
-			if v == nil {
-				return nil, nil
-			}
-			return []byte(v.String()), nil
-		},
-		UnmarshalValue: func(b []byte) (quad.Value, error) {
-			// TODO: proper parser for a single value
-			r := NewReader(bytes.NewReader(bytes.Join([][]byte{
-				[]byte("<s> <p> "),
-				b,
-				[]byte(" <l> .\n"),
-			}, nil)), false)
-			q, err := r.ReadQuad()
-			if err == io.EOF {
-				return nil, quad.ErrInvalid
-			} else if err != nil {
-				return nil, err
-			}
-			return q.Object, nil
+		Writer:         func(w io.Writer) quad.WriteCloser { return NewWriter(w) },
+		MarshalValue:   marshalValue,
+		UnmarshalValue: unmarshalValue,
+	})
+	quad.RegisterFormat(quad.Format{
+		Name: "ntriples",
+		Ext:  []string{".nt"},
+		Mime: []string{"application/n-triples"},
+		Reader: func(r io.Reader) quad.ReadCloser {
+			// N-Triples is a subset of N-Quads
+			return NewReader(r, DecodeRaw)
 		},
+		Writer:         func(w io.Writer) quad.WriteCloser { return NewTriplesWriter(w) },
+		MarshalValue:   marshalValue,
+		UnmarshalValue: unmarshalValue,
 	})
 }
 
+func marshalValue(v quad.Value) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return []byte(v.String()), nil
+}
+
+func unmarshalValue(b []byte) (quad.Value, error) {
+	// TODO: proper parser for a single value
+	r := NewReader(bytes.NewReader(bytes.Join([][]byte{
+		[]byte("<s> <p> "),
+		b,
+		[]byte(" <l> .\n"),
+	}, nil)), false)
+	q, err := r.ReadQuad()
+	if err == io.EOF {
+		return nil, quad.ErrInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	return q.Object, nil
+}
+
+// ParseError is returned when a line of the document cannot be parsed.
+// Reading can continue after this error.
+type ParseError struct {
+	Line int    // number of the line, starting from 1
+	Text string // content of the line
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: failed to parse %q: %v", e.Line, e.Text, e.Err)
+}
+
 // Reader implements N-Quad document parsing according to the RDF
 // 1.1 N-Quads specification.
 type Reader struct {
 	r    *bufio.Reader
 	line []byte
+	n    int // number of lines read
 	raw  bool
 }
 
@@ -105,6 +135,7 @@ func (dec *Reader) ReadQuad() (quad.Quad, error) {
 			}
 			dec.line = append(dec.line, l...)
 			if !pre {
+				dec.n++
 				break
 			}
 		}
@@ -123,13 +154,17 @@ func (dec *Reader) ReadQuad() (quad.Quad, error) {
 		q, err = Parse(string(line))
 	}
 	if err != nil {
-		return quad.Quad{}, fmt.Errorf("failed to parse %q: %v", dec.line, err)
+		return quad.Quad{}, &ParseError{Line: dec.n, Text: string(dec.line), Err: err}
 	}
 	if !q.IsValid() {
 		return dec.ReadQuad()
 	}
 	return q, nil
 }
+
+// Line returns the number of the last line that was read, starting from 1.
+func (dec *Reader) Line() int { return dec.n }
+
 func (dec *Reader) Close() error { return nil }
 
 func unEscape(r []rune, spec int, isQuoted, isEscaped bool) quad.Value {
@@ -316,3 +351,27 @@ func (enc *Writer) WriteQuad(q quad.Quad) error {
 	return enc.err
 }
 func (enc *Writer) Close() error { return enc.err }
+
+// ErrLabeledQuad is returned by the N-Triples writer for quads with a label.
+var ErrLabeledQuad = errors.New("nquads: quads with labels cannot be written as N-Triples")
+
+// NewTriplesWriter returns an N-Triples encoder that writes its output to the
+// provided io.Writer. Quads with labels are rejected with ErrLabeledQuad.
+// See quad.DropLabels to write them as triples.
+func NewTriplesWriter(w io.Writer) *TriplesWriter {
+	return &TriplesWriter{w: NewWriter(w)}
+}
+
+// TriplesWriter implements N-Triples document generator according to the RDF
+// 1.1 N-Triples specification.
+type TriplesWriter struct {
+	w *Writer
+}
+
+func (enc *TriplesWriter) WriteQuad(q quad.Quad) error {
+	if q.Label != nil {
+		return ErrLabeledQuad
+	}
+	return enc.w.WriteQuad(q)
+}
+func (enc *TriplesWriter) Close() error { return enc.w.Close() }
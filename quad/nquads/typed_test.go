@@ -16,6 +16,7 @@ package nquads
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -696,6 +697,33 @@ func TestDecoder(t *testing.T) {
 	}
 }
 
+func TestDecoderParseError(t *testing.T) {
+	const doc = "<a> <b> <c> .\n# comment\n\n<a> <b> .\n<a> <b> <d> .\n<a> \"x\n"
+	dec := NewReader(strings.NewReader(doc), false)
+	var (
+		n     int
+		lines []int
+	)
+	for {
+		_, err := dec.ReadQuad()
+		if err == io.EOF {
+			break
+		} else if perr, ok := err.(*ParseError); ok {
+			lines = append(lines, perr.Line)
+			continue
+		} else if err != nil {
+			t.Fatalf("Failed to read document: %v", err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("Unexpected number of quads read, got:%d expect:2", n)
+	}
+	if !reflect.DeepEqual(lines, []int{4, 6}) {
+		t.Errorf("Unexpected error lines, got:%v expect:[4 6]", lines)
+	}
+}
+
 func TestRDFWorkingGroupSuit(t *testing.T) {
 	// Tests that are not passable by cquads parsing from the RDF
 	// Working Group Suite:
@@ -868,3 +896,22 @@ func TestValueEncoding(t *testing.T) {
 		require.Equal(t, v, v2)
 	}
 }
+
+func TestTriplesWriter(t *testing.T) {
+	quads := []quad.Quad{
+		quad.MakeIRI("a", "b", "c", ""),
+		quad.MakeIRI("a", "b", "d", "g"),
+	}
+	buf := bytes.NewBuffer(nil)
+	w := quad.FormatByName("ntriples").Writer(buf)
+	_, err := quad.Copy(w, quad.NewReader(quads))
+	require.Equal(t, ErrLabeledQuad, err)
+	require.Equal(t, "<a> <b> <c> .\n", buf.String())
+
+	buf.Reset()
+	w = NewTriplesWriter(buf)
+	_, err = quad.Copy(w, quad.DropLabels(quad.NewReader(quads)))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, "<a> <b> <c> .\n<a> <b> <d> .\n", buf.String())
+}
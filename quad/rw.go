@@ -80,6 +80,23 @@ func NewReader(quads []Quad) *Quads {
 	return &Quads{s: quads}
 }
 
+// DropLabels wraps a quad reader to remove labels from all quads. It allows to write
+// quads to formats that only support triples. Quads that only differ by the label
+// become duplicate triples.
+func DropLabels(r Reader) Reader {
+	return dropLabelsReader{r: r}
+}
+
+type dropLabelsReader struct {
+	r Reader
+}
+
+func (r dropLabelsReader) ReadQuad() (Quad, error) {
+	q, err := r.r.ReadQuad()
+	q.Label = nil
+	return q, err
+}
+
 // Copy will copy all quads from src to dst. It returns copied quads count and an error, if it failed.
 //
 // Copy will try to cast dst to BatchWriter and will switch to CopyBatch implementation in case of success.
@@ -0,0 +1,327 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ValidationCode is a machine-readable reason why a quad is not valid.
+type ValidationCode string
+
+const (
+	// CodeEmptySubject is returned for quads with no subject.
+	CodeEmptySubject = ValidationCode("empty_subject")
+	// CodeEmptyPredicate is returned for quads with no predicate.
+	CodeEmptyPredicate = ValidationCode("empty_predicate")
+	// CodeEmptyObject is returned for quads with no object.
+	CodeEmptyObject = ValidationCode("empty_object")
+	// CodeEmptyLabel is returned for quads with a label that is set, but contains only whitespace.
+	CodeEmptyLabel = ValidationCode("empty_label")
+	// CodeLiteralPredicate is returned for quads that have a literal in the predicate position.
+	CodeLiteralPredicate = ValidationCode("literal_predicate")
+	// CodeControlChar is returned for values that contain control characters.
+	// Literals are allowed to contain tabs and line breaks.
+	CodeControlChar = ValidationCode("control_character")
+	// CodeWhitespace is returned for node identifiers with leading or trailing whitespace.
+	CodeWhitespace = ValidationCode("whitespace")
+	// CodeNotNFC is returned for literals that are not in Unicode Normalization Form C.
+	// It is only checked when NFC normalization is enabled.
+	CodeNotNFC = ValidationCode("not_nfc")
+)
+
+// ValidationError is returned when a quad does not pass the validation.
+type ValidationError struct {
+	Code      ValidationCode
+	Direction Direction
+	Value     Value
+}
+
+func (e *ValidationError) Error() string {
+	if e.Value == nil {
+		return fmt.Sprintf("invalid %v: %s", e.Direction, e.Code)
+	}
+	return fmt.Sprintf("invalid %v %v: %s", e.Direction, e.Value, e.Code)
+}
+
+// isIdentifier checks if a value is used to identify a node, rather than to store a literal.
+// Plain strings are treated as identifiers in all positions except the object.
+func isIdentifier(d Direction, v Value) bool {
+	switch v.(type) {
+	case IRI, BNode:
+		return true
+	case String:
+		return d != Object
+	}
+	return false
+}
+
+// literalString returns a string part of the literal value.
+func literalString(v Value) (String, bool) {
+	switch v := v.(type) {
+	case String:
+		return v, true
+	case TypedString:
+		return v.Value, true
+	case LangString:
+		return v.Value, true
+	}
+	return "", false
+}
+
+func isControl(r rune, literal bool) bool {
+	if literal && (r == '\t' || r == '\n' || r == '\r') {
+		return false
+	}
+	return unicode.IsControl(r)
+}
+
+func hasControl(s string, literal bool) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return isControl(r, literal) }) >= 0
+}
+
+// rawString returns an unescaped string of the node identifier or a literal.
+func rawString(v Value) string {
+	switch v := v.(type) {
+	case IRI:
+		return string(v)
+	case BNode:
+		return string(v)
+	}
+	if s, ok := literalString(v); ok {
+		return string(s)
+	}
+	return StringOf(v)
+}
+
+func isEmpty(v Value) bool {
+	return v == nil || rawString(v) == ""
+}
+
+// validateValue checks a single value of the quad.
+func validateValue(d Direction, v Value) *ValidationError {
+	fail := func(code ValidationCode) *ValidationError {
+		return &ValidationError{Code: code, Direction: d, Value: v}
+	}
+	if isIdentifier(d, v) {
+		s := rawString(v)
+		if strings.TrimSpace(s) != s {
+			if d == Label && strings.TrimSpace(s) == "" {
+				return fail(CodeEmptyLabel)
+			}
+			return fail(CodeWhitespace)
+		}
+		if hasControl(s, false) {
+			return fail(CodeControlChar)
+		}
+		if _, ok := v.(String); ok && d == Predicate && strings.IndexFunc(s, unicode.IsSpace) >= 0 {
+			return fail(CodeLiteralPredicate)
+		}
+		return nil
+	} else if d == Predicate {
+		return fail(CodeLiteralPredicate)
+	}
+	if s, ok := literalString(v); ok && hasControl(string(s), true) {
+		return fail(CodeControlChar)
+	}
+	return nil
+}
+
+// Validate checks that the quad has a subject, a predicate and an object, that the
+// predicate is an IRI-like value (an IRI, a blank node or a plain string with no spaces),
+// that values do not contain control characters, and that node identifiers have no
+// leading or trailing whitespace.
+//
+// Returned error is always a *ValidationError.
+func (q Quad) Validate() error {
+	switch {
+	case isEmpty(q.Subject):
+		return &ValidationError{Code: CodeEmptySubject, Direction: Subject}
+	case isEmpty(q.Predicate):
+		return &ValidationError{Code: CodeEmptyPredicate, Direction: Predicate}
+	case isEmpty(q.Object):
+		return &ValidationError{Code: CodeEmptyObject, Direction: Object}
+	}
+	if q.Label != nil && rawString(q.Label) == "" {
+		return &ValidationError{Code: CodeEmptyLabel, Direction: Label, Value: q.Label}
+	}
+	for _, d := range Directions {
+		if v := q.Get(d); v != nil {
+			if err := validateValue(d, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CanonicalOptions are optional normalizations applied by Canonicalize.
+type CanonicalOptions struct {
+	// NFC enables Unicode NFC normalization of literals.
+	NFC bool
+}
+
+func stripControl(s string, literal bool) string {
+	if !hasControl(s, literal) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if isControl(r, literal) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func canonicalString(s String, opt *CanonicalOptions) String {
+	out := stripControl(string(s), true)
+	if opt != nil && opt.NFC {
+		out = norm.NFC.String(out)
+	}
+	return String(out)
+}
+
+func canonicalValue(d Direction, v Value, opt *CanonicalOptions) Value {
+	if isIdentifier(d, v) {
+		s := strings.TrimSpace(stripControl(rawString(v), false))
+		if d == Label && s == "" {
+			return nil
+		}
+		switch v.(type) {
+		case IRI:
+			return IRI(s)
+		case BNode:
+			return BNode(s)
+		}
+		return String(s)
+	}
+	switch v := v.(type) {
+	case String:
+		return canonicalString(v, opt)
+	case TypedString:
+		v.Value = canonicalString(v.Value, opt)
+		return v
+	case LangString:
+		v.Value = canonicalString(v.Value, opt)
+		return v
+	}
+	return v
+}
+
+// Canonicalize returns a normalized copy of the quad. It trims whitespace around node
+// identifiers, removes control characters, drops labels that contain only whitespace,
+// and optionally normalizes literals to Unicode NFC.
+//
+// It does not fix all problems reported by Validate. For example, quads with a missing
+// subject or with a literal in the predicate position remain invalid.
+func (q Quad) Canonicalize(opt *CanonicalOptions) Quad {
+	for _, d := range Directions {
+		if v := q.Get(d); v != nil {
+			q.Set(d, canonicalValue(d, v, opt))
+		}
+	}
+	return q
+}
+
+// ValidationMode defines how quads are checked before they are written.
+type ValidationMode int
+
+const (
+	// ValidateNone accepts all quads as-is. It is the default, so quads are
+	// never modified unless validation is requested explicitly.
+	ValidateNone = ValidationMode(iota)
+	// ValidateLenient canonicalizes quads before validating them.
+	ValidateLenient
+	// ValidateStrict rejects quads that are not valid or not in a canonical form.
+	ValidateStrict
+)
+
+var validationModeNames = []string{
+	ValidateNone:    "none",
+	ValidateLenient: "lenient",
+	ValidateStrict:  "strict",
+}
+
+func (m ValidationMode) String() string {
+	if int(m) < 0 || int(m) >= len(validationModeNames) {
+		return fmt.Sprintf("ValidationMode(%d)", int(m))
+	}
+	return validationModeNames[m]
+}
+
+// ValidationModeByName returns a validation mode by its name ("lenient", "strict" or "none").
+func ValidationModeByName(name string) (ValidationMode, error) {
+	for i, s := range validationModeNames {
+		if s == name {
+			return ValidationMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown validation mode: %q", name)
+}
+
+// Validation is a set of rules that all ingestion paths apply to quads.
+type Validation struct {
+	Mode ValidationMode
+	CanonicalOptions
+}
+
+// Apply checks the quad according to the validation mode and returns the quad that should
+// be written. See Quad.Validate and Quad.Canonicalize.
+func (v Validation) Apply(q Quad) (Quad, error) {
+	switch v.Mode {
+	case ValidateNone:
+		return q, nil
+	case ValidateLenient:
+		q = q.Canonicalize(&v.CanonicalOptions)
+		return q, q.Validate()
+	}
+	if err := q.Validate(); err != nil {
+		return q, err
+	}
+	if v.NFC {
+		for _, d := range Directions {
+			if s, ok := literalString(q.Get(d)); ok && !norm.NFC.IsNormalString(string(s)) {
+				return q, &ValidationError{Code: CodeNotNFC, Direction: d, Value: q.Get(d)}
+			}
+		}
+	}
+	return q, nil
+}
+
+// ValidateQuads wraps a quad reader to apply validation rules to each quad.
+// Reader stops with a *ValidationError on the first invalid quad.
+func ValidateQuads(r Reader, v Validation) Reader {
+	if v.Mode == ValidateNone {
+		return r
+	}
+	return &validateReader{r: r, v: v}
+}
+
+type validateReader struct {
+	r Reader
+	v Validation
+}
+
+func (r *validateReader) ReadQuad() (Quad, error) {
+	q, err := r.r.ReadQuad()
+	if err != nil {
+		return q, err
+	}
+	return r.v.Apply(q)
+}
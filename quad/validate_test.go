@@ -0,0 +1,169 @@
+package quad
+
+import (
+	"testing"
+)
+
+var validateTests = []struct {
+	name string
+	q    Quad
+	code ValidationCode // expected error in strict mode
+	fix  *Quad          // expected quad in lenient mode, or nil if it's still invalid
+}{
+	{
+		name: "valid",
+		q:    Quad{IRI("a"), IRI("name"), String("A\tB\nC"), IRI("g")},
+	},
+	{
+		name: "legacy strings",
+		q:    Quad{String("alice"), String("follows"), String("bob"), nil},
+	},
+	{
+		name: "empty subject",
+		q:    Quad{nil, IRI("name"), String("A"), nil},
+		code: CodeEmptySubject,
+	},
+	{
+		name: "empty subject iri",
+		q:    Quad{IRI(" "), IRI("name"), String("A"), nil},
+		code: CodeWhitespace,
+	},
+	{
+		name: "empty predicate",
+		q:    Quad{IRI("a"), String(""), String("A"), nil},
+		code: CodeEmptyPredicate,
+	},
+	{
+		name: "empty object",
+		q:    Quad{IRI("a"), IRI("name"), nil, nil},
+		code: CodeEmptyObject,
+	},
+	{
+		name: "literal predicate",
+		q:    Quad{IRI("a"), Int(1), String("A"), nil},
+		code: CodeLiteralPredicate,
+	},
+	{
+		name: "typed predicate",
+		q:    Quad{IRI("a"), TypedString{Value: "name", Type: "xsd:string"}, String("A"), nil},
+		code: CodeLiteralPredicate,
+	},
+	{
+		name: "string predicate with spaces",
+		q:    Quad{IRI("a"), String("full name"), String("A"), nil},
+		code: CodeLiteralPredicate,
+	},
+	{
+		name: "control characters in literal",
+		q:    Quad{IRI("a"), IRI("name"), String("A\x00B\x1b"), nil},
+		code: CodeControlChar,
+		fix:  &Quad{IRI("a"), IRI("name"), String("AB"), nil},
+	},
+	{
+		name: "control characters in iri",
+		q:    Quad{IRI("a\nb"), IRI("name"), LangString{Value: "A\x07", Lang: "en"}, nil},
+		code: CodeControlChar,
+		fix:  &Quad{IRI("ab"), IRI("name"), LangString{Value: "A", Lang: "en"}, nil},
+	},
+	{
+		name: "stray whitespace",
+		q:    Quad{BNode(" b0"), IRI("name\t"), String(" A "), String(" g ")},
+		code: CodeWhitespace,
+		fix:  &Quad{BNode("b0"), IRI("name"), String(" A "), String("g")},
+	},
+	{
+		name: "whitespace label",
+		q:    Quad{IRI("a"), IRI("name"), String("A"), String(" \t")},
+		code: CodeEmptyLabel,
+		fix:  &Quad{IRI("a"), IRI("name"), String("A"), nil},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range validateTests {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.q.Validate()
+			if c.code == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if verr, ok := err.(*ValidationError); !ok || verr.Code != c.code {
+				t.Fatalf("unexpected error: %v, expected %q", err, c.code)
+			}
+			_, err = Validation{Mode: ValidateStrict}.Apply(c.q)
+			if (err != nil) != (c.code != "") {
+				t.Errorf("unexpected strict error: %v", err)
+			}
+			if _, err = (Validation{Mode: ValidateNone}).Apply(c.q); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			q, err := Validation{Mode: ValidateLenient}.Apply(c.q)
+			expect := c.fix
+			if c.code == "" {
+				expect = &c.q
+			}
+			if expect == nil {
+				if err == nil {
+					t.Errorf("expected an error, got: %v", q)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected lenient error: %v", err)
+			} else if q != *expect {
+				t.Errorf("unexpected canonical quad: %#v vs %#v", q, *expect)
+			}
+		})
+	}
+}
+
+func TestValidateNFC(t *testing.T) {
+	const (
+		decomposed = "Café"
+		composed   = "Café"
+	)
+	q := Quad{IRI("a"), IRI("name"), LangString{Value: decomposed, Lang: "fr"}, nil}
+
+	if _, err := (Validation{Mode: ValidateStrict}).Apply(q); err != nil {
+		t.Errorf("unexpected error without nfc: %v", err)
+	}
+	_, err := Validation{Mode: ValidateStrict, CanonicalOptions: CanonicalOptions{NFC: true}}.Apply(q)
+	if verr, ok := err.(*ValidationError); !ok || verr.Code != CodeNotNFC {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	got, err := Validation{Mode: ValidateLenient, CanonicalOptions: CanonicalOptions{NFC: true}}.Apply(q)
+	if err != nil {
+		t.Fatal(err)
+	} else if s := got.Object.(LangString).Value; s != composed {
+		t.Errorf("literal was not normalized: %q", s)
+	}
+	if got, _ = (Validation{}).Apply(q); got != q {
+		t.Errorf("literal should be normalized only with an option: %v", got)
+	}
+}
+
+func TestValidationModeByName(t *testing.T) {
+	for _, m := range []ValidationMode{ValidateLenient, ValidateStrict, ValidateNone} {
+		if got, err := ValidationModeByName(m.String()); err != nil || got != m {
+			t.Errorf("unexpected mode for %q: %v, %v", m, got, err)
+		}
+	}
+	if _, err := ValidationModeByName("unknown"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestValidateQuads(t *testing.T) {
+	quads := []Quad{
+		{IRI(" a "), IRI("name"), String("A"), nil},
+		{nil, IRI("name"), String("B"), nil},
+	}
+	r := ValidateQuads(NewReader(quads), Validation{Mode: ValidateLenient})
+	q, err := r.ReadQuad()
+	if err != nil || q.Subject != IRI("a") {
+		t.Fatalf("unexpected result: %v, %v", q, err)
+	}
+	if _, err = r.ReadQuad(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
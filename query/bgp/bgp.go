@@ -0,0 +1,428 @@
+// Package bgp implements matching of basic graph patterns: sets of quad templates
+// with shared variables, similar to the WHERE clause of SPARQL.
+package bgp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var (
+	// ErrNoPatterns is returned when compiling an empty list of patterns.
+	ErrNoPatterns = errors.New("bgp: no patterns")
+	// ErrNoVariables is returned for patterns that have no variables.
+	ErrNoVariables = errors.New("bgp: pattern has no variables")
+	// ErrCartesianProduct is returned when patterns form groups that share no variables.
+	// Results of such queries are cartesian products of results of each group, which
+	// are not supported.
+	ErrCartesianProduct = errors.New("bgp: patterns share no variables (cartesian products are not supported)")
+)
+
+// Term is either a variable or a constant value of a pattern.
+type Term struct {
+	Var   string     // name of the variable, without "?"
+	Value quad.Value // constant value, if Var is not set
+}
+
+// Var returns a variable term.
+func Var(name string) Term {
+	return Term{Var: name}
+}
+
+// Value returns a constant term.
+func Value(v quad.Value) Term {
+	return Term{Value: v}
+}
+
+// IsVar checks if the term is a variable.
+func (t Term) IsVar() bool { return t.Var != "" }
+
+// IsZero checks if the term is not set. Only the label of a pattern can be unset.
+func (t Term) IsZero() bool { return t.Var == "" && t.Value == nil }
+
+// String returns the term in the form that is accepted by ParseTerm.
+func (t Term) String() string {
+	if t.IsVar() {
+		return "?" + t.Var
+	} else if t.Value == nil {
+		return ""
+	}
+	return quad.ToString(t.Value)
+}
+
+// ParseTerm parses a term. Strings starting with "?" are variables, and other strings
+// are converted to values the same way as in other query languages: "<iri>" is an IRI,
+// "_:id" is a blank node, and other strings are string literals.
+func ParseTerm(s string) Term {
+	if len(s) > 1 && s[0] == '?' {
+		return Var(s[1:])
+	}
+	return Value(quad.StringToValue(s))
+}
+
+func (t Term) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *Term) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = ParseTerm(s)
+	return nil
+}
+
+// Pattern is a quad template. Terms of all directions except the label must be set.
+// Unset label matches quads with any label.
+type Pattern struct {
+	Subject   Term `json:"s"`
+	Predicate Term `json:"p"`
+	Object    Term `json:"o"`
+	Label     Term `json:"l"`
+}
+
+// Get returns a term for a given direction.
+func (p Pattern) Get(d quad.Direction) Term {
+	switch d {
+	case quad.Subject:
+		return p.Subject
+	case quad.Predicate:
+		return p.Predicate
+	case quad.Object:
+		return p.Object
+	case quad.Label:
+		return p.Label
+	}
+	return Term{}
+}
+
+func (p Pattern) String() string {
+	var terms []string
+	for _, d := range quad.Directions {
+		if t := p.Get(d); !t.IsZero() {
+			terms = append(terms, t.String())
+		}
+	}
+	return "{" + strings.Join(terms, " ") + "}"
+}
+
+// vars returns variables of the pattern in the order of directions.
+func (p Pattern) vars() []string {
+	var out []string
+	for _, d := range quad.Directions {
+		if t := p.Get(d); t.IsVar() {
+			out = append(out, t.Var)
+		}
+	}
+	return out
+}
+
+// validate checks if the patterns can be matched, and returns a list of their
+// variables in the order of appearance.
+func validate(patterns []Pattern) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, ErrNoPatterns
+	}
+	var (
+		vars []string
+		seen = make(map[string]bool)
+	)
+	for _, p := range patterns {
+		for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object} {
+			if p.Get(d).IsZero() {
+				return nil, fmt.Errorf("bgp: %v of pattern %v is not set", d, p)
+			}
+		}
+		pv := p.vars()
+		if len(pv) == 0 {
+			return nil, fmt.Errorf("%v: %v", ErrNoVariables, p)
+		}
+		for _, v := range pv {
+			if strings.HasPrefix(v, aliasPrefix) {
+				return nil, fmt.Errorf("bgp: invalid variable name: %q", v)
+			}
+			if !seen[v] {
+				seen[v] = true
+				vars = append(vars, v)
+			}
+		}
+	}
+	// all patterns must be connected by variables; start from the first one and
+	// collect all patterns reachable through shared variables
+	reached := make(map[string]bool)
+	used := make([]bool, len(patterns))
+	queue := []int{0}
+	used[0] = true
+	for len(queue) != 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, v := range patterns[i].vars() {
+			reached[v] = true
+		}
+		for j, p := range patterns {
+			if used[j] {
+				continue
+			}
+			for _, v := range p.vars() {
+				if reached[v] {
+					used[j] = true
+					queue = append(queue, j)
+					break
+				}
+			}
+		}
+	}
+	for j, ok := range used {
+		if !ok {
+			return nil, fmt.Errorf("%v: %v and %v", ErrCartesianProduct, patterns[0], patterns[j])
+		}
+	}
+	return vars, nil
+}
+
+// aliasPrefix is a prefix of tags used for additional occurrences of variables
+// that close cycles in the patterns.
+const aliasPrefix = "$"
+
+// Query is a compiled basic graph pattern.
+type Query struct {
+	qs   graph.QuadStore
+	vars []string
+	it   graph.Iterator
+	// clone of the tree that is used to enumerate all paths of each root value
+	check graph.Iterator
+	// alias tags that must be equal to the variable
+	aliases map[string]string
+}
+
+// Compile compiles patterns to an iterator tree. Each variable becomes a tag of the tree.
+//
+// Patterns are joined as a tree rooted at one of the variables, where each pattern is
+// an intersection of HasA and LinksTo iterators. Patterns that connect already joined
+// variables (cycles) bind an additional tag that is checked to be equal to the variable.
+// The root is chosen by comparing estimated costs of optimized trees for all variables.
+func Compile(qs graph.QuadStore, patterns []Pattern) (*Query, error) {
+	vars, err := validate(patterns)
+	if err != nil {
+		return nil, err
+	}
+	var best *Query
+	var bestCost int64
+	for _, root := range vars {
+		q := &Query{qs: qs, vars: vars}
+		b := &builder{qs: qs, patterns: patterns, q: q,
+			used:    make([]bool, len(patterns)),
+			visited: make(map[string]bool),
+		}
+		q.it = b.node(root)
+		if it, ok := q.it.Optimize(); ok {
+			q.it = it
+		}
+		if it, ok := qs.OptimizeIterator(q.it); ok {
+			q.it = it
+		}
+		st := q.it.Stats()
+		cost := st.NextCost * st.Size
+		if best == nil || cost < bestCost {
+			if best != nil {
+				best.it.Close()
+			}
+			best, bestCost = q, cost
+		} else {
+			q.it.Close()
+		}
+	}
+	best.check = best.it.Clone()
+	return best, nil
+}
+
+// builder builds an iterator tree for patterns, starting from a given variable.
+type builder struct {
+	qs       graph.QuadStore
+	patterns []Pattern
+	q        *Query
+	used     []bool
+	visited  map[string]bool
+}
+
+// alias returns an iterator of all nodes tagged with a new alias of the variable.
+func (b *builder) alias(v string) graph.Iterator {
+	if b.q.aliases == nil {
+		b.q.aliases = make(map[string]string)
+	}
+	name := fmt.Sprintf("%s%s.%d", aliasPrefix, v, len(b.q.aliases))
+	b.q.aliases[name] = v
+	it := b.qs.NodesAllIterator()
+	it.Tagger().Add(name)
+	return it
+}
+
+// node returns an iterator of values of the variable that match all patterns that
+// were not used yet.
+func (b *builder) node(v string) graph.Iterator {
+	b.visited[v] = true
+	var its []graph.Iterator
+	for i, p := range b.patterns {
+		if b.used[i] {
+			continue
+		}
+		for _, d := range quad.Directions {
+			if t := p.Get(d); t.IsVar() && t.Var == v {
+				b.used[i] = true
+				its = append(its, b.pattern(p, d))
+				break
+			}
+		}
+	}
+	if len(its) == 0 {
+		// leaf of the tree; values are only constrained by the parent pattern
+		it := b.qs.NodesAllIterator()
+		it.Tagger().Add(v)
+		return it
+	}
+	and := iterator.NewAnd(b.qs, its...)
+	and.Tagger().Add(v)
+	return and
+}
+
+// pattern returns an iterator of values in a given direction of quads matching the pattern.
+func (b *builder) pattern(p Pattern, dir quad.Direction) graph.Iterator {
+	var its []graph.Iterator
+	for _, d := range quad.Directions {
+		t := p.Get(d)
+		var sub graph.Iterator
+		switch {
+		case d == dir || t.IsZero():
+			continue
+		case !t.IsVar():
+			if v := b.qs.ValueOf(t.Value); v != nil {
+				sub = iterator.NewFixed(v)
+			} else {
+				sub = iterator.NewNull()
+			}
+		case b.visited[t.Var]:
+			// variable is already bound by another branch of the tree, or by
+			// the other direction of the same pattern
+			sub = b.alias(t.Var)
+		default:
+			sub = b.node(t.Var)
+		}
+		its = append(its, iterator.NewLinksTo(b.qs, sub, d))
+	}
+	return iterator.NewHasA(b.qs, iterator.NewAnd(b.qs, its...), dir)
+}
+
+// Vars returns names of variables in the order of their appearance in the patterns.
+func (q *Query) Vars() []string {
+	return append([]string{}, q.vars...)
+}
+
+// Iterator returns an optimized iterator tree of the query. Values of variables are
+// set as tags. Results that bind aliases of variables (see Compile) to different
+// values must be ignored, and not all paths of results are reachable with NextPath,
+// thus Each should be used to get results instead.
+func (q *Query) Iterator() graph.Iterator {
+	return q.it
+}
+
+// bind converts tags of a result to variable bindings. It returns false if tags
+// of aliases are not equal to the tags of their variables, or if a variable is
+// bound to an empty value (for example, to a label of a quad without a label).
+func (q *Query) bind(tags map[string]graph.Value) (map[string]graph.Value, bool) {
+	for a, v := range q.aliases {
+		if graph.ToKey(tags[a]) != graph.ToKey(tags[v]) {
+			return nil, false
+		}
+	}
+	row := make(map[string]graph.Value, len(q.vars))
+	for _, v := range q.vars {
+		val := tags[v]
+		if val == nil || q.qs.NameOf(val) == nil {
+			return nil, false
+		}
+		row[v] = val
+	}
+	return row, true
+}
+
+// Each calls fn with variable bindings of each match of the patterns. Each matching
+// combination of quads produces a separate row, thus rows may repeat.
+// At most limit rows are returned, if the limit is positive.
+//
+// Paths of results of Next are not reliable for trees that follow links of a node
+// (see LinksTo), since paths of the node are exhausted on the first link. Thus,
+// distinct values of the root variable are found with Next, and all paths of each
+// value are enumerated by checking it with a clone of the tree.
+func (q *Query) Each(ctx context.Context, limit int, fn func(row map[string]graph.Value)) error {
+	q.it.Reset()
+	roots := iterator.NewUnique(q.it)
+	n := 0
+	emit := func() bool {
+		tags := make(map[string]graph.Value)
+		q.check.TagResults(tags)
+		if row, ok := q.bind(tags); ok {
+			fn(row)
+			n++
+		}
+		return limit <= 0 || n < limit
+	}
+	for roots.Next(ctx) {
+		if !q.check.Contains(ctx, roots.Result()) {
+			if err := q.check.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		if !emit() {
+			return nil
+		}
+		for q.check.NextPath(ctx) {
+			if !emit() {
+				return nil
+			}
+		}
+		if err := q.check.Err(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return roots.Err()
+}
+
+// Close releases resources of the query.
+func (q *Query) Close() error {
+	err := q.it.Close()
+	if err2 := q.check.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Match compiles and runs the patterns, and returns at most limit rows of variable
+// bindings, if the limit is positive. See Compile and Query.Each.
+func Match(ctx context.Context, qs graph.QuadStore, patterns []Pattern, limit int) ([]map[string]quad.Value, error) {
+	q, err := Compile(qs, patterns)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var out []map[string]quad.Value
+	err = q.Each(ctx, limit, func(row map[string]graph.Value) {
+		m := make(map[string]quad.Value, len(row))
+		for k, v := range row {
+			m[k] = qs.NameOf(v)
+		}
+		out = append(out, m)
+	})
+	return out, err
+}
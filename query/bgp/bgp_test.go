@@ -0,0 +1,365 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+func makeStore(t testing.TB, data []quad.Quad) graph.QuadStore {
+	qs := memstore.New()
+	w, err := writer.NewSingleReplication(qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddQuadSet(data); err != nil {
+		t.Fatal(err)
+	}
+	return qs
+}
+
+var testData = []quad.Quad{
+	quad.MakeIRI("alice", "follows", "bob", ""),
+	quad.MakeIRI("bob", "follows", "alice", ""),
+	quad.MakeIRI("bob", "follows", "charlie", ""),
+	quad.MakeIRI("charlie", "follows", "dani", ""),
+	quad.MakeIRI("dani", "follows", "dani", ""),
+	quad.Make(quad.IRI("bob"), quad.IRI("status"), "cool", nil),
+	quad.Make(quad.IRI("dani"), quad.IRI("status"), "cool", quad.IRI("smart_graph")),
+	quad.Make(quad.IRI("charlie"), quad.IRI("status"), "bored", nil),
+}
+
+// rowStrings converts rows to sorted strings, for comparison.
+func rowStrings(rows []map[string]quad.Value) []string {
+	out := make([]string, 0, len(rows))
+	for _, row := range rows {
+		var keys []string
+		for k := range row {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var parts []string
+		for _, k := range keys {
+			parts = append(parts, k+"="+quad.ToString(row[k]))
+		}
+		out = append(out, strings.Join(parts, " "))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func p(s, p, o string) Pattern {
+	return Pattern{Subject: ParseTerm(s), Predicate: ParseTerm(p), Object: ParseTerm(o)}
+}
+
+var matchTests = []struct {
+	name     string
+	patterns []Pattern
+	expect   []string
+}{
+	{
+		name: "join",
+		patterns: []Pattern{
+			p("?x", "<follows>", "?y"),
+			p("?y", "<status>", "cool"),
+		},
+		expect: []string{
+			"x=<alice> y=<bob>",
+			"x=<charlie> y=<dani>",
+			"x=<dani> y=<dani>",
+		},
+	},
+	{
+		name: "unbound predicate",
+		patterns: []Pattern{
+			p("<bob>", "?p", "?o"),
+		},
+		expect: []string{
+			"o=<alice> p=<follows>",
+			"o=<charlie> p=<follows>",
+			"o=cool p=<status>",
+		},
+	},
+	{
+		name: "cycle",
+		patterns: []Pattern{
+			p("?a", "<follows>", "?b"),
+			p("?b", "<follows>", "?a"),
+		},
+		expect: []string{
+			"a=<alice> b=<bob>",
+			"a=<bob> b=<alice>",
+			"a=<dani> b=<dani>",
+		},
+	},
+	{
+		name: "triangle",
+		patterns: []Pattern{
+			p("?a", "<follows>", "?b"),
+			p("?b", "<follows>", "?c"),
+			p("?c", "<follows>", "?a"),
+		},
+		expect: []string{
+			"a=<dani> b=<dani> c=<dani>",
+		},
+	},
+	{
+		name: "same variable",
+		patterns: []Pattern{
+			p("?x", "?p", "?x"),
+		},
+		expect: []string{
+			"p=<follows> x=<dani>",
+		},
+	},
+	{
+		name: "label",
+		patterns: []Pattern{
+			{Subject: Var("x"), Predicate: Value(quad.IRI("status")), Object: Var("s"), Label: Var("g")},
+		},
+		expect: []string{
+			"g=<smart_graph> s=cool x=<dani>",
+		},
+	},
+	{
+		name: "constant label",
+		patterns: []Pattern{
+			p("?x", "<follows>", "?y"),
+			{Subject: Var("y"), Predicate: Value(quad.IRI("status")), Object: Var("s"), Label: Value(quad.IRI("smart_graph"))},
+		},
+		expect: []string{
+			"s=cool x=<charlie> y=<dani>",
+			"s=cool x=<dani> y=<dani>",
+		},
+	},
+	{
+		name: "unknown value",
+		patterns: []Pattern{
+			p("?x", "<likes>", "?y"),
+		},
+	},
+}
+
+func TestMatch(t *testing.T) {
+	qs := makeStore(t, testData)
+	for _, c := range matchTests {
+		t.Run(c.name, func(t *testing.T) {
+			rows, err := Match(context.TODO(), qs, c.patterns, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := rowStrings(rows)
+			if len(got) == 0 && len(c.expect) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("unexpected rows:\n%q\nvs\n%q", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	qs := makeStore(t, testData)
+	for _, c := range []struct {
+		name     string
+		patterns []Pattern
+		err      error
+	}{
+		{name: "empty", err: ErrNoPatterns},
+		{name: "no variables", patterns: []Pattern{p("<bob>", "<status>", "cool")}, err: ErrNoVariables},
+		{name: "cartesian", patterns: []Pattern{
+			p("?x", "<follows>", "?y"),
+			p("?a", "<status>", "?b"),
+		}, err: ErrCartesianProduct},
+		{name: "missing predicate", patterns: []Pattern{{Subject: Var("x"), Object: Var("y")}}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Compile(qs, c.patterns)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if c.err != nil && !strings.HasPrefix(err.Error(), c.err.Error()) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// naiveMatch returns bindings for all combinations of quads that match the patterns.
+func naiveMatch(data []quad.Quad, patterns []Pattern) []map[string]quad.Value {
+	var out []map[string]quad.Value
+	var match func(i int, row map[string]quad.Value)
+	match = func(i int, row map[string]quad.Value) {
+		if i == len(patterns) {
+			cp := make(map[string]quad.Value, len(row))
+			for k, v := range row {
+				cp[k] = v
+			}
+			out = append(out, cp)
+			return
+		}
+	quads:
+		for _, q := range data {
+			var bound []string
+			for _, d := range quad.Directions {
+				t := patterns[i].Get(d)
+				v := q.Get(d)
+				switch {
+				case t.IsZero():
+				case !t.IsVar():
+					if v == nil || t.Value != v {
+						for _, b := range bound {
+							delete(row, b)
+						}
+						continue quads
+					}
+				default:
+					if cur, ok := row[t.Var]; ok {
+						if v == nil || cur != v {
+							for _, b := range bound {
+								delete(row, b)
+							}
+							continue quads
+						}
+					} else if v == nil {
+						for _, b := range bound {
+							delete(row, b)
+						}
+						continue quads
+					} else {
+						row[t.Var] = v
+						bound = append(bound, t.Var)
+					}
+				}
+			}
+			match(i+1, row)
+			for _, b := range bound {
+				delete(row, b)
+			}
+		}
+	}
+	match(0, make(map[string]quad.Value))
+	return out
+}
+
+func TestMatchRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	node := func() quad.Value { return quad.IRI(fmt.Sprintf("n%d", rnd.Intn(8))) }
+	pred := func() quad.Value { return quad.IRI(fmt.Sprintf("p%d", rnd.Intn(3))) }
+	var data []quad.Quad
+	seen := make(map[quad.Quad]bool)
+	for len(data) < 60 {
+		q := quad.Quad{Subject: node(), Predicate: pred(), Object: node()}
+		if rnd.Intn(4) == 0 {
+			q.Label = quad.IRI(fmt.Sprintf("g%d", rnd.Intn(2)))
+		}
+		if !seen[q] {
+			seen[q] = true
+			data = append(data, q)
+		}
+	}
+	qs := makeStore(t, data)
+
+	vars := []string{"a", "b", "c", "d"}
+	term := func(val func() quad.Value) Term {
+		if rnd.Intn(3) == 0 {
+			return Value(val())
+		}
+		return Var(vars[rnd.Intn(len(vars))])
+	}
+	checked := 0
+	for i := 0; i < 300; i++ {
+		patterns := make([]Pattern, 1+rnd.Intn(4))
+		for j := range patterns {
+			patterns[j] = Pattern{Subject: term(node), Predicate: term(pred), Object: term(node)}
+			if rnd.Intn(4) == 0 {
+				patterns[j].Label = term(func() quad.Value { return quad.IRI(fmt.Sprintf("g%d", rnd.Intn(2))) })
+			}
+			if rnd.Intn(3) == 0 {
+				// make the predicate fixed more often, as in real queries
+				patterns[j].Predicate = Value(pred())
+			}
+		}
+		if _, err := validate(patterns); err != nil {
+			continue
+		}
+		checked++
+		rows, err := Match(context.TODO(), qs, patterns, 0)
+		if err != nil {
+			t.Fatalf("%v: %v", patterns, err)
+		}
+		got, expect := rowStrings(rows), rowStrings(naiveMatch(data, patterns))
+		if len(got) == 0 && len(expect) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Fatalf("unexpected rows for %v:\n%q\nvs\n%q", patterns, got, expect)
+		}
+	}
+	if checked < 100 {
+		t.Errorf("too few valid queries: %d", checked)
+	}
+}
+
+func TestSession(t *testing.T) {
+	qs := makeStore(t, testData)
+	s := NewSession(qs)
+	run := func(input string, limit int) ([]interface{}, error) {
+		c := make(chan query.Result, 5)
+		go s.Execute(context.TODO(), input, c, limit)
+		s.results = nil
+		var err error
+		for r := range c {
+			if r.Err() != nil {
+				err = r.Err()
+				continue
+			}
+			s.Collate(r)
+		}
+		out, _ := s.Results()
+		res, _ := out.([]interface{})
+		return res, err
+	}
+	res, err := run(`[{"s": "?x", "p": "<follows>", "o": "?y"}, {"s": "?y", "p": "<status>", "o": "cool"}]`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 || s.Truncated() {
+		t.Fatalf("unexpected results: %v", res)
+	}
+	found := false
+	for _, r := range res {
+		if reflect.DeepEqual(r, map[string]string{"x": "<alice>", "y": "<bob>"}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a result not found: %v", res)
+	}
+
+	res, err = run(`[{"s": "?x", "p": "<follows>", "o": "?y"}]`, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || !s.Truncated() {
+		t.Errorf("expected results to be truncated: %v", res)
+	}
+
+	if _, err = run(`[{"s": "?x"`, 0); err == nil {
+		t.Error("expected a parse error")
+	}
+	if _, err = run(`[{"s": "?x", "p": "<follows>", "o": "?y"}, {"s": "?a", "p": "<status>", "o": "?b"}]`, 0); err == nil {
+		t.Error("expected a cartesian product error")
+	}
+}
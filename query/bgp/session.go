@@ -0,0 +1,163 @@
+package bgp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+const Name = "bgp"
+
+func init() {
+	query.RegisterLanguage(query.Language{
+		Name: Name,
+		Session: func(qs graph.QuadStore) query.Session {
+			return NewSession(qs)
+		},
+		HTTP: func(qs graph.QuadStore) query.HTTP {
+			return NewSession(qs)
+		},
+		REPL: func(qs graph.QuadStore) query.REPLSession {
+			return NewSession(qs)
+		},
+	})
+}
+
+// ParsePatterns parses a JSON list of patterns, for example:
+//
+//	[{"s": "?x", "p": "<follows>", "o": "?y"}, {"s": "?y", "p": "<status>", "o": "cool"}]
+//
+// See ParseTerm for the syntax of terms. Errors are returned as graph.QueryError.
+func ParsePatterns(data []byte) ([]Pattern, error) {
+	var patterns []Pattern
+	err := json.Unmarshal(data, &patterns)
+	if e, ok := err.(*json.SyntaxError); ok {
+		// offset is set after the invalid character
+		return nil, graph.NewQueryError(Name, string(data), int(e.Offset)-1, fmt.Errorf("cannot parse patterns: %v", err))
+	} else if err != nil {
+		return nil, &graph.QueryError{Language: Name, Err: fmt.Errorf("cannot parse patterns: %v", err)}
+	}
+	return patterns, nil
+}
+
+// Session runs queries with patterns encoded as JSON. See ParsePatterns.
+type Session struct {
+	qs        graph.QuadStore
+	vars      []string
+	results   []interface{}
+	truncated bool // results of the last query are partial
+}
+
+func NewSession(qs graph.QuadStore) *Session {
+	return &Session{qs: qs}
+}
+
+func (s *Session) compile(input string) (*Query, error) {
+	patterns, err := ParsePatterns([]byte(input))
+	if err != nil {
+		return nil, err
+	}
+	q, err := Compile(s.qs, patterns)
+	if err != nil {
+		return nil, &graph.QueryError{Language: Name, Err: err}
+	}
+	return q, nil
+}
+
+func (s *Session) Execute(ctx context.Context, input string, c chan query.Result, limit int) {
+	defer close(c)
+	s.truncated = false
+	s.results = nil
+	send := func(r query.Result) {
+		select {
+		case c <- r:
+		case <-ctx.Done():
+		}
+	}
+	q, err := s.compile(input)
+	if err != nil {
+		send(query.ErrorResult(err))
+		return
+	}
+	defer q.Close()
+	s.vars = q.Vars()
+	// read one more row to find out if results are truncated
+	n, max := 0, 0
+	if limit > 0 {
+		max = limit + 1
+	}
+	err = q.Each(ctx, max, func(row map[string]graph.Value) {
+		if limit > 0 && n >= limit {
+			s.truncated = true
+			return
+		}
+		n++
+		send(query.TagMapResult(row))
+	})
+	if err != nil {
+		send(query.ErrorResult(err))
+	}
+}
+
+var _ query.Truncater = (*Session)(nil)
+
+// Truncated reports if results of the last executed query were dropped because of the results limit.
+func (s *Session) Truncated() bool {
+	return s.truncated
+}
+
+func (s *Session) ShapeOf(input string) (interface{}, error) {
+	q, err := s.compile(input)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	output := make(map[string]interface{})
+	iterator.OutputQueryShapeForIterator(q.Iterator(), s.qs, output)
+	return output, nil
+}
+
+var _ query.Streamer = (*Session)(nil)
+
+// FormatResult converts variable bindings to an object with values in the same
+// format as constant terms of patterns.
+func (s *Session) FormatResult(result query.Result) (interface{}, bool) {
+	row, ok := result.Result().(map[string]graph.Value)
+	if !ok {
+		return nil, false
+	}
+	obj := make(map[string]string, len(row))
+	for k, v := range row {
+		obj[k] = quad.ToString(s.qs.NameOf(v))
+	}
+	return obj, true
+}
+
+func (s *Session) Collate(result query.Result) {
+	if v, ok := s.FormatResult(result); ok {
+		s.results = append(s.results, v)
+	}
+}
+
+func (s *Session) Results() (interface{}, error) {
+	return s.results, nil
+}
+
+func (s *Session) FormatREPL(result query.Result) string {
+	row, ok := result.Result().(map[string]graph.Value)
+	if !ok {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteString("****\n")
+	for _, k := range s.vars {
+		fmt.Fprintf(&buf, "?%s : %s\n", k, s.qs.NameOf(row[k]))
+	}
+	return buf.String()
+}
@@ -236,6 +236,8 @@ var defaultEnv = map[string]func(vm *goja.Runtime, call goja.FunctionCall) goja.
 		return quad.TypedString{Value: quad.String(s), Type: quad.IRI(typ)}
 	}),
 
+	"param": oneStringType(func(s string) quad.Value { return shape.Param(s) }),
+
 	"lt":    cmpOpType(iterator.CompareLT),
 	"lte":   cmpOpType(iterator.CompareLTE),
 	"gt":    cmpOpType(iterator.CompareGT),
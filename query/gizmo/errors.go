@@ -19,6 +19,8 @@ import "fmt"
 var (
 	errNoVia       = fmt.Errorf("expected predicate list")
 	errRegexpOnIRI = fmt.Errorf("regexps are not allowed on IRIs")
+	errNotPrepared = fmt.Errorf("only All and GetLimit are allowed in prepared queries")
+	errNoFinal     = fmt.Errorf("prepared query must call All or GetLimit once")
 )
 
 type errArgCount2 struct {
@@ -15,16 +15,32 @@
 package gizmo
 
 import (
+	"math"
+	"strconv"
+
 	"github.com/dop251/goja"
 
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/quad"
 )
 
 const TopResultTag = "id"
 
+// RawValueSuffix is appended to a tag name to get a key for the lexical form of a typed value in results.
+//
+// For example, an integer value of tag "age" is returned as a number under "age" and as a string under "age@raw".
+const RawValueSuffix = "@raw"
+
 // GetLimit is the same as All, but limited to the first N unique nodes at the end of the path, and each of their possible traversals.
 func (p *pathObject) GetLimit(limit int) error {
-	it := p.buildIteratorTree()
+	if p.s.prep != nil {
+		return p.s.prep.record(p, limit)
+	}
+	it, err := p.buildIteratorTree()
+	if err != nil {
+		return err
+	}
 	it.Tagger().Add(TopResultTag)
 	p.s.limit = limit
 	p.s.count = 0
@@ -32,6 +48,8 @@ func (p *pathObject) GetLimit(limit int) error {
 }
 
 // All executes the query and adds the results, with all tags, as a string-to-string (tag to node) map in the output set, one for each path that a traversal could take.
+//
+// Typed values, like numbers, booleans and dates, are returned in their native form. The lexical form of such values is returned under the same tag with the "@raw" suffix. Floating-point values that have no JSON representation (NaN and infinities) are returned in their lexical form instead.
 func (p *pathObject) All() error {
 	return p.GetLimit(p.s.limit)
 }
@@ -41,29 +59,53 @@ func (p *pathObject) toArray(call goja.FunctionCall, withTags bool) goja.Value {
 	if len(args) > 1 {
 		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(args)})
 	}
-	limit := -1
+	limit, capped := -1, false
 	if len(args) > 0 {
 		limit, _ = toInt(args[0])
+	} else if p.s.limit >= 0 {
+		// without an explicit limit, intermediate results are capped by the limit of the session
+		limit, capped = p.s.limit, true
+	}
+	n := limit
+	if capped {
+		n++ // to detect dropped results
+	}
+	it, err := p.buildIteratorTree()
+	if err != nil {
+		return throwErr(p.s.vm, err)
 	}
-	it := p.buildIteratorTree()
 	it.Tagger().Add(TopResultTag)
-	var (
-		array interface{}
-		err   error
-	)
+	var array interface{}
+	dropped := false
 	if !withTags {
-		array, err = p.s.runIteratorToArrayNoTags(it, limit)
+		var arr []interface{}
+		arr, err = p.s.runIteratorToArrayNoTags(it, n)
+		if capped && len(arr) > limit {
+			arr, dropped = arr[:limit], true
+		}
+		array = arr
 	} else {
-		array, err = p.s.runIteratorToArray(it, limit)
+		var arr []map[string]interface{}
+		arr, err = p.s.runIteratorToArray(it, n)
+		if capped && len(arr) > limit {
+			arr, dropped = arr[:limit], true
+		}
+		array = arr
 	}
 	if err != nil {
 		return throwErr(p.s.vm, err)
 	}
+	if dropped {
+		p.s.warn("intermediate results were capped at %d values; pass a limit to ToArray or TagArray to get more", limit)
+	}
 	return p.s.vm.ToValue(array)
 }
 
 // ToArray executes a query and returns the results at the end of the query path as an JS array.
 //
+// It can be used in the middle of a script, for example to build the next query from intermediate results.
+// Without an explicit limit, the number of results is capped by the results limit of the query.
+//
 // Example:
 // 	// javascript
 //	// bobFollowers contains an Array of followers of bob (alice, charlie, dani).
@@ -84,7 +126,10 @@ func (p *pathObject) TagArray(call goja.FunctionCall) goja.Value {
 	return p.toArray(call, true)
 }
 func (p *pathObject) toValue(withTags bool) (interface{}, error) {
-	it := p.buildIteratorTree()
+	it, err := p.buildIteratorTree()
+	if err != nil {
+		return nil, err
+	}
 	it.Tagger().Add(TopResultTag)
 	const limit = 1
 	if !withTags {
@@ -136,24 +181,97 @@ func (p *pathObject) Map(call goja.FunctionCall) goja.Value {
 //	// Simulate query.All().All()
 //	graph.V("<alice>").ForEach(function(d) { g.Emit(d) } )
 func (p *pathObject) ForEach(call goja.FunctionCall) goja.Value {
-	it := p.buildIteratorTree()
-	it.Tagger().Add(TopResultTag)
 	if n := len(call.Arguments); n != 1 && n != 2 {
 		return throwErr(p.s.vm, errArgCount{Got: len(call.Arguments)})
 	}
+	it, err := p.buildIteratorTree()
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	it.Tagger().Add(TopResultTag)
 	callback := call.Argument(len(call.Arguments) - 1)
 	args := exportArgs(call.Arguments[:len(call.Arguments)-1])
 	limit := -1
 	if len(args) != 0 {
 		limit, _ = toInt(args[0])
 	}
-	err := p.s.runIteratorWithCallback(it, callback, call, limit)
+	err = p.s.runIteratorWithCallback(it, callback, call, limit)
 	if err != nil {
 		return throwErr(p.s.vm, err)
 	}
 	return goja.Null()
 }
 
+func (p *pathObject) buildLinksIterator() (graph.Iterator, error) {
+	if p.s.prep != nil {
+		return nil, errNotPrepared
+	}
+	if p.path == nil {
+		return nil, path.ErrNotTraversal
+	}
+	return p.path.BuildLinksIteratorOn(p.s.qs)
+}
+
+// GetQuads executes the query and adds quads followed by the last traversal of the path to the output set.
+// Each quad is a map with "subject", "predicate", "object" and "label" keys. The path must end with a traversal, like Out or In.
+// Signature: ([limit])
+//
+// Arguments:
+//
+// * `limit` (Optional): An integer value on the first `limit` quads to return.
+//
+// Example:
+//	// javascript
+//	// Return all quads with "<follows>" predicate that start at "<bob>".
+//	g.V("<bob>").Out("<follows>").GetQuads()
+func (p *pathObject) GetQuads(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) > 1 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	limit := p.s.limit
+	if len(args) > 0 {
+		limit, _ = toInt(args[0])
+	}
+	it, err := p.buildLinksIterator()
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	p.s.limit = limit
+	p.s.count = 0
+	if err = p.s.runLinks(it); err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return goja.Null()
+}
+
+// ToQuads is the same as GetQuads, but returns quads as a JS array.
+// Signature: ([limit])
+//
+// Example:
+//	// javascript
+//	// bobLinks contains an Array of quads, like {"subject": "<bob>", "predicate": "<follows>", "object": "<fred>"}.
+//	var bobLinks = g.V("<bob>").Out("<follows>").ToQuads()
+func (p *pathObject) ToQuads(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) > 1 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	limit := -1
+	if len(args) > 0 {
+		limit, _ = toInt(args[0])
+	}
+	it, err := p.buildLinksIterator()
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	array, err := p.s.runLinksToArray(it, limit)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return p.s.vm.ToValue(array)
+}
+
 // Count returns a number of results and returns it as a value.
 //
 // Example:
@@ -163,10 +281,49 @@ func (p *pathObject) ForEach(call goja.FunctionCall) goja.Value {
 //	// Send it as a query result
 //	g.Emit(n)
 func (p *pathObject) Count() (int64, error) {
-	it := p.buildIteratorTree()
+	it, err := p.buildIteratorTree()
+	if err != nil {
+		return 0, err
+	}
 	return p.s.countResults(it)
 }
 
+// GroupCount counts results for each value of a given tag, and returns an object that maps the values to the counts.
+// Each path is counted separately, thus a node that was reached in multiple ways is counted multiple times.
+// Results without the tag are skipped.
+//
+// Example:
+//	// javascript
+//	// Count followers of each node
+//	var followers = g.V().Tag("target").In("<follows>").GroupCount("target")
+//	// followers["<bob>"] is 3
+//	g.Emit(followers)
+func (p *pathObject) GroupCount(tag string) (map[string]interface{}, error) {
+	it, err := p.buildIteratorTree()
+	if err != nil {
+		return nil, err
+	}
+	it.Tagger().Add(TopResultTag)
+	return p.s.groupResults(it, tag, false)
+}
+
+// GroupBy is the same as GroupCount, but returns an object that maps values of the tag to arrays of results, as TagArray would.
+//
+// Example:
+//	// javascript
+//	// Collect followers of each node
+//	var followers = g.V().Tag("target").In("<follows>").GroupBy("target")
+//	// followers["<bob>"] contains results for alice, charlie and dani
+//	g.Emit(followers)
+func (p *pathObject) GroupBy(tag string) (map[string]interface{}, error) {
+	it, err := p.buildIteratorTree()
+	if err != nil {
+		return nil, err
+	}
+	it.Tagger().Add(TopResultTag)
+	return p.s.groupResults(it, tag, true)
+}
+
 func quadValueToString(v quad.Value) string {
 	if s, ok := v.(quad.String); ok {
 		return string(s)
@@ -184,3 +341,50 @@ func quadValueToNative(v quad.Value) interface{} {
 	}
 	return out
 }
+
+// rawValue returns a lexical form of a typed literal, or false if the value is not typed.
+func rawValue(v quad.Value) (string, bool) {
+	switch v := v.(type) {
+	case quad.TypedString:
+		return string(v.Value), true
+	case quad.Bool:
+		// TypedString of Bool is not in the XSD lexical form
+		return strconv.FormatBool(bool(v)), true
+	case quad.Float:
+		// neither are infinities
+		if f := float64(v); math.IsInf(f, 0) {
+			if f < 0 {
+				return "-INF", true
+			}
+			return "INF", true
+		}
+		return string(v.TypedString().Value), true
+	case quad.TypedStringer:
+		return string(v.TypedString().Value), true
+	}
+	return "", false
+}
+
+// setTagValue sets a native form of the value for a given tag. For typed literals,
+// the lexical form is set as well, under a key with RawValueSuffix.
+func setTagValue(obj map[string]interface{}, tag string, v quad.Value) {
+	o := quadValueToNative(v)
+	if o == nil {
+		return
+	}
+	obj[tag] = o
+	if raw, ok := rawValue(v); ok {
+		obj[tag+RawValueSuffix] = raw
+	}
+}
+
+// quadToNative converts a quad to a map from direction names to native values.
+func quadToNative(q quad.Quad) map[string]interface{} {
+	out := make(map[string]interface{}, 4)
+	for _, d := range quad.Directions {
+		if v := quadValueToNative(q.Get(d)); v != nil {
+			out[d.String()] = v
+		}
+	}
+	return out
+}
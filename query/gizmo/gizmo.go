@@ -16,14 +16,16 @@ package gizmo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 
 	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
 
-	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/query"
 	"github.com/cayleygraph/cayley/schema"
@@ -68,6 +70,8 @@ type Session struct {
 	last string
 	p    *goja.Program
 
+	prep *preparedQuery // set while preparing a query
+
 	out   chan query.Result
 	ctx   context.Context
 	limit int
@@ -77,6 +81,13 @@ type Session struct {
 	dataOutput []interface{}
 	err        error
 	shape      map[string]interface{}
+
+	explain bool          // set while explaining a query
+	io      graph.IOStats // reads performed while explaining a query
+	plans   []graph.Description
+
+	truncated bool     // results of the last query are partial
+	warnings  []string // warnings for the last query
 }
 
 func (s *Session) context() context.Context {
@@ -102,42 +113,100 @@ func (s *Session) buildEnv() error {
 func (s *Session) tagsToValueMap(m map[string]graph.Value) map[string]interface{} {
 	outputMap := make(map[string]interface{})
 	for k, v := range m {
-		if o := quadValueToNative(s.qs.NameOf(v)); o != nil {
-			outputMap[k] = o
-		}
+		setTagValue(outputMap, k, s.qs.NameOf(v))
 	}
 	if len(outputMap) == 0 {
 		return nil
 	}
 	return outputMap
 }
-func (s *Session) runIteratorToArray(it graph.Iterator, limit int) ([]map[string]interface{}, error) {
-	ctx := s.context()
 
+// outputShape records a shape of the iterator instead of running it.
+func (s *Session) outputShape(it graph.Iterator) {
+	defer it.Close()
+	iterator.OutputQueryShapeForIterator(it, s.qs, s.shape)
+}
+
+// explainIterator records a plan of the iterator instead of running it,
+// if the session explains the query.
+func (s *Session) explainIterator(it graph.Iterator) bool {
+	if !s.explain {
+		return false
+	}
+	c := graph.Iterate(s.context(), it)
+	s.plans = append(s.plans, c.Explain())
+	s.io.Add(c.IOStats())
+	return true
+}
+
+// collector accounts memory of results buffered by a query in the budget of the context
+// (see graph.WithBudget), and stops the iteration if the budget is exceeded.
+type collector struct {
+	ctx    context.Context
+	cancel func()
+	budget *graph.Budget
+	err    error
+}
+
+func (s *Session) newCollector() *collector {
+	ctx, cancel := context.WithCancel(s.context())
+	return &collector{ctx: ctx, cancel: cancel, budget: graph.BudgetFromContext(ctx)}
+}
+
+// add reserves memory for a result with n values. It returns false and stops the
+// iteration if the budget is exceeded.
+func (c *collector) add(n int) bool {
+	if c.err != nil {
+		return false
+	}
+	if err := c.budget.Reserve(graph.RowSize(n)); err != nil {
+		c.err = err
+		c.cancel()
+		return false
+	}
+	return true
+}
+
+// done returns an error of the budget, if any, or an error of the iteration.
+func (c *collector) done(err error) error {
+	c.cancel()
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
+
+func (s *Session) runIteratorToArray(it graph.Iterator, limit int) ([]map[string]interface{}, error) {
 	output := make([]map[string]interface{}, 0)
-	err := graph.Iterate(ctx, it).Limit(limit).TagEach(func(tags map[string]graph.Value) {
+	if s.explainIterator(it) {
+		return output, nil
+	}
+	c := s.newCollector()
+	err := graph.Iterate(c.ctx, it).Limit(limit).TagEach(func(tags map[string]graph.Value) {
 		tm := s.tagsToValueMap(tags)
-		if tm == nil {
+		if tm == nil || !c.add(len(tm)) {
 			return
 		}
 		output = append(output, tm)
 	})
-	if err != nil {
+	if err = c.done(err); err != nil {
 		return nil, err
 	}
 	return output, nil
 }
 
 func (s *Session) runIteratorToArrayNoTags(it graph.Iterator, limit int) ([]interface{}, error) {
-	ctx := s.context()
-
 	output := make([]interface{}, 0)
-	err := graph.Iterate(ctx, it).Paths(false).Limit(limit).EachValue(s.qs, func(v quad.Value) {
-		if o := quadValueToNative(v); o != nil {
+	if s.explainIterator(it) {
+		return output, nil
+	}
+	c := s.newCollector()
+	err := graph.Iterate(c.ctx, it).Paths(false).Limit(limit).EachValue(s.qs, func(v quad.Value) {
+		if o := quadValueToNative(v); o != nil && c.add(0) {
 			output = append(output, o)
 		}
 	})
-	if err != nil {
+	if err = c.done(err); err != nil {
 		return nil, err
 	}
 	return output, nil
@@ -147,6 +216,8 @@ func (s *Session) runIteratorWithCallback(it graph.Iterator, callback goja.Value
 	fnc, ok := goja.AssertFunction(callback)
 	if !ok {
 		return fmt.Errorf("expected js callback function")
+	} else if s.explainIterator(it) {
+		return nil
 	}
 	ctx, cancel := context.WithCancel(s.context())
 	defer cancel()
@@ -169,6 +240,9 @@ func (s *Session) runIteratorWithCallback(it graph.Iterator, callback goja.Value
 
 func (s *Session) send(ctx context.Context, r *Result) bool {
 	if s.limit >= 0 && s.count >= s.limit {
+		if !r.Meta {
+			s.truncated = true
+		}
 		return false
 	}
 	if s.out == nil {
@@ -183,38 +257,202 @@ func (s *Session) send(ctx context.Context, r *Result) bool {
 		return false
 	}
 	s.count++
-	return s.limit < 0 || s.count < s.limit
+	// even if the limit is reached, the caller will try to send the next result,
+	// thus we know if any results were dropped
+	return true
+}
+
+// remaining returns the number of results that can still be sent before reaching
+// the limit, or -1 if there is no limit. Iteration is limited to this number of results,
+// so the iterator tree does no work for results that would be dropped.
+func (s *Session) remaining() int {
+	if s.limit < 0 {
+		return -1
+	} else if n := s.limit - s.count; n > 0 {
+		return n
+	}
+	return 0
 }
 
 func (s *Session) runIterator(it graph.Iterator) error {
 	if s.shape != nil {
-		iterator.OutputQueryShapeForIterator(it, s.qs, s.shape)
+		s.outputShape(it)
+		return nil
+	} else if s.explainIterator(it) {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(s.context())
+	defer cancel()
+	stop := false
+	c := graph.Iterate(ctx, it).Paths(true).Limit(s.remaining())
+	err := c.TagEach(func(tags map[string]graph.Value) {
+		if !stop && !s.send(ctx, &Result{Tags: tags}) {
+			cancel()
+			stop = true
+		}
+	})
+	if stop {
+		err = nil
+	} else if c.Truncated() {
+		s.truncated = true
+	}
+	return err
+}
+
+func (s *Session) runLinks(it graph.Iterator) error {
+	if s.shape != nil {
+		s.outputShape(it)
+		return nil
+	} else if s.explainIterator(it) {
 		return nil
 	}
 
 	ctx, cancel := context.WithCancel(s.context())
 	defer cancel()
 	stop := false
-	err := graph.Iterate(ctx, it).Paths(true).TagEach(func(tags map[string]graph.Value) {
-		if !s.send(ctx, &Result{Tags: tags}) {
+	c := graph.Iterate(ctx, it).Limit(s.remaining())
+	err := c.Each(func(v graph.Value) {
+		if !stop && !s.send(ctx, &Result{Val: quadToNative(s.qs.Quad(v))}) {
 			cancel()
 			stop = true
 		}
 	})
 	if stop {
 		err = nil
+	} else if c.Truncated() {
+		s.truncated = true
 	}
 	return err
 }
 
+func (s *Session) runLinksToArray(it graph.Iterator, limit int) ([]interface{}, error) {
+	output := make([]interface{}, 0)
+	if s.explainIterator(it) {
+		return output, nil
+	}
+	c := s.newCollector()
+	err := graph.Iterate(c.ctx, it).Limit(limit).Each(func(v graph.Value) {
+		// quad has 4 values
+		if c.add(3) {
+			output = append(output, quadToNative(s.qs.Quad(v)))
+		}
+	})
+	if err = c.done(err); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
 func (s *Session) countResults(it graph.Iterator) (int64, error) {
 	if s.shape != nil {
-		iterator.OutputQueryShapeForIterator(it, s.qs, s.shape)
+		s.outputShape(it)
 		return 0, nil
+	} else if s.explainIterator(it) {
+		// the query is not executed, thus the estimated size is returned
+		return s.plans[len(s.plans)-1].Size, nil
 	}
 	return graph.Iterate(s.context(), it).Paths(true).Count()
 }
 
+// MaxGroupEntries limits the memory used by GroupCount and GroupBy: the number of groups
+// for GroupCount, and the number of collected results for GroupBy. Results above the limit
+// are dropped, and the query is marked as truncated.
+var MaxGroupEntries = 100000
+
+// resultGroup holds results with the same value of the tag.
+type resultGroup struct {
+	key  graph.Value
+	n    int64
+	rows []map[string]graph.Value
+}
+
+// groupResults runs the iterator and groups results by the value of a given tag.
+// Each path is counted separately. If collect is set, results are returned for each
+// group, otherwise they are only counted. Results without the tag are skipped.
+func (s *Session) groupResults(it graph.Iterator, tag string, collect bool) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	if s.shape != nil {
+		s.outputShape(it)
+		return out, nil
+	} else if s.explainIterator(it) {
+		return out, nil
+	}
+	c := s.newCollector()
+	var (
+		groups  = make(map[interface{}]*resultGroup)
+		order   []*resultGroup
+		entries int
+		dropped bool
+	)
+	err := graph.Iterate(c.ctx, it).Paths(true).TagEach(func(tags map[string]graph.Value) {
+		v, ok := tags[tag]
+		if !ok {
+			return
+		}
+		k := graph.ToKey(v)
+		g := groups[k]
+		if g == nil || collect {
+			if entries >= MaxGroupEntries {
+				dropped = true
+				return
+			}
+			n := 0
+			if collect {
+				n = len(tags)
+			}
+			if !c.add(n) {
+				return
+			}
+		}
+		if g == nil {
+			g = &resultGroup{key: v}
+			groups[k] = g
+			order = append(order, g)
+			if !collect {
+				entries++
+			}
+		}
+		g.n++
+		if collect {
+			g.rows = append(g.rows, tags)
+			entries++
+		}
+	})
+	if err = c.done(err); err != nil {
+		return nil, err
+	}
+	if dropped {
+		s.truncated = true
+		s.warn("number of grouped results exceeds %d, some of them were dropped", MaxGroupEntries)
+	}
+	keys := make([]graph.Value, 0, len(order))
+	for _, g := range order {
+		keys = append(keys, g.key)
+	}
+	names, err := graph.ValuesOf(s.context(), s.qs, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, g := range order {
+		// different values may have the same string form, merge them
+		key := quadValueToString(names[i])
+		if !collect {
+			n, _ := out[key].(int64)
+			out[key] = n + g.n
+			continue
+		}
+		arr, _ := out[key].([]interface{})
+		for _, tags := range g.rows {
+			if tm := s.tagsToValueMap(tags); tm != nil {
+				arr = append(arr, tm)
+			}
+		}
+		out[key] = arr
+	}
+	return out, nil
+}
+
 type Result struct {
 	Meta bool
 	Val  interface{}
@@ -229,6 +467,19 @@ func (r *Result) Result() interface{} {
 }
 func (r *Result) Err() error { return nil }
 
+// compileError converts an error of the script compilation to graph.QueryError.
+// The position of the error is taken from the parser, if it's available.
+func compileError(qu string, err error) error {
+	qerr := &graph.QueryError{Language: Name, Err: err}
+	if _, perr := parser.ParseFile(nil, "", qu, 0); perr != nil {
+		if list, ok := perr.(parser.ErrorList); ok && len(list) != 0 {
+			qerr.Line, qerr.Column = list[0].Position.Line, list[0].Position.Column
+			qerr.Err = errors.New(list[0].Message)
+		}
+	}
+	return qerr
+}
+
 func (s *Session) run(qu string) (v goja.Value, err error) {
 	var p *goja.Program
 	if s.last == qu && s.last != "" {
@@ -236,7 +487,7 @@ func (s *Session) run(qu string) (v goja.Value, err error) {
 	} else {
 		p, err = goja.Compile("", qu, false)
 		if err != nil {
-			return
+			return nil, compileError(qu, err)
 		}
 		s.last, s.p = qu, p
 	}
@@ -253,7 +504,10 @@ func (s *Session) Execute(ctx context.Context, qu string, out chan query.Result,
 	s.out = out
 	s.limit = limit
 	s.count = 0
-	s.ctx = ctx
+	s.truncated = false
+	s.warnings = nil
+	// share materialized values between all paths of the query
+	s.ctx = iterator.WithInterner(ctx, iterator.NewInterner())
 	done := make(chan struct{})
 	defer close(done)
 	go func() {
@@ -276,6 +530,86 @@ func (s *Session) Execute(ctx context.Context, qu string, out chan query.Result,
 	}
 }
 
+var _ query.Preparer = (*Session)(nil)
+
+// Prepare runs the query script and records the path passed to All or GetLimit
+// instead of executing it. Values of parameters can be referenced with param("name").
+//
+// Other finals are not allowed in prepared queries.
+func (s *Session) Prepare(qu string, opt query.PrepareOptions) (query.PreparedQuery, error) {
+	s.prep = &preparedQuery{qs: s.qs, opt: opt}
+	s.limit = -1
+	defer func() {
+		s.prep = nil
+	}()
+	if _, err := s.run(qu); err != nil {
+		return nil, err
+	}
+	q := s.prep
+	if q.p == nil {
+		return nil, errNoFinal
+	}
+	return q, nil
+}
+
+var _ query.PreparedQuery = (*preparedQuery)(nil)
+
+type preparedQuery struct {
+	qs    graph.QuadStore
+	opt   query.PrepareOptions
+	p     *path.Prepared
+	limit int
+}
+
+func (q *preparedQuery) record(p *pathObject, limit int) error {
+	if q.p != nil {
+		return errNoFinal
+	}
+	if err := p.path.CheckTags(); err != nil {
+		return err
+	}
+	q.p = p.path.PrepareOn(q.qs)
+	q.p.MaxStale = q.opt.MaxStale
+	q.limit = limit
+	return nil
+}
+
+func (q *preparedQuery) Params() []string {
+	return q.p.Params()
+}
+
+func (q *preparedQuery) Execute(ctx context.Context, params map[string]quad.Value, out chan query.Result, limit int) {
+	defer close(out)
+	it, err := q.p.BuildIterator(params)
+	if err != nil {
+		select {
+		case <-ctx.Done():
+		case out <- query.ErrorResult(err):
+		}
+		return
+	}
+	it.Tagger().Add(TopResultTag)
+	if limit < 0 || (q.limit >= 0 && q.limit < limit) {
+		limit = q.limit
+	}
+	err = graph.Iterate(ctx, it).On(q.qs).Paths(true).Limit(limit).TagEach(func(tags map[string]graph.Value) {
+		select {
+		case out <- &Result{Tags: tags}:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case out <- query.ErrorResult(err):
+		}
+	}
+}
+
+func (q *preparedQuery) Close() error {
+	return q.p.Close()
+}
+
 func (s *Session) FormatREPL(result query.Result) string {
 	if err := result.Err(); err != nil {
 		return fmt.Sprintf("error: %v", err)
@@ -329,6 +663,58 @@ func (s *Session) FormatREPL(result query.Result) string {
 	return out
 }
 
+var _ query.Truncater = (*Session)(nil)
+
+// IOStats returns reads performed on the backend while explaining the last query.
+func (s *Session) IOStats() graph.IOStats {
+	return s.io
+}
+
+// Truncated reports if results of the last executed query were dropped because
+// of the results limit, or a truncating iterator in the query (ex: Limit).
+func (s *Session) Truncated() bool {
+	return s.truncated
+}
+
+var _ query.Warner = (*Session)(nil)
+
+// warn records a warning for the current query. Repeated warnings are recorded once.
+func (s *Session) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for _, w := range s.warnings {
+		if w == msg {
+			return
+		}
+	}
+	s.warnings = append(s.warnings, msg)
+}
+
+// Warnings returns warnings for the last executed query, such as tag collisions in results.
+func (s *Session) Warnings() []string {
+	return s.warnings
+}
+
+var _ query.Explainer = (*Session)(nil)
+
+// Explain runs the query script, but records plans of all the paths passed to
+// finals (All, ToArray, Count, etc.) instead of executing them. No data is read from
+// the backend: finals that return values to the script return placeholders (empty
+// arrays and maps), and Count returns the estimated size of the path.
+func (s *Session) Explain(ctx context.Context, qu string) ([]graph.Description, error) {
+	s.explain = true
+	s.out = nil
+	s.ctx = ctx
+	s.io = graph.IOStats{}
+	defer func() {
+		s.explain = false
+		s.plans = nil
+	}()
+	if _, err := s.run(qu); err != nil {
+		return nil, err
+	}
+	return s.plans, nil
+}
+
 // Web stuff
 
 func (s *Session) ShapeOf(qu string) (interface{}, error) {
@@ -344,16 +730,35 @@ func (s *Session) Collate(result query.Result) {
 		s.err = err
 		return
 	}
+	if v, ok := s.FormatResult(result); ok {
+		n := 0
+		if data, ok := result.(*Result); ok {
+			n = len(data.Tags)
+		}
+		if s.err == nil {
+			s.err = graph.BudgetFromContext(s.context()).Reserve(graph.RowSize(n))
+		}
+		if s.err == nil {
+			s.dataOutput = append(s.dataOutput, v)
+		}
+	}
+}
+
+var _ query.Streamer = (*Session)(nil)
+
+// FormatResult converts a single result to a value returned by the HTTP API.
+// Results of finals that return raw values are returned as-is, and tagged results
+// are converted to objects.
+func (s *Session) FormatResult(result query.Result) (interface{}, bool) {
 	data, ok := result.(*Result)
 	if !ok {
-		clog.Errorf("unexpected result type: %T", result)
-		return
+		s.warn("unexpected result type: %T", result)
+		return nil, false
 	} else if data.Meta {
-		return
+		return nil, false
 	}
 	if data.Val != nil {
-		s.dataOutput = append(s.dataOutput, data.Val)
-		return
+		return data.Val, true
 	}
 	obj := make(map[string]interface{})
 	tags := data.Tags
@@ -363,15 +768,15 @@ func (s *Session) Collate(result query.Result) {
 	}
 	sort.Strings(tagKeys)
 	for _, k := range tagKeys {
-		if name := s.qs.NameOf(tags[k]); name != nil {
-			obj[k] = quadValueToNative(name)
-		} else {
-			delete(obj, k)
+		if _, ok := obj[k]; ok {
+			s.warn("tag %q collides with a raw value of another tag", k)
 		}
+		setTagValue(obj, k, s.qs.NameOf(tags[k]))
 	}
-	if len(obj) != 0 {
-		s.dataOutput = append(s.dataOutput, obj)
+	if len(obj) == 0 {
+		return nil, false
 	}
+	return obj, true
 }
 
 func (s *Session) Results() (interface{}, error) {
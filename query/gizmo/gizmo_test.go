@@ -113,6 +113,20 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<fred>", "cool_person"},
 	},
+	{
+		message: "use .Out() with limitPerNode",
+		query: `
+			g.V("<charlie>", "<dani>", "<emily>").Out("<follows>", null, {limitPerNode: 1}).Count()
+		`,
+		expect: []string{"3"},
+	},
+	{
+		message: "use .In() with limitPerNode",
+		query: `
+			g.V("<alice>", "<fred>").In("<follows>", null, {limitPerNode: 5}).All()
+		`,
+		expect: []string{"<bob>", "<emily>"},
+	},
 	{
 		message: "use .In()",
 		query: `
@@ -358,6 +372,34 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<dani>"},
 	},
+	{
+		message: "use Order and Limit",
+		query: `
+				g.V().Has("<status>").Order().Limit(2).All()
+		`,
+		expect: []string{"<bob>", "<dani>"},
+	},
+	{
+		message: "use OrderDesc and Limit",
+		query: `
+				g.V().Has("<status>").Unique().OrderDesc().Limit(2).All()
+		`,
+		expect: []string{"<emily>", "<greg>"},
+	},
+	{
+		message: "use OrderBy on a saved value",
+		query: `
+				g.V().Save("<status>", "status").OrderBy("status").Limit(3).All()
+		`,
+		expect: []string{"<bob>", "<dani>", "<greg>"},
+	},
+	{
+		message: "use OrderByDesc on a saved value",
+		query: `
+				g.V().Save("<status>", "status").OrderByDesc("status").Limit(2).All()
+		`,
+		expect: []string{"<emily>", "<greg>"},
+	},
 
 	{
 		message: "show Count",
@@ -429,6 +471,14 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<bob>", "<greg>"},
 	},
+	{
+		message: "show a mixed list of predicates and paths",
+		query: `
+			g.V("<dani>").Out([g.V("<predicates>").Out("<are>").Is("<status>"), "<follows>"], "pred").All()
+		`,
+		tag:    "pred",
+		expect: []string{"<follows>", "<follows>", "<status>"},
+	},
 	{
 		message: "list all bob's incoming predicates",
 		query: `
@@ -479,6 +529,28 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<dani>", "<fred>"},
 	},
+	{
+		message: "reject tag collisions",
+		query: `
+			g.V("<charlie>").Tag("x").Out("<follows>").Tag("x").All()
+		`,
+		err: true,
+	},
+	{
+		message: "reject save collisions",
+		query: `
+			g.V("<dani>").Save("<follows>", "x").Save("<status>", "x").All()
+		`,
+		err: true,
+	},
+	{
+		message: "allow same tag in different Or branches",
+		query: `
+			g.V("<charlie>").Out("<follows>").Tag("x").Union(g.V("<alice>").Out("<follows>").Tag("x")).All()
+		`,
+		tag:    "x",
+		expect: []string{"<bob>", "<bob>", "<dani>"},
+	},
 	{
 		message: "issue #254",
 		query:   `g.V({"id":"<alice>"}).All()`,
@@ -518,6 +590,24 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<alice>", "<charlie>"},
 	},
+	{
+		message: "combine intermediate results",
+		query: `
+			var f = g.V("<alice>").Out("<follows>").ToValue()
+			var st = g.V(f).Out("<status>").ToArray()
+			g.Emit(f + ": " + st.join(","))
+		`,
+		expect: []string{"<bob>: cool_person"},
+	},
+	{
+		message: "cap intermediate results",
+		query: `
+			g.Emit(g.V("<bob>").In("<follows>").ToArray().length)
+			g.Emit(g.V("<bob>").In("<follows>").TagArray(3).length)
+		`,
+		limit:  2,
+		expect: []string{"2", "3"},
+	},
 	{
 		message: "show ForEach",
 		query: `
@@ -581,6 +671,33 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<bob>", "<dani>", "<fred>", "<greg>"},
 	},
+	{
+		message: "cycles (no loops)",
+		query: `
+			g.V("<charlie>").Cycles("<follows>").All();
+		`,
+		expect: nil,
+	},
+	{
+		message: "cycles path",
+		query: `
+			g.V("<charlie>").Cycles(g.M().Both("<follows>")).All();
+		`,
+		expect: []string{"<alice>", "<bob>", "<charlie>", "<dani>", "<emily>", "<fred>", "<greg>"},
+	},
+	{
+		message: "cycles tag",
+		query: `
+			g.V("<a>").Cycles("<parent>", "cycle").All();
+		`,
+		data: []quad.Quad{
+			quad.MakeIRI("a", "parent", "b", ""),
+			quad.MakeIRI("b", "parent", "a", ""),
+			quad.MakeIRI("b", "parent", "c", ""),
+		},
+		tag:    "cycle_1",
+		expect: []string{"<a>", "<b>"},
+	},
 	{
 		message: "find non-existent",
 		query: `
@@ -736,3 +853,325 @@ func issue718Nodes() []string {
 	}
 	return nodes
 }
+
+func TestPrepare(t *testing.T) {
+	ses := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq"))
+	pq, err := ses.Prepare(`g.V(param("who")).Out("<follows>").All()`, query.PrepareOptions{})
+	require.NoError(t, err)
+	defer pq.Close()
+	require.Equal(t, []string{"who"}, pq.Params())
+
+	run := func(params map[string]quad.Value) ([]string, error) {
+		c := make(chan query.Result, 1)
+		go pq.Execute(context.TODO(), params, c, -1)
+		var got []string
+		for res := range c {
+			if err := res.Err(); err != nil {
+				return nil, err
+			}
+			got = append(got, quadValueToString(ses.qs.NameOf(res.(*Result).Tags[TopResultTag])))
+		}
+		sort.Strings(got)
+		return got, nil
+	}
+	got, err := run(map[string]quad.Value{"who": quad.IRI("charlie")})
+	require.NoError(t, err)
+	require.Equal(t, []string{"<bob>", "<dani>"}, got)
+
+	got, err = run(map[string]quad.Value{"who": quad.IRI("bob")})
+	require.NoError(t, err)
+	require.Equal(t, []string{"<fred>"}, got)
+
+	_, err = run(nil)
+	require.Error(t, err)
+
+	_, err = ses.Prepare(`g.V(param("who")).ToArray()`, query.PrepareOptions{})
+	require.Error(t, err)
+}
+
+func runQueryCollate(t *testing.T, ses *Session, qu string) interface{} {
+	c := make(chan query.Result, 1)
+	go ses.Execute(context.TODO(), qu, c, -1)
+	for res := range c {
+		ses.Collate(res)
+	}
+	out, err := ses.Results()
+	require.NoError(t, err)
+	return out
+}
+
+func TestTypedResults(t *testing.T) {
+	ses := makeTestSession([]quad.Quad{
+		{Subject: quad.IRI("alice"), Predicate: quad.IRI("age"), Object: quad.Int(21)},
+		{Subject: quad.IRI("alice"), Predicate: quad.IRI("cool"), Object: quad.Bool(true)},
+		{Subject: quad.IRI("alice"), Predicate: quad.IRI("name"), Object: quad.String("Alice")},
+	})
+	got := runQueryCollate(t, ses, `g.V("<alice>").Tag("p").Out("<age>").Tag("age").Back("p").Out("<cool>").Tag("cool").Back("p").Out("<name>").All()`)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"age":      21,
+			"age@raw":  "21",
+			"cool":     true,
+			"cool@raw": "true",
+			"id":       "Alice",
+			"p":        "<alice>",
+		},
+	}, got)
+}
+
+func TestGroupBy(t *testing.T) {
+	ses := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq"))
+
+	got := runQueryCollate(t, ses, `g.Emit(g.V().Tag("target").In("<follows>").GroupCount("target"))`)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"<bob>": int64(3), "<fred>": int64(2), "<dani>": int64(1), "<greg>": int64(2),
+		},
+	}, got)
+
+	// bob is reached from 3 nodes; each path is counted separately
+	got = runQueryCollate(t, ses, `g.Emit(g.V().Tag("source").Out("<follows>").Is("<bob>").GroupCount("id"))`)
+	require.Equal(t, []interface{}{map[string]interface{}{"<bob>": int64(3)}}, got)
+
+	got = runQueryCollate(t, ses, `g.Emit(g.V().Tag("source").Out("<follows>").Is("<bob>").GroupCount("source"))`)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"<alice>": int64(1), "<charlie>": int64(1), "<dani>": int64(1)},
+	}, got)
+
+	got = runQueryCollate(t, ses, `g.Emit(g.V("<dani>", "<fred>").Tag("source").Out("<follows>").GroupBy("id"))`)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"<bob>": []interface{}{
+				map[string]interface{}{"id": "<bob>", "source": "<dani>"},
+			},
+			"<greg>": []interface{}{
+				map[string]interface{}{"id": "<greg>", "source": "<dani>"},
+				map[string]interface{}{"id": "<greg>", "source": "<fred>"},
+			},
+		},
+	}, got)
+
+	defer func(n int) { MaxGroupEntries = n }(MaxGroupEntries)
+	MaxGroupEntries = 2
+	got = runQueryCollate(t, ses, `g.Emit(g.V().Tag("target").In("<follows>").GroupCount("target"))`)
+	require.Len(t, got.([]interface{})[0], 2)
+	require.True(t, ses.Truncated())
+	require.NotEmpty(t, ses.Warnings())
+}
+
+func TestIntermediateResultsCap(t *testing.T) {
+	ses := makeTestSession(issue160TestGraph)
+	for _, c := range []struct {
+		query string
+		warn  bool
+	}{
+		{`g.Emit(g.V().ToArray().length)`, true},
+		{`g.Emit(g.V().TagArray(10).length)`, false},
+		{`g.Emit(g.V("<alice>").ToArray().length)`, false},
+	} {
+		out := make(chan query.Result, 1)
+		go ses.Execute(context.TODO(), c.query, out, 2)
+		for res := range out {
+			require.NoError(t, res.Err())
+		}
+		require.Equal(t, c.warn, len(ses.Warnings()) != 0, "%s: %v", c.query, ses.Warnings())
+	}
+}
+
+func TestQuads(t *testing.T) {
+	data := []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "charlie", "g"),
+		quad.MakeIRI("bob", "follows", "charlie", ""),
+	}
+	expect := []interface{}{
+		map[string]interface{}{
+			"subject": "<alice>", "predicate": "<follows>", "object": "<bob>",
+		},
+		map[string]interface{}{
+			"subject": "<alice>", "predicate": "<follows>", "object": "<charlie>", "label": "<g>",
+		},
+	}
+	sortQuads := func(arr []interface{}) {
+		sort.Slice(arr, func(i, j int) bool {
+			return fmt.Sprint(arr[i]) < fmt.Sprint(arr[j])
+		})
+	}
+
+	sortQuads(expect)
+
+	ses := makeTestSession(data)
+	got := runQueryCollate(t, ses, `g.V("<alice>").Out("<follows>").GetQuads()`).([]interface{})
+	sortQuads(got)
+	require.Equal(t, expect, got)
+
+	got = runQueryCollate(t, ses, `g.Emit(g.V("<alice>").Out("<follows>").ToQuads())`).([]interface{})
+	require.Len(t, got, 1)
+	arr, ok := got[0].([]interface{})
+	require.True(t, ok, "unexpected type: %T", got[0])
+	sortQuads(arr)
+	require.Equal(t, expect, arr)
+
+	c := make(chan query.Result, 1)
+	go ses.Execute(context.TODO(), `g.V("<alice>").Out("<follows>").Is("<bob>").GetQuads()`, c, -1)
+	var gotErr bool
+	for res := range c {
+		if res.Err() != nil {
+			gotErr = true
+		}
+	}
+	require.True(t, gotErr, "expected an error for a path without traversal")
+}
+
+func TestExplain(t *testing.T) {
+	ses := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq"))
+	plans, err := ses.Explain(context.TODO(), `
+var n = g.V("<alice>").Out("<follows>").Count()
+g.V("<bob>").In("<follows>").All()
+`)
+	require.NoError(t, err)
+	require.Len(t, plans, 2)
+	for _, p := range plans {
+		require.NotNil(t, p.Stats)
+	}
+	require.Zero(t, ses.IOStats().Reads)
+
+	// value finals return placeholders instead of reading the data
+	plans, err = ses.Explain(context.TODO(), `
+var arr = g.V("<alice>").Out("<follows>").ToArray()
+var n = g.V("<alice>").Out("<follows>").Count()
+g.V("<alice>").Out("<follows>").ForEach(function(d) { throw "callback was called" })
+if (arr.length == 0 && n > 0) {
+	g.V("<bob>").In("<follows>").All()
+}
+`)
+	require.NoError(t, err)
+	require.Len(t, plans, 4)
+	require.Zero(t, ses.IOStats().Reads)
+
+	// session should work normally after explaining a query
+	got := runQueryCollate(t, ses, `g.V("<bob>").In("<follows>").All()`)
+	require.NotEmpty(t, got)
+}
+
+// callCounter counts calls to iterators of the quad store.
+type callCounter struct {
+	next, contains int
+}
+
+type countingIterator struct {
+	graph.Iterator
+	c *callCounter
+}
+
+func (it countingIterator) Next(ctx context.Context) bool {
+	it.c.next++
+	return it.Iterator.Next(ctx)
+}
+
+func (it countingIterator) Contains(ctx context.Context, v graph.Value) bool {
+	it.c.contains++
+	return it.Iterator.Contains(ctx, v)
+}
+
+func (it countingIterator) Clone() graph.Iterator {
+	return countingIterator{Iterator: it.Iterator.Clone(), c: it.c}
+}
+
+type countingStore struct {
+	graph.QuadStore
+	c *callCounter
+}
+
+func (qs countingStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	return countingIterator{Iterator: qs.QuadStore.QuadIterator(d, v), c: qs.c}
+}
+
+func (qs countingStore) NodesAllIterator() graph.Iterator {
+	return countingIterator{Iterator: qs.QuadStore.NodesAllIterator(), c: qs.c}
+}
+
+func (qs countingStore) QuadsAllIterator() graph.Iterator {
+	return countingIterator{Iterator: qs.QuadStore.QuadsAllIterator(), c: qs.c}
+}
+
+func TestLimitStopsEarly(t *testing.T) {
+	// each of n subjects is linked to each of n objects through the hub,
+	// thus queries below have n*n matching paths and n distinct objects;
+	// only a single result is requested after the limit to check for truncation
+	const n = 1000
+	var data []quad.Quad
+	for i := 0; i < n; i++ {
+		data = append(data,
+			quad.MakeIRI(fmt.Sprint("s", i), "p", "hub", ""),
+			quad.MakeIRI("hub", "q", fmt.Sprint("o", i), ""),
+		)
+	}
+	qs := makeTestSession(data).qs
+	const maxCalls = 50
+	for _, qu := range []string{
+		`g.V().Has("<p>", "<hub>").Tag("s").Out("<p>").Out("<q>").Tag("o").In("<q>").GetLimit(1)`,
+		`g.V().Has("<p>", "<hub>").Tag("s").Out("<p>").Out("<q>").Tag("o").Unique().GetLimit(1)`,
+		`g.V().Has("<p>", "<hub>").Out("<p>").Out("<q>").Unique().GetLimit(1)`,
+		`g.V("<x>").Or(g.V().Has("<p>", "<hub>").Out("<p>").Out("<q>")).Unique().GetLimit(1)`,
+	} {
+		cnt := &callCounter{}
+		ses := NewSession(countingStore{QuadStore: qs, c: cnt})
+		out := make(chan query.Result, 1)
+		go ses.Execute(context.TODO(), qu, out, -1)
+		var got int
+		for res := range out {
+			require.NoError(t, res.Err(), qu)
+			got++
+		}
+		require.Equal(t, 1, got, qu)
+		require.True(t, ses.Truncated(), qu)
+		require.True(t, cnt.next+cnt.contains < maxCalls, "%s: too many calls: %+v", qu, *cnt)
+	}
+}
+
+func TestLimitExactResults(t *testing.T) {
+	qs := makeTestSession([]quad.Quad{
+		quad.MakeIRI("a", "p", "hub", ""),
+		quad.MakeIRI("b", "p", "hub", ""),
+		quad.MakeIRI("hub", "q", "c", ""),
+	}).qs
+	for _, c := range []struct {
+		query     string
+		limit     int
+		results   int
+		truncated bool
+	}{
+		{query: `g.V().Out("<p>").Unique().All()`, limit: 1, results: 1},
+		{query: `g.V().Has("<p>", "<hub>").All()`, limit: 2, results: 2},
+		{query: `g.V().Has("<p>", "<hub>").All()`, limit: 1, results: 1, truncated: true},
+	} {
+		ses := NewSession(qs)
+		out := make(chan query.Result, 1)
+		go ses.Execute(context.TODO(), c.query, out, c.limit)
+		var got int
+		for res := range out {
+			require.NoError(t, res.Err(), c.query)
+			got++
+		}
+		require.Equal(t, c.results, got, c.query)
+		require.Equal(t, c.truncated, ses.Truncated(), "%s: limit %d", c.query, c.limit)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	ses := makeTestSession(issue160TestGraph)
+	out := make(chan query.Result, 1)
+	go ses.Execute(context.TODO(), "g.V()\n  .All(", out, -1)
+	var err error
+	for res := range out {
+		if res.Err() != nil {
+			err = res.Err()
+		}
+	}
+	qerr, ok := err.(*graph.QueryError)
+	require.True(t, ok, "unexpected error: %v", err)
+	require.Equal(t, Name, qerr.Language)
+	require.Equal(t, 2, qerr.Line)
+	require.True(t, qerr.Column > 0)
+}
@@ -77,11 +77,17 @@ func (p *pathObject) clonePath() *path.Path {
 	p.path, np = np, p.path
 	return np
 }
-func (p *pathObject) buildIteratorTree() graph.Iterator {
+func (p *pathObject) buildIteratorTree() (graph.Iterator, error) {
+	if p.s.prep != nil {
+		return nil, errNotPrepared
+	}
 	if p.path == nil {
-		return iterator.NewNull()
+		return iterator.NewNull(), nil
+	}
+	if err := p.path.CheckTags(); err != nil {
+		return nil, err
 	}
-	return p.path.BuildIteratorOn(p.s.qs)
+	return p.path.BuildIteratorOn(p.s.qs), nil
 }
 
 // Filter all paths to ones which, at this point, are on the given node.
@@ -105,12 +111,32 @@ func (p *pathObject) Is(call goja.FunctionCall) goja.Value {
 	return p.newVal(np)
 }
 func (p *pathObject) inout(call goja.FunctionCall, in bool) goja.Value {
-	preds, tags, ok := toViaData(exportArgs(call.Arguments))
+	args := exportArgs(call.Arguments)
+	var limit int
+	if n := len(args); n > 1 {
+		if opts, ok := args[n-1].(map[string]interface{}); ok {
+			args = args[:n-1]
+			if args[n-2] == nil {
+				// allow null tags before options
+				args = args[:n-2]
+			}
+			if v, ok := opts["limitPerNode"]; ok {
+				if limit, ok = toInt(v); !ok || limit <= 0 {
+					return throwErr(p.s.vm, fmt.Errorf("expected positive limitPerNode, got: %v", v))
+				}
+			}
+		}
+	}
+	preds, tags, ok := toViaData(args)
 	if !ok {
 		return throwErr(p.s.vm, errNoVia)
 	}
 	np := p.clonePath()
-	if in {
+	if limit > 0 && in {
+		np = np.InWithLimit(int64(limit), tags, preds...)
+	} else if limit > 0 {
+		np = np.OutWithLimit(int64(limit), tags, preds...)
+	} else if in {
 		np = np.InWithTags(tags, preds...)
 	} else {
 		np = np.OutWithTags(tags, preds...)
@@ -120,7 +146,7 @@ func (p *pathObject) inout(call goja.FunctionCall, in bool) goja.Value {
 
 // In is inverse of Out.
 // Starting with the nodes in `path` on the object, follow the quads with predicates defined by `predicatePath` to their subjects.
-// Signature: ([predicatePath], [tags])
+// Signature: ([predicatePath], [tags], [options])
 //
 // Arguments:
 //
@@ -133,6 +159,8 @@ func (p *pathObject) inout(call goja.FunctionCall, in bool) goja.Value {
 //   * null or undefined: No tags
 //   * a string: A single tag to add the predicate used to the output set.
 //   * a list of strings: Multiple tags to use as keys to save the predicate used to the output set.
+// * `options` (Optional): An object with options:
+//   * `limitPerNode`: Follow at most this number of quads into each of the nodes.
 //
 // Example:
 //
@@ -149,7 +177,7 @@ func (p *pathObject) In(call goja.FunctionCall) goja.Value {
 
 // Out is the work-a-day way to get between nodes, in the forward direction.
 // Starting with the nodes in `path` on the subject, follow the quads with predicates defined by `predicatePath` to their objects.
-// Signature: ([predicatePath], [tags])
+// Signature: ([predicatePath], [tags], [options])
 //
 // Arguments:
 //
@@ -158,10 +186,15 @@ func (p *pathObject) In(call goja.FunctionCall) goja.Value {
 //   * a string: The predicate name to follow out from this node
 //   * a list of strings: The predicates to follow out from this node
 //   * a query path object: The target of which is a set of predicates to follow.
+//   * a list that mixes strings and query path objects: All of the predicates are followed.
 // * `tags` (Optional): One of:
 //   * null or undefined: No tags
 //   * a string: A single tag to add the predicate used to the output set.
 //   * a list of strings: Multiple tags to use as keys to save the predicate used to the output set.
+// * `options` (Optional): An object with options:
+//   * `limitPerNode`: Follow at most this number of quads from each of the nodes.
+//
+// Predicates defined by a query path are not resolved in advance; the path is executed as a part of the query.
 //
 // Example:
 //
@@ -178,6 +211,8 @@ func (p *pathObject) In(call goja.FunctionCall) goja.Value {
 //	// Finds all things dani points at on the status linkage, given from a separate query path.
 //	// Result is {"id": "cool_person", "pred": "<status>"}
 //	g.V("<dani>").Out(g.V("<status>"), "pred").All()
+//	// Finds at most one person followed by each of the people bob follows.
+//	g.V("<bob>").Out("<follows>").Out("<follows>", null, {limitPerNode: 1}).All()
 func (p *pathObject) Out(call goja.FunctionCall) goja.Value {
 	return p.inout(call, false)
 }
@@ -259,6 +294,41 @@ func (p *pathObject) FollowRecursive(call goja.FunctionCall) goja.Value {
 	return p.newVal(np)
 }
 
+// Cycles follows the path or predicate recursively, and returns only nodes that participate in a cycle.
+// Signature: (path[, tag])
+//
+// Arguments:
+//
+// * `path`: A path object or a predicate to follow.
+// * `tag` (Optional): A prefix of tags for nodes of a cycle through each result: "<tag>_0" is the result itself, "<tag>_1" is the next node, and so on.
+//
+// Example:
+// 	// javascript:
+//	// Find loops in a hierarchy that should be a tree.
+//	g.V().Cycles("<parent>", "cycle").All()
+func (p *pathObject) Cycles(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) == 0 || len(args) > 2 {
+		return throwErr(p.s.vm, errArgCount{Got: len(args)})
+	}
+	preds := toVia(args[:1])
+	if len(preds) == 0 {
+		return throwErr(p.s.vm, errNoVia)
+	} else if len(preds) != 1 {
+		return throwErr(p.s.vm, fmt.Errorf("expected one predicate or path for cycles"))
+	}
+	var tag string
+	if len(args) == 2 && args[1] != nil {
+		tags := toStrings(args[1:])
+		if len(tags) != 1 {
+			return throwErr(p.s.vm, fmt.Errorf("expected a string tag for cycles"))
+		}
+		tag = tags[0]
+	}
+	np := p.clonePath().Cycles(preds[0], tag)
+	return p.newVal(np)
+}
+
 // And is an alias for Intersect.
 func (p *pathObject) And(path *pathObject) *pathObject {
 	return p.Intersect(path)
@@ -538,7 +608,8 @@ func (p *pathObject) Difference(path *pathObject) *pathObject {
 	return p.Except(path)
 }
 
-// Labels gets the list of inbound and outbound quad labels
+// Labels gets the list of inbound and outbound quad labels.
+// If LabelContext is set, only labels from this context are returned.
 func (p *pathObject) Labels() *pathObject {
 	np := p.clonePath().Labels()
 	return p.new(np)
@@ -593,7 +664,7 @@ func (p *pathObject) SaveOutPredicates(tag string) *pathObject {
 }
 
 // LabelContext sets (or removes) the subgraph context to consider in the following traversals.
-// Affects all In(), Out(), and Both() calls that follow it. The default LabelContext is null (all subgraphs).
+// Affects all In(), Out(), Both(), Has(), Save() and predicates calls that follow it. The default LabelContext is null (all subgraphs).
 // Signature: ([labelPath], [tags])
 //
 // Arguments:
@@ -667,3 +738,43 @@ func (p *pathObject) Skip(offset int) *pathObject {
 	np := p.clonePath().Skip(int64(offset))
 	return p.new(np)
 }
+
+// Order sorts nodes of current path in ascending order.
+// Numbers are compared by value, other nodes are compared by their string representation.
+//
+// Example:
+//	// javascript
+//	// Start from all nodes that follow bob, and get the first one in order -- results in alice
+//	g.V().Has("<follows>", "<bob>").Order().Limit(1).All()
+func (p *pathObject) Order() *pathObject {
+	np := p.clonePath().Order()
+	return p.new(np)
+}
+
+// OrderDesc is the same as Order, but sorts nodes in descending order.
+func (p *pathObject) OrderDesc() *pathObject {
+	np := p.clonePath().OrderDesc()
+	return p.new(np)
+}
+
+// OrderBy sorts results of current path by the value saved to a tag, in ascending order.
+// Results without the tag are returned last.
+//
+// Arguments:
+//
+// * `tag`: A name of the tag to sort on.
+//
+// Example:
+//	// javascript
+//	// Sort all people with a status by the status value
+//	g.V().Save("<status>", "status").OrderBy("status").All()
+func (p *pathObject) OrderBy(tag string) *pathObject {
+	np := p.clonePath().OrderBy(tag, false)
+	return p.new(np)
+}
+
+// OrderByDesc is the same as OrderBy, but sorts results in descending order.
+func (p *pathObject) OrderByDesc(tag string) *pathObject {
+	np := p.clonePath().OrderBy(tag, true)
+	return p.new(np)
+}
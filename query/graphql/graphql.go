@@ -3,6 +3,7 @@ package graphql
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,6 +11,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/dennwc/graphql/gqlerrors"
 	"github.com/dennwc/graphql/language/ast"
 	"github.com/dennwc/graphql/language/lexer"
 	"github.com/dennwc/graphql/language/parser"
@@ -392,7 +394,12 @@ func Parse(r io.Reader) (*Query, error) {
 	}
 	doc, err := parser.Parse(parser.ParseParams{Source: string(data)})
 	if err != nil {
-		return nil, err
+		qerr := &graph.QueryError{Language: Name, Err: err}
+		if gerr, ok := err.(*gqlerrors.Error); ok && len(gerr.Locations) != 0 {
+			qerr.Line, qerr.Column = gerr.Locations[0].Line, gerr.Locations[0].Column
+			qerr.Err = errors.New(gerr.Message)
+		}
+		return nil, qerr
 	}
 	if len(doc.Definitions) != 1 {
 		return nil, fmt.Errorf("unsupported query type")
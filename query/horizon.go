@@ -0,0 +1,106 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// Meta holds metadata about a query execution.
+type Meta struct {
+	// HorizonStart is the horizon of the quad store when the query was started.
+	HorizonStart graph.PrimaryKey `json:"horizon_start"`
+	// HorizonEnd is the horizon of the quad store when the query has finished.
+	HorizonEnd graph.PrimaryKey `json:"horizon_end"`
+	// Snapshot is set if the query was executed on a snapshot pinned at the start horizon.
+	Snapshot bool `json:"snapshot,omitempty"`
+	// Consistent is set if all results correspond to the start horizon, either because the query
+	// was executed on a snapshot, or because the quad store was not modified during the query.
+	Consistent bool `json:"consistent"`
+
+	// Elapsed is the query execution time in milliseconds.
+	Elapsed float64 `json:"elapsed_ms"`
+	// Count is the number of returned results.
+	Count int `json:"count"`
+	// Truncated is set if some results were dropped, for example because of a limit or a timeout.
+	Truncated bool `json:"truncated"`
+	// Warnings lists non-fatal problems found while executing the query.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// HorizonTracker records horizons of a quad store at the start and at the end of a query.
+type HorizonTracker struct {
+	qs    graph.QuadStore
+	h     graph.Horizoner
+	snap  graph.QuadStore
+	start graph.PrimaryKey
+	meta  *Meta
+}
+
+// TrackHorizon starts tracking the horizon of a quad store. The query must be executed on
+// the quad store returned by the QuadStore method of the tracker.
+//
+// If pin is set and the quad store supports snapshots, the query will be executed on a snapshot
+// of the quad store, thus all results will be consistent with the start horizon.
+func TrackHorizon(qs graph.QuadStore, pin bool) *HorizonTracker {
+	t := &HorizonTracker{qs: qs}
+	if pin && graph.FeaturesOf(qs).Snapshots {
+		if s, ok := qs.(graph.Snapshotter); ok {
+			if snap, err := s.Snapshot(); err == nil {
+				t.h, t.snap = s, snap
+				if sh, ok := snap.(graph.Horizoner); ok {
+					// store might be modified after the snapshot was taken
+					t.start = sh.Horizon()
+				} else {
+					t.start = s.Horizon()
+				}
+				return t
+			}
+		}
+	}
+	if h, ok := qs.(graph.Horizoner); ok {
+		if start := h.Horizon(); start.Valid() {
+			t.h, t.start = h, start
+		}
+	}
+	return t
+}
+
+// QuadStore returns a quad store that should be used to execute the query.
+func (t *HorizonTracker) QuadStore() graph.QuadStore {
+	if t.snap != nil {
+		return t.snap
+	}
+	return t.qs
+}
+
+// Done stops tracking the horizon and returns query metadata. Subsequent calls return the same metadata.
+// It returns nil if the quad store does not track its horizon.
+func (t *HorizonTracker) Done() *Meta {
+	if t.h == nil || t.meta != nil {
+		return t.meta
+	}
+	m := &Meta{
+		HorizonStart: t.start,
+		HorizonEnd:   t.h.Horizon(),
+		Snapshot:     t.snap != nil,
+	}
+	m.Consistent = m.Snapshot || m.HorizonStart.Compare(m.HorizonEnd) == 0
+	if t.snap != nil {
+		t.snap.Close()
+	}
+	t.meta = m
+	return m
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query_test
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+func TestTrackHorizon(t *testing.T) {
+	qs := memstore.New(quad.MakeIRI("a", "b", "c", ""))
+	add := func(q quad.Quad) {
+		if err := qs.ApplyDeltas([]graph.Delta{{Quad: q, Action: graph.Add}}, graph.IgnoreOpts{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr := query.TrackHorizon(qs, true)
+	if tr.QuadStore() != qs {
+		t.Fatal("memstore does not support snapshots")
+	}
+	m := tr.Done()
+	if m == nil || !m.Consistent || m.Snapshot {
+		t.Errorf("unexpected metadata: %+v", m)
+	}
+
+	tr = query.TrackHorizon(qs, true)
+	add(quad.MakeIRI("c", "b", "d", ""))
+	m = tr.Done()
+	if m == nil || m.Consistent || m.HorizonEnd.Compare(m.HorizonStart) <= 0 {
+		t.Errorf("unexpected metadata: %+v", m)
+	}
+	if m2 := tr.Done(); m2 != m {
+		t.Errorf("expected the same metadata: %+v vs %+v", m2, m)
+	}
+
+	tr = query.TrackHorizon(&graphmock.Store{}, true)
+	if m = tr.Done(); m != nil {
+		t.Errorf("unexpected metadata: %+v", m)
+	}
+}
@@ -42,12 +42,20 @@ func (q *Query) BuildIteratorTree(query interface{}) {
 	q.queryStructure = make(map[Path]map[string]interface{})
 	q.queryResult = make(map[ResultPath]map[string]interface{})
 	q.queryResult[""] = make(map[string]interface{})
+	q.projections = make(map[Path]map[string]projection)
+	q.wildcards = make(map[Path]bool)
 
 	var isOptional bool
 	q.it, isOptional, q.err = q.buildIteratorTreeInternal(query, NewPath())
 	if isOptional {
 		q.err = errors.New("optional iterator at the top level")
 	}
+	if q.err == nil {
+		q.err = q.checkProjections()
+	}
+	if q.err != nil {
+		q.err = &graph.QueryError{Language: Name, Err: q.err}
+	}
 }
 
 func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it graph.Iterator, optional bool, err error) {
@@ -87,7 +95,7 @@ func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it grap
 		}
 	case map[string]interface{}:
 		// for JSON objects
-		it, err = q.buildIteratorTreeMapInternal(t, path)
+		it, optional, err = q.buildIteratorTreeMapInternal(t, path)
 	case nil:
 		it = q.buildResultIterator(path)
 		optional = true
@@ -101,13 +109,42 @@ func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it grap
 	return it, optional, nil
 }
 
-func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path Path) (graph.Iterator, error) {
+func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path Path) (graph.Iterator, bool, error) {
 	it := iterator.NewAnd(q.ses.qs)
 	it.AddSubIterator(q.ses.qs.NodesAllIterator())
 	var err error
 	err = nil
 	outputStructure := make(map[string]interface{})
+	var (
+		sortBy     string
+		sortDesc   bool
+		isOptional bool
+	)
 	for key, subquery := range query {
+		if key == sortKey {
+			if sortBy, sortDesc, err = q.parseSort(query, path); err != nil {
+				return nil, false, err
+			}
+			continue
+		} else if key == optionalKey {
+			var ok bool
+			if isOptional, ok = subquery.(bool); !ok {
+				return nil, false, fmt.Errorf("optional expects a boolean, got: %T", subquery)
+			}
+			continue
+		} else if key == wildcardKey {
+			if subquery != nil {
+				return nil, false, fmt.Errorf("wildcard %s expects null, got: %v", path.Follow(key).DisplayString(), subquery)
+			}
+			q.wildcards[path] = true
+			continue
+		} else if strings.HasPrefix(key, projectPrefix) {
+			if err = q.addProjection(path, key, subquery); err != nil {
+				return nil, false, err
+			}
+			outputStructure[key] = nil
+			continue
+		}
 		optional := false
 		outputStructure[key] = nil
 		reverse := false
@@ -128,13 +165,13 @@ func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path
 		if key == "id" {
 			subit, optional, err = q.buildIteratorTreeInternal(subquery, path.Follow(key))
 			if err != nil {
-				return nil, err
+				return nil, false, err
 			}
 		} else {
 			var builtIt graph.Iterator
 			builtIt, optional, err = q.buildIteratorTreeInternal(subquery, path.Follow(key))
 			if err != nil {
-				return nil, err
+				return nil, false, err
 			}
 			subAnd := iterator.NewAnd(q.ses.qs)
 			predFixed := iterator.NewFixed()
@@ -159,10 +196,111 @@ func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path
 		}
 	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	q.queryStructure[path] = outputStructure
-	return it, nil
+	if sortBy != "" {
+		tag := ""
+		if sortBy != "id" {
+			tag = string(path.Follow(sortBy))
+		}
+		return iterator.NewSort(q.ses.qs, it, tag, sortDesc), isOptional, nil
+	}
+	return it, isOptional, nil
+}
+
+// optionalKey is a special key that makes a nested object optional. If no nodes match
+// the object, the parent is still returned, with a null value for the object.
+const optionalKey = "optional"
+
+// wildcardKey is a special key that returns all outgoing properties of the node, in
+// addition to the fields listed in the object. See MaxWildcardValues.
+const wildcardKey = "*"
+
+// projectPrefix is a prefix of keys that copy a value of a field of an enclosing object
+// into a nested object, for example "^name" copies the "name" of the parent, and "^^name"
+// copies the "name" of the grandparent. "^id" copies the ancestor node itself.
+const projectPrefix = "^"
+
+// projection is a field of an ancestor object that is copied into a nested object.
+type projection struct {
+	obj   Path   // path of the ancestor object
+	field string // field of the ancestor, or an empty string for the ancestor node itself
+}
+
+// tag returns a tag that holds the projected value.
+func (p projection) tag() Path {
+	if p.field == "" {
+		return p.obj
+	}
+	return p.obj.Follow(p.field)
+}
+
+// addProjection records a key of the object at path that copies a value of a field of
+// one of the ancestors. The value of the key in the query must be null.
+func (q *Query) addProjection(path Path, key string, subquery interface{}) error {
+	name := path.Follow(key).DisplayString()
+	if subquery != nil {
+		return fmt.Errorf("projected field %s expects null, got: %v", name, subquery)
+	}
+	field := strings.TrimLeft(key, projectPrefix)
+	obj := path
+	for i := len(key) - len(field); i > 0; i-- {
+		var ok bool
+		if obj, ok = obj.parent(); !ok {
+			return fmt.Errorf("projected field %s has no ancestor object", name)
+		}
+	}
+	if field == "id" {
+		field = ""
+	}
+	if q.projections[path] == nil {
+		q.projections[path] = make(map[string]projection)
+	}
+	q.projections[path][key] = projection{obj: obj, field: field}
+	return nil
+}
+
+// checkProjections verifies that all projected fields refer to single values of
+// ancestor objects. It can only be called when the whole query is built.
+func (q *Query) checkProjections() error {
+	for path, fields := range q.projections {
+		for key, p := range fields {
+			if p.field == "" {
+				continue // ancestor node itself
+			}
+			name := path.Follow(key).DisplayString()
+			if _, ok := q.queryStructure[p.obj][p.field]; !ok {
+				return fmt.Errorf("projected field %s is not in the ancestor object", name)
+			} else if _, ok = q.queryStructure[p.tag()]; ok {
+				return fmt.Errorf("projected field %s refers to an object", name)
+			} else if q.isRepeated[p.tag()] {
+				return fmt.Errorf("projected field %s refers to a list", name)
+			}
+		}
+	}
+	return nil
+}
+
+// sortKey is a special key that sets an order of results. Its value is a name of
+// a field in the same object, prefixed with "-" for descending order. The "@" prefix
+// keeps it apart from predicates, so a predicate named "sort" can still be queried.
+const sortKey = "@sort"
+
+func (q *Query) parseSort(query map[string]interface{}, path Path) (string, bool, error) {
+	if path != "" {
+		return "", false, fmt.Errorf("@sort is only supported at the top level, got it at %s", path.DisplayString())
+	}
+	field, ok := query[sortKey].(string)
+	if !ok {
+		return "", false, fmt.Errorf("@sort expects a field name, got: %T", query[sortKey])
+	}
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+	if _, ok := query[field]; !ok || field == sortKey || field == wildcardKey {
+		return "", false, fmt.Errorf("@sort field %q is not in the query", field)
+	}
+	return field, desc, nil
 }
 
 type byRecordLength []ResultPath
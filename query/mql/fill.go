@@ -19,6 +19,7 @@ import (
 	"sort"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/quad"
 )
 
@@ -58,6 +59,9 @@ func (q *Query) treeifyResult(tags map[string]graph.Value) map[ResultPath]string
 			if _, ok := q.queryStructure[currentPath]; ok {
 				// If there's substructure, then copy that in.
 				newStruct := q.copyPathStructure(currentPath)
+				if q.wildcards[currentPath] {
+					q.expandProperties(newStruct, tags[string(currentPath)])
+				}
 				if q.isRepeated[currentPath] && currentPath != "" {
 					switch t := q.queryResult[targetPath][key].(type) {
 					case nil:
@@ -91,6 +95,12 @@ func (q *Query) treeifyResult(tags map[string]graph.Value) map[ResultPath]string
 			if _, ok := q.queryResult[namePath]["id"]; ok {
 				q.queryResult[namePath]["id"] = value
 			}
+			// Copy values of ancestors.
+			for key, p := range q.projections[currentPath] {
+				if v, ok := results[p.tag()]; ok {
+					q.queryResult[namePath][key] = v
+				}
+			}
 		} else {
 			// Just a value.
 			targetPath, key := path.splitLastPath()
@@ -113,6 +123,66 @@ func (q *Query) treeifyResult(tags map[string]graph.Value) map[ResultPath]string
 	return resultPaths
 }
 
+// MaxWildcardValues limits the number of property values returned for each node
+// by a wildcard ("*"). Properties above the limit are dropped, and the query is
+// marked as truncated.
+var MaxWildcardValues = 1000
+
+// expandProperties adds all outgoing properties of the node to the result object, as lists
+// of values keyed by the predicate. Predicates of the node are enumerated first, and then
+// values are fetched for each of them. Fields listed in the query explicitly are not changed.
+func (q *Query) expandProperties(obj map[string]interface{}, node graph.Value) {
+	if node == nil || q.err != nil {
+		return
+	}
+	qs := q.ses.qs
+	var preds []string
+	predVals := make(map[string]graph.Value)
+	err := graph.Iterate(q.ctx, iterator.NewPredicates(qs, iterator.NewFixed(node))).Paths(false).Each(func(p graph.Value) {
+		name := quadValueToNative(qs.NameOf(p))
+		if _, ok := obj[name]; ok {
+			return
+		}
+		preds = append(preds, name)
+		predVals[name] = p
+	})
+	if err != nil {
+		q.err = err
+		return
+	}
+	sort.Strings(preds)
+	left := MaxWildcardValues
+	for _, name := range preds {
+		if left <= 0 {
+			q.truncated = true
+			return
+		}
+		links := iterator.NewAnd(qs,
+			iterator.NewLinksTo(qs, iterator.NewFixed(node), quad.Subject),
+			iterator.NewLinksTo(qs, iterator.NewFixed(predVals[name]), quad.Predicate),
+		)
+		c := graph.Iterate(q.ctx, iterator.NewUnique(iterator.NewHasA(qs, links, quad.Object))).Limit(left)
+		values, err := c.AllValues(qs)
+		if err != nil {
+			q.err = err
+			return
+		}
+		out := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			out = append(out, quadValueToNative(v))
+		}
+		sort.Slice(out, func(i, j int) bool {
+			return out[i].(string) < out[j].(string)
+		})
+		obj[name] = out
+		left -= len(values)
+		if c.Truncated() {
+			q.truncated = true
+			return
+		}
+	}
+}
+
 func (q *Query) buildResults() {
 	for _, v := range q.resultOrder {
 		q.results = append(q.results, q.queryResult[""][v])
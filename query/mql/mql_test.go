@@ -99,6 +99,27 @@ var testQueries = []struct {
 			]
 		`,
 	},
+	{
+		message: "sort nodes by id",
+		query:   `[{"id": null, "<status>": "cool_person", "@sort": "-id"}]`,
+		expect: `
+			[
+				{"id": "<greg>", "<status>": "cool_person"},
+				{"id": "<dani>", "<status>": "cool_person"},
+				{"id": "<bob>", "<status>": "cool_person"}
+			]
+		`,
+	},
+	{
+		message: "sort nodes by a field",
+		query:   `[{"id": null, "<status>": null, "<follows>": "<fred>", "@sort": "-<status>"}]`,
+		expect: `
+			[
+				{"id": "<emily>", "<status>": "smart_person", "<follows>": "<fred>"},
+				{"id": "<bob>", "<status>": "cool_person", "<follows>": "<fred>"}
+			]
+		`,
+	},
 	{
 		message: "get correct follows list",
 		query:   `[{"id": "<charlie>", "<follows>": []}]`,
@@ -158,6 +179,95 @@ var testQueries = []struct {
 			]
 		`,
 	},
+	{
+		message: "project ancestor values into nested reverse links",
+		query: `[{"id": "<charlie>", "<follows>": [{
+			"id": null, "^id": null, "<status>": null,
+			"!<follows>": [{"id": null, "<status>": null, "^<status>": null, "^^id": null}]
+		}]}]`,
+		expect: `
+			[
+				{"id": "<charlie>", "<follows>": [
+					{"id": "<bob>", "^id": "<charlie>", "<status>": "cool_person", "!<follows>": [
+						{"id": "<alice>", "<status>": null, "^<status>": "cool_person", "^^id": "<charlie>"},
+						{"id": "<charlie>", "<status>": null, "^<status>": "cool_person", "^^id": "<charlie>"},
+						{"id": "<dani>", "<status>": "cool_person", "^<status>": "cool_person", "^^id": "<charlie>"}
+					]},
+					{"id": "<dani>", "^id": "<charlie>", "<status>": "cool_person", "!<follows>": [
+						{"id": "<charlie>", "<status>": null, "^<status>": "cool_person", "^^id": "<charlie>"}
+					]}
+				]}
+			]
+		`,
+	},
+	{
+		message: "optional nested objects",
+		query: `[{"id": null, "<status>": "cool_person", "<follows>": [{
+			"id": null,
+			"<follows>": [{"id": null, "optional": true, "<status>": "cool_person", "^^<status>": null}]
+		}]}]`,
+		expect: `
+			[
+				{"id": "<bob>", "<status>": "cool_person", "<follows>": [
+					{"id": "<fred>", "<follows>": [
+						{"id": "<greg>", "<status>": "cool_person", "^^<status>": "cool_person"}
+					]}
+				]},
+				{"id": "<dani>", "<status>": "cool_person", "<follows>": [
+					{"id": "<bob>", "<follows>": null},
+					{"id": "<greg>", "<follows>": null}
+				]}
+			]
+		`,
+	},
+	{
+		message: "expand all properties of a node",
+		query:   `[{"id": "<dani>", "*": null}]`,
+		expect: `
+			[
+				{"id": "<dani>", "<follows>": ["<bob>", "<greg>"], "<status>": ["cool_person"]}
+			]
+		`,
+	},
+	{
+		message: "expand a property with many values",
+		query:   `[{"id": "<greg>", "*": null}]`,
+		expect: `
+			[
+				{"id": "<greg>", "<status>": ["cool_person", "smart_person"]}
+			]
+		`,
+	},
+	{
+		message: "expand a node without properties",
+		query:   `[{"id": "cool_person", "*": null}]`,
+		expect: `
+			[
+				{"id": "cool_person"}
+			]
+		`,
+	},
+	{
+		message: "expand properties without changing explicit fields",
+		query:   `[{"id": "<dani>", "<status>": null, "*": null}]`,
+		expect: `
+			[
+				{"id": "<dani>", "<status>": "cool_person", "<follows>": ["<bob>", "<greg>"]}
+			]
+		`,
+	},
+	{
+		message: "expand properties of nested objects",
+		query:   `[{"id": "<fred>", "!<follows>": [{"id": null, "*": null}]}]`,
+		expect: `
+			[
+				{"id": "<fred>", "!<follows>": [
+					{"id": "<bob>", "<follows>": ["<fred>"], "<status>": ["cool_person"]},
+					{"id": "<emily>", "<follows>": ["<fred>"], "<status>": ["smart_person"]}
+				]}
+			]
+		`,
+	},
 }
 
 func runQuery(g []quad.Quad, qu string) interface{} {
@@ -188,3 +298,89 @@ func TestMQL(t *testing.T) {
 		})
 	}
 }
+
+func TestMQLErrors(t *testing.T) {
+	simpleGraph := testutil.LoadGraph(t, "../../data/testdata.nq")
+	for _, qu := range []string{
+		`[{"id": null, "^id": null}]`,
+		`[{"id": null, "<follows>": {"id": null, "^^id": null}}]`,
+		`[{"id": null, "<follows>": {"id": null, "^<status>": null}}]`,
+		`[{"id": null, "<status>": [], "<follows>": {"id": null, "^<status>": null}}]`,
+		`[{"id": null, "<follows>": {"id": null}, "!<follows>": {"id": null, "^<follows>": null}}]`,
+		`[{"id": null, "<status>": null, "<follows>": {"id": null, "^<status>": "x"}}]`,
+		`[{"id": null, "<follows>": {"id": null, "optional": "yes"}}]`,
+		`[{"id": null, "optional": true}]`,
+		`[{"id": null, "*": "<follows>"}]`,
+		`[{"id": null, "*": null, "@sort": "*"}]`,
+	} {
+		s := makeTestSession(simpleGraph)
+		c := make(chan query.Result, 5)
+		go s.Execute(context.TODO(), qu, c, -1)
+		var err error
+		for result := range c {
+			if result.Err() != nil {
+				err = result.Err()
+			}
+		}
+		if err == nil {
+			t.Errorf("expected an error for %s", qu)
+		} else if !graph.IsQueryError(err) {
+			t.Errorf("expected a query error for %s: %v", qu, err)
+		}
+	}
+}
+
+func TestMQLSyntaxError(t *testing.T) {
+	s := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq"))
+	_, err := s.ShapeOf("[{\"id\": null,\n  \"<follows>\" null}]")
+	qerr, ok := err.(*graph.QueryError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if qerr.Line != 2 || qerr.Column != 15 {
+		t.Errorf("unexpected position: %d:%d", qerr.Line, qerr.Column)
+	}
+}
+
+func TestMQLWildcardLimit(t *testing.T) {
+	defer func(n int) {
+		MaxWildcardValues = n
+	}(MaxWildcardValues)
+	MaxWildcardValues = 1
+
+	s := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq"))
+	c := make(chan query.Result, 5)
+	go s.Execute(context.TODO(), `[{"id": "<dani>", "*": null}]`, c, -1)
+	for result := range c {
+		s.Collate(result)
+	}
+	got, err := s.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{
+		map[string]interface{}{"id": "<dani>", "<follows>": []interface{}{"<bob>"}},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: %v", got)
+	}
+	if !s.Truncated() {
+		t.Error("expected truncated results")
+	}
+}
+
+func TestMQLSortPredicate(t *testing.T) {
+	data := []quad.Quad{
+		quad.MakeIRI("a", "sort", "d", ""),
+		{Subject: quad.IRI("b"), Predicate: quad.String("sort"), Object: quad.IRI("d")},
+		{Subject: quad.IRI("c"), Predicate: quad.String("sort"), Object: quad.IRI("d")},
+	}
+	got := runQuery(data, `[{"id": null, "sort": "<d>", "@sort": "-id"}]`)
+	expect := []interface{}{
+		map[string]interface{}{"id": "<c>", "sort": "<d>"},
+		map[string]interface{}{"id": "<b>", "sort": "<d>"},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results: %v", got)
+	}
+}
@@ -15,6 +15,7 @@
 package mql
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -28,12 +29,16 @@ type (
 
 type Query struct {
 	ses            *Session
+	ctx            context.Context
 	it             graph.Iterator
 	isRepeated     map[Path]bool
 	queryStructure map[Path]map[string]interface{}
 	queryResult    map[ResultPath]map[string]interface{}
+	projections    map[Path]map[string]projection
+	wildcards      map[Path]bool // objects with all properties expanded
 	results        []interface{}
 	resultOrder    []string
+	truncated      bool // some properties of wildcards were dropped
 	err            error
 }
 
@@ -56,6 +61,15 @@ func (p Path) Follow(s string) Path {
 	return Path(fmt.Sprintf("%s\x1E%s", p, s))
 }
 
+// parent returns a path of the enclosing object. It returns false for the top level path.
+func (p Path) parent() (Path, bool) {
+	i := strings.LastIndex(string(p), "\x1E")
+	if i < 0 {
+		return "", false
+	}
+	return p[:i], true
+}
+
 func (p Path) DisplayString() string {
 	return strings.Replace(string(p), "\x1E", ".", -1)
 }
@@ -108,6 +122,7 @@ func (p Path) ToResultPathFromMap(resultMap map[Path]string) ResultPath {
 func NewQuery(ses *Session) *Query {
 	var q Query
 	q.ses = ses
+	q.ctx = context.Background()
 	q.err = nil
 	return &q
 }
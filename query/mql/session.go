@@ -43,22 +43,38 @@ func init() {
 }
 
 type Session struct {
-	qs    graph.QuadStore
-	query *Query
+	qs        graph.QuadStore
+	query     *Query
+	truncated bool // results of the last query are partial
 }
 
 func NewSession(qs graph.QuadStore) *Session {
 	return &Session{qs: qs}
 }
 
+// parseQuery decodes a JSON query. Syntax errors are returned as graph.QueryError.
+func parseQuery(qu string) (interface{}, error) {
+	var out interface{}
+	err := json.Unmarshal([]byte(qu), &out)
+	if e, ok := err.(*json.SyntaxError); ok {
+		// offset is set after the invalid character
+		return nil, graph.NewQueryError(Name, qu, int(e.Offset)-1, err)
+	} else if err != nil {
+		return nil, &graph.QueryError{Language: Name, Err: err}
+	}
+	return out, nil
+}
+
 func (s *Session) ShapeOf(query string) (interface{}, error) {
-	var mqlQuery interface{}
-	err := json.Unmarshal([]byte(query), &mqlQuery)
+	mqlQuery, err := parseQuery(query)
 	if err != nil {
 		return nil, err
 	}
 	s.query = NewQuery(s)
 	s.query.BuildIteratorTree(mqlQuery)
+	if s.query.it != nil {
+		defer s.query.it.Close()
+	}
 	output := make(map[string]interface{})
 	iterator.OutputQueryShapeForIterator(s.query.it, s.qs, output)
 	nodes := make([]iterator.Node, 0)
@@ -72,8 +88,9 @@ func (s *Session) ShapeOf(query string) (interface{}, error) {
 
 func (s *Session) Execute(ctx context.Context, input string, c chan query.Result, limit int) {
 	defer close(c)
-	var mqlQuery interface{}
-	if err := json.Unmarshal([]byte(input), &mqlQuery); err != nil {
+	s.truncated = false
+	mqlQuery, err := parseQuery(input)
+	if err != nil {
 		select {
 		case c <- query.ErrorResult(err):
 		case <-ctx.Done():
@@ -81,8 +98,12 @@ func (s *Session) Execute(ctx context.Context, input string, c chan query.Result
 		return
 	}
 	s.query = NewQuery(s)
+	s.query.ctx = ctx
 	s.query.BuildIteratorTree(mqlQuery)
 	if s.query.isError() {
+		if s.query.it != nil {
+			s.query.it.Close()
+		}
 		select {
 		case c <- query.ErrorResult(s.query.err):
 		case <-ctx.Done():
@@ -91,12 +112,14 @@ func (s *Session) Execute(ctx context.Context, input string, c chan query.Result
 	}
 
 	it := s.query.it
-	err := graph.Iterate(ctx, it).Limit(limit).TagEach(func(tags map[string]graph.Value) {
+	chain := graph.Iterate(ctx, it).Limit(limit)
+	err = chain.TagEach(func(tags map[string]graph.Value) {
 		select {
 		case c <- query.TagMapResult(tags):
 		case <-ctx.Done():
 		}
 	})
+	s.truncated = chain.Truncated()
 	if err != nil {
 		select {
 		case c <- query.ErrorResult(err):
@@ -105,6 +128,14 @@ func (s *Session) Execute(ctx context.Context, input string, c chan query.Result
 	}
 }
 
+var _ query.Truncater = (*Session)(nil)
+
+// Truncated reports if results of the last executed query were dropped because of the results limit,
+// or because of the limit of properties returned for wildcards (see MaxWildcardValues).
+func (s *Session) Truncated() bool {
+	return s.truncated || (s.query != nil && s.query.truncated)
+}
+
 func (s *Session) FormatREPL(result query.Result) string {
 	tags, ok := result.Result().(map[string]graph.Value)
 	if !ok {
@@ -0,0 +1,68 @@
+package query
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// NodesTag is the tag of results that is used as a node by CollectNodes, if it's set.
+const NodesTag = "id"
+
+// CollectNodes executes the query and returns a deduplicated list of nodes returned by it.
+//
+// For results with tags, the value of NodesTag is used, if it's set; otherwise, values of
+// all tags are used. Results that are not nodes, for example, values returned by the script,
+// are skipped.
+func CollectNodes(ctx context.Context, ses Session, query string, limit int) ([]graph.Value, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := make(chan Result, 5)
+	go ses.Execute(ctx, query, c, limit)
+	defer func() {
+		// the session will close the channel when it notices the cancellation
+		cancel()
+		for range c {
+		}
+	}()
+
+	var (
+		out  []graph.Value
+		seen = make(map[interface{}]struct{})
+	)
+	add := func(v graph.Value) {
+		if v == nil {
+			return
+		}
+		key := graph.ToKey(v)
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		out = append(out, v)
+	}
+	for res := range c {
+		if err := res.Err(); err != nil {
+			return nil, err
+		}
+		switch r := res.Result().(type) {
+		case map[string]graph.Value:
+			if v, ok := r[NodesTag]; ok {
+				add(v)
+				continue
+			}
+			keys := make([]string, 0, len(r))
+			for k := range r {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				add(r[k])
+			}
+		case graph.Value:
+			add(r)
+		}
+	}
+	return out, nil
+}
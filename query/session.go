@@ -19,8 +19,10 @@ import (
 	"context"
 	"errors"
 	"io"
+	"sort"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
 )
 
 var ErrParseMore = errors.New("query: more input required")
@@ -57,6 +59,67 @@ type Session interface {
 	Execute(ctx context.Context, query string, out chan Result, limit int)
 }
 
+// PreparedQuery is a query that was parsed and planned once, and can be executed
+// multiple times with different parameters.
+type PreparedQuery interface {
+	// Params returns a sorted list of parameter names of the query.
+	Params() []string
+	// Execute runs the query with given parameter values and returns individual
+	// results on the channel. All parameters must be set.
+	//
+	// Channel will be closed when function returns.
+	Execute(ctx context.Context, params map[string]quad.Value, out chan Result, limit int)
+	// Close releases resources associated with the query.
+	Close() error
+}
+
+// PrepareOptions controls how prepared queries are planned.
+type PrepareOptions struct {
+	// MaxStale is the maximal advance of the store horizon (the number of changes
+	// applied to the store for sequential horizons) before the query plan is rebuilt.
+	// Negative value disables re-planning. It only affects queries that depend
+	// on the store content. See path.Prepared for details.
+	MaxStale int64
+}
+
+// Preparer is an optional interface for sessions that support prepared queries.
+type Preparer interface {
+	Prepare(query string, opt PrepareOptions) (PreparedQuery, error)
+}
+
+// Explainer is an optional interface for sessions that can return a query plan
+// without executing the query.
+type Explainer interface {
+	// Explain runs the query script, but instead of executing the query returns
+	// descriptions of optimized iterator trees with estimated costs.
+	// Iterators are never advanced, thus the data is not read.
+	Explain(ctx context.Context, query string) ([]graph.Description, error)
+}
+
+// Truncater is an optional interface for sessions that can report if results of
+// the last executed query are partial.
+type Truncater interface {
+	// Truncated reports if the last query has stopped early and some results were
+	// dropped, for example because of a limit or a timeout.
+	Truncated() bool
+}
+
+// Warner is an optional interface for sessions that can report non-fatal problems
+// found while executing and collating results of the last query.
+type Warner interface {
+	// Warnings returns a list of warnings for the last query, if any.
+	Warnings() []string
+}
+
+// Streamer is an optional interface for HTTP sessions that can format each result
+// independently of others, thus results can be sent to the client as soon as they
+// are produced.
+type Streamer interface {
+	// FormatResult converts a single result to a value that can be encoded to JSON.
+	// It returns false if the result produces no output.
+	FormatResult(Result) (interface{}, bool)
+}
+
 // TODO(dennwc): review HTTP interface (Collate is weird)
 // TODO(dennwc): specify exact type to return from ShapeOf
 // TODO(dennwc): add context to ShapeOf?
@@ -118,11 +181,12 @@ func GetLanguage(lang string) *Language {
 	return nil
 }
 
-// Languages returns names of registered query languages.
+// Languages returns sorted names of registered query languages.
 func Languages() []string {
 	out := make([]string, 0, len(languages))
 	for name := range languages {
 		out = append(out, name)
 	}
+	sort.Strings(out)
 	return out
 }
@@ -61,7 +61,7 @@ func (s *Session) Parse(input string) error {
 				if (i - 10) > min {
 					min = i - 10
 				}
-				return fmt.Errorf("too many close parentheses at char %d: %s", i, input[min:i])
+				return graph.NewQueryError(Name, input, i, fmt.Errorf("too many close parentheses: %s", input[min:i]))
 			}
 		}
 	}
@@ -71,7 +71,7 @@ func (s *Session) Parse(input string) error {
 	if len(ParseString(input)) > 0 {
 		return nil
 	}
-	return errors.New("invalid syntax")
+	return &graph.QueryError{Language: Name, Err: errors.New("invalid syntax")}
 }
 
 func (s *Session) Execute(ctx context.Context, input string, out chan query.Result, limit int) {
@@ -58,6 +58,9 @@ type APIv2 struct {
 	// query
 	timeout time.Duration
 	limit   int
+	memory  int64
+
+	trusted TrustedProxies
 }
 
 func (api *APIv2) SetReadOnly(ro bool) {
@@ -72,6 +75,18 @@ func (api *APIv2) SetQueryTimeout(dt time.Duration) {
 func (api *APIv2) SetQueryLimit(n int) {
 	api.limit = n
 }
+
+// SetQueryMemory limits an approximate memory size of results buffered by a single query.
+// Zero value means no limit. See graph.Budget.
+func (api *APIv2) SetQueryMemory(n int64) {
+	api.memory = n
+}
+
+// SetTrustedProxies sets proxies that are allowed to set the actor of requests.
+// See ActorForRequest.
+func (api *APIv2) SetTrustedProxies(p TrustedProxies) {
+	api.trusted = p
+}
 func (api *APIv2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	api.r.ServeHTTP(w, r)
 }
@@ -166,13 +181,13 @@ func writerFrom(w http.ResponseWriter, r *http.Request, acceptName string) io.Wr
 }
 
 func (api *APIv2) handleForRequest(r *http.Request) (*graph.Handle, error) {
-	return HandleForRequest(api.h, api.wtyp, api.wopt, r)
+	return HandleForRequest(api.h, api.wtyp, api.wopt, r, api.trusted)
 }
 
 func (api *APIv2) ServeWrite(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if api.ro {
-		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
 		return
 	}
 	format := getFormat(r, "", hdrContentType)
@@ -193,7 +208,7 @@ func (api *APIv2) ServeWrite(w http.ResponseWriter, r *http.Request) {
 		jsonResponse(w, http.StatusBadRequest, err)
 		return
 	}
-	qw := graph.NewWriter(h.QuadWriter)
+	qw := graph.NewWriter(h.QuadWriter, &graph.WriterOptions{Batch: api.batch})
 	defer qw.Close()
 	n, err := quad.CopyBatch(qw, qr, api.batch)
 	if err != nil {
@@ -212,7 +227,7 @@ func (api *APIv2) ServeWrite(w http.ResponseWriter, r *http.Request) {
 func (api *APIv2) ServeDelete(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if api.ro {
-		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
 		return
 	}
 	format := getFormat(r, "", hdrContentType)
@@ -247,7 +262,7 @@ func (api *APIv2) ServeDelete(w http.ResponseWriter, r *http.Request) {
 func (api *APIv2) ServeNodeDelete(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if api.ro {
-		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		jsonResponse(w, http.StatusForbidden, graph.ErrReadOnly)
 		return
 	}
 	format := getFormat(r, "", hdrContentType)
@@ -361,27 +376,37 @@ func (api *APIv2) ServeFormats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(out)
 }
 
-func (api *APIv2) queryContext(r *http.Request) (ctx context.Context, cancel func()) {
-	ctx = context.TODO() // TODO(dennwc): get from request
+func (api *APIv2) queryContext(r *http.Request) (context.Context, func()) {
+	ctx := context.TODO() // TODO(dennwc): get from request
+	var cancel func()
 	if api.timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, api.timeout)
 	} else {
 		ctx, cancel = context.WithCancel(ctx)
 	}
-	return ctx, cancel
+	budget := graph.NewBudget(api.memory, graph.GlobalBudget)
+	ctx = graph.WithBudget(ctx, budget)
+	return ctx, func() {
+		cancel()
+		budget.Close()
+	}
 }
 
 func defaultErrorFunc(w query.ResponseWriter, err error) {
-	data, _ := json.Marshal(err.Error())
-	w.WriteHeader(http.StatusBadRequest)
-	w.Write([]byte(`{"error": `))
-	w.Write(data)
-	w.Write([]byte("}\n"))
+	w.WriteHeader(ErrorStatus(err, http.StatusBadRequest))
+	json.NewEncoder(w).Encode(errorResponse{Error: err.Error(), Code: graph.ErrorCode(err)})
 }
 
-func writeResults(w io.Writer, r interface{}) {
+// writeResults writes query results. Results are encoded before anything is written,
+// thus an encoding error is returned to the client with a proper status.
+func writeResults(w http.ResponseWriter, r interface{}) {
+	data, err := json.Marshal(JSONValue(r))
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
 	w.Write([]byte(`{"result": `))
-	json.NewEncoder(w).Encode(r)
+	w.Write(data)
 	w.Write([]byte("}\n"))
 }
 
@@ -1,15 +1,20 @@
 package cayleyhttp
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/client"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphtest"
 	"github.com/cayleygraph/cayley/graph/memstore"
 	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/query/gizmo"
 	"github.com/cayleygraph/cayley/writer"
 	"github.com/stretchr/testify/require"
 )
@@ -64,3 +69,53 @@ func TestV2Read(t *testing.T) {
 	sort.Sort(quad.ByQuadString(expect))
 	require.Equal(t, expect, quads)
 }
+
+func TestV2Query(t *testing.T) {
+	h := makeHandle(t, quad.MakeIRI("alice", "follows", "bob", ""))
+	defer h.Close()
+	for _, timeout := range []time.Duration{0, time.Minute} {
+		api := NewAPIv2(h)
+		api.SetQueryTimeout(timeout)
+		api.SetQueryMemory(1 << 20)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/v2/query?lang=gizmo",
+			strings.NewReader(`g.V("<alice>").Out("<follows>").All()`))
+		api.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code, "timeout: %v: %s", timeout, w.Body.String())
+		var out struct {
+			Result []map[string]string `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+		require.Equal(t, []map[string]string{{"id": "<bob>"}}, out.Result)
+	}
+}
+
+func TestActorForRequest(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	require.NoError(t, err)
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	require.Error(t, err)
+
+	newReq := func(addr string) *http.Request {
+		r := httptest.NewRequest("POST", "/api/v2/write", nil)
+		r.RemoteAddr = addr
+		r.Header.Set(HeaderActor, "alice")
+		return r
+	}
+	for _, c := range []struct {
+		addr    string
+		trusted TrustedProxies
+		actor   string
+	}{
+		{addr: "192.0.2.1:1234", trusted: nil, actor: ""},
+		{addr: "192.0.2.1:1234", trusted: trusted, actor: "alice"},
+		{addr: "10.1.2.3:1234", trusted: trusted, actor: "alice"},
+		{addr: "192.0.2.2:1234", trusted: trusted, actor: ""},
+	} {
+		require.Equal(t, c.actor, ActorForRequest(newReq(c.addr), c.trusted), "%s", c.addr)
+	}
+
+	r := newReq("10.1.2.3:1234")
+	r.SetBasicAuth("bob", "")
+	require.Equal(t, "bob", ActorForRequest(r, trusted))
+}
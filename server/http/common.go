@@ -3,34 +3,144 @@ package cayleyhttp
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/http"
 )
 
+// ErrorStatus returns an HTTP status code for a class of the error (see graph.ErrorCode).
+// If the class of the error is not known, def is returned.
+func ErrorStatus(err error, def int) int {
+	switch graph.ErrorCode(err) {
+	case graph.CodeQuery, graph.CodeInvalidAction:
+		return http.StatusBadRequest
+	case graph.CodeReadOnly:
+		return http.StatusForbidden
+	case graph.CodeQuadNotExist, graph.CodeNodeNotExist:
+		return http.StatusNotFound
+	case graph.CodeQuadExists, graph.CodeDatabaseExists:
+		return http.StatusConflict
+	case graph.CodeCancelled, graph.CodeNotInitialized:
+		return http.StatusServiceUnavailable
+	case graph.CodeTimeout:
+		return http.StatusGatewayTimeout
+	case graph.CodeBudgetExceeded:
+		return http.StatusRequestEntityTooLarge
+	case graph.CodeWrongBackend, graph.CodeIncompatibleVersion:
+		return http.StatusInternalServerError
+	}
+	return def
+}
+
+// errorResponse is a JSON response with an error. Code is a stable machine-readable
+// class of the error, see graph.ErrorCode.
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"error_code,omitempty"`
+}
+
+// jsonResponse writes an error with a given status code. If the class of the error
+// is known, the status code is replaced with the one for the class (see ErrorStatus).
 func jsonResponse(w http.ResponseWriter, code int, err interface{}) {
-	w.Header().Set("Content-Type", contentTypeJSON)
-	w.WriteHeader(code)
-	w.Write([]byte(`{"error": `))
-	var s string
+	var resp errorResponse
 	switch err := err.(type) {
 	case string:
-		s = err
+		resp.Error = err
 	case error:
-		s = err.Error()
+		resp.Error = err.Error()
+		resp.Code = graph.ErrorCode(err)
+		code = ErrorStatus(err, code)
 	default:
-		s = fmt.Sprint(err)
+		resp.Error = fmt.Sprint(err)
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HeaderActor is a request header that sets the actor recorded with changes made by the request.
+// The user name of HTTP basic auth takes precedence over it.
+const HeaderActor = "X-Cayley-Actor"
+
+// TrustedProxies is a list of networks of reverse proxies that authenticate clients
+// and pass their identity to Cayley. See ActorForRequest.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a list of IP addresses and networks in CIDR notation.
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	var out TrustedProxies
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address: %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network: %q", s)
+		}
+		out = append(out, n)
 	}
-	data, _ := json.Marshal(s)
-	w.Write(data)
-	w.Write([]byte(`}`))
+	return out, nil
 }
 
-func HandleForRequest(h *graph.Handle, wtyp string, wopt graph.Options, r *http.Request) (*graph.Handle, error) {
+// Trusts checks if the request was sent by one of the trusted proxies.
+func (p TrustedProxies) Trusts(r *http.Request) bool {
+	if len(p) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActorForRequest returns an identity of the client that is recorded with changes made by the request.
+//
+// Cayley does not authenticate clients, thus both the user name of HTTP basic auth and the
+// HeaderActor are self-reported. They are only accepted from trusted proxies, which are
+// expected to authenticate clients and to set them. For other requests, the actor is empty.
+func ActorForRequest(r *http.Request, trusted TrustedProxies) string {
+	if !trusted.Trusts(r) {
+		return ""
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return r.Header.Get(HeaderActor)
+}
+
+// HandleForRequest returns a graph handle for the request. Deltas written through
+// the handle are attributed to the actor of the request (see ActorForRequest).
+func HandleForRequest(h *graph.Handle, wtyp string, wopt graph.Options, r *http.Request, trusted TrustedProxies) (*graph.Handle, error) {
+	actor := ActorForRequest(r, trusted)
 	g, ok := h.QuadStore.(httpgraph.QuadStore)
 	if !ok {
-		return h, nil
+		if actor == "" {
+			return h, nil
+		}
+		return &graph.Handle{QuadStore: h.QuadStore, QuadWriter: graph.WriterWithActor(h.QuadWriter, actor)}, nil
 	}
 	qs, err := g.ForRequest(r)
 	if err != nil {
@@ -41,5 +151,41 @@ func HandleForRequest(h *graph.Handle, wtyp string, wopt graph.Options, r *http.
 		qs.Close()
 		return nil, err
 	}
-	return &graph.Handle{QuadStore: qs, QuadWriter: qw}, nil
+	return &graph.Handle{QuadStore: qs, QuadWriter: graph.WriterWithActor(qw, actor)}, nil
+}
+
+// JSONValue converts a query result to a value that can be encoded to JSON. Results may
+// contain typed values as native numbers, booleans and dates, and quads as objects with
+// a value per direction. Typed values that have no JSON representation, like NaN and
+// infinite floats, are replaced with their lexical forms.
+//
+// Objects and arrays of the result are converted in place.
+func JSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		return jsonFloat(v)
+	case float32:
+		return jsonFloat(float64(v))
+	case map[string]interface{}:
+		for k, sv := range v {
+			v[k] = JSONValue(sv)
+		}
+	case []interface{}:
+		for i, sv := range v {
+			v[i] = JSONValue(sv)
+		}
+	}
+	return v
+}
+
+func jsonFloat(v float64) interface{} {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "INF"
+	case math.IsInf(v, -1):
+		return "-INF"
+	}
+	return v
 }
@@ -15,6 +15,8 @@
 package writer
 
 import (
+	"time"
+
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/quad"
 )
@@ -55,8 +57,9 @@ func NewSingleReplication(qs graph.QuadStore, opts graph.Options) (graph.QuadWri
 func (s *Single) AddQuad(q quad.Quad) error {
 	deltas := make([]graph.Delta, 1)
 	deltas[0] = graph.Delta{
-		Quad:   q,
-		Action: graph.Add,
+		Quad:      q,
+		Action:    graph.Add,
+		Timestamp: time.Now(),
 	}
 	return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
 }
@@ -66,14 +69,15 @@ func (s *Single) AddQuadSet(set []quad.Quad) error {
 	for _, q := range set {
 		tx.AddQuad(q)
 	}
-	return s.qs.ApplyDeltas(tx.Deltas, s.ignoreOpts)
+	return s.qs.ApplyDeltas(stampDeltas(tx.Deltas, false), s.ignoreOpts)
 }
 
 func (s *Single) RemoveQuad(q quad.Quad) error {
 	deltas := make([]graph.Delta, 1)
 	deltas[0] = graph.Delta{
-		Quad:   q,
-		Action: graph.Delete,
+		Quad:      q,
+		Action:    graph.Delete,
+		Timestamp: time.Now(),
 	}
 	return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
 }
@@ -115,5 +119,23 @@ func (s *Single) Close() error {
 }
 
 func (s *Single) ApplyTransaction(t *graph.Transaction) error {
-	return s.qs.ApplyDeltas(t.Deltas, s.ignoreOpts)
+	return s.qs.ApplyDeltas(stampDeltas(t.Deltas, true), s.ignoreOpts)
+}
+
+// stampDeltas sets the current time on deltas without a timestamp.
+// If copyOnWrite is set, the slice is copied before it is modified.
+func stampDeltas(deltas []graph.Delta, copyOnWrite bool) []graph.Delta {
+	now := time.Now()
+	copied := !copyOnWrite
+	for i := range deltas {
+		if !deltas[i].Timestamp.IsZero() {
+			continue
+		}
+		if !copied {
+			deltas = append([]graph.Delta(nil), deltas...)
+			copied = true
+		}
+		deltas[i].Timestamp = now
+	}
+	return deltas
 }